@@ -3,7 +3,6 @@ package main
 import (
 	"os"
 
-	"github.com/seal-io/walrus/utils/clis"
 	"github.com/seal-io/walrus/utils/log"
 	"github.com/seal-io/walrus/utils/signals"
 
@@ -13,7 +12,7 @@ import (
 func main() {
 	cmd := server.Command()
 
-	app := clis.AsApp(cmd)
+	app := server.App(cmd)
 	if err := app.RunContext(signals.Handler(), os.Args); err != nil {
 		log.Fatal(err)
 	}
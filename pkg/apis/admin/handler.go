@@ -0,0 +1,489 @@
+package admin
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/render"
+	"github.com/seal-io/walrus/utils/errorx"
+	"golang.org/x/exp/slices"
+
+	"github.com/seal-io/hermitcrab/pkg/apis/runtime"
+	"github.com/seal-io/hermitcrab/pkg/events"
+	"github.com/seal-io/hermitcrab/pkg/maintenance"
+	"github.com/seal-io/hermitcrab/pkg/provider"
+	"github.com/seal-io/hermitcrab/pkg/provider/addrs"
+	"github.com/seal-io/hermitcrab/pkg/provider/drift"
+	"github.com/seal-io/hermitcrab/pkg/provider/metadata"
+	"github.com/seal-io/hermitcrab/pkg/provider/purge"
+	"github.com/seal-io/hermitcrab/pkg/provider/storage"
+	"github.com/seal-io/hermitcrab/pkg/registry"
+	"github.com/seal-io/hermitcrab/pkg/support"
+	"github.com/seal-io/hermitcrab/pkg/tunable"
+)
+
+func Handle(service *provider.Service) *Handler {
+	return &Handler{
+		s: service,
+	}
+}
+
+type Handler struct {
+	s *provider.Service
+}
+
+// GetCLIConfig returns the CLI configuration snippet,
+// which installs the providers from this service as a network mirror.
+func (h *Handler) GetCLIConfig(req GetCLIConfigRequest) (render.Render, error) {
+	cfg := fmt.Sprintf(`# Paste the following block into %s.
+provider_installation {
+  network_mirror {
+    url = "https://%s/v1/providers/"
+  }
+}
+`, cliConfigFiles[req.Flavor], req.Host)
+
+	return render.Data{
+		ContentType: "text/plain; charset=utf-8",
+		Data:        []byte(cfg),
+	}, nil
+}
+
+// GetProviders returns the stored providers in key order,
+// which are filtered by the prefixes of the hostname, namespace and type.
+func (h *Handler) GetProviders(req GetProvidersRequest) ([]Provider, int, error) {
+	as, err := h.s.Metadata.ListProviders(req.Context)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	degraded := map[string]bool{}
+	for _, d := range h.s.Metadata.GetDegradedProviders(req.Context) {
+		degraded[d.Hostname+"/"+d.Namespace+"/"+d.Type] = true
+	}
+
+	ps := make([]Provider, 0, len(as))
+
+	for _, a := range as {
+		if !strings.HasPrefix(a.Hostname, req.Hostname) ||
+			!strings.HasPrefix(a.Namespace, req.Namespace) ||
+			!strings.HasPrefix(a.Type, req.Type) {
+			continue
+		}
+
+		ps = append(ps, Provider{
+			Hostname:  a.Hostname,
+			Namespace: a.Namespace,
+			Type:      a.Type,
+			Degraded:  degraded[a.TypedKey()],
+		})
+	}
+
+	return paginate(ps, req.RequestPagination), len(ps), nil
+}
+
+// GetProviderVersions returns the versions of the provider, newest first,
+// each version is stamped with the CLI versions compatible with its protocols.
+func (h *Handler) GetProviderVersions(req GetProviderVersionsRequest) ([]ProviderVersion, int, error) {
+	vs, err := h.s.Metadata.GetVersions(req.Context, metadata.GetVersionsOptions{
+		Hostname:  req.Hostname,
+		Namespace: req.Namespace,
+		Type:      req.Type,
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	metadata.SortVersions(vs)
+
+	page := paginate(vs, req.RequestPagination)
+
+	pvs := make([]ProviderVersion, len(page))
+	for i := range page {
+		pvs[i] = ProviderVersion{
+			Version:       page[i],
+			Compatibility: metadata.CompatibilityOf(page[i].Protocols),
+		}
+	}
+
+	return pvs, len(vs), nil
+}
+
+// GetProviderHistory returns the recent sync attempts of the provider, newest first.
+func (h *Handler) GetProviderHistory(req GetProviderHistoryRequest) ([]metadata.SyncAttempt, error) {
+	return h.s.Metadata.GetSyncHistory(req.Context, metadata.GetSyncHistoryOptions{
+		Hostname:  req.Hostname,
+		Namespace: req.Namespace,
+		Type:      req.Type,
+	})
+}
+
+// GetProviderDiff returns the versions and platforms of the provider added or removed between two sync points,
+// which is generated from the sync history for reviewing the changes.
+func (h *Handler) GetProviderDiff(req GetProviderDiffRequest) (metadata.SyncDiff, error) {
+	return h.s.Metadata.GetSyncDiff(req.Context, metadata.GetSyncDiffOptions{
+		Hostname:  req.Hostname,
+		Namespace: req.Namespace,
+		Type:      req.Type,
+		From:      req.FromTime,
+		To:        req.ToTime,
+	})
+}
+
+// GetProviderKeys returns the GPG public keys signing the mirrored archives of the provider,
+// so that the policies verifying the keys can consume them from the mirror.
+func (h *Handler) GetProviderKeys(req GetProviderKeysRequest) (GetProviderKeysResponse, error) {
+	ks, err := h.s.Metadata.GetSigningKeys(req.Context, metadata.GetSigningKeysOptions{
+		Hostname:  req.Hostname,
+		Namespace: req.Namespace,
+		Type:      req.Type,
+	})
+	if err != nil {
+		return GetProviderKeysResponse{}, err
+	}
+
+	return GetProviderKeysResponse{GPGPublicKeys: ks}, nil
+}
+
+// GetProvenance returns where the cached archives of the provider came from for the supply-chain audits,
+// the provenance survives the eviction of the archive.
+func (h *Handler) GetProvenance(req GetProvenanceRequest) (GetProvenanceResponse, error) {
+	if req.Filename != "" {
+		r, err := h.s.Provenance.Get(req.Context, req.Address(), req.Filename)
+		if err != nil {
+			return nil, err
+		}
+
+		return GetProvenanceResponse{r}, nil
+	}
+
+	return h.s.Provenance.List(req.Context, req.Address())
+}
+
+// PinArchive downloads the archive from the given URL into the cache regardless of the metadata,
+// the archive must match the given checksum,
+// which back-fills the archives removed from the upstream.
+func (h *Handler) PinArchive(req PinArchiveRequest) (PinArchiveResponse, error) {
+	if h.s.Offline {
+		return PinArchiveResponse{}, errorx.HttpErrorf(http.StatusBadRequest,
+			"pinning archive is unavailable in offline mode")
+	}
+
+	if err := maintenance.Error("pinning archive"); err != nil {
+		return PinArchiveResponse{}, err
+	}
+
+	ar, err := h.s.Storage.PinArchive(req.Context, storage.LoadArchiveOptions{
+		Hostname:    req.Hostname,
+		Namespace:   req.Namespace,
+		Type:        req.Type,
+		Filename:    req.Filename,
+		Shasum:      req.Shasum,
+		DownloadURL: req.URL,
+	})
+	if err != nil {
+		if errors.Is(err, storage.ErrDownloadFailed) {
+			return PinArchiveResponse{}, errorx.WrapHttpError(http.StatusBadGateway, err, "error pinning archive")
+		}
+
+		return PinArchiveResponse{}, err
+	}
+
+	if ar.Reader != nil {
+		_ = ar.Reader.Close()
+	}
+
+	v, os, arch, _ := registry.ParseArchiveFilename(req.Type, req.Filename)
+
+	return PinArchiveResponse{
+		Version:  v,
+		OS:       os,
+		Arch:     arch,
+		Filename: req.Filename,
+		Shasum:   req.Shasum,
+		Size:     ar.ContentLength,
+	}, nil
+}
+
+// ImportShasums imports the SHA256SUMS file of the provider version,
+// which backfills the shasums of the platforms omitted by the upstream.
+func (h *Handler) ImportShasums(req ImportShasumsRequest) (ImportShasumsResponse, error) {
+	ns, err := h.s.Metadata.ImportShasums(req.Context, metadata.ImportShasumsOptions{
+		Hostname:  req.Hostname,
+		Namespace: req.Namespace,
+		Type:      req.Type,
+		Version:   req.Version,
+		Content:   []byte(req.Content),
+	})
+	if err != nil {
+		return ImportShasumsResponse{}, err
+	}
+
+	return ImportShasumsResponse{Imported: ns}, nil
+}
+
+// SetCanary marks or unmarks the provider version as canary,
+// which is only visible to the clients presenting the canary token.
+func (h *Handler) SetCanary(req SetCanaryRequest) error {
+	return h.s.Metadata.SetCanary(req.Context, metadata.SetCanaryOptions{
+		Hostname:  req.Hostname,
+		Namespace: req.Namespace,
+		Type:      req.Type,
+		Version:   req.Version,
+		Canary:    req.Canary,
+	})
+}
+
+// PublishPlatform stores the provider platform published by the replicating instance,
+// the archive must be published in advance, so that the platform is never advertised without the archive.
+func (h *Handler) PublishPlatform(req PublishPlatformRequest) error {
+	if err := maintenance.Error("publishing"); err != nil {
+		return err
+	}
+
+	ok := h.s.Storage.HasArchive(req.Context, storage.LoadArchiveOptions{
+		Hostname:  req.Hostname,
+		Namespace: req.Namespace,
+		Type:      req.Type,
+		Filename:  req.Platform.Filename,
+	})
+	if !ok {
+		return errorx.HttpErrorf(http.StatusConflict, "archive %s is not published", req.Platform.Filename)
+	}
+
+	return h.s.Metadata.Publish(req.Context, metadata.PublishOptions{
+		Hostname:  req.Hostname,
+		Namespace: req.Namespace,
+		Type:      req.Type,
+		Version:   req.Version,
+		Protocols: req.Protocols,
+		Platform:  req.Platform,
+	})
+}
+
+// PublishArchive returns the handler to store the archive published by the replicating instance,
+// the request body is the archive, and the X-Checksum-Sha256 header is the sha256 checksum in hex.
+func PublishArchive(service *provider.Service) runtime.ErrorHandle {
+	return func(c *gin.Context) error {
+		addr := addrs.Address{
+			Hostname:  c.Param("hostname"),
+			Namespace: c.Param("namespace"),
+			Type:      c.Param("type"),
+		}.Normalize()
+		if err := addr.Validate(); err != nil {
+			return errorx.WrapHttpError(http.StatusBadRequest, err, "invalid provider")
+		}
+
+		filename := c.Param("filename")
+		if _, _, _, ok := registry.ParseArchiveFilename(addr.Type, filename); !ok {
+			return errorx.HttpErrorf(http.StatusBadRequest,
+				"invalid filename: must be terraform-provider-<TYPE>_<VERSION>_<OS>_<ARCH>.zip")
+		}
+
+		sum := strings.ToLower(c.GetHeader("X-Checksum-Sha256"))
+		if bs, err := hex.DecodeString(sum); err != nil || len(bs) != 32 {
+			return errorx.HttpErrorf(http.StatusBadRequest,
+				"invalid X-Checksum-Sha256: must be a sha256 checksum in hex")
+		}
+
+		if err := maintenance.Error("publishing"); err != nil {
+			return err
+		}
+
+		err := service.Storage.StoreArchive(c, storage.LoadArchiveOptions{
+			Hostname:  addr.Hostname,
+			Namespace: addr.Namespace,
+			Type:      addr.Type,
+			Filename:  filename,
+			Shasum:    sum,
+		}, c.Request.Body)
+		if err != nil {
+			return err
+		}
+
+		c.Status(http.StatusNoContent)
+
+		return nil
+	}
+}
+
+// GetDrift reports the drift between the metadata and the cached archives.
+func (h *Handler) GetDrift(req GetDriftRequest) (drift.Report, error) {
+	return drift.Check(req.Context, h.s, drift.Options{
+		Verify: req.Verify,
+	})
+}
+
+// RepairDrift repairs the drift between the metadata and the cached archives,
+// and returns the repaired report.
+func (h *Handler) RepairDrift(req RepairDriftRequest) (drift.Report, error) {
+	if err := maintenance.Error("repairing drift"); err != nil {
+		return drift.Report{}, err
+	}
+
+	return drift.Check(req.Context, h.s, drift.Options{
+		Verify: req.Verify,
+		Repair: true,
+	})
+}
+
+// PurgeCache purges the cached archives matching the filters of the request,
+// and returns the purged archives.
+func (h *Handler) PurgeCache(req PurgeCacheRequest) (purge.Report, error) {
+	opts := req.Options()
+
+	if !opts.DryRun {
+		if err := maintenance.Error("purging cache"); err != nil {
+			return purge.Report{}, err
+		}
+	}
+
+	if opts.Metadata && h.s.Offline {
+		return purge.Report{}, errorx.HttpErrorf(http.StatusBadRequest,
+			"purging metadata is not allowed in offline mode")
+	}
+
+	return purge.Run(req.Context, h.s, opts)
+}
+
+// GetPlatforms returns the platforms observed from the archive downloads, the most requested first,
+// which is empty if the platform inference is disabled.
+func (h *Handler) GetPlatforms(_ GetPlatformsRequest) ([]provider.ObservedPlatform, error) {
+	return h.s.ObservedPlatforms(), nil
+}
+
+// GetSyncs returns the ongoing syncs, the earliest started first.
+func (h *Handler) GetSyncs(req GetSyncsRequest) ([]metadata.SyncActivity, error) {
+	return h.s.Metadata.GetSyncActivities(req.Context), nil
+}
+
+// GetDegradedSyncs returns the providers exhausting the sync error budget,
+// the scheduled sync of which is backed off until the retry time.
+func (h *Handler) GetDegradedSyncs(req GetDegradedSyncsRequest) ([]metadata.DegradedProvider, error) {
+	return h.s.Metadata.GetDegradedProviders(req.Context), nil
+}
+
+// GetSupportBundle returns the support bundle in tar.gz format for attaching to the issues,
+// which collects the sanitized configuration, the recent logs, the bolt stats, the cache stats,
+// the sync history and the goroutine dumps.
+func (h *Handler) GetSupportBundle(req GetSupportBundleRequest) (render.Render, error) {
+	var b bytes.Buffer
+
+	err := support.Collect(req.Context, &b, support.CollectOptions{
+		Metadata: h.s.Metadata,
+		Storage:  h.s.Storage,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error collecting support bundle: %w", err)
+	}
+
+	return runtime.ResponseFile{
+		ContentType:   "application/gzip",
+		ContentLength: int64(b.Len()),
+		Filename:      "hermitcrab-support-" + time.Now().UTC().Format("20060102T150405Z") + ".tar.gz",
+		Reader:        io.NopCloser(&b),
+	}, nil
+}
+
+// GetMaintenance returns the maintenance status.
+func (h *Handler) GetMaintenance(_ GetMaintenanceRequest) (maintenance.Status, error) {
+	return maintenance.Get(), nil
+}
+
+// UpdateMaintenance puts the server into or out of maintenance,
+// during the maintenance, the metadata is answered from the cache,
+// the downloads and the syncs are refused with 503.
+func (h *Handler) UpdateMaintenance(req UpdateMaintenanceRequest) (maintenance.Status, error) {
+	if !req.Enabled {
+		return maintenance.Disable(), nil
+	}
+
+	return maintenance.Enable(req.Reason, time.Duration(req.RetryAfter)*time.Second), nil
+}
+
+// GetTunables returns the effective tunables and the overrides of them.
+func (h *Handler) GetTunables(_ GetTunablesRequest) (tunable.State, error) {
+	return tunable.GetState(), nil
+}
+
+// UpdateTunables overrides the given tunables at runtime,
+// the overrides are persisted and take precedence over the flags after restarting.
+func (h *Handler) UpdateTunables(req UpdateTunablesRequest) (tunable.State, error) {
+	return tunable.Update(req.Overrides())
+}
+
+// ResetTunables deletes all overrides of the tunables,
+// the tunables fall back to the flags.
+func (h *Handler) ResetTunables(_ ResetTunablesRequest) (tunable.State, error) {
+	return tunable.Reset()
+}
+
+// GetRateLimits returns the last observed rate limits of the upstreams in hostname order,
+// which is empty if no upstream reports its rate limit.
+func (h *Handler) GetRateLimits(_ GetRateLimitsRequest) ([]registry.RateLimit, error) {
+	return registry.RateLimits(), nil
+}
+
+// GetDiscoveries returns the cached discovery documents of the registries in hostname order.
+func (h *Handler) GetDiscoveries(_ GetDiscoveriesRequest) ([]registry.Discovery, error) {
+	return registry.ListDiscoveries()
+}
+
+// GetDiscovery returns the cached discovery document of the registry,
+// which records the last error of fetching.
+func (h *Handler) GetDiscovery(req GetDiscoveryRequest) (registry.Discovery, error) {
+	return registry.GetDiscovery(req.Hostname)
+}
+
+// UpdateDiscovery overrides the discovery document of the registry,
+// which is never fetched from the registry until deleted.
+func (h *Handler) UpdateDiscovery(req UpdateDiscoveryRequest) (registry.Discovery, error) {
+	return registry.OverrideDiscovery(req.Hostname, req.Services)
+}
+
+// DeleteDiscovery deletes the cached or overridden discovery document of the registry,
+// which is fetched from the registry again on the next request.
+func (h *Handler) DeleteDiscovery(req DeleteDiscoveryRequest) error {
+	return registry.DeleteDiscovery(req.Hostname)
+}
+
+// StreamEvents streams the events of the given types via websocket until the client disconnects,
+// all types are streamed if not specified.
+func (h *Handler) StreamEvents(req StreamEventsRequest) error {
+	if req.Stream == nil {
+		return errorx.HttpErrorf(http.StatusUpgradeRequired, "websocket is required")
+	}
+
+	for ev := range events.Subscribe(req.Stream) {
+		if len(req.Types) != 0 && !slices.Contains(req.Types, ev.Type) {
+			continue
+		}
+
+		if err := req.Stream.SendJSON(ev); err != nil {
+			return err
+		}
+	}
+
+	return req.Stream.Err()
+}
+
+// paginate returns the requested page of the given items.
+func paginate[T any](items []T, p runtime.RequestPagination) []T {
+	limit, offset, ok := p.Paging()
+	if !ok {
+		return items
+	}
+
+	if offset >= len(items) {
+		return items[:0]
+	}
+
+	return items[offset:min(offset+limit, len(items))]
+}
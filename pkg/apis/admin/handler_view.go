@@ -0,0 +1,770 @@
+package admin
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/seal-io/hermitcrab/pkg/apis/runtime"
+	"github.com/seal-io/hermitcrab/pkg/provider/addrs"
+	"github.com/seal-io/hermitcrab/pkg/provider/metadata"
+	"github.com/seal-io/hermitcrab/pkg/provider/provenance"
+	"github.com/seal-io/hermitcrab/pkg/provider/purge"
+	"github.com/seal-io/hermitcrab/pkg/registry"
+	"github.com/seal-io/hermitcrab/pkg/tunable"
+)
+
+var cliConfigFiles = map[string]string{
+	"terraform": "~/.terraformrc (or %APPDATA%/terraform.rc on Windows)",
+	"opentofu":  "~/.tofurc (or %APPDATA%/tofu.rc on Windows)",
+}
+
+type (
+	GetCLIConfigRequest struct {
+		_ struct{} `route:"GET=/cli-config"`
+
+		Host   string `query:"host"`
+		Flavor string `query:"flavor,default=terraform"`
+
+		Context *gin.Context
+	}
+)
+
+func (r *GetCLIConfigRequest) SetGinContext(ctx *gin.Context) {
+	r.Context = ctx
+}
+
+func (r *GetCLIConfigRequest) Validate() error {
+	if _, ok := cliConfigFiles[r.Flavor]; !ok {
+		return errors.New("invalid flavor: must be terraform or opentofu")
+	}
+
+	if r.Host == "" {
+		// Default to the host of the incoming request.
+		r.Host = r.Context.Request.Host
+	}
+
+	// The host is rendered into the configuration snippet.
+	host, err := addrs.NormalizeHostname(r.Host)
+	if err != nil {
+		return fmt.Errorf("invalid host: %w", err)
+	}
+
+	r.Host = host
+
+	return nil
+}
+
+type (
+	GetProviderHistoryRequest struct {
+		_ struct{} `route:"GET=/providers/:hostname/:namespace/:type/history"`
+
+		Hostname  string `path:"hostname"`
+		Namespace string `path:"namespace"`
+		Type      string `path:"type"`
+
+		Context *gin.Context
+	}
+)
+
+func (r *GetProviderHistoryRequest) SetGinContext(ctx *gin.Context) {
+	r.Context = ctx
+}
+
+func (r *GetProviderHistoryRequest) Validate() error {
+	addr := addrs.Address{
+		Hostname:  r.Hostname,
+		Namespace: r.Namespace,
+		Type:      r.Type,
+	}.Normalize()
+	if err := addr.Validate(); err != nil {
+		return err
+	}
+
+	r.Hostname, r.Namespace, r.Type = addr.Hostname, addr.Namespace, addr.Type
+
+	return nil
+}
+
+type (
+	GetProviderDiffRequest struct {
+		_ struct{} `route:"GET=/providers/:hostname/:namespace/:type/diff"`
+
+		Hostname  string `path:"hostname"`
+		Namespace string `path:"namespace"`
+		Type      string `path:"type"`
+		// From and To are the sync points in RFC3339, To defaults to now.
+		From string `query:"from"`
+		To   string `query:"to,omitempty"`
+
+		FromTime time.Time
+		ToTime   time.Time
+
+		Context *gin.Context
+	}
+)
+
+func (r *GetProviderDiffRequest) SetGinContext(ctx *gin.Context) {
+	r.Context = ctx
+}
+
+func (r *GetProviderDiffRequest) Validate() error {
+	addr := addrs.Address{
+		Hostname:  r.Hostname,
+		Namespace: r.Namespace,
+		Type:      r.Type,
+	}.Normalize()
+	if err := addr.Validate(); err != nil {
+		return err
+	}
+
+	r.Hostname, r.Namespace, r.Type = addr.Hostname, addr.Namespace, addr.Type
+
+	var err error
+
+	r.FromTime, err = time.Parse(time.RFC3339, r.From)
+	if err != nil {
+		return errors.New("invalid from: must be in RFC3339")
+	}
+
+	if r.To != "" {
+		r.ToTime, err = time.Parse(time.RFC3339, r.To)
+		if err != nil {
+			return errors.New("invalid to: must be in RFC3339")
+		}
+	}
+
+	return nil
+}
+
+type (
+	GetProvidersRequest struct {
+		_ struct{} `route:"GET=/providers"`
+
+		// Hostname, Namespace and Type filter the providers by prefix.
+		Hostname  string `query:"hostname,omitempty"`
+		Namespace string `query:"namespace,omitempty"`
+		Type      string `query:"type,omitempty"`
+
+		runtime.RequestPagination `query:",inline"`
+
+		Context *gin.Context
+	}
+
+	Provider struct {
+		Hostname  string `json:"hostname"`
+		Namespace string `json:"namespace"`
+		Type      string `json:"type"`
+		// Degraded indicates the provider exhausts the sync error budget.
+		Degraded bool `json:"degraded,omitempty"`
+	}
+)
+
+func (r *GetProvidersRequest) SetGinContext(ctx *gin.Context) {
+	r.Context = ctx
+}
+
+func (r *GetProvidersRequest) Validate() error {
+	r.Hostname = strings.ToLower(r.Hostname)
+	r.Namespace = strings.ToLower(r.Namespace)
+	r.Type = strings.ToLower(r.Type)
+
+	return nil
+}
+
+type (
+	GetProviderVersionsRequest struct {
+		_ struct{} `route:"GET=/providers/:hostname/:namespace/:type/versions"`
+
+		Hostname  string `path:"hostname"`
+		Namespace string `path:"namespace"`
+		Type      string `path:"type"`
+
+		runtime.RequestPagination `query:",inline"`
+
+		Context *gin.Context
+	}
+
+	ProviderVersion struct {
+		metadata.Version `json:",inline"`
+
+		// Compatibility holds the CLI versions compatible with the protocols of the version.
+		Compatibility metadata.Compatibility `json:"compatibility"`
+	}
+)
+
+func (r *GetProviderVersionsRequest) SetGinContext(ctx *gin.Context) {
+	r.Context = ctx
+}
+
+func (r *GetProviderVersionsRequest) Validate() error {
+	addr := addrs.Address{
+		Hostname:  r.Hostname,
+		Namespace: r.Namespace,
+		Type:      r.Type,
+	}.Normalize()
+	if err := addr.Validate(); err != nil {
+		return err
+	}
+
+	r.Hostname, r.Namespace, r.Type = addr.Hostname, addr.Namespace, addr.Type
+
+	return nil
+}
+
+type (
+	GetProviderKeysRequest struct {
+		_ struct{} `route:"GET=/providers/:hostname/:namespace/:type/keys"`
+
+		Hostname  string `path:"hostname"`
+		Namespace string `path:"namespace"`
+		Type      string `path:"type"`
+
+		Context *gin.Context
+	}
+
+	// GetProviderKeysResponse is in the format of the signing_keys of the registry protocol.
+	GetProviderKeysResponse struct {
+		GPGPublicKeys []metadata.GPGPublicKey `json:"gpg_public_keys"`
+	}
+)
+
+func (r *GetProviderKeysRequest) SetGinContext(ctx *gin.Context) {
+	r.Context = ctx
+}
+
+func (r *GetProviderKeysRequest) Validate() error {
+	addr := addrs.Address{
+		Hostname:  r.Hostname,
+		Namespace: r.Namespace,
+		Type:      r.Type,
+	}.Normalize()
+	if err := addr.Validate(); err != nil {
+		return err
+	}
+
+	r.Hostname, r.Namespace, r.Type = addr.Hostname, addr.Namespace, addr.Type
+
+	return nil
+}
+
+type (
+	GetProvenanceRequest struct {
+		_ struct{} `route:"GET=/providers/:hostname/:namespace/:type/provenance"`
+
+		Hostname  string `path:"hostname"`
+		Namespace string `path:"namespace"`
+		Type      string `path:"type"`
+		// Filename filters the provenance of the given archive.
+		Filename string `query:"filename,omitempty"`
+
+		Context *gin.Context
+	}
+
+	GetProvenanceResponse = []provenance.Record
+)
+
+func (r *GetProvenanceRequest) SetGinContext(ctx *gin.Context) {
+	r.Context = ctx
+}
+
+func (r *GetProvenanceRequest) Validate() error {
+	addr := addrs.Address{
+		Hostname:  r.Hostname,
+		Namespace: r.Namespace,
+		Type:      r.Type,
+	}.Normalize()
+	if err := addr.Validate(); err != nil {
+		return err
+	}
+
+	r.Hostname, r.Namespace, r.Type = addr.Hostname, addr.Namespace, addr.Type
+
+	return nil
+}
+
+// Address returns the typed provider address of the request.
+func (r *GetProvenanceRequest) Address() addrs.Address {
+	return addrs.Address{
+		Hostname:  r.Hostname,
+		Namespace: r.Namespace,
+		Type:      r.Type,
+	}
+}
+
+type (
+	PinArchiveRequest struct {
+		_ struct{} `route:"POST=/providers/:hostname/:namespace/:type/archives"`
+
+		Hostname  string `path:"hostname"`
+		Namespace string `path:"namespace"`
+		Type      string `path:"type"`
+
+		// URL is the download URL of the archive.
+		URL string `json:"url"`
+		// Shasum is the expected sha256 checksum of the archive in hex.
+		Shasum string `json:"shasum"`
+		// Filename is the archive filename,
+		// i.e. terraform-provider-null_3.2.1_linux_amd64.zip,
+		// default is the last segment of the URL.
+		Filename string `json:"filename,omitempty"`
+
+		Context *gin.Context
+	}
+
+	PinArchiveResponse struct {
+		Version  string `json:"version"`
+		OS       string `json:"os"`
+		Arch     string `json:"arch"`
+		Filename string `json:"filename"`
+		Shasum   string `json:"shasum"`
+		Size     int64  `json:"size"`
+	}
+)
+
+func (r *PinArchiveRequest) SetGinContext(ctx *gin.Context) {
+	r.Context = ctx
+}
+
+func (r *PinArchiveRequest) Validate() error {
+	addr := addrs.Address{
+		Hostname:  r.Hostname,
+		Namespace: r.Namespace,
+		Type:      r.Type,
+	}.Normalize()
+	if err := addr.Validate(); err != nil {
+		return err
+	}
+
+	r.Hostname, r.Namespace, r.Type = addr.Hostname, addr.Namespace, addr.Type
+
+	u, err := url.Parse(r.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("invalid url: must be an absolute HTTP(S) URL")
+	}
+
+	r.Shasum = strings.ToLower(r.Shasum)
+	if bs, err := hex.DecodeString(r.Shasum); err != nil || len(bs) != 32 {
+		return errors.New("invalid shasum: must be a sha256 checksum in hex")
+	}
+
+	if r.Filename == "" {
+		r.Filename = u.Path[strings.LastIndex(u.Path, "/")+1:]
+	}
+
+	if _, _, _, ok := registry.ParseArchiveFilename(r.Type, r.Filename); !ok {
+		return errors.New("invalid filename: must be terraform-provider-<TYPE>_<VERSION>_<OS>_<ARCH>.zip")
+	}
+
+	return nil
+}
+
+type (
+	ImportShasumsRequest struct {
+		_ struct{} `route:"POST=/providers/:hostname/:namespace/:type/versions/:version/shasums"`
+
+		Hostname  string `path:"hostname"`
+		Namespace string `path:"namespace"`
+		Type      string `path:"type"`
+		Version   string `path:"version"`
+
+		// Content is the content of the SHA256SUMS file.
+		Content string `json:"content" form:"content"`
+
+		Context *gin.Context
+	}
+
+	ImportShasumsResponse struct {
+		Imported []string `json:"imported"`
+	}
+)
+
+func (r *ImportShasumsRequest) SetGinContext(ctx *gin.Context) {
+	r.Context = ctx
+}
+
+func (r *ImportShasumsRequest) Validate() error {
+	addr := addrs.Address{
+		Hostname:  r.Hostname,
+		Namespace: r.Namespace,
+		Type:      r.Type,
+		Version:   r.Version,
+	}.Normalize()
+	if err := addr.Validate(); err != nil {
+		return err
+	}
+
+	r.Hostname, r.Namespace, r.Type, r.Version = addr.Hostname, addr.Namespace, addr.Type, addr.Version
+
+	if strings.TrimSpace(r.Content) == "" {
+		return errors.New("invalid content: blank")
+	}
+
+	return nil
+}
+
+type (
+	SetCanaryRequest struct {
+		_ struct{} `route:"PUT=/providers/:hostname/:namespace/:type/versions/:version/canary"`
+
+		Hostname  string `path:"hostname"`
+		Namespace string `path:"namespace"`
+		Type      string `path:"type"`
+		Version   string `path:"version"`
+
+		// Canary marks the version as canary if true, otherwise, unmarks.
+		Canary bool `json:"canary"`
+
+		Context *gin.Context
+	}
+)
+
+func (r *SetCanaryRequest) SetGinContext(ctx *gin.Context) {
+	r.Context = ctx
+}
+
+func (r *SetCanaryRequest) Validate() error {
+	addr := addrs.Address{
+		Hostname:  r.Hostname,
+		Namespace: r.Namespace,
+		Type:      r.Type,
+		Version:   r.Version,
+	}.Normalize()
+	if err := addr.Validate(); err != nil {
+		return err
+	}
+
+	r.Hostname, r.Namespace, r.Type, r.Version = addr.Hostname, addr.Namespace, addr.Type, addr.Version
+
+	return nil
+}
+
+type (
+	PublishPlatformRequest struct {
+		_ struct{} `route:"POST=/publish/providers/:hostname/:namespace/:type/versions/:version"`
+
+		Hostname  string `path:"hostname"`
+		Namespace string `path:"namespace"`
+		Type      string `path:"type"`
+		Version   string `path:"version"`
+
+		Protocols []string          `json:"protocols,omitempty"`
+		Platform  metadata.Platform `json:"platform"`
+
+		Context *gin.Context
+	}
+)
+
+func (r *PublishPlatformRequest) SetGinContext(ctx *gin.Context) {
+	r.Context = ctx
+}
+
+func (r *PublishPlatformRequest) Validate() error {
+	addr := addrs.Address{
+		Hostname:  r.Hostname,
+		Namespace: r.Namespace,
+		Type:      r.Type,
+		Version:   r.Version,
+	}.Normalize()
+	if err := addr.Validate(); err != nil {
+		return err
+	}
+
+	r.Hostname, r.Namespace, r.Type, r.Version = addr.Hostname, addr.Namespace, addr.Type, addr.Version
+
+	v, os, arch, ok := registry.ParseArchiveFilename(r.Type, r.Platform.Filename)
+	if !ok || v != r.Version || os != r.Platform.OS || arch != r.Platform.Arch {
+		return errors.New("invalid platform: filename must match the version, os and arch")
+	}
+
+	r.Platform.Shasum = strings.ToLower(r.Platform.Shasum)
+	if bs, err := hex.DecodeString(r.Platform.Shasum); err != nil || len(bs) != 32 {
+		return errors.New("invalid platform: shasum must be a sha256 checksum in hex")
+	}
+
+	return nil
+}
+
+type (
+	GetDriftRequest struct {
+		_ struct{} `route:"GET=/drift"`
+
+		Verify bool `query:"verify"`
+
+		Context *gin.Context
+	}
+
+	RepairDriftRequest struct {
+		_ struct{} `route:"POST=/drift/repair"`
+
+		Verify bool `query:"verify"`
+
+		Context *gin.Context
+	}
+)
+
+func (r *GetDriftRequest) SetGinContext(ctx *gin.Context) {
+	r.Context = ctx
+}
+
+func (r *RepairDriftRequest) SetGinContext(ctx *gin.Context) {
+	r.Context = ctx
+}
+
+type (
+	PurgeCacheRequest struct {
+		_ struct{} `route:"POST=/cache/purge"`
+
+		// OlderThan only purges the archives not modified within the duration, i.e. 720h.
+		OlderThan string `json:"olderThan,omitempty"`
+		// Provider only purges the archives of the providers matching the pattern, i.e. hashicorp/*.
+		Provider string `json:"provider,omitempty"`
+		// Version only purges the archives of the versions satisfying the constraint, i.e. < 3.0.0.
+		Version string `json:"version,omitempty"`
+		// Platform only purges the archives of the platforms matching the pattern, i.e. windows_*.
+		Platform string `json:"platform,omitempty"`
+		// Metadata also deletes the metadata of the versions of the purged archives,
+		// not allowed along with the platform filter.
+		Metadata bool `json:"metadata,omitempty"`
+		// DryRun only reports the archives to purge without deleting.
+		DryRun bool `json:"dryRun,omitempty"`
+
+		Context *gin.Context
+	}
+)
+
+func (r *PurgeCacheRequest) SetGinContext(ctx *gin.Context) {
+	r.Context = ctx
+}
+
+func (r *PurgeCacheRequest) Validate() error {
+	if r.OlderThan != "" {
+		if _, err := time.ParseDuration(r.OlderThan); err != nil {
+			return fmt.Errorf("invalid older than: %w", err)
+		}
+	}
+
+	return r.Options().Validate()
+}
+
+// Options returns the purge options of the request.
+func (r *PurgeCacheRequest) Options() purge.Options {
+	olderThan, _ := time.ParseDuration(r.OlderThan)
+
+	return purge.Options{
+		OlderThan: olderThan,
+		Provider:  r.Provider,
+		Version:   r.Version,
+		Platform:  r.Platform,
+		Metadata:  r.Metadata,
+		DryRun:    r.DryRun,
+	}
+}
+
+type (
+	GetPlatformsRequest struct {
+		_ struct{} `route:"GET=/platforms"`
+	}
+)
+
+type (
+	GetSyncsRequest struct {
+		_ struct{} `route:"GET=/syncs"`
+
+		Context *gin.Context
+	}
+)
+
+func (r *GetSyncsRequest) SetGinContext(ctx *gin.Context) {
+	r.Context = ctx
+}
+
+type (
+	GetDegradedSyncsRequest struct {
+		_ struct{} `route:"GET=/syncs/degraded"`
+
+		Context *gin.Context
+	}
+)
+
+func (r *GetDegradedSyncsRequest) SetGinContext(ctx *gin.Context) {
+	r.Context = ctx
+}
+
+type (
+	GetSupportBundleRequest struct {
+		_ struct{} `route:"GET=/support-bundle"`
+
+		Context *gin.Context
+	}
+)
+
+func (r *GetSupportBundleRequest) SetGinContext(ctx *gin.Context) {
+	r.Context = ctx
+}
+
+type (
+	GetMaintenanceRequest struct {
+		_ struct{} `route:"GET=/maintenance"`
+	}
+
+	UpdateMaintenanceRequest struct {
+		_ struct{} `route:"PUT=/maintenance"`
+
+		Enabled bool   `json:"enabled"`
+		Reason  string `json:"reason,omitempty"`
+		// RetryAfter is the seconds of the Retry-After responded with the refusals,
+		// defaults to 300.
+		RetryAfter int64 `json:"retryAfter,omitempty"`
+	}
+)
+
+func (r *UpdateMaintenanceRequest) Validate() error {
+	if r.RetryAfter < 0 {
+		return errors.New("invalid retry after: negative")
+	}
+
+	return nil
+}
+
+type (
+	GetTunablesRequest struct {
+		_ struct{} `route:"GET=/tunables"`
+	}
+
+	UpdateTunablesRequest struct {
+		_ struct{} `route:"PUT=/tunables"`
+
+		// SyncParallelism is the maximum number of the providers syncing at the same time,
+		// every 10 providers are synced by a worker if 0.
+		SyncParallelism *int `json:"syncParallelism,omitempty"`
+		// DownloadChunkSize is the bytes of each range requested by the ranged downloads.
+		DownloadChunkSize *int64 `json:"downloadChunkSize,omitempty"`
+		// DocsCacheTTL is the duration of the cached documentation before re-fetching, i.e. 24h.
+		DocsCacheTTL *string `json:"docsCacheTTL,omitempty"`
+		// DiscoveryTTL is the duration of the cached discovery document before re-fetching, i.e. 1h.
+		DiscoveryTTL *string `json:"discoveryTTL,omitempty"`
+		// ArchiveCacheMaxAge is the max-age of the Cache-Control of the served archives, i.e. 168h.
+		ArchiveCacheMaxAge *string `json:"archiveCacheMaxAge,omitempty"`
+	}
+
+	ResetTunablesRequest struct {
+		_ struct{} `route:"DELETE=/tunables"`
+	}
+)
+
+func (r *UpdateTunablesRequest) Validate() error {
+	for n, s := range map[string]*string{
+		"docs cache ttl":        r.DocsCacheTTL,
+		"discovery ttl":         r.DiscoveryTTL,
+		"archive cache max age": r.ArchiveCacheMaxAge,
+	} {
+		if s == nil {
+			continue
+		}
+
+		if _, err := time.ParseDuration(*s); err != nil {
+			return fmt.Errorf("invalid %s: %w", n, err)
+		}
+	}
+
+	o := r.Overrides()
+	if o == (tunable.Overrides{}) {
+		return errors.New("invalid tunables: blank")
+	}
+
+	return o.Validate()
+}
+
+// Overrides returns the tunable overrides of the request.
+func (r *UpdateTunablesRequest) Overrides() tunable.Overrides {
+	durationOf := func(s *string) *tunable.Duration {
+		if s == nil {
+			return nil
+		}
+
+		d, _ := time.ParseDuration(*s)
+		td := tunable.Duration(d)
+
+		return &td
+	}
+
+	return tunable.Overrides{
+		SyncParallelism:    r.SyncParallelism,
+		DownloadChunkSize:  r.DownloadChunkSize,
+		DocsCacheTTL:       durationOf(r.DocsCacheTTL),
+		DiscoveryTTL:       durationOf(r.DiscoveryTTL),
+		ArchiveCacheMaxAge: durationOf(r.ArchiveCacheMaxAge),
+	}
+}
+
+type (
+	GetRateLimitsRequest struct {
+		_ struct{} `route:"GET=/rate-limits"`
+	}
+)
+
+type (
+	GetDiscoveriesRequest struct {
+		_ struct{} `route:"GET=/discoveries"`
+	}
+
+	GetDiscoveryRequest struct {
+		_ struct{} `route:"GET=/discoveries/:hostname"`
+
+		Hostname string `path:"hostname"`
+	}
+
+	UpdateDiscoveryRequest struct {
+		_ struct{} `route:"PUT=/discoveries/:hostname"`
+
+		Hostname string `path:"hostname"`
+
+		// Services holds the service endpoints indexing by the service type,
+		// i.e. {"providers.v1": "https://registry.example.com/v1/providers/"}.
+		Services map[string]string `json:"services"`
+	}
+
+	DeleteDiscoveryRequest struct {
+		_ struct{} `route:"DELETE=/discoveries/:hostname"`
+
+		Hostname string `path:"hostname"`
+	}
+)
+
+func (r *UpdateDiscoveryRequest) Validate() error {
+	if len(r.Services) == 0 {
+		return errors.New("invalid services: blank")
+	}
+
+	for k, v := range r.Services {
+		if k == "" || v == "" {
+			return fmt.Errorf("invalid service %q: blank", k)
+		}
+
+		if _, err := url.Parse(v); err != nil {
+			return fmt.Errorf("invalid service %q: %w", k, err)
+		}
+	}
+
+	return nil
+}
+
+type (
+	StreamEventsRequest struct {
+		_ struct{} `route:"GET=/events"`
+
+		Types []string `query:"type,omitempty"`
+
+		Stream *runtime.RequestBidiStream
+	}
+)
+
+func (r *StreamEventsRequest) SetStream(stream runtime.RequestBidiStream) {
+	r.Stream = &stream
+}
@@ -0,0 +1,52 @@
+package admin
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetCLIConfigRequest_Validate(t *testing.T) {
+	testCases := []struct {
+		name     string
+		given    string
+		expected string
+		wantErr  bool
+	}{
+		{
+			name:     "query host",
+			given:    "Mirror.Example.com:443",
+			expected: "mirror.example.com",
+		},
+		{
+			name:     "request host",
+			given:    "",
+			expected: "localhost:8080",
+		},
+		{
+			name:    "injected host",
+			given:   "example.com/\"\n}\nplugin_cache_dir = \"/tmp",
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest("GET", "http://localhost:8080/v2/admin/cli-config", nil)
+
+			r := GetCLIConfigRequest{Host: tc.given, Flavor: "terraform", Context: c}
+
+			err := r.Validate()
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, r.Host)
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package artifact
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin/render"
+	"github.com/seal-io/walrus/utils/errorx"
+
+	"github.com/seal-io/hermitcrab/pkg/maintenance"
+	"github.com/seal-io/hermitcrab/pkg/policy"
+	"github.com/seal-io/hermitcrab/pkg/provider"
+	"github.com/seal-io/hermitcrab/pkg/provider/storage"
+	"github.com/seal-io/hermitcrab/pkg/timing"
+)
+
+// CacheControl is the Cache-Control of the served artifacts,
+// the content of an artifact never changes as it is addressed by its checksum.
+const CacheControl = "public, max-age=31536000, immutable"
+
+// CanaryCacheControl is the Cache-Control of the served canary artifacts,
+// which must not be stored by the shared caches to not leak to the non-canary clients.
+const CanaryCacheControl = "private, no-store"
+
+func Handle(service *provider.Service) *Handler {
+	return &Handler{
+		s: service,
+	}
+}
+
+type Handler struct {
+	s *provider.Service
+}
+
+// DownloadArtifact serves the provider archive addressed by its sha256 checksum,
+// which is looked up from the stored metadata and fetched from the upstream if not cached,
+// so that the CDN or the object store can offload the bulk bytes with the immutable URL.
+func (h *Handler) DownloadArtifact(req DownloadArtifactRequest) (render.Render, error) {
+	if err := maintenance.Error("downloading"); err != nil {
+		return nil, err
+	}
+
+	addr, p, err := h.s.Metadata.GetPlatformByShasum(req.Context, req.Digest)
+	if err != nil {
+		return nil, err
+	}
+
+	pl := policy.Get()
+	canary := h.s.Metadata.IsCanary(req.Context, addr)
+
+	// Respond as not found to not reveal the refused archives.
+	if !pl.Serves(req.Context.Request.Host, addr) ||
+		!pl.ServesPlatform(addr.OS, addr.Arch) ||
+		canary && !h.s.IsCanaryClient(req.Context.Request) {
+		return nil, errorx.HttpErrorf(http.StatusNotFound, "archive %s is not found", req.Digest)
+	}
+
+	// Refuse the archive signed by the unexpected keys before caching.
+	if err = h.s.VerifyTrust(req.Context, addr, p); err != nil {
+		return nil, err
+	}
+
+	ar, err := h.s.Storage.LoadArchive(req.Context, storage.LoadArchiveOptions{
+		Hostname:    addr.Hostname,
+		Namespace:   addr.Namespace,
+		Type:        addr.Type,
+		Filename:    p.Filename,
+		Shasum:      p.Shasum,
+		DownloadURL: p.DownloadURL,
+		Canary:      canary,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if ar.Headers == nil {
+		ar.Headers = map[string]string{}
+	}
+
+	ar.Headers["Cache-Control"] = CacheControl
+	if canary {
+		ar.Headers["Cache-Control"] = CanaryCacheControl
+	}
+
+	if ar.NotModified(req.Context.Request) {
+		ar.RenderNotModified(req.Context)
+		return nil, nil
+	}
+
+	// Time the streaming of the archive.
+	ar.Reader = timing.Reader(req.Context, timing.PhaseDisk, ar.Reader)
+
+	return ar, nil
+}
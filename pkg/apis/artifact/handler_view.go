@@ -0,0 +1,36 @@
+package artifact
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type (
+	DownloadArtifactRequest struct {
+		_ struct{} `route:"GET=/sha256/:digest"`
+
+		// Digest is the hex encoded sha256 checksum of the archive.
+		Digest string `path:"digest"`
+
+		Context *gin.Context
+	}
+)
+
+func (r *DownloadArtifactRequest) SetGinContext(ctx *gin.Context) {
+	r.Context = ctx
+}
+
+var regexValidDigest = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+func (r *DownloadArtifactRequest) Validate() error {
+	r.Digest = strings.ToLower(r.Digest)
+
+	if !regexValidDigest.MatchString(r.Digest) {
+		return errors.New("invalid digest")
+	}
+
+	return nil
+}
@@ -0,0 +1,75 @@
+package docs
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/render"
+	"github.com/seal-io/walrus/utils/errorx"
+
+	"github.com/seal-io/hermitcrab/pkg/policy"
+	"github.com/seal-io/hermitcrab/pkg/provider"
+	"github.com/seal-io/hermitcrab/pkg/provider/addrs"
+	"github.com/seal-io/hermitcrab/pkg/provider/docs"
+)
+
+func Handle(service *provider.Service) *Handler {
+	return &Handler{
+		s: service,
+	}
+}
+
+// Handler serves the provider documentation of the registry v2 API,
+// the documentation is proxied and cached from the default hostname,
+// so that the developer portals behind the air gap can render the provider documentation.
+type Handler struct {
+	s *provider.Service
+}
+
+// GetProvider returns the provider information,
+// i.e. /v2/providers/hashicorp/aws?include=provider-versions.
+func (h *Handler) GetProvider(req GetProviderRequest) (render.Render, error) {
+	addr := req.Address()
+
+	if !policy.Get().Serves(req.Context.Request.Host, addr) {
+		return nil, errorx.HttpErrorf(http.StatusNotFound,
+			"provider %s is not served by %s", addr.TypedKey(), req.Context.Request.Host)
+	}
+
+	return h.get(req.Context, "providers/"+addr.Namespace+"/"+addr.Type)
+}
+
+// GetProviderVersion returns the provider version information,
+// i.e. /v2/provider-versions/12345?include=provider-docs.
+func (h *Handler) GetProviderVersion(req GetProviderVersionRequest) (render.Render, error) {
+	return h.get(req.Context, "provider-versions/"+req.ID)
+}
+
+// GetProviderDocs returns the documentation list of a provider version,
+// i.e. /v2/provider-docs?filter[provider-version]=12345&filter[category]=resources&filter[slug]=instance.
+func (h *Handler) GetProviderDocs(req GetProviderDocsRequest) (render.Render, error) {
+	return h.get(req.Context, "provider-docs")
+}
+
+// GetProviderDoc returns the documentation content,
+// i.e. /v2/provider-docs/67890.
+func (h *Handler) GetProviderDoc(req GetProviderDocRequest) (render.Render, error) {
+	return h.get(req.Context, "provider-docs/"+req.ID)
+}
+
+// get returns the response of the given path of the registry v2 API with the query of the request.
+func (h *Handler) get(c *gin.Context, p string) (render.Render, error) {
+	data, err := h.s.Docs.Get(c, docs.GetOptions{
+		Hostname: addrs.DefaultHostname,
+		Path:     p,
+		Query:    c.Request.URL.Query(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return render.Data{
+		ContentType: "application/vnd.api+json",
+		Data:        data,
+	}, nil
+}
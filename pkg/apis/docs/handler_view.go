@@ -0,0 +1,109 @@
+package docs
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/seal-io/hermitcrab/pkg/provider/addrs"
+)
+
+type (
+	GetProviderRequest struct {
+		_ struct{} `route:"GET=/providers/:namespace/:type"`
+
+		Namespace string `path:"namespace"`
+		Type      string `path:"type"`
+
+		Context *gin.Context
+	}
+)
+
+func (r *GetProviderRequest) SetGinContext(ctx *gin.Context) {
+	r.Context = ctx
+}
+
+func (r *GetProviderRequest) Validate() error {
+	addr := r.Address()
+	if err := addr.Validate(); err != nil {
+		return err
+	}
+
+	r.Namespace, r.Type = addr.Namespace, addr.Type
+
+	return nil
+}
+
+// Address returns the provider address of the request,
+// which is mirrored from the default hostname.
+func (r *GetProviderRequest) Address() addrs.Address {
+	return addrs.Address{
+		Hostname:  addrs.DefaultHostname,
+		Namespace: r.Namespace,
+		Type:      r.Type,
+	}.Normalize()
+}
+
+type (
+	GetProviderVersionRequest struct {
+		_ struct{} `route:"GET=/provider-versions/:id"`
+
+		ID string `path:"id"`
+
+		Context *gin.Context
+	}
+)
+
+func (r *GetProviderVersionRequest) SetGinContext(ctx *gin.Context) {
+	r.Context = ctx
+}
+
+func (r *GetProviderVersionRequest) Validate() error {
+	return validateID(r.ID)
+}
+
+type (
+	GetProviderDocsRequest struct {
+		_ struct{} `route:"GET=/provider-docs"`
+
+		Context *gin.Context
+	}
+)
+
+func (r *GetProviderDocsRequest) SetGinContext(ctx *gin.Context) {
+	r.Context = ctx
+}
+
+type (
+	GetProviderDocRequest struct {
+		_ struct{} `route:"GET=/provider-docs/:id"`
+
+		ID string `path:"id"`
+
+		Context *gin.Context
+	}
+)
+
+func (r *GetProviderDocRequest) SetGinContext(ctx *gin.Context) {
+	r.Context = ctx
+}
+
+func (r *GetProviderDocRequest) Validate() error {
+	return validateID(r.ID)
+}
+
+// validateID validates the given identifier of the registry v2 API,
+// which is numeric.
+func validateID(id string) error {
+	if id == "" {
+		return errors.New("invalid id: blank")
+	}
+
+	for _, c := range id {
+		if c < '0' || c > '9' {
+			return errors.New("invalid id: must be numeric")
+		}
+	}
+
+	return nil
+}
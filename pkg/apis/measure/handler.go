@@ -13,7 +13,7 @@ import (
 
 func Readyz() runtime.Handle {
 	return func(c *gin.Context) {
-		d, ok := health.MustValidate(c, []string{"database"})
+		d, ok := health.MustValidate(c, []string{"database", "storage"})
 		if !ok {
 			c.String(http.StatusServiceUnavailable, d)
 			return
@@ -0,0 +1,92 @@
+package provider
+
+import (
+	"container/list"
+	"sync"
+)
+
+const (
+	// maxCachedDocuments is the maximum number of the rendered metadata documents kept in the memory,
+	// the least recently served ones are evicted beyond it,
+	// so that only the hot providers stay in the memory.
+	maxCachedDocuments = 512
+	// maxCachedDocumentBytes is the maximum bytes of the rendered metadata documents kept in the memory.
+	maxCachedDocumentBytes = 64 << 20 // 64mb.
+)
+
+// documentCache is a least recently used cache of the rendered metadata documents,
+// bounded by the number and the bytes of the documents,
+// the document of a stale revision is dropped once looked up.
+type documentCache struct {
+	mu       sync.Mutex
+	ll       *list.List
+	entries  map[string]*list.Element
+	size     int
+	maxCount int
+	maxSize  int
+}
+
+type documentEntry struct {
+	key string
+	doc metadataDocument
+}
+
+func newDocumentCache(maxCount, maxSize int) *documentCache {
+	return &documentCache{
+		ll:       list.New(),
+		entries:  map[string]*list.Element{},
+		maxCount: maxCount,
+		maxSize:  maxSize,
+	}
+}
+
+// get returns the document of the given key if rendered at the given revision,
+// the document of another revision is dropped.
+func (c *documentCache) get(key string, revision uint64) (metadataDocument, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		return metadataDocument{}, false
+	}
+
+	doc := e.Value.(*documentEntry).doc
+	if doc.revision != revision {
+		c.remove(e)
+		return metadataDocument{}, false
+	}
+
+	c.ll.MoveToFront(e)
+
+	return doc, true
+}
+
+// put stores the document of the given key,
+// and evicts the least recently served ones beyond the bounds,
+// the document larger than the bytes bound is never stored.
+func (c *documentCache) put(key string, doc metadataDocument) {
+	if len(doc.data) > c.maxSize {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.entries[key]; ok {
+		c.remove(e)
+	}
+
+	c.entries[key] = c.ll.PushFront(&documentEntry{key: key, doc: doc})
+	c.size += len(doc.data)
+
+	for c.ll.Len() > c.maxCount || c.size > c.maxSize {
+		c.remove(c.ll.Back())
+	}
+}
+
+func (c *documentCache) remove(e *list.Element) {
+	de := c.ll.Remove(e).(*documentEntry)
+	delete(c.entries, de.key)
+	c.size -= len(de.doc.data)
+}
@@ -0,0 +1,65 @@
+package provider
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_documentCache(t *testing.T) {
+	doc := func(size int, rev uint64) metadataDocument {
+		return metadataDocument{data: make([]byte, size), revision: rev}
+	}
+
+	t.Run("evict least recently served beyond count", func(t *testing.T) {
+		c := newDocumentCache(2, 1024)
+		c.put("a", doc(1, 1))
+		c.put("b", doc(1, 1))
+
+		_, ok := c.get("a", 1)
+		assert.True(t, ok)
+
+		c.put("c", doc(1, 1))
+
+		_, ok = c.get("b", 1)
+		assert.False(t, ok, "least recently served evicted")
+		_, ok = c.get("a", 1)
+		assert.True(t, ok)
+		_, ok = c.get("c", 1)
+		assert.True(t, ok)
+	})
+
+	t.Run("evict beyond size", func(t *testing.T) {
+		c := newDocumentCache(10, 10)
+		c.put("a", doc(6, 1))
+		c.put("b", doc(6, 1))
+
+		_, ok := c.get("a", 1)
+		assert.False(t, ok)
+		_, ok = c.get("b", 1)
+		assert.True(t, ok)
+		assert.Equal(t, 6, c.size)
+
+		c.put("c", doc(11, 1))
+
+		_, ok = c.get("c", 1)
+		assert.False(t, ok, "oversize never stored")
+		_, ok = c.get("b", 1)
+		assert.True(t, ok)
+	})
+
+	t.Run("drop stale revision", func(t *testing.T) {
+		c := newDocumentCache(10, 1024)
+		c.put("a", doc(4, 1))
+
+		_, ok := c.get("a", 2)
+		assert.False(t, ok)
+		assert.Equal(t, 0, c.ll.Len())
+		assert.Equal(t, 0, c.size)
+
+		c.put("a", doc(4, 2))
+		c.put("a", doc(5, 3))
+		assert.Equal(t, 1, c.ll.Len())
+		assert.Equal(t, 5, c.size)
+	})
+}
@@ -1,81 +1,206 @@
 package provider
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
 	"net/http"
-	"sync"
+	"slices"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin/render"
 	"github.com/seal-io/walrus/utils/errorx"
 	"github.com/seal-io/walrus/utils/gopool"
+	"github.com/seal-io/walrus/utils/json"
 	"github.com/seal-io/walrus/utils/log"
-	"k8s.io/apimachinery/pkg/util/sets"
 
+	"github.com/seal-io/hermitcrab/pkg/apis/runtime"
+	"github.com/seal-io/hermitcrab/pkg/maintenance"
+	"github.com/seal-io/hermitcrab/pkg/policy"
 	"github.com/seal-io/hermitcrab/pkg/provider"
+	"github.com/seal-io/hermitcrab/pkg/provider/addrs"
 	"github.com/seal-io/hermitcrab/pkg/provider/metadata"
 	"github.com/seal-io/hermitcrab/pkg/provider/storage"
+	"github.com/seal-io/hermitcrab/pkg/timing"
 )
 
 func Handle(service *provider.Service) *Handler {
 	return &Handler{
-		s: service,
+		documents: newDocumentCache(maxCachedDocuments, maxCachedDocumentBytes),
+		s:         service,
 	}
 }
 
 type Handler struct {
-	m sync.Mutex
+	documents *documentCache
 
 	s *provider.Service
 }
 
-func (h *Handler) GetMetadata(req GetMetadataRequest) (GetMetadataResponse, error) {
+// GetMetadata serves the index.json and {version}.json documents of the network mirror protocol,
+// the documents are rendered once per revision of the stored metadata and served from the memory,
+// unless in offline mode or limited to the requested platforms,
+// only the recently served documents are kept.
+func (h *Handler) GetMetadata(req GetMetadataRequest) (render.Render, error) {
+	if err := served(req.Context.Request.Host, req.Address()); err != nil {
+		return nil, err
+	}
+
+	// Serve the provider under the equivalent namespace if stored.
+	addr := h.s.Resolve(req.Context, req.Address())
+
+	canary := h.s.IsCanaryClient(req.Context.Request)
+
+	var (
+		doc metadataDocument
+		err error
+	)
+
+	if h.s.Offline || len(req.Platforms) != 0 {
+		doc, err = h.renderMetadata(req, addr, canary)
+	} else {
+		key := addr.TypedKey() + "/" + req.Action + "/" + strconv.FormatBool(canary)
+		rev := h.s.Metadata.GetRevision(req.Context, addr)
+
+		if d, ok := h.documents.get(key, rev); ok {
+			doc = d
+		} else {
+			doc, err = h.renderMetadata(req, addr, canary)
+			if err == nil {
+				// The revision is taken before querying,
+				// so that the document rendered from the changing metadata is rendered again.
+				doc.revision = rev
+				h.documents.put(key, doc)
+			}
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	etag := `"` + doc.checksum + `"`
+	if req.Context.GetHeader("If-None-Match") == etag {
+		req.Context.Header("ETag", etag)
+		req.Context.Status(http.StatusNotModified)
+		req.Context.Writer.WriteHeaderNow()
+
+		return nil, nil
+	}
+
+	return runtime.ResponseFile{
+		ContentType:   "application/json",
+		ContentLength: int64(len(doc.data)),
+		Checksum:      doc.checksum,
+		Reader:        io.NopCloser(bytes.NewReader(doc.data)),
+	}, nil
+}
+
+// metadataDocument holds the rendered JSON document of the network mirror protocol.
+type metadataDocument struct {
+	data     []byte
+	checksum string
+	revision uint64
+}
+
+// renderMetadata renders the requested document of the given provider.
+func (h *Handler) renderMetadata(req GetMetadataRequest, addr addrs.Address, canary bool) (metadataDocument, error) {
+	resp, err := h.getMetadata(req, addr, canary)
+	if err != nil {
+		return metadataDocument{}, err
+	}
+
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return metadataDocument{}, err
+	}
+
+	sum := sha256.Sum256(data)
+
+	return metadataDocument{
+		data:     data,
+		checksum: hex.EncodeToString(sum[:]),
+	}, nil
+}
+
+// getMetadata returns the requested document of the given provider.
+func (h *Handler) getMetadata(req GetMetadataRequest, addr addrs.Address, canary bool) (GetMetadataResponse, error) {
 	version := req.Version()
 
 	if version == "index" {
 		opts := metadata.GetVersionsOptions{
-			Hostname:  req.Hostname,
-			Namespace: req.Namespace,
-			Type:      req.Type,
+			Hostname:  addr.Hostname,
+			Namespace: addr.Namespace,
+			Type:      addr.Type,
 		}
 
-		mr, err := h.s.Metadata.GetVersions(req.Context, opts)
+		mr, err := h.s.Metadata.GetVersions(metadata.WithUpstreamBudget(req.Context), opts)
 		if err != nil {
 			return GetMetadataResponse{}, err
 		}
 
+		metadata.SortVersions(mr)
+
+		av := h.s.Availability(req.Context, addr)
+
 		resp := GetMetadataResponse{
-			Versions: sets.New[string](),
+			Versions: make(Versions, 0, len(mr)),
 		}
 		for _, v := range mr {
-			resp.Versions.Insert(v.Version)
+			// Skip the canary version unless the client presents the canary token.
+			if v.Canary && !canary {
+				continue
+			}
+
+			// Skip the version without any cached platform in offline mode.
+			if h.s.Offline && len(av.Available(req.Context, v)) == 0 {
+				continue
+			}
+
+			resp.Versions = append(resp.Versions, v.Version)
 		}
 
 		return resp, nil
 	}
 
 	opts := metadata.GetVersionOptions{
-		Hostname:  req.Hostname,
-		Namespace: req.Namespace,
-		Type:      req.Type,
+		Hostname:  addr.Hostname,
+		Namespace: addr.Namespace,
+		Type:      addr.Type,
 		Version:   version,
 	}
 
-	mr, err := h.s.Metadata.GetVersion(req.Context, opts)
+	mr, err := h.s.Metadata.GetVersion(metadata.WithUpstreamBudget(req.Context), opts)
 	if err != nil {
 		return GetMetadataResponse{}, err
 	}
 
+	if mr.Canary && !canary {
+		return GetMetadataResponse{}, errorx.HttpErrorf(http.StatusNotFound, "version %s is not found", version)
+	}
+
 	resp := GetMetadataResponse{
 		Archives: map[string]Archive{},
 	}
 
-	for _, v := range mr.Platforms {
+	for _, v := range h.s.Availability(req.Context, addr).Available(req.Context, mr) {
 		archiveName := v.OS + "_" + v.Arch
 
+		// Only list the requested platforms if specified.
+		if len(req.Platforms) != 0 && !slices.Contains(req.Platforms, archiveName) {
+			continue
+		}
+
 		archive := Archive{
 			URL: "download/" + v.Filename,
 		}
+		if h.s.ArtifactURLs && v.Shasum != "" {
+			// Relative to the {version}.json, i.e. /v1/artifacts/sha256/{digest}.
+			archive.URL = "../../../../artifacts/sha256/" + v.Shasum
+		}
 		if v.Shasum != "" {
 			archive.Hashes = []string{
 				"zh:" + v.Shasum,
@@ -89,40 +214,132 @@ func (h *Handler) GetMetadata(req GetMetadataRequest) (GetMetadataResponse, erro
 }
 
 func (h *Handler) DownloadArchive(req DownloadArchiveRequest) (render.Render, error) {
-	getPlatformOpts := metadata.GetPlatformOptions{
-		Hostname:  req.Hostname,
-		Namespace: req.Namespace,
-		Type:      req.Type,
-		Version:   req.Version,
-		OS:        req.OS,
-		Arch:      req.Arch,
+	if err := served(req.Context.Request.Host, req.Address()); err != nil {
+		return nil, err
+	}
+
+	if !policy.Get().ServesPlatform(req.OS, req.Arch) {
+		return nil, errorx.HttpErrorf(http.StatusNotFound, "platform %s_%s is not served", req.OS, req.Arch)
 	}
 
-	mr, err := h.s.Metadata.GetPlatform(req.Context, getPlatformOpts)
+	if err := maintenance.Error("downloading"); err != nil {
+		return nil, err
+	}
+
+	// Serve the archive under the equivalent namespace if stored.
+	addr := h.s.Resolve(req.Context, req.Address())
+
+	canary := h.s.Metadata.IsCanary(req.Context, addr)
+	if canary && !h.s.IsCanaryClient(req.Context.Request) {
+		return nil, errorx.HttpErrorf(http.StatusNotFound, "version %s is not found", addr.Version)
+	}
+
+	getPlatformOpts := metadata.GetPlatformOptions(addr)
+
+	mr, err := h.s.Metadata.GetPlatform(metadata.WithUpstreamBudget(req.Context), getPlatformOpts)
 	if err != nil {
 		return nil, err
 	}
 
+	// Refuse the archive signed by the unexpected keys before caching.
+	if err = h.s.VerifyTrust(req.Context, addr, mr); err != nil {
+		return nil, err
+	}
+
+	h.s.ObservePlatform(addr.OS, addr.Arch)
+
 	loadOrFetchOpts := storage.LoadArchiveOptions{
-		Hostname:    req.Hostname,
-		Namespace:   req.Namespace,
-		Type:        req.Type,
+		Hostname:    addr.Hostname,
+		Namespace:   addr.Namespace,
+		Type:        addr.Type,
 		Filename:    mr.Filename,
 		Shasum:      mr.Shasum,
 		DownloadURL: mr.DownloadURL,
+		Canary:      canary,
+	}
+
+	ar, err := h.s.Storage.LoadArchive(req.Context, loadOrFetchOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	if ar.NotModified(req.Context.Request) {
+		ar.RenderNotModified(req.Context)
+		return nil, nil
 	}
 
-	return h.s.Storage.LoadArchive(req.Context, loadOrFetchOpts)
+	// Time the streaming of the archive.
+	ar.Reader = timing.Reader(req.Context, timing.PhaseDisk, ar.Reader)
+
+	return ar, nil
+}
+
+// PeerArchive serves the cached archive to the peers,
+// responds 404 if not cached rather than downloading from the upstream,
+// the archive obeys the same policy and canary as DownloadArchive.
+func (h *Handler) PeerArchive(req PeerArchiveRequest) (render.Render, error) {
+	addr := req.Address()
+
+	if err := served(req.Context.Request.Host, addr); err != nil {
+		return nil, err
+	}
+
+	if !policy.Get().ServesPlatform(addr.OS, addr.Arch) {
+		return nil, errorx.HttpErrorf(http.StatusNotFound, "platform %s_%s is not served", addr.OS, addr.Arch)
+	}
+
+	if err := maintenance.Error("downloading"); err != nil {
+		return nil, err
+	}
+
+	canary := h.s.Metadata.IsCanary(req.Context, addr)
+	if canary && !h.s.IsCanaryClient(req.Context.Request) {
+		return nil, errorx.HttpErrorf(http.StatusNotFound, "archive %s is not cached", req.Archive)
+	}
+
+	opts := storage.LoadArchiveOptions{
+		Hostname:  req.Hostname,
+		Namespace: req.Namespace,
+		Type:      req.Type,
+		Filename:  req.Archive,
+		Canary:    canary,
+	}
+
+	if !h.s.Storage.HasArchive(req.Context, opts) {
+		return nil, errorx.HttpErrorf(http.StatusNotFound, "archive %s is not cached", req.Archive)
+	}
+
+	ar, err := h.s.Storage.LoadArchive(req.Context, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if ar.NotModified(req.Context.Request) {
+		ar.RenderNotModified(req.Context)
+		return nil, nil
+	}
+
+	ar.Reader = timing.Reader(req.Context, timing.PhaseDisk, ar.Reader)
+
+	return ar, nil
+}
+
+// served returns 404 if the given provider is not served to the requested host.
+func served(host string, addr addrs.Address) error {
+	if !policy.Get().Serves(host, addr) {
+		return errorx.HttpErrorf(http.StatusNotFound, "provider %s is not served by %s", addr.TypedKey(), host)
+	}
+
+	return nil
 }
 
 func (h *Handler) SyncMetadata(req SyncMetadataRequest) error {
-	if !h.m.TryLock() {
-		return errorx.HttpErrorf(http.StatusLocked, "previous sync is not finished")
+	if err := maintenance.Error("syncing"); err != nil {
+		return err
 	}
 
+	// The metadata service merges the overlapping syncs.
 	gopool.Go(func() {
-		defer h.m.Unlock()
-
 		logger := log.WithName("apis").WithName("provider").WithName("sync_metadata")
 
 		timeout := req.Timeout
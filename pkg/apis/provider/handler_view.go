@@ -1,12 +1,16 @@
 package provider
 
 import (
+	"bytes"
 	"errors"
 	"regexp"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"k8s.io/apimachinery/pkg/util/sets"
+	"github.com/seal-io/walrus/utils/json"
+
+	"github.com/seal-io/hermitcrab/pkg/provider/addrs"
 )
 
 type (
@@ -17,12 +21,15 @@ type (
 		Namespace string `path:"namespace"`
 		Type      string `path:"type"`
 		Action    string `path:"action"` // Eg. Index.json for list versions, {version}.json for list versioned package.
+		// Platforms limits the archives of {version}.json to the given platforms in form of <OS>_<ARCH>,
+		// i.e. ?platform=linux_amd64&platform=darwin_arm64 or ?platform=linux_amd64,darwin_arm64.
+		Platforms []string `query:"platform,omitempty"`
 
 		Context *gin.Context
 	}
 
 	GetMetadataResponse struct {
-		Versions sets.Set[string]   `json:"versions,omitempty"`
+		Versions Versions           `json:"versions,omitempty"`
 		Archives map[string]Archive `json:"archives,omitempty"`
 	}
 
@@ -30,8 +37,36 @@ type (
 		URL    string   `json:"url"`
 		Hashes []string `json:"hashes"`
 	}
+
+	// Versions holds the ordered versions,
+	// which marshals as a JSON object keyed by the versions in order.
+	Versions []string
 )
 
+func (vs Versions) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+
+	b.WriteByte('{')
+
+	for i := range vs {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+
+		k, err := json.Marshal(vs[i])
+		if err != nil {
+			return nil, err
+		}
+
+		b.Write(k)
+		b.WriteString(":{}")
+	}
+
+	b.WriteByte('}')
+
+	return b.Bytes(), nil
+}
+
 func (r *GetMetadataRequest) SetGinContext(ctx *gin.Context) {
 	r.Context = ctx
 }
@@ -41,9 +76,46 @@ func (r *GetMetadataRequest) Validate() error {
 		return errors.New("invalid action")
 	}
 
+	// The hostname drives the discovery and the storage paths.
+	hostname, err := addrs.NormalizeHostname(r.Hostname)
+	if err != nil {
+		return err
+	}
+
+	addr := addrs.Address{
+		Hostname:  hostname,
+		Namespace: r.Namespace,
+		Type:      r.Type,
+	}.Normalize()
+	if err := addr.Validate(); err != nil {
+		return err
+	}
+
+	r.Hostname, r.Namespace, r.Type = addr.Hostname, addr.Namespace, addr.Type
+
+	// Accept both the repeated and comma separated platforms.
+	ps := make([]string, 0, len(r.Platforms))
+	for i := range r.Platforms {
+		for _, p := range strings.Split(r.Platforms[i], ",") {
+			if p = strings.ToLower(strings.TrimSpace(p)); p != "" {
+				ps = append(ps, p)
+			}
+		}
+	}
+	r.Platforms = ps
+
 	return nil
 }
 
+// Address returns the typed provider address of the request.
+func (r *GetMetadataRequest) Address() addrs.Address {
+	return addrs.Address{
+		Hostname:  r.Hostname,
+		Namespace: r.Namespace,
+		Type:      r.Type,
+	}
+}
+
 func (r *GetMetadataRequest) Version() string {
 	return r.Action[:len(r.Action)-5]
 }
@@ -69,28 +141,121 @@ func (r *DownloadArchiveRequest) SetGinContext(ctx *gin.Context) {
 	r.Context = ctx
 }
 
+// regexValidArchive matches the archive filename,
+// the type consists of letters, digits and hyphens, i.e. google-beta,
+// and the version may carry the prerelease and the build metadata.
 var regexValidArchive = regexp.MustCompile(
-	`^terraform-provider-(?P<type>\w+)_(?P<version>[\w|\\.]+)_(?P<os>[a-z]+)_(?P<arch>[a-z0-9]+)\.zip$`,
+	`^terraform-provider-(?P<type>[0-9A-Za-z-]+)_(?P<version>[0-9A-Za-z.+-]+)_(?P<os>[a-z]+)_(?P<arch>[a-z0-9]+)\.zip$`,
 )
 
 func (r *DownloadArchiveRequest) Validate() error {
-	ps := regexValidArchive.FindStringSubmatch(r.Archive)
+	addr, err := parseArchive(r.Hostname, r.Namespace, r.Type, r.Archive)
+	if err != nil {
+		return err
+	}
+
+	r.Hostname, r.Namespace, r.Type = addr.Hostname, addr.Namespace, addr.Type
+	r.Version = addr.Version
+	r.OS = addr.OS
+	r.Arch = addr.Arch
+
+	return nil
+}
+
+// parseArchive returns the normalized platform address of the given archive of the given typed provider.
+func parseArchive(hostname, namespace, typ, archive string) (addrs.Address, error) {
+	ps := regexValidArchive.FindStringSubmatch(archive)
 	if len(ps) != 5 {
-		return errors.New("invalid archive")
+		return addrs.Address{}, errors.New("invalid archive")
 	}
 	ps = ps[1:]
 
-	if r.Type != ps[0] {
-		return errors.New("invalid type")
+	// The hostname drives the discovery and the storage paths.
+	hostname, err := addrs.NormalizeHostname(hostname)
+	if err != nil {
+		return addrs.Address{}, err
 	}
 
-	r.Version = ps[1]
-	r.OS = ps[2]
-	r.Arch = ps[3]
+	addr := addrs.Address{
+		Hostname:  hostname,
+		Namespace: namespace,
+		Type:      typ,
+		Version:   ps[1],
+		OS:        ps[2],
+		Arch:      ps[3],
+	}.Normalize()
+	if err := addr.Validate(); err != nil {
+		return addrs.Address{}, err
+	}
+
+	if addr.Type != strings.ToLower(ps[0]) {
+		return addrs.Address{}, errors.New("invalid type")
+	}
+
+	return addr, nil
+}
+
+// Address returns the provider address of the request.
+func (r *DownloadArchiveRequest) Address() addrs.Address {
+	return addrs.Address{
+		Hostname:  r.Hostname,
+		Namespace: r.Namespace,
+		Type:      r.Type,
+		Version:   r.Version,
+		OS:        r.OS,
+		Arch:      r.Arch,
+	}
+}
+
+type (
+	// PeerArchiveRequest requests the cached archive by the peers,
+	// see storage.PeerArchiveURL.
+	PeerArchiveRequest struct {
+		_ struct{} `route:"GET=/:hostname/:namespace/:type/peer/:archive"`
+
+		Hostname  string `path:"hostname"`
+		Namespace string `path:"namespace"`
+		Type      string `path:"type"`
+		Archive   string `path:"archive"`
+
+		Version string
+		OS      string
+		Arch    string
+
+		Context *gin.Context
+	}
+)
+
+func (r *PeerArchiveRequest) SetGinContext(ctx *gin.Context) {
+	r.Context = ctx
+}
+
+func (r *PeerArchiveRequest) Validate() error {
+	addr, err := parseArchive(r.Hostname, r.Namespace, r.Type, r.Archive)
+	if err != nil {
+		return err
+	}
+
+	r.Hostname, r.Namespace, r.Type = addr.Hostname, addr.Namespace, addr.Type
+	r.Version = addr.Version
+	r.OS = addr.OS
+	r.Arch = addr.Arch
 
 	return nil
 }
 
+// Address returns the platform address of the request.
+func (r *PeerArchiveRequest) Address() addrs.Address {
+	return addrs.Address{
+		Hostname:  r.Hostname,
+		Namespace: r.Namespace,
+		Type:      r.Type,
+		Version:   r.Version,
+		OS:        r.OS,
+		Arch:      r.Arch,
+	}
+}
+
 type (
 	SyncMetadataRequest struct {
 		_ struct{} `route:"PUT=/sync"`
@@ -3,7 +3,9 @@ package provider
 import (
 	"testing"
 
+	"github.com/seal-io/walrus/utils/json"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func Test_regexValidArchive(t *testing.T) {
@@ -31,6 +33,22 @@ func Test_regexValidArchive(t *testing.T) {
 			given:    "terraform-provider-foo__darwin_amd64.zip.zip",
 			expected: false,
 		},
+		{
+			given:    "terraform-provider-google-beta_5.0.0_linux_amd64.zip",
+			expected: true,
+		},
+		{
+			given:    "terraform-provider-foo_1.2.3-beta.1+build.5_linux_amd64.zip",
+			expected: true,
+		},
+		{
+			given:    "terraform-provider-foo_bar_1.2.3_linux_amd64.zip",
+			expected: false,
+		},
+		{
+			given:    "terraform-provider-foo_1.2.3|1_linux_amd64.zip",
+			expected: false,
+		},
 	}
 	for _, tc := range testCases {
 		t.Run(tc.given, func(t *testing.T) {
@@ -39,3 +57,96 @@ func Test_regexValidArchive(t *testing.T) {
 		})
 	}
 }
+
+func TestDownloadArchiveRequest_Validate(t *testing.T) {
+	r := DownloadArchiveRequest{
+		Hostname:  "registry.terraform.io",
+		Namespace: "hashicorp",
+		Type:      "Google-Beta",
+		Archive:   "terraform-provider-google-beta_5.0.0-rc1_linux_amd64.zip",
+	}
+	require.NoError(t, r.Validate())
+	assert.Equal(t, "google-beta", r.Type)
+	assert.Equal(t, "5.0.0-rc1", r.Version)
+	assert.Equal(t, "terraform-provider-google-beta_5.0.0-rc1_linux_amd64.zip", r.Address().ArchiveFilename())
+
+	// Mismatch the type of the path.
+	r.Type = "google"
+	assert.Error(t, r.Validate())
+}
+
+func TestPeerArchiveRequest_Validate(t *testing.T) {
+	r := PeerArchiveRequest{
+		Hostname:  "registry.terraform.io",
+		Namespace: "hashicorp",
+		Type:      "null",
+		Archive:   "terraform-provider-null_3.2.1_windows_arm64.zip",
+	}
+	require.NoError(t, r.Validate())
+
+	addr := r.Address()
+	assert.Equal(t, "3.2.1", addr.Version)
+	assert.Equal(t, "windows", addr.OS)
+	assert.Equal(t, "arm64", addr.Arch)
+}
+
+func TestVersions_MarshalJSON(t *testing.T) {
+	vs := Versions{"2.0.0", "v2.0.0-beta", "1.10.0", "1.2.0", "unknown"}
+
+	bs, err := json.Marshal(GetMetadataResponse{Versions: vs})
+	require.NoError(t, err)
+	assert.Equal(t,
+		`{"versions":{"2.0.0":{},"v2.0.0-beta":{},"1.10.0":{},"1.2.0":{},"unknown":{}}}`,
+		string(bs))
+}
+
+func TestGetMetadataRequest_Validate_hostname(t *testing.T) {
+	testCases := []struct {
+		given    string
+		expected string
+	}{
+		{given: "Registry.Terraform.IO", expected: "registry.terraform.io"},
+		{given: "registry.terraform.io.", expected: "registry.terraform.io"},
+		{given: "registry.terraform.io:443", expected: "registry.terraform.io"},
+		{given: "localhost:8080", expected: "localhost:8080"},
+		{given: "127.0.0.1:8080", expected: "127.0.0.1:8080"},
+		{given: "[::1]:8080", expected: "[::1]:8080"},
+		{given: "xn--bcher-kva.example", expected: "xn--bcher-kva.example"},
+		{given: ".."},
+		{given: "..%2f..%2fetc"},
+		{given: "a..b"},
+		{given: `registry\terraform`},
+		{given: "-registry.terraform.io"},
+		{given: "registry.terraform.io:0"},
+		{given: "registry.terraform.io:https"},
+		{given: "bücher.example"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.given, func(t *testing.T) {
+			r := GetMetadataRequest{
+				Hostname:  tc.given,
+				Namespace: "hashicorp",
+				Type:      "null",
+				Action:    "index.json",
+			}
+
+			err := r.Validate()
+			if tc.expected == "" {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, r.Hostname)
+
+			d := DownloadArchiveRequest{
+				Hostname:  tc.given,
+				Namespace: "hashicorp",
+				Type:      "null",
+				Archive:   "terraform-provider-null_1.0.0_linux_amd64.zip",
+			}
+			require.NoError(t, d.Validate())
+			assert.Equal(t, tc.expected, d.Hostname)
+		})
+	}
+}
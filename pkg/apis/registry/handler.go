@@ -0,0 +1,140 @@
+package registry
+
+import (
+	"net/http"
+	"path"
+
+	"github.com/gin-gonic/gin"
+	"github.com/seal-io/walrus/utils/errorx"
+
+	"github.com/seal-io/hermitcrab/pkg/apis/runtime"
+	"github.com/seal-io/hermitcrab/pkg/policy"
+	"github.com/seal-io/hermitcrab/pkg/provider"
+	"github.com/seal-io/hermitcrab/pkg/provider/metadata"
+)
+
+// Discovery returns the handler to serve the remote service discovery document,
+// which advertises the provider registry protocol endpoint of this service,
+// so that the providers can be sourced as <HOST>/<NAMESPACE>/<TYPE>.
+// See https://developer.hashicorp.com/terraform/internals/remote-service-discovery.
+func Discovery(providersPath string) runtime.Handle {
+	doc := map[string]string{
+		"providers.v1": providersPath,
+	}
+
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, doc)
+	}
+}
+
+func Handle(service *provider.Service) *Handler {
+	return &Handler{
+		s: service,
+	}
+}
+
+// Handler serves the provider registry protocol,
+// the providers are mirrored from the default hostname,
+// and the archives are downloaded from the network mirror of this service.
+// See https://developer.hashicorp.com/terraform/internals/provider-registry-protocol.
+type Handler struct {
+	s *provider.Service
+}
+
+func (h *Handler) GetVersions(req GetVersionsRequest) (GetVersionsResponse, error) {
+	addr := req.Address()
+
+	if !policy.Get().Serves(req.Context.Request.Host, addr) {
+		return GetVersionsResponse{}, errorx.HttpErrorf(http.StatusNotFound,
+			"provider %s is not served by %s", addr.TypedKey(), req.Context.Request.Host)
+	}
+
+	// Serve the provider under the equivalent namespace if stored.
+	ra := h.s.Resolve(req.Context, addr)
+
+	mr, err := h.s.Metadata.GetVersions(metadata.WithUpstreamBudget(req.Context), metadata.GetVersionsOptions{
+		Hostname:  ra.Hostname,
+		Namespace: ra.Namespace,
+		Type:      ra.Type,
+	})
+	if err != nil {
+		return GetVersionsResponse{}, err
+	}
+
+	resp := GetVersionsResponse{
+		Versions: make([]Version, 0, len(mr)),
+	}
+
+	canary := h.s.IsCanaryClient(req.Context.Request)
+	av := h.s.Availability(req.Context, ra)
+
+	for i := range mr {
+		// Skip the canary version unless the client presents the canary token.
+		if mr[i].Canary && !canary {
+			continue
+		}
+
+		ps := av.Available(req.Context, mr[i])
+
+		// Skip the version without any cached platform in offline mode.
+		if h.s.Offline && len(ps) == 0 {
+			continue
+		}
+
+		v := Version{
+			Version:   mr[i].Version,
+			Protocols: mr[i].Protocols,
+			Platforms: make([]Platform, 0, len(ps)),
+		}
+
+		for j := range ps {
+			v.Platforms = append(v.Platforms, Platform{
+				OS:   ps[j].OS,
+				Arch: ps[j].Arch,
+			})
+		}
+
+		resp.Versions = append(resp.Versions, v)
+	}
+
+	return resp, nil
+}
+
+func (h *Handler) GetDownload(req GetDownloadRequest) (GetDownloadResponse, error) {
+	addr := req.Address()
+
+	if !policy.Get().Serves(req.Context.Request.Host, addr) {
+		return GetDownloadResponse{}, errorx.HttpErrorf(http.StatusNotFound,
+			"provider %s is not served by %s", addr.TypedKey(), req.Context.Request.Host)
+	}
+
+	if !policy.Get().ServesPlatform(addr.OS, addr.Arch) {
+		return GetDownloadResponse{}, errorx.HttpErrorf(http.StatusNotFound,
+			"platform %s_%s is not served", addr.OS, addr.Arch)
+	}
+
+	ra := h.s.Resolve(req.Context, addr)
+
+	if !h.s.IsCanaryClient(req.Context.Request) && h.s.Metadata.IsCanary(req.Context, ra) {
+		return GetDownloadResponse{}, errorx.HttpErrorf(http.StatusNotFound, "version %s is not found", ra.Version)
+	}
+
+	mr, err := h.s.Metadata.GetPlatform(metadata.WithUpstreamBudget(req.Context), metadata.GetPlatformOptions(ra))
+	if err != nil {
+		return GetDownloadResponse{}, err
+	}
+
+	return GetDownloadResponse{
+		Protocols: mr.Protocols,
+		OS:        mr.OS,
+		Arch:      mr.Arch,
+		Filename:  mr.Filename,
+		// Download the archive from the network mirror,
+		// which caches the archive.
+		DownloadURL:         "/" + path.Join("v1/providers", addr.TypedKey(), "download", mr.Filename),
+		ShasumsURL:          mr.ShasumsURL,
+		ShasumsSignatureURL: mr.ShasumsSignatureURL,
+		Shasum:              mr.Shasum,
+		SigningKeys:         mr.SigningKeys,
+	}, nil
+}
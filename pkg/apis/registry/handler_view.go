@@ -0,0 +1,113 @@
+package registry
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/seal-io/walrus/utils/json"
+
+	"github.com/seal-io/hermitcrab/pkg/provider/addrs"
+)
+
+type (
+	GetVersionsRequest struct {
+		_ struct{} `route:"GET=/:namespace/:type/versions"`
+
+		Namespace string `path:"namespace"`
+		Type      string `path:"type"`
+
+		Context *gin.Context
+	}
+
+	GetVersionsResponse struct {
+		Versions []Version `json:"versions"`
+	}
+
+	Version struct {
+		Version   string     `json:"version"`
+		Protocols []string   `json:"protocols,omitempty"`
+		Platforms []Platform `json:"platforms"`
+	}
+
+	Platform struct {
+		OS   string `json:"os"`
+		Arch string `json:"arch"`
+	}
+)
+
+func (r *GetVersionsRequest) SetGinContext(ctx *gin.Context) {
+	r.Context = ctx
+}
+
+func (r *GetVersionsRequest) Validate() error {
+	addr := r.Address()
+	if err := addr.Validate(); err != nil {
+		return err
+	}
+
+	r.Namespace, r.Type = addr.Namespace, addr.Type
+
+	return nil
+}
+
+// Address returns the provider address of the request,
+// which is mirrored from the default hostname.
+func (r *GetVersionsRequest) Address() addrs.Address {
+	return addrs.Address{
+		Hostname:  addrs.DefaultHostname,
+		Namespace: r.Namespace,
+		Type:      r.Type,
+	}.Normalize()
+}
+
+type (
+	GetDownloadRequest struct {
+		_ struct{} `route:"GET=/:namespace/:type/:version/download/:os/:arch"`
+
+		Namespace string `path:"namespace"`
+		Type      string `path:"type"`
+		Version   string `path:"version"`
+		OS        string `path:"os"`
+		Arch      string `path:"arch"`
+
+		Context *gin.Context
+	}
+
+	GetDownloadResponse struct {
+		Protocols           []string        `json:"protocols,omitempty"`
+		OS                  string          `json:"os"`
+		Arch                string          `json:"arch"`
+		Filename            string          `json:"filename"`
+		DownloadURL         string          `json:"download_url"`
+		ShasumsURL          string          `json:"shasums_url,omitempty"`
+		ShasumsSignatureURL string          `json:"shasums_signature_url,omitempty"`
+		Shasum              string          `json:"shasum"`
+		SigningKeys         json.RawMessage `json:"signing_keys,omitempty"`
+	}
+)
+
+func (r *GetDownloadRequest) SetGinContext(ctx *gin.Context) {
+	r.Context = ctx
+}
+
+func (r *GetDownloadRequest) Validate() error {
+	addr := r.Address()
+	if err := addr.Validate(); err != nil {
+		return err
+	}
+
+	r.Namespace, r.Type = addr.Namespace, addr.Type
+
+	return nil
+}
+
+// Address returns the provider address of the request,
+// which is mirrored from the default hostname.
+func (r *GetDownloadRequest) Address() addrs.Address {
+	return addrs.Address{
+		Hostname:  addrs.DefaultHostname,
+		Namespace: r.Namespace,
+		Type:      r.Type,
+		Version:   r.Version,
+		OS:        r.OS,
+		Arch:      r.Arch,
+	}.Normalize()
+}
@@ -0,0 +1,52 @@
+package release
+
+import (
+	"github.com/gin-gonic/gin/render"
+
+	"github.com/seal-io/hermitcrab/pkg/maintenance"
+	"github.com/seal-io/hermitcrab/pkg/release"
+)
+
+func Handle(service release.Service) *Handler {
+	return &Handler{
+		s: service,
+	}
+}
+
+type Handler struct {
+	s release.Service
+}
+
+func (h *Handler) GetReleases(req GetReleasesRequest) (GetReleasesResponse, error) {
+	vs, err := h.s.GetVersions(req.Context, req.Product)
+	if err != nil {
+		return GetReleasesResponse{}, err
+	}
+
+	resp := GetReleasesResponse{
+		Name:     req.Product,
+		Versions: make(map[string]release.Version, len(vs)),
+	}
+	for i := range vs {
+		resp.Versions[vs[i].Version] = vs[i]
+	}
+
+	return resp, nil
+}
+
+func (h *Handler) GetReleaseFile(req GetReleaseFileRequest) (render.Render, error) {
+	if req.Filename == "index.json" {
+		v, err := h.s.GetVersion(req.Context, req.Product, req.Version)
+		if err != nil {
+			return nil, err
+		}
+
+		return render.JSON{Data: v}, nil
+	}
+
+	if err := maintenance.Error("downloading"); err != nil {
+		return nil, err
+	}
+
+	return h.s.LoadFile(req.Context, req.Product, req.Version, req.Filename)
+}
@@ -0,0 +1,69 @@
+package release
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/seal-io/hermitcrab/pkg/release"
+)
+
+type (
+	GetReleasesRequest struct {
+		_ struct{} `route:"GET=/:product/index.json"`
+
+		Product string `path:"product"`
+
+		Context *gin.Context
+	}
+
+	GetReleasesResponse struct {
+		Name     string                     `json:"name"`
+		Versions map[string]release.Version `json:"versions"`
+	}
+)
+
+func (r *GetReleasesRequest) SetGinContext(ctx *gin.Context) {
+	r.Context = ctx
+}
+
+func (r *GetReleasesRequest) Validate() error {
+	if r.Product == "" {
+		return errors.New("invalid product")
+	}
+
+	return nil
+}
+
+type (
+	GetReleaseFileRequest struct {
+		_ struct{} `route:"GET=/:product/:version/:filename"`
+
+		Product  string `path:"product"`
+		Version  string `path:"version"`
+		Filename string `path:"filename"` // Eg. Index.json for the index of the version, or the released file.
+
+		Context *gin.Context
+	}
+)
+
+func (r *GetReleaseFileRequest) SetGinContext(ctx *gin.Context) {
+	r.Context = ctx
+}
+
+func (r *GetReleaseFileRequest) Validate() error {
+	if r.Product == "" {
+		return errors.New("invalid product")
+	}
+
+	if r.Version == "" {
+		return errors.New("invalid version")
+	}
+
+	if r.Filename == "" || strings.ContainsAny(r.Filename, `/\`) {
+		return errors.New("invalid filename")
+	}
+
+	return nil
+}
@@ -0,0 +1,155 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/seal-io/walrus/utils/errorx"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/seal-io/hermitcrab/pkg/download"
+	"github.com/seal-io/hermitcrab/pkg/maintenance"
+	"github.com/seal-io/hermitcrab/pkg/provider"
+	"github.com/seal-io/hermitcrab/pkg/provider/addrs"
+	"github.com/seal-io/hermitcrab/pkg/provider/metadata"
+	"github.com/seal-io/hermitcrab/pkg/provider/storage"
+)
+
+type admin struct {
+	UnimplementedAdminServer
+
+	s *provider.Service
+}
+
+func (a *admin) SyncMetadata(ctx context.Context, _ *SyncMetadataRequest) (*SyncMetadataResponse, error) {
+	err := a.s.Metadata.Sync(ctx)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &SyncMetadataResponse{}, nil
+}
+
+func (a *admin) GetVersions(ctx context.Context, req *GetVersionsRequest) (*GetVersionsResponse, error) {
+	addr := addrs.Address{
+		Hostname:  req.GetHostname(),
+		Namespace: req.GetNamespace(),
+		Type:      req.GetType(),
+	}.Normalize()
+	if err := addr.Validate(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	vs, err := a.s.Metadata.GetVersions(ctx, metadata.GetVersionsOptions{
+		Hostname:  addr.Hostname,
+		Namespace: addr.Namespace,
+		Type:      addr.Type,
+	})
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	resp := &GetVersionsResponse{
+		Versions: make([]*Version, 0, len(vs)),
+	}
+
+	for i := range vs {
+		v := &Version{
+			Version:   vs[i].Version,
+			Platforms: make([]*Platform, 0, len(vs[i].Platforms)),
+		}
+
+		for _, p := range vs[i].Platforms {
+			v.Platforms = append(v.Platforms, &Platform{
+				Os:       p.OS,
+				Arch:     p.Arch,
+				Filename: p.Filename,
+				Shasum:   p.Shasum,
+			})
+		}
+
+		resp.Versions = append(resp.Versions, v)
+	}
+
+	return resp, nil
+}
+
+func (a *admin) Prewarm(ctx context.Context, req *PrewarmRequest) (*PrewarmResponse, error) {
+	addr := addrs.Address{
+		Hostname:  req.GetHostname(),
+		Namespace: req.GetNamespace(),
+		Type:      req.GetType(),
+		Version:   req.GetVersion(),
+		OS:        req.GetOs(),
+		Arch:      req.GetArch(),
+	}.Normalize()
+	if err := addr.Validate(); err != nil || addr.Arch == "" {
+		return nil, status.Error(codes.InvalidArgument, "hostname, namespace, type, version, os and arch must be filled")
+	}
+
+	if err := maintenance.Error("downloading"); err != nil {
+		return nil, toStatus(err)
+	}
+
+	p, err := a.s.Metadata.GetPlatform(ctx, metadata.GetPlatformOptions(addr))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	if err = a.s.VerifyTrust(ctx, addr, p); err != nil {
+		return nil, toStatus(err)
+	}
+
+	// Give way to the interactive downloads.
+	ctx = download.WithPriority(ctx, download.PriorityBackground)
+
+	ar, err := a.s.Storage.LoadArchive(ctx, storage.LoadArchiveOptions{
+		Hostname:    addr.Hostname,
+		Namespace:   addr.Namespace,
+		Type:        addr.Type,
+		Filename:    p.Filename,
+		Shasum:      p.Shasum,
+		DownloadURL: p.DownloadURL,
+	})
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	if ar.Reader != nil {
+		_ = ar.Reader.Close()
+	}
+
+	return &PrewarmResponse{
+		Filename: p.Filename,
+		Shasum:   p.Shasum,
+		Size:     ar.ContentLength,
+	}, nil
+}
+
+// toStatus converts the given error to gRPC status.
+func toStatus(err error) error {
+	var he errorx.HttpError
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	case errors.Is(err, metadata.ErrTypedNotFound),
+		errors.Is(err, metadata.ErrVersionNotFound),
+		errors.Is(err, metadata.ErrPlatformNotFound),
+		errors.Is(err, metadata.ErrVersionRemoved),
+		errors.Is(err, metadata.ErrPlatformRemoved):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.As(err, &he) && he.Status == http.StatusForbidden:
+		// I.e. the archive signed by the unexpected keys.
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.As(err, &he) && he.Status == http.StatusServiceUnavailable:
+		// I.e. the refusal during the maintenance, or the exceeded upstream budget.
+		return status.Error(codes.Unavailable, err.Error())
+	}
+
+	return status.Error(codes.Internal, err.Error())
+}
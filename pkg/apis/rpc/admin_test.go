@@ -0,0 +1,28 @@
+package rpc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/seal-io/hermitcrab/pkg/maintenance"
+)
+
+func TestAdmin_Prewarm_maintenance(t *testing.T) {
+	maintenance.Enable("upgrading", time.Minute)
+	t.Cleanup(func() { maintenance.Disable() })
+
+	_, err := (&admin{}).Prewarm(context.Background(), &PrewarmRequest{
+		Hostname:  "registry.terraform.io",
+		Namespace: "hashicorp",
+		Type:      "null",
+		Version:   "3.2.1",
+		Os:        "linux",
+		Arch:      "amd64",
+	})
+	assert.Equal(t, codes.Unavailable, status.Code(err), "should never download during the maintenance")
+}
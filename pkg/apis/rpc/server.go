@@ -0,0 +1,135 @@
+package rpc
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"errors"
+	"net"
+	"strings"
+
+	"github.com/seal-io/walrus/utils/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+
+	"github.com/seal-io/hermitcrab/pkg/provider"
+)
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative admin.proto
+
+type ServeOptions struct {
+	// BindAddress is the address to listen, i.e. 127.0.0.1:9090.
+	BindAddress string
+	// Token is the bearer token to authenticate the clients,
+	// only the local clients are allowed if empty.
+	Token string
+	// TlsConfig is the TLS config to serve, i.e. the one of the apis,
+	// serves in plaintext if nil.
+	TlsConfig *tls.Config
+
+	ProviderService *provider.Service
+}
+
+// Serve serves the admin gRPC service until the given context canceled.
+func Serve(ctx context.Context, opts ServeOptions) error {
+	logger := log.WithName("rpc")
+
+	lis, err := net.Listen("tcp", opts.BindAddress)
+	if err != nil {
+		return err
+	}
+
+	srv := newServer(opts)
+
+	go func() {
+		<-ctx.Done()
+		srv.GracefulStop()
+	}()
+
+	if opts.TlsConfig == nil {
+		logger.Warnf("serving gRPC in plaintext on %s, the token is exposed to the network", lis.Addr())
+	} else {
+		logger.Infof("serving gRPC on %s", lis.Addr())
+	}
+
+	err = srv.Serve(lis)
+	if err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+		return err
+	}
+
+	return nil
+}
+
+// newServer returns the gRPC server of the given options,
+// all unary and stream calls are authenticated, including the reflection.
+func newServer(opts ServeOptions) *grpc.Server {
+	sopts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(authenticateUnary(opts.Token)),
+		grpc.ChainStreamInterceptor(authenticateStream(opts.Token)),
+	}
+	if opts.TlsConfig != nil {
+		sopts = append(sopts, grpc.Creds(credentials.NewTLS(opts.TlsConfig)))
+	}
+
+	srv := grpc.NewServer(sopts...)
+	RegisterAdminServer(srv, &admin{s: opts.ProviderService})
+	reflection.Register(srv)
+
+	return srv
+}
+
+// authenticateUnary returns an unary interceptor to authenticate the clients, see authenticate.
+func authenticateUnary(token string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if err := authenticate(ctx, token); err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// authenticateStream returns a stream interceptor to authenticate the clients, see authenticate.
+func authenticateStream(token string) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := authenticate(ss.Context(), token); err != nil {
+			return err
+		}
+
+		return handler(srv, ss)
+	}
+}
+
+// authenticate authenticates the client of the given context,
+// the client must carry the given token in the authorization metadata,
+// or be a local client if the given token is empty.
+func authenticate(ctx context.Context, token string) error {
+	if token == "" {
+		p, ok := peer.FromContext(ctx)
+		if !ok || !isLocalAddr(p.Addr) {
+			return status.Error(codes.PermissionDenied, "only local clients are allowed")
+		}
+
+		return nil
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, v := range md.Get("authorization") {
+		t, ok := strings.CutPrefix(v, "Bearer ")
+		if ok && subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			return nil
+		}
+	}
+
+	return status.Error(codes.Unauthenticated, "invalid token")
+}
+
+func isLocalAddr(addr net.Addr) bool {
+	ta, ok := addr.(*net.TCPAddr)
+	return ok && ta.IP.IsLoopback()
+}
@@ -0,0 +1,107 @@
+package rpc
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+)
+
+func TestServe_authenticate(t *testing.T) {
+	// Borrow the keypair of the test server.
+	ts := httptest.NewTLSServer(http.NotFoundHandler())
+	t.Cleanup(ts.Close)
+
+	cases := []struct {
+		name  string
+		opts  ServeOptions
+		creds credentials.TransportCredentials
+	}{
+		{
+			name:  "plaintext",
+			opts:  ServeOptions{Token: "secret"},
+			creds: insecure.NewCredentials(),
+		},
+		{
+			name:  "tls",
+			opts:  ServeOptions{Token: "secret", TlsConfig: ts.TLS},
+			creds: credentials.NewTLS(ts.Client().Transport.(*http.Transport).TLSClientConfig),
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			conn := serveTest(t, tc.opts, tc.creds)
+
+			anonymous := context.Background()
+			authorized := metadata.AppendToOutgoingContext(anonymous, "authorization", "Bearer secret")
+
+			// Unary.
+			_, err := NewAdminClient(conn).GetVersions(anonymous, &GetVersionsRequest{})
+			assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+			_, err = NewAdminClient(conn).GetVersions(authorized, &GetVersionsRequest{})
+			assert.Equal(t, codes.InvalidArgument, status.Code(err), "should pass the authentication")
+
+			// Stream, i.e. the reflection.
+			listServices := func(ctx context.Context) (*rpb.ServerReflectionResponse, error) {
+				stream, err := rpb.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+				if err != nil {
+					return nil, err
+				}
+
+				err = stream.Send(&rpb.ServerReflectionRequest{
+					MessageRequest: &rpb.ServerReflectionRequest_ListServices{},
+				})
+				if err != nil {
+					return nil, err
+				}
+
+				return stream.Recv()
+			}
+
+			_, err = listServices(anonymous)
+			assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+			resp, err := listServices(authorized)
+			require.NoError(t, err)
+			assert.Contains(t, resp.GetListServicesResponse().String(), "hermitcrab.admin.v1.Admin")
+		})
+	}
+
+	t.Run("plaintext client to tls", func(t *testing.T) {
+		conn := serveTest(t, ServeOptions{Token: "secret", TlsConfig: ts.TLS}, insecure.NewCredentials())
+
+		ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer secret")
+		_, err := NewAdminClient(conn).GetVersions(ctx, &GetVersionsRequest{})
+		assert.Equal(t, codes.Unavailable, status.Code(err), "should never send the token in plaintext")
+	})
+}
+
+func serveTest(t *testing.T, opts ServeOptions, creds credentials.TransportCredentials) *grpc.ClientConn {
+	t.Helper()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	srv := newServer(opts)
+	go func() { _ = srv.Serve(lis) }()
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithTransportCredentials(creds))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+
+	return conn
+}
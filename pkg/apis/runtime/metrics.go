@@ -20,7 +20,7 @@ func newStatsCollector() *statsCollector {
 				Name:      "request_inflight",
 				Help:      "The number of inflight request.",
 			},
-			[]string{"proto", "path", "method"},
+			[]string{"proto", "route", "path", "method"},
 		),
 		requestCounter: prometheus.NewCounterVec(
 			prometheus.CounterOpts{
@@ -28,7 +28,7 @@ func newStatsCollector() *statsCollector {
 				Name:      "request_total",
 				Help:      "The total number of requests.",
 			},
-			[]string{"proto", "path", "method", "code"},
+			[]string{"proto", "route", "path", "method", "code"},
 		),
 		requestDurations: prometheus.NewHistogramVec(
 			prometheus.HistogramOpts{
@@ -61,7 +61,7 @@ func newStatsCollector() *statsCollector {
 					60,
 				},
 			},
-			[]string{"proto", "path", "method", "code"},
+			[]string{"proto", "route", "path", "method", "code"},
 		),
 		requestSizes: prometheus.NewHistogramVec(
 			prometheus.HistogramOpts{
@@ -70,16 +70,16 @@ func newStatsCollector() *statsCollector {
 				Help:      "The request size distribution in bytes.",
 				Buckets:   prometheus.ExponentialBuckets(128, 2.0, 15), // 128B, 256B, ..., 2M.
 			},
-			[]string{"proto", "path", "method"},
+			[]string{"proto", "route", "path", "method"},
 		),
 		responseSizes: prometheus.NewHistogramVec(
 			prometheus.HistogramOpts{
 				Namespace: ns,
 				Name:      "response_sizes",
 				Help:      "The response size distribution in bytes.",
-				Buckets:   prometheus.ExponentialBuckets(128, 2.0, 15), // 128B, 256B, ..., 2M.
+				Buckets:   prometheus.ExponentialBuckets(128, 4.0, 12), // 128B, 512B, ..., 512M.
 			},
-			[]string{"proto", "path", "method"},
+			[]string{"proto", "route", "path", "method"},
 		),
 	}
 }
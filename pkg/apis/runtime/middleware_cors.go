@@ -0,0 +1,109 @@
+package runtime
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// CORSOptions holds the options of the CORS middleware.
+type CORSOptions struct {
+	// AllowOrigins holds the origins allowed to access,
+	// i.e. https://portal.corp, the * allows any origin.
+	AllowOrigins []string
+	// AllowMethods holds the methods allowed to access.
+	AllowMethods []string
+	// AllowHeaders holds the request headers allowed to carry.
+	AllowHeaders []string
+	// ExposeHeaders holds the response headers exposed to the browser.
+	ExposeHeaders []string
+	// MaxAge is the duration to cache the preflight result.
+	MaxAge time.Duration
+}
+
+// CORS is a gin middleware,
+// which is used for responding the cross-origin requests from browsers,
+// the preflight request is responded with 204 if the origin is allowed, otherwise 403.
+//
+// Since the preflight request matches no route,
+// CORS must be installed at the root router to intercept.
+func CORS(opts CORSOptions) Handle {
+	if len(opts.AllowOrigins) == 0 {
+		return next()
+	}
+
+	origins := sets.New[string]()
+	for i := range opts.AllowOrigins {
+		origins.Insert(strings.ToLower(strings.TrimSuffix(opts.AllowOrigins[i], "/")))
+	}
+	anyOrigin := origins.Has("*")
+
+	methods := strings.Join(opts.AllowMethods, ", ")
+	headers := strings.Join(opts.AllowHeaders, ", ")
+	exposeHeaders := strings.Join(opts.ExposeHeaders, ", ")
+
+	var maxAge string
+	if opts.MaxAge > 0 {
+		maxAge = strconv.Itoa(int(opts.MaxAge.Seconds()))
+	}
+
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if origin == "" {
+			c.Next()
+			return
+		}
+
+		c.Writer.Header().Add("Vary", "Origin")
+
+		preflight := c.Request.Method == http.MethodOptions &&
+			c.GetHeader("Access-Control-Request-Method") != ""
+
+		if !anyOrigin && !origins.Has(strings.ToLower(origin)) {
+			if preflight {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+
+			c.Next()
+
+			return
+		}
+
+		h := c.Writer.Header()
+
+		if anyOrigin {
+			h.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			h.Set("Access-Control-Allow-Origin", origin)
+		}
+
+		if !preflight {
+			if exposeHeaders != "" {
+				h.Set("Access-Control-Expose-Headers", exposeHeaders)
+			}
+
+			c.Next()
+
+			return
+		}
+
+		if methods != "" {
+			h.Set("Access-Control-Allow-Methods", methods)
+		}
+
+		if headers != "" {
+			h.Set("Access-Control-Allow-Headers", headers)
+		}
+
+		if maxAge != "" {
+			h.Set("Access-Control-Max-Age", maxAge)
+		}
+
+		c.AbortWithStatus(http.StatusNoContent)
+	}
+}
@@ -8,6 +8,8 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/seal-io/walrus/utils/errorx"
 	"github.com/seal-io/walrus/utils/log"
+
+	"github.com/seal-io/hermitcrab/pkg/redact"
 )
 
 // erroring is a gin middleware,
@@ -28,19 +30,45 @@ func erroring(c *gin.Context) {
 	// Get errors from chain and parse into response.
 	he := getHttpError(c)
 
+	// Ask the client to retry later if required,
+	// i.e. the refusal during the maintenance.
+	var ra retryAfter
+	for i := range he.errs {
+		if errors.As(he.errs[i], &ra) {
+			c.Header("Retry-After", ra.RetryAfter())
+			break
+		}
+	}
+
 	// Log errors.
-	if len(he.errs) != 0 && withinStacktraceStatus(he.Status) {
+	if len(he.errs) != 0 && ra == nil && withinStacktraceStatus(he.Status) {
 		reqMethod := c.Request.Method
 
-		reqPath := c.Request.URL.Path
-		if raw := c.Request.URL.RawQuery; raw != "" {
-			reqPath = reqPath + "?" + raw
-		}
+		reqPath := redact.URL(c.Request.URL)
 
 		log.WithName("api").
 			Errorf("error requesting %s %s: %v", reqMethod, reqPath, errorx.Format(he.errs))
 	}
 
+	// Code the error since the API version 2,
+	// so that the clients never parse the message.
+	if APIVersionOf(c) >= 2 {
+		he.Code = codeOf(he)
+	}
+
+	// Detail the error if structured,
+	// i.e. the published platforms of the version.
+	var ed errorDetailer
+	for i := range he.errs {
+		if errors.As(he.errs[i], &ed) {
+			he.Details = ed.ErrorDetails()
+			break
+		}
+	}
+
+	// Mask the credentials leaked from the upstream errors.
+	he.Message = redact.String(he.Message)
+
 	c.AbortWithStatusJSON(he.Status, he)
 }
 
@@ -85,6 +113,10 @@ type ErrorResponse struct {
 	Message    string `json:"message"`
 	Status     int    `json:"status"`
 	StatusText string `json:"statusText"`
+	// Code is the machine-readable code of the error since the API version 2.
+	Code string `json:"code,omitempty"`
+	// Details is the structured details of the error if any.
+	Details any `json:"details,omitempty"`
 
 	// Errs is the all errors from gin context errors.
 	errs []error
@@ -117,6 +149,38 @@ func diagnoseError(ge *gin.Error) (int, string) {
 	return c, b.String()
 }
 
+// retryAfter is implemented by the errors asking the client to retry later,
+// which returns the value of the Retry-After header.
+type retryAfter interface {
+	RetryAfter() string
+}
+
+// errorCoder is implemented by the errors with the machine-readable code,
+// which returns the code of the error, i.e. maintenance.
+type errorCoder interface {
+	ErrorCode() string
+}
+
+// errorDetailer is implemented by the errors with the structured details,
+// which returns the details to render in the response.
+type errorDetailer interface {
+	ErrorDetails() any
+}
+
+// codeOf returns the code of the given error response,
+// which is the code of the first coded error,
+// or the snake case of the status text if no coded errors.
+func codeOf(he ErrorResponse) string {
+	var ec errorCoder
+	for i := range he.errs {
+		if errors.As(he.errs[i], &ec) {
+			return ec.ErrorCode()
+		}
+	}
+
+	return strings.ReplaceAll(strings.ToLower(strings.ReplaceAll(he.StatusText, "-", " ")), " ", "_")
+}
+
 func withinStacktraceStatus(status int) bool {
 	return (status < http.StatusOK || status >= http.StatusInternalServerError) &&
 		status != http.StatusSwitchingProtocols
@@ -1,7 +1,9 @@
 package runtime
 
 import (
+	"crypto/subtle"
 	"net/http"
+	"strings"
 	"sync"
 
 	"github.com/gin-gonic/gin"
@@ -41,6 +43,45 @@ func OnlyLocalIP() Handle {
 	return Only(isLocalIP)
 }
 
+// OnlyToken judges the incoming request whether carries the given bearer token,
+// or is from localhost if the given token is empty,
+// aborts with 403 if not match.
+func OnlyToken(token string) Handle {
+	if token == "" {
+		return OnlyLocalIP()
+	}
+
+	hasToken := func(c *gin.Context) bool {
+		t, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		return ok && subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1
+	}
+
+	return Only(hasToken)
+}
+
+// OnlyBasicAuth judges the incoming request whether carries the given basic auth credentials,
+// or allows all requests if the given username is empty,
+// aborts with 401 if not match.
+func OnlyBasicAuth(username, password string) Handle {
+	if username == "" {
+		return next()
+	}
+
+	return func(c *gin.Context) {
+		u, p, ok := c.Request.BasicAuth()
+		if !ok ||
+			subtle.ConstantTimeCompare([]byte(u), []byte(username)) != 1 ||
+			subtle.ConstantTimeCompare([]byte(p), []byte(password)) != 1 {
+			c.Header("WWW-Authenticate", `Basic realm="hermitcrab"`)
+			c.AbortWithStatus(http.StatusUnauthorized)
+
+			return
+		}
+
+		c.Next()
+	}
+}
+
 // If is a gin middleware,
 // which is used for judging the incoming request,
 // execute given handle if matched.
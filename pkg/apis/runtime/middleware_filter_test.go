@@ -0,0 +1,44 @@
+package runtime
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOnlyBasicAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	do := func(h Handle, username, password string) *httptest.ResponseRecorder {
+		e := gin.New()
+		e.Use(h)
+		e.GET("/metrics", func(c *gin.Context) {
+			c.Status(http.StatusOK)
+		})
+
+		r := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		if username != "" {
+			r.SetBasicAuth(username, password)
+		}
+
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, r)
+
+		return w
+	}
+
+	// Allow all requests without credentials.
+	assert.Equal(t, http.StatusOK, do(OnlyBasicAuth("", ""), "", "").Code)
+
+	h := OnlyBasicAuth("admin", "secret")
+
+	w := do(h, "", "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Header().Get("WWW-Authenticate"), "Basic")
+
+	assert.Equal(t, http.StatusUnauthorized, do(h, "admin", "wrong").Code)
+	assert.Equal(t, http.StatusOK, do(h, "admin", "secret").Code)
+}
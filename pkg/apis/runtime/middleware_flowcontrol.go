@@ -3,7 +3,10 @@ package runtime
 import (
 	"context"
 	"errors"
+	"math"
 	"net/http"
+	"strconv"
+	"sync"
 	"sync/atomic"
 	"time"
 	"unsafe"
@@ -87,6 +90,43 @@ func RequestThrottling(qps, burst int) Handle {
 	}
 }
 
+// RequestCooldown allows one request within the given duration,
+// returns 429 with the Retry-After header if the new request arrives during the cooldown,
+// the cooldown is disabled if the given duration is not positive.
+func RequestCooldown(d time.Duration) Handle {
+	if d <= 0 {
+		return next()
+	}
+
+	var (
+		mu    sync.Mutex
+		until time.Time
+	)
+
+	return func(c *gin.Context) {
+		now := time.Now()
+
+		mu.Lock()
+
+		if now.Before(until) {
+			wait := until.Sub(now)
+
+			mu.Unlock()
+
+			c.Header("Retry-After", strconv.FormatInt(int64(math.Ceil(wait.Seconds())), 10))
+			c.AbortWithStatus(http.StatusTooManyRequests)
+
+			return
+		}
+
+		until = now.Add(d)
+
+		mu.Unlock()
+
+		c.Next()
+	}
+}
+
 // RequestShaping arranges all requests to be received on the given qps,
 // returns 429 if the new request can be allowed within the given latency,
 // if the given latency is not positive, RequestShaping will never return 429.
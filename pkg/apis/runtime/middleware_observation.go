@@ -10,6 +10,9 @@ import (
 	"k8s.io/apimachinery/pkg/util/sets"
 
 	"github.com/seal-io/walrus/utils/log"
+
+	"github.com/seal-io/hermitcrab/pkg/redact"
+	"github.com/seal-io/hermitcrab/pkg/timing"
 )
 
 // SkipLoggingPaths is a RouterOption to ignore logging for the given paths.
@@ -21,6 +24,53 @@ func SkipLoggingPaths(paths ...string) RouterOption {
 	})
 }
 
+// StructuredLogging is a RouterOption to log the access with structured fields,
+// which is friendly to the JSON log collectors.
+func StructuredLogging(enabled bool) RouterOption {
+	return routerOption(func(r *Router) {
+		structuredLogging = enabled
+	})
+}
+
+var structuredLogging bool
+
+// WithRouteNamer is a RouterOption to name the route of the request for monitoring,
+// which breaks down the metrics of the same route by the named purpose,
+// the route is labeled with the full path if the namer returns blank.
+func WithRouteNamer(namer func(c *gin.Context) string) RouterOption {
+	return routerOption(func(r *Router) {
+		routeNamer = namer
+	})
+}
+
+var routeNamer func(c *gin.Context) string
+
+// WithSlowRequestThreshold is a RouterOption to warn the request exceeding the given threshold,
+// with the timing breakdown of the request, disabled if the threshold is zero.
+func WithSlowRequestThreshold(threshold time.Duration) RouterOption {
+	return routerOption(func(r *Router) {
+		slowRequestThreshold = threshold
+	})
+}
+
+var slowRequestThreshold time.Duration
+
+// routeNameOf returns the route name of the request,
+// which is bounded to avoid high cardinality.
+func routeNameOf(c *gin.Context) string {
+	if routeNamer != nil {
+		if n := routeNamer(c); n != "" {
+			return n
+		}
+	}
+
+	if p := c.FullPath(); p != "" {
+		return p
+	}
+
+	return "unmatched"
+}
+
 var (
 	pathSkipLogging       = sets.New[string]()
 	pathPrefixSkipLogging = sets.New[string]()
@@ -64,6 +114,7 @@ func observing(c *gin.Context) {
 	}
 
 	reqProto := c.Request.Proto
+	reqRoute := routeNameOf(c)
 	reqMethod := c.Request.Method
 
 	switch {
@@ -75,21 +126,38 @@ func observing(c *gin.Context) {
 
 	// Record inflight request.
 	_statsCollector.requestInflight.
-		WithLabelValues(reqProto, reqPath, reqMethod).
+		WithLabelValues(reqProto, reqRoute, reqPath, reqMethod).
 		Inc()
 
 	defer func() {
 		_statsCollector.requestInflight.
-			WithLabelValues(reqProto, reqPath, reqMethod).
+			WithLabelValues(reqProto, reqRoute, reqPath, reqMethod).
 			Dec()
 	}()
 
+	// Track the timing breakdown for the slow request logging.
+	var breakdown *timing.Breakdown
+	if slowRequestThreshold > 0 {
+		breakdown = timing.New()
+		c.Set(timing.ContextKey, breakdown)
+	}
+
 	start := time.Now()
 
 	c.Next()
 
 	reqLatency := time.Since(start)
 
+	if breakdown != nil && reqLatency > slowRequestThreshold {
+		kvs := []any{"route", reqRoute, "status", c.Writer.Status(), "latency", reqLatency.String()}
+		for _, p := range c.Params {
+			kvs = append(kvs, p.Key, p.Value)
+		}
+
+		logger.WithValues(append(kvs, breakdown.LogValues()...)...).
+			Warnf("slow request %s %s", reqMethod, redact.URL(c.Request.URL))
+	}
+
 	reqSize := c.Request.ContentLength
 	if v := c.GetInt64("request_size"); v != 0 {
 		reqSize = v
@@ -109,22 +177,22 @@ func observing(c *gin.Context) {
 
 	// Record request latency.
 	_statsCollector.requestDurations.
-		WithLabelValues(reqProto, reqPath, reqMethod, respStatus).
+		WithLabelValues(reqProto, reqRoute, reqPath, reqMethod, respStatus).
 		Observe(reqLatency.Seconds())
 
 	// Record request time.
 	_statsCollector.requestCounter.
-		WithLabelValues(reqProto, reqPath, reqMethod, respStatus).
+		WithLabelValues(reqProto, reqRoute, reqPath, reqMethod, respStatus).
 		Inc()
 
 	// Record request size.
 	_statsCollector.requestSizes.
-		WithLabelValues(reqProto, reqPath, reqMethod).
+		WithLabelValues(reqProto, reqRoute, reqPath, reqMethod).
 		Observe(float64(reqSize))
 
 	// Record response size.
 	_statsCollector.responseSizes.
-		WithLabelValues(reqProto, reqPath, reqMethod).
+		WithLabelValues(reqProto, reqRoute, reqPath, reqMethod).
 		Observe(float64(respSize))
 
 	if !skipLogging {
@@ -139,12 +207,24 @@ func observing(c *gin.Context) {
 
 		reqClientIP := c.ClientIP()
 
-		reqPath := c.Request.URL.Path
-		if raw := c.Request.URL.RawQuery; raw != "" {
-			reqPath = reqPath + "?" + raw
+		reqPath := redact.URL(c.Request.URL)
+
+		if structuredLogging {
+			logger.WithValues(
+				"status", respStatus,
+				"proto", reqProto,
+				"request_size", reqSize,
+				"response_size", respSize,
+				"latency", reqLatency.String(),
+				"client_ip", reqClientIP,
+				"method", reqMethod,
+				"path", reqPath,
+			).Debug("access")
+
+			return
 		}
 
-		logger.Debugf("%s | %8s | %10s | %10s | %13v | %15s | %-7s %s",
+		logger.Debugf("status=%s proto=%s request_size=%q response_size=%q latency=%v client_ip=%s method=%s path=%q",
 			respStatus,
 			reqProto,
 			reqSize,
@@ -0,0 +1,65 @@
+package runtime
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// apiVersionContextKey is the key of the gin context,
+// which holds the major version of the API serving the request.
+const apiVersionContextKey = "hermitcrab.api.version"
+
+// APIVersion is a gin middleware,
+// which marks the request served by the given major version of the API,
+// so that the handlers shared among the versions can land the new behaviors
+// only on the newer versions, i.e. the error codes.
+func APIVersion(v int) Handle {
+	return func(c *gin.Context) {
+		c.Set(apiVersionContextKey, v)
+		c.Next()
+	}
+}
+
+// APIVersionOf returns the major version of the API serving the given request,
+// default is 1 if not marked.
+func APIVersionOf(c *gin.Context) int {
+	if v, ok := c.Get(apiVersionContextKey); ok {
+		return v.(int)
+	}
+
+	return 1
+}
+
+// DeprecationOptions holds the options of the deprecated routes.
+type DeprecationOptions struct {
+	// Sunset is the time the deprecated routes stop serving,
+	// which drives the Sunset header if not zero.
+	Sunset time.Time
+	// Successor returns the path of the successor route of the given request path,
+	// which drives the Link header if not blank.
+	Successor func(path string) string
+}
+
+// Deprecated is a gin middleware,
+// which announces the deprecation of the routes by the Deprecation and the Sunset(RFC 8594) headers,
+// and links to the successor routes,
+// the deprecated routes keep serving as usual.
+func Deprecated(opts DeprecationOptions) Handle {
+	return func(c *gin.Context) {
+		c.Header("Deprecation", "true")
+
+		if !opts.Sunset.IsZero() {
+			c.Header("Sunset", opts.Sunset.UTC().Format(http.TimeFormat))
+		}
+
+		if opts.Successor != nil {
+			if s := opts.Successor(c.Request.URL.Path); s != "" {
+				c.Header("Link", "<"+s+`>; rel="successor-version"`)
+			}
+		}
+
+		c.Next()
+	}
+}
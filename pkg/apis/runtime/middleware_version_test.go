@@ -0,0 +1,63 @@
+package runtime
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/seal-io/walrus/utils/errorx"
+	"github.com/seal-io/walrus/utils/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIVersion(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	e := gin.New()
+	e.Use(erroring)
+
+	sunset := time.Date(2027, 6, 30, 0, 0, 0, 0, time.UTC)
+
+	notFound := func(c *gin.Context) {
+		_ = c.Error(errorx.HttpErrorf(http.StatusNotFound, "version is not found"))
+	}
+
+	e.Group("/v1").
+		Use(Deprecated(DeprecationOptions{
+			Sunset: sunset,
+			Successor: func(p string) string {
+				return "/v2" + p[len("/v1"):]
+			},
+		})).
+		GET("/versions", notFound)
+	e.Group("/v2").
+		Use(APIVersion(2)).
+		GET("/versions", notFound)
+
+	do := func(p string) (*httptest.ResponseRecorder, ErrorResponse) {
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, p, nil))
+
+		var er ErrorResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &er))
+
+		return w, er
+	}
+
+	// Announce the deprecation, and keep the response of the version 1.
+	w, er := do("/v1/versions")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "true", w.Header().Get("Deprecation"))
+	assert.Equal(t, "Wed, 30 Jun 2027 00:00:00 GMT", w.Header().Get("Sunset"))
+	assert.Equal(t, `</v2/versions>; rel="successor-version"`, w.Header().Get("Link"))
+	assert.Empty(t, er.Code)
+
+	// Code the error since the version 2.
+	w, er = do("/v2/versions")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Empty(t, w.Header().Get("Deprecation"))
+	assert.Equal(t, "not_found", er.Code)
+}
@@ -1,11 +1,17 @@
 package runtime
 
 import (
+	"encoding/base64"
+	"encoding/hex"
 	"io"
 	"math"
+	"mime"
 	"net/http"
+	"path/filepath"
 	"reflect"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
@@ -107,28 +113,66 @@ type ResponsePagination struct {
 // ResponseFile is similar to render.Reader,
 // but be able to close the file reader out of the handler processing.
 type ResponseFile struct {
+	// ContentType is the MIME type of the file,
+	// default is detected from the Filename.
 	ContentType   string
 	ContentLength int64
-	Headers       map[string]string
-	Reader        io.ReadCloser
+	// Filename is the name of the file to download as,
+	// which drives the Content-Disposition header if not blank.
+	Filename string
+	// Checksum is the hex encoded sha256 checksum of the file,
+	// which drives the ETag, Digest and X-Checksum-Sha256 headers if not blank.
+	Checksum string
+	// Modified is the last modified time of the file,
+	// which drives the Last-Modified header if not zero.
+	Modified time.Time
+	Headers  map[string]string
+	Reader   io.ReadCloser
 }
 
 func (r ResponseFile) Render(w http.ResponseWriter) (err error) {
 	r.WriteContentType(w)
 
+	if r.Headers == nil {
+		r.Headers = map[string]string{}
+	}
+
 	if r.ContentLength > 0 {
-		if r.Headers == nil {
-			r.Headers = map[string]string{}
-		}
 		r.Headers["Content-Length"] = strconv.FormatInt(r.ContentLength, 10)
 	}
 
+	if _, ok := r.Headers["Content-Disposition"]; !ok && r.Filename != "" {
+		r.Headers["Content-Disposition"] = mime.FormatMediaType("attachment", map[string]string{"filename": r.Filename})
+	}
+
+	if r.Checksum != "" {
+		if _, ok := r.Headers["ETag"]; !ok {
+			r.Headers["ETag"] = `"` + r.Checksum + `"`
+		}
+
+		if bs, err := hex.DecodeString(r.Checksum); err == nil {
+			r.Headers["Digest"] = "sha-256=" + base64.StdEncoding.EncodeToString(bs)
+			r.Headers["X-Checksum-Sha256"] = r.Checksum
+		}
+	}
+
+	if _, ok := r.Headers["Last-Modified"]; !ok && !r.Modified.IsZero() {
+		r.Headers["Last-Modified"] = r.Modified.UTC().Format(http.TimeFormat)
+	}
+
 	header := w.Header()
 	for k, v := range r.Headers {
 		if header.Get(k) == "" {
 			header.Set(k, v)
 		}
 	}
+
+	// Give the writer a chance to skip reading, e.g. responding the HEAD request.
+	if rf, ok := w.(io.ReaderFrom); ok {
+		_, err = rf.ReadFrom(r.Reader)
+		return
+	}
+
 	_, err = io.Copy(w, r.Reader)
 
 	return
@@ -137,14 +181,99 @@ func (r ResponseFile) Render(w http.ResponseWriter) (err error) {
 func (r ResponseFile) WriteContentType(w http.ResponseWriter) {
 	header := w.Header()
 	if vs := header["Content-Type"]; len(vs) == 0 {
-		contentType := "application/octet-stream"
-		if r.ContentType != "" {
-			contentType = r.ContentType
+		contentType := r.ContentType
+		if contentType == "" {
+			contentType = ContentTypeOf(r.Filename)
 		}
 		header["Content-Type"] = []string{contentType}
 	}
 }
 
+// ContentTypeOf returns the MIME type of the given filename by the extension,
+// default is application/octet-stream.
+func ContentTypeOf(filename string) string {
+	switch n := strings.ToLower(filename); {
+	case strings.HasSuffix(n, ".zip"):
+		return "application/zip"
+	case strings.HasSuffix(n, ".tar.gz"), strings.HasSuffix(n, ".tgz"):
+		return "application/gzip"
+	case strings.HasSuffix(n, ".tar"):
+		return "application/x-tar"
+	}
+
+	if t := mime.TypeByExtension(filepath.Ext(filename)); t != "" {
+		return t
+	}
+
+	return "application/octet-stream"
+}
+
+// NotModified returns true if the given conditional request matches the file,
+// the If-None-Match takes precedence over the If-Modified-Since,
+// see https://www.rfc-editor.org/rfc/rfc9110#section-13.2.2.
+func (r ResponseFile) NotModified(req *http.Request) bool {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return false
+	}
+
+	if inm := req.Header.Get("If-None-Match"); inm != "" {
+		etag := strings.TrimPrefix(r.etag(), "W/")
+		if etag == "" {
+			return false
+		}
+
+		for _, et := range strings.Split(inm, ",") {
+			et = strings.TrimPrefix(strings.TrimSpace(et), "W/")
+			if et == "*" || et == etag {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	if ims := req.Header.Get("If-Modified-Since"); ims != "" && !r.Modified.IsZero() {
+		t, err := http.ParseTime(ims)
+		return err == nil && !r.Modified.Truncate(time.Second).After(t)
+	}
+
+	return false
+}
+
+// RenderNotModified responds 304 with the validators and the Cache-Control of the file,
+// and closes the file.
+func (r ResponseFile) RenderNotModified(c *gin.Context) {
+	defer func() { _ = r.Close() }()
+
+	if etag := r.etag(); etag != "" {
+		c.Header("ETag", etag)
+	}
+
+	if !r.Modified.IsZero() {
+		c.Header("Last-Modified", r.Modified.UTC().Format(http.TimeFormat))
+	}
+
+	if cc := r.Headers["Cache-Control"]; cc != "" {
+		c.Header("Cache-Control", cc)
+	}
+
+	c.Status(http.StatusNotModified)
+	c.Writer.WriteHeaderNow()
+}
+
+// etag returns the ETag of the file, blank if neither specified nor checksummed.
+func (r ResponseFile) etag() string {
+	if et, ok := r.Headers["ETag"]; ok {
+		return et
+	}
+
+	if r.Checksum != "" {
+		return `"` + r.Checksum + `"`
+	}
+
+	return ""
+}
+
 func (r ResponseFile) Close() error {
 	if r.Reader == nil {
 		return nil
@@ -0,0 +1,148 @@
+package runtime
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResponseFile_Render(t *testing.T) {
+	testCases := []struct {
+		name     string
+		given    ResponseFile
+		expected map[string]string
+	}{
+		{
+			name: "zip",
+			given: ResponseFile{
+				Filename: "terraform-provider-null_3.2.1_linux_amd64.zip",
+				Checksum: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+			},
+			expected: map[string]string{
+				"Content-Type":        "application/zip",
+				"Content-Disposition": "attachment; filename=terraform-provider-null_3.2.1_linux_amd64.zip",
+				"ETag":                `"e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"`,
+				"Digest":              "sha-256=47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=",
+				"X-Checksum-Sha256":   "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+			},
+		},
+		{
+			name: "tar.gz",
+			given: ResponseFile{
+				Filename: "terraform-aws-vpc-5.0.0.tar.gz",
+			},
+			expected: map[string]string{
+				"Content-Type":        "application/gzip",
+				"Content-Disposition": "attachment; filename=terraform-aws-vpc-5.0.0.tar.gz",
+				"ETag":                "",
+				"Last-Modified":       "",
+			},
+		},
+		{
+			name: "modified",
+			given: ResponseFile{
+				Filename: "terraform-provider-null_3.2.1_linux_amd64.zip",
+				Modified: time.Date(2024, 1, 2, 3, 4, 5, 0, time.FixedZone("UTC+8", 8*60*60)),
+			},
+			expected: map[string]string{
+				"Last-Modified": "Mon, 01 Jan 2024 19:04:05 GMT",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.given.Reader = io.NopCloser(strings.NewReader(""))
+
+			w := httptest.NewRecorder()
+			require.NoError(t, tc.given.Render(w))
+
+			for k, v := range tc.expected {
+				assert.Equal(t, v, w.Header().Get(k), k)
+			}
+		})
+	}
+}
+
+func TestResponseFile_NotModified(t *testing.T) {
+	const checksum = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+	modified := time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC)
+
+	testCases := []struct {
+		name     string
+		method   string
+		headers  map[string]string
+		expected bool
+	}{
+		{
+			name:     "unconditional",
+			expected: false,
+		},
+		{
+			name:     "matched etag",
+			headers:  map[string]string{"If-None-Match": `"other", "` + checksum + `"`},
+			expected: true,
+		},
+		{
+			name:     "weak etag",
+			headers:  map[string]string{"If-None-Match": `W/"` + checksum + `"`},
+			expected: true,
+		},
+		{
+			name:     "any etag",
+			headers:  map[string]string{"If-None-Match": "*"},
+			expected: true,
+		},
+		{
+			name: "mismatched etag takes precedence",
+			headers: map[string]string{
+				"If-None-Match":     `"other"`,
+				"If-Modified-Since": modified.Add(time.Hour).Format(http.TimeFormat),
+			},
+			expected: false,
+		},
+		{
+			name:     "not modified since",
+			headers:  map[string]string{"If-Modified-Since": modified.Format(http.TimeFormat)},
+			expected: true,
+		},
+		{
+			name:     "modified since",
+			headers:  map[string]string{"If-Modified-Since": modified.Add(-time.Hour).Format(http.TimeFormat)},
+			expected: false,
+		},
+		{
+			name:     "unsafe method",
+			method:   http.MethodPost,
+			headers:  map[string]string{"If-None-Match": "*"},
+			expected: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			method := tc.method
+			if method == "" {
+				method = http.MethodGet
+			}
+
+			req := httptest.NewRequest(method, "/", nil)
+			for k, v := range tc.headers {
+				req.Header.Set(k, v)
+			}
+
+			r := ResponseFile{
+				Checksum: checksum,
+				Modified: modified,
+			}
+			assert.Equal(t, tc.expected, r.NotModified(req))
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"io"
 
 	"github.com/gin-gonic/gin"
+	"github.com/seal-io/walrus/utils/log"
 )
 
 // ginGlobalOption is the function type of RouterOption,
@@ -38,6 +39,23 @@ func WithDefaultWriter(w io.Writer) RouterOption {
 	})
 }
 
+// WithTrustedProxies is a RouterOption to configure the trusted proxies in form of IP or CIDR,
+// the client IP is extracted from the X-Forwarded-For or X-Real-IP header
+// only if the request comes from a trusted proxy,
+// otherwise, the remote address is treated as the client IP.
+func WithTrustedProxies(proxies []string) RouterOption {
+	return ginEngineOption(func(eng *gin.Engine) {
+		eng.ForwardedByClientIP = true
+		eng.RemoteIPHeaders = []string{"X-Forwarded-For", "X-Real-IP"}
+
+		if err := eng.SetTrustedProxies(proxies); err != nil {
+			log.WithName("api").Errorf("error setting trusted proxies, trust none: %v", err)
+
+			_ = eng.SetTrustedProxies(nil)
+		}
+	})
+}
+
 // WithDefaultHandler is a RouterOption to configure the default handler for gin.
 func WithDefaultHandler(handler IHandler) RouterOption {
 	return ginEngineOption(func(eng *gin.Engine) {
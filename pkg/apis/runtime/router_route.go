@@ -1,12 +1,15 @@
 package runtime
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"io"
 	"net/http"
 	"path"
 	"reflect"
 	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
@@ -16,6 +19,7 @@ import (
 	"k8s.io/apimachinery/pkg/util/sets"
 
 	"github.com/seal-io/walrus/utils/errorx"
+	"github.com/seal-io/walrus/utils/json"
 	"github.com/seal-io/walrus/utils/log"
 	"github.com/seal-io/walrus/utils/strs"
 
@@ -145,6 +149,10 @@ func (rt *Router) Routes(handler IHandler) IRouter {
 			}
 
 			// Handle normal request.
+			if c.Request.Method == http.MethodHead {
+				c.Writer = headResponseWriter{ResponseWriter: c.Writer}
+			}
+
 			if route.RequestType.Kind() != reflect.Pointer {
 				routeInput = routeInput.Elem()
 			}
@@ -213,19 +221,22 @@ func (rt *Router) Routes(handler IHandler) IRouter {
 						outputObj = NoPageResponse(outputObj)
 					}
 
-					writeJSONContentType(c)
-					c.JSON(outputStatus, outputObj)
+					writeJSON(c, outputStatus, outputObj)
 				}
 			case 3:
 				outputObj := getPageResponse(c, routeOutputs[0].Interface(), int(routeOutputs[1].Int()))
 
-				writeJSONContentType(c)
-				c.JSON(outputStatus, outputObj)
+				writeJSON(c, outputStatus, outputObj)
 			}
 		}
 
 		// Register virtual handler.
 		rt.router.Handle(route.Method, route.Path, vh)
+
+		// Respond the HEAD request with the headers of the GET request.
+		if route.Method == http.MethodGet {
+			rt.router.Handle(http.MethodHead, route.Path, vh)
+		}
 	}
 
 	return rt
@@ -934,3 +945,41 @@ func isImplementOf(o, t reflect.Type) bool {
 func writeJSONContentType(c *gin.Context) {
 	c.Header("Content-Type", "application/json")
 }
+
+// writeJSON writes the given object as JSON with the Content-Length and ETag headers,
+// the ETag is the sha256 checksum of the JSON.
+func writeJSON(c *gin.Context, status int, obj any) {
+	bs, err := json.Marshal(obj)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	sum := sha256.Sum256(bs)
+
+	writeJSONContentType(c)
+	c.Header("Content-Length", strconv.Itoa(len(bs)))
+	c.Header("ETag", `"`+hex.EncodeToString(sum[:])+`"`)
+	c.Data(status, "application/json", bs)
+}
+
+// headResponseWriter discards the body of the HEAD request,
+// it skips reading the source if copying via io.Copy.
+type headResponseWriter struct {
+	gin.ResponseWriter
+}
+
+func (w headResponseWriter) Write(p []byte) (int, error) {
+	w.WriteHeaderNow()
+	return len(p), nil
+}
+
+func (w headResponseWriter) WriteString(s string) (int, error) {
+	w.WriteHeaderNow()
+	return len(s), nil
+}
+
+func (w headResponseWriter) ReadFrom(io.Reader) (int64, error) {
+	w.WriteHeaderNow()
+	return 0, nil
+}
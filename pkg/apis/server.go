@@ -11,10 +11,6 @@ import (
 	"strings"
 	"time"
 
-	"golang.org/x/crypto/acme"
-	"golang.org/x/crypto/acme/autocert"
-
-	"github.com/seal-io/walrus/utils/dynacert"
 	"github.com/seal-io/walrus/utils/gopool"
 	"github.com/seal-io/walrus/utils/log"
 
@@ -36,31 +32,22 @@ type Server struct {
 type ServeOptions struct {
 	SetupOptions
 
-	BindAddress        string
-	BindWithDualStack  bool
-	TlsMode            TlsMode
-	TlsCertFile        string
-	TlsPrivateKeyFile  string
-	TlsCertDir         string
-	TlsAutoCertDomains []string
+	BindAddress       string
+	BindWithDualStack bool
+	// Tls is the TLS to serve in HTTPs, serves in HTTP only if nil, see NewTls.
+	Tls *Tls
+	// MetricsBindAddress is the address to serve the metrics and pprof separately,
+	// i.e. 127.0.0.1:9100, served along with the other services if blank.
+	MetricsBindAddress string
 }
 
-type TlsMode uint64
-
-const (
-	TlsModeDisabled TlsMode = iota
-	TlsModeSelfGenerated
-	TlsModeAutoGenerated
-	TlsModeCustomized
-)
-
-type TlsCertDirMode = string
-
 func (s *Server) Serve(c context.Context, opts ServeOptions) error {
 	s.logger.Info("starting")
 
 	config.TlsCertified.Set(opts.TlsCertified)
 
+	opts.SeparateMetrics = opts.MetricsBindAddress != ""
+
 	handler, err := s.Setup(c, opts.SetupOptions)
 	if err != nil {
 		return fmt.Errorf("error setting up apis server: %w", err)
@@ -69,9 +56,32 @@ func (s *Server) Serve(c context.Context, opts ServeOptions) error {
 
 	g := gopool.GroupWithContextIn(c)
 
+	// Serve metrics.
+	if opts.SeparateMetrics {
+		metricsHandler, err := s.SetupMetrics(c, opts.SetupOptions)
+		if err != nil {
+			return fmt.Errorf("error setting up metrics server: %w", err)
+		}
+
+		g.Go(func(ctx context.Context) error {
+			lg := newStdErrorLogger(s.logger.WithName("metrics"))
+
+			ls, err := newTcpListener(ctx, "tcp", opts.MetricsBindAddress)
+			if err != nil {
+				return err
+			}
+
+			defer func() { _ = ls.Close() }()
+
+			s.logger.Infof("serving metrics on %q", opts.MetricsBindAddress)
+
+			return serve(ctx, metricsHandler, lg, ls)
+		})
+	}
+
 	// Serve https.
 	g.Go(func(ctx context.Context) error {
-		if opts.TlsMode == TlsModeDisabled {
+		if opts.Tls == nil {
 			s.logger.Info("serving in HTTP")
 
 			httpHandler <- handler
@@ -94,61 +104,8 @@ func (s *Server) Serve(c context.Context, opts ServeOptions) error {
 
 		defer func() { _ = ls.Close() }()
 
-		tlsConfig := &tls.Config{
-			NextProtos: []string{"h2", "http/1.1"},
-			MinVersion: tls.VersionTLS12,
-		}
-
-		switch opts.TlsMode {
-		default: // TlsModeSelfGenerated.
-			cache := dynacert.DirCache(opts.TlsCertDir)
-
-			s.logger.InfoS("serving in HTTPs with self-generated keypair",
-				"cache", opts.TlsCertDir)
-
-			mgr := &dynacert.Manager{
-				Cache: cache,
-			}
-			tlsConfig.GetCertificate = mgr.GetCertificate
-			ls = tls.NewListener(ls, tlsConfig)
-			httpHandler <- http.HandlerFunc(redirectHandler)
-		case TlsModeAutoGenerated:
-			cache := autocert.DirCache(opts.TlsCertDir)
-
-			s.logger.InfoS("serving in HTTPs with auto-generated keypair",
-				"domains", opts.TlsAutoCertDomains,
-				"cache", opts.TlsCertDir)
-
-			mgr := &autocert.Manager{
-				Prompt:     autocert.AcceptTOS,
-				Cache:      cache,
-				HostPolicy: autocert.HostWhitelist(opts.TlsAutoCertDomains...),
-			}
-
-			tlsConfig.NextProtos = append(tlsConfig.NextProtos, acme.ALPNProto)
-			tlsConfig.GetCertificate = func(i *tls.ClientHelloInfo) (*tls.Certificate, error) {
-				if i.ServerName == "localhost" || i.ServerName == "" {
-					ni := *i
-					ni.ServerName = opts.TlsAutoCertDomains[0]
-
-					return mgr.GetCertificate(&ni)
-				}
-
-				return mgr.GetCertificate(i)
-			}
-			ls = tls.NewListener(ls, tlsConfig)
-			httpHandler <- mgr.HTTPHandler(http.HandlerFunc(redirectHandler))
-		case TlsModeCustomized:
-			s.logger.Info("serving in HTTPs with custom keypair")
-
-			cert, err := tls.LoadX509KeyPair(opts.TlsCertFile, opts.TlsPrivateKeyFile)
-			if err != nil {
-				return err
-			}
-			tlsConfig.Certificates = []tls.Certificate{cert}
-			ls = tls.NewListener(ls, tlsConfig)
-			httpHandler <- http.HandlerFunc(redirectHandler)
-		}
+		ls = tls.NewListener(ls, opts.Tls.Config)
+		httpHandler <- opts.Tls.HttpHandler
 
 		s.logger.Infof("serving https on %q by %q", addr, nw)
 
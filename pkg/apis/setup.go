@@ -3,13 +3,22 @@ package apis
 import (
 	"context"
 	"net/http"
+	"strings"
 	"time"
 
+	"github.com/gin-gonic/gin"
+
+	"github.com/seal-io/hermitcrab/pkg/apis/admin"
+	artifactapis "github.com/seal-io/hermitcrab/pkg/apis/artifact"
 	"github.com/seal-io/hermitcrab/pkg/apis/debug"
+	docsapis "github.com/seal-io/hermitcrab/pkg/apis/docs"
 	"github.com/seal-io/hermitcrab/pkg/apis/measure"
 	providerapis "github.com/seal-io/hermitcrab/pkg/apis/provider"
+	registryapis "github.com/seal-io/hermitcrab/pkg/apis/registry"
+	releaseapis "github.com/seal-io/hermitcrab/pkg/apis/release"
 	"github.com/seal-io/hermitcrab/pkg/apis/runtime"
 	"github.com/seal-io/hermitcrab/pkg/provider"
+	"github.com/seal-io/hermitcrab/pkg/release"
 )
 
 type SetupOptions struct {
@@ -17,9 +26,27 @@ type SetupOptions struct {
 	ConnQPS               int
 	ConnBurst             int
 	WebsocketConnMaxPerIP int
+	StructuredLogging     bool
+	SlowRequestThreshold  time.Duration
+	CORSAllowOrigins      []string
+	CORSAllowMethods      []string
+	CORSAllowHeaders      []string
+	TrustedProxies        []string
+	// MetricsBasicAuth is the credentials in form of <USERNAME>:<PASSWORD> to access the metrics,
+	// the metrics are not authenticated if blank.
+	MetricsBasicAuth string
 	// Derived from configuration.
 	ProviderService *provider.Service
+	ReleaseService  release.Service
 	TlsCertified    bool
+	AdminToken      string
+	SyncCooldown    time.Duration
+	// AdminV1Sunset is the time the deprecated admin services of the API version 1 stop serving,
+	// which is announced by the Sunset header if not zero.
+	AdminV1Sunset time.Time
+	// SeparateMetrics serves the metrics and pprof by the separate listener,
+	// see SetupMetrics.
+	SeparateMetrics bool
 }
 
 func (s *Server) Setup(ctx context.Context, opts SetupOptions) (http.Handler, error) {
@@ -43,17 +70,80 @@ func (s *Server) Setup(ctx context.Context, opts SetupOptions) (http.Handler, er
 			"/livez",
 			"/metrics",
 			"/debug/version"),
+		runtime.StructuredLogging(opts.StructuredLogging),
+		runtime.WithRouteNamer(routeName),
+		runtime.WithSlowRequestThreshold(opts.SlowRequestThreshold),
+		runtime.WithTrustedProxies(opts.TrustedProxies),
 		runtime.ExposeOpenAPI(),
 	}
 
 	apis := runtime.NewRouter(apisOpts...)
 
+	// Allow the browser-based tooling to access the metadata and admin services,
+	// the CORS is installed at the root to respond the preflight requests.
+	apis.Use(runtime.If(isCORSRoute, runtime.CORS(runtime.CORSOptions{
+		AllowOrigins:  opts.CORSAllowOrigins,
+		AllowMethods:  append([]string{http.MethodOptions}, opts.CORSAllowMethods...),
+		AllowHeaders:  opts.CORSAllowHeaders,
+		ExposeHeaders: []string{"Content-Disposition", "ETag", "Digest", "X-Checksum-Sha256", "X-Checksum-H1"},
+		MaxAge:        10 * time.Minute,
+	})))
+
 	rootApis := apis.Group("/v1").
 		Use(throttler, wsCounter)
 	{
 		r := rootApis
 		r.Group("/providers").
+			// The manual synchronization is authorized as the admin services,
+			// and cooled down per client to not flood the upstreams.
+			Use(runtime.If(isSyncRoute, runtime.OnlyToken(opts.AdminToken)),
+				runtime.If(isSyncRoute, runtime.PerIP(func() runtime.Handle {
+					return runtime.RequestCooldown(opts.SyncCooldown)
+				}))).
 			Routes(providerapis.Handle(opts.ProviderService))
+		r.Group("/artifacts").
+			Routes(artifactapis.Handle(opts.ProviderService))
+		r.Group("/registry/providers").
+			Routes(registryapis.Handle(opts.ProviderService))
+		// The admin services are deprecated in favor of the API version 2,
+		// which keep serving as usual until the sunset.
+		r.Group("/admin").
+			Use(runtime.OnlyToken(opts.AdminToken),
+				runtime.Deprecated(runtime.DeprecationOptions{
+					Sunset:    opts.AdminV1Sunset,
+					Successor: adminV2PathOf,
+				})).
+			Routes(admin.Handle(opts.ProviderService)).
+			Put("/publish/providers/:hostname/:namespace/:type/archives/:filename",
+				admin.PublishArchive(opts.ProviderService))
+	}
+
+	rootV2Apis := apis.Group("/v2").
+		Use(throttler)
+	{
+		r := rootV2Apis
+		r.Routes(docsapis.Handle(opts.ProviderService))
+		// The new behaviors of the admin services land here, i.e. the error codes,
+		// the network mirror and the registry protocols stay in the API version 1,
+		// as their URLs are defined by Terraform.
+		r.Group("/admin").
+			Use(runtime.APIVersion(2), wsCounter, runtime.OnlyToken(opts.AdminToken)).
+			Routes(admin.Handle(opts.ProviderService)).
+			Put("/publish/providers/:hostname/:namespace/:type/archives/:filename",
+				admin.PublishArchive(opts.ProviderService))
+	}
+
+	releaseApis := apis.Group("/releases").
+		Use(throttler)
+	{
+		r := releaseApis
+		r.Routes(releaseapis.Handle(opts.ReleaseService))
+	}
+
+	discoveryApis := apis.Group("/.well-known")
+	{
+		r := discoveryApis
+		r.Get("/terraform.json", registryapis.Discovery("/v1/registry/providers/"))
 	}
 
 	measureApis := apis.Group("").
@@ -62,7 +152,12 @@ func (s *Server) Setup(ctx context.Context, opts SetupOptions) (http.Handler, er
 		r := measureApis
 		r.Get("/readyz", measure.Readyz())
 		r.Get("/livez", measure.Livez())
-		r.Get("/metrics", measure.Metrics())
+
+		if !opts.SeparateMetrics {
+			r.Group("").
+				Use(basicAuthOf(opts.MetricsBasicAuth)).
+				Get("/metrics", measure.Metrics())
+		}
 	}
 
 	debugApis := apis.Group("/debug").
@@ -73,9 +168,111 @@ func (s *Server) Setup(ctx context.Context, opts SetupOptions) (http.Handler, er
 		r.Get("/flags", debug.GetFlags())
 		r.Group("").
 			Use(runtime.OnlyLocalIP()).
-			Get("/pprof/*any", debug.PProf()).
 			Put("/flags", debug.SetFlags())
+
+		if !opts.SeparateMetrics {
+			r.Group("").
+				Use(runtime.OnlyLocalIP()).
+				Get("/pprof/*any", debug.PProf())
+		}
+	}
+
+	return apis, nil
+}
+
+// SetupMetrics sets up the metrics and pprof services served by the separate internal listener,
+// which are authenticated by the basic auth if configured,
+// otherwise, the pprof is only allowed from localhost.
+func (s *Server) SetupMetrics(_ context.Context, opts SetupOptions) (http.Handler, error) {
+	apis := runtime.NewRouter(
+		runtime.WithDefaultWriter(s.logger),
+		runtime.SkipLoggingPaths("/metrics"),
+		runtime.StructuredLogging(opts.StructuredLogging),
+	)
+
+	auth := basicAuthOf(opts.MetricsBasicAuth)
+
+	apis.Group("").
+		Use(auth).
+		Get("/metrics", measure.Metrics())
+
+	if opts.MetricsBasicAuth == "" {
+		auth = runtime.OnlyLocalIP()
 	}
 
+	apis.Group("/debug").
+		Use(auth).
+		Get("/pprof/*any", debug.PProf())
+
 	return apis, nil
 }
+
+// basicAuthOf returns the basic auth middleware of the given credentials in form of <USERNAME>:<PASSWORD>.
+func basicAuthOf(credentials string) runtime.Handle {
+	username, password, _ := strings.Cut(credentials, ":")
+	return runtime.OnlyBasicAuth(username, password)
+}
+
+// adminV2PathOf returns the path of the admin services of the API version 2,
+// which succeeds the given path of the API version 1.
+func adminV2PathOf(p string) string {
+	return "/v2/admin/" + strings.TrimPrefix(p, "/v1/admin/")
+}
+
+// isSyncRoute returns true if the request is to trigger the synchronization.
+func isSyncRoute(c *gin.Context) bool {
+	return c.Request.URL.Path == "/v1/providers/sync"
+}
+
+// isCORSRoute returns true if the request is to the metadata, documentation or admin services.
+func isCORSRoute(c *gin.Context) bool {
+	p := c.Request.URL.Path
+
+	return strings.HasPrefix(p, "/v1/providers/") ||
+		strings.HasPrefix(p, "/v1/registry/providers/") ||
+		strings.HasPrefix(p, "/v1/admin/") ||
+		strings.HasPrefix(p, "/v2/")
+}
+
+// routeName names the route by the purpose for monitoring,
+// so that the metadata latency can be separated from the download throughput.
+func routeName(c *gin.Context) string {
+	p := c.FullPath()
+
+	switch {
+	case p == "/v1/providers/:hostname/:namespace/:type/:action":
+		if c.Param("action") == "index.json" {
+			return "metadata_index"
+		}
+
+		return "metadata_version"
+	case p == "/v1/providers/:hostname/:namespace/:type/download/:archive":
+		return "archive_download"
+	case p == "/v1/providers/:hostname/:namespace/:type/peer/:archive":
+		return "archive_peer"
+	case p == "/v1/providers/sync":
+		return "sync"
+	case strings.HasPrefix(p, "/v1/artifacts/"):
+		return "artifact"
+	case strings.HasPrefix(p, "/v1/registry/providers/"):
+		if strings.HasSuffix(p, "/versions") {
+			return "registry_versions"
+		}
+
+		return "registry_download"
+	case strings.HasPrefix(p, "/releases/"):
+		return "release"
+	case strings.HasPrefix(p, "/v2/admin/"):
+		return "admin"
+	case strings.HasPrefix(p, "/v2/"):
+		return "docs"
+	case p == "/.well-known/terraform.json":
+		return "discovery"
+	case strings.HasPrefix(p, "/v1/admin/"):
+		return "admin"
+	case strings.HasPrefix(p, "/debug/"):
+		return "debug"
+	}
+
+	return ""
+}
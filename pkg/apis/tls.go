@@ -0,0 +1,106 @@
+package apis
+
+import (
+	"crypto/tls"
+	"net/http"
+
+	"github.com/seal-io/walrus/utils/dynacert"
+	"github.com/seal-io/walrus/utils/log"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+type TlsMode uint64
+
+const (
+	TlsModeDisabled TlsMode = iota
+	TlsModeSelfGenerated
+	TlsModeAutoGenerated
+	TlsModeCustomized
+)
+
+type TlsCertDirMode = string
+
+// TlsOptions holds the options of serving in HTTPs.
+type TlsOptions struct {
+	TlsMode            TlsMode
+	TlsCertFile        string
+	TlsPrivateKeyFile  string
+	TlsCertDir         string
+	TlsAutoCertDomains []string
+}
+
+// Tls holds the TLS config to serve in HTTPs,
+// which is shared by the listeners of the same keypair, i.e. the admin gRPC service.
+type Tls struct {
+	// Config is the TLS config of the listeners.
+	Config *tls.Config
+	// HttpHandler is the handler to serve in HTTP along with the HTTPs,
+	// i.e. redirecting to HTTPs.
+	HttpHandler http.Handler
+}
+
+// NewTls returns the TLS of the given options, or nil if the TLS is disabled.
+func NewTls(opts TlsOptions) (*Tls, error) {
+	if opts.TlsMode == TlsModeDisabled {
+		return nil, nil
+	}
+
+	logger := log.WithName("api")
+
+	tlsConfig := &tls.Config{
+		NextProtos: []string{"h2", "http/1.1"},
+		MinVersion: tls.VersionTLS12,
+	}
+
+	switch opts.TlsMode {
+	default: // TlsModeSelfGenerated.
+		cache := dynacert.DirCache(opts.TlsCertDir)
+
+		logger.InfoS("serving in HTTPs with self-generated keypair",
+			"cache", opts.TlsCertDir)
+
+		mgr := &dynacert.Manager{
+			Cache: cache,
+		}
+		tlsConfig.GetCertificate = mgr.GetCertificate
+
+		return &Tls{Config: tlsConfig, HttpHandler: http.HandlerFunc(redirectHandler)}, nil
+	case TlsModeAutoGenerated:
+		cache := autocert.DirCache(opts.TlsCertDir)
+
+		logger.InfoS("serving in HTTPs with auto-generated keypair",
+			"domains", opts.TlsAutoCertDomains,
+			"cache", opts.TlsCertDir)
+
+		mgr := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			Cache:      cache,
+			HostPolicy: autocert.HostWhitelist(opts.TlsAutoCertDomains...),
+		}
+
+		tlsConfig.NextProtos = append(tlsConfig.NextProtos, acme.ALPNProto)
+		tlsConfig.GetCertificate = func(i *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			if i.ServerName == "localhost" || i.ServerName == "" {
+				ni := *i
+				ni.ServerName = opts.TlsAutoCertDomains[0]
+
+				return mgr.GetCertificate(&ni)
+			}
+
+			return mgr.GetCertificate(i)
+		}
+
+		return &Tls{Config: tlsConfig, HttpHandler: mgr.HTTPHandler(http.HandlerFunc(redirectHandler))}, nil
+	case TlsModeCustomized:
+		logger.Info("serving in HTTPs with custom keypair")
+
+		cert, err := tls.LoadX509KeyPair(opts.TlsCertFile, opts.TlsPrivateKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+
+		return &Tls{Config: tlsConfig, HttpHandler: http.HandlerFunc(redirectHandler)}, nil
+	}
+}
@@ -0,0 +1,141 @@
+package chaos
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/seal-io/walrus/utils/log"
+	"github.com/seal-io/walrus/utils/vars"
+)
+
+// ErrInjected is returned by the upstream calls failed by the fault injection.
+var ErrInjected = errors.New("injected fault")
+
+// Faults holds the faults to inject into the upstream calls,
+// which is for testing only.
+type Faults struct {
+	// Delay is the duration to delay the upstream call.
+	Delay time.Duration
+	// DelayRate is the probability in [0, 1] of delaying the upstream call.
+	DelayRate float64
+	// FailureRate is the probability in [0, 1] of failing the upstream call.
+	FailureRate float64
+	// TruncateRate is the probability in [0, 1] of truncating the upstream response.
+	TruncateRate float64
+}
+
+// ParseFaults parses the given string into a Faults,
+// the string is in form of <KEY>=<VALUE>[,<KEY>=<VALUE>...],
+// i.e. delay=2s,delay-rate=0.5,failure-rate=0.1,truncate-rate=0.1.
+func ParseFaults(s string) (Faults, error) {
+	var f Faults
+
+	if s == "" {
+		return f, nil
+	}
+
+	for _, opt := range strings.Split(s, ",") {
+		k, v, ok := strings.Cut(opt, "=")
+		if !ok || k == "" || v == "" {
+			return Faults{}, fmt.Errorf("invalid faults: illegal option %q", opt)
+		}
+
+		var err error
+
+		switch strings.ToLower(k) {
+		case "delay":
+			f.Delay, err = time.ParseDuration(v)
+			if f.DelayRate == 0 {
+				f.DelayRate = 1
+			}
+		case "delay-rate":
+			f.DelayRate, err = parseRate(v)
+		case "failure-rate":
+			f.FailureRate, err = parseRate(v)
+		case "truncate-rate":
+			f.TruncateRate, err = parseRate(v)
+		default:
+			return Faults{}, fmt.Errorf("invalid faults: unknown option %q", k)
+		}
+
+		if err != nil {
+			return Faults{}, fmt.Errorf("invalid faults: illegal %s: %w", k, err)
+		}
+	}
+
+	return f, nil
+}
+
+func parseRate(s string) (float64, error) {
+	r, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, err
+	}
+
+	if r < 0 || r > 1 {
+		return 0, errors.New("must be in [0, 1]")
+	}
+
+	return r, nil
+}
+
+var config = vars.NewSetMany(Faults{})
+
+// Configure configures the faults to inject,
+// it can be called multiple times to alter the faults in testing.
+func Configure(f Faults) {
+	if f.Enabled() {
+		log.WithName("chaos").
+			Warnf("fault injection is enabled: %s", f)
+	}
+
+	config.Set(f)
+}
+
+// Enabled returns true if any fault is configured.
+func (f Faults) Enabled() bool {
+	return (f.Delay > 0 && f.DelayRate > 0) || f.FailureRate > 0 || f.TruncateRate > 0
+}
+
+func (f Faults) String() string {
+	return fmt.Sprintf("delay=%s,delay-rate=%g,failure-rate=%g,truncate-rate=%g",
+		f.Delay, f.DelayRate, f.FailureRate, f.TruncateRate)
+}
+
+// fault is the decision of the fault injection for an upstream call.
+type fault struct {
+	Delay    time.Duration
+	Fail     bool
+	Truncate bool
+}
+
+// roll decides the fault to inject into an upstream call.
+func roll() (ft fault) {
+	f := config.Get()
+	if !f.Enabled() {
+		return ft
+	}
+
+	// nolint:gosec
+	if f.Delay > 0 && rand.Float64() < f.DelayRate {
+		ft.Delay = f.Delay
+	}
+
+	// nolint:gosec
+	switch r := rand.Float64(); {
+	case r < f.FailureRate:
+		ft.Fail = true
+	case r < f.FailureRate+f.TruncateRate:
+		ft.Truncate = true
+	}
+
+	return ft
+}
+
+func (ft fault) injected() bool {
+	return ft.Delay > 0 || ft.Fail || ft.Truncate
+}
@@ -0,0 +1,120 @@
+package chaos
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFaults(t *testing.T) {
+	testCases := []struct {
+		given    string
+		expected Faults
+		wantErr  bool
+	}{
+		{
+			given: "",
+		},
+		{
+			given:    "delay=2s",
+			expected: Faults{Delay: 2 * time.Second, DelayRate: 1},
+		},
+		{
+			given:    "delay=1s,delay-rate=0.5,failure-rate=0.1,truncate-rate=0.2",
+			expected: Faults{Delay: time.Second, DelayRate: 0.5, FailureRate: 0.1, TruncateRate: 0.2},
+		},
+		{
+			given:   "failure-rate=2",
+			wantErr: true,
+		},
+		{
+			given:   "unknown=1",
+			wantErr: true,
+		},
+		{
+			given:   "delay",
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.given, func(t *testing.T) {
+			actual, err := ParseFaults(tc.given)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
+
+func TestTransport(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, strings.Repeat("x", 1024))
+	}))
+	t.Cleanup(srv.Close)
+	t.Cleanup(func() { Configure(Faults{}) })
+
+	cli := &http.Client{Transport: Transport(http.DefaultTransport)}
+
+	get := func() (int, error) {
+		resp, err := cli.Get(srv.URL)
+		if err != nil {
+			return 0, err
+		}
+		defer func() { _ = resp.Body.Close() }()
+
+		bs, err := io.ReadAll(resp.Body)
+
+		return len(bs), err
+	}
+
+	// Pass through.
+	n, err := get()
+	require.NoError(t, err)
+	assert.Equal(t, 1024, n)
+
+	// Fail.
+	Configure(Faults{FailureRate: 1})
+	_, err = get()
+	assert.ErrorIs(t, err, ErrInjected)
+
+	// Truncate.
+	Configure(Faults{TruncateRate: 1})
+	n, err = get()
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	assert.Equal(t, 512, n)
+
+	// Delay.
+	Configure(Faults{Delay: 50 * time.Millisecond, DelayRate: 1})
+	start := time.Now()
+	n, err = get()
+	require.NoError(t, err)
+	assert.Equal(t, 1024, n)
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+}
+
+func TestDial(t *testing.T) {
+	t.Cleanup(func() { Configure(Faults{}) })
+
+	Configure(Faults{FailureRate: 1})
+
+	c, err := Dial(func(addr string) (net.Conn, error) {
+		c, _ := net.Pipe()
+		return c, nil
+	})("example.com:80")
+	require.NoError(t, err)
+
+	_, err = c.Write([]byte("GET / HTTP/1.1\r\n\r\n"))
+	assert.ErrorIs(t, err, ErrInjected)
+}
@@ -0,0 +1,74 @@
+package chaos
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/seal-io/walrus/utils/log"
+)
+
+// Dial wraps the given dial function to inject the configured faults,
+// the fault is decided at writing each request into the connection,
+// it passes through if no fault is configured.
+func Dial(dial func(addr string) (net.Conn, error)) func(addr string) (net.Conn, error) {
+	return func(addr string) (net.Conn, error) {
+		c, err := dial(addr)
+		if err != nil || !config.Get().Enabled() {
+			return c, err
+		}
+
+		return &conn{Conn: c, addr: addr}, nil
+	}
+}
+
+type conn struct {
+	net.Conn
+
+	addr string
+
+	m        sync.Mutex
+	truncate bool
+}
+
+func (c *conn) Write(p []byte) (int, error) {
+	ft := roll()
+	if ft.injected() {
+		log.WithName("chaos").
+			Debugf("injecting fault %+v to %s", ft, c.addr)
+	}
+
+	_ = sleep(context.Background(), ft.Delay)
+
+	if ft.Fail {
+		_ = c.Conn.Close()
+		return 0, ErrInjected
+	}
+
+	c.m.Lock()
+	c.truncate = ft.Truncate
+	c.m.Unlock()
+
+	return c.Conn.Write(p)
+}
+
+func (c *conn) Read(p []byte) (int, error) {
+	c.m.Lock()
+	truncate := c.truncate
+	c.m.Unlock()
+
+	if !truncate {
+		return c.Conn.Read(p)
+	}
+
+	// Return the half of the response and then break the connection.
+	n, err := c.Conn.Read(p[:len(p)/2+1])
+	if err != nil {
+		return n, err
+	}
+
+	_ = c.Conn.Close()
+
+	return n / 2, io.ErrUnexpectedEOF
+}
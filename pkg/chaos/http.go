@@ -0,0 +1,94 @@
+package chaos
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/seal-io/walrus/utils/log"
+)
+
+// Transport wraps the given http.RoundTripper to inject the configured faults,
+// it passes through if no fault is configured.
+func Transport(base http.RoundTripper) http.RoundTripper {
+	return &transport{base: base}
+}
+
+type transport struct {
+	base http.RoundTripper
+}
+
+func (t *transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	ft := roll()
+	if !ft.injected() {
+		return t.base.RoundTrip(r)
+	}
+
+	log.WithName("chaos").
+		Debugf("injecting fault %+v to %s %s", ft, r.Method, r.URL.Redacted())
+
+	if err := sleep(r.Context(), ft.Delay); err != nil {
+		return nil, err
+	}
+
+	if ft.Fail {
+		return nil, ErrInjected
+	}
+
+	resp, err := t.base.RoundTrip(r)
+	if err != nil || !ft.Truncate {
+		return resp, err
+	}
+
+	// Truncate the body at the half.
+	limit := resp.ContentLength / 2
+	if limit < 0 {
+		limit = 0
+	}
+
+	resp.Body = &truncatedBody{
+		ReadCloser: resp.Body,
+		remaining:  limit,
+	}
+
+	return resp, nil
+}
+
+// truncatedBody returns io.ErrUnexpectedEOF after reading the remaining bytes.
+type truncatedBody struct {
+	io.ReadCloser
+
+	remaining int64
+}
+
+func (b *truncatedBody) Read(p []byte) (int, error) {
+	if b.remaining <= 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+
+	if int64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+
+	return n, err
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
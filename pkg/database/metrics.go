@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"path"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	bolt "go.etcd.io/bbolt"
@@ -15,33 +17,58 @@ const (
 	bkSubsystem = "bk"
 )
 
-func NewStatsCollectorWith(db BoltDriver) prometheus.Collector {
+const (
+	// DefaultBucketStatsInterval is the default interval of refreshing the bucket stats,
+	// the cached stats are collected in the meantime.
+	DefaultBucketStatsInterval = time.Minute
+	// DefaultBucketStatsDepth is the default depth of collecting the bucket stats,
+	// which covers the domain buckets and their direct nested buckets, i.e. the typed providers.
+	DefaultBucketStatsDepth = 2
+)
+
+// BucketStatsOptions holds the options of collecting the bucket stats.
+type BucketStatsOptions struct {
+	// Interval is the interval of walking the buckets,
+	// walks on every collecting if not positive.
+	Interval time.Duration
+	// Depth is the maximum depth of the buckets to collect,
+	// the stats of the deeper buckets are aggregated into their ancestor at the depth,
+	// unlimited if not positive.
+	Depth int
+}
+
+func NewStatsCollectorWith(db BoltDriver, opts BucketStatsOptions) prometheus.Collector {
 	return &statsCollector{
 		d: NewDatabaseStatsCollectorWith(db),
-		b: NewBucketStatsCollector(db),
+		b: NewBucketStatsCollectorWith(db, opts),
 	}
 }
 
 type statsCollector struct {
-	sync.Mutex
-
 	d, b prometheus.Collector
 }
 
 func (c *statsCollector) Describe(ch chan<- *prometheus.Desc) {
-	c.Lock()
-	defer c.Unlock()
-
 	c.d.Describe(ch)
 	c.b.Describe(ch)
 }
 
+// Collect collects the database stats and the bucket stats independently,
+// so that the database stats are never delayed by walking the buckets.
 func (c *statsCollector) Collect(ch chan<- prometheus.Metric) {
-	c.Lock()
-	defer c.Unlock()
+	var wg sync.WaitGroup
+
+	for _, cc := range []prometheus.Collector{c.d, c.b} {
+		wg.Add(1)
 
-	c.d.Collect(ch)
-	c.b.Collect(ch)
+		go func(cc prometheus.Collector) {
+			defer wg.Done()
+
+			cc.Collect(ch)
+		}(cc)
+	}
+
+	wg.Wait()
 }
 
 func NewDatabaseStatsCollectorWith(db BoltDriver) prometheus.Collector {
@@ -212,10 +239,21 @@ func (c *databaseStatsCollector) Collect(ch chan<- prometheus.Metric) {
 }
 
 func NewBucketStatsCollector(db BoltDriver) prometheus.Collector {
+	return NewBucketStatsCollectorWith(db, BucketStatsOptions{
+		Interval: DefaultBucketStatsInterval,
+		Depth:    DefaultBucketStatsDepth,
+	})
+}
+
+// NewBucketStatsCollectorWith returns the collector of the bucket stats,
+// which walks the nested buckets at most once per the given interval.
+func NewBucketStatsCollectorWith(db BoltDriver, opts BucketStatsOptions) prometheus.Collector {
 	labels := []string{"bucket"}
 
 	return &bucketStatsCollector{
-		db: db,
+		db:       db,
+		interval: opts.Interval,
+		maxDepth: opts.Depth,
 		depth: prometheus.NewDesc(
 			prometheus.BuildFQName(namespace, bkSubsystem, "depth"),
 			"The depth of the bucket.",
@@ -285,7 +323,14 @@ func NewBucketStatsCollector(db BoltDriver) prometheus.Collector {
 }
 
 type bucketStatsCollector struct {
-	db BoltDriver
+	db       BoltDriver
+	interval time.Duration
+	maxDepth int
+
+	// refreshing guards the walking,
+	// the concurrent collecting serves the cached stats instead of waiting.
+	refreshing sync.Mutex
+	cached     atomic.Pointer[bucketStats]
 
 	depth                             *prometheus.Desc
 	keys                              *prometheus.Desc
@@ -318,18 +363,74 @@ func (c *bucketStatsCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- c.physicalBranchPagesInUseBytes
 }
 
+// bucketStats holds the collected metrics of the buckets.
+type bucketStats struct {
+	metrics   []prometheus.Metric
+	refreshed time.Time
+}
+
 func (c *bucketStatsCollector) Collect(ch chan<- prometheus.Metric) {
-	err := c.db.View(func(tx *bolt.Tx) error {
-		return tx.ForEach(func(k []byte, b *bolt.Bucket) error {
-			return c.collect(ch, string(bytes.Clone(k)), b)
+	s := c.cached.Load()
+
+	if s == nil || time.Since(s.refreshed) >= c.interval {
+		switch {
+		case c.refreshing.TryLock():
+			s = c.refresh()
+			c.refreshing.Unlock()
+		case s == nil:
+			// Wait for the first walking.
+			c.refreshing.Lock()
+			s = c.cached.Load()
+			c.refreshing.Unlock()
+		}
+	}
+
+	if s == nil {
+		return
+	}
+
+	for _, m := range s.metrics {
+		ch <- m
+	}
+}
+
+// refresh walks all nested buckets and caches the collected metrics.
+func (c *bucketStatsCollector) refresh() *bucketStats {
+	// Refreshed by others while waiting.
+	if s := c.cached.Load(); s != nil && time.Since(s.refreshed) < c.interval {
+		return s
+	}
+
+	s := &bucketStats{}
+	ch := make(chan prometheus.Metric)
+
+	go func() {
+		defer close(ch)
+
+		err := c.db.View(func(tx *bolt.Tx) error {
+			return tx.ForEach(func(k []byte, b *bolt.Bucket) error {
+				return c.collect(ch, string(bytes.Clone(k)), b, 1)
+			})
 		})
-	})
-	if err != nil {
-		ch <- prometheus.NewInvalidMetric(c.buckets, err)
+		if err != nil {
+			ch <- prometheus.NewInvalidMetric(c.buckets, err)
+		}
+	}()
+
+	for m := range ch {
+		s.metrics = append(s.metrics, m)
 	}
+
+	s.refreshed = time.Now()
+	c.cached.Store(s)
+
+	return s
 }
 
-func (c *bucketStatsCollector) collect(ch chan<- prometheus.Metric, n string, b *bolt.Bucket) error {
+// collect collects the stats of the given bucket at the given depth,
+// the stats of a bucket include its nested buckets,
+// so the deeper buckets are not collected beyond the maximum depth.
+func (c *bucketStatsCollector) collect(ch chan<- prometheus.Metric, n string, b *bolt.Bucket, depth int) error {
 	stats := b.Stats()
 
 	ch <- prometheus.MustNewConstMetric(c.depth, prometheus.GaugeValue,
@@ -359,7 +460,11 @@ func (c *bucketStatsCollector) collect(ch chan<- prometheus.Metric, n string, b
 	ch <- prometheus.MustNewConstMetric(c.physicalBranchPagesInUseBytes, prometheus.GaugeValue,
 		float64(stats.BranchInuse), n)
 
+	if c.maxDepth > 0 && depth >= c.maxDepth {
+		return nil
+	}
+
 	return b.ForEachBucket(func(k []byte) error {
-		return c.collect(ch, path.Join(n, string(bytes.Clone(k))), b.Bucket(k))
+		return c.collect(ch, path.Join(n, string(bytes.Clone(k))), b.Bucket(k), depth+1)
 	})
 }
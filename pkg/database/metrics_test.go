@@ -0,0 +1,105 @@
+package database
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestBucketStatsCollector_cached(t *testing.T) {
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "test.db"), 0o600, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+
+	createBucket := func(n string) {
+		require.NoError(t, db.Update(func(tx *bolt.Tx) error {
+			_, err := tx.CreateBucketIfNotExists([]byte(n))
+			return err
+		}))
+	}
+
+	createBucket("a")
+
+	c := NewBucketStatsCollectorWith(db, BucketStatsOptions{Interval: time.Hour})
+
+	count := func() int {
+		return testutil.CollectAndCount(c, "boltdb_bk_keys")
+	}
+
+	assert.Equal(t, 1, count())
+
+	// Serve the cached stats within the interval.
+	createBucket("b")
+	assert.Equal(t, 1, count())
+
+	// Refresh after the interval.
+	c.(*bucketStatsCollector).cached.Load().refreshed = time.Now().Add(-time.Hour)
+	assert.Equal(t, 2, count())
+
+	// The database stats are collected along with the bucket stats.
+	r := prometheus.NewPedanticRegistry()
+	require.NoError(t, r.Register(NewStatsCollectorWith(db, BucketStatsOptions{})))
+
+	mfs, err := r.Gather()
+	require.NoError(t, err)
+
+	var names []string
+	for _, mf := range mfs {
+		names = append(names, mf.GetName())
+	}
+
+	assert.Contains(t, strings.Join(names, ","), "boltdb_tx_reads_total")
+	assert.Contains(t, strings.Join(names, ","), "boltdb_bk_keys")
+}
+
+func TestBucketStatsCollector_depth(t *testing.T) {
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "test.db"), 0o600, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+
+	// Nest the buckets as providers/{typed}/{version}.
+	require.NoError(t, db.Update(func(tx *bolt.Tx) error {
+		pb, err := tx.CreateBucketIfNotExists([]byte("providers"))
+		if err != nil {
+			return err
+		}
+
+		tb, err := pb.CreateBucketIfNotExists([]byte("registry.terraform.io/hashicorp/null"))
+		if err != nil {
+			return err
+		}
+
+		for _, v := range []string{"1.0.0", "2.0.0"} {
+			vb, err := tb.CreateBucketIfNotExists([]byte(v))
+			if err != nil {
+				return err
+			}
+
+			if err = vb.Put([]byte("data"), []byte("{}")); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}))
+
+	for depth, expected := range map[int]int{0: 4, 1: 1, 2: 2} {
+		c := NewBucketStatsCollectorWith(db, BucketStatsOptions{Depth: depth})
+		assert.Equal(t, expected, testutil.CollectAndCount(c, "boltdb_bk_keys"), "depth %d", depth)
+	}
+
+	// The deeper buckets are aggregated into the collected ones.
+	c := NewBucketStatsCollectorWith(db, BucketStatsOptions{Depth: 1})
+	assert.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(`
+# HELP boltdb_bk_buckets The number of buckets in the bucket.
+# TYPE boltdb_bk_buckets gauge
+boltdb_bk_buckets{bucket="providers"} 4
+`), "boltdb_bk_buckets"))
+}
@@ -10,30 +10,42 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/seal-io/walrus/utils/bytespool"
 	"github.com/seal-io/walrus/utils/gopool"
 	"github.com/seal-io/walrus/utils/log"
 	"github.com/seal-io/walrus/utils/runtimex"
 	"github.com/seal-io/walrus/utils/version"
+
+	"github.com/seal-io/hermitcrab/pkg/tunable"
 )
 
 var defaultHttpClient = NewHttpClient(
 	WithUserAgent(version.GetUserAgentWith("hermitcrab")),
 	WithInsecureSkipVerify(),
+	WithFaultInjection(),
 )
 
+// DefaultChunkSize is the default bytes of each range requested by the ranged download.
+const DefaultChunkSize = 2 * 1024 * 1024 // 2mb.
+
 type Client struct {
 	httpCli *http.Client
+	queue   *queue
 }
 
-func NewClient(httpCli *http.Client) *Client {
+// NewClient returns a new download client,
+// which downloads within the given maximum concurrency by priority,
+// unlimited if not positive.
+func NewClient(httpCli *http.Client, maxConcurrent int) *Client {
 	if httpCli == nil {
 		httpCli = defaultHttpClient
 	}
 
 	return &Client{
 		httpCli: httpCli,
+		queue:   newQueue(maxConcurrent),
 	}
 }
 
@@ -41,14 +53,69 @@ type GetOptions struct {
 	DownloadURL string
 	Directory   string
 	Filename    string
-	Shasum      string
+	// ScratchDirectory holds the in-progress download if specified, default is Directory,
+	// the completed download is moved into Directory atomically,
+	// which allows downloading on a fast local volume and keeping the results on a durable(networked) one.
+	ScratchDirectory string
+	Shasum           string
+	Headers          map[string]string
+	// Authorize authorizes each request separately if specified, after setting the Headers,
+	// i.e. signing the method and the time of the request.
+	Authorize func(*http.Request)
+	// Progress reports the received bytes of the download at most once per second if specified.
+	Progress ProgressFunc
+	// Response reports the headers of the remote response if specified,
+	// which are the ones of the HEAD response if downloaded by ranges.
+	Response func(http.Header)
 }
 
+// Get downloads the file with the priority carried by the given context,
+// the background download is requeued if preempted by the interactive download.
 func (c *Client) Get(ctx context.Context, opts GetOptions) error {
 	if opts.DownloadURL == "" || opts.Directory == "" || opts.Filename == "" {
 		return errors.New("invalid options")
 	}
 
+	var restarted bool
+
+	for {
+		dctx, release, err := c.queue.acquire(ctx, opts.Directory, PriorityFrom(ctx))
+		if err != nil {
+			return err
+		}
+
+		err = c.get(dctx, opts)
+		release()
+
+		switch {
+		case err == nil:
+			return nil
+		case errors.Is(context.Cause(dctx), errPreempted):
+			log.WithName("download").WithValues("url", opts.DownloadURL).
+				Debug("requeue preempted download")
+		case errors.Is(err, errValidatorMismatched) && !restarted:
+			// Restart once from scratch, as the upstream file changed during resuming.
+			restarted = true
+
+			log.WithName("download").WithValues("url", opts.DownloadURL).
+				Info("restart download as upstream file changed")
+		default:
+			return err
+		}
+	}
+}
+
+// Promote promotes the background downloads of the given directory to interactive,
+// which is used when the interactive requests wait for them.
+func (c *Client) Promote(directory string) {
+	c.queue.promote(directory)
+}
+
+func (c *Client) get(ctx context.Context, opts GetOptions) error {
+	if opts.Authorize != nil {
+		ctx = context.WithValue(ctx, authorizeContextKey{}, opts.Authorize)
+	}
+
 	output := filepath.Join(opts.Directory, opts.Filename)
 
 	// Validate the output,
@@ -71,7 +138,7 @@ func (c *Client) Get(ctx context.Context, opts GetOptions) error {
 		}
 
 		// Validate the shasum.
-		matched, err := validateShasum(output, opts.Shasum)
+		matched, err := ValidateShasum(output, opts.Shasum)
 		if err != nil {
 			return fmt.Errorf("validate: failed to validate existing output: %w", err)
 		}
@@ -90,8 +157,16 @@ func (c *Client) Get(ctx context.Context, opts GetOptions) error {
 
 	// Validate the temp output,
 	// if existed, must check the shasum.
+	tempDir := opts.ScratchDirectory
+	if tempDir == "" {
+		tempDir = opts.Directory
+	} else if err := os.MkdirAll(tempDir, 0o700); err != nil && !os.IsExist(err) {
+		return fmt.Errorf("validate: failed to create scratch directory: %w", err)
+	}
+
 	var (
-		tempPath       = filepath.Join(opts.Directory, "."+opts.Filename)
+		tempPath       = filepath.Join(tempDir, "."+opts.Filename)
+		validatorPath  = tempPath + ".validator"
 		receivedLength int64
 	)
 	{
@@ -114,6 +189,7 @@ func (c *Client) Get(ctx context.Context, opts GetOptions) error {
 	var (
 		partialDownload bool
 		contentLength   int64
+		validator       string
 	)
 	{
 		req, err := http.NewRequestWithContext(ctx, http.MethodHead, opts.DownloadURL, nil)
@@ -121,12 +197,19 @@ func (c *Client) Get(ctx context.Context, opts GetOptions) error {
 			return fmt.Errorf("download: failed to create HEAD request: %w", err)
 		}
 
-		resp, err := c.httpCli.Do(req)
+		setHeaders(req, opts.Headers)
+
+		resp, err := c.do(req)
 		if err == nil && resp.StatusCode == http.StatusOK {
 			partialDownload = resp.Header.Get("Accept-Ranges") == "bytes" &&
 				resp.ContentLength > 0 &&
 				runtimex.NumCPU() > 1
 			contentLength = resp.ContentLength
+			validator = validatorOf(resp)
+
+			if opts.Response != nil {
+				opts.Response(resp.Header)
+			}
 		}
 
 		// If the remote allowing range download,
@@ -140,6 +223,28 @@ func (c *Client) Get(ctx context.Context, opts GetOptions) error {
 
 			receivedLength = 0
 		}
+
+		// Resume only if the upstream file is the same as the one the temp output was downloaded from,
+		// otherwise, the resumed ranges corrupt the result.
+		if partialDownload && receivedLength > 0 {
+			if prev, _ := os.ReadFile(validatorPath); validator == "" || string(prev) != validator {
+				err = os.RemoveAll(tempPath)
+				if err != nil {
+					return fmt.Errorf("download: failed to remove outdated temp output: %w", err)
+				}
+
+				receivedLength = 0
+			}
+		}
+
+		// Record the validator of the upstream file to resume next time.
+		if partialDownload && receivedLength == 0 {
+			_ = os.Remove(validatorPath)
+
+			if validator != "" {
+				_ = os.WriteFile(validatorPath, []byte(validator), 0o600)
+			}
+		}
 	}
 
 	// Prepare the output directory.
@@ -154,6 +259,13 @@ func (c *Client) Get(ctx context.Context, opts GetOptions) error {
 		return fmt.Errorf("download: failed to create GET request: %w", err)
 	}
 
+	setHeaders(req, opts.Headers)
+
+	// Ask the upstream to respond the whole file if changed since the validator.
+	if partialDownload && validator != "" {
+		req.Header.Set("If-Range", validator)
+	}
+
 	tempFile, err := os.OpenFile(tempPath, os.O_WRONLY|os.O_CREATE, 0o600)
 	if err != nil {
 		return fmt.Errorf("download: failed to open temp file: %w", err)
@@ -162,49 +274,71 @@ func (c *Client) Get(ctx context.Context, opts GetOptions) error {
 	defer func() {
 		_ = tempFile.Close()
 
-		if err == nil || partialDownload {
+		if err == nil || partialDownload && !errors.Is(err, errValidatorMismatched) {
 			return
 		}
 
 		// Remove the temp file if failed to download.
 		_ = os.Remove(tempPath)
+		_ = os.Remove(validatorPath)
 	}()
 
 	if partialDownload {
-		err = c.downloadPartial(req, tempFile, receivedLength, contentLength)
+		err = c.downloadPartial(req, tempFile, receivedLength, contentLength,
+			newProgress(opts.Progress, receivedLength, contentLength))
 	} else {
-		err = c.download(req, tempFile)
+		err = c.download(req, tempFile,
+			newProgress(opts.Progress, 0, contentLength), opts.Response)
 	}
 
 	if err != nil {
 		return fmt.Errorf("download: %w", err)
 	}
 
+	// Flush the temp output before renaming,
+	// so that a crash never leaves a truncated output.
+	err = tempFile.Sync()
+	if err != nil {
+		return fmt.Errorf("download: failed to sync temp output: %w", err)
+	}
+
 	// Validate whether the shasum is matched.
-	matched, err := validateShasum(tempPath, opts.Shasum)
+	matched, err := ValidateShasum(tempPath, opts.Shasum)
 	if err != nil {
 		return fmt.Errorf("validate: failed to validate downloaded temp output: %w", err)
 	}
 
 	if !matched {
+		// Tell the empty content apart from the corrupted one.
+		empty := false
+		if info, err := tempFile.Stat(); err == nil {
+			empty = info.Size() == 0
+		}
+
 		// Remove the corrupted download output.
 		err = os.RemoveAll(tempPath)
 		if err != nil {
 			return fmt.Errorf("validate: failed to remove corrupted download output: %w", err)
 		}
 
+		if empty {
+			return errors.New("validate: upstream responded empty content")
+		}
+
 		return errors.New("validate: shasum mismatched")
 	}
 
-	err = os.Rename(tempPath, output)
+	err = renameFile(tempPath, output)
 	if err != nil {
 		return fmt.Errorf("download: failed to rename output: %w", err)
 	}
 
+	_ = os.Remove(validatorPath)
+
 	return nil
 }
 
-func (c *Client) downloadPartial(req *http.Request, file *os.File, receivedLength, contentLength int64) error {
+func (c *Client) downloadPartial(req *http.Request, file *os.File, receivedLength, contentLength int64, p *progress) error {
 	if receivedLength == contentLength {
 		return nil
 	}
@@ -223,10 +357,12 @@ func (c *Client) downloadPartial(req *http.Request, file *os.File, receivedLengt
 		}
 	}
 
-	const (
-		partialBuffer = 2 * 1024 * 1024 // 2mb.
-		parallel      = 5
-	)
+	const parallel = 5
+
+	partialBuffer := tunable.Get().DownloadChunkSize
+	if partialBuffer <= 0 {
+		partialBuffer = DefaultChunkSize
+	}
 
 	var bytesRanges [][2]int64
 	{
@@ -268,13 +404,24 @@ func (c *Client) downloadPartial(req *http.Request, file *os.File, receivedLengt
 					req := req.Clone(ctx)
 					req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", rangeStart, rangeEnd))
 
-					resp, err := c.httpCli.Do(req)
+					resp, err := c.do(req)
 					if err != nil {
 						return fmt.Errorf("failed to send partital GET request: %w", err)
 					}
 
 					defer func() { _ = resp.Body.Close() }()
 
+					// The range is beyond the upstream file,
+					// which means the temp output is complete, and verified later.
+					if resp.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+						return errRangeNotSatisfiable
+					}
+
+					// The upstream responds the whole file if the If-Range validator mismatched.
+					if resp.StatusCode == http.StatusOK && req.Header.Get("If-Range") != "" {
+						return errValidatorMismatched
+					}
+
 					if resp.StatusCode != http.StatusPartialContent {
 						return fmt.Errorf("unexpected partital GET response status: %s", resp.Status)
 					}
@@ -306,9 +453,16 @@ func (c *Client) downloadPartial(req *http.Request, file *os.File, receivedLengt
 					partialStart, partialEnd, err)
 			}
 
+			p.add(int64(len(buf)))
+
 			return nil
 		}(bytesRanges[i:j])
 		if err != nil {
+			if errors.Is(err, errRangeNotSatisfiable) {
+				logger.Debug("range not satisfiable, verify the received content")
+				return nil
+			}
+
 			return err
 		}
 
@@ -320,20 +474,44 @@ func (c *Client) downloadPartial(req *http.Request, file *os.File, receivedLengt
 	return nil
 }
 
+// errValidatorMismatched is the error of resuming a download whose upstream file changed.
+var errValidatorMismatched = errors.New("upstream file changed since the validator")
+
+// errRangeNotSatisfiable is the error of requesting a range beyond the upstream file.
+var errRangeNotSatisfiable = errors.New("range not satisfiable")
+
+// validatorOf returns the validator of the given response for the If-Range header,
+// the strong ETag takes precedence over the Last-Modified,
+// returns blank if neither.
+func validatorOf(resp *http.Response) string {
+	if et := resp.Header.Get("ETag"); et != "" && !strings.HasPrefix(et, "W/") {
+		return et
+	}
+
+	return resp.Header.Get("Last-Modified")
+}
+
 const copyBuffer = 1024 * 1024 // 1mb.
 
-func (c *Client) download(req *http.Request, file *os.File) error {
+func (c *Client) download(req *http.Request, file *os.File, p *progress, response func(http.Header)) error {
 	logger := log.WithName("download").WithValues("url", req.URL)
 
+	// Truncate the temp file left by the previous download,
+	// so that a shorter or empty response is not mixed up with it.
+	err := file.Truncate(0)
+	if err != nil {
+		return fmt.Errorf("failed to truncate file: %w", err)
+	}
+
 	// Seek to the beginning of the temp file.
-	_, err := file.Seek(0, 0)
+	_, err = file.Seek(0, 0)
 	if err != nil {
 		return fmt.Errorf("failed to seek file beginning: %w", err)
 	}
 
 	logger.Debug("downloading")
 
-	resp, err := c.httpCli.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return fmt.Errorf("failed to send GET request: %w", err)
 	}
@@ -345,11 +523,19 @@ func (c *Client) download(req *http.Request, file *os.File) error {
 		return fmt.Errorf("unexpected GET response status: %s", resp.Status)
 	}
 
+	if response != nil {
+		response(resp.Header)
+	}
+
+	if p != nil && resp.ContentLength > 0 {
+		p.total = resp.ContentLength
+	}
+
 	buf := bytespool.GetBytes(copyBuffer)
 	defer bytespool.Put(buf)
 
 	// Write the response body to the temp file.
-	_, err = io.CopyBuffer(file, resp.Body, buf)
+	_, err = io.CopyBuffer(io.MultiWriter(file, p), resp.Body, buf)
 	if err != nil {
 		return fmt.Errorf("failed to output response body: %w", err)
 	}
@@ -359,16 +545,46 @@ func (c *Client) download(req *http.Request, file *os.File) error {
 	return nil
 }
 
-func validateShasum(path, shasum string) (bool, error) {
+type authorizeContextKey struct{}
+
+// do sends the given request, which is authorized by the GetOptions.Authorize carried by its context,
+// so that the HEAD probe and each ranged GET are authorized separately.
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	if fn, ok := req.Context().Value(authorizeContextKey{}).(func(*http.Request)); ok {
+		fn(req)
+	}
+
+	return c.httpCli.Do(req)
+}
+
+func setHeaders(req *http.Request, headers map[string]string) {
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+}
+
+// ValidateShasum returns true if the sha256 checksum of the given file matches the given shasum,
+// or the given shasum is blank.
+func ValidateShasum(path, shasum string) (bool, error) {
 	if shasum == "" {
 		return true, nil
 	}
 
-	f, err := os.Open(path)
+	sum, err := Shasum(path)
 	if err != nil {
 		return false, err
 	}
 
+	return sum == shasum, nil
+}
+
+// Shasum returns the sha256 checksum in hex of the given file.
+func Shasum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+
 	defer func() { _ = f.Close() }()
 
 	h := sha256.New()
@@ -378,8 +594,8 @@ func validateShasum(path, shasum string) (bool, error) {
 
 	_, err = io.CopyBuffer(h, f, buf)
 	if err != nil {
-		return false, err
+		return "", err
 	}
 
-	return hex.EncodeToString(h.Sum(nil)) == shasum, nil
+	return hex.EncodeToString(h.Sum(nil)), nil
 }
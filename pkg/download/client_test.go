@@ -0,0 +1,169 @@
+package download
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_downloadPartial(t *testing.T) {
+	content := bytes.Repeat([]byte("a"), 1024)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"new"`)
+		http.ServeContent(w, r, "archive.zip", time.Time{}, bytes.NewReader(content))
+	}))
+	defer srv.Close()
+
+	c := NewClient(srv.Client(), 0)
+
+	testCases := []struct {
+		name     string
+		ifRange  string
+		expected error
+	}{
+		{name: "matched", ifRange: `"new"`},
+		{name: "mismatched", ifRange: `"old"`, expected: errValidatorMismatched},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			f, err := os.Create(filepath.Join(t.TempDir(), ".archive.zip"))
+			require.NoError(t, err)
+
+			defer func() { _ = f.Close() }()
+
+			req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, srv.URL, nil)
+			require.NoError(t, err)
+			req.Header.Set("If-Range", tc.ifRange)
+
+			err = c.downloadPartial(req, f, 0, int64(len(content)), nil)
+			assert.ErrorIs(t, err, tc.expected)
+		})
+	}
+	// The range beyond the upstream file is treated as complete.
+	t.Run("not satisfiable", func(t *testing.T) {
+		f, err := os.Create(filepath.Join(t.TempDir(), ".archive.zip"))
+		require.NoError(t, err)
+
+		defer func() { _ = f.Close() }()
+
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, srv.URL, nil)
+		require.NoError(t, err)
+
+		err = c.downloadPartial(req, f, int64(len(content)+1), int64(2*len(content)), nil)
+		assert.NoError(t, err)
+	})
+}
+
+func TestClient_Get_empty(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "0")
+	}))
+	defer srv.Close()
+
+	c := NewClient(srv.Client(), 0)
+	dir := t.TempDir()
+
+	// A stale temp output must not be mixed up with the empty content.
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".archive.zip"), []byte("stale"), 0o600))
+
+	err := c.Get(context.Background(), GetOptions{
+		DownloadURL: srv.URL,
+		Directory:   dir,
+		Filename:    "archive.zip",
+		Shasum:      "0000",
+	})
+	assert.ErrorContains(t, err, "empty content")
+	assert.NoFileExists(t, filepath.Join(dir, ".archive.zip"))
+
+	// The empty content is accepted if matched the shasum.
+	err = c.Get(context.Background(), GetOptions{
+		DownloadURL: srv.URL,
+		Directory:   dir,
+		Filename:    "archive.zip",
+		Shasum:      "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+	})
+	require.NoError(t, err)
+	assert.FileExists(t, filepath.Join(dir, "archive.zip"))
+}
+
+func TestClient_Get_scratch(t *testing.T) {
+	content := bytes.Repeat([]byte("a"), 1024)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "archive.zip", time.Time{}, bytes.NewReader(content))
+	}))
+	defer srv.Close()
+
+	c := NewClient(srv.Client(), 0)
+	dir, scratchDir := t.TempDir(), filepath.Join(t.TempDir(), "scratch")
+
+	err := c.Get(context.Background(), GetOptions{
+		DownloadURL:      srv.URL,
+		Directory:        dir,
+		Filename:         "archive.zip",
+		ScratchDirectory: scratchDir,
+	})
+	require.NoError(t, err)
+
+	// The completed download is moved out of the scratch directory.
+	actual, err := os.ReadFile(filepath.Join(dir, "archive.zip"))
+	require.NoError(t, err)
+	assert.Equal(t, content, actual)
+	assert.NoFileExists(t, filepath.Join(dir, ".archive.zip"))
+	assert.NoFileExists(t, filepath.Join(scratchDir, ".archive.zip"))
+}
+
+func TestClient_Get_authorize(t *testing.T) {
+	content := bytes.Repeat([]byte("a"), 1024)
+
+	var (
+		m       sync.Mutex
+		methods []string
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Mimic the S3, which rejects the signature of another method.
+		if r.Header.Get("Authorization") != "signed "+r.Method {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		m.Lock()
+		methods = append(methods, r.Method)
+		m.Unlock()
+
+		http.ServeContent(w, r, "archive.zip", time.Time{}, bytes.NewReader(content))
+	}))
+	defer srv.Close()
+
+	c := NewClient(srv.Client(), 0)
+	dir := t.TempDir()
+
+	err := c.Get(context.Background(), GetOptions{
+		DownloadURL: srv.URL,
+		Directory:   dir,
+		Filename:    "archive.zip",
+		Headers:     map[string]string{"Authorization": "signed GET"},
+		Authorize: func(req *http.Request) {
+			req.Header.Set("Authorization", "signed "+req.Method)
+		},
+	})
+	require.NoError(t, err)
+
+	actual, err := os.ReadFile(filepath.Join(dir, "archive.zip"))
+	require.NoError(t, err)
+	assert.Equal(t, content, actual)
+	assert.Contains(t, methods, http.MethodHead, "should authorize the HEAD probe separately")
+	assert.Contains(t, methods, http.MethodGet)
+}
@@ -5,6 +5,8 @@ import (
 	"net"
 	"net/http"
 	"time"
+
+	"github.com/seal-io/hermitcrab/pkg/chaos"
 )
 
 func NewHttpClient(opts ...HttpClientOption) *http.Client {
@@ -87,6 +89,15 @@ func WithInsecureSkipVerify() HttpClientOption {
 	}
 }
 
+// WithFaultInjection injects the faults configured by chaos.Configure,
+// it must be the last option as wrapping the transport opaquely.
+func WithFaultInjection() HttpClientOption {
+	return func(cli *http.Client) *http.Client {
+		cli.Transport = chaos.Transport(cli.Transport)
+		return cli
+	}
+}
+
 type _CustomTransport struct {
 	Base   http.RoundTripper
 	Custom func(*http.Request)
@@ -0,0 +1,55 @@
+package download
+
+import (
+	"sync"
+	"time"
+)
+
+// ProgressFunc reports the received bytes and the total bytes of a download,
+// the total is not positive if unknown.
+type ProgressFunc func(received, total int64)
+
+// progressInterval is the minimum interval between two reports.
+const progressInterval = time.Second
+
+// progress accumulates the received bytes and reports them at most once per interval.
+type progress struct {
+	m        sync.Mutex
+	fn       ProgressFunc
+	received int64
+	total    int64
+	reported time.Time
+}
+
+func newProgress(fn ProgressFunc, received, total int64) *progress {
+	return &progress{
+		fn:       fn,
+		received: received,
+		total:    total,
+	}
+}
+
+// Write implements io.Writer to count the bytes written through.
+func (p *progress) Write(b []byte) (int, error) {
+	p.add(int64(len(b)))
+	return len(b), nil
+}
+
+// add counts the given received bytes.
+func (p *progress) add(n int64) {
+	if p == nil || p.fn == nil {
+		return
+	}
+
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	p.received += n
+
+	if time.Since(p.reported) < progressInterval {
+		return
+	}
+
+	p.reported = time.Now()
+	p.fn(p.received, p.total)
+}
@@ -0,0 +1,219 @@
+package download
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// Priority is the priority of a download.
+type Priority int
+
+const (
+	// PriorityInteractive is the priority of the user-facing download,
+	// i.e. terraform init, which always preempts the background download.
+	PriorityInteractive Priority = iota
+	// PriorityBackground is the priority of the background download,
+	// i.e. prefetching or repairing.
+	PriorityBackground
+)
+
+func (p Priority) String() string {
+	if p == PriorityBackground {
+		return "background"
+	}
+
+	return "interactive"
+}
+
+type priorityContextKey struct{}
+
+// WithPriority returns a copy of the given context carrying the given download priority.
+func WithPriority(ctx context.Context, p Priority) context.Context {
+	return context.WithValue(ctx, priorityContextKey{}, p)
+}
+
+// PriorityFrom returns the download priority carried by the given context,
+// default is PriorityInteractive.
+func PriorityFrom(ctx context.Context) Priority {
+	if ctx == nil {
+		return PriorityInteractive
+	}
+
+	p, _ := ctx.Value(priorityContextKey{}).(Priority)
+
+	return p
+}
+
+// errPreempted is the cause of canceling a background download,
+// the preempted download is requeued.
+var errPreempted = errors.New("preempted by interactive download")
+
+// queue admits the downloads within the limited slots by priority,
+// the interactive downloads are admitted before the background downloads,
+// and preempt the running background downloads if no slot is available.
+type queue struct {
+	m sync.Mutex
+
+	slots   int
+	running map[*ticket]struct{}
+	waiting [2][]*ticket
+}
+
+type ticket struct {
+	key      string
+	priority Priority
+	ready    chan struct{}
+	cancel   context.CancelCauseFunc
+}
+
+func newQueue(slots int) *queue {
+	return &queue{
+		slots:   slots,
+		running: map[*ticket]struct{}{},
+	}
+}
+
+// acquire waits for a slot to download into the given key(directory),
+// and returns the context to download and the function to release the slot,
+// the returned context is canceled with errPreempted if preempted.
+func (q *queue) acquire(ctx context.Context, key string, p Priority) (context.Context, func(), error) {
+	// Unlimited.
+	if q == nil || q.slots <= 0 {
+		return ctx, func() {}, nil
+	}
+
+	if p != PriorityBackground {
+		p = PriorityInteractive
+	}
+
+	dctx, cancel := context.WithCancelCause(ctx)
+	t := &ticket{
+		key:      key,
+		priority: p,
+		ready:    make(chan struct{}),
+		cancel:   cancel,
+	}
+
+	q.m.Lock()
+	q.waiting[p] = append(q.waiting[p], t)
+	q.dispatch()
+
+	if p == PriorityInteractive {
+		q.preempt()
+	}
+	q.m.Unlock()
+
+	release := func() {
+		q.m.Lock()
+		defer q.m.Unlock()
+
+		delete(q.running, t)
+		q.dispatch()
+		cancel(nil)
+	}
+
+	select {
+	case <-t.ready:
+		return dctx, release, nil
+	case <-ctx.Done():
+	}
+
+	q.m.Lock()
+	defer q.m.Unlock()
+
+	select {
+	case <-t.ready:
+		// Admitted at the same time.
+		delete(q.running, t)
+		q.dispatch()
+	default:
+		q.remove(t)
+	}
+
+	cancel(nil)
+
+	return nil, nil, ctx.Err()
+}
+
+// promote promotes the background downloads into the given key(directory) to interactive,
+// so that the interactive requests waiting for the same download are not starved.
+func (q *queue) promote(key string) {
+	if q == nil || q.slots <= 0 {
+		return
+	}
+
+	q.m.Lock()
+	defer q.m.Unlock()
+
+	for t := range q.running {
+		if t.key == key {
+			t.priority = PriorityInteractive
+		}
+	}
+
+	ws := q.waiting[PriorityBackground][:0]
+
+	for _, t := range q.waiting[PriorityBackground] {
+		if t.key != key {
+			ws = append(ws, t)
+			continue
+		}
+
+		t.priority = PriorityInteractive
+		q.waiting[PriorityInteractive] = append(q.waiting[PriorityInteractive], t)
+	}
+
+	q.waiting[PriorityBackground] = ws
+
+	q.dispatch()
+	q.preempt()
+}
+
+// dispatch admits the waiting downloads by priority until no slot is available,
+// it must be called with the lock held.
+func (q *queue) dispatch() {
+	for p := range q.waiting {
+		for len(q.running) < q.slots && len(q.waiting[p]) != 0 {
+			t := q.waiting[p][0]
+			q.waiting[p] = q.waiting[p][1:]
+			q.running[t] = struct{}{}
+			close(t.ready)
+		}
+	}
+}
+
+// preempt cancels the running background downloads for the waiting interactive downloads,
+// it must be called with the lock held.
+func (q *queue) preempt() {
+	n := len(q.waiting[PriorityInteractive])
+
+	for t := range q.running {
+		if n == 0 {
+			break
+		}
+
+		if t.priority == PriorityBackground {
+			// Release the slot immediately,
+			// the preempted download stops shortly.
+			delete(q.running, t)
+			t.cancel(errPreempted)
+			n--
+		}
+	}
+
+	q.dispatch()
+}
+
+// remove removes the given ticket from the waiting list,
+// it must be called with the lock held.
+func (q *queue) remove(t *ticket) {
+	for p := range q.waiting {
+		for i := range q.waiting[p] {
+			if q.waiting[p][i] == t {
+				q.waiting[p] = append(q.waiting[p][:i], q.waiting[p][i+1:]...)
+				return
+			}
+		}
+	}
+}
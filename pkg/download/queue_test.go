@@ -0,0 +1,75 @@
+package download
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueue_preempt(t *testing.T) {
+	q := newQueue(1)
+	ctx := context.Background()
+
+	// The background download runs if a slot is available.
+	bctx, brelease, err := q.acquire(ctx, "a", PriorityBackground)
+	require.NoError(t, err)
+
+	// The interactive download preempts the running background download.
+	ictx, irelease, err := q.acquire(ctx, "b", PriorityInteractive)
+	require.NoError(t, err)
+	assert.NoError(t, ictx.Err())
+
+	<-bctx.Done()
+	assert.True(t, errors.Is(context.Cause(bctx), errPreempted))
+	brelease()
+
+	// The requeued background download waits for the interactive download.
+	acquired := make(chan struct{})
+
+	go func() {
+		_, release, err := q.acquire(ctx, "a", PriorityBackground)
+		if err == nil {
+			close(acquired)
+			release()
+		}
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("the background download must wait")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	irelease()
+
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("the background download must be admitted after releasing")
+	}
+}
+
+func TestQueue_promote(t *testing.T) {
+	q := newQueue(1)
+	ctx := context.Background()
+
+	bctx, brelease, err := q.acquire(ctx, "a", PriorityBackground)
+	require.NoError(t, err)
+
+	// The promoted download is not preempted.
+	q.promote("a")
+
+	cctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+
+	_, _, err = q.acquire(cctx, "b", PriorityInteractive)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.NoError(t, bctx.Err())
+
+	brelease()
+	assert.Empty(t, q.waiting[PriorityInteractive], "the canceled waiting must be removed")
+}
@@ -0,0 +1,94 @@
+package download
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/seal-io/walrus/utils/bytespool"
+)
+
+// renameFile moves the file from src to dst atomically,
+// if the src and dst are on different devices,
+// copies the src into a hidden file beside the dst and renames it,
+// the parent directory of the dst is synced after renaming.
+func renameFile(src, dst string) error {
+	err := os.Rename(src, dst)
+	if err != nil {
+		if !errors.Is(err, syscall.EXDEV) {
+			return err
+		}
+
+		err = copyRename(src, dst)
+		if err != nil {
+			return err
+		}
+	}
+
+	syncDir(filepath.Dir(dst))
+
+	return nil
+}
+
+// copyRename copies the src into a hidden file beside the dst,
+// syncs and renames it to the dst, then removes the src.
+func copyRename(src, dst string) (err error) {
+	sf, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open source: %w", err)
+	}
+
+	defer func() { _ = sf.Close() }()
+
+	tp := filepath.Join(filepath.Dir(dst), "."+filepath.Base(dst))
+
+	tf, err := os.OpenFile(tp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to create staging file: %w", err)
+	}
+
+	defer func() {
+		_ = tf.Close()
+
+		if err != nil {
+			_ = os.Remove(tp)
+		}
+	}()
+
+	buf := bytespool.GetBytes(copyBuffer)
+	defer bytespool.Put(buf)
+
+	_, err = io.CopyBuffer(tf, sf, buf)
+	if err != nil {
+		return fmt.Errorf("failed to copy to staging file: %w", err)
+	}
+
+	err = tf.Sync()
+	if err != nil {
+		return fmt.Errorf("failed to sync staging file: %w", err)
+	}
+
+	err = os.Rename(tp, dst)
+	if err != nil {
+		return fmt.Errorf("failed to rename staging file: %w", err)
+	}
+
+	_ = os.Remove(src)
+
+	return nil
+}
+
+// syncDir syncs the directory entries of the given directory to survive a crash,
+// it is best effort as not all platforms support syncing a directory.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+
+	_ = d.Sync()
+	_ = d.Close()
+}
@@ -0,0 +1,88 @@
+// Package events broadcasts the structured events of the service to the subscribers,
+// i.e. the live dashboard watching the admin event stream.
+package events
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/seal-io/walrus/utils/gopool"
+)
+
+// The types of the events.
+const (
+	// TypeSyncStarted indicates the versions of a provider start syncing from the upstream.
+	TypeSyncStarted = "sync.started"
+	// TypeSyncFinished indicates the versions of a provider finish syncing from the upstream.
+	TypeSyncFinished = "sync.finished"
+	// TypeDownloadStarted indicates an archive starts downloading from the upstream.
+	TypeDownloadStarted = "download.started"
+	// TypeDownloadProgress reports the received bytes of a downloading archive.
+	TypeDownloadProgress = "download.progress"
+	// TypeDownloadFinished indicates an archive finishes downloading from the upstream.
+	TypeDownloadFinished = "download.finished"
+	// TypeArchivesEvicted indicates the cached archives are evicted.
+	TypeArchivesEvicted = "archives.evicted"
+)
+
+// Event holds the type, the time and the payload of an event.
+type Event struct {
+	Type      string    `json:"type"`
+	Timestamp time.Time `json:"timestamp"`
+	Data      any       `json:"data,omitempty"`
+}
+
+// subscriberBuffer is the number of events buffered for a subscriber.
+const subscriberBuffer = 64
+
+var (
+	mu          sync.RWMutex
+	subscribers = map[chan Event]struct{}{}
+)
+
+// Publish broadcasts the event of the given type and payload to the subscribers,
+// the event is dropped for the subscriber falling behind,
+// so that the publisher is never blocked.
+func Publish(typ string, data any) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if len(subscribers) == 0 {
+		return
+	}
+
+	ev := Event{
+		Type:      typ,
+		Timestamp: time.Now(),
+		Data:      data,
+	}
+
+	for ch := range subscribers {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+// Subscribe returns a channel receiving the published events,
+// the channel is closed once the given context is done.
+func Subscribe(ctx context.Context) <-chan Event {
+	ch := make(chan Event, subscriberBuffer)
+
+	mu.Lock()
+	subscribers[ch] = struct{}{}
+	mu.Unlock()
+
+	gopool.Go(func() {
+		<-ctx.Done()
+
+		mu.Lock()
+		delete(subscribers, ch)
+		close(ch)
+		mu.Unlock()
+	})
+
+	return ch
+}
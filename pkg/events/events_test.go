@@ -0,0 +1,35 @@
+package events
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubscribe(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	ch := Subscribe(ctx)
+
+	Publish(TypeSyncStarted, "x")
+
+	ev := <-ch
+	assert.Equal(t, TypeSyncStarted, ev.Type)
+	assert.Equal(t, "x", ev.Data)
+
+	// The subscriber falling behind drops the events instead of blocking the publisher.
+	for i := 0; i < 2*subscriberBuffer; i++ {
+		Publish(TypeDownloadProgress, i)
+	}
+
+	assert.Len(t, ch, subscriberBuffer)
+
+	cancel()
+
+	for range ch {
+	}
+
+	_, ok := <-ch
+	assert.False(t, ok)
+}
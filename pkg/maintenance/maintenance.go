@@ -0,0 +1,102 @@
+package maintenance
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/seal-io/walrus/utils/errorx"
+)
+
+// DefaultRetryAfter is the default delay asking the clients to retry during the maintenance.
+const DefaultRetryAfter = 5 * time.Minute
+
+// Status holds the maintenance status of the server,
+// during the maintenance, the metadata is answered from the cache,
+// the downloads and the syncs are refused.
+type Status struct {
+	Enabled bool      `json:"enabled"`
+	Since   time.Time `json:"since,omitempty"`
+	Reason  string    `json:"reason,omitempty"`
+	// RetryAfter is the seconds of the Retry-After responded with the refusals.
+	RetryAfter int64 `json:"retryAfter,omitempty"`
+}
+
+var status atomic.Pointer[Status]
+
+// Get returns the maintenance status.
+func Get() Status {
+	if s := status.Load(); s != nil {
+		return *s
+	}
+
+	return Status{}
+}
+
+// Enabled returns true if the server is in maintenance.
+func Enabled() bool {
+	return Get().Enabled
+}
+
+// Enable puts the server into maintenance with the given reason,
+// the clients are asked to retry after the given delay, DefaultRetryAfter if not positive,
+// keeps the start time if already in maintenance.
+func Enable(reason string, retryAfter time.Duration) Status {
+	if retryAfter <= 0 {
+		retryAfter = DefaultRetryAfter
+	}
+
+	s := Status{
+		Enabled:    true,
+		Since:      time.Now(),
+		Reason:     reason,
+		RetryAfter: int64(retryAfter.Round(time.Second) / time.Second),
+	}
+
+	if prev := Get(); prev.Enabled {
+		s.Since = prev.Since
+	}
+
+	status.Store(&s)
+
+	return s
+}
+
+// Disable brings the server out of maintenance.
+func Disable() Status {
+	status.Store(&Status{})
+
+	return Status{}
+}
+
+// Error returns the error of refusing the given action during the maintenance,
+// which responds 503 with the Retry-After, returns nil if not in maintenance.
+func Error(action string) error {
+	s := Get()
+	if !s.Enabled {
+		return nil
+	}
+
+	return errorx.WrapHttpError(http.StatusServiceUnavailable,
+		retryAfterError(s.RetryAfter), fmt.Sprintf("%s is unavailable during maintenance", action))
+}
+
+// retryAfterError is the cause of the refusal during the maintenance,
+// which holds the seconds of the Retry-After.
+type retryAfterError int64
+
+func (e retryAfterError) Error() string {
+	return "in maintenance, retry after " + strconv.FormatInt(int64(e), 10) + "s"
+}
+
+// RetryAfter returns the value of the Retry-After header.
+func (e retryAfterError) RetryAfter() string {
+	return strconv.FormatInt(int64(e), 10)
+}
+
+// ErrorCode returns the machine-readable code of the error.
+func (e retryAfterError) ErrorCode() string {
+	return "maintenance"
+}
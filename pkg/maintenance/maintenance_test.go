@@ -0,0 +1,46 @@
+package maintenance
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/seal-io/walrus/utils/errorx"
+)
+
+func TestMaintenance(t *testing.T) {
+	defer Disable()
+
+	if err := Error("downloading"); err != nil {
+		t.Fatalf("expected no error out of maintenance, got %v", err)
+	}
+
+	s := Enable("migrating", 0)
+	if !Enabled() || s.RetryAfter != 300 {
+		t.Fatalf("unexpected status: %+v", s)
+	}
+
+	// Keep the start time if already in maintenance.
+	if s2 := Enable("upgrading", time.Minute); !s2.Since.Equal(s.Since) || s2.RetryAfter != 60 {
+		t.Errorf("unexpected status: %+v", s2)
+	}
+
+	err := Error("downloading")
+
+	var he errorx.HttpError
+	if !errors.As(err, &he) || he.Status != http.StatusServiceUnavailable {
+		t.Errorf("expected 503, got %v", err)
+	}
+
+	var ra interface{ RetryAfter() string }
+	if !errors.As(err, &ra) || ra.RetryAfter() != "60" {
+		t.Errorf("expected retry after 60, got %v", err)
+	}
+
+	Disable()
+
+	if Enabled() {
+		t.Error("expected out of maintenance")
+	}
+}
@@ -1,10 +1,13 @@
 package metric
 
 import (
+	"fmt"
+	"io"
 	"net/http"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/common/expfmt"
 
 	"github.com/seal-io/walrus/utils/log"
 )
@@ -23,3 +26,21 @@ func Index(maxInFlight int, timeout time.Duration) http.Handler {
 
 	return promhttp.HandlerFor(reg, opts)
 }
+
+// WriteText writes the snapshot of the registered metrics into the given writer in the text format,
+// i.e. attaching to the support bundle.
+func WriteText(w io.Writer) error {
+	mfs, err := reg.Gather()
+	if err != nil {
+		return fmt.Errorf("error gathering metrics: %w", err)
+	}
+
+	enc := expfmt.NewEncoder(w, expfmt.NewFormat(expfmt.TypeTextPlain))
+	for i := range mfs {
+		if err = enc.Encode(mfs[i]); err != nil {
+			return fmt.Errorf("error encoding metrics: %w", err)
+		}
+	}
+
+	return nil
+}
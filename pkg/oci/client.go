@@ -0,0 +1,552 @@
+package oci
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/seal-io/walrus/utils/json"
+	"github.com/seal-io/walrus/utils/version"
+
+	"github.com/seal-io/hermitcrab/pkg/download"
+)
+
+var defaultHttpClient = download.NewHttpClient(
+	download.WithUserAgent(version.GetUserAgentWith("hermitcrab")),
+	download.WithInsecureSkipVerify(),
+)
+
+type ClientOptions struct {
+	// PlainHTTP accesses the registry with HTTP instead of HTTPS.
+	PlainHTTP bool
+	// Credential is the credential of the registry,
+	// in form of <USERNAME>:<PASSWORD> for basic authentication,
+	// or the token for bearer authentication.
+	Credential string
+}
+
+// Client accesses the OCI registry with the distribution API,
+// see https://github.com/opencontainers/distribution-spec/blob/main/spec.md.
+type Client struct {
+	httpCli    *http.Client
+	base       url.URL
+	credential string
+
+	challenge struct {
+		sync.Mutex
+		pinged bool
+		scheme string
+		params map[string]string
+	}
+	tokens sync.Map
+}
+
+func NewClient(host string, opts ClientOptions) *Client {
+	scheme := "https"
+	if opts.PlainHTTP {
+		scheme = "http"
+	}
+
+	return &Client{
+		httpCli: defaultHttpClient,
+		base: url.URL{
+			Scheme: scheme,
+			Host:   host,
+			Path:   "/v2/",
+		},
+		credential: opts.Credential,
+	}
+}
+
+// URL returns the API URL of the given path.
+func (c *Client) URL(p string) string {
+	u := c.base
+	u.Path += strings.TrimPrefix(p, "/")
+
+	return u.String()
+}
+
+// BlobURL returns the URL of the given blob.
+func (c *Client) BlobURL(repo, digest string) string {
+	return c.URL(repo + "/blobs/" + digest)
+}
+
+// ParseBlobURL returns the repository and digest of the given blob URL,
+// returns false if the URL is not a blob of the registry.
+func (c *Client) ParseBlobURL(rawURL string) (repo, digest string, ok bool) {
+	p, ok := strings.CutPrefix(rawURL, c.base.String())
+	if !ok {
+		return "", "", false
+	}
+
+	i := strings.LastIndex(p, "/blobs/")
+	if i <= 0 {
+		return "", "", false
+	}
+
+	return p[:i], p[i+len("/blobs/"):], true
+}
+
+type token struct {
+	value   string
+	expired time.Time
+}
+
+// AuthHeaders returns the authorization headers of accessing the given repository with the given actions,
+// i.e. pull, or pull,push.
+func (c *Client) AuthHeaders(ctx context.Context, repo, actions string) (map[string]string, error) {
+	c.challenge.Lock()
+	if !c.challenge.pinged {
+		c.challenge.scheme, c.challenge.params, c.challenge.pinged = c.ping(ctx)
+	}
+	c.challenge.Unlock()
+
+	switch c.challenge.scheme {
+	case "basic":
+		if c.credential == "" {
+			return nil, nil
+		}
+
+		return map[string]string{
+			"Authorization": "Basic " + base64.StdEncoding.EncodeToString([]byte(c.credential)),
+		}, nil
+	case "bearer":
+	default:
+		return nil, nil
+	}
+
+	scope := "repository:" + repo + ":" + actions
+
+	if v, ok := c.tokens.Load(scope); ok {
+		if t := v.(token); time.Now().Before(t.expired) {
+			return map[string]string{"Authorization": "Bearer " + t.value}, nil
+		}
+	}
+
+	t, err := c.fetchToken(ctx, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	c.tokens.Store(scope, t)
+
+	return map[string]string{"Authorization": "Bearer " + t.value}, nil
+}
+
+// ping gets the authentication challenge of the registry,
+// returns false if failed to reach the registry.
+func (c *Client) ping(ctx context.Context) (scheme string, params map[string]string, ok bool) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.base.String(), nil)
+	if err != nil {
+		return "", nil, false
+	}
+
+	resp, err := c.httpCli.Do(req)
+	if err != nil {
+		return "", nil, false
+	}
+
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusUnauthorized {
+		return "", nil, true
+	}
+
+	scheme, params = parseChallenge(resp.Header.Get("WWW-Authenticate"))
+
+	return scheme, params, true
+}
+
+// parseChallenge parses the WWW-Authenticate header,
+// i.e. Bearer realm="https://auth.docker.io/token",service="registry.docker.io".
+func parseChallenge(s string) (scheme string, params map[string]string) {
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(s), " ")
+	params = map[string]string{}
+
+	for rest != "" {
+		var kv string
+
+		kv, rest = cutParam(rest)
+
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok {
+			continue
+		}
+
+		params[strings.ToLower(strings.TrimSpace(k))] = strings.Trim(strings.TrimSpace(v), `"`)
+	}
+
+	return strings.ToLower(scheme), params
+}
+
+// cutParam cuts the first parameter from the given string,
+// the comma inside the quotes is not a separator.
+func cutParam(s string) (string, string) {
+	quoted := false
+
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			quoted = !quoted
+		case ',':
+			if !quoted {
+				return s[:i], s[i+1:]
+			}
+		}
+	}
+
+	return s, ""
+}
+
+// fetchToken fetches the token of the given scope from the authorization service.
+func (c *Client) fetchToken(ctx context.Context, scope string) (token, error) {
+	realm := c.challenge.params["realm"]
+	if realm == "" {
+		return token{}, errors.New("invalid bearer challenge: missing realm")
+	}
+
+	u, err := url.Parse(realm)
+	if err != nil {
+		return token{}, fmt.Errorf("invalid bearer challenge: %w", err)
+	}
+
+	q := u.Query()
+	if s := c.challenge.params["service"]; s != "" {
+		q.Set("service", s)
+	}
+	q.Set("scope", scope)
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return token{}, err
+	}
+
+	if un, pw, ok := strings.Cut(c.credential, ":"); ok {
+		req.SetBasicAuth(un, pw)
+	} else if c.credential != "" {
+		// The credential is a token already.
+		return token{value: c.credential, expired: time.Now().Add(time.Hour)}, nil
+	}
+
+	resp, err := c.httpCli.Do(req)
+	if err != nil {
+		return token{}, fmt.Errorf("error fetching token: %w", err)
+	}
+
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return token{}, fmt.Errorf("error fetching token: unexpected status %d", resp.StatusCode)
+	}
+
+	var b struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+
+	if err = json.NewDecoder(resp.Body).Decode(&b); err != nil {
+		return token{}, fmt.Errorf("error decoding token: %w", err)
+	}
+
+	t := token{value: b.Token}
+	if t.value == "" {
+		t.value = b.AccessToken
+	}
+
+	if b.ExpiresIn <= 0 {
+		b.ExpiresIn = 60
+	}
+	// Expire a little earlier to avoid using the expiring token.
+	t.expired = time.Now().Add(time.Duration(b.ExpiresIn)*time.Second - 10*time.Second)
+
+	return t, nil
+}
+
+// Do sends the given request with the authorization of the given repository and actions,
+// the given request must be able to get body again if it has a body.
+func (c *Client) Do(req *http.Request, repo, actions string) (*http.Response, error) {
+	hs, err := c.AuthHeaders(req.Context(), repo, actions)
+	if err != nil {
+		return nil, err
+	}
+
+	for k, v := range hs {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := c.httpCli.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusUnauthorized || len(hs) == 0 {
+		return resp, nil
+	}
+
+	// Retry with the new token if the cached token is revoked.
+	_ = resp.Body.Close()
+	c.tokens.Delete("repository:" + repo + ":" + actions)
+
+	hs, err = c.AuthHeaders(req.Context(), repo, actions)
+	if err != nil {
+		return nil, err
+	}
+
+	req = req.Clone(req.Context())
+	for k, v := range hs {
+		req.Header.Set(k, v)
+	}
+
+	if req.GetBody != nil {
+		req.Body, err = req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return c.httpCli.Do(req)
+}
+
+// ListTags lists the tags of the given repository.
+func (c *Client) ListTags(ctx context.Context, repo string) ([]string, error) {
+	var (
+		tags []string
+		next = c.URL(repo+"/tags/list") + "?n=1000"
+	)
+
+	for next != "" {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, next, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := c.Do(req, repo, "pull")
+		if err != nil {
+			return nil, fmt.Errorf("error listing tags: %w", err)
+		}
+
+		var b struct {
+			Tags []string `json:"tags"`
+		}
+
+		err = decodeResponse(resp, &b)
+		if err != nil {
+			return nil, fmt.Errorf("error listing tags: %w", err)
+		}
+
+		tags = append(tags, b.Tags...)
+		next = nextLink(resp, req.URL)
+	}
+
+	return tags, nil
+}
+
+// nextLink returns the next page URL from the Link header,
+// i.e. </v2/foo/tags/list?n=1000&last=b>; rel="next".
+func nextLink(resp *http.Response, base *url.URL) string {
+	l := resp.Header.Get("Link")
+	if l == "" || !strings.Contains(l, `rel="next"`) {
+		return ""
+	}
+
+	s, e := strings.Index(l, "<"), strings.Index(l, ">")
+	if s < 0 || e <= s {
+		return ""
+	}
+
+	u, err := url.Parse(l[s+1 : e])
+	if err != nil {
+		return ""
+	}
+
+	return base.ResolveReference(u).String()
+}
+
+// GetManifest gets the manifest of the given reference.
+func (c *Client) GetManifest(ctx context.Context, repo, ref string) (Manifest, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.URL(repo+"/manifests/"+ref), nil)
+	if err != nil {
+		return Manifest{}, err
+	}
+
+	req.Header.Set("Accept", MediaTypeImageManifest)
+
+	resp, err := c.Do(req, repo, "pull")
+	if err != nil {
+		return Manifest{}, fmt.Errorf("error getting manifest: %w", err)
+	}
+
+	var m Manifest
+
+	err = decodeResponse(resp, &m)
+	if err != nil {
+		return Manifest{}, fmt.Errorf("error getting manifest: %w", err)
+	}
+
+	return m, nil
+}
+
+func decodeResponse(resp *http.Response, ptr any) error {
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		bs, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected status %d: %s", resp.StatusCode, string(bs))
+	}
+
+	return json.NewDecoder(resp.Body).Decode(ptr)
+}
+
+// GetManifestDigest gets the digest of the given reference,
+// returns empty string if not found.
+func (c *Client) GetManifestDigest(ctx context.Context, repo, ref string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, c.URL(repo+"/manifests/"+ref), nil)
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set("Accept", MediaTypeImageManifest)
+
+	resp, err := c.Do(req, repo, "pull")
+	if err != nil {
+		return "", fmt.Errorf("error heading manifest: %w", err)
+	}
+
+	_ = resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.Header.Get("Docker-Content-Digest"), nil
+	case http.StatusNotFound:
+		return "", nil
+	}
+
+	return "", fmt.Errorf("error heading manifest: unexpected status %d", resp.StatusCode)
+}
+
+// PutManifest puts the given manifest with the given reference.
+func (c *Client) PutManifest(ctx context.Context, repo, ref string, m Manifest) error {
+	bs, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, c.URL(repo+"/manifests/"+ref), bytes.NewReader(bs))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", MediaTypeImageManifest)
+
+	resp, err := c.Do(req, repo, "pull,push")
+	if err != nil {
+		return fmt.Errorf("error putting manifest: %w", err)
+	}
+
+	return expectStatus(resp, http.StatusCreated)
+}
+
+// BlobExists returns true if the given blob is existed.
+func (c *Client) BlobExists(ctx context.Context, repo, digest string) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, c.BlobURL(repo, digest), nil)
+	if err != nil {
+		return false, err
+	}
+
+	resp, err := c.Do(req, repo, "pull")
+	if err != nil {
+		return false, fmt.Errorf("error heading blob: %w", err)
+	}
+
+	_ = resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	}
+
+	return false, fmt.Errorf("error heading blob: unexpected status %d", resp.StatusCode)
+}
+
+// PushBlob pushes the blob in a monolithic upload,
+// the given open function is called to get the blob content, which may be called multiple times.
+func (c *Client) PushBlob(ctx context.Context, repo string, desc Descriptor, open func() (io.ReadCloser, error)) error {
+	ok, err := c.BlobExists(ctx, repo, desc.Digest)
+	if err != nil || ok {
+		return err
+	}
+
+	// Start uploading.
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.URL(repo+"/blobs/uploads/"), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.Do(req, repo, "pull,push")
+	if err != nil {
+		return fmt.Errorf("error starting blob upload: %w", err)
+	}
+
+	if err = expectStatus(resp, http.StatusAccepted); err != nil {
+		return fmt.Errorf("error starting blob upload: %w", err)
+	}
+
+	loc, err := req.URL.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		return fmt.Errorf("error parsing upload location: %w", err)
+	}
+
+	q := loc.Query()
+	q.Set("digest", desc.Digest)
+	loc.RawQuery = q.Encode()
+
+	// Complete uploading.
+	body, err := open()
+	if err != nil {
+		return err
+	}
+
+	req, err = http.NewRequestWithContext(ctx, http.MethodPut, loc.String(), body)
+	if err != nil {
+		_ = body.Close()
+		return err
+	}
+
+	req.ContentLength = desc.Size
+	req.GetBody = open
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	resp, err = c.Do(req, repo, "pull,push")
+	if err != nil {
+		return fmt.Errorf("error completing blob upload: %w", err)
+	}
+
+	if err = expectStatus(resp, http.StatusCreated); err != nil {
+		return fmt.Errorf("error completing blob upload: %w", err)
+	}
+
+	return nil
+}
+
+func expectStatus(resp *http.Response, status int) error {
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != status {
+		bs, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected status %d: %s", resp.StatusCode, string(bs))
+	}
+
+	return nil
+}
@@ -0,0 +1,43 @@
+package oci
+
+const (
+	// MediaTypeImageManifest is the media type of OCI image manifest.
+	MediaTypeImageManifest = "application/vnd.oci.image.manifest.v1+json"
+	// MediaTypeEmptyJSON is the media type of the empty config, see ORAS.
+	MediaTypeEmptyJSON = "application/vnd.oci.empty.v1+json"
+	// MediaTypeProviderArchive is the media type of the provider archive layer.
+	MediaTypeProviderArchive = "application/zip"
+	// ArtifactTypeProvider is the artifact type of the provider artifact.
+	ArtifactTypeProvider = "application/vnd.terraform.provider.v1"
+
+	// AnnotationTitle is the annotation of the layer filename.
+	AnnotationTitle = "org.opencontainers.image.title"
+	// AnnotationProviderProtocols is the annotation of the provider protocols,
+	// in form of comma separated versions, i.e. 5.0,6.0.
+	AnnotationProviderProtocols = "io.terraform.provider.protocols"
+)
+
+// Descriptor describes the content addressable blob.
+type Descriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// Manifest is the OCI image manifest.
+type Manifest struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType,omitempty"`
+	ArtifactType  string            `json:"artifactType,omitempty"`
+	Config        Descriptor        `json:"config"`
+	Layers        []Descriptor      `json:"layers"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+// DescriptorEmptyJSON is the descriptor of the empty config `{}`.
+var DescriptorEmptyJSON = Descriptor{
+	MediaType: MediaTypeEmptyJSON,
+	Digest:    "sha256:44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a",
+	Size:      2,
+}
@@ -0,0 +1,330 @@
+package policy
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+	"github.com/seal-io/walrus/utils/json"
+	"github.com/seal-io/walrus/utils/vars"
+
+	"github.com/seal-io/hermitcrab/pkg/provider/addrs"
+)
+
+// Policy holds the policies of mirroring providers.
+type Policy struct {
+	// Quotas holds the disk quota in bytes of each namespace,
+	// indexing by <NAMESPACE> or <HOSTNAME>/<NAMESPACE>.
+	Quotas map[string]uint64
+	// VirtualHosts holds the provider set served to each requested host,
+	// indexing by the host without port, the * is the fallback of the unlisted hosts.
+	VirtualHosts map[string]VirtualHost
+	// Equivalents holds the equivalent namespaces of each namespace,
+	// indexing by <HOSTNAME>/<NAMESPACE>,
+	// i.e. registry.opentofu.org/hashicorp is equivalent to registry.terraform.io/hashicorp.
+	Equivalents map[string][]string
+	// Trust holds the GPG key IDs which must sign the providers,
+	// indexing by <HOSTNAME> or <HOSTNAME>/<NAMESPACE>, the key IDs are in upper case.
+	Trust map[string][]string
+	// Platforms holds the patterns of the served platforms,
+	// in form of <OS>_<ARCH> with the shell globs, i.e. linux_*,
+	// all platforms are served if blank.
+	Platforms []string
+}
+
+// VirtualHost holds the policy of a requested host.
+type VirtualHost struct {
+	// Providers holds the patterns of the served providers,
+	// in form of <HOSTNAME>/<NAMESPACE>/<TYPE> with the shell globs,
+	// i.e. registry.terraform.io/hashicorp/*.
+	Providers []string `json:"providers"`
+}
+
+// Serves returns true if the given provider is served to the virtual host.
+func (vh VirtualHost) Serves(addr addrs.Address) bool {
+	k := addr.TypedKey()
+
+	for _, p := range vh.Providers {
+		if ok, _ := path.Match(p, k); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+var policy = vars.NewSetOnce(Policy{
+	Quotas:       map[string]uint64{},
+	VirtualHosts: map[string]VirtualHost{},
+	Equivalents:  map[string][]string{},
+	Trust:        map[string][]string{},
+})
+
+// Configure configures the global policy,
+// it can only be called once.
+func Configure(p Policy) {
+	if p.Quotas == nil {
+		p.Quotas = map[string]uint64{}
+	}
+
+	if p.VirtualHosts == nil {
+		p.VirtualHosts = map[string]VirtualHost{}
+	}
+
+	if p.Equivalents == nil {
+		p.Equivalents = map[string][]string{}
+	}
+
+	if p.Trust == nil {
+		p.Trust = map[string][]string{}
+	}
+
+	policy.Set(p)
+}
+
+// Get returns the global policy.
+func Get() Policy {
+	return policy.Get()
+}
+
+// Load loads the policy from the given file.
+//
+// File example:
+//
+//	{
+//	  "quotas": {
+//	    "hashicorp": "20GiB",
+//	    "registry.terraform.io/datadog": "5GiB"
+//	  },
+//	  "vhosts": {
+//	    "tf-mirror-prod.corp": {
+//	      "providers": ["hashicorp/*", "registry.terraform.io/datadog/datadog"]
+//	    },
+//	    "*": {
+//	      "providers": ["*/*/*"]
+//	    }
+//	  },
+//	  "equivalents": [
+//	    ["registry.terraform.io/hashicorp", "registry.opentofu.org/hashicorp"]
+//	  ],
+//	  "trust": {
+//	    "registry.terraform.io/hashicorp": ["34365D9472D7468F"],
+//	    "registry.example.com": ["51852D87348FFC4C"]
+//	  },
+//	  "platforms": ["linux_*", "darwin_arm64"]
+//	}
+//
+// Returns empty policy if the given file is blank.
+func Load(file string) (Policy, error) {
+	p := Policy{
+		Quotas:       map[string]uint64{},
+		VirtualHosts: map[string]VirtualHost{},
+		Equivalents:  map[string][]string{},
+		Trust:        map[string][]string{},
+	}
+
+	if file == "" {
+		return p, nil
+	}
+
+	bs, err := os.ReadFile(file)
+	if err != nil {
+		return Policy{}, fmt.Errorf("error reading policy file: %w", err)
+	}
+
+	var pf struct {
+		Quotas       map[string]string      `json:"quotas"`
+		VirtualHosts map[string]VirtualHost `json:"vhosts"`
+		Equivalents  [][]string             `json:"equivalents"`
+		Trust        map[string][]string    `json:"trust"`
+		Platforms    []string               `json:"platforms"`
+	}
+
+	if err = json.Unmarshal(bs, &pf); err != nil {
+		return Policy{}, fmt.Errorf("error unmarshaling policy file: %w", err)
+	}
+
+	for k, v := range pf.Quotas {
+		q, err := humanize.ParseBytes(v)
+		if err != nil {
+			return Policy{}, fmt.Errorf("invalid quota of %s: %w", k, err)
+		}
+
+		p.Quotas[strings.ToLower(k)] = q
+	}
+
+	for k, v := range pf.VirtualHosts {
+		vh := VirtualHost{
+			Providers: make([]string, 0, len(v.Providers)),
+		}
+
+		for _, pp := range v.Providers {
+			pp = strings.ToLower(strings.Trim(pp, "/"))
+
+			// Complete the hostname if omitted.
+			if strings.Count(pp, "/") == 1 {
+				pp = addrs.DefaultHostname + "/" + pp
+			}
+
+			if _, err = path.Match(pp, ""); err != nil || strings.Count(pp, "/") != 2 {
+				return Policy{}, fmt.Errorf("invalid provider pattern %q of vhost %s", pp, k)
+			}
+
+			vh.Providers = append(vh.Providers, pp)
+		}
+
+		p.VirtualHosts[strings.ToLower(k)] = vh
+	}
+
+	for _, g := range pf.Equivalents {
+		ns := make([]string, 0, len(g))
+
+		for _, n := range g {
+			n = strings.ToLower(strings.Trim(n, "/"))
+			if strings.Count(n, "/") != 1 {
+				return Policy{}, fmt.Errorf("invalid equivalent namespace %q, must be <HOSTNAME>/<NAMESPACE>", n)
+			}
+
+			ns = append(ns, n)
+		}
+
+		for i := range ns {
+			for j := range ns {
+				if i != j && ns[i] != ns[j] {
+					p.Equivalents[ns[i]] = append(p.Equivalents[ns[i]], ns[j])
+				}
+			}
+		}
+	}
+
+	for k, ids := range pf.Trust {
+		k = strings.ToLower(strings.Trim(k, "/"))
+		if k == "" || strings.Count(k, "/") > 1 {
+			return Policy{}, fmt.Errorf("invalid trust %q, must be <HOSTNAME> or <HOSTNAME>/<NAMESPACE>", k)
+		}
+
+		if len(ids) == 0 {
+			return Policy{}, fmt.Errorf("invalid trust of %s: blank key IDs", k)
+		}
+
+		for _, id := range ids {
+			id = strings.ToUpper(id)
+			if !regexKeyID.MatchString(id) {
+				return Policy{}, fmt.Errorf("invalid trust of %s: malformed key ID %q", k, id)
+			}
+
+			p.Trust[k] = append(p.Trust[k], id)
+		}
+	}
+
+	for _, pp := range pf.Platforms {
+		pp = strings.ToLower(pp)
+		if _, err = path.Match(pp, ""); err != nil || strings.Count(pp, "_") != 1 {
+			return Policy{}, fmt.Errorf("invalid platform pattern %q, must be <OS>_<ARCH>", pp)
+		}
+
+		p.Platforms = append(p.Platforms, pp)
+	}
+
+	return p, nil
+}
+
+// regexKeyID matches the 64-bit GPG key ID in hex.
+var regexKeyID = regexp.MustCompile(`^[0-9A-F]{16}$`)
+
+// Serves returns true if the given provider is served to the given requested host,
+// the unlisted host is served by the * virtual host,
+// and all providers are served if no virtual host is matched.
+func (p Policy) Serves(host string, addr addrs.Address) bool {
+	if len(p.VirtualHosts) == 0 {
+		return true
+	}
+
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	vh, ok := p.VirtualHosts[strings.ToLower(host)]
+	if !ok {
+		vh, ok = p.VirtualHosts["*"]
+	}
+
+	if !ok {
+		return true
+	}
+
+	return vh.Serves(addr)
+}
+
+// ServesPlatform returns true if the given platform is served,
+// all platforms are served if no pattern is specified.
+func (p Policy) ServesPlatform(goos, arch string) bool {
+	if len(p.Platforms) == 0 {
+		return true
+	}
+
+	k := strings.ToLower(goos + "_" + arch)
+
+	for _, pp := range p.Platforms {
+		if ok, _ := path.Match(pp, k); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// QuotaOf returns the disk quota in bytes of the given namespace,
+// the <HOSTNAME>/<NAMESPACE> takes precedence over the <NAMESPACE>,
+// returns false if unlimited.
+func (p Policy) QuotaOf(hostname, namespace string) (uint64, bool) {
+	namespace = strings.ToLower(namespace)
+
+	if q, ok := p.Quotas[strings.ToLower(hostname)+"/"+namespace]; ok {
+		return q, true
+	}
+
+	q, ok := p.Quotas[namespace]
+
+	return q, ok
+}
+
+// EquivalentsOf returns the addresses of the given provider under the equivalent namespaces,
+// returns nil if no equivalent.
+func (p Policy) EquivalentsOf(addr addrs.Address) []addrs.Address {
+	es := p.Equivalents[strings.ToLower(addr.Hostname+"/"+addr.Namespace)]
+	if len(es) == 0 {
+		return nil
+	}
+
+	as := make([]addrs.Address, 0, len(es))
+
+	for _, e := range es {
+		hostname, namespace, _ := strings.Cut(e, "/")
+
+		a := addr
+		a.Hostname, a.Namespace = hostname, namespace
+		as = append(as, a)
+	}
+
+	return as
+}
+
+// TrustedKeysOf returns the GPG key IDs which must sign the given provider,
+// the <HOSTNAME>/<NAMESPACE> takes precedence over the <HOSTNAME>,
+// returns false if the provider is not pinned.
+func (p Policy) TrustedKeysOf(hostname, namespace string) ([]string, bool) {
+	hostname = strings.ToLower(hostname)
+
+	if ids, ok := p.Trust[hostname+"/"+strings.ToLower(namespace)]; ok {
+		return ids, true
+	}
+
+	ids, ok := p.Trust[hostname]
+
+	return ids, ok
+}
@@ -0,0 +1,180 @@
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/seal-io/hermitcrab/pkg/provider/addrs"
+)
+
+func TestPolicy_Serves(t *testing.T) {
+	f := filepath.Join(t.TempDir(), "policy.json")
+	require.NoError(t, os.WriteFile(f, []byte(`{
+  "vhosts": {
+    "TF-Mirror-Prod.corp": {
+      "providers": ["hashicorp/*", "registry.example.com/infra/*"]
+    },
+    "*": {
+      "providers": ["*/*/*"]
+    }
+  }
+}`), 0o600))
+
+	p, err := Load(f)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		host     string
+		addr     string
+		expected bool
+	}{
+		{host: "tf-mirror-prod.corp", addr: "hashicorp/aws", expected: true},
+		{host: "tf-mirror-prod.corp:443", addr: "hashicorp/aws", expected: true},
+		{host: "tf-mirror-prod.corp", addr: "registry.example.com/infra/internal", expected: true},
+		{host: "tf-mirror-prod.corp", addr: "datadog/datadog", expected: false},
+		{host: "tf-mirror-dev.corp", addr: "datadog/datadog", expected: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.host+"/"+tc.addr, func(t *testing.T) {
+			addr, err := addrs.Parse(tc.addr)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, p.Serves(tc.host, addr))
+		})
+	}
+
+	// Serve all without virtual hosts.
+	assert.True(t, Policy{}.Serves("any", addrs.Address{Hostname: "h", Namespace: "n", Type: "t"}))
+}
+
+func TestLoad_invalidVirtualHost(t *testing.T) {
+	f := filepath.Join(t.TempDir(), "policy.json")
+	require.NoError(t, os.WriteFile(f, []byte(`{"vhosts":{"a":{"providers":["[/x"]}}}`), 0o600))
+
+	_, err := Load(f)
+	assert.Error(t, err)
+}
+
+func TestPolicy_EquivalentsOf(t *testing.T) {
+	f := filepath.Join(t.TempDir(), "policy.json")
+	require.NoError(t, os.WriteFile(f, []byte(`{
+  "equivalents": [
+    ["registry.terraform.io/hashicorp", "Registry.OpenTofu.org/hashicorp"]
+  ]
+}`), 0o600))
+
+	p, err := Load(f)
+	require.NoError(t, err)
+
+	addr, err := addrs.Parse("registry.opentofu.org/hashicorp/aws")
+	require.NoError(t, err)
+
+	expected, err := addrs.Parse("registry.terraform.io/hashicorp/aws")
+	require.NoError(t, err)
+
+	assert.Equal(t, []addrs.Address{expected}, p.EquivalentsOf(addr))
+	assert.Equal(t, []addrs.Address{addr}, p.EquivalentsOf(expected))
+	assert.Nil(t, p.EquivalentsOf(addrs.Address{Hostname: "h", Namespace: "n", Type: "t"}))
+}
+
+func TestPolicy_TrustedKeysOf(t *testing.T) {
+	f := filepath.Join(t.TempDir(), "policy.json")
+	require.NoError(t, os.WriteFile(f, []byte(`{
+  "trust": {
+    "Registry.Terraform.io": ["51852d87348ffc4c"],
+    "registry.terraform.io/hashicorp": ["34365D9472D7468F"]
+  }
+}`), 0o600))
+
+	p, err := Load(f)
+	require.NoError(t, err)
+
+	ids, ok := p.TrustedKeysOf("registry.terraform.io", "HashiCorp")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"34365D9472D7468F"}, ids)
+
+	ids, ok = p.TrustedKeysOf("registry.terraform.io", "datadog")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"51852D87348FFC4C"}, ids)
+
+	_, ok = p.TrustedKeysOf("registry.example.com", "infra")
+	assert.False(t, ok)
+
+	// Reject the malformed key ID.
+	require.NoError(t, os.WriteFile(f, []byte(`{"trust":{"registry.terraform.io":["not-a-key"]}}`), 0o600))
+
+	_, err = Load(f)
+	assert.Error(t, err)
+}
+
+func TestPolicy_QuotaOf(t *testing.T) {
+	f := filepath.Join(t.TempDir(), "policy.json")
+	require.NoError(t, os.WriteFile(f, []byte(`{
+  "quotas": {
+    "HashiCorp": "20GiB",
+    "Registry.Terraform.io/DataDog": "5GB",
+    "registry.example.com/hashicorp": "512 MiB"
+  }
+}`), 0o600))
+
+	p, err := Load(f)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		hostname  string
+		namespace string
+		expected  uint64
+		limited   bool
+	}{
+		{hostname: "registry.terraform.io", namespace: "hashicorp", expected: 20 << 30, limited: true},
+		{hostname: "registry.opentofu.org", namespace: "HASHICORP", expected: 20 << 30, limited: true},
+		{hostname: "registry.example.com", namespace: "hashicorp", expected: 512 << 20, limited: true},
+		{hostname: "REGISTRY.terraform.io", namespace: "datadog", expected: 5_000_000_000, limited: true},
+		{hostname: "registry.opentofu.org", namespace: "datadog", limited: false},
+		{hostname: "registry.terraform.io", namespace: "integrations", limited: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.hostname+"/"+tc.namespace, func(t *testing.T) {
+			q, ok := p.QuotaOf(tc.hostname, tc.namespace)
+			assert.Equal(t, tc.limited, ok)
+			assert.Equal(t, tc.expected, q)
+		})
+	}
+
+	// Unlimited without quotas.
+	_, ok := Policy{}.QuotaOf("registry.terraform.io", "hashicorp")
+	assert.False(t, ok)
+
+	// Reject the malformed quota.
+	require.NoError(t, os.WriteFile(f, []byte(`{"quotas":{"hashicorp":"a lot"}}`), 0o600))
+
+	_, err = Load(f)
+	assert.Error(t, err)
+}
+
+func TestPolicy_ServesPlatform(t *testing.T) {
+	assert.True(t, Policy{}.ServesPlatform("windows", "386"))
+
+	f := filepath.Join(t.TempDir(), "policy.json")
+	require.NoError(t, os.WriteFile(f, []byte(`{"platforms":["Linux_*","darwin_arm64"]}`), 0o600))
+
+	p, err := Load(f)
+	require.NoError(t, err)
+
+	assert.True(t, p.ServesPlatform("linux", "amd64"))
+	assert.True(t, p.ServesPlatform("linux", "arm64"))
+	assert.True(t, p.ServesPlatform("darwin", "arm64"))
+	assert.False(t, p.ServesPlatform("darwin", "amd64"))
+	assert.False(t, p.ServesPlatform("windows", "amd64"))
+
+	// Reject the malformed pattern.
+	require.NoError(t, os.WriteFile(f, []byte(`{"platforms":["linux"]}`), 0o600))
+
+	_, err = Load(f)
+	assert.Error(t, err)
+}
@@ -0,0 +1,230 @@
+package addrs
+
+import (
+	"errors"
+	"net"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// DefaultHostname is the hostname of the provider address if omitted.
+const DefaultHostname = "registry.terraform.io"
+
+// Address is the coordinate of a provider,
+// the Version, OS and Arch are optional in order.
+type Address struct {
+	Hostname  string
+	Namespace string
+	Type      string
+	Version   string
+	OS        string
+	Arch      string
+}
+
+// Parse parses the given string to an Address,
+// the string is in form of [<HOSTNAME>/]<NAMESPACE>/<TYPE>[/<VERSION>[/<OS>/<ARCH>]],
+// and the hostname is DefaultHostname if omitted.
+func Parse(s string) (Address, error) {
+	ps := strings.Split(strings.Trim(s, "/"), "/")
+
+	var a Address
+
+	switch len(ps) {
+	case 2:
+		a = Address{Hostname: DefaultHostname, Namespace: ps[0], Type: ps[1]}
+	case 3:
+		a = Address{Hostname: ps[0], Namespace: ps[1], Type: ps[2]}
+	case 4:
+		a = Address{Hostname: ps[0], Namespace: ps[1], Type: ps[2], Version: ps[3]}
+	case 6:
+		a = Address{Hostname: ps[0], Namespace: ps[1], Type: ps[2], Version: ps[3], OS: ps[4], Arch: ps[5]}
+	default:
+		return Address{}, errors.New("invalid provider address: " + s)
+	}
+
+	a = a.Normalize()
+
+	return a, a.Validate()
+}
+
+// Normalize returns the Address with the case-insensitive parts lower-cased,
+// which are the hostname, namespace and type.
+func (a Address) Normalize() Address {
+	a.Hostname = strings.ToLower(a.Hostname)
+	a.Namespace = strings.ToLower(a.Namespace)
+	a.Type = strings.ToLower(a.Type)
+
+	return a
+}
+
+// Validate returns error if the Address is incomplete.
+func (a Address) Validate() error {
+	if a.Hostname == "" || a.Namespace == "" || a.Type == "" {
+		return errors.New("invalid provider address: blank hostname, namespace or type")
+	}
+
+	if (a.OS != "" || a.Arch != "") && (a.Version == "" || a.OS == "" || a.Arch == "") {
+		return errors.New("invalid provider address: incomplete platform")
+	}
+
+	for _, p := range []string{a.Hostname, a.Namespace, a.Type, a.Version, a.OS, a.Arch} {
+		if p == "." || p == ".." || strings.ContainsAny(p, `/\`) {
+			return errors.New("invalid provider address: illegal part " + p)
+		}
+	}
+
+	return nil
+}
+
+// NormalizeHostname returns the normalized form of the given hostname,
+// which is a FQDN or an IP address with an optional port, i.e. registry.terraform.io or localhost:8080,
+// the hostname is lower-cased, the trailing dot and the default port 443 are trimmed,
+// returns error if the hostname is malformed, i.e. carries the path traversal characters.
+func NormalizeHostname(hostname string) (string, error) {
+	invalid := func(reason string) (string, error) {
+		return "", errors.New("invalid hostname " + strconv.Quote(hostname) + ": " + reason)
+	}
+
+	if hostname == "" || len(hostname) > 261 {
+		return invalid("blank or too long")
+	}
+
+	host, port := strings.ToLower(hostname), ""
+
+	if i := strings.LastIndexByte(host, ':'); i >= 0 && !strings.HasSuffix(host, "]") {
+		h, p, err := net.SplitHostPort(host)
+		if err != nil {
+			return invalid("malformed port")
+		}
+
+		if n, err := strconv.ParseUint(p, 10, 16); err != nil || n == 0 {
+			return invalid("illegal port " + p)
+		}
+
+		host, port = h, p
+	}
+
+	// Accept the IP address.
+	if ip := net.ParseIP(strings.Trim(host, "[]")); ip != nil {
+		host = ip.String()
+		if ip.To4() == nil {
+			host = "[" + host + "]"
+		}
+	} else {
+		host = strings.TrimSuffix(host, ".")
+		if host == "" || len(host) > 253 {
+			return invalid("blank or too long")
+		}
+
+		for _, l := range strings.Split(host, ".") {
+			if !isHostnameLabel(l) {
+				return invalid("illegal label " + strconv.Quote(l))
+			}
+		}
+	}
+
+	if port == "" || port == "443" {
+		return host, nil
+	}
+
+	return host + ":" + port, nil
+}
+
+// isHostnameLabel returns true if the given string is a legal label of the hostname,
+// which consists of the letters, digits and hyphens, and neither starts nor ends with a hyphen,
+// the internationalized labels must be in the punycode form.
+func isHostnameLabel(l string) bool {
+	if l == "" || len(l) > 63 || l[0] == '-' || l[len(l)-1] == '-' {
+		return false
+	}
+
+	for i := 0; i < len(l); i++ {
+		c := l[i]
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Typed returns the Address without the version and platform.
+func (a Address) Typed() Address {
+	return Address{Hostname: a.Hostname, Namespace: a.Namespace, Type: a.Type}
+}
+
+// Versioned returns the Address without the platform.
+func (a Address) Versioned() Address {
+	return Address{Hostname: a.Hostname, Namespace: a.Namespace, Type: a.Type, Version: a.Version}
+}
+
+// WithVersion returns the Address with the given version.
+func (a Address) WithVersion(version string) Address {
+	a.Version = version
+	return a
+}
+
+// WithPlatform returns the Address with the given platform.
+func (a Address) WithPlatform(os, arch string) Address {
+	a.OS = os
+	a.Arch = arch
+
+	return a
+}
+
+// String returns the slash separated Address,
+// i.e. registry.terraform.io/hashicorp/aws/5.0.0/linux/amd64.
+func (a Address) String() string {
+	return path.Join(a.Hostname, a.Namespace, a.Type, a.Version, a.OS, a.Arch)
+}
+
+// TypedKey returns the key of the typed provider, i.e. registry.terraform.io/hashicorp/aws.
+func (a Address) TypedKey() string {
+	return path.Join(a.Hostname, a.Namespace, a.Type)
+}
+
+// ParseTypedKey parses the given key of the typed provider to an Address,
+// the key must be in form of <HOSTNAME>/<NAMESPACE>/<TYPE> without any other slash,
+// the hostname can carry a port, i.e. localhost:5000/hashicorp/aws.
+func ParseTypedKey(k string) (Address, error) {
+	ps := strings.Split(k, "/")
+	if len(ps) != 3 {
+		return Address{}, errors.New("invalid typed provider key: " + k)
+	}
+
+	a := Address{Hostname: ps[0], Namespace: ps[1], Type: ps[2]}
+
+	return a, a.Validate()
+}
+
+// PlatformKey returns the key of the platform, i.e. linux/amd64.
+func (a Address) PlatformKey() string {
+	return path.Join(a.OS, a.Arch)
+}
+
+// Dir returns the directory of the typed provider under the given root.
+func (a Address) Dir(root string) string {
+	return filepath.Join(root, a.Hostname, a.Namespace, a.Type)
+}
+
+// ArchiveFilename returns the archive filename of the platform,
+// i.e. terraform-provider-aws_5.0.0_linux_amd64.zip.
+func (a Address) ArchiveFilename() string {
+	return "terraform-provider-" + a.Type + "_" + a.Version + "_" + a.OS + "_" + a.Arch + ".zip"
+}
+
+// LogValues returns the key/value pairs of the non-blank parts for logging.
+func (a Address) LogValues() []any {
+	kvs := []any{"hostname", a.Hostname, "namespace", a.Namespace, "type", a.Type}
+	if a.Version != "" {
+		kvs = append(kvs, "version", a.Version)
+	}
+
+	if a.OS != "" {
+		kvs = append(kvs, "os", a.OS, "arch", a.Arch)
+	}
+
+	return kvs
+}
@@ -0,0 +1,232 @@
+package addrs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	testCases := []struct {
+		given    string
+		expected Address
+		wantErr  bool
+	}{
+		{
+			given:    "hashicorp/aws",
+			expected: Address{Hostname: DefaultHostname, Namespace: "hashicorp", Type: "aws"},
+		},
+		{
+			given:    "/hashicorp/aws/",
+			expected: Address{Hostname: DefaultHostname, Namespace: "hashicorp", Type: "aws"},
+		},
+		{
+			given:    "Registry.Terraform.io/HashiCorp/AWS",
+			expected: Address{Hostname: "registry.terraform.io", Namespace: "hashicorp", Type: "aws"},
+		},
+		{
+			given: "localhost:5000/hashicorp/aws/5.0.0",
+			expected: Address{
+				Hostname: "localhost:5000", Namespace: "hashicorp", Type: "aws", Version: "5.0.0",
+			},
+		},
+		{
+			given: "registry.terraform.io/hashicorp/aws/5.0.0-beta.1/linux/amd64",
+			expected: Address{
+				Hostname: "registry.terraform.io", Namespace: "hashicorp", Type: "aws",
+				Version: "5.0.0-beta.1", OS: "linux", Arch: "amd64",
+			},
+		},
+		{
+			given:   "aws",
+			wantErr: true,
+		},
+		{
+			given:   "registry.terraform.io/hashicorp/aws/5.0.0/linux",
+			wantErr: true,
+		},
+		{
+			given:   "registry.terraform.io/hashicorp/aws/5.0.0/linux/amd64/extra",
+			wantErr: true,
+		},
+		{
+			given:   "registry.terraform.io//aws",
+			wantErr: true,
+		},
+		{
+			given:   "registry.terraform.io/hashicorp/aws/5.0.0//amd64",
+			wantErr: true,
+		},
+		{
+			given:   "registry.terraform.io/hashicorp/aws/../linux/amd64",
+			wantErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.given, func(t *testing.T) {
+			actual, err := Parse(tc.given)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, actual)
+
+			// Round trip.
+			again, err := Parse(actual.String())
+			assert.NoError(t, err)
+			assert.Equal(t, actual, again)
+		})
+	}
+}
+
+func TestAddress_Normalize(t *testing.T) {
+	testCases := []struct {
+		name     string
+		given    Address
+		expected Address
+	}{
+		{
+			name: "lower-cased",
+			given: Address{
+				Hostname: "Registry.Terraform.IO", Namespace: "HashiCorp", Type: "AWS",
+			},
+			expected: Address{
+				Hostname: "registry.terraform.io", Namespace: "hashicorp", Type: "aws",
+			},
+		},
+		{
+			name: "case-sensitive parts kept",
+			given: Address{
+				Hostname: "Example.com", Namespace: "Corp", Type: "Foo",
+				Version: "1.0.0-RC1", OS: "Linux", Arch: "AMD64",
+			},
+			expected: Address{
+				Hostname: "example.com", Namespace: "corp", Type: "foo",
+				Version: "1.0.0-RC1", OS: "Linux", Arch: "AMD64",
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			actual := tc.given.Normalize()
+			assert.Equal(t, tc.expected, actual)
+			assert.Equal(t, actual, actual.Normalize(), "idempotent")
+		})
+	}
+}
+
+func TestAddress_Validate(t *testing.T) {
+	typed := Address{Hostname: DefaultHostname, Namespace: "hashicorp", Type: "aws"}
+
+	testCases := []struct {
+		name     string
+		given    Address
+		expected bool
+	}{
+		{
+			name:     "typed",
+			given:    typed,
+			expected: true,
+		},
+		{
+			name:     "versioned",
+			given:    typed.WithVersion("5.0.0"),
+			expected: true,
+		},
+		{
+			name:     "platform",
+			given:    typed.WithVersion("5.0.0").WithPlatform("linux", "amd64"),
+			expected: true,
+		},
+		{
+			name:     "blank hostname",
+			given:    Address{Namespace: "hashicorp", Type: "aws"},
+			expected: false,
+		},
+		{
+			name:     "blank type",
+			given:    Address{Hostname: DefaultHostname, Namespace: "hashicorp"},
+			expected: false,
+		},
+		{
+			name:     "platform without version",
+			given:    typed.WithPlatform("linux", "amd64"),
+			expected: false,
+		},
+		{
+			name:     "platform without arch",
+			given:    typed.WithVersion("5.0.0").WithPlatform("linux", ""),
+			expected: false,
+		},
+		{
+			name:     "dot dot",
+			given:    typed.WithVersion(".."),
+			expected: false,
+		},
+		{
+			name:     "slash",
+			given:    Address{Hostname: DefaultHostname, Namespace: "hashicorp/aws", Type: "aws"},
+			expected: false,
+		},
+		{
+			name:     "backslash",
+			given:    typed.WithVersion("5.0.0").WithPlatform(`..\linux`, "amd64"),
+			expected: false,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, tc.given.Validate() == nil)
+		})
+	}
+}
+
+func TestParseTypedKey(t *testing.T) {
+	testCases := []struct {
+		given    string
+		expected Address
+		wantErr  bool
+	}{
+		{
+			given:    "registry.terraform.io/hashicorp/aws",
+			expected: Address{Hostname: "registry.terraform.io", Namespace: "hashicorp", Type: "aws"},
+		},
+		{
+			given:    "localhost:5000/hashicorp/aws",
+			expected: Address{Hostname: "localhost:5000", Namespace: "hashicorp", Type: "aws"},
+		},
+		{
+			given:   "hashicorp/aws",
+			wantErr: true,
+		},
+		{
+			given:   "registry.terraform.io/hashicorp/aws/5.0.0",
+			wantErr: true,
+		},
+		{
+			given:   "registry.terraform.io//aws",
+			wantErr: true,
+		},
+		{
+			given:   "registry.terraform.io/../aws",
+			wantErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.given, func(t *testing.T) {
+			actual, err := ParseTypedKey(tc.given)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, actual)
+
+			// Round trip.
+			assert.Equal(t, tc.given, actual.TypedKey())
+		})
+	}
+}
@@ -0,0 +1,27 @@
+package provider
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// CanaryHeader is the header presenting the canary token,
+// alternatively, the canary token can be presented as the bearer token,
+// i.e. TF_TOKEN_<HOST> of terraform.
+const CanaryHeader = "X-Canary-Token"
+
+// IsCanaryClient returns true if the given request presents the canary token,
+// returns false if the canary token is not configured.
+func (s *Service) IsCanaryClient(r *http.Request) bool {
+	if s.CanaryToken == "" || r == nil {
+		return false
+	}
+
+	t := r.Header.Get(CanaryHeader)
+	if t == "" {
+		t, _ = strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	}
+
+	return t != "" && subtle.ConstantTimeCompare([]byte(t), []byte(s.CanaryToken)) == 1
+}
@@ -0,0 +1,319 @@
+package docs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/seal-io/walrus/utils/errorx"
+	"github.com/seal-io/walrus/utils/json"
+	"github.com/seal-io/walrus/utils/log"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/seal-io/hermitcrab/pkg/database"
+	"github.com/seal-io/hermitcrab/pkg/registry"
+	"github.com/seal-io/hermitcrab/pkg/tunable"
+)
+
+// Service holds the operation of the provider documentation.
+// Value always be json.RawBytes, takes a look of the bucket structure:
+//
+//	BUCKET(provider_docs)
+//	  KEY({hostname}/{path}?{canonical query}): struct{
+//	    fetched: string, RFC3339Nano
+//	    data: {...}
+//	  }
+type Service interface {
+	// Get gets the response of the registry v2 API from the cache,
+	// or fetches from the upstream if not cached or expired.
+	Get(context.Context, GetOptions) ([]byte, error)
+}
+
+// GetOptions holds the options of getting the documentation.
+type GetOptions struct {
+	// Hostname is the registry hostname.
+	Hostname string
+	// Path is the path of the registry v2 API,
+	// i.e. providers/hashicorp/aws, provider-versions/12345 and provider-docs/67890.
+	Path string
+	// Query is the query of the registry v2 API,
+	// i.e. filter[provider-version]=12345&filter[category]=resources,
+	// only the include, filter[...] and page[...] parameters are kept.
+	Query url.Values
+}
+
+const domain = "provider_docs"
+
+// DefaultTTL is the default duration of the cached documentation before re-fetching.
+const DefaultTTL = 24 * time.Hour
+
+// DefaultMaxEntries is the default maximum number of the cached documentation.
+const DefaultMaxEntries = 10000
+
+// ServiceOptions holds the options of the documentation service.
+type ServiceOptions struct {
+	// TTL is the duration of the cached documentation before re-fetching,
+	// default is DefaultTTL if not positive.
+	TTL time.Duration
+	// MaxEntries is the maximum number of the cached documentation,
+	// the least recently fetched ones are evicted if exceeding,
+	// default is DefaultMaxEntries if not positive.
+	MaxEntries int
+	// Offline never fetches from the upstream,
+	// only the cached documentation is served.
+	Offline bool
+	// Clock returns the current time, default is time.Now.
+	Clock func() time.Time
+	// Source returns the DocsSource of the given hostname,
+	// default is the one configured in the registry package.
+	Source func(ctx context.Context, hostname string) (registry.DocsSource, error)
+}
+
+// NewService returns a new documentation service.
+func NewService(boltDriver database.BoltDriver, opts ServiceOptions) (Service, error) {
+	err := boltDriver.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(toBytes(domain))
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error creating docs bucket: %w", err)
+	}
+
+	if opts.TTL <= 0 {
+		opts.TTL = DefaultTTL
+	}
+
+	if opts.MaxEntries <= 0 {
+		opts.MaxEntries = DefaultMaxEntries
+	}
+
+	if opts.Clock == nil {
+		opts.Clock = time.Now
+	}
+
+	if opts.Source == nil {
+		opts.Source = func(ctx context.Context, hostname string) (registry.DocsSource, error) {
+			src, err := registry.Host(hostname).Source(ctx)
+			if err != nil {
+				return nil, err
+			}
+
+			ds, ok := src.(registry.DocsSource)
+			if !ok {
+				return nil, registry.ErrUnsupported
+			}
+
+			return ds, nil
+		}
+	}
+
+	return &service{
+		boltDriver: boltDriver,
+		ttl:        opts.TTL,
+		maxEntries: opts.MaxEntries,
+		offline:    opts.Offline,
+		clock:      opts.Clock,
+		source:     opts.Source,
+	}, nil
+}
+
+type service struct {
+	boltDriver database.BoltDriver
+	ttl        time.Duration
+	maxEntries int
+	offline    bool
+	clock      func() time.Time
+	source     func(ctx context.Context, hostname string) (registry.DocsSource, error)
+}
+
+// cached holds the cached documentation.
+type cached struct {
+	Fetched time.Time       `json:"fetched"`
+	Data    json.RawMessage `json:"data"`
+}
+
+func (s *service) Get(ctx context.Context, opts GetOptions) ([]byte, error) {
+	logger := log.WithName("provider").WithName("docs")
+
+	hostname := strings.ToLower(opts.Hostname)
+	p := strings.Trim(opts.Path, "/")
+
+	if hostname == "" || p == "" {
+		return nil, errors.New("invalid options")
+	}
+
+	query := canonicalQuery(opts.Query)
+
+	key := hostname + "/" + p
+	if q := query.Encode(); q != "" {
+		key += "?" + q
+	}
+
+	var c cached
+
+	err := s.boltDriver.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(toBytes(domain)).Get(toBytes(key))
+		if len(data) == 0 {
+			return nil
+		}
+
+		return json.Unmarshal(bytes.Clone(data), &c)
+	})
+	if err != nil {
+		logger.Warnf("error getting cached docs %s: %v", key, err)
+	}
+
+	ttl := tunable.Get().DocsCacheTTL.Std()
+	if ttl <= 0 {
+		ttl = s.ttl
+	}
+
+	if len(c.Data) != 0 && (s.offline || s.clock().Sub(c.Fetched) < ttl) {
+		return c.Data, nil
+	}
+
+	if s.offline {
+		return nil, errorx.HttpErrorf(http.StatusNotFound, "docs %s is not cached in offline mode", key)
+	}
+
+	data, err := s.fetch(ctx, hostname, p, query)
+	if err != nil {
+		if errors.Is(err, registry.ErrDocsNotFound) {
+			return nil, errorx.WrapHttpError(http.StatusNotFound, err, "docs not found")
+		}
+
+		// Serve the expired one if the upstream is unavailable.
+		if len(c.Data) != 0 {
+			logger.Warnf("serving expired docs %s: %v", key, err)
+			return c.Data, nil
+		}
+
+		return nil, errorx.WrapHttpError(http.StatusBadGateway, err, "error fetching docs")
+	}
+
+	err = s.boltDriver.Update(func(tx *bolt.Tx) error {
+		bs, err := json.Marshal(cached{
+			Fetched: s.clock(),
+			Data:    data,
+		})
+		if err != nil {
+			return err
+		}
+
+		b := tx.Bucket(toBytes(domain))
+
+		err = b.Put(toBytes(key), bs)
+		if err != nil {
+			return err
+		}
+
+		return s.evict(b)
+	})
+	if err != nil {
+		logger.Warnf("error caching docs %s: %v", key, err)
+	}
+
+	return data, nil
+}
+
+// evict evicts the least recently fetched documentation if exceeding the maximum entries,
+// a tenth of the maximum entries are evicted additionally to not walk the bucket on every caching.
+func (s *service) evict(b *bolt.Bucket) error {
+	// Count with the cursor as the stats miss the pending changes of the transaction.
+	var n int
+
+	c := b.Cursor()
+	for k, _ := c.First(); k != nil; k, _ = c.Next() {
+		n++
+	}
+
+	if n <= s.maxEntries {
+		return nil
+	}
+
+	type entry struct {
+		key     []byte
+		fetched time.Time
+	}
+
+	var es []entry
+
+	err := b.ForEach(func(k, v []byte) error {
+		var c cached
+		// Evict the malformed one first.
+		_ = json.Unmarshal(v, &c)
+
+		es = append(es, entry{key: bytes.Clone(k), fetched: c.Fetched})
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(es, func(i, j int) bool {
+		return es[i].fetched.Before(es[j].fetched)
+	})
+
+	n = len(es) - s.maxEntries + s.maxEntries/10
+	for i := 0; i < n && i < len(es); i++ {
+		err = b.Delete(es[i].key)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// canonicalQuery returns the query of the registry v2 API sorted in keys and values,
+// only the include, filter[...] and page[...] parameters are kept,
+// so that the arbitrary parameters are neither cached nor forwarded to the upstream.
+func canonicalQuery(query url.Values) url.Values {
+	cq := url.Values{}
+
+	for k, vs := range query {
+		switch {
+		case k == "include":
+		case strings.HasPrefix(k, "filter[") && strings.HasSuffix(k, "]"):
+		case strings.HasPrefix(k, "page[") && strings.HasSuffix(k, "]"):
+		default:
+			continue
+		}
+
+		vs = append([]string(nil), vs...)
+		sort.Strings(vs)
+		cq[k] = vs
+	}
+
+	return cq
+}
+
+// fetch fetches the documentation from the upstream of the given hostname.
+func (s *service) fetch(ctx context.Context, hostname, p string, query url.Values) ([]byte, error) {
+	src, err := s.source(ctx, hostname)
+	if err != nil {
+		return nil, fmt.Errorf("error getting upstream source: %w", err)
+	}
+
+	data, err := src.GetDocs(ctx, p, query)
+	if err != nil {
+		return nil, err
+	}
+
+	if !json.Valid(data) {
+		return nil, errors.New("invalid JSON response")
+	}
+
+	return data, nil
+}
+
+func toBytes(s string) []byte {
+	return []byte(s)
+}
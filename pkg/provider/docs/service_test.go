@@ -0,0 +1,205 @@
+package docs
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/seal-io/hermitcrab/pkg/registry"
+)
+
+func TestService_Get(t *testing.T) {
+	var (
+		hits    atomic.Int32
+		failing atomic.Bool
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+
+		switch {
+		case failing.Load():
+			w.WriteHeader(http.StatusForbidden)
+		case r.URL.Path == "/v2/provider-docs/1":
+			_, _ = w.Write([]byte(`{"data":{"id":"1","attributes":{"content":"# null_resource"}}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "docs.db"), 0o600, nil)
+	require.NoError(t, err)
+
+	defer func() { _ = db.Close() }()
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	svc, err := NewService(db, ServiceOptions{
+		TTL:   time.Hour,
+		Clock: func() time.Time { return now },
+		Source: func(ctx context.Context, hostname string) (registry.DocsSource, error) {
+			src, err := registry.NewUpstreamSource(ctx, registry.Upstream{
+				Hostname: hostname,
+				Kind:     registry.UpstreamKindRegistry,
+				Options: map[string]string{
+					"docs.v2": srv.URL + "/v2/",
+				},
+			})
+			if err != nil {
+				return nil, err
+			}
+
+			return src.(registry.DocsSource), nil
+		},
+	})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	opts := GetOptions{
+		Hostname: "registry.terraform.io",
+		Path:     "provider-docs/1",
+		Query:    url.Values{},
+	}
+
+	// Cached after the first fetch.
+	for i := 0; i < 2; i++ {
+		data, err := svc.Get(ctx, opts)
+		require.NoError(t, err)
+		assert.Contains(t, string(data), "null_resource")
+	}
+
+	assert.Equal(t, int32(1), hits.Load())
+
+	// Serve the expired one if the upstream is unavailable.
+	now = now.Add(2 * time.Hour)
+
+	failing.Store(true)
+
+	data, err := svc.Get(ctx, opts)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "null_resource")
+	assert.Equal(t, int32(2), hits.Load())
+
+	// Not found.
+	failing.Store(false)
+
+	_, err = svc.Get(ctx, GetOptions{
+		Hostname: "registry.terraform.io",
+		Path:     "provider-docs/2",
+	})
+	assert.ErrorIs(t, err, registry.ErrDocsNotFound)
+}
+
+func TestService_Get_query(t *testing.T) {
+	var (
+		hits    atomic.Int32
+		queries = make(chan url.Values, 8)
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		queries <- r.URL.Query()
+
+		_, _ = w.Write([]byte(`{"data":[]}`))
+	}))
+	defer srv.Close()
+
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "docs.db"), 0o600, nil)
+	require.NoError(t, err)
+
+	defer func() { _ = db.Close() }()
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	svc, err := NewService(db, ServiceOptions{
+		TTL:        time.Hour,
+		MaxEntries: 10,
+		Clock:      func() time.Time { return now },
+		Source: func(ctx context.Context, hostname string) (registry.DocsSource, error) {
+			src, err := registry.NewUpstreamSource(ctx, registry.Upstream{
+				Hostname: hostname,
+				Kind:     registry.UpstreamKindRegistry,
+				Options: map[string]string{
+					"docs.v2": srv.URL + "/v2/",
+				},
+			})
+			if err != nil {
+				return nil, err
+			}
+
+			return src.(registry.DocsSource), nil
+		},
+	})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+
+	// Drop the unknown parameters, and share the cache regardless of the order.
+	_, err = svc.Get(ctx, GetOptions{
+		Hostname: "registry.terraform.io",
+		Path:     "provider-docs",
+		Query: url.Values{
+			"filter[provider-version]": {"1"},
+			"filter[category]":         {"resources", "data-sources"},
+			"page[size]":               {"10"},
+			"cache-buster":             {"1"},
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, url.Values{
+		"filter[provider-version]": {"1"},
+		"filter[category]":         {"data-sources", "resources"},
+		"page[size]":               {"10"},
+	}, <-queries)
+
+	_, err = svc.Get(ctx, GetOptions{
+		Hostname: "registry.terraform.io",
+		Path:     "provider-docs",
+		Query: url.Values{
+			"page[size]":               {"10"},
+			"filter[category]":         {"data-sources", "resources"},
+			"filter[provider-version]": {"1"},
+			"cache-buster":             {"2"},
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), hits.Load())
+
+	// Evict the least recently fetched ones if exceeding the maximum entries.
+	for i := 2; i <= 11; i++ {
+		now = now.Add(time.Second)
+
+		_, err = svc.Get(ctx, GetOptions{
+			Hostname: "registry.terraform.io",
+			Path:     "provider-docs",
+			Query:    url.Values{"filter[provider-version]": {strconv.Itoa(i)}},
+		})
+		require.NoError(t, err)
+		<-queries
+	}
+
+	err = db.View(func(tx *bolt.Tx) error {
+		assert.Equal(t, 9, tx.Bucket(toBytes(domain)).Stats().KeyN)
+		return nil
+	})
+	require.NoError(t, err)
+
+	_, err = svc.Get(ctx, GetOptions{
+		Hostname: "registry.terraform.io",
+		Path:     "provider-docs",
+		Query:    url.Values{"filter[provider-version]": {"1"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int32(12), hits.Load())
+}
@@ -0,0 +1,300 @@
+package drift
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/seal-io/walrus/utils/log"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"github.com/seal-io/hermitcrab/pkg/download"
+	"github.com/seal-io/hermitcrab/pkg/provider"
+	"github.com/seal-io/hermitcrab/pkg/provider/addrs"
+	"github.com/seal-io/hermitcrab/pkg/provider/metadata"
+	"github.com/seal-io/hermitcrab/pkg/provider/storage"
+)
+
+// DefaultPopularPlatforms holds the platforms expected to be cached,
+// along with any cached archive of the same version.
+var DefaultPopularPlatforms = []string{
+	"linux_amd64",
+	"linux_arm64",
+	"darwin_amd64",
+	"darwin_arm64",
+	"windows_amd64",
+}
+
+type (
+	// Options holds the options of checking the drift.
+	Options struct {
+		// Verify verifies the sha256 checksum of the cached archives,
+		// which reads all cached archives.
+		Verify bool
+		// Repair removes the orphaned and mismatched archives,
+		// and fetches the missing and mismatched archives.
+		Repair bool
+		// PopularPlatforms holds the platforms in form of <OS>_<ARCH>,
+		// default is the platforms observed from the clients if inferred,
+		// otherwise, DefaultPopularPlatforms.
+		PopularPlatforms []string
+	}
+
+	// Report holds the drift between the metadata and the cached archives.
+	Report struct {
+		// Orphaned holds the cached archives without metadata.
+		Orphaned []Archive `json:"orphaned"`
+		// Missing holds the archives of the popular platforms listed in the metadata but not cached,
+		// only the versions with cached archives are counted.
+		Missing []Archive `json:"missing"`
+		// Mismatched holds the cached archives which are empty or mismatch the checksum of the metadata.
+		Mismatched []Archive `json:"mismatched"`
+		// Repaired is true if the drift has been repaired.
+		Repaired bool `json:"repaired"`
+	}
+
+	// Archive holds the information of a drifted archive.
+	Archive struct {
+		Hostname  string `json:"hostname"`
+		Namespace string `json:"namespace"`
+		Type      string `json:"type"`
+		Filename  string `json:"filename"`
+		// Reason is the reason of the mismatch.
+		Reason string `json:"reason,omitempty"`
+		// Error is the error of repairing.
+		Error string `json:"error,omitempty"`
+	}
+)
+
+// Drifted returns true if any drift is found.
+func (r Report) Drifted() bool {
+	return len(r.Orphaned) != 0 || len(r.Missing) != 0 || len(r.Mismatched) != 0
+}
+
+// Check cross-checks the metadata against the cached archives,
+// and repairs the drift if required.
+func Check(ctx context.Context, s *provider.Service, opts Options) (Report, error) {
+	// Rank the platforms by the requests observed from the clients.
+	ranks := map[string]int{}
+	for i, p := range s.ObservedPlatforms() {
+		ranks[p.Platform] = i
+	}
+
+	popular := sets.New(opts.PopularPlatforms...)
+	if popular.Len() == 0 {
+		for p := range ranks {
+			popular.Insert(p)
+		}
+	}
+
+	if popular.Len() == 0 {
+		popular.Insert(DefaultPopularPlatforms...)
+	}
+
+	var (
+		platforms = map[archiveKey]metadata.Platform{}
+		addresses = map[archiveKey]addrs.Address{}
+	)
+
+	err := s.Metadata.WalkPlatforms(ctx, func(addr addrs.Address, p metadata.Platform) error {
+		k := archiveKey{typed: addr.TypedKey(), filename: p.Filename}
+		platforms[k] = p
+		addresses[k] = addr
+
+		return nil
+	})
+	if err != nil {
+		return Report{}, fmt.Errorf("error walking platforms: %w", err)
+	}
+
+	var (
+		r = Report{
+			Orphaned:   []Archive{},
+			Missing:    []Archive{},
+			Mismatched: []Archive{},
+		}
+		cached  = sets.New[archiveKey]()
+		touched = sets.New[string]()
+	)
+
+	err = s.Storage.WalkArchives(ctx, func(a storage.StoredArchive) error {
+		k := archiveKey{typed: a.Address().TypedKey(), filename: a.Filename}
+		cached.Insert(k)
+
+		p, ok := platforms[k]
+		if !ok {
+			r.Orphaned = append(r.Orphaned, archiveOf(a.Address(), a.Filename))
+			return nil
+		}
+
+		touched.Insert(addresses[k].Versioned().String())
+
+		if reason := mismatch(a.Path, p.Shasum, opts.Verify); reason != "" {
+			ar := archiveOf(a.Address(), a.Filename)
+			ar.Reason = reason
+			r.Mismatched = append(r.Mismatched, ar)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return Report{}, fmt.Errorf("error walking archives: %w", err)
+	}
+
+	for k, addr := range addresses {
+		if cached.Has(k) ||
+			!touched.Has(addr.Versioned().String()) ||
+			!popular.Has(addr.OS+"_"+addr.Arch) {
+			continue
+		}
+
+		r.Missing = append(r.Missing, archiveOf(addr, k.filename))
+	}
+
+	// Fetch the missing archives of the most requested platforms first.
+	rank := func(a Archive) int {
+		addr := addresses[a.key()]
+		if n, ok := ranks[addr.OS+"_"+addr.Arch]; ok {
+			return n
+		}
+
+		return len(ranks)
+	}
+
+	sort.Slice(r.Missing, func(i, j int) bool {
+		if ri, rj := rank(r.Missing[i]), rank(r.Missing[j]); ri != rj {
+			return ri < rj
+		}
+
+		return r.Missing[i].key().less(r.Missing[j].key())
+	})
+
+	if opts.Repair && r.Drifted() {
+		repair(ctx, s, &r, addresses)
+	}
+
+	return r, nil
+}
+
+// mismatch returns the reason if the archive of the given path mismatches the given shasum,
+// the checksum is only verified if required.
+func mismatch(p, shasum string, verify bool) string {
+	fi, err := os.Stat(p)
+	if err != nil {
+		return err.Error()
+	}
+
+	if fi.Size() == 0 {
+		return "empty archive"
+	}
+
+	if !verify || shasum == "" {
+		return ""
+	}
+
+	ok, err := download.ValidateShasum(p, shasum)
+	if err != nil {
+		return err.Error()
+	}
+
+	if !ok {
+		return "checksum mismatch"
+	}
+
+	return ""
+}
+
+// repair removes the orphaned and mismatched archives, and fetches the missing and mismatched archives,
+// the error of each archive is recorded in the report.
+func repair(ctx context.Context, s *provider.Service, r *Report, addresses map[archiveKey]addrs.Address) {
+	logger := log.WithName("provider").WithName("drift")
+
+	for _, as := range [][]Archive{r.Orphaned, r.Mismatched} {
+		for i := range as {
+			err := s.Storage.DeleteArchives(ctx, storage.DeleteArchivesOptions{
+				Address:  as[i].Address(),
+				Filename: as[i].Filename,
+				Reason:   storage.EvictionReasonDrift,
+			})
+			if err != nil {
+				as[i].Error = err.Error()
+				logger.Warnf("error removing drifted archive %s: %v", as[i].Filename, err)
+			}
+		}
+	}
+
+	// Fetch the missing archives and the removed mismatched archives.
+	for _, as := range [][]Archive{r.Missing, r.Mismatched} {
+		for i := range as {
+			if as[i].Error != "" {
+				continue
+			}
+
+			err := fetch(ctx, s, addresses[as[i].key()])
+			if err != nil {
+				as[i].Error = err.Error()
+				logger.Warnf("error fetching archive %s: %v", as[i].Filename, err)
+			}
+		}
+	}
+
+	r.Repaired = true
+}
+
+// fetch fetches the archive of the given platform address into the storage.
+func fetch(ctx context.Context, s *provider.Service, addr addrs.Address) error {
+	p, err := s.Metadata.GetPlatform(ctx, metadata.GetPlatformOptions(addr))
+	if err != nil {
+		return err
+	}
+
+	// Give way to the interactive downloads.
+	ctx = download.WithPriority(ctx, download.PriorityBackground)
+
+	ar, err := s.Storage.LoadArchive(ctx, storage.LoadArchiveOptions{
+		Hostname:    addr.Hostname,
+		Namespace:   addr.Namespace,
+		Type:        addr.Type,
+		Filename:    p.Filename,
+		Shasum:      p.Shasum,
+		DownloadURL: p.DownloadURL,
+	})
+	if err != nil {
+		return err
+	}
+
+	return ar.Close()
+}
+
+// archiveKey indexes the archive by the typed provider and the filename.
+type archiveKey struct {
+	typed    string
+	filename string
+}
+
+// Address returns the typed provider address of the archive.
+func (a Archive) Address() addrs.Address {
+	return addrs.Address{
+		Hostname:  a.Hostname,
+		Namespace: a.Namespace,
+		Type:      a.Type,
+	}
+}
+
+func (k archiveKey) less(o archiveKey) bool {
+	return k.typed < o.typed || k.typed == o.typed && k.filename < o.filename
+}
+
+func (a Archive) key() archiveKey {
+	return archiveKey{typed: a.Address().TypedKey(), filename: a.Filename}
+}
+
+func archiveOf(addr addrs.Address, filename string) Archive {
+	return Archive{
+		Hostname:  addr.Hostname,
+		Namespace: addr.Namespace,
+		Type:      addr.Type,
+		Filename:  filename,
+	}
+}
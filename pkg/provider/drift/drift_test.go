@@ -0,0 +1,90 @@
+package drift
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/seal-io/hermitcrab/pkg/provider"
+	"github.com/seal-io/hermitcrab/pkg/provider/addrs"
+	"github.com/seal-io/hermitcrab/pkg/provider/metadata"
+	"github.com/seal-io/hermitcrab/pkg/provider/storage"
+)
+
+// fakeMetadata serves the stored platforms only.
+type fakeMetadata struct {
+	metadata.Service
+
+	platforms []addrs.Address
+}
+
+func (f fakeMetadata) WalkPlatforms(_ context.Context, fn func(addrs.Address, metadata.Platform) error) error {
+	for _, addr := range f.platforms {
+		err := fn(addr, metadata.Platform{
+			OS:       addr.OS,
+			Arch:     addr.Arch,
+			Filename: addr.ArchiveFilename(),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func TestCheck(t *testing.T) {
+	dir := t.TempDir()
+
+	ss, err := storage.NewService(dir, storage.ServiceOptions{})
+	require.NoError(t, err)
+
+	addr := addrs.Address{
+		Hostname:  "registry.terraform.io",
+		Namespace: "hashicorp",
+		Type:      "null",
+	}
+
+	s := &provider.Service{
+		Metadata: fakeMetadata{
+			platforms: []addrs.Address{
+				addr.WithVersion("1.0.0").WithPlatform("linux", "amd64"),
+				addr.WithVersion("1.0.0").WithPlatform("darwin", "arm64"),
+				addr.WithVersion("1.0.0").WithPlatform("freebsd", "amd64"),
+				addr.WithVersion("2.0.0").WithPlatform("linux", "amd64"),
+			},
+		},
+		Storage: ss,
+	}
+
+	typedDir := addr.Dir(filepath.Join(dir, "providers"))
+	require.NoError(t, os.MkdirAll(typedDir, 0o700))
+
+	for fn, content := range map[string]string{
+		"terraform-provider-null_1.0.0_linux_amd64.zip":   "",
+		"terraform-provider-null_0.9.0_linux_amd64.zip":   "orphaned",
+		".terraform-provider-null_1.0.0_darwin_arm64.zip": "downloading",
+	} {
+		require.NoError(t, os.WriteFile(filepath.Join(typedDir, fn), []byte(content), 0o600))
+	}
+
+	r, err := Check(context.Background(), s, Options{})
+	require.NoError(t, err)
+
+	assert.True(t, r.Drifted())
+	assert.Equal(t, []Archive{archiveOf(addr, "terraform-provider-null_0.9.0_linux_amd64.zip")}, r.Orphaned)
+	assert.Equal(t, []Archive{{
+		Hostname:  addr.Hostname,
+		Namespace: addr.Namespace,
+		Type:      addr.Type,
+		Filename:  "terraform-provider-null_1.0.0_linux_amd64.zip",
+		Reason:    "empty archive",
+	}}, r.Mismatched)
+	// The unpopular platform and the version without cached archives are not missing.
+	assert.Equal(t, []Archive{archiveOf(addr, "terraform-provider-null_1.0.0_darwin_arm64.zip")}, r.Missing)
+	assert.False(t, r.Repaired)
+}
@@ -0,0 +1,297 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/seal-io/walrus/utils/gopool"
+	"github.com/seal-io/walrus/utils/json"
+	"github.com/seal-io/walrus/utils/log"
+	"github.com/seal-io/walrus/utils/version"
+	"go.uber.org/multierr"
+
+	"github.com/seal-io/hermitcrab/pkg/download"
+	"github.com/seal-io/hermitcrab/pkg/events"
+	"github.com/seal-io/hermitcrab/pkg/provider/addrs"
+	"github.com/seal-io/hermitcrab/pkg/provider/metadata"
+	"github.com/seal-io/hermitcrab/pkg/provider/storage"
+	"github.com/seal-io/hermitcrab/pkg/registry"
+)
+
+// replicaConcurrency is the maximum number of archives publishing at the same time.
+const replicaConcurrency = 4
+
+// replicaTimeout is the timeout of publishing an archive to a downstream instance.
+const replicaTimeout = 30 * time.Minute
+
+// adminPaths are the paths of the admin APIs of the downstream instances in preference,
+// the downstream instances serving the admin APIs only under /v1 respond 404 to the /v2 ones.
+var adminPaths = []string{"v2/admin", "v1/admin"}
+
+// statusError holds the unexpected status responded by a downstream instance.
+type statusError struct {
+	Status  int
+	Message string
+}
+
+func (e statusError) Error() string {
+	return fmt.Sprintf("unexpected status %d: %s", e.Status, e.Message)
+}
+
+type ReplicaOptions struct {
+	// Targets are the base URLs of the downstream instances,
+	// i.e. https://edge.example.com,
+	// the admin token of a downstream instance is configured as the token of its hostname.
+	Targets []string
+	// InsecureSkipVerify skips verifying the certificates of the downstream instances,
+	// which exposes the admin tokens to the interceptors, only for testing.
+	InsecureSkipVerify bool
+}
+
+// Replica publishes the newly cached provider archives along with their platforms
+// to the downstream instances via the admin publish API,
+// so that the edge mirrors in the restricted segments stay warm.
+type Replica struct {
+	targets  []url.URL
+	client   *http.Client
+	metadata metadata.Service
+	storage  storage.Service
+	sem      chan struct{}
+}
+
+func NewReplica(metadataService metadata.Service, storageService storage.Service, opts ReplicaOptions) (*Replica, error) {
+	hopts := []download.HttpClientOption{
+		download.WithUserAgent(version.GetUserAgentWith("hermitcrab")),
+	}
+	if opts.InsecureSkipVerify {
+		hopts = append(hopts, download.WithInsecureSkipVerify())
+	}
+
+	r := &Replica{
+		targets:  make([]url.URL, 0, len(opts.Targets)),
+		client:   download.NewHttpClient(hopts...),
+		metadata: metadataService,
+		storage:  storageService,
+		sem:      make(chan struct{}, replicaConcurrency),
+	}
+
+	for _, t := range opts.Targets {
+		u, err := url.Parse(t)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid target %q: must be an absolute HTTP(S) URL", t)
+		}
+
+		r.targets = append(r.targets, *u)
+	}
+
+	return r, nil
+}
+
+// Run publishes the archives once cached until the given context is done.
+func (r *Replica) Run(ctx context.Context) {
+	for ev := range events.Subscribe(ctx) {
+		if ev.Type != events.TypeDownloadFinished {
+			continue
+		}
+
+		dev, ok := ev.Data.(storage.DownloadEvent)
+		if !ok || dev.Error != "" {
+			continue
+		}
+
+		gopool.Go(func() {
+			r.sem <- struct{}{}
+			defer func() { <-r.sem }()
+
+			addr := addrs.Address{
+				Hostname:  dev.Hostname,
+				Namespace: dev.Namespace,
+				Type:      dev.Type,
+			}
+
+			err := r.Replicate(ctx, addr, dev.Filename)
+			if err != nil {
+				log.WithName("provider").WithName("export").
+					WithValues(addr.LogValues()...).
+					Warnf("error replicating %s: %v", dev.Filename, err)
+			}
+		})
+	}
+}
+
+// Replicate publishes the cached archive of the given typed provider and filename to all downstream instances.
+func (r *Replica) Replicate(ctx context.Context, addr addrs.Address, filename string) error {
+	v, os, arch, ok := registry.ParseArchiveFilename(addr.Type, filename)
+	if !ok {
+		return nil
+	}
+
+	pa := addr.WithVersion(v).WithPlatform(os, arch)
+
+	p, err := r.metadata.GetPlatform(ctx, metadata.GetPlatformOptions(pa))
+	if err != nil {
+		return fmt.Errorf("error getting platform: %w", err)
+	}
+
+	if p.Shasum == "" {
+		return errors.New("unknown checksum")
+	}
+
+	vs, err := r.metadata.GetVersions(ctx, metadata.GetVersionsOptions{
+		Hostname:  addr.Hostname,
+		Namespace: addr.Namespace,
+		Type:      addr.Type,
+	})
+	if err != nil {
+		return fmt.Errorf("error getting versions: %w", err)
+	}
+
+	var protocols []string
+
+	for i := range vs {
+		if vs[i].Version == v {
+			protocols = vs[i].Protocols
+			break
+		}
+	}
+
+	for i := range r.targets {
+		err = multierr.Append(err, r.publish(ctx, r.targets[i], pa, protocols, p))
+	}
+
+	return err
+}
+
+// publish publishes the archive and then the platform to the given downstream instance,
+// falls back to the older admin APIs if the downstream instance does not serve the newer ones.
+func (r *Replica) publish(
+	ctx context.Context,
+	target url.URL,
+	addr addrs.Address,
+	protocols []string,
+	p metadata.Platform,
+) error {
+	ctx, cancel := context.WithTimeout(ctx, replicaTimeout)
+	defer cancel()
+
+	var err error
+
+	for _, ap := range adminPaths {
+		err = r.publishVia(ctx, target, ap, addr, protocols, p)
+
+		var se statusError
+		if !errors.As(err, &se) || se.Status != http.StatusNotFound {
+			return err
+		}
+
+		log.WithName("provider").WithName("export").
+			WithValues(addr.LogValues()...).
+			Debugf("admin APIs under /%s are not served by %s, falling back", ap, target.Host)
+	}
+
+	return err
+}
+
+// publishVia publishes the archive and then the platform to the given downstream instance
+// via the admin APIs of the given path,
+// so that the downstream never advertises the platform without the archive.
+func (r *Replica) publishVia(
+	ctx context.Context,
+	target url.URL,
+	adminPath string,
+	addr addrs.Address,
+	protocols []string,
+	p metadata.Platform,
+) error {
+	ar, err := r.storage.LoadArchive(ctx, storage.LoadArchiveOptions{
+		Hostname:    addr.Hostname,
+		Namespace:   addr.Namespace,
+		Type:        addr.Type,
+		Filename:    p.Filename,
+		Shasum:      p.Shasum,
+		DownloadURL: p.DownloadURL,
+	})
+	if err != nil {
+		return fmt.Errorf("error loading archive: %w", err)
+	}
+
+	defer func() { _ = ar.Reader.Close() }()
+
+	err = r.do(ctx, target, http.MethodPut,
+		path.Join(adminPath, "publish/providers", addr.TypedKey(), "archives", p.Filename),
+		ar.Reader, ar.ContentLength, map[string]string{
+			"Content-Type":      "application/octet-stream",
+			"X-Checksum-Sha256": p.Shasum,
+		})
+	if err != nil {
+		return fmt.Errorf("error publishing archive to %s: %w", target.Host, err)
+	}
+
+	bs, err := json.Marshal(map[string]any{
+		"protocols": protocols,
+		"platform":  p,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = r.do(ctx, target, http.MethodPost,
+		path.Join(adminPath, "publish/providers", addr.TypedKey(), "versions", addr.Version),
+		bytes.NewReader(bs), int64(len(bs)), map[string]string{
+			"Content-Type": "application/json",
+		})
+	if err != nil {
+		return fmt.Errorf("error publishing platform to %s: %w", target.Host, err)
+	}
+
+	return nil
+}
+
+// do sends the request of the given method and path to the given downstream instance.
+func (r *Replica) do(
+	ctx context.Context,
+	target url.URL,
+	method, p string,
+	body io.Reader,
+	size int64,
+	headers map[string]string,
+) error {
+	target.Path = path.Join("/", target.Path, p)
+
+	req, err := http.NewRequestWithContext(ctx, method, target.String(), body)
+	if err != nil {
+		return err
+	}
+
+	req.ContentLength = size
+
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	if t := registry.Token(target.Host); t != "" {
+		req.Header.Set("Authorization", "Bearer "+t)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return statusError{Status: resp.StatusCode, Message: strings.TrimSpace(string(msg))}
+	}
+
+	return nil
+}
@@ -0,0 +1,93 @@
+package export
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/seal-io/hermitcrab/pkg/provider/addrs"
+	"github.com/seal-io/hermitcrab/pkg/provider/metadata"
+	"github.com/seal-io/hermitcrab/pkg/provider/storage"
+)
+
+func TestReplica_do_verify(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	t.Cleanup(ts.Close)
+
+	u, err := url.Parse(ts.URL)
+	require.NoError(t, err)
+
+	r, err := NewReplica(nil, nil, ReplicaOptions{Targets: []string{ts.URL}})
+	require.NoError(t, err)
+
+	err = r.do(context.Background(), *u, http.MethodGet, "v2/admin/publish", nil, 0, nil)
+	assert.ErrorContains(t, err, "certificate", "should verify the certificate by default")
+
+	r, err = NewReplica(nil, nil, ReplicaOptions{Targets: []string{ts.URL}, InsecureSkipVerify: true})
+	require.NoError(t, err)
+
+	err = r.do(context.Background(), *u, http.MethodGet, "v2/admin/publish", nil, 0, nil)
+	assert.NoError(t, err)
+}
+
+func TestReplica_publish_fallback(t *testing.T) {
+	var paths []string
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.Method+" "+r.URL.Path)
+
+		// Serve the admin APIs only under /v1.
+		if strings.HasPrefix(r.URL.Path, "/v2/") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		_, _ = io.Copy(io.Discard, r.Body)
+	}))
+	t.Cleanup(ts.Close)
+
+	u, err := url.Parse(ts.URL)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+
+	ss, err := storage.NewService(dir, storage.ServiceOptions{})
+	require.NoError(t, err)
+
+	addr := addrs.Address{
+		Hostname:  "registry.terraform.io",
+		Namespace: "hashicorp",
+		Type:      "null",
+		Version:   "1.0.0",
+		OS:        "linux",
+		Arch:      "amd64",
+	}
+
+	typedDir := addr.Dir(filepath.Join(dir, "providers"))
+	require.NoError(t, os.MkdirAll(typedDir, 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(typedDir, addr.ArchiveFilename()), []byte("archive"), 0o600))
+
+	r, err := NewReplica(nil, ss, ReplicaOptions{Targets: []string{ts.URL}})
+	require.NoError(t, err)
+
+	err = r.publish(context.Background(), *u, addr, []string{"5.0"}, metadata.Platform{
+		Filename: addr.ArchiveFilename(),
+		// The sha256 checksum of "archive".
+		Shasum: "0eb3e36bfb24dcd9bb1d1bece1531216b59539a8fde17ee80224af0653c92aa3",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"PUT /v2/admin/publish/providers/registry.terraform.io/hashicorp/null/archives/" + addr.ArchiveFilename(),
+		"PUT /v1/admin/publish/providers/registry.terraform.io/hashicorp/null/archives/" + addr.ArchiveFilename(),
+		"POST /v1/admin/publish/providers/registry.terraform.io/hashicorp/null/versions/1.0.0",
+	}, paths)
+}
@@ -0,0 +1,195 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/seal-io/walrus/utils/json"
+	"github.com/seal-io/walrus/utils/log"
+
+	"github.com/seal-io/hermitcrab/pkg/download"
+	"github.com/seal-io/hermitcrab/pkg/oci"
+	"github.com/seal-io/hermitcrab/pkg/provider/addrs"
+	"github.com/seal-io/hermitcrab/pkg/provider/storage"
+	"github.com/seal-io/hermitcrab/pkg/registry"
+)
+
+type OCIOptions struct {
+	// Registry is the host of the target OCI registry.
+	Registry string
+	// Repository is the repository prefix of the target OCI registry,
+	// the provider is exported to <REPOSITORY>/<HOSTNAME>/<NAMESPACE>/terraform-provider-<TYPE>.
+	Repository string
+	// PlainHTTP accesses the target OCI registry with HTTP.
+	PlainHTTP bool
+	// Credential is the credential of the target OCI registry.
+	Credential string
+}
+
+// OCI publishes the cached provider archives as OCI artifacts,
+// each version is tagged with the archives as the layers,
+// which can be consumed by the OCI upstream source or `oras pull`.
+type OCI struct {
+	client     *oci.Client
+	repository string
+	storage    storage.Service
+
+	digests sync.Map
+}
+
+func NewOCI(storageService storage.Service, opts OCIOptions) *OCI {
+	return &OCI{
+		client: oci.NewClient(opts.Registry, oci.ClientOptions{
+			PlainHTTP:  opts.PlainHTTP,
+			Credential: opts.Credential,
+		}),
+		repository: strings.Trim(opts.Repository, "/"),
+		storage:    storageService,
+	}
+}
+
+// Export exports all cached provider archives.
+func (e *OCI) Export(ctx context.Context) error {
+	logger := log.WithName("provider").WithName("export")
+
+	arts := map[addrs.Address][]storage.StoredArchive{}
+
+	err := e.storage.WalkArchives(ctx, func(a storage.StoredArchive) error {
+		v, _, _, ok := registry.ParseArchiveFilename(a.Type, a.Filename)
+		if !ok {
+			return nil
+		}
+
+		k := a.Address().WithVersion(v)
+		arts[k] = append(arts[k], a)
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error walking archives: %w", err)
+	}
+
+	for k, as := range arts {
+		err = e.export(ctx, k, as)
+		if err != nil {
+			logger.Errorf("error exporting %s: %v", k, err)
+		}
+	}
+
+	return nil
+}
+
+func (e *OCI) export(ctx context.Context, k addrs.Address, as []storage.StoredArchive) error {
+	repo := path.Join(e.repository, k.Hostname, k.Namespace, "terraform-provider-"+k.Type)
+
+	sort.Slice(as, func(i, j int) bool {
+		return as[i].Filename < as[j].Filename
+	})
+
+	m := oci.Manifest{
+		SchemaVersion: 2,
+		MediaType:     oci.MediaTypeImageManifest,
+		ArtifactType:  oci.ArtifactTypeProvider,
+		Config:        oci.DescriptorEmptyJSON,
+		Layers:        make([]oci.Descriptor, 0, len(as)),
+	}
+
+	for i := range as {
+		d, err := e.describe(as[i])
+		if err != nil {
+			return err
+		}
+
+		m.Layers = append(m.Layers, d)
+	}
+
+	// Skip if the tag is up-to-date.
+	bs, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256(bs)
+
+	d, err := e.client.GetManifestDigest(ctx, repo, k.Version)
+	if err != nil {
+		return err
+	}
+
+	if d == "sha256:"+hex.EncodeToString(sum[:]) {
+		return nil
+	}
+
+	err = e.client.PushBlob(ctx, repo, m.Config, func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader([]byte(`{}`))), nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for i := range as {
+		p := as[i].Path
+
+		err = e.client.PushBlob(ctx, repo, m.Layers[i], func() (io.ReadCloser, error) {
+			return os.Open(p)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return e.client.PutManifest(ctx, repo, k.Version, m)
+}
+
+type describedArchive struct {
+	size       int64
+	modified   time.Time
+	descriptor oci.Descriptor
+}
+
+// describe returns the layer descriptor of the given archive,
+// the digest is cached until the archive is modified.
+func (e *OCI) describe(a storage.StoredArchive) (oci.Descriptor, error) {
+	fi, err := os.Stat(a.Path)
+	if err != nil {
+		return oci.Descriptor{}, err
+	}
+
+	if v, ok := e.digests.Load(a.Path); ok {
+		if da := v.(describedArchive); da.size == fi.Size() && da.modified.Equal(fi.ModTime()) {
+			return da.descriptor, nil
+		}
+	}
+
+	sum, err := download.Shasum(a.Path)
+	if err != nil {
+		return oci.Descriptor{}, err
+	}
+
+	d := oci.Descriptor{
+		MediaType: oci.MediaTypeProviderArchive,
+		Digest:    "sha256:" + sum,
+		Size:      fi.Size(),
+		Annotations: map[string]string{
+			oci.AnnotationTitle: a.Filename,
+		},
+	}
+
+	e.digests.Store(a.Path, describedArchive{
+		size:       fi.Size(),
+		modified:   fi.ModTime(),
+		descriptor: d,
+	})
+
+	return d, nil
+}
@@ -0,0 +1,114 @@
+package metadata
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// The kinds of the sync activities.
+const (
+	// SyncKindAll syncs the versions of all stored providers.
+	SyncKindAll = "all"
+	// SyncKindVersions syncs the versions of a provider.
+	SyncKindVersions = "versions"
+	// SyncKindPlatforms syncs all platforms of a provider version.
+	SyncKindPlatforms = "platforms"
+	// SyncKindPlatform syncs a platform of a provider version.
+	SyncKindPlatform = "platform"
+)
+
+// syncAllScope is the scope of syncing all stored providers,
+// which never conflicts with the scope of a provider.
+const syncAllScope = "*"
+
+// SyncActivity holds an ongoing synchronization.
+type SyncActivity struct {
+	Kind    string    `json:"kind"`
+	Scope   string    `json:"scope"`
+	Started time.Time `json:"started"`
+}
+
+// fullSync is the ongoing synchronization of all stored providers,
+// which the overlapping Sync calls join instead of starting another one.
+type fullSync struct {
+	done chan struct{}
+	err  error
+}
+
+// beginSync marks the given scope syncing,
+// returns false if the scope is already syncing,
+// otherwise, returns the function to end the syncing.
+func (s *service) beginSync(kind, scope string) (func(), bool) {
+	_, syncing := s.syncing.LoadOrStore(scope, SyncActivity{
+		Kind:    kind,
+		Scope:   scope,
+		Started: time.Now(),
+	})
+	if syncing {
+		return nil, false
+	}
+
+	return func() { s.syncing.Delete(scope) }, true
+}
+
+func (s *service) isSyncing(scope string) bool {
+	_, syncing := s.syncing.Load(scope)
+	return syncing
+}
+
+func (s *service) GetSyncActivities(_ context.Context) []SyncActivity {
+	as := make([]SyncActivity, 0)
+
+	s.syncing.Range(func(_, v any) bool {
+		as = append(as, v.(SyncActivity))
+		return true
+	})
+
+	sort.Slice(as, func(i, j int) bool {
+		if !as[i].Started.Equal(as[j].Started) {
+			return as[i].Started.Before(as[j].Started)
+		}
+
+		return as[i].Scope < as[j].Scope
+	})
+
+	return as
+}
+
+// joinSync runs the given function as the synchronization of all stored providers,
+// or waits for the ongoing one and returns its result.
+func (s *service) joinSync(ctx context.Context, fn func(context.Context) error) error {
+	s.fullMu.Lock()
+
+	if f := s.full; f != nil {
+		s.fullMu.Unlock()
+
+		select {
+		case <-f.done:
+			return f.err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	f := &fullSync{done: make(chan struct{})}
+	s.full = f
+	s.fullMu.Unlock()
+
+	end, _ := s.beginSync(SyncKindAll, syncAllScope)
+
+	defer func() {
+		end()
+
+		s.fullMu.Lock()
+		s.full = nil
+		s.fullMu.Unlock()
+
+		close(f.done)
+	}()
+
+	f.err = fn(ctx)
+
+	return f.err
+}
@@ -0,0 +1,126 @@
+package metadata
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/seal-io/walrus/utils/errorx"
+	"github.com/seal-io/walrus/utils/gopool"
+	"github.com/seal-io/walrus/utils/log"
+
+	"github.com/seal-io/hermitcrab/pkg/timing"
+)
+
+// ErrUpstreamBudgetExceeded is returned if the upstream calls of a query exceed the budget,
+// the syncing continues in background.
+var ErrUpstreamBudgetExceeded = errors.New("upstream budget exceeded")
+
+// backgroundSyncTimeout is the maximum duration of the syncing continued in background.
+const backgroundSyncTimeout = 5 * time.Minute
+
+type budgetContextKey struct{}
+
+// budget holds the deadline of the upstream calls of a query,
+// the deadline is started by the first query.
+type budget struct {
+	deadline time.Time
+}
+
+// WithUpstreamBudget returns a copy of the given context,
+// which limits the upstream calls of the query within the configured budget,
+// i.e. the client requests that cannot wait for a long cascading syncing.
+func WithUpstreamBudget(ctx context.Context) context.Context {
+	return context.WithValue(ctx, budgetContextKey{}, budget{})
+}
+
+// startBudget starts the upstream budget of the given context if required,
+// the recursive queries share the started budget.
+func (s *service) startBudget(ctx context.Context) context.Context {
+	b, ok := ctx.Value(budgetContextKey{}).(budget)
+	if !ok || !b.deadline.IsZero() || s.upstreamBudget <= 0 {
+		return ctx
+	}
+
+	return context.WithValue(ctx, budgetContextKey{}, budget{deadline: time.Now().Add(s.upstreamBudget)})
+}
+
+// withinBudget calls the given syncing function within the upstream budget of the given context,
+// the syncing continues in background if the budget exceeded,
+// calls the function directly if no budget started.
+func (s *service) withinBudget(ctx context.Context, fn func(context.Context) error) error {
+	b, ok := ctx.Value(budgetContextKey{}).(budget)
+	if !ok || b.deadline.IsZero() {
+		return fn(ctx)
+	}
+
+	remaining := time.Until(b.deadline)
+	if remaining <= 0 {
+		return s.budgetError()
+	}
+
+	defer timing.Track(ctx, timing.PhaseUpstream)()
+
+	// Detach from the request, which is recycled after responding.
+	done := make(chan error, 1)
+
+	gopool.Go(func() {
+		bctx, cancel := context.WithTimeout(context.Background(), backgroundSyncTimeout)
+		defer cancel()
+
+		done <- fn(bctx)
+	})
+
+	t := time.NewTimer(remaining)
+	defer t.Stop()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		log.WithName("provider").WithName("metadata").
+			V(4).Infof("upstream budget %s exceeded, continue syncing in background", s.upstreamBudget)
+
+		return s.budgetError()
+	}
+}
+
+// exceedsBudget returns true if the upstream budget of the given context is exhausted.
+func exceedsBudget(ctx context.Context) bool {
+	b, ok := ctx.Value(budgetContextKey{}).(budget)
+	return ok && !b.deadline.IsZero() && !time.Now().Before(b.deadline)
+}
+
+// budgetError returns the error responding 503 with the Retry-After of the budget.
+func (s *service) budgetError() error {
+	return errorx.WrapHttpError(http.StatusServiceUnavailable,
+		budgetExceededError(int64(math.Ceil(s.upstreamBudget.Seconds()))),
+		"syncing from the upstream in background, retry later")
+}
+
+// budgetExceededError is the cause of the exceeded upstream budget,
+// which holds the seconds of the Retry-After.
+type budgetExceededError int64
+
+func (e budgetExceededError) Error() string {
+	return ErrUpstreamBudgetExceeded.Error() + ", retry after " + strconv.FormatInt(int64(e), 10) + "s"
+}
+
+func (e budgetExceededError) Unwrap() error {
+	return ErrUpstreamBudgetExceeded
+}
+
+// RetryAfter returns the value of the Retry-After header.
+func (e budgetExceededError) RetryAfter() string {
+	return strconv.FormatInt(int64(e), 10)
+}
+
+// ErrorCode returns the machine-readable code of the error.
+func (e budgetExceededError) ErrorCode() string {
+	return "upstream_budget_exceeded"
+}
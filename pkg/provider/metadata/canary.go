@@ -0,0 +1,104 @@
+package metadata
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/seal-io/walrus/utils/errorx"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/seal-io/hermitcrab/pkg/provider/addrs"
+)
+
+// canaryKey is the key of the version bucket, which marks the version as canary,
+// the canary version is only visible to the canary clients,
+// which survives the re-syncing of the version, takes a look of the key:
+//
+//	BUCKET({version}):
+//	  KEY(canary): bool
+const canaryKey = "canary"
+
+// SetCanaryOptions holds the options of marking a provider version as canary.
+type SetCanaryOptions struct {
+	Hostname  string
+	Namespace string
+	Type      string
+	Version   string
+	Canary    bool
+}
+
+// isCanary returns true if the given version bucket is marked as canary.
+func isCanary(versionBucket *bolt.Bucket) bool {
+	return string(getValue(versionBucket, canaryKey)) == "true"
+}
+
+// SetCanary marks or unmarks the given version as canary.
+func (s *service) SetCanary(_ context.Context, opts SetCanaryOptions) error {
+	addr := addrs.Address{
+		Hostname:  opts.Hostname,
+		Namespace: opts.Namespace,
+		Type:      opts.Type,
+		Version:   opts.Version,
+	}.Normalize()
+	if addr.Validate() != nil || addr.Version == "" {
+		return errors.New("invalid options")
+	}
+
+	err := s.update(addr, func(tx *bolt.Tx) error {
+		typedBucket := tx.
+			Bucket(toBytes(domain)).
+			Bucket(toBytes(addr.TypedKey()))
+		if typedBucket == nil {
+			return ErrTypedNotFound
+		}
+
+		versionBucket := typedBucket.Bucket(toBytes(addr.Version))
+		if versionBucket == nil {
+			return ErrVersionNotFound
+		}
+
+		if !opts.Canary {
+			return versionBucket.Delete(toBytes(canaryKey))
+		}
+
+		return putValue(versionBucket, canaryKey, toBytes("true"))
+	})
+	if err != nil {
+		if errors.Is(err, ErrTypedNotFound) || errors.Is(err, ErrVersionNotFound) {
+			return errorx.WrapHttpError(http.StatusNotFound, err, "version is not mirrored")
+		}
+
+		return fmt.Errorf("error setting canary: %w", err)
+	}
+
+	return nil
+}
+
+// IsCanary returns true if the given version is marked as canary without syncing from remote.
+func (s *service) IsCanary(_ context.Context, addr addrs.Address) bool {
+	addr = addr.Normalize()
+
+	var canary bool
+
+	_ = s.boltDriver.View(func(tx *bolt.Tx) error {
+		typedBucket := tx.
+			Bucket(toBytes(domain)).
+			Bucket(toBytes(addr.TypedKey()))
+		if typedBucket == nil {
+			return nil
+		}
+
+		versionBucket := typedBucket.Bucket(toBytes(addr.Version))
+		if versionBucket == nil {
+			return nil
+		}
+
+		canary = isCanary(versionBucket)
+
+		return nil
+	})
+
+	return canary
+}
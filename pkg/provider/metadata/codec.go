@@ -0,0 +1,84 @@
+package metadata
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	// compressedHeader leads the compressed value,
+	// which never leads a JSON, so that the uncompressed values stay readable.
+	compressedHeader byte = 0x01
+	// compressThreshold is the minimum size of the value to compress.
+	compressThreshold = 1 << 10
+)
+
+// encodeValue compresses the given value in gzip with the header if it is larger than the threshold,
+// returns the given value if not worth compressing.
+func encodeValue(data []byte) []byte {
+	if len(data) < compressThreshold {
+		return data
+	}
+
+	var buf bytes.Buffer
+
+	buf.WriteByte(compressedHeader)
+
+	w, _ := gzip.NewWriterLevel(&buf, gzip.BestSpeed)
+	if _, err := w.Write(data); err != nil {
+		return data
+	}
+
+	if err := w.Close(); err != nil {
+		return data
+	}
+
+	if buf.Len() >= len(data) {
+		return data
+	}
+
+	return buf.Bytes()
+}
+
+// decodeValue decompresses the given value if it leads with the header,
+// returns a copy of the given value otherwise,
+// so that the returned value is safe to use out of the transaction.
+func decodeValue(data []byte) ([]byte, error) {
+	if len(data) == 0 || data[0] != compressedHeader {
+		return bytes.Clone(data), nil
+	}
+
+	r, err := gzip.NewReader(bytes.NewReader(data[1:]))
+	if err != nil {
+		return nil, fmt.Errorf("error decompressing value: %w", err)
+	}
+
+	defer func() { _ = r.Close() }()
+
+	v, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("error decompressing value: %w", err)
+	}
+
+	return v, nil
+}
+
+// getValue returns the decoded value of the given key from the given bucket,
+// returns nil if not found or malformed.
+func getValue(b *bolt.Bucket, key string) []byte {
+	v, err := decodeValue(b.Get(toBytes(key)))
+	if err != nil {
+		return nil
+	}
+
+	return v
+}
+
+// putValue stores the encoded value of the given key into the given bucket.
+func putValue(b *bolt.Bucket, key string, data []byte) error {
+	return b.Put(toBytes(key), encodeValue(data))
+}
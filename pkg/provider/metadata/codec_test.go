@@ -0,0 +1,48 @@
+package metadata
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodeValue(t *testing.T) {
+	armor := "-----BEGIN PGP PUBLIC KEY BLOCK-----\n" +
+		strings.Repeat("mQINBGB9+xkBEACabYZOWKmgZsHTdRDiyPJxhbuUiKX65GUWkyRMJKi/1dviVxOX\n", 50) +
+		"-----END PGP PUBLIC KEY BLOCK-----"
+
+	testCases := []struct {
+		name       string
+		given      string
+		compressed bool
+	}{
+		{
+			name:  "small",
+			given: `{"os":"linux","arch":"amd64"}`,
+		},
+		{
+			name:       "gpg heavy",
+			given:      `{"os":"linux","arch":"amd64","signing_keys":{"gpg_public_keys":[{"ascii_armor":"` + armor + `"}]}}`,
+			compressed: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			encoded := encodeValue([]byte(tc.given))
+
+			if tc.compressed {
+				assert.Equal(t, compressedHeader, encoded[0])
+				assert.Less(t, len(encoded), len(tc.given)/2)
+			} else {
+				assert.Equal(t, tc.given, string(encoded))
+			}
+
+			decoded, err := decodeValue(encoded)
+			require.NoError(t, err)
+			assert.Equal(t, tc.given, string(decoded))
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package metadata
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+// Compatibility holds the CLI versions compatible with a provider version,
+// which are inferred from the major versions of the plugin protocols,
+// in form of the version constraints, i.e. >= 1.0.0,
+// blank if the protocols are unknown or no version is compatible.
+type Compatibility struct {
+	Terraform string `json:"terraform,omitempty"`
+	OpenTofu  string `json:"opentofu,omitempty"`
+}
+
+// cliRange is the range of the CLI versions supporting a major version of the plugin protocols,
+// the upper bound is exclusive and blank if unbounded.
+type cliRange struct {
+	min, max string
+}
+
+var (
+	// terraformProtocols holds the Terraform versions supporting the major versions of the plugin protocols,
+	// the protocol 4 is dropped since Terraform 0.12.
+	terraformProtocols = map[string]cliRange{
+		"4": {min: "0.10.0", max: "0.12.0"},
+		"5": {min: "0.12.0"},
+		"6": {min: "1.0.0"},
+	}
+	// opentofuProtocols holds the OpenTofu versions supporting the major versions of the plugin protocols,
+	// the protocol 4 is never supported.
+	opentofuProtocols = map[string]cliRange{
+		"5": {min: "1.6.0"},
+		"6": {min: "1.6.0"},
+	}
+)
+
+// CompatibilityOf returns the CLI versions compatible with the given protocols of a provider version,
+// i.e. >= 0.12.0 for Terraform and >= 1.6.0 for OpenTofu of the protocol 5.0.
+func CompatibilityOf(protocols []string) Compatibility {
+	return Compatibility{
+		Terraform: constraintOf(protocols, terraformProtocols),
+		OpenTofu:  constraintOf(protocols, opentofuProtocols),
+	}
+}
+
+// constraintOf returns the constraint of the CLI versions supporting any of the given protocols,
+// the overlapping ranges are merged, and the disjoint ones are joined by ||.
+func constraintOf(protocols []string, ranges map[string]cliRange) string {
+	var rs []cliRange
+
+	for _, p := range protocols {
+		major, _, _ := strings.Cut(strings.TrimSpace(p), ".")
+		if r, ok := ranges[major]; ok {
+			rs = append(rs, r)
+		}
+	}
+
+	if len(rs) == 0 {
+		return ""
+	}
+
+	less := func(a, b string) bool {
+		return semver.MustParse(a).LessThan(semver.MustParse(b))
+	}
+
+	sort.Slice(rs, func(i, j int) bool { return less(rs[i].min, rs[j].min) })
+
+	merged := []cliRange{rs[0]}
+
+	for _, r := range rs[1:] {
+		last := &merged[len(merged)-1]
+
+		switch {
+		case last.max == "":
+			// Unbounded, covers the rest.
+		case !less(last.max, r.min):
+			if r.max == "" || less(last.max, r.max) {
+				last.max = r.max
+			}
+		default:
+			merged = append(merged, r)
+		}
+	}
+
+	cs := make([]string, 0, len(merged))
+
+	for _, r := range merged {
+		c := ">= " + r.min
+		if r.max != "" {
+			c += ", < " + r.max
+		}
+
+		cs = append(cs, c)
+	}
+
+	return strings.Join(cs, " || ")
+}
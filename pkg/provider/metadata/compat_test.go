@@ -0,0 +1,47 @@
+package metadata
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompatibilityOf(t *testing.T) {
+	testCases := []struct {
+		given    []string
+		expected Compatibility
+	}{
+		{
+			given:    nil,
+			expected: Compatibility{},
+		},
+		{
+			given:    []string{"4.0"},
+			expected: Compatibility{Terraform: ">= 0.10.0, < 0.12.0"},
+		},
+		{
+			given:    []string{"5.0"},
+			expected: Compatibility{Terraform: ">= 0.12.0", OpenTofu: ">= 1.6.0"},
+		},
+		{
+			given:    []string{"6.0"},
+			expected: Compatibility{Terraform: ">= 1.0.0", OpenTofu: ">= 1.6.0"},
+		},
+		{
+			given:    []string{"4.0", "5.1"},
+			expected: Compatibility{Terraform: ">= 0.10.0", OpenTofu: ">= 1.6.0"},
+		},
+		{
+			given:    []string{"6.0", "4.0"},
+			expected: Compatibility{Terraform: ">= 0.10.0, < 0.12.0 || >= 1.0.0", OpenTofu: ">= 1.6.0"},
+		},
+		{
+			given:    []string{"7.0"},
+			expected: Compatibility{},
+		},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.expected, CompatibilityOf(tc.given), "protocols %v", tc.given)
+	}
+}
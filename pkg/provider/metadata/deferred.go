@@ -0,0 +1,60 @@
+package metadata
+
+import (
+	"context"
+	"time"
+
+	"github.com/seal-io/walrus/utils/log"
+
+	"github.com/seal-io/hermitcrab/pkg/maintenance"
+	"github.com/seal-io/hermitcrab/pkg/provider/addrs"
+	"github.com/seal-io/hermitcrab/pkg/registry"
+)
+
+// MaxSyncDeferral is the longest delay of retrying a rate-limited sync,
+// the sync asked to retry later than this is left to the next scheduled sync.
+const MaxSyncDeferral = 30 * time.Minute
+
+// deferSync queues the versions syncing of the given provider for retry
+// after the delay indicated by the Retry-After of its upstream,
+// returns false if the upstream has not asked to retry later.
+func (s *service) deferSync(ctx context.Context, addr addrs.Address) bool {
+	rl, ok := registry.RateLimitOf(addr.Hostname)
+	if !ok {
+		return false
+	}
+
+	d := time.Until(rl.RetryAfter)
+	if d <= 0 || d > MaxSyncDeferral {
+		return false
+	}
+
+	key := addr.TypedKey()
+
+	if _, deferred := s.deferred.LoadOrStore(key, rl.RetryAfter); deferred {
+		return true
+	}
+
+	log.WithName("provider").WithName("metadata").
+		Infof("deferred syncing %s for %s as requested by %s", addr, d.Round(time.Second), addr.Hostname)
+
+	// Detach from the scheduled sync, which completes before the retry.
+	ctx = context.WithoutCancel(ctx)
+
+	time.AfterFunc(d, func() {
+		s.deferred.Delete(key)
+
+		// Leave to the next scheduled sync after the maintenance.
+		if maintenance.Enabled() {
+			return
+		}
+
+		err := s.syncVersions(ctx, addr)
+		if err != nil {
+			log.WithName("provider").WithName("metadata").
+				Warnf("error retrying deferred syncing %s: %v", addr, err)
+		}
+	})
+
+	return true
+}
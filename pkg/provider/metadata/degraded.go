@@ -0,0 +1,131 @@
+package metadata
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/seal-io/walrus/utils/log"
+
+	"github.com/seal-io/hermitcrab/pkg/provider/addrs"
+)
+
+const (
+	// SyncErrorBudget is the number of consecutive failed syncs tolerated per provider,
+	// the provider is degraded and backed off once exhausted.
+	SyncErrorBudget = 3
+	// MinSyncBackoff and MaxSyncBackoff bound the backoff of syncing a degraded provider,
+	// which doubles from the minimum on every failed retry.
+	MinSyncBackoff = 30 * time.Minute
+	MaxSyncBackoff = 24 * time.Hour
+)
+
+// DegradedProvider holds a provider failing to sync consecutively.
+type DegradedProvider struct {
+	Hostname  string `json:"hostname"`
+	Namespace string `json:"namespace"`
+	Type      string `json:"type"`
+	// Failures is the number of consecutive failed syncs.
+	Failures  int       `json:"failures"`
+	LastError string    `json:"lastError"`
+	Since     time.Time `json:"since"`
+	// RetryAt is the time to retry the scheduled sync, zero if the error budget is not exhausted.
+	RetryAt time.Time `json:"retryAt,omitempty"`
+}
+
+// Degraded returns true if the error budget is exhausted.
+func (d DegradedProvider) Degraded() bool {
+	return d.Failures >= SyncErrorBudget
+}
+
+// observeSyncResult counts the consecutive failed syncs of the given provider,
+// and backs off the scheduled sync exponentially once the error budget is exhausted,
+// the successful sync restores the provider.
+func (s *service) observeSyncResult(addr addrs.Address, err error) {
+	logger := log.WithName("provider").WithName("metadata")
+	key := addr.TypedKey()
+
+	if err == nil {
+		if _, failed := s.failures.LoadAndDelete(key); failed {
+			logger.Infof("restored syncing %s", addr)
+		}
+
+		return
+	}
+
+	now := s.clock()
+
+	d := DegradedProvider{
+		Hostname:  addr.Hostname,
+		Namespace: addr.Namespace,
+		Type:      addr.Type,
+		Since:     now,
+	}
+	if v, ok := s.failures.Load(key); ok {
+		d = v.(DegradedProvider)
+	}
+
+	d.Failures++
+	d.LastError = err.Error()
+
+	if d.Degraded() {
+		backoff := MinSyncBackoff << (d.Failures - SyncErrorBudget)
+		if backoff <= 0 || backoff > MaxSyncBackoff {
+			backoff = MaxSyncBackoff
+		}
+
+		d.RetryAt = now.Add(backoff)
+
+		// Warn once, the later failures are reported by the admin API.
+		if d.Failures == SyncErrorBudget {
+			logger.Warnf("degraded syncing %s after %d consecutive failures, backing off: %v",
+				addr, d.Failures, err)
+		}
+	}
+
+	s.failures.Store(key, d)
+}
+
+// isBackingOff returns true if the scheduled sync of the given degraded provider is backing off.
+func (s *service) isBackingOff(addr addrs.Address) bool {
+	v, ok := s.failures.Load(addr.TypedKey())
+	if !ok {
+		return false
+	}
+
+	d := v.(DegradedProvider)
+
+	return d.Degraded() && s.clock().Before(d.RetryAt)
+}
+
+// isDegraded returns true if the given provider is degraded.
+func (s *service) isDegraded(addr addrs.Address) bool {
+	v, ok := s.failures.Load(addr.TypedKey())
+	return ok && v.(DegradedProvider).Degraded()
+}
+
+func (s *service) GetDegradedProviders(_ context.Context) []DegradedProvider {
+	ds := make([]DegradedProvider, 0)
+
+	s.failures.Range(func(_, v any) bool {
+		if d := v.(DegradedProvider); d.Degraded() {
+			ds = append(ds, d)
+		}
+
+		return true
+	})
+
+	sort.Slice(ds, func(i, j int) bool {
+		if ds[i].Hostname != ds[j].Hostname {
+			return ds[i].Hostname < ds[j].Hostname
+		}
+
+		if ds[i].Namespace != ds[j].Namespace {
+			return ds[i].Namespace < ds[j].Namespace
+		}
+
+		return ds[i].Type < ds[j].Type
+	})
+
+	return ds
+}
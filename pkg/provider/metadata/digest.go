@@ -0,0 +1,160 @@
+package metadata
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/seal-io/walrus/utils/errorx"
+	"github.com/seal-io/walrus/utils/json"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/seal-io/hermitcrab/pkg/provider/addrs"
+)
+
+// digestsDomain is the bucket indexing the stored platforms by the sha256 checksum of their archives,
+// which is maintained within the same transactions of changing the platforms,
+// takes a look of the bucket structure:
+//
+//	BUCKET(provider_digests)
+//	  KEY({shasum}): string, {hostname}/{namespace}/{type}/{version}/{os}/{arch}
+const digestsDomain = "provider_digests"
+
+// GetPlatformByShasum gets the stored platform whose archive matches the given sha256 checksum
+// without syncing from remote, returns the address of the platform along with it.
+func (s *service) GetPlatformByShasum(_ context.Context, shasum string) (addr addrs.Address, p Platform, err error) {
+	shasum = strings.ToLower(shasum)
+
+	err = s.boltDriver.View(func(tx *bolt.Tx) error {
+		addr, err = addrs.Parse(string(tx.Bucket(toBytes(digestsDomain)).Get(toBytes(shasum))))
+		if err != nil || addr.OS == "" {
+			return errorx.HttpErrorf(http.StatusNotFound, "archive %s is not found", shasum)
+		}
+
+		versionBucket := tx.
+			Bucket(toBytes(domain)).
+			Bucket(toBytes(addr.TypedKey())).
+			Bucket(toBytes(addr.Version))
+		if versionBucket == nil || isRemoved(versionBucket) && s.hideRemoved {
+			return errorx.HttpErrorf(http.StatusNotFound, "archive %s is not found", shasum)
+		}
+
+		p = Platform{
+			OS:       addr.OS,
+			Arch:     addr.Arch,
+			Filename: addr.ArchiveFilename(),
+		}
+
+		if _, data, _ := platformsOf(versionBucket)(addr.PlatformKey()); len(data) != 0 {
+			_ = json.Unmarshal(data, &p)
+		}
+
+		// The index entry is left behind by the changed platform.
+		if !strings.EqualFold(p.Shasum, shasum) {
+			return errorx.HttpErrorf(http.StatusNotFound, "archive %s is not found", shasum)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return addrs.Address{}, Platform{}, err
+	}
+
+	return addr, p, nil
+}
+
+// indexShasum indexes the stored platform of the given address by its shasum,
+// does nothing if the platform has no shasum.
+func indexShasum(tx *bolt.Tx, addr addrs.Address, data []byte) error {
+	sum := strings.ToLower(json.Get(data, "shasum").String())
+	if sum == "" {
+		return nil
+	}
+
+	return tx.Bucket(toBytes(digestsDomain)).Put(toBytes(sum), toBytes(addr.String()))
+}
+
+// unindexShasum removes the index of the stored platform of the given address,
+// keeps the index if the shasum belongs to another platform.
+func unindexShasum(tx *bolt.Tx, addr addrs.Address, data []byte) error {
+	sum := strings.ToLower(json.Get(data, "shasum").String())
+	if sum == "" {
+		return nil
+	}
+
+	digestsBucket := tx.Bucket(toBytes(digestsDomain))
+	if string(digestsBucket.Get(toBytes(sum))) != addr.String() {
+		return nil
+	}
+
+	return digestsBucket.Delete(toBytes(sum))
+}
+
+// indexVersion indexes the stored platforms of the given version bucket by their shasums,
+// or removes the indexes of them if unindex is true.
+func indexVersion(tx *bolt.Tx, addr addrs.Address, versionBucket *bolt.Bucket, unindex bool) error {
+	var version Version
+	if err := json.Unmarshal(getValue(versionBucket, "data"), &version); err != nil {
+		// Skip the incomplete version.
+		return nil
+	}
+
+	getPlatform := platformsOf(versionBucket)
+
+	for _, p := range version.Platforms {
+		pa := addr.WithPlatform(p.OS, p.Arch)
+
+		_, data, _ := getPlatform(pa.PlatformKey())
+
+		var err error
+		if unindex {
+			err = unindexShasum(tx, pa, data)
+		} else {
+			err = indexShasum(tx, pa, data)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// deleteVersion deletes the version bucket of the given address along with the indexes of its platforms.
+func deleteVersion(tx *bolt.Tx, typedBucket *bolt.Bucket, addr addrs.Address) error {
+	if versionBucket := typedBucket.Bucket(toBytes(addr.Version)); versionBucket != nil {
+		if err := indexVersion(tx, addr, versionBucket, true); err != nil {
+			return err
+		}
+	}
+
+	return typedBucket.DeleteBucket(toBytes(addr.Version))
+}
+
+// buildDigests indexes all stored platforms by their shasums,
+// does nothing if the index is built.
+func buildDigests(tx *bolt.Tx) error {
+	if tx.Bucket(toBytes(digestsDomain)) != nil {
+		return nil
+	}
+
+	if _, err := tx.CreateBucket(toBytes(digestsDomain)); err != nil {
+		return err
+	}
+
+	providersBucket := tx.Bucket(toBytes(domain))
+
+	return providersBucket.ForEachBucket(func(k []byte) error {
+		typedAddr, err := addrs.ParseTypedKey(string(k))
+		if err != nil {
+			return nil
+		}
+
+		typedBucket := providersBucket.Bucket(k)
+
+		return typedBucket.ForEachBucket(func(v []byte) error {
+			return indexVersion(tx, typedAddr.WithVersion(string(v)), typedBucket.Bucket(v), false)
+		})
+	})
+}
@@ -0,0 +1,63 @@
+package metadata
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/seal-io/hermitcrab/pkg/provider/addrs"
+)
+
+// DefaultEagerPlatformSync holds the patterns of the providers whose platforms are synced eagerly by default,
+// which are the most popular ones worth the upstream rate limits.
+var DefaultEagerPlatformSync = []string{
+	"hashicorp/aws",
+	"hashicorp/google",
+	"hashicorp/azurerm",
+	"hashicorp/kubernetes",
+}
+
+// normalizeProviderPatterns returns the lowercase patterns in form of <HOSTNAME>/<NAMESPACE>/<TYPE>,
+// the hostname is DefaultHostname if omitted.
+func normalizeProviderPatterns(ps []string) ([]string, error) {
+	if ps == nil {
+		return nil, nil
+	}
+
+	r := make([]string, 0, len(ps))
+
+	for _, p := range ps {
+		p = strings.ToLower(strings.Trim(p, "/"))
+
+		// Complete the hostname if omitted.
+		if strings.Count(p, "/") == 1 {
+			p = addrs.DefaultHostname + "/" + p
+		}
+
+		if _, err := path.Match(p, ""); err != nil || strings.Count(p, "/") != 2 {
+			return nil, fmt.Errorf("invalid provider pattern %q", p)
+		}
+
+		r = append(r, p)
+	}
+
+	return r, nil
+}
+
+// isEagerPlatformSync returns true if the platforms of the given provider are synced eagerly
+// after syncing the versions.
+func (s *service) isEagerPlatformSync(addr addrs.Address) bool {
+	if s.eagerPlatformSync == nil {
+		return true
+	}
+
+	k := addr.TypedKey()
+
+	for _, p := range s.eagerPlatformSync {
+		if ok, _ := path.Match(p, k); ok {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,309 @@
+package metadata
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/seal-io/walrus/utils/errorx"
+	"github.com/seal-io/walrus/utils/json"
+	"github.com/seal-io/walrus/utils/log"
+	"github.com/tidwall/gjson"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/seal-io/hermitcrab/pkg/provider/addrs"
+)
+
+// historyDomain is the bucket of the sync histories,
+// which is separated from the providers bucket to not be treated as versions,
+// takes a look of the bucket structure:
+//
+//	BUCKET(provider_histories)
+//	  KEY({hostname}/{namespace}/{type}): []SyncAttempt, newest first.
+const historyDomain = "provider_histories"
+
+// DefaultMaxSyncHistory is the default number of sync attempts retained per provider.
+const DefaultMaxSyncHistory = 20
+
+type (
+	// GetSyncHistoryOptions holds the options of getting provider sync history.
+	GetSyncHistoryOptions struct {
+		Hostname  string
+		Namespace string
+		Type      string
+	}
+
+	// SyncAttempt holds the result of an attempt to sync the provider versions.
+	SyncAttempt struct {
+		Timestamp       time.Time `json:"timestamp"`
+		Duration        string    `json:"duration"`
+		VersionsAdded   []string  `json:"versions_added,omitempty"`
+		VersionsRemoved []string  `json:"versions_removed,omitempty"`
+		// PlatformsAdded and PlatformsRemoved hold the changed platforms of the existing versions,
+		// which are keyed by the version and listed in form of <OS>_<ARCH>.
+		PlatformsAdded   map[string][]string `json:"platforms_added,omitempty"`
+		PlatformsRemoved map[string][]string `json:"platforms_removed,omitempty"`
+		Error            string              `json:"error,omitempty"`
+	}
+
+	// GetSyncDiffOptions holds the options of getting provider sync diff.
+	GetSyncDiffOptions struct {
+		Hostname  string
+		Namespace string
+		Type      string
+		// From and To bound the sync attempts to diff, the attempts after From and not after To are diffed.
+		From time.Time
+		To   time.Time
+	}
+
+	// SyncDiff holds the net changes of the provider between two sync points.
+	SyncDiff struct {
+		From             time.Time           `json:"from"`
+		To               time.Time           `json:"to"`
+		Attempts         int                 `json:"attempts"`
+		VersionsAdded    []string            `json:"versions_added"`
+		VersionsRemoved  []string            `json:"versions_removed"`
+		PlatformsAdded   map[string][]string `json:"platforms_added"`
+		PlatformsRemoved map[string][]string `json:"platforms_removed"`
+	}
+
+	// SyncEvent is the payload of the sync events,
+	// the attempt is only carried by the finished event.
+	SyncEvent struct {
+		Hostname  string `json:"hostname"`
+		Namespace string `json:"namespace"`
+		Type      string `json:"type"`
+
+		*SyncAttempt
+	}
+)
+
+func (s *service) GetSyncHistory(ctx context.Context, opts GetSyncHistoryOptions) ([]SyncAttempt, error) {
+	addr := addrs.Address{
+		Hostname:  opts.Hostname,
+		Namespace: opts.Namespace,
+		Type:      opts.Type,
+	}.Normalize()
+	if addr.Validate() != nil {
+		return nil, errors.New("invalid options")
+	}
+
+	var history []SyncAttempt
+
+	err := s.boltDriver.View(func(tx *bolt.Tx) error {
+		data := getValue(tx.Bucket(toBytes(historyDomain)), addr.TypedKey())
+		if len(data) == 0 {
+			return nil
+		}
+
+		return json.Unmarshal(data, &history)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error getting sync history: %w", err)
+	}
+
+	if history == nil {
+		history = []SyncAttempt{}
+	}
+
+	return history, nil
+}
+
+func (s *service) GetSyncDiff(ctx context.Context, opts GetSyncDiffOptions) (SyncDiff, error) {
+	if opts.To.IsZero() {
+		opts.To = s.clock()
+	}
+
+	if !opts.From.Before(opts.To) {
+		return SyncDiff{}, errorx.HttpErrorf(http.StatusBadRequest, "from must be before to")
+	}
+
+	history, err := s.GetSyncHistory(ctx, GetSyncHistoryOptions{
+		Hostname:  opts.Hostname,
+		Namespace: opts.Namespace,
+		Type:      opts.Type,
+	})
+	if err != nil {
+		return SyncDiff{}, err
+	}
+
+	// The attempts before the oldest retained one are dropped,
+	// so the diff is incomplete if it starts before.
+	if len(history) >= s.maxSyncHistory && opts.From.Before(history[len(history)-1].Timestamp) {
+		return SyncDiff{}, errorx.HttpErrorf(http.StatusBadRequest,
+			"sync history before %s is not retained", history[len(history)-1].Timestamp.Format(time.RFC3339))
+	}
+
+	return diffSyncHistory(history, opts.From, opts.To), nil
+}
+
+// diffSyncHistory returns the net changes of the given sync history (newest first) within (from, to],
+// the version added and then removed within the range is not reported,
+// and the platform changes of the added or removed versions are not reported.
+func diffSyncHistory(history []SyncAttempt, from, to time.Time) SyncDiff {
+	var (
+		versions  = map[string]bool{}
+		platforms = map[string]map[string]bool{}
+		attempts  int
+	)
+
+	change := func(m map[string]bool, k string, added bool) {
+		if v, ok := m[k]; ok && v != added {
+			// Net out the reverse change.
+			delete(m, k)
+			return
+		}
+
+		m[k] = added
+	}
+
+	// Replay from the oldest.
+	for i := len(history) - 1; i >= 0; i-- {
+		a := history[i]
+		if !a.Timestamp.After(from) || a.Timestamp.After(to) || a.Error != "" {
+			continue
+		}
+
+		attempts++
+
+		for _, v := range a.VersionsAdded {
+			change(versions, v, true)
+		}
+
+		for _, v := range a.VersionsRemoved {
+			change(versions, v, false)
+		}
+
+		for _, pc := range []struct {
+			m     map[string][]string
+			added bool
+		}{{a.PlatformsAdded, true}, {a.PlatformsRemoved, false}} {
+			for v, ps := range pc.m {
+				if platforms[v] == nil {
+					platforms[v] = map[string]bool{}
+				}
+
+				for _, p := range ps {
+					change(platforms[v], p, pc.added)
+				}
+			}
+		}
+	}
+
+	d := SyncDiff{
+		From:             from,
+		To:               to,
+		Attempts:         attempts,
+		VersionsAdded:    []string{},
+		VersionsRemoved:  []string{},
+		PlatformsAdded:   map[string][]string{},
+		PlatformsRemoved: map[string][]string{},
+	}
+
+	for v, added := range versions {
+		if added {
+			d.VersionsAdded = append(d.VersionsAdded, v)
+		} else {
+			d.VersionsRemoved = append(d.VersionsRemoved, v)
+		}
+	}
+
+	for v, ps := range platforms {
+		if _, ok := versions[v]; ok {
+			continue
+		}
+
+		for p, added := range ps {
+			if added {
+				d.PlatformsAdded[v] = append(d.PlatformsAdded[v], p)
+			} else {
+				d.PlatformsRemoved[v] = append(d.PlatformsRemoved[v], p)
+			}
+		}
+	}
+
+	sortVersionsBy(d.VersionsAdded, func(v string) string { return v })
+	sortVersionsBy(d.VersionsRemoved, func(v string) string { return v })
+
+	for _, m := range []map[string][]string{d.PlatformsAdded, d.PlatformsRemoved} {
+		for v := range m {
+			sort.Strings(m[v])
+		}
+	}
+
+	return d
+}
+
+// diffPlatforms returns the platforms in form of <OS>_<ARCH> added and removed
+// from the given previous version data to the given current one.
+func diffPlatforms(prev, curr []byte) (added, removed []string) {
+	platformsOf := func(data []byte) map[string]struct{} {
+		r := map[string]struct{}{}
+
+		json.Get(data, "platforms").ForEach(func(_, platformJ gjson.Result) bool {
+			os := platformJ.Get("os").String()
+			arch := platformJ.Get("arch").String()
+
+			if os != "" && arch != "" {
+				r[os+"_"+arch] = struct{}{}
+			}
+
+			return true
+		})
+
+		return r
+	}
+
+	p, c := platformsOf(prev), platformsOf(curr)
+
+	for k := range c {
+		if _, ok := p[k]; !ok {
+			added = append(added, k)
+		}
+	}
+
+	for k := range p {
+		if _, ok := c[k]; !ok {
+			removed = append(removed, k)
+		}
+	}
+
+	sort.Strings(added)
+	sort.Strings(removed)
+
+	return added, removed
+}
+
+// recordSyncAttempt prepends the given attempt to the sync history of the given provider,
+// and drops the oldest attempts beyond the maximum.
+func (s *service) recordSyncAttempt(addr addrs.Address, attempt SyncAttempt) {
+	err := s.boltDriver.Update(func(tx *bolt.Tx) error {
+		historyBucket := tx.Bucket(toBytes(historyDomain))
+
+		var history []SyncAttempt
+		if data := getValue(historyBucket, addr.TypedKey()); len(data) != 0 {
+			// Start over if malformed.
+			_ = json.Unmarshal(data, &history)
+		}
+
+		history = append([]SyncAttempt{attempt}, history...)
+		if len(history) > s.maxSyncHistory {
+			history = history[:s.maxSyncHistory]
+		}
+
+		data, err := json.Marshal(history)
+		if err != nil {
+			return err
+		}
+
+		return putValue(historyBucket, addr.TypedKey(), data)
+	})
+	if err != nil {
+		log.WithName("provider").WithName("metadata").
+			WithValues(addr.LogValues()...).
+			Warnf("error recording sync attempt: %v", err)
+	}
+}
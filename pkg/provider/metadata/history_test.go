@@ -0,0 +1,55 @@
+package metadata
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_diffSyncHistory(t *testing.T) {
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// Newest first.
+	history := []SyncAttempt{
+		{
+			Timestamp:     t0.Add(5 * time.Hour),
+			VersionsAdded: []string{"3.0.0"},
+		},
+		{
+			Timestamp:       t0.Add(4 * time.Hour),
+			VersionsRemoved: []string{"1.0.0", "2.1.0"},
+			PlatformsAdded:  map[string][]string{"2.0.0": {"darwin_arm64"}},
+		},
+		{
+			Timestamp: t0.Add(3 * time.Hour),
+			Error:     "error getting remote versions",
+		},
+		{
+			Timestamp:        t0.Add(2 * time.Hour),
+			VersionsAdded:    []string{"2.1.0"},
+			PlatformsAdded:   map[string][]string{"2.0.0": {"linux_arm64"}},
+			PlatformsRemoved: map[string][]string{"2.0.0": {"darwin_arm64"}},
+		},
+		{
+			Timestamp:     t0.Add(time.Hour),
+			VersionsAdded: []string{"1.0.0", "2.0.0"},
+		},
+	}
+
+	d := diffSyncHistory(history, t0.Add(time.Hour), t0.Add(4*time.Hour))
+	assert.Equal(t, 2, d.Attempts)
+	// 2.1.0 is added and then removed within the range.
+	assert.Empty(t, d.VersionsAdded)
+	assert.Equal(t, []string{"1.0.0"}, d.VersionsRemoved)
+	// The darwin_arm64 of 2.0.0 is removed and then added back within the range.
+	assert.Equal(t, map[string][]string{"2.0.0": {"linux_arm64"}}, d.PlatformsAdded)
+	assert.Empty(t, d.PlatformsRemoved)
+
+	d = diffSyncHistory(history, t0, t0.Add(6*time.Hour))
+	assert.Equal(t, 4, d.Attempts)
+	assert.Equal(t, []string{"3.0.0", "2.0.0"}, d.VersionsAdded)
+	assert.Empty(t, d.VersionsRemoved)
+	// The platform changes of the added versions are not reported.
+	assert.Empty(t, d.PlatformsAdded)
+}
@@ -0,0 +1,198 @@
+package metadata
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/seal-io/walrus/utils/errorx"
+	"github.com/seal-io/walrus/utils/json"
+	"github.com/tidwall/gjson"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/seal-io/hermitcrab/pkg/provider/addrs"
+)
+
+type (
+	// GetSigningKeysOptions holds the options of getting the signing keys of a provider.
+	GetSigningKeysOptions struct {
+		Hostname  string
+		Namespace string
+		Type      string
+	}
+
+	// GPGPublicKey holds a GPG public key signing the provider archives.
+	GPGPublicKey struct {
+		KeyID          string `json:"key_id"`
+		ASCIIArmor     string `json:"ascii_armor"`
+		TrustSignature string `json:"trust_signature,omitempty"`
+		Source         string `json:"source,omitempty"`
+		SourceURL      string `json:"source_url,omitempty"`
+	}
+)
+
+// keysDomain is the bucket of the GPG public keys shared by the stored platforms,
+// the platforms reference the stored key by the key_id instead of embedding the same ascii_armor,
+// takes a look of the key:
+//
+//	BUCKET(provider_signing_keys)
+//	  KEY({key_id}): {
+//	    key_id: string
+//	    ascii_armor: string
+//	    trust_signature: string
+//	    source: string
+//	    source_url: string
+//	  }
+const keysDomain = "provider_signing_keys"
+
+// gpgPublicKeysPath is the path of the GPG public keys in the platform JSON.
+const gpgPublicKeysPath = "signing_keys.gpg_public_keys"
+
+// rewriteGPGPublicKeys rewrites the GPG public keys of the given platform JSON by the given function,
+// keeps the key if the function returns nil,
+// returns the given platform JSON if nothing changed or failed to rewrite.
+func rewriteGPGPublicKeys(data []byte, fn func(key gjson.Result) []byte) []byte {
+	keysJ := json.Get(data, gpgPublicKeysPath)
+	if !keysJ.IsArray() {
+		return data
+	}
+
+	r := data
+
+	for i, keyJ := range keysJ.Array() {
+		k := fn(keyJ)
+		if k == nil {
+			continue
+		}
+
+		var err error
+
+		r, err = json.Set(r, gpgPublicKeysPath+"."+strconv.Itoa(i), k)
+		if err != nil {
+			return data
+		}
+	}
+
+	return r
+}
+
+// dedupGPGPublicKeys stores the GPG public keys of the given platform JSON into the given keys bucket,
+// and returns the platform JSON referencing the stored keys by the key_id,
+// the key is kept if a different one with the same key_id is stored.
+func dedupGPGPublicKeys(keysBucket *bolt.Bucket, data []byte) []byte {
+	if keysBucket == nil {
+		return data
+	}
+
+	return rewriteGPGPublicKeys(data, func(keyJ gjson.Result) []byte {
+		id := keyJ.Get("key_id").String()
+		if id == "" || !keyJ.Get("ascii_armor").Exists() {
+			return nil
+		}
+
+		k := toBytes(keyJ.Get("@ugly").Raw)
+
+		switch stored := getValue(keysBucket, id); {
+		case len(stored) == 0:
+			if putValue(keysBucket, id, k) != nil {
+				return nil
+			}
+		case !bytes.Equal(stored, k):
+			return nil
+		}
+
+		return toBytes(`{"key_id":` + keyJ.Get("key_id").Raw + `}`)
+	})
+}
+
+// restoreGPGPublicKeys returns the platform JSON embedding the GPG public keys
+// referenced by the key_id from the given keys bucket.
+func restoreGPGPublicKeys(keysBucket *bolt.Bucket, data []byte) []byte {
+	if keysBucket == nil {
+		return data
+	}
+
+	return rewriteGPGPublicKeys(data, func(keyJ gjson.Result) []byte {
+		if keyJ.Get("ascii_armor").Exists() {
+			return nil
+		}
+
+		stored := getValue(keysBucket, keyJ.Get("key_id").String())
+		if len(stored) == 0 {
+			return nil
+		}
+
+		return stored
+	})
+}
+
+func (s *service) GetSigningKeys(ctx context.Context, opts GetSigningKeysOptions) ([]GPGPublicKey, error) {
+	addr := addrs.Address{
+		Hostname:  opts.Hostname,
+		Namespace: opts.Namespace,
+		Type:      opts.Type,
+	}.Normalize()
+	if addr.Validate() != nil {
+		return nil, errors.New("invalid options")
+	}
+
+	keys := map[string]GPGPublicKey{}
+
+	err := s.boltDriver.View(func(tx *bolt.Tx) error {
+		typedBucket := tx.
+			Bucket(toBytes(domain)).
+			Bucket(toBytes(addr.TypedKey()))
+		if typedBucket == nil {
+			return ErrTypedNotFound
+		}
+
+		return typedBucket.ForEachBucket(func(v []byte) error {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			versionBucket := typedBucket.Bucket(v)
+			versionAddr := addr.WithVersion(string(v))
+			getPlatform := platformsOf(versionBucket)
+
+			platformsJ := json.Get(getValue(versionBucket, "data"), "platforms")
+			for _, platformJ := range platformsJ.Array() {
+				pa := versionAddr.WithPlatform(platformJ.Get("os").String(), platformJ.Get("arch").String())
+
+				_, data, _ := getPlatform(pa.PlatformKey())
+				for _, keyJ := range json.Get(data, gpgPublicKeysPath).Array() {
+					var k GPGPublicKey
+					if json.Unmarshal(toBytes(keyJ.Raw), &k) != nil || k.KeyID == "" || k.ASCIIArmor == "" {
+						continue
+					}
+
+					keys[k.KeyID] = k
+				}
+			}
+
+			return nil
+		})
+	})
+	if err != nil {
+		if errors.Is(err, ErrTypedNotFound) {
+			return nil, errorx.WrapHttpError(http.StatusNotFound, err, "provider is not mirrored")
+		}
+
+		return nil, fmt.Errorf("error getting signing keys: %w", err)
+	}
+
+	r := make([]GPGPublicKey, 0, len(keys))
+	for _, k := range keys {
+		r = append(r, k)
+	}
+
+	sort.Slice(r, func(i, j int) bool {
+		return r[i].KeyID < r[j].KeyID
+	})
+
+	return r, nil
+}
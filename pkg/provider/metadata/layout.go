@@ -0,0 +1,309 @@
+package metadata
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/seal-io/walrus/utils/json"
+	"github.com/seal-io/walrus/utils/log"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/seal-io/hermitcrab/pkg/provider/addrs"
+)
+
+// The layouts of storing the platforms of a version.
+const (
+	// PlatformLayoutNested stores each platform in a nested bucket of the version bucket.
+	PlatformLayoutNested = "nested"
+	// PlatformLayoutInline stores all platforms of a version in a single JSON of the version bucket,
+	// which saves the bucket headers and the pages of the providers with many platforms,
+	// takes a look of the key:
+	//
+	//	BUCKET({version}):
+	//	  KEY(platforms): map[{platform}]struct{
+	//	    modified: string, RFC3339
+	//	    data: {...}
+	//	  }
+	PlatformLayoutInline = "inline"
+)
+
+const (
+	// layoutKey is the key of the providers bucket, which records the layout of the stored platforms.
+	layoutKey = "layout"
+	// inlinePlatformsKey is the key of the version bucket, which holds the platforms in inline layout.
+	inlinePlatformsKey = "platforms"
+)
+
+// inlinePlatform holds a platform in inline layout.
+type inlinePlatform struct {
+	Modified string          `json:"modified,omitempty"`
+	Data     json.RawMessage `json:"data,omitempty"`
+}
+
+// getInlinePlatforms returns the platforms of the given version bucket in inline layout.
+func getInlinePlatforms(versionBucket *bolt.Bucket) (map[string]inlinePlatform, error) {
+	ps := map[string]inlinePlatform{}
+
+	data, err := decodeValue(versionBucket.Get(toBytes(inlinePlatformsKey)))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) == 0 {
+		return ps, nil
+	}
+
+	if err = json.Unmarshal(data, &ps); err != nil {
+		return nil, fmt.Errorf("error unmarshaling inline platforms: %w", err)
+	}
+
+	return ps, nil
+}
+
+// platformsOf returns a function to get the modified time and the data of the platform of the given key
+// from the given version bucket, the data is empty if not synced yet, returns false if not found,
+// both layouts are read, so that the platforms are readable before migrating,
+// the inline platforms are parsed at most once,
+// the platform without shasum is backfilled by the imported shasums.
+func platformsOf(versionBucket *bolt.Bucket) func(key string) (time.Time, []byte, bool) {
+	var (
+		inline     map[string]inlinePlatform
+		keysBucket = versionBucket.Tx().Bucket(toBytes(keysDomain))
+		shasums    = getShasums(versionBucket)
+	)
+
+	return func(key string) (modified time.Time, data []byte, found bool) {
+		if platformBucket := versionBucket.Bucket(toBytes(key)); platformBucket != nil {
+			modified, _ = time.Parse(time.RFC3339, string(platformBucket.Get(toBytes("modified"))))
+			data = restoreGPGPublicKeys(keysBucket, getValue(platformBucket, "data"))
+
+			return modified, backfillShasum(shasums, data), true
+		}
+
+		if inline == nil {
+			inline, _ = getInlinePlatforms(versionBucket)
+			if inline == nil {
+				inline = map[string]inlinePlatform{}
+			}
+		}
+
+		p, found := inline[key]
+		if !found {
+			return time.Time{}, nil, false
+		}
+
+		modified, _ = time.Parse(time.RFC3339, p.Modified)
+
+		return modified, backfillShasum(shasums, restoreGPGPublicKeys(keysBucket, p.Data)), true
+	}
+}
+
+// putPlatform stores the modified time and the data of the platform of the given address into the version bucket,
+// and indexes the platform by its shasum if the data changes.
+func (s *service) putPlatform(versionBucket *bolt.Bucket, addr addrs.Address, modified time.Time, data []byte) error {
+	key := addr.PlatformKey()
+
+	if len(data) == 0 {
+		return s.storePlatform(versionBucket, key, modified, data)
+	}
+
+	tx := versionBucket.Tx()
+
+	_, stored, _ := platformsOf(versionBucket)(key)
+	if err := unindexShasum(tx, addr, stored); err != nil {
+		return fmt.Errorf("error unindexing platform: %w", err)
+	}
+
+	if err := s.storePlatform(versionBucket, key, modified, data); err != nil {
+		return err
+	}
+
+	// Index the stored one, which may be backfilled by the imported shasums.
+	_, stored, _ = platformsOf(versionBucket)(key)
+	if err := indexShasum(tx, addr, stored); err != nil {
+		return fmt.Errorf("error indexing platform: %w", err)
+	}
+
+	return nil
+}
+
+// storePlatform stores the modified time and the data of the platform of the given key into the version bucket
+// in the configured layout, keeps the stored data if the given data is empty,
+// the GPG public keys of the data are stored once in the keys bucket.
+func (s *service) storePlatform(versionBucket *bolt.Bucket, key string, modified time.Time, data []byte) error {
+	if len(data) != 0 {
+		data = dedupGPGPublicKeys(versionBucket.Tx().Bucket(toBytes(keysDomain)), data)
+	}
+
+	if s.platformLayout != PlatformLayoutInline {
+		platformBucket, err := versionBucket.CreateBucketIfNotExists(toBytes(key))
+		if err != nil {
+			return fmt.Errorf("error creating platform bucket: %w", err)
+		}
+
+		if len(data) != 0 {
+			err = putValue(platformBucket, "data", data)
+			if err != nil {
+				return fmt.Errorf("error putting platform data: %w", err)
+			}
+		}
+
+		return platformBucket.Put(toBytes("modified"), toBytes(modified.Format(time.RFC3339)))
+	}
+
+	ps, err := getInlinePlatforms(versionBucket)
+	if err != nil {
+		return err
+	}
+
+	p := ps[key]
+	p.Modified = modified.Format(time.RFC3339)
+
+	if len(data) != 0 {
+		p.Data = data
+	}
+
+	ps[key] = p
+
+	return putInlinePlatforms(versionBucket, ps)
+}
+
+// putInlinePlatforms stores the given platforms into the version bucket in inline layout.
+func putInlinePlatforms(versionBucket *bolt.Bucket, ps map[string]inlinePlatform) error {
+	data, err := json.Marshal(ps)
+	if err != nil {
+		return fmt.Errorf("error marshaling inline platforms: %w", err)
+	}
+
+	err = putValue(versionBucket, inlinePlatformsKey, data)
+	if err != nil {
+		return fmt.Errorf("error putting inline platforms: %w", err)
+	}
+
+	return nil
+}
+
+// migrateLayout converts the stored platforms into the configured layout,
+// does nothing if the layout is not changed since the last migration.
+func (s *service) migrateLayout() error {
+	logger := log.WithName("provider").WithName("metadata")
+
+	return s.boltDriver.Update(func(tx *bolt.Tx) error {
+		providersBucket := tx.Bucket(toBytes(domain))
+
+		// The nested layout is the one before recording.
+		stored := string(providersBucket.Get(toBytes(layoutKey)))
+		if stored == "" {
+			stored = PlatformLayoutNested
+		}
+
+		if stored == s.platformLayout {
+			return nil
+		}
+
+		var migrated int
+
+		err := providersBucket.ForEachBucket(func(k []byte) error {
+			typedBucket := providersBucket.Bucket(k)
+
+			return typedBucket.ForEachBucket(func(v []byte) error {
+				versionBucket := typedBucket.Bucket(v)
+
+				var err error
+				if s.platformLayout == PlatformLayoutInline {
+					err = inlineVersion(versionBucket)
+				} else {
+					err = nestVersion(versionBucket)
+				}
+
+				if err != nil {
+					return fmt.Errorf("error migrating %s/%s: %w", string(k), string(v), err)
+				}
+
+				migrated++
+
+				return nil
+			})
+		})
+		if err != nil {
+			return err
+		}
+
+		if migrated != 0 {
+			logger.Infof("migrated platforms of %d versions from %s layout to %s layout",
+				migrated, stored, s.platformLayout)
+		}
+
+		return providersBucket.Put(toBytes(layoutKey), toBytes(s.platformLayout))
+	})
+}
+
+// inlineVersion moves the nested platform buckets of the given version bucket into the inline platforms.
+func inlineVersion(versionBucket *bolt.Bucket) error {
+	ps, err := getInlinePlatforms(versionBucket)
+	if err != nil {
+		return err
+	}
+
+	var keys []string
+
+	err = versionBucket.ForEachBucket(func(k []byte) error {
+		platformBucket := versionBucket.Bucket(k)
+
+		ps[string(k)] = inlinePlatform{
+			Modified: string(platformBucket.Get(toBytes("modified"))),
+			Data:     getValue(platformBucket, "data"),
+		}
+		keys = append(keys, string(k))
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(keys) == 0 {
+		return nil
+	}
+
+	for _, k := range keys {
+		if err = versionBucket.DeleteBucket(toBytes(k)); err != nil {
+			return err
+		}
+	}
+
+	return putInlinePlatforms(versionBucket, ps)
+}
+
+// nestVersion moves the inline platforms of the given version bucket into the nested platform buckets.
+func nestVersion(versionBucket *bolt.Bucket) error {
+	ps, err := getInlinePlatforms(versionBucket)
+	if err != nil {
+		return err
+	}
+
+	if len(ps) == 0 {
+		return nil
+	}
+
+	for k, p := range ps {
+		platformBucket, err := versionBucket.CreateBucketIfNotExists(toBytes(k))
+		if err != nil {
+			return err
+		}
+
+		if len(p.Data) != 0 {
+			if err = putValue(platformBucket, "data", p.Data); err != nil {
+				return err
+			}
+		}
+
+		if p.Modified != "" {
+			if err = platformBucket.Put(toBytes("modified"), toBytes(p.Modified)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return versionBucket.Delete(toBytes(inlinePlatformsKey))
+}
@@ -0,0 +1,153 @@
+package metadata
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/seal-io/hermitcrab/pkg/provider/addrs"
+)
+
+func TestService_migrateLayout(t *testing.T) {
+	env := newTestEnv(t, 0)
+	ctx := context.Background()
+
+	opts := GetPlatformOptions{
+		Hostname:  testHostname,
+		Namespace: "hashicorp",
+		Type:      "null",
+		Version:   "1.1.0",
+		OS:        "linux",
+		Arch:      "amd64",
+	}
+
+	p, err := env.service.GetPlatform(ctx, opts)
+	require.NoError(t, err)
+
+	for _, layout := range []string{PlatformLayoutInline, PlatformLayoutNested} {
+		svc, err := NewService(env.service.boltDriver, ServiceOptions{
+			PlatformLayout: layout,
+			Offline:        true,
+		})
+		require.NoError(t, err)
+
+		// Serve the migrated platform without syncing.
+		mp, err := svc.GetPlatform(ctx, opts)
+		require.NoError(t, err, layout)
+		assert.Equal(t, p, mp, layout)
+
+		err = env.service.boltDriver.View(func(tx *bolt.Tx) error {
+			versionBucket := tx.
+				Bucket(toBytes(domain)).
+				Bucket(toBytes(testHostname + "/hashicorp/null")).
+				Bucket(toBytes("1.1.0"))
+
+			nested := versionBucket.Bucket(toBytes("linux/amd64")) != nil
+			inline := versionBucket.Get(toBytes(inlinePlatformsKey)) != nil
+			assert.Equal(t, layout == PlatformLayoutNested, nested, layout)
+			assert.Equal(t, layout == PlatformLayoutInline, inline, layout)
+
+			return nil
+		})
+		require.NoError(t, err)
+	}
+}
+
+// BenchmarkService_GetPlatform compares the bytes in use, the keys and the latency of the platform layouts,
+// with 200 versions and 12 platforms per version.
+func BenchmarkService_GetPlatform(b *testing.B) {
+	const (
+		versions  = 200
+		platforms = 12
+	)
+
+	for _, layout := range []string{PlatformLayoutNested, PlatformLayoutInline} {
+		b.Run(layout, func(b *testing.B) {
+			p := filepath.Join(b.TempDir(), "metadata.db")
+
+			db, err := bolt.Open(p, 0o600, nil)
+			require.NoError(b, err)
+
+			defer func() { _ = db.Close() }()
+
+			svc, err := NewService(db, ServiceOptions{
+				PlatformLayout: layout,
+				Offline:        true,
+			})
+			require.NoError(b, err)
+
+			s := svc.(*service)
+			addr := addrs.Address{Hostname: testHostname, Namespace: "hashicorp", Type: "null"}
+
+			err = db.Update(func(tx *bolt.Tx) error {
+				typedBucket, err := tx.Bucket(toBytes(domain)).
+					CreateBucket(toBytes(testHostname + "/hashicorp/null"))
+				if err != nil {
+					return err
+				}
+
+				for i := 0; i < versions; i++ {
+					v := fmt.Sprintf("1.%d.0", i)
+
+					versionBucket, err := typedBucket.CreateBucket(toBytes(v))
+					if err != nil {
+						return err
+					}
+
+					err = versionBucket.Put(toBytes("data"), toBytes(`{"version":"`+v+`","platforms":[]}`))
+					if err != nil {
+						return err
+					}
+
+					for j := 0; j < platforms; j++ {
+						pd := fmt.Sprintf(`{"os":"os%d","arch":"arch","filename":"terraform-provider-null_%s_os%d_arch.zip",`+
+							`"download_url":"https://example.com/%s/os%d","shasum":"%064d"}`, j, v, j, v, j, j)
+
+						err = s.putPlatform(versionBucket, addr.WithVersion(v).WithPlatform(fmt.Sprintf("os%d", j), "arch"),
+							time.Now(), toBytes(pd))
+						if err != nil {
+							return err
+						}
+					}
+				}
+
+				return nil
+			})
+			require.NoError(b, err)
+
+			var st bolt.BucketStats
+
+			err = db.View(func(tx *bolt.Tx) error {
+				st = tx.Bucket(toBytes(domain)).Stats()
+				return nil
+			})
+			require.NoError(b, err)
+
+			ctx := context.Background()
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				_, err = svc.GetPlatform(ctx, GetPlatformOptions{
+					Hostname:  testHostname,
+					Namespace: "hashicorp",
+					Type:      "null",
+					Version:   fmt.Sprintf("1.%d.0", i%versions),
+					OS:        fmt.Sprintf("os%d", i%platforms),
+					Arch:      "arch",
+				})
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+
+			b.ReportMetric(float64(st.BranchInuse+st.LeafInuse), "inuse_bytes")
+			b.ReportMetric(float64(st.KeyN), "keys")
+		})
+	}
+}
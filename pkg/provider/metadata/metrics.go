@@ -0,0 +1,125 @@
+package metadata
+
+import (
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tidwall/gjson"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/seal-io/hermitcrab/pkg/database"
+)
+
+const (
+	namespace = "provider"
+	subsystem = "index"
+)
+
+// NewStatsCollector returns the collector of the provider index,
+// which counts the providers, versions and platforms known per hostname.
+func NewStatsCollector(boltDriver database.BoltDriver) prometheus.Collector {
+	return &statsCollector{
+		boltDriver: boltDriver,
+		providers: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "providers"),
+			"The number of providers known per hostname.",
+			[]string{"hostname"}, nil,
+		),
+		versions: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "versions"),
+			"The number of provider versions known per hostname.",
+			[]string{"hostname"}, nil,
+		),
+		platforms: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "platforms"),
+			"The number of provider platforms known per hostname.",
+			[]string{"hostname"}, nil,
+		),
+		keys: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "bucket_keys"),
+			"The number of bolt keys under the providers bucket per hostname.",
+			[]string{"hostname"}, nil,
+		),
+		unparsableVersions: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "unparsable_versions"),
+			"The number of provider versions rejected by the semantic versioning per hostname, "+
+				"which are ordered by the tolerant or lexical fallback.",
+			[]string{"hostname", "fallback"}, nil,
+		),
+	}
+}
+
+type statsCollector struct {
+	boltDriver database.BoltDriver
+
+	providers *prometheus.Desc
+	versions  *prometheus.Desc
+	platforms *prometheus.Desc
+	keys      *prometheus.Desc
+
+	unparsableVersions *prometheus.Desc
+}
+
+func (c *statsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.providers
+	ch <- c.versions
+	ch <- c.platforms
+	ch <- c.keys
+	ch <- c.unparsableVersions
+}
+
+func (c *statsCollector) Collect(ch chan<- prometheus.Metric) {
+	type stats struct {
+		providers, versions, platforms, keys int
+
+		unparsableVersions map[string]int
+	}
+
+	ss := map[string]*stats{}
+
+	_ = c.boltDriver.View(func(tx *bolt.Tx) error {
+		providersBucket := tx.Bucket(toBytes(domain))
+		if providersBucket == nil {
+			return nil
+		}
+
+		return providersBucket.ForEachBucket(func(k []byte) error {
+			hostname, _, ok := strings.Cut(string(k), "/")
+			if !ok {
+				return nil
+			}
+
+			s := ss[hostname]
+			if s == nil {
+				s = &stats{unparsableVersions: map[string]int{}}
+				ss[hostname] = s
+			}
+
+			typedBucket := providersBucket.Bucket(k)
+			s.providers++
+			s.keys += typedBucket.Stats().KeyN
+
+			return typedBucket.ForEachBucket(func(v []byte) error {
+				s.versions++
+				if fb := parseVersion(string(v)).fallback(); fb != "" {
+					s.unparsableVersions[fb]++
+				}
+				s.platforms += int(gjson.GetBytes(getValue(typedBucket.Bucket(v), "data"), "platforms.#").Int())
+
+				return nil
+			})
+		})
+	})
+
+	for hostname, s := range ss {
+		ch <- prometheus.MustNewConstMetric(c.providers, prometheus.GaugeValue, float64(s.providers), hostname)
+		ch <- prometheus.MustNewConstMetric(c.versions, prometheus.GaugeValue, float64(s.versions), hostname)
+		ch <- prometheus.MustNewConstMetric(c.platforms, prometheus.GaugeValue, float64(s.platforms), hostname)
+		ch <- prometheus.MustNewConstMetric(c.keys, prometheus.GaugeValue, float64(s.keys), hostname)
+
+		for _, fb := range []string{VersionFallbackTolerant, VersionFallbackLexical} {
+			ch <- prometheus.MustNewConstMetric(c.unparsableVersions, prometheus.GaugeValue,
+				float64(s.unparsableVersions[fb]), hostname, fb)
+		}
+	}
+}
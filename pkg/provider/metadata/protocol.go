@@ -0,0 +1,49 @@
+package metadata
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// normalizeProtocols returns the major versions of the given protocols,
+// i.e. 5 of 5.0, all protocols are allowed if empty.
+func normalizeProtocols(ps []string) ([]string, error) {
+	if len(ps) == 0 {
+		return nil, nil
+	}
+
+	r := make([]string, 0, len(ps))
+
+	for _, p := range ps {
+		major, _, _ := strings.Cut(strings.TrimSpace(p), ".")
+		if n, err := strconv.Atoi(major); err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid protocol %q", p)
+		}
+
+		if !slices.Contains(r, major) {
+			r = append(r, major)
+		}
+	}
+
+	return r, nil
+}
+
+// isProtocolCompatible returns true if the given protocols of a version
+// share a major version with the allowed protocols,
+// the version without the protocols is always compatible as unknown.
+func (s *service) isProtocolCompatible(ps []string) bool {
+	if s.protocols == nil || len(ps) == 0 {
+		return true
+	}
+
+	for _, p := range ps {
+		major, _, _ := strings.Cut(strings.TrimSpace(p), ".")
+		if slices.Contains(s.protocols, major) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,112 @@
+package metadata
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/seal-io/walrus/utils/json"
+	"github.com/tidwall/gjson"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/seal-io/hermitcrab/pkg/provider/addrs"
+)
+
+// PublishOptions holds the options of publishing a provider platform,
+// i.e. the platform published by the replicating instance after caching its archive.
+type PublishOptions struct {
+	Hostname  string
+	Namespace string
+	Type      string
+	Version   string
+	Protocols []string
+	Platform  Platform
+}
+
+// Publish stores the given platform as synced,
+// the platform is appended to the platforms of the stored version if absent,
+// so that the version only advertises the published platforms until synced from the upstream.
+func (s *service) Publish(_ context.Context, opts PublishOptions) error {
+	addr := addrs.Address{
+		Hostname:  opts.Hostname,
+		Namespace: opts.Namespace,
+		Type:      opts.Type,
+		Version:   opts.Version,
+		OS:        opts.Platform.OS,
+		Arch:      opts.Platform.Arch,
+	}.Normalize()
+	if addr.Validate() != nil || addr.Version == "" || addr.OS == "" || addr.Arch == "" ||
+		opts.Platform.Filename == "" {
+		return errors.New("invalid options")
+	}
+
+	platformB, err := json.Marshal(opts.Platform)
+	if err != nil {
+		return fmt.Errorf("error marshaling platform: %w", err)
+	}
+
+	return s.update(addr, func(tx *bolt.Tx) error {
+		typedBucket, err := tx.
+			Bucket(toBytes(domain)).
+			CreateBucketIfNotExists(toBytes(addr.TypedKey()))
+		if err != nil {
+			return fmt.Errorf("error creating typed bucket: %w", err)
+		}
+
+		versionBucket, err := typedBucket.CreateBucketIfNotExists(toBytes(addr.Version))
+		if err != nil {
+			return fmt.Errorf("error creating version bucket: %w", err)
+		}
+
+		// Merge into the stored version data in place,
+		// which keeps the other fields given by the upstream.
+		versionB := getValue(versionBucket, "data")
+		if len(versionB) == 0 {
+			versionB = toBytes(`{"platforms":[]}`)
+		}
+
+		versionB, err = json.Set(versionB, "version", toBytes(`"`+addr.Version+`"`))
+		if err != nil {
+			return fmt.Errorf("error setting version: %w", err)
+		}
+
+		if len(opts.Protocols) != 0 {
+			protocolsB, err := json.Marshal(opts.Protocols)
+			if err != nil {
+				return fmt.Errorf("error marshaling protocols: %w", err)
+			}
+
+			versionB, err = json.Set(versionB, "protocols", protocolsB)
+			if err != nil {
+				return fmt.Errorf("error setting protocols: %w", err)
+			}
+		}
+
+		found := false
+
+		json.Get(versionB, "platforms").ForEach(func(_, p gjson.Result) bool {
+			found = p.Get("os").String() == addr.OS && p.Get("arch").String() == addr.Arch
+			return !found
+		})
+
+		if !found {
+			versionB, err = json.Set(versionB, "platforms.-1",
+				toBytes(`{"os":"`+addr.OS+`","arch":"`+addr.Arch+`"}`))
+			if err != nil {
+				return fmt.Errorf("error setting platforms: %w", err)
+			}
+		}
+
+		err = putValue(versionBucket, "data", versionB)
+		if err != nil {
+			return fmt.Errorf("error putting version bucket: %w", err)
+		}
+
+		err = s.putPlatform(versionBucket, addr, s.clock(), platformB)
+		if err != nil {
+			return fmt.Errorf("error putting platform: %w", err)
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,63 @@
+package metadata
+
+import (
+	"context"
+	"time"
+
+	"github.com/seal-io/walrus/utils/gopool"
+	"github.com/seal-io/walrus/utils/log"
+
+	"github.com/seal-io/hermitcrab/pkg/maintenance"
+	"github.com/seal-io/hermitcrab/pkg/provider/addrs"
+)
+
+// DefaultSoftTTL is the default age of the stored versions of a provider,
+// beyond which reading them triggers refreshing in background,
+// which is shorter than the interval of the scheduled sync.
+const DefaultSoftTTL = 10 * time.Minute
+
+// refreshStale refreshes the versions of the given provider in background
+// if the stored ones are older than the soft TTL, the reader is never blocked,
+// the refreshing is triggered at most once per soft TTL,
+// so that the failing upstream is not hammered by the readers.
+func (s *service) refreshStale(addr addrs.Address, modified time.Time) {
+	// Skip the provider never synced from the upstream, i.e. the published one.
+	if s.softTTL <= 0 || s.offline || modified.IsZero() {
+		return
+	}
+
+	now := s.clock()
+	if now.Sub(modified) < s.softTTL {
+		return
+	}
+
+	if maintenance.Enabled() || s.isSyncing(addr.TypedKey()) || s.isBackingOff(addr) {
+		return
+	}
+
+	key := addr.TypedKey()
+
+	if v, ok := s.refreshed.Load(key); ok && now.Sub(v.(time.Time)) < s.softTTL {
+		return
+	}
+
+	s.refreshed.Store(key, now)
+
+	gopool.Go(func() {
+		logger := log.WithName("provider").WithName("metadata").
+			WithValues(addr.LogValues()...)
+
+		ctx, cancel := context.WithTimeout(context.Background(), backgroundSyncTimeout)
+		defer cancel()
+
+		if !s.paceSync(ctx, addr) {
+			return
+		}
+
+		logger.V(4).Infof("refreshing versions stale since %s", modified.Format(time.RFC3339))
+
+		if err := s.syncVersions(ctx, addr); err != nil {
+			logger.Warnf("error refreshing stale versions: %v", err)
+		}
+	})
+}
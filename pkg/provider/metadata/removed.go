@@ -0,0 +1,187 @@
+package metadata
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/seal-io/walrus/utils/errorx"
+	"github.com/seal-io/walrus/utils/json"
+	"github.com/seal-io/walrus/utils/log"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/seal-io/hermitcrab/pkg/provider/addrs"
+)
+
+const (
+	// removedKey is the key of the version bucket, which marks the version as removed from the upstream,
+	// i.e. the version is gone from the upstream versions list, the uncached platforms are never fetched,
+	// which is cleared once the upstream lists the version again, takes a look of the key:
+	//
+	//	BUCKET({version}):
+	//	  KEY(removed): string, RFC3339
+	removedKey = "removed"
+	// removedPlatformsKey is the key of the version bucket, which marks the platforms as removed from the upstream,
+	// i.e. the upstream responds 404 or 410 for the platform, the removed platform is not re-fetched,
+	// which is cleared once the upstream lists the version again, takes a look of the key:
+	//
+	//	BUCKET({version}):
+	//	  KEY(removed_platforms): map[{platform}]string, RFC3339
+	removedPlatformsKey = "removed_platforms"
+)
+
+var (
+	// ErrVersionRemoved is returned if the version is removed from the upstream.
+	ErrVersionRemoved = errors.New("version removed from upstream")
+	// ErrPlatformRemoved is returned if the platform is removed from the upstream.
+	ErrPlatformRemoved = errors.New("platform removed from upstream")
+)
+
+// isRemoved returns true if the given version bucket is marked as removed from the upstream.
+func isRemoved(versionBucket *bolt.Bucket) bool {
+	return len(getValue(versionBucket, removedKey)) != 0
+}
+
+// getRemovedPlatforms returns the platforms of the given version bucket marked as removed from the upstream.
+func getRemovedPlatforms(versionBucket *bolt.Bucket) map[string]string {
+	ps := map[string]string{}
+
+	if data := getValue(versionBucket, removedPlatformsKey); len(data) != 0 {
+		_ = json.Unmarshal(data, &ps)
+	}
+
+	return ps
+}
+
+// isPlatformRemoved returns true if the platform of the given key is marked as removed from the upstream.
+func isPlatformRemoved(versionBucket *bolt.Bucket, key string) bool {
+	_, ok := getRemovedPlatforms(versionBucket)[key]
+	return ok
+}
+
+// markRemoved marks the given version bucket as removed from the upstream,
+// returns true if marked newly.
+func markRemoved(versionBucket *bolt.Bucket, now time.Time) (bool, error) {
+	if isRemoved(versionBucket) {
+		return false, nil
+	}
+
+	return true, putValue(versionBucket, removedKey, toBytes(now.Format(time.RFC3339)))
+}
+
+// clearRemoved clears the marks of the given version bucket and its platforms,
+// returns true if any mark is cleared.
+func clearRemoved(versionBucket *bolt.Bucket) (bool, error) {
+	var cleared bool
+
+	for _, k := range []string{removedKey, removedPlatformsKey} {
+		if versionBucket.Get(toBytes(k)) == nil {
+			continue
+		}
+
+		if err := versionBucket.Delete(toBytes(k)); err != nil {
+			return false, err
+		}
+
+		cleared = true
+	}
+
+	return cleared, nil
+}
+
+// markPlatformRemoved marks the platform of the given address as removed from the upstream.
+func (s *service) markPlatformRemoved(addr addrs.Address) error {
+	var marked bool
+
+	err := s.update(addr, func(tx *bolt.Tx) error {
+		typedBucket := tx.
+			Bucket(toBytes(domain)).
+			Bucket(toBytes(addr.TypedKey()))
+		if typedBucket == nil {
+			return nil
+		}
+
+		versionBucket := typedBucket.Bucket(toBytes(addr.Version))
+		if versionBucket == nil {
+			return nil
+		}
+
+		ps := getRemovedPlatforms(versionBucket)
+		if _, ok := ps[addr.PlatformKey()]; ok {
+			return nil
+		}
+
+		ps[addr.PlatformKey()] = s.clock().Format(time.RFC3339)
+
+		data, err := json.Marshal(ps)
+		if err != nil {
+			return fmt.Errorf("error marshaling removed platforms: %w", err)
+		}
+
+		marked = true
+
+		return putValue(versionBucket, removedPlatformsKey, data)
+	})
+	if err != nil {
+		return err
+	}
+
+	if marked {
+		log.WithName("provider").WithName("metadata").
+			WithValues(addr.LogValues()...).
+			Warn("platform is removed from the upstream, stop re-fetching until listed again")
+	}
+
+	return nil
+}
+
+// removedError returns the error responding 410 for the removed version or platform.
+func removedError(err error) error {
+	if errors.Is(err, ErrPlatformRemoved) {
+		return errorx.WrapHttpError(http.StatusGone, err, "platform is removed from the upstream")
+	}
+
+	return errorx.WrapHttpError(http.StatusGone, err, "version is removed from the upstream")
+}
+
+// markGone marks the stored versions of the given typed bucket absent from the given listed versions as removed,
+// returns the newly marked versions, nothing is marked if the upstream lists no version.
+func (s *service) markGone(typedBucket *bolt.Bucket, listed []string) ([]string, error) {
+	if len(listed) == 0 {
+		return nil, nil
+	}
+
+	ls := make(map[string]struct{}, len(listed))
+	for _, v := range listed {
+		ls[v] = struct{}{}
+	}
+
+	var stored []string
+
+	err := typedBucket.ForEachBucket(func(k []byte) error {
+		if _, ok := ls[string(k)]; !ok {
+			stored = append(stored, string(k))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var gone []string
+
+	for _, v := range stored {
+		marked, err := markRemoved(typedBucket.Bucket(toBytes(v)), s.clock())
+		if err != nil {
+			return nil, err
+		}
+
+		if marked {
+			gone = append(gone, v)
+		}
+	}
+
+	return gone, nil
+}
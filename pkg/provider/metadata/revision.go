@@ -0,0 +1,30 @@
+package metadata
+
+import (
+	"context"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/seal-io/hermitcrab/pkg/provider/addrs"
+)
+
+// update changes the stored metadata of the given typed provider within a read-write transaction,
+// the revision of the typed provider increases if succeeded.
+func (s *service) update(addr addrs.Address, fn func(tx *bolt.Tx) error) error {
+	err := s.boltDriver.Update(fn)
+	if err == nil {
+		s.revisions.Store(addr.TypedKey(), s.revision.Add(1))
+	}
+
+	return err
+}
+
+// GetRevision returns the revision of the stored metadata of the given typed provider,
+// which changes once the stored metadata changes, zero if never changed since started.
+func (s *service) GetRevision(_ context.Context, addr addrs.Address) uint64 {
+	if v, ok := s.revisions.Load(addr.Normalize().TypedKey()); ok {
+		return v.(uint64)
+	}
+
+	return 0
+}
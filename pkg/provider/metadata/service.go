@@ -1,17 +1,17 @@
 package metadata
 
 import (
-	"bytes"
 	"context"
 	"errors"
 	"fmt"
-	"path"
+	"net/http"
 	"runtime"
 	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/Masterminds/semver/v3"
+	"github.com/seal-io/walrus/utils/errorx"
 	"github.com/seal-io/walrus/utils/gopool"
 	"github.com/seal-io/walrus/utils/json"
 	"github.com/seal-io/walrus/utils/log"
@@ -22,7 +22,12 @@ import (
 	"go.uber.org/multierr"
 
 	"github.com/seal-io/hermitcrab/pkg/database"
+	"github.com/seal-io/hermitcrab/pkg/events"
+	"github.com/seal-io/hermitcrab/pkg/maintenance"
+	"github.com/seal-io/hermitcrab/pkg/provider/addrs"
 	"github.com/seal-io/hermitcrab/pkg/registry"
+	"github.com/seal-io/hermitcrab/pkg/timing"
+	"github.com/seal-io/hermitcrab/pkg/tunable"
 )
 
 var (
@@ -63,16 +68,26 @@ type (
 	// Version holds the information of provider version.
 	Version struct {
 		Version   string     `json:"version"`
+		Protocols []string   `json:"protocols,omitempty"`
 		Platforms []Platform `json:"platforms"`
+		// Canary indicates the version is only visible to the canary clients.
+		Canary bool `json:"canary,omitempty"`
+		// Removed indicates the version is removed from the upstream,
+		// only the cached platforms are served.
+		Removed bool `json:"removed,omitempty"`
 	}
 
 	// Platform holds the information of provider platform.
 	Platform struct {
-		OS          string `json:"os"`
-		Arch        string `json:"arch"`
-		Filename    string `json:"filename"`
-		Shasum      string `json:"shasum"`
-		DownloadURL string `json:"download_url"`
+		Protocols           []string        `json:"protocols,omitempty"`
+		OS                  string          `json:"os"`
+		Arch                string          `json:"arch"`
+		Filename            string          `json:"filename"`
+		Shasum              string          `json:"shasum"`
+		DownloadURL         string          `json:"download_url"`
+		ShasumsURL          string          `json:"shasums_url,omitempty"`
+		ShasumsSignatureURL string          `json:"shasums_signature_url,omitempty"`
+		SigningKeys         json.RawMessage `json:"signing_keys,omitempty"`
 	}
 
 	// Service holds the operation of providers.
@@ -82,6 +97,9 @@ type (
 	//	  BUCKET({hostname}/{namespace}/{type})
 	//	    KEY(modified): string, RFC3339 *
 	//	    BUCKET({version}):
+	//	      KEY(shasums): map[{filename}]string, see ImportShasums.
+	//	      KEY(canary): bool, see SetCanary.
+	//	      KEY(removed): string, RFC3339, see ErrVersionRemoved.
 	//	      KEY(data): struct{
 	//	        version: string
 	//	        protocols: []string
@@ -90,7 +108,7 @@ type (
 	//	          arch: string
 	//	        }
 	//	      }
-	//	      BUCKET({platform}):
+	//	      BUCKET({platform}): in nested layout, see PlatformLayoutInline for the inline layout.
 	//	        KEY(modified): string, RFC3339 *
 	//	        KEY(data): {
 	//	          protocols: []string
@@ -102,7 +120,7 @@ type (
 	//	          shasums_signature_url: string
 	//	          shasum: string
 	//	          signing_keys: {
-	//	            gpg_public_keys: []{
+	//	            gpg_public_keys: []{ only key_id if referencing the key stored in keysDomain.
 	//	              key_id: string
 	//	              ascii_armor: string
 	//	              trust_signature: string
@@ -118,32 +136,213 @@ type (
 		GetVersion(context.Context, GetVersionOptions) (Version, error)
 		// GetPlatform gets detail of a specified provider version.
 		GetPlatform(context.Context, GetPlatformOptions) (Platform, error)
-		// Sync does synchronization from remote to local.
+		// Sync does synchronization from remote to local,
+		// the overlapping calls join the ongoing one.
 		Sync(context.Context) error
+		// WalkPlatforms walks the stored platforms without syncing from remote,
+		// the Platform only has the OS, Arch and Filename if not synced yet,
+		// stops walking if the given function returns error.
+		WalkPlatforms(context.Context, func(addrs.Address, Platform) error) error
+		// GetSyncHistory gets the recent sync attempts of a specified provider, newest first.
+		GetSyncHistory(context.Context, GetSyncHistoryOptions) ([]SyncAttempt, error)
+		// GetSyncDiff gets the net changes of a specified provider between two sync points,
+		// which is generated from the sync history.
+		GetSyncDiff(context.Context, GetSyncDiffOptions) (SyncDiff, error)
+		// HasProvider returns true if the given typed provider is stored without syncing from remote.
+		HasProvider(context.Context, addrs.Address) bool
+		// ListProviders lists the stored typed providers without syncing from remote,
+		// the malformed ones are skipped.
+		ListProviders(context.Context) ([]addrs.Address, error)
+		// GetSyncActivities returns the ongoing synchronizations, oldest first.
+		GetSyncActivities(context.Context) []SyncActivity
+		// GetDegradedProviders returns the providers exhausting the sync error budget in typed key order,
+		// the scheduled sync of which is backed off.
+		GetDegradedProviders(context.Context) []DegradedProvider
+		// GetSigningKeys gets the GPG public keys of the stored platforms of a specified provider
+		// without syncing from remote, ordered by the key ID.
+		GetSigningKeys(context.Context, GetSigningKeysOptions) ([]GPGPublicKey, error)
+		// ImportShasums imports the SHA256SUMS file of a specified provider version,
+		// which backfills the shasums of the stored platforms, returns the imported filenames.
+		ImportShasums(context.Context, ImportShasumsOptions) ([]string, error)
+		// SetCanary marks or unmarks a specified provider version as canary,
+		// which is only visible to the canary clients.
+		SetCanary(context.Context, SetCanaryOptions) error
+		// IsCanary returns true if the given provider version is marked as canary without syncing from remote.
+		IsCanary(context.Context, addrs.Address) bool
+		// GetPlatformByShasum gets the stored platform whose archive matches the given sha256 checksum
+		// without syncing from remote, returns the address of the platform along with it.
+		GetPlatformByShasum(ctx context.Context, shasum string) (addrs.Address, Platform, error)
+		// GetRevision returns the revision of the stored metadata of the given typed provider,
+		// which changes once the stored metadata changes, zero if never changed since started.
+		GetRevision(context.Context, addrs.Address) uint64
+		// Publish stores a specified provider platform published by the replicating instance,
+		// which is appended to the platforms of the stored version.
+		Publish(context.Context, PublishOptions) error
+		// DeleteVersions deletes the stored versions of the given typed provider,
+		// which are synced from remote again on the next syncing, returns the deleted versions.
+		DeleteVersions(ctx context.Context, addr addrs.Address, versions []string) ([]string, error)
 	}
 )
 
 const domain = "providers"
 
+// ServiceOptions holds the options of the metadata service.
+type ServiceOptions struct {
+	// MaxVersions is the maximum number of versions retained per provider,
+	// the oldest versions beyond it are pruned during syncing,
+	// unlimited if not positive.
+	MaxVersions int
+	// Pruned is called with the pruned versions of the provider,
+	// which can be used to clean up the related resources.
+	Pruned func(ctx context.Context, addr addrs.Address, versions []string)
+	// Added is called with the new versions of the provider discovered by syncing, newest first,
+	// which is not called for the first syncing of the provider.
+	Added func(ctx context.Context, addr addrs.Address, versions []string)
+	// MaxSyncHistory is the maximum number of sync attempts retained per provider,
+	// default is DefaultMaxSyncHistory if not positive.
+	MaxSyncHistory int
+	// Clock returns the current time, default is time.Now.
+	Clock func() time.Time
+	// Source returns the UpstreamSource of the given hostname,
+	// default is the one configured in the registry package.
+	Source func(ctx context.Context, hostname string) (registry.UpstreamSource, error)
+	// Offline never syncs from the upstream,
+	// only the stored metadata is served.
+	Offline bool
+	// PlatformLayout is the layout of storing the platforms of a version,
+	// select from PlatformLayoutNested and PlatformLayoutInline,
+	// the stored platforms are migrated if changed,
+	// default is PlatformLayoutNested.
+	PlatformLayout string
+	// EagerPlatformSync holds the patterns of the providers whose platforms of the newest versions
+	// are synced in background after syncing the versions,
+	// in form of [<HOSTNAME>/]<NAMESPACE>/<TYPE> with the shell globs, i.e. hashicorp/aws,
+	// the other providers sync the platforms on demand,
+	// all providers are synced eagerly if nil.
+	EagerPlatformSync []string
+	// Protocols holds the major versions of the plugin protocols used by the clients, i.e. 5 and 6,
+	// the versions only supporting the other protocols are skipped during syncing,
+	// all versions are synced if empty.
+	Protocols []string
+	// HideRemoved hides the versions removed from the upstream,
+	// otherwise, the cached platforms of them are still served.
+	HideRemoved bool
+	// UpstreamBudget is the maximum duration of the upstream calls of a query marked by WithUpstreamBudget,
+	// the query responds 503 with the Retry-After if exceeded, while the syncing continues in background,
+	// unlimited if not positive.
+	UpstreamBudget time.Duration
+	// SoftTTL is the age of the stored versions of a provider,
+	// beyond which reading them triggers refreshing in background,
+	// disabled if not positive.
+	SoftTTL time.Duration
+	// ShadowSampleRate is the ratio of the queries served from the cache,
+	// which are compared against the upstream in background to detect the silent staleness or corruption,
+	// in range of [0, 1], disabled if not positive.
+	ShadowSampleRate float64
+	// ProbeUnlisted fetches the platform not listed in the version from the upstream,
+	// otherwise, responds 404 with the published platforms of the version without asking the upstream.
+	ProbeUnlisted bool
+}
+
 // NewService returns a new metadata service.
-func NewService(boltDriver database.BoltDriver) (Service, error) {
+func NewService(boltDriver database.BoltDriver, opts ServiceOptions) (Service, error) {
 	err := boltDriver.Update(func(tx *bolt.Tx) error {
-		_, err := tx.CreateBucketIfNotExists(toBytes(domain))
-		return err
+		for _, d := range []string{domain, historyDomain, keysDomain} {
+			if _, err := tx.CreateBucketIfNotExists(toBytes(d)); err != nil {
+				return err
+			}
+		}
+
+		return buildDigests(tx)
 	})
 	if err != nil {
 		return nil, fmt.Errorf("error creating providers bucket: %w", err)
 	}
 
-	return &service{
-		boltDriver: boltDriver,
-	}, nil
+	if opts.MaxSyncHistory <= 0 {
+		opts.MaxSyncHistory = DefaultMaxSyncHistory
+	}
+
+	if opts.Clock == nil {
+		opts.Clock = time.Now
+	}
+
+	if opts.Source == nil {
+		opts.Source = func(ctx context.Context, hostname string) (registry.UpstreamSource, error) {
+			return registry.Host(hostname).Source(ctx)
+		}
+	}
+
+	if opts.PlatformLayout == "" {
+		opts.PlatformLayout = PlatformLayoutNested
+	}
+
+	eager, err := normalizeProviderPatterns(opts.EagerPlatformSync)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing eager platform sync: %w", err)
+	}
+
+	protocols, err := normalizeProtocols(opts.Protocols)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing protocols: %w", err)
+	}
+
+	s := &service{
+		boltDriver:     boltDriver,
+		maxVersions:    opts.MaxVersions,
+		maxSyncHistory: opts.MaxSyncHistory,
+		pruned:         opts.Pruned,
+		added:          opts.Added,
+		clock:          opts.Clock,
+		source:         opts.Source,
+		offline:        opts.Offline,
+		platformLayout: opts.PlatformLayout,
+
+		eagerPlatformSync: eager,
+		protocols:         protocols,
+		hideRemoved:       opts.HideRemoved,
+		upstreamBudget:    opts.UpstreamBudget,
+		softTTL:           opts.SoftTTL,
+		shadowRate:        opts.ShadowSampleRate,
+		probeUnlisted:     opts.ProbeUnlisted,
+	}
+
+	err = s.migrateLayout()
+	if err != nil {
+		return nil, fmt.Errorf("error migrating platform layout: %w", err)
+	}
+
+	return s, nil
 }
 
 type service struct {
-	syncing sync.Map
-
-	boltDriver database.BoltDriver
+	syncing   sync.Map
+	deferred  sync.Map
+	failures  sync.Map
+	revisions sync.Map
+	refreshed sync.Map
+	shadowing sync.Map
+	revision  atomic.Uint64
+	fullMu    sync.Mutex
+	full      *fullSync
+
+	boltDriver     database.BoltDriver
+	maxVersions    int
+	maxSyncHistory int
+	pruned         func(context.Context, addrs.Address, []string)
+	added          func(context.Context, addrs.Address, []string)
+	clock          func() time.Time
+	source         func(context.Context, string) (registry.UpstreamSource, error)
+	offline        bool
+	platformLayout string
+
+	eagerPlatformSync []string
+	protocols         []string
+	hideRemoved       bool
+	upstreamBudget    time.Duration
+	softTTL           time.Duration
+	shadowRate        float64
+	probeUnlisted     bool
 }
 
 func (s *service) GetVersions(ctx context.Context, opts GetVersionsOptions) ([]Version, error) {
@@ -195,41 +394,56 @@ type QueryOptions struct {
 	Arch      string
 }
 
+// Address returns the provider address of the options.
+func (opts QueryOptions) Address() addrs.Address {
+	return addrs.Address(opts).Normalize()
+}
+
 // Query is the underlay of GetVersions, GetVersion and GetPlatform.
 func (s *service) Query(ctx context.Context, opts QueryOptions) ([]Version, error) {
-	if opts.Hostname == "" || opts.Namespace == "" || opts.Type == "" {
+	addr := opts.Address()
+	if addr.Validate() != nil {
 		return nil, errors.New("invalid options")
 	}
 
 	logger := log.WithName("provider").WithName("metadata")
 
-	var queried []Version
+	ctx = s.startBudget(ctx)
 
+	var (
+		queried  []Version
+		modified time.Time
+	)
+
+	stop := timing.Track(ctx, timing.PhaseBolt)
 	err := s.boltDriver.View(func(tx *bolt.Tx) error {
 		typedBucket := tx.
 			Bucket(toBytes(domain)).
-			Bucket(toBytes(path.Join(opts.Hostname, opts.Namespace, opts.Type)))
+			Bucket(toBytes(addr.TypedKey()))
 		if typedBucket == nil {
 			return ErrTypedNotFound
 		}
 
-		logger := logger.WithValues(
-			"hostname", opts.Hostname, "namespace", opts.Namespace, "type", opts.Type)
+		logger := logger.WithValues(addr.Typed().LogValues()...)
+
+		if modifiedB := typedBucket.Get(toBytes("modified")); len(modifiedB) != 0 {
+			modified, _ = time.Parse(time.RFC3339, string(modifiedB))
+		}
 
 		// Deep in one version.
-		if opts.Version != "" {
-			versionBucket := typedBucket.Bucket(toBytes(opts.Version))
+		if addr.Version != "" {
+			versionBucket := typedBucket.Bucket(toBytes(addr.Version))
 			if versionBucket == nil {
 				return ErrVersionNotFound
 			}
 
-			data := bytes.Clone(versionBucket.Get(toBytes("data")))
+			data := getValue(versionBucket, "data")
 			if len(data) == 0 {
 				return ErrVersionIncomplete
 			}
 
 			logger := logger.WithValues(
-				"version", opts.Version)
+				"version", addr.Version)
 
 			var version Version
 			if err := json.Unmarshal(data, &version); err != nil {
@@ -238,21 +452,48 @@ func (s *service) Query(ctx context.Context, opts QueryOptions) ([]Version, erro
 				return fmt.Errorf("error unmarshaling version: %w", err)
 			}
 
+			// Never serve the version stored before the allowed protocols changed.
+			if !s.isProtocolCompatible(version.Protocols) {
+				return ErrVersionNotFound
+			}
+
+			version.Canary = isCanary(versionBucket)
+			version.Removed = isRemoved(versionBucket)
+
+			if version.Removed && s.hideRemoved {
+				return ErrVersionRemoved
+			}
+
+			getPlatform := platformsOf(versionBucket)
+
 			// Deep in a platform.
-			if opts.OS != "" && opts.Arch != "" {
-				platformBucket := versionBucket.Bucket(toBytes(path.Join(opts.OS, opts.Arch)))
-				if platformBucket == nil {
+			if addr.OS != "" && addr.Arch != "" {
+				_, data, found := getPlatform(addr.PlatformKey())
+				if version.Removed && (!found || len(data) == 0) {
+					return ErrVersionRemoved
+				}
+
+				if (!found || len(data) == 0) && isPlatformRemoved(versionBucket, addr.PlatformKey()) {
+					return ErrPlatformRemoved
+				}
+
+				if !found {
+					// Answer from the listing without asking the upstream,
+					// which never publishes the platform.
+					if !s.probeUnlisted && !version.publishes(addr.OS, addr.Arch) {
+						return notPublishedError(version, addr.OS, addr.Arch)
+					}
+
 					return ErrPlatformNotFound
 				}
 
-				data := bytes.Clone(platformBucket.Get(toBytes("data")))
 				if len(data) == 0 {
 					return ErrPlatformIncomplete
 				}
 
 				var platform Platform
 				if err := json.Unmarshal(data, &platform); err != nil {
-					logger.WithValues("os", opts.OS, "arch", opts.Arch).
+					logger.WithValues("os", addr.OS, "arch", addr.Arch).
 						Warnf("malformed JSON string: %s", string(data))
 
 					return fmt.Errorf("error unmarshaling platform: %w", err)
@@ -270,20 +511,28 @@ func (s *service) Query(ctx context.Context, opts QueryOptions) ([]Version, erro
 			}
 
 			// Otherwise, iterate over all available platforms.
+			removedPlatforms := getRemovedPlatforms(versionBucket)
+
 			for _, p := range version.Platforms {
-				platformBucket := versionBucket.Bucket(toBytes(path.Join(p.OS, p.Arch)))
-				if platformBucket == nil {
+				k := addr.WithPlatform(p.OS, p.Arch).PlatformKey()
+
+				_, data, found := getPlatform(k)
+				if _, removed := removedPlatforms[k]; (version.Removed || removed) && (!found || len(data) == 0) {
+					// Only serve the cached platforms of the removed version or platforms.
+					continue
+				}
+
+				if !found {
 					return ErrPlatformsIncomplete
 				}
 
-				data := bytes.Clone(platformBucket.Get(toBytes("data")))
 				if len(data) == 0 {
 					return ErrPlatformIncomplete
 				}
 
 				var platform Platform
 				if err := json.Unmarshal(data, &platform); err != nil {
-					logger.WithValues("os", opts.OS, "arch", opts.Arch).
+					logger.WithValues("os", addr.OS, "arch", addr.Arch).
 						Warnf("malformed JSON string: %s", string(data))
 
 					return fmt.Errorf("error unmarshaling platform: %w", err)
@@ -305,19 +554,31 @@ func (s *service) Query(ctx context.Context, opts QueryOptions) ([]Version, erro
 		err := typedBucket.ForEachBucket(func(versionBucketName []byte) error {
 			versionBucket := typedBucket.Bucket(versionBucketName)
 
-			data := bytes.Clone(versionBucket.Get(toBytes("data")))
+			data := getValue(versionBucket, "data")
 			if len(data) == 0 {
 				return ErrVersionIncomplete
 			}
 
 			var version Version
 			if err := json.Unmarshal(data, &version); err != nil {
-				logger.WithValues("version", opts.Version).
+				logger.WithValues("version", addr.Version).
 					Warnf("malformed JSON string: %s", string(data))
 
 				return fmt.Errorf("error unmarshaling version: %w", err)
 			}
 
+			// Never serve the version stored before the allowed protocols changed.
+			if !s.isProtocolCompatible(version.Protocols) {
+				return nil
+			}
+
+			version.Canary = isCanary(versionBucket)
+			version.Removed = isRemoved(versionBucket)
+
+			if version.Removed && s.hideRemoved {
+				return nil
+			}
+
 			queried = append(queried, version)
 
 			return nil
@@ -328,113 +589,200 @@ func (s *service) Query(ctx context.Context, opts QueryOptions) ([]Version, erro
 
 		return nil
 	})
+
+	stop()
+
 	if err == nil {
+		// Refresh the stale index without blocking the reader.
+		if addr.Version == "" {
+			s.refreshStale(addr.Typed(), modified)
+		}
+
+		// Compare a sample of the served results against the upstream in background.
+		s.shadow(addr, modified, queried)
+
 		return queried, nil
 	}
 
-	const wait = 500 * time.Millisecond
+	if errors.Is(err, ErrVersionRemoved) || errors.Is(err, ErrPlatformRemoved) {
+		return queried, removedError(err)
+	}
+
+	// Never sync from the upstream in offline mode.
+	if s.offline {
+		if errors.Is(err, ErrTypedNotFound) ||
+			errors.Is(err, ErrVersionNotFound) ||
+			errors.Is(err, ErrPlatformNotFound) {
+			err = errorx.WrapHttpError(http.StatusNotFound, err, "not found in offline mode")
+		}
+
+		return queried, err
+	}
+
+	// Answer from the cache during the maintenance.
+	if maintenance.Enabled() {
+		switch {
+		case errors.Is(err, ErrPlatformsIncomplete):
+			return queried, nil
+		case errors.Is(err, ErrTypedNotFound) ||
+			errors.Is(err, ErrVersionNotFound) ||
+			errors.Is(err, ErrPlatformNotFound):
+			return queried, maintenance.Error("syncing")
+		}
+
+		return queried, err
+	}
+
+	// Wait a while for the syncing of others.
+	await := func() error {
+		if exceedsBudget(ctx) {
+			return s.budgetError()
+		}
+
+		defer timing.Track(ctx, timing.PhaseUpstream)()
+
+		time.Sleep(500 * time.Millisecond)
+
+		return nil
+	}
 
 	switch {
 	case errors.Is(err, ErrPlatformNotFound):
 		// Wait a while to get the latest platform.
-		if s.isSyncing(path.Join(opts.Hostname, opts.Namespace, opts.Type, opts.Version, opts.OS, opts.Arch)) {
-			time.Sleep(wait)
+		if s.isSyncing(addr.String()) {
+			if err = await(); err != nil {
+				return queried, err
+			}
+
 			return s.Query(ctx, opts)
 		}
 
 		// Otherwise, sync the platform.
-		err = s.syncPlatform(ctx,
-			opts.Hostname, opts.Namespace, opts.Type, opts.Version, opts.OS, opts.Arch)
+		err = s.withinBudget(ctx, func(ctx context.Context) error {
+			return s.syncPlatform(ctx, addr)
+		})
 		if err == nil {
 			runtime.Gosched()
 			return s.Query(ctx, opts)
 		}
 	case errors.Is(err, ErrPlatformsIncomplete):
 		// Wait a while to get the full platforms.
-		if s.isSyncing(path.Join(opts.Hostname, opts.Namespace, opts.Type, opts.Version)) {
-			time.Sleep(wait)
+		if s.isSyncing(addr.Versioned().String()) {
+			if err = await(); err != nil {
+				return queried, err
+			}
+
 			return s.Query(ctx, opts)
 		}
 
 		// Otherwise, sync all platforms.
-		err = s.syncPlatforms(ctx,
-			opts.Hostname, opts.Namespace, opts.Type, opts.Version)
+		err = s.withinBudget(ctx, func(ctx context.Context) error {
+			return s.syncPlatforms(ctx, addr.Versioned())
+		})
 		if err == nil {
 			runtime.Gosched()
 			return s.Query(ctx, opts)
 		}
 	case errors.Is(err, ErrTypedNotFound):
 		// Wait a while to get the latest versions.
-		if s.isSyncing(path.Join(opts.Hostname, opts.Namespace, opts.Type)) {
-			time.Sleep(wait)
+		if s.isSyncing(addr.TypedKey()) {
+			if err = await(); err != nil {
+				return queried, err
+			}
+
 			return s.Query(ctx, opts)
 		}
 
 		// Otherwise, sync versions.
-		err = s.syncVersions(ctx,
-			opts.Hostname, opts.Namespace, opts.Type)
+		err = s.withinBudget(ctx, func(ctx context.Context) error {
+			return s.syncVersions(ctx, addr.Typed())
+		})
 		if err == nil {
 			runtime.Gosched()
 			return s.Query(ctx, opts)
 		}
 	}
 
+	if errors.Is(err, ErrVersionRemoved) || errors.Is(err, ErrPlatformRemoved) {
+		err = removedError(err)
+	}
+
 	return queried, err
 }
 
 func (s *service) Sync(ctx context.Context) error {
-	typedBucketNames := make([][3][]byte, 0, 64)
+	if s.offline {
+		return nil
+	}
 
-	err := s.boltDriver.View(func(tx *bolt.Tx) error {
-		sp := []byte("/")
+	if err := maintenance.Error("syncing"); err != nil {
+		return err
+	}
 
-		return tx.Bucket(toBytes(domain)).ForEachBucket(func(k []byte) error {
-			keys := bytes.SplitN(bytes.Clone(k), sp, 3)
-			if len(keys) == 3 {
-				typedBucketNames = append(typedBucketNames, [3][]byte{
-					bytes.Clone(keys[0]), // Hostname.
-					bytes.Clone(keys[1]), // Namespace.
-					bytes.Clone(keys[2]), // Type.
-				})
-			}
+	// Join the ongoing synchronization if overlapped,
+	// i.e. the manual sync during the scheduled one.
+	return s.joinSync(ctx, s.syncAll)
+}
 
-			return nil
-		})
-	})
+// syncAll syncs the versions of all stored providers.
+func (s *service) syncAll(ctx context.Context) error {
+	// Copy the typed providers up front,
+	// so that the syncing never holds the transaction.
+	typedAddrs, err := s.ListProviders(ctx)
 	if err != nil {
 		return err
 	}
 
-	if len(typedBucketNames) == 0 {
+	if len(typedAddrs) == 0 {
 		return nil
 	}
 
-	const batch = 10
+	// Sync every 10 providers by a worker,
+	// or spread the providers over the tunable parallelism.
+	batch := 10
+	if p := tunable.Get().SyncParallelism; p > 0 {
+		batch = (len(typedAddrs) + p - 1) / p
+	}
+
 	wg := gopool.Group()
 
-	for i, t := 0, len(typedBucketNames); i < t; {
+	for i, t := 0, len(typedAddrs); i < t; {
 		j := i + batch
 		if j >= t {
 			j = t
 		}
 
-		func(typedBucketNames [][3][]byte) {
+		func(typedAddrs []addrs.Address) {
 			wg.Go(func() (err error) {
-				for k := range typedBucketNames {
-					typedBucketName := typedBucketNames[k]
-
-					err = multierr.Append(err,
-						s.syncVersions(ctx,
-							string(typedBucketName[0]),
-							string(typedBucketName[1]),
-							string(typedBucketName[2]),
-						),
-					)
+				for k := range typedAddrs {
+					// Skip the degraded provider until the backoff elapses.
+					if s.isBackingOff(typedAddrs[k]) {
+						continue
+					}
+
+					if !s.paceSync(ctx, typedAddrs[k]) {
+						s.deferSync(ctx, typedAddrs[k])
+						continue
+					}
+
+					serr := s.syncVersions(ctx, typedAddrs[k])
+					if serr != nil && s.deferSync(ctx, typedAddrs[k]) {
+						// Retry after the delay indicated by the upstream
+						// instead of waiting for the next scheduled sync.
+						continue
+					}
+
+					// The degraded provider has been warned.
+					if serr != nil && s.isDegraded(typedAddrs[k]) {
+						continue
+					}
+
+					err = multierr.Append(err, serr)
 				}
 
 				return err
 			})
-		}(typedBucketNames[i:j])
+		}(typedAddrs[i:j])
 
 		i = j
 	}
@@ -442,47 +790,236 @@ func (s *service) Sync(ctx context.Context) error {
 	return wg.Wait()
 }
 
-func (s *service) isSyncing(k string) bool {
-	_, syncing := s.syncing.Load(k)
-	return syncing
+// paceSync waits for the pace of the upstream rate limit of the given provider,
+// returns false if the quota is exhausted until the reset or the context is done.
+func (s *service) paceSync(ctx context.Context, addr addrs.Address) bool {
+	rl, ok := registry.RateLimitOf(addr.Hostname)
+	if !ok {
+		return true
+	}
+
+	d, ok := rl.Pace(time.Now())
+	if !ok {
+		log.WithName("provider").WithName("metadata").
+			Warnf("skip syncing %s as the rate limit of %s is exhausted until %s",
+				addr, addr.Hostname, rl.Reset.Format(time.RFC3339))
+
+		return false
+	}
+
+	if d <= 0 {
+		return true
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
+func (s *service) HasProvider(_ context.Context, addr addrs.Address) bool {
+	var found bool
+
+	_ = s.boltDriver.View(func(tx *bolt.Tx) error {
+		found = tx.
+			Bucket(toBytes(domain)).
+			Bucket(toBytes(addr.Normalize().TypedKey())) != nil
+
+		return nil
+	})
+
+	return found
+}
+
+func (s *service) ListProviders(_ context.Context) ([]addrs.Address, error) {
+	logger := log.WithName("provider").WithName("metadata")
+
+	typedAddrs := make([]addrs.Address, 0, 64)
+
+	err := s.boltDriver.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(toBytes(domain)).ForEachBucket(func(k []byte) error {
+			addr, err := addrs.ParseTypedKey(string(k))
+			if err != nil {
+				logger.Warnf("skip malformed typed bucket %q", string(k))
+				return nil
+			}
+
+			typedAddrs = append(typedAddrs, addr)
+
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return typedAddrs, nil
 }
 
-func (s *service) syncVersions(ctx context.Context, h, n, t string) error {
+func (s *service) WalkPlatforms(ctx context.Context, fn func(addrs.Address, Platform) error) error {
+	type entry struct {
+		addr     addrs.Address
+		platform Platform
+	}
+
+	var es []entry
+
+	// Collect the platforms to not hold the transaction during walking.
+	err := s.boltDriver.View(func(tx *bolt.Tx) error {
+		providersBucket := tx.Bucket(toBytes(domain))
+
+		return providersBucket.ForEachBucket(func(k []byte) error {
+			typedAddr, err := addrs.ParseTypedKey(string(k))
+			if err != nil {
+				return nil
+			}
+
+			typedBucket := providersBucket.Bucket(k)
+
+			return typedBucket.ForEachBucket(func(v []byte) error {
+				versionBucket := typedBucket.Bucket(v)
+				versionAddr := typedAddr.WithVersion(string(v))
+				getPlatform := platformsOf(versionBucket)
+
+				var version Version
+				if err := json.Unmarshal(getValue(versionBucket, "data"), &version); err != nil {
+					// Skip the incomplete version.
+					return nil
+				}
+
+				for _, p := range version.Platforms {
+					addr := versionAddr.WithPlatform(p.OS, p.Arch)
+
+					platform := Platform{
+						OS:       p.OS,
+						Arch:     p.Arch,
+						Filename: addr.ArchiveFilename(),
+					}
+
+					if _, data, _ := getPlatform(addr.PlatformKey()); len(data) != 0 {
+						_ = json.Unmarshal(data, &platform)
+					}
+
+					es = append(es, entry{addr: addr, platform: platform})
+				}
+
+				return nil
+			})
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("error collecting platforms: %w", err)
+	}
+
+	for i := range es {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if err = fn(es[i].addr, es[i].platform); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *service) syncVersions(ctx context.Context, addr addrs.Address) (err error) {
 	logger := log.WithName("provider").WithName("metadata").
-		WithValues("hostname", h, "namespace", n, "type", t)
+		WithValues(addr.LogValues()...)
 
-	key := path.Join(h, n, t)
-	if s.isSyncing(key) {
+	end, ok := s.beginSync(SyncKindVersions, addr.TypedKey())
+	if !ok {
 		return nil
 	}
 
-	s.syncing.Store(key, struct{}{})
-	defer s.syncing.Delete(key)
+	defer end()
 
-	var versions []string
+	ev := SyncEvent{
+		Hostname:  addr.Hostname,
+		Namespace: addr.Namespace,
+		Type:      addr.Type,
+	}
+	events.Publish(events.TypeSyncStarted, ev)
+
+	var (
+		versions, added, removed         []string
+		incompatible, gone               []string
+		platformsAdded, platformsRemoved map[string][]string
+	)
+
+	// Record the attempt for troubleshooting.
+	start := time.Now()
+	attempt := SyncAttempt{
+		Timestamp: s.clock(),
+	}
 
-	err := s.boltDriver.Update(func(tx *bolt.Tx) error {
-		typedBucket, err := tx.
-			Bucket(toBytes(domain)).
-			CreateBucketIfNotExists(toBytes(path.Join(h, n, t)))
+	defer func() {
+		attempt.Duration = time.Since(start).String()
 		if err != nil {
-			return fmt.Errorf("error creating typed bucket: %w", err)
+			attempt.Error = err.Error()
+		} else {
+			attempt.VersionsAdded = added
+			attempt.VersionsRemoved = removed
+			attempt.PlatformsAdded = platformsAdded
+			attempt.PlatformsRemoved = platformsRemoved
+		}
+
+		s.recordSyncAttempt(addr, attempt)
+		s.observeSyncResult(addr, err)
+
+		ev.SyncAttempt = &attempt
+		events.Publish(events.TypeSyncFinished, ev)
+	}()
+
+	var since time.Time
+
+	err = s.boltDriver.View(func(tx *bolt.Tx) error {
+		typedBucket := tx.
+			Bucket(toBytes(domain)).
+			Bucket(toBytes(addr.TypedKey()))
+		if typedBucket == nil {
+			return nil
 		}
 
-		var since time.Time
 		if sinceB := typedBucket.Get(toBytes("modified")); len(sinceB) != 0 {
 			since, _ = time.Parse(time.RFC3339, string(sinceB))
 		}
 
-		versionsB, err := registry.Host(h).
-			Provider(ctx).
-			GetVersions(ctx, n, t, since)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Fetch outside the transaction to not block the writer during the upstream call.
+	src, err := s.source(ctx, addr.Hostname)
+	if err != nil {
+		return fmt.Errorf("error getting upstream source: %w", err)
+	}
+
+	stop := timing.Track(ctx, timing.PhaseUpstream)
+	versionsB, err := src.GetVersions(ctx, addr.Namespace, addr.Type, since)
+	stop()
+	if err != nil {
+		return fmt.Errorf("error getting remote versions: %w", err)
+	}
+
+	err = s.update(addr, func(tx *bolt.Tx) error {
+		typedBucket, err := tx.
+			Bucket(toBytes(domain)).
+			CreateBucketIfNotExists(toBytes(addr.TypedKey()))
 		if err != nil {
-			return fmt.Errorf("error getting remote versions: %w", err)
+			return fmt.Errorf("error creating typed bucket: %w", err)
 		}
 
 		if len(versionsB) == 0 {
-			_ = typedBucket.Put(toBytes("modified"), toBytes(time.Now().Format(time.RFC3339)))
+			_ = typedBucket.Put(toBytes("modified"), toBytes(s.clock().Format(time.RFC3339)))
 
 			if !since.IsZero() {
 				logger.Debug("no new versions")
@@ -499,17 +1036,69 @@ func (s *service) syncVersions(ctx context.Context, h, n, t string) error {
 				return true
 			}
 
+			// Skip the versions never used by the clients,
+			// and delete the stored one as the allowed protocols changed.
+			var protocols []string
+			for _, p := range versionJ.Get("protocols").Array() {
+				protocols = append(protocols, p.String())
+			}
+
+			if !s.isProtocolCompatible(protocols) {
+				if typedBucket.Bucket(toBytes(version)) != nil {
+					err = deleteVersion(tx, typedBucket, addr.WithVersion(version))
+					if err != nil {
+						return false
+					}
+
+					incompatible = append(incompatible, version)
+				}
+
+				return true
+			}
+
+			if vb := typedBucket.Bucket(toBytes(version)); vb == nil {
+				added = append(added, version)
+			} else {
+				// Record the platform changes of the existing version for diffing.
+				pa, pr := diffPlatforms(getValue(vb, "data"), toBytes(versionJ.Raw))
+				if len(pa) != 0 {
+					if platformsAdded == nil {
+						platformsAdded = map[string][]string{}
+					}
+
+					platformsAdded[version] = pa
+				}
+
+				if len(pr) != 0 {
+					if platformsRemoved == nil {
+						platformsRemoved = map[string][]string{}
+					}
+
+					platformsRemoved[version] = pr
+				}
+			}
+
 			err = func() error {
 				versionBucket, err := typedBucket.CreateBucketIfNotExists(toBytes(version))
 				if err != nil {
 					return fmt.Errorf("error creating version bucket: %w", err)
 				}
 
-				err = versionBucket.Put(toBytes("data"), toBytes(versionJ.Raw))
+				err = putValue(versionBucket, "data", toBytes(versionJ.Raw))
 				if err != nil {
 					return fmt.Errorf("error putting version bucket: %w", err)
 				}
 
+				// Fetch the removed platforms again as the upstream lists the version.
+				cleared, err := clearRemoved(versionBucket)
+				if err != nil {
+					return fmt.Errorf("error clearing removed marks: %w", err)
+				}
+
+				if cleared {
+					logger.Infof("version %s is listed by the upstream again", version)
+				}
+
 				return nil
 			}()
 			if err != nil {
@@ -525,7 +1114,12 @@ func (s *service) syncVersions(ctx context.Context, h, n, t string) error {
 			return fmt.Errorf("error iterating over versions: %w", err)
 		}
 
-		_ = typedBucket.Put(toBytes("modified"), toBytes(time.Now().Format(time.RFC3339)))
+		gone, err = s.markGone(typedBucket, versions)
+		if err != nil {
+			return fmt.Errorf("error marking removed versions: %w", err)
+		}
+
+		_ = typedBucket.Put(toBytes("modified"), toBytes(s.clock().Format(time.RFC3339)))
 
 		return nil
 	})
@@ -533,45 +1127,65 @@ func (s *service) syncVersions(ctx context.Context, h, n, t string) error {
 		return err
 	}
 
-	if len(versions) == 0 {
+	if len(gone) != 0 {
+		logger.Warnf("marked %d versions gone from the upstream as removed: %v", len(gone), gone)
+	}
+
+	if len(incompatible) != 0 && s.pruned != nil {
+		logger.Debugf("deleted %d incompatible versions", len(incompatible))
+
+		s.pruned(ctx, addr, incompatible)
+	}
+
+	removed, err = s.pruneVersions(ctx, addr)
+	if err != nil {
+		logger.Warnf("error pruning versions: %v", err)
+	}
+
+	// Record the versions deleted or gone from the upstream as removed.
+	removed = append(append(incompatible, gone...), removed...)
+
+	// Notify the new versions surviving the pruning.
+	if vs := newestFirst(added, removed); len(vs) != 0 && !since.IsZero() && s.added != nil {
+		s.added(ctx, addr, vs)
+	}
+
+	if len(versions) == 0 || !s.isEagerPlatformSync(addr) {
 		return nil
 	}
 
-	// Sort versions.
-	semvers := make([]*semver.Version, len(versions))
+	// Sort versions, the unparsable versions are placed at the end.
+	pvs := make([]parsedVersion, len(versions))
 	for i := range versions {
-		semvers[i], _ = semver.NewVersion(versions[i])
+		pvs[i] = parseVersion(versions[i])
 	}
 
-	sort.Slice(semvers, func(i, j int) bool {
-		if semvers[i] != nil && semvers[j] != nil {
-			return semvers[i].GreaterThan(semvers[j])
-		}
-
-		return false
-	})
+	sortVersionsBy(pvs, func(pv parsedVersion) string { return pv.raw })
 
 	// Sync latest platforms in background.
 	gopool.Go(func() {
 		logger.Debug("syncing 5 newest versions in 5 mins")
 
-		if len(semvers) >= 5 {
-			semvers = semvers[:5]
+		if len(pvs) >= 5 {
+			pvs = pvs[:5]
 		}
 
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
 		defer cancel()
 
-		for i := range semvers {
-			if semvers[i] == nil {
+		for i := range pvs {
+			if pvs[i].segments == nil {
 				continue
 			}
 
-			version := semvers[i].String()
+			version := pvs[i].raw
 			logger := logger.WithValues("version", version)
 
-			err := s.syncPlatforms(ctx,
-				h, n, t, version)
+			err := s.syncPlatforms(ctx, addr.WithVersion(version))
+			if errors.Is(err, ErrVersionRemoved) {
+				continue
+			}
+
 			if err != nil {
 				logger.Errorf("error syncing platforms: %v", err)
 				continue
@@ -584,34 +1198,140 @@ func (s *service) syncVersions(ctx context.Context, h, n, t string) error {
 	return nil
 }
 
-func (s *service) syncPlatforms(ctx context.Context, h, n, t, v string) error {
+// pruneVersions deletes the oldest version buckets beyond the maximum versions,
+// the versions that are not parsable even tolerantly are retained,
+// returns the pruned versions.
+func (s *service) pruneVersions(ctx context.Context, addr addrs.Address) ([]string, error) {
+	if s.maxVersions <= 0 {
+		return nil, nil
+	}
+
+	var pruned []string
+
+	err := s.update(addr, func(tx *bolt.Tx) error {
+		typedBucket := tx.
+			Bucket(toBytes(domain)).
+			Bucket(toBytes(addr.TypedKey()))
+		if typedBucket == nil {
+			return nil
+		}
+
+		var vs []string
+
+		err := typedBucket.ForEachBucket(func(k []byte) error {
+			if parseVersion(string(k)).segments != nil {
+				vs = append(vs, string(k))
+			}
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		if len(vs) <= s.maxVersions {
+			return nil
+		}
+
+		sortVersionsBy(vs, func(v string) string { return v })
+
+		for _, v := range vs[s.maxVersions:] {
+			err = deleteVersion(tx, typedBucket, addr.WithVersion(v))
+			if err != nil {
+				return fmt.Errorf("error deleting version bucket %s: %w", v, err)
+			}
+
+			pruned = append(pruned, v)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(pruned) != 0 && s.pruned != nil {
+		log.WithName("provider").WithName("metadata").
+			WithValues(addr.LogValues()...).
+			Debugf("pruned %d versions", len(pruned))
+
+		s.pruned(ctx, addr, pruned)
+	}
+
+	return pruned, nil
+}
+
+func (s *service) DeleteVersions(_ context.Context, addr addrs.Address, versions []string) ([]string, error) {
+	addr = addr.Normalize()
+	if addr.Validate() != nil {
+		return nil, errors.New("invalid options")
+	}
+
+	var deleted []string
+
+	err := s.update(addr, func(tx *bolt.Tx) error {
+		typedBucket := tx.
+			Bucket(toBytes(domain)).
+			Bucket(toBytes(addr.TypedKey()))
+		if typedBucket == nil {
+			return nil
+		}
+
+		for _, v := range versions {
+			if typedBucket.Bucket(toBytes(v)) == nil {
+				continue
+			}
+
+			err := deleteVersion(tx, typedBucket, addr.WithVersion(v))
+			if err != nil {
+				return fmt.Errorf("error deleting version bucket %s: %w", v, err)
+			}
+
+			deleted = append(deleted, v)
+		}
+
+		if len(deleted) == 0 {
+			return nil
+		}
+
+		// Sync unconditionally next time to get back the deleted versions.
+		return typedBucket.Delete(toBytes("modified"))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return deleted, nil
+}
+
+func (s *service) syncPlatforms(ctx context.Context, addr addrs.Address) error {
 	logger := log.WithName("provider").WithName("metadata").
-		WithValues("hostname", h, "namespace", n, "type", t, "version", v)
+		WithValues(addr.LogValues()...)
 
-	key := path.Join(h, n, t, v)
-	if s.isSyncing(key) {
+	end, ok := s.beginSync(SyncKindPlatforms, addr.String())
+	if !ok {
 		return nil
 	}
 
-	s.syncing.Store(key, struct{}{})
-	defer s.syncing.Delete(key)
+	defer end()
 
 	var platforms [][2]string
 
 	err := s.boltDriver.View(func(tx *bolt.Tx) error {
 		typedBucket := tx.
 			Bucket(toBytes(domain)).
-			Bucket(toBytes(path.Join(h, n, t)))
+			Bucket(toBytes(addr.TypedKey()))
 		if typedBucket == nil {
 			return nil
 		}
 
-		versionBucket := typedBucket.Bucket(toBytes(v))
-		if versionBucket == nil {
+		// Never re-fetch the removed version.
+		versionBucket := typedBucket.Bucket(toBytes(addr.Version))
+		if versionBucket == nil || isRemoved(versionBucket) {
 			return nil
 		}
 
-		data := bytes.Clone(versionBucket.Get(toBytes("data")))
+		data := getValue(versionBucket, "data")
 		if len(data) == 0 {
 			return nil
 		}
@@ -653,8 +1373,11 @@ func (s *service) syncPlatforms(ctx context.Context, h, n, t, v string) error {
 		o, a := platforms[i][0], platforms[i][1]
 
 		wg.Go(func(ctx context.Context) error {
-			err := s.syncPlatform(ctx,
-				h, n, t, v, o, a)
+			err := s.syncPlatform(ctx, addr.WithPlatform(o, a))
+			if errors.Is(err, ErrPlatformRemoved) {
+				return nil
+			}
+
 			if err != nil {
 				return err
 			}
@@ -668,58 +1391,99 @@ func (s *service) syncPlatforms(ctx context.Context, h, n, t, v string) error {
 	return wg.Wait()
 }
 
-func (s *service) syncPlatform(ctx context.Context, h, n, t, v, o, a string) error {
-	key := path.Join(h, n, t, v, o, a)
-	if s.isSyncing(key) {
+func (s *service) syncPlatform(ctx context.Context, addr addrs.Address) error {
+	end, ok := s.beginSync(SyncKindPlatform, addr.String())
+	if !ok {
 		return nil
 	}
 
-	s.syncing.Store(key, struct{}{})
-	defer s.syncing.Delete(key)
+	defer end()
 
-	return s.boltDriver.Update(func(tx *bolt.Tx) error {
+	// versionBucketOf returns the version bucket of the platform, or nil if not found.
+	versionBucketOf := func(tx *bolt.Tx) *bolt.Bucket {
 		typedBucket := tx.
 			Bucket(toBytes(domain)).
-			Bucket(toBytes(path.Join(h, n, t)))
+			Bucket(toBytes(addr.TypedKey()))
 		if typedBucket == nil {
 			return nil
 		}
 
-		versionBucket := typedBucket.Bucket(toBytes(v))
+		return typedBucket.Bucket(toBytes(addr.Version))
+	}
+
+	var (
+		found           bool
+		removed         bool
+		platformRemoved bool
+		since           time.Time
+	)
+
+	err := s.boltDriver.View(func(tx *bolt.Tx) error {
+		versionBucket := versionBucketOf(tx)
 		if versionBucket == nil {
 			return nil
 		}
 
-		platformBucket, err := versionBucket.CreateBucketIfNotExists(toBytes(path.Join(o, a)))
-		if err != nil {
-			return fmt.Errorf("error creating platform bucket: %w", err)
-		}
+		found = true
+		removed = isRemoved(versionBucket)
+		platformRemoved = isPlatformRemoved(versionBucket, addr.PlatformKey())
+		since, _, _ = platformsOf(versionBucket)(addr.PlatformKey())
 
-		var since time.Time
-		if sinceB := platformBucket.Get(toBytes("modified")); len(sinceB) != 0 {
-			since, _ = time.Parse(time.RFC3339, string(sinceB))
-		}
+		return nil
+	})
+	if err != nil || !found {
+		return err
+	}
 
-		platformB, err := registry.Host(h).
-			Provider(ctx).
-			GetPlatform(ctx, n, t, v, o, a, since)
-		if err != nil {
-			return fmt.Errorf("error getting remote platform: %w", err)
+	// Never re-fetch the removed version or platform until listed again.
+	switch {
+	case removed:
+		return ErrVersionRemoved
+	case platformRemoved:
+		return ErrPlatformRemoved
+	}
+
+	// Fetch outside the transaction to not block the writer during the upstream call.
+	src, err := s.source(ctx, addr.Hostname)
+	if err != nil {
+		return fmt.Errorf("error getting upstream source: %w", err)
+	}
+
+	stop := timing.Track(ctx, timing.PhaseUpstream)
+	platformB, err := src.GetPlatform(ctx, addr.Namespace, addr.Type, addr.Version, addr.OS, addr.Arch, since)
+	stop()
+
+	if errors.Is(err, registry.ErrPlatformNotFound) {
+		if err = s.markPlatformRemoved(addr); err != nil {
+			return fmt.Errorf("error marking removed platform: %w", err)
 		}
 
-		if len(platformB) == 0 {
-			_ = platformBucket.Put(toBytes("modified"), toBytes(time.Now().Format(time.RFC3339)))
+		return ErrPlatformRemoved
+	}
+
+	if err != nil {
+		return fmt.Errorf("error getting remote platform: %w", err)
+	}
+
+	// The upstream sources respond an object without the download URL if not found,
+	// which is not stored but never treated as removed.
+	if len(platformB) != 0 && json.Get(platformB, "download_url").String() == "" {
+		return errorx.HttpErrorf(http.StatusNotFound,
+			"platform %s is not found in the upstream", addr.PlatformKey())
+	}
 
+	return s.update(addr, func(tx *bolt.Tx) error {
+		// The version may be pruned during fetching.
+		versionBucket := versionBucketOf(tx)
+		if versionBucket == nil {
 			return nil
 		}
 
-		err = platformBucket.Put(toBytes("data"), platformB)
+		err := s.putPlatform(versionBucket, addr, s.clock(), platformB)
 		if err != nil {
-			return fmt.Errorf("error putting platform bucket: %w", err)
+			return fmt.Errorf("error putting platform: %w", err)
 		}
 
-		_ = platformBucket.Put(toBytes("modified"), toBytes(time.Now().Format(time.RFC3339)))
-
 		return nil
 	})
 }
@@ -0,0 +1,1547 @@
+package metadata
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/seal-io/walrus/utils/errorx"
+	"github.com/seal-io/walrus/utils/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/seal-io/hermitcrab/pkg/provider/addrs"
+	"github.com/seal-io/hermitcrab/pkg/registry"
+)
+
+// fakeRegistry is an in-memory registry serving the hashicorp/null provider.
+type fakeRegistry struct {
+	m sync.Mutex
+
+	versions []string
+	modified time.Time
+	failing  bool
+	delay    time.Duration
+	noShasum bool
+	// protocols overrides the protocols of the versions, default is 5.0.
+	protocols map[string][]string
+	// removed holds the versions whose platforms respond 404.
+	removed map[string]bool
+
+	sinces []string
+	hits   map[string]int
+}
+
+func (f *fakeRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	f.hits[r.URL.Path]++
+
+	time.Sleep(f.delay)
+
+	if f.failing {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	p, ok := strings.CutPrefix(r.URL.Path, "/v1/providers/hashicorp/null/")
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if p == "versions" {
+		ims := r.Header.Get("If-Modified-Since")
+		f.sinces = append(f.sinces, ims)
+
+		if t, err := http.ParseTime(ims); err == nil && !f.modified.After(t) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		vs := make([]map[string]any, 0, len(f.versions))
+		for _, v := range f.versions {
+			protocols, ok := f.protocols[v]
+			if !ok {
+				protocols = []string{"5.0"}
+			}
+
+			vs = append(vs, map[string]any{
+				"version":   v,
+				"protocols": protocols,
+				"platforms": []map[string]string{
+					{"os": "linux", "arch": "amd64"},
+					{"os": "darwin", "arch": "arm64"},
+				},
+			})
+		}
+
+		_ = json.NewEncoder(w).Encode(map[string]any{"versions": vs})
+
+		return
+	}
+
+	// {version}/download/{os}/{arch}.
+	ps := strings.Split(p, "/")
+	if len(ps) != 4 || ps[1] != "download" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if f.removed[ps[0]] {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	shasum := "sha-" + ps[0]
+	if f.noShasum {
+		shasum = ""
+	}
+
+	fn := fmt.Sprintf("terraform-provider-null_%s_%s_%s.zip", ps[0], ps[2], ps[3])
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"protocols":    []string{"5.0"},
+		"os":           ps[2],
+		"arch":         ps[3],
+		"filename":     fn,
+		"download_url": "/files/" + fn,
+		"shasum":       shasum,
+		"signing_keys": map[string]any{
+			"gpg_public_keys": []map[string]string{
+				{
+					"key_id":      testKeyID,
+					"ascii_armor": testArmor,
+					"source":      "HashiCorp",
+				},
+			},
+		},
+	})
+}
+
+const (
+	testKeyID = "34365D9472D7468F"
+	testArmor = "-----BEGIN PGP PUBLIC KEY BLOCK-----\n...\n-----END PGP PUBLIC KEY BLOCK-----"
+)
+
+func (f *fakeRegistry) set(fn func(f *fakeRegistry)) {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	fn(f)
+}
+
+func (f *fakeRegistry) get(fn func(f *fakeRegistry)) {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	fn(f)
+}
+
+// fakeClock is a manual clock.
+type fakeClock struct {
+	m   sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.now = c.now.Add(d)
+}
+
+type testEnv struct {
+	registry *fakeRegistry
+	clock    *fakeClock
+	service  *service
+	pruned   map[string][]string
+}
+
+const testHostname = "registry.example.com"
+
+func newTestEnv(t *testing.T, maxVersions int) *testEnv {
+	t.Helper()
+
+	env := &testEnv{
+		registry: &fakeRegistry{
+			versions: []string{"1.0.0", "1.1.0", "2.0.0"},
+			modified: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			hits:     map[string]int{},
+		},
+		clock: &fakeClock{
+			now: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+		},
+		pruned: map[string][]string{},
+	}
+
+	srv := httptest.NewServer(env.registry)
+	t.Cleanup(srv.Close)
+
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "metadata.db"), 0o600, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+
+	var pm sync.Mutex
+
+	svc, err := NewService(db, ServiceOptions{
+		MaxVersions: maxVersions,
+		Pruned: func(_ context.Context, addr addrs.Address, versions []string) {
+			pm.Lock()
+			defer pm.Unlock()
+
+			env.pruned[addr.String()] = append(env.pruned[addr.String()], versions...)
+		},
+		Clock: env.clock.Now,
+		Source: func(ctx context.Context, hostname string) (registry.UpstreamSource, error) {
+			return registry.NewUpstreamSource(ctx, registry.Upstream{
+				Hostname: hostname,
+				Kind:     registry.UpstreamKindRegistry,
+				Options: map[string]string{
+					"providers.v1": srv.URL + "/v1/providers/",
+				},
+			})
+		},
+	})
+	require.NoError(t, err)
+
+	env.service = svc.(*service)
+
+	return env
+}
+
+func versionsOf(vs []Version) []string {
+	r := make([]string, 0, len(vs))
+	for i := range vs {
+		r = append(r, vs[i].Version)
+	}
+
+	sort.Strings(r)
+
+	return r
+}
+
+func TestService_GetVersions(t *testing.T) {
+	env := newTestEnv(t, 0)
+	ctx := context.Background()
+
+	opts := GetVersionsOptions{
+		Hostname:  testHostname,
+		Namespace: "hashicorp",
+		Type:      "null",
+	}
+
+	// Sync from the upstream at the first time.
+	vs, err := env.service.GetVersions(ctx, opts)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1.0.0", "1.1.0", "2.0.0"}, versionsOf(vs))
+
+	env.registry.get(func(f *fakeRegistry) {
+		assert.Equal(t, []string{""}, f.sinces, "the first fetching must not be conditional")
+	})
+
+	// Serve from local at the second time.
+	vs, err = env.service.GetVersions(ctx, opts)
+	require.NoError(t, err)
+	assert.Len(t, vs, 3)
+
+	env.registry.get(func(f *fakeRegistry) {
+		assert.Equal(t, 1, f.hits["/v1/providers/hashicorp/null/versions"])
+	})
+
+	// Normalize the address.
+	vs, err = env.service.GetVersions(ctx, GetVersionsOptions{
+		Hostname:  strings.ToUpper(testHostname),
+		Namespace: "HashiCorp",
+		Type:      "NULL",
+	})
+	require.NoError(t, err)
+	assert.Len(t, vs, 3)
+}
+
+func TestService_GetVersions_refreshStale(t *testing.T) {
+	env := newTestEnv(t, 0)
+	env.service.eagerPlatformSync = []string{}
+	env.service.softTTL = 10 * time.Minute
+	ctx := context.Background()
+
+	opts := GetVersionsOptions{
+		Hostname:  testHostname,
+		Namespace: "hashicorp",
+		Type:      "null",
+	}
+
+	const versionsPath = "/v1/providers/hashicorp/null/versions"
+
+	_, err := env.service.GetVersions(ctx, opts)
+	require.NoError(t, err)
+
+	// The upstream releases a new version.
+	env.registry.set(func(f *fakeRegistry) {
+		f.versions = append(f.versions, "2.1.0")
+		f.modified = env.clock.Now().Add(time.Minute)
+	})
+
+	// Serve the fresh index from local.
+	_, err = env.service.GetVersions(ctx, opts)
+	require.NoError(t, err)
+
+	env.registry.get(func(f *fakeRegistry) {
+		assert.Equal(t, 1, f.hits[versionsPath])
+	})
+
+	// Serve the stale index without blocking, and refresh in background.
+	env.clock.Advance(11 * time.Minute)
+
+	vs, err := env.service.GetVersions(ctx, opts)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1.0.0", "1.1.0", "2.0.0"}, versionsOf(vs))
+
+	assert.Eventually(t, func() bool {
+		vs, err := env.service.GetVersions(ctx, opts)
+		return err == nil && len(vs) == 4
+	}, 3*time.Second, 50*time.Millisecond)
+
+	env.registry.get(func(f *fakeRegistry) {
+		assert.Equal(t, 2, f.hits[versionsPath], "the refreshed index must not be refreshed again")
+	})
+}
+
+func TestService_shadowCompare(t *testing.T) {
+	env := newTestEnv(t, 0)
+	env.service.eagerPlatformSync = []string{}
+	ctx := context.Background()
+
+	addr := addrs.Address{Hostname: testHostname, Namespace: "hashicorp", Type: "null"}
+
+	vs, err := env.service.GetVersions(ctx, GetVersionsOptions{
+		Hostname:  addr.Hostname,
+		Namespace: addr.Namespace,
+		Type:      addr.Type,
+	})
+	require.NoError(t, err)
+
+	d, err := env.service.shadowCompare(ctx, addr, vs)
+	require.NoError(t, err)
+	assert.False(t, d.Diverged())
+
+	// The upstream releases a new version and withdraws an old one.
+	env.registry.set(func(f *fakeRegistry) {
+		f.versions = []string{"1.1.0", "2.0.0", "2.1.0"}
+	})
+
+	d, err = env.service.shadowCompare(ctx, addr, vs)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"2.1.0"}, d.Missing)
+	assert.Equal(t, []string{"1.0.0"}, d.Extra)
+
+	// The served shasum is corrupted.
+	paddr := addr.WithVersion("1.1.0").WithPlatform("linux", "amd64")
+
+	p, err := env.service.GetPlatform(ctx, GetPlatformOptions(paddr))
+	require.NoError(t, err)
+
+	d, err = env.service.shadowCompare(ctx, paddr, []Version{{Version: "1.1.0", Platforms: []Platform{p}}})
+	require.NoError(t, err)
+	assert.False(t, d.Diverged())
+
+	p.Shasum = "corrupted"
+
+	d, err = env.service.shadowCompare(ctx, paddr, []Version{{Version: "1.1.0", Platforms: []Platform{p}}})
+	require.NoError(t, err)
+	assert.Equal(t, "sha-1.1.0", d.Shasum)
+	assert.Empty(t, d.Filename)
+}
+
+func TestService_GetPlatform(t *testing.T) {
+	env := newTestEnv(t, 0)
+	ctx := context.Background()
+
+	p, err := env.service.GetPlatform(ctx, GetPlatformOptions{
+		Hostname:  testHostname,
+		Namespace: "hashicorp",
+		Type:      "null",
+		Version:   "1.1.0",
+		OS:        "linux",
+		Arch:      "amd64",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "terraform-provider-null_1.1.0_linux_amd64.zip", p.Filename)
+	assert.Equal(t, "sha-1.1.0", p.Shasum)
+	assert.True(t, strings.HasSuffix(p.DownloadURL, "/files/"+p.Filename),
+		"the relative download URL must be resolved, got %s", p.DownloadURL)
+
+	_, err = env.service.GetVersion(ctx, GetVersionOptions{
+		Hostname:  testHostname,
+		Namespace: "hashicorp",
+		Type:      "null",
+		Version:   "9.9.9",
+	})
+	assert.ErrorIs(t, err, ErrVersionNotFound)
+}
+
+func TestService_GetPlatform_dedupKeys(t *testing.T) {
+	env := newTestEnv(t, 0)
+	ctx := context.Background()
+
+	addr := addrs.Address{
+		Hostname:  testHostname,
+		Namespace: "hashicorp",
+		Type:      "null",
+		Version:   "1.1.0",
+	}
+
+	for _, pf := range [][2]string{{"linux", "amd64"}, {"darwin", "arm64"}} {
+		p, err := env.service.GetPlatform(ctx, GetPlatformOptions(addr.WithPlatform(pf[0], pf[1])))
+		require.NoError(t, err)
+		assert.Equal(t, testArmor, json.Get(p.SigningKeys, "gpg_public_keys.0.ascii_armor").String())
+	}
+
+	err := env.service.boltDriver.View(func(tx *bolt.Tx) error {
+		assert.Equal(t, 1, tx.Bucket(toBytes(keysDomain)).Stats().KeyN)
+
+		versionBucket := tx.Bucket(toBytes(domain)).
+			Bucket(toBytes(addr.TypedKey())).
+			Bucket(toBytes(addr.Version))
+		data := getValue(versionBucket.Bucket(toBytes(addr.WithPlatform("linux", "amd64").PlatformKey())), "data")
+		assert.Equal(t, testKeyID, json.Get(data, "signing_keys.gpg_public_keys.0.key_id").String())
+		assert.False(t, json.Get(data, "signing_keys.gpg_public_keys.0.ascii_armor").Exists())
+
+		return nil
+	})
+	require.NoError(t, err)
+}
+
+func TestService_GetSigningKeys(t *testing.T) {
+	env := newTestEnv(t, 0)
+	ctx := context.Background()
+
+	opts := GetSigningKeysOptions{
+		Hostname:  testHostname,
+		Namespace: "hashicorp",
+		Type:      "null",
+	}
+
+	_, err := env.service.GetSigningKeys(ctx, opts)
+	assert.ErrorIs(t, err, ErrTypedNotFound)
+
+	_, err = env.service.GetPlatform(ctx, GetPlatformOptions{
+		Hostname:  testHostname,
+		Namespace: "hashicorp",
+		Type:      "null",
+		Version:   "1.1.0",
+		OS:        "linux",
+		Arch:      "amd64",
+	})
+	require.NoError(t, err)
+
+	ks, err := env.service.GetSigningKeys(ctx, opts)
+	require.NoError(t, err)
+	require.Len(t, ks, 1)
+	assert.Equal(t, testKeyID, ks[0].KeyID)
+	assert.Equal(t, testArmor, ks[0].ASCIIArmor)
+}
+
+func TestService_ImportShasums(t *testing.T) {
+	env := newTestEnv(t, 0)
+	ctx := context.Background()
+
+	env.registry.set(func(f *fakeRegistry) {
+		f.noShasum = true
+	})
+
+	popts := GetPlatformOptions{
+		Hostname:  testHostname,
+		Namespace: "hashicorp",
+		Type:      "null",
+		Version:   "1.1.0",
+		OS:        "linux",
+		Arch:      "amd64",
+	}
+
+	p, err := env.service.GetPlatform(ctx, popts)
+	require.NoError(t, err)
+	assert.Empty(t, p.Shasum)
+
+	sum := strings.Repeat("a", 64)
+
+	opts := ImportShasumsOptions{
+		Hostname:  testHostname,
+		Namespace: "hashicorp",
+		Type:      "null",
+		Version:   "1.1.0",
+		Content: []byte(sum + "  terraform-provider-null_1.1.0_linux_amd64.zip\n" +
+			strings.Repeat("b", 64) + "  terraform-provider-null_1.0.0_linux_amd64.zip\n" +
+			strings.Repeat("c", 64) + "  terraform-provider-null_1.1.0_manifest.json\n"),
+	}
+
+	ns, err := env.service.ImportShasums(ctx, opts)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"terraform-provider-null_1.1.0_linux_amd64.zip"}, ns)
+
+	p, err = env.service.GetPlatform(ctx, popts)
+	require.NoError(t, err)
+	assert.Equal(t, sum, p.Shasum)
+
+	// The backfilled platform is indexed.
+	addr, _, err := env.service.GetPlatformByShasum(ctx, sum)
+	require.NoError(t, err)
+	assert.Equal(t, "1.1.0", addr.Version)
+	assert.Equal(t, "linux", addr.OS)
+
+	// Conflict with the stored shasum.
+	opts.Content = []byte(strings.Repeat("d", 64) + " *terraform-provider-null_1.1.0_linux_amd64.zip\n")
+	_, err = env.service.ImportShasums(ctx, opts)
+	assert.ErrorContains(t, err, "conflicts")
+
+	// Malformed.
+	opts.Content = []byte("not a shasums file")
+	_, err = env.service.ImportShasums(ctx, opts)
+	assert.ErrorContains(t, err, "invalid line 1")
+
+	// Not mirrored.
+	opts.Version = "9.9.9"
+	opts.Content = []byte(sum + "  terraform-provider-null_9.9.9_linux_amd64.zip\n")
+	_, err = env.service.ImportShasums(ctx, opts)
+	assert.ErrorIs(t, err, ErrVersionNotFound)
+}
+
+func TestService_SetCanary(t *testing.T) {
+	env := newTestEnv(t, 0)
+	ctx := context.Background()
+
+	vopts := GetVersionsOptions{
+		Hostname:  testHostname,
+		Namespace: "hashicorp",
+		Type:      "null",
+	}
+
+	_, err := env.service.GetVersions(ctx, vopts)
+	require.NoError(t, err)
+
+	opts := SetCanaryOptions{
+		Hostname:  testHostname,
+		Namespace: "hashicorp",
+		Type:      "null",
+		Version:   "1.1.0",
+		Canary:    true,
+	}
+	addr := addrs.Address{
+		Hostname:  testHostname,
+		Namespace: "hashicorp",
+		Type:      "null",
+		Version:   "1.1.0",
+	}
+
+	require.NoError(t, env.service.SetCanary(ctx, opts))
+	assert.True(t, env.service.IsCanary(ctx, addr))
+
+	// Survive the re-syncing.
+	require.NoError(t, env.service.Sync(ctx))
+
+	vs, err := env.service.GetVersions(ctx, vopts)
+	require.NoError(t, err)
+
+	for _, v := range vs {
+		assert.Equal(t, v.Version == "1.1.0", v.Canary, v.Version)
+	}
+
+	opts.Canary = false
+	require.NoError(t, env.service.SetCanary(ctx, opts))
+	assert.False(t, env.service.IsCanary(ctx, addr))
+
+	// Not mirrored.
+	opts.Version = "9.9.9"
+	assert.ErrorIs(t, env.service.SetCanary(ctx, opts), ErrVersionNotFound)
+}
+
+func TestService_GetRevision(t *testing.T) {
+	env := newTestEnv(t, 0)
+	ctx := context.Background()
+
+	addr := addrs.Address{
+		Hostname:  testHostname,
+		Namespace: "hashicorp",
+		Type:      "null",
+	}
+
+	assert.Zero(t, env.service.GetRevision(ctx, addr))
+
+	// Change by syncing.
+	_, err := env.service.GetVersions(ctx, GetVersionsOptions{
+		Hostname:  addr.Hostname,
+		Namespace: addr.Namespace,
+		Type:      addr.Type,
+	})
+	require.NoError(t, err)
+
+	synced := env.service.GetRevision(ctx, addr)
+	assert.NotZero(t, synced)
+
+	// Unchanged by reading.
+	_, err = env.service.GetVersions(ctx, GetVersionsOptions{
+		Hostname:  addr.Hostname,
+		Namespace: addr.Namespace,
+		Type:      addr.Type,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, synced, env.service.GetRevision(ctx, addr))
+
+	// Change by marking canary.
+	require.NoError(t, env.service.SetCanary(ctx, SetCanaryOptions{
+		Hostname:  addr.Hostname,
+		Namespace: addr.Namespace,
+		Type:      addr.Type,
+		Version:   "1.1.0",
+		Canary:    true,
+	}))
+	assert.Greater(t, env.service.GetRevision(ctx, addr), synced)
+
+	// Normalize the address.
+	assert.Equal(t, env.service.GetRevision(ctx, addr),
+		env.service.GetRevision(ctx, addrs.Address{
+			Hostname:  strings.ToUpper(testHostname),
+			Namespace: "HashiCorp",
+			Type:      "NULL",
+		}))
+}
+
+func TestService_Publish(t *testing.T) {
+	env := newTestEnv(t, 0)
+	ctx := context.Background()
+
+	opts := PublishOptions{
+		Hostname:  testHostname,
+		Namespace: "hashicorp",
+		Type:      "random",
+		Version:   "2.0.0",
+		Protocols: []string{"5.0"},
+		Platform: Platform{
+			OS:          "linux",
+			Arch:        "amd64",
+			Filename:    "terraform-provider-random_2.0.0_linux_amd64.zip",
+			Shasum:      "sha-2.0.0",
+			DownloadURL: "https://example.com/terraform-provider-random_2.0.0_linux_amd64.zip",
+		},
+	}
+
+	require.NoError(t, env.service.Publish(ctx, opts))
+
+	// Publish again and another platform.
+	require.NoError(t, env.service.Publish(ctx, opts))
+
+	opts.Platform.Arch = "arm64"
+	opts.Platform.Filename = "terraform-provider-random_2.0.0_linux_arm64.zip"
+	require.NoError(t, env.service.Publish(ctx, opts))
+
+	v, err := env.service.GetVersion(ctx, GetVersionOptions{
+		Hostname:  testHostname,
+		Namespace: "hashicorp",
+		Type:      "random",
+		Version:   "2.0.0",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"5.0"}, v.Protocols)
+
+	var filenames []string
+
+	for _, p := range v.Platforms {
+		if p.Filename != "" {
+			filenames = append(filenames, p.Filename)
+		}
+	}
+
+	assert.ElementsMatch(t, []string{
+		"terraform-provider-random_2.0.0_linux_amd64.zip",
+		"terraform-provider-random_2.0.0_linux_arm64.zip",
+	}, filenames)
+
+	p, err := env.service.GetPlatform(ctx, GetPlatformOptions{
+		Hostname:  testHostname,
+		Namespace: "hashicorp",
+		Type:      "random",
+		Version:   "2.0.0",
+		OS:        "linux",
+		Arch:      "amd64",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "sha-2.0.0", p.Shasum)
+}
+
+func TestService_GetPlatformByShasum(t *testing.T) {
+	env := newTestEnv(t, 0)
+	ctx := context.Background()
+
+	opts := PublishOptions{
+		Hostname:  testHostname,
+		Namespace: "hashicorp",
+		Type:      "random",
+		Version:   "2.0.0",
+		Platform: Platform{
+			OS:       "linux",
+			Arch:     "amd64",
+			Filename: "terraform-provider-random_2.0.0_linux_amd64.zip",
+			Shasum:   "aaaa",
+		},
+	}
+	require.NoError(t, env.service.Publish(ctx, opts))
+
+	addr, p, err := env.service.GetPlatformByShasum(ctx, "AAAA")
+	require.NoError(t, err)
+	assert.Equal(t, "random", addr.Type)
+	assert.Equal(t, "2.0.0", addr.Version)
+	assert.Equal(t, opts.Platform.Filename, p.Filename)
+
+	// The index is updated along with publishing.
+	opts.Platform.Arch = "arm64"
+	opts.Platform.Filename = "terraform-provider-random_2.0.0_linux_arm64.zip"
+	opts.Platform.Shasum = "bbbb"
+	require.NoError(t, env.service.Publish(ctx, opts))
+
+	addr, _, err = env.service.GetPlatformByShasum(ctx, "bbbb")
+	require.NoError(t, err)
+	assert.Equal(t, "arm64", addr.Arch)
+
+	_, _, err = env.service.GetPlatformByShasum(ctx, "cccc")
+	assert.Error(t, err)
+
+	// The index of the changed platform is replaced.
+	opts.Platform.Shasum = "cccc"
+	require.NoError(t, env.service.Publish(ctx, opts))
+
+	_, _, err = env.service.GetPlatformByShasum(ctx, "bbbb")
+	assert.Error(t, err)
+
+	addr, _, err = env.service.GetPlatformByShasum(ctx, "cccc")
+	require.NoError(t, err)
+	assert.Equal(t, "arm64", addr.Arch)
+
+	// The index is built for the stored platforms.
+	err = env.service.boltDriver.Update(func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket(toBytes(digestsDomain)); err != nil {
+			return err
+		}
+
+		return buildDigests(tx)
+	})
+	require.NoError(t, err)
+
+	for _, sum := range []string{"aaaa", "cccc"} {
+		_, _, err = env.service.GetPlatformByShasum(ctx, sum)
+		assert.NoError(t, err, sum)
+	}
+
+	// The index is removed along with the version.
+	_, err = env.service.DeleteVersions(ctx, addr, []string{"2.0.0"})
+	require.NoError(t, err)
+
+	for _, sum := range []string{"aaaa", "cccc"} {
+		_, _, err = env.service.GetPlatformByShasum(ctx, sum)
+		assert.Error(t, err, sum)
+	}
+
+	err = env.service.boltDriver.View(func(tx *bolt.Tx) error {
+		assert.Equal(t, 0, tx.Bucket(toBytes(digestsDomain)).Stats().KeyN)
+		return nil
+	})
+	require.NoError(t, err)
+}
+
+func TestService_Sync(t *testing.T) {
+	env := newTestEnv(t, 0)
+	ctx := context.Background()
+
+	opts := GetVersionsOptions{
+		Hostname:  testHostname,
+		Namespace: "hashicorp",
+		Type:      "null",
+	}
+
+	_, err := env.service.GetVersions(ctx, opts)
+	require.NoError(t, err)
+
+	// Not modified since the last syncing.
+	env.clock.Advance(time.Hour)
+	require.NoError(t, env.service.Sync(ctx))
+
+	// Modified after the last syncing.
+	env.registry.set(func(f *fakeRegistry) {
+		f.versions = append(f.versions, "2.1.0")
+		f.modified = env.clock.Now().Add(time.Minute)
+	})
+	env.clock.Advance(time.Hour)
+	require.NoError(t, env.service.Sync(ctx))
+
+	env.registry.get(func(f *fakeRegistry) {
+		assert.Equal(t, []string{
+			"",
+			"Tue, 02 Jan 2024 00:00:00 GMT",
+			"Tue, 02 Jan 2024 01:00:00 GMT",
+		}, f.sinces, "the syncing must be conditional with the clock time of the last syncing")
+	})
+
+	vs, err := env.service.GetVersions(ctx, opts)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1.0.0", "1.1.0", "2.0.0", "2.1.0"}, versionsOf(vs))
+}
+
+func TestService_Sync_typedKeys(t *testing.T) {
+	env := newTestEnv(t, 0)
+	ctx := context.Background()
+
+	const (
+		withPort  = testHostname + ":8443/hashicorp/null"
+		malformed = testHostname + "/hashi/corp/null"
+	)
+
+	err := env.service.boltDriver.Update(func(tx *bolt.Tx) error {
+		for _, k := range []string{withPort, malformed} {
+			if _, err := tx.Bucket(toBytes(domain)).CreateBucket(toBytes(k)); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, env.service.Sync(ctx))
+
+	// The hostname with port is synced, the malformed key is skipped.
+	err = env.service.boltDriver.View(func(tx *bolt.Tx) error {
+		countVersions := func(k string) (n int) {
+			_ = tx.Bucket(toBytes(domain)).Bucket(toBytes(k)).ForEachBucket(func([]byte) error {
+				n++
+				return nil
+			})
+
+			return n
+		}
+
+		assert.Equal(t, 3, countVersions(withPort))
+		assert.Equal(t, 0, countVersions(malformed))
+
+		return nil
+	})
+	require.NoError(t, err)
+
+	var walked []string
+
+	err = env.service.WalkPlatforms(ctx, func(addr addrs.Address, _ Platform) error {
+		walked = append(walked, addr.String())
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Contains(t, walked, testHostname+":8443/hashicorp/null/1.0.0/linux/amd64")
+}
+
+func TestService_Sync_added(t *testing.T) {
+	env := newTestEnv(t, 0)
+	env.service.eagerPlatformSync = []string{}
+	ctx := context.Background()
+
+	var added [][]string
+
+	env.service.added = func(_ context.Context, _ addrs.Address, vs []string) {
+		added = append(added, vs)
+	}
+
+	opts := GetVersionsOptions{
+		Hostname:  testHostname,
+		Namespace: "hashicorp",
+		Type:      "null",
+	}
+
+	// The first syncing never notifies.
+	_, err := env.service.GetVersions(ctx, opts)
+	require.NoError(t, err)
+	assert.Empty(t, added)
+
+	env.registry.set(func(f *fakeRegistry) {
+		f.versions = append(f.versions, "2.1.0", "2.0.1")
+		f.modified = env.clock.Now().Add(time.Minute)
+	})
+	env.clock.Advance(time.Hour)
+
+	require.NoError(t, env.service.Sync(ctx))
+	assert.Equal(t, [][]string{{"2.1.0", "2.0.1"}}, added, "should notify the new versions newest first")
+}
+
+func TestService_Sync_pruneVersions(t *testing.T) {
+	env := newTestEnv(t, 2)
+	ctx := context.Background()
+
+	vs, err := env.service.GetVersions(ctx, GetVersionsOptions{
+		Hostname:  testHostname,
+		Namespace: "hashicorp",
+		Type:      "null",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1.1.0", "2.0.0"}, versionsOf(vs))
+	assert.Equal(t, map[string][]string{
+		testHostname + "/hashicorp/null": {"1.0.0"},
+	}, env.pruned)
+}
+
+func TestService_Sync_protocols(t *testing.T) {
+	env := newTestEnv(t, 0)
+	ctx := context.Background()
+
+	opts := GetVersionsOptions{
+		Hostname:  testHostname,
+		Namespace: "hashicorp",
+		Type:      "null",
+	}
+
+	_, err := env.service.GetVersions(ctx, opts)
+	require.NoError(t, err)
+
+	// The clients only use the protocol 5 and 6.
+	env.service.protocols, err = normalizeProtocols([]string{"5", "6.0"})
+	require.NoError(t, err)
+
+	env.registry.set(func(f *fakeRegistry) {
+		f.versions = append(f.versions, "2.1.0")
+		f.protocols = map[string][]string{
+			"1.0.0": {"4.0"},
+			"2.0.0": {"4.0", "5.0"},
+			"2.1.0": {"4.0"},
+		}
+		f.modified = env.clock.Now().Add(time.Minute)
+	})
+	env.clock.Advance(time.Hour)
+	require.NoError(t, env.service.Sync(ctx))
+
+	vs, err := env.service.GetVersions(ctx, opts)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1.1.0", "2.0.0"}, versionsOf(vs))
+	assert.Equal(t, map[string][]string{
+		testHostname + "/hashicorp/null": {"1.0.0"},
+	}, env.pruned, "the stored incompatible versions must be deleted")
+
+	_, err = normalizeProtocols([]string{"v5"})
+	assert.Error(t, err)
+}
+
+func TestService_GetVersions_protocols(t *testing.T) {
+	env := newTestEnv(t, 0)
+	ctx := context.Background()
+
+	opts := GetVersionsOptions{
+		Hostname:  testHostname,
+		Namespace: "hashicorp",
+		Type:      "null",
+	}
+
+	vs, err := env.service.GetVersions(ctx, opts)
+	require.NoError(t, err)
+	require.NotEmpty(t, vs)
+
+	// Never serve the stored versions once the allowed protocols changed,
+	// even before the next syncing.
+	env.service.protocols, err = normalizeProtocols([]string{"6"})
+	require.NoError(t, err)
+
+	vs, err = env.service.GetVersions(ctx, opts)
+	require.NoError(t, err)
+	assert.Empty(t, vs)
+
+	_, err = env.service.GetVersion(ctx, GetVersionOptions{
+		Hostname:  testHostname,
+		Namespace: "hashicorp",
+		Type:      "null",
+		Version:   "1.0.0",
+	})
+	assert.ErrorIs(t, err, ErrVersionNotFound)
+}
+
+func TestService_GetPlatform_removed(t *testing.T) {
+	env := newTestEnv(t, 0)
+	env.service.eagerPlatformSync = []string{}
+	ctx := context.Background()
+
+	opts := GetPlatformOptions{
+		Hostname:  testHostname,
+		Namespace: "hashicorp",
+		Type:      "null",
+		Version:   "1.0.0",
+		OS:        "linux",
+		Arch:      "amd64",
+	}
+
+	_, err := env.service.GetPlatform(ctx, opts)
+	require.NoError(t, err)
+
+	// The upstream deletes the platforms.
+	env.registry.set(func(f *fakeRegistry) {
+		f.removed = map[string]bool{"1.0.0": true}
+	})
+
+	const removedPath = "/v1/providers/hashicorp/null/1.0.0/download/darwin/arm64"
+
+	darwin := opts
+	darwin.OS, darwin.Arch = "darwin", "arm64"
+
+	assertGone := func(opts GetPlatformOptions, target error) {
+		t.Helper()
+
+		_, err := env.service.GetPlatform(ctx, opts)
+		require.ErrorIs(t, err, target)
+
+		var he errorx.HttpError
+		require.ErrorAs(t, err, &he)
+		assert.Equal(t, http.StatusGone, he.Status)
+	}
+
+	for i := 0; i < 2; i++ {
+		assertGone(darwin, ErrPlatformRemoved)
+	}
+
+	env.registry.get(func(f *fakeRegistry) {
+		assert.Equal(t, 1, f.hits[removedPath], "the removed platform must not be re-fetched")
+	})
+
+	getVersion := func() Version {
+		t.Helper()
+
+		v, err := env.service.GetVersion(ctx, GetVersionOptions{
+			Hostname:  testHostname,
+			Namespace: "hashicorp",
+			Type:      "null",
+			Version:   "1.0.0",
+		})
+		require.NoError(t, err)
+
+		return v
+	}
+
+	// Only the platform is removed, keep serving the cached one.
+	p, err := env.service.GetPlatform(ctx, opts)
+	require.NoError(t, err)
+	assert.Equal(t, "terraform-provider-null_1.0.0_linux_amd64.zip", p.Filename)
+
+	v := getVersion()
+	assert.False(t, v.Removed)
+
+	var fetched []string
+	for _, p := range v.Platforms {
+		if p.Filename != "" {
+			fetched = append(fetched, p.OS)
+		}
+	}
+	assert.Equal(t, []string{"linux"}, fetched)
+
+	typedAddr := addrs.Address{Hostname: testHostname, Namespace: "hashicorp", Type: "null"}
+
+	// Fetch the removed platform again once the upstream lists the version again.
+	env.registry.set(func(f *fakeRegistry) {
+		f.removed = nil
+		f.modified = env.clock.Now().Add(time.Minute)
+	})
+	require.NoError(t, env.service.syncVersions(ctx, typedAddr))
+
+	_, err = env.service.GetPlatform(ctx, darwin)
+	require.NoError(t, err)
+
+	// The upstream deletes the version from the list.
+	env.registry.set(func(f *fakeRegistry) {
+		f.versions = []string{"1.1.0", "2.0.0"}
+		f.modified = env.clock.Now().Add(time.Minute)
+	})
+	require.NoError(t, env.service.syncVersions(ctx, typedAddr))
+	assert.True(t, getVersion().Removed)
+
+	history, err := env.service.GetSyncHistory(ctx, GetSyncHistoryOptions{
+		Hostname:  testHostname,
+		Namespace: "hashicorp",
+		Type:      "null",
+	})
+	require.NoError(t, err)
+	require.NotEmpty(t, history)
+	assert.Equal(t, []string{"1.0.0"}, history[0].VersionsRemoved, "the version gone must be recorded")
+
+	// Keep serving the cached platforms of the removed version.
+	p, err = env.service.GetPlatform(ctx, opts)
+	require.NoError(t, err)
+	assert.Equal(t, "terraform-provider-null_1.0.0_linux_amd64.zip", p.Filename)
+
+	windows := opts
+	windows.OS = "windows"
+	assertGone(windows, ErrVersionRemoved)
+
+	// Hide the removed version if configured.
+	env.service.hideRemoved = true
+
+	_, err = env.service.GetPlatform(ctx, opts)
+	assert.ErrorIs(t, err, ErrVersionRemoved)
+
+	vs, err := env.service.GetVersions(ctx, GetVersionsOptions{
+		Hostname:  testHostname,
+		Namespace: "hashicorp",
+		Type:      "null",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1.1.0", "2.0.0"}, versionsOf(vs))
+
+	// Clear the mark once the upstream lists the version again.
+	env.registry.set(func(f *fakeRegistry) {
+		f.versions = []string{"1.0.0", "1.1.0", "2.0.0"}
+		f.modified = env.clock.Now().Add(time.Minute)
+	})
+	require.NoError(t, env.service.syncVersions(ctx, typedAddr))
+	assert.False(t, getVersion().Removed)
+}
+
+func TestService_GetPlatform_blankDownloadURL(t *testing.T) {
+	env := newTestEnv(t, 0)
+	env.service.eagerPlatformSync = []string{}
+	ctx := context.Background()
+
+	var hits atomic.Int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/download/linux/amd64") {
+			hits.Add(1)
+			_, _ = w.Write([]byte(`{}`))
+			return
+		}
+
+		env.registry.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	env.service.source = func(ctx context.Context, hostname string) (registry.UpstreamSource, error) {
+		return registry.NewUpstreamSource(ctx, registry.Upstream{
+			Hostname: hostname,
+			Kind:     registry.UpstreamKindRegistry,
+			Options: map[string]string{
+				"providers.v1": srv.URL + "/v1/providers/",
+			},
+		})
+	}
+
+	opts := GetPlatformOptions{
+		Hostname:  testHostname,
+		Namespace: "hashicorp",
+		Type:      "null",
+		Version:   "1.0.0",
+		OS:        "linux",
+		Arch:      "amd64",
+	}
+
+	// Neither stored nor marked as removed.
+	for i := 0; i < 2; i++ {
+		_, err := env.service.GetPlatform(ctx, opts)
+		require.Error(t, err)
+		assert.NotErrorIs(t, err, ErrPlatformRemoved)
+		assert.NotErrorIs(t, err, ErrVersionRemoved)
+
+		var he errorx.HttpError
+		require.ErrorAs(t, err, &he)
+		assert.Equal(t, http.StatusNotFound, he.Status)
+	}
+
+	// Ask the upstream again on the next request.
+	assert.Equal(t, int32(2), hits.Load())
+}
+
+func TestService_GetPlatform_notPublished(t *testing.T) {
+	env := newTestEnv(t, 0)
+	env.service.eagerPlatformSync = []string{}
+	ctx := context.Background()
+
+	opts := GetPlatformOptions{
+		Hostname:  testHostname,
+		Namespace: "hashicorp",
+		Type:      "null",
+		Version:   "1.0.0",
+		OS:        "freebsd",
+		Arch:      "amd64",
+	}
+
+	_, err := env.service.GetPlatform(ctx, opts)
+	require.ErrorIs(t, err, ErrPlatformNotPublished)
+
+	var he errorx.HttpError
+	require.ErrorAs(t, err, &he)
+	assert.Equal(t, http.StatusNotFound, he.Status)
+
+	var pe platformNotPublishedError
+	require.ErrorAs(t, err, &pe)
+	assert.Equal(t, []string{"darwin_arm64", "linux_amd64"}, pe.Platforms)
+
+	env.registry.get(func(f *fakeRegistry) {
+		assert.Zero(t, f.hits["/v1/providers/hashicorp/null/1.0.0/download/freebsd/amd64"],
+			"the unpublished platform must not be fetched")
+	})
+
+	// Never mark the version as removed.
+	v, err := env.service.GetVersion(ctx, GetVersionOptions{
+		Hostname:  testHostname,
+		Namespace: "hashicorp",
+		Type:      "null",
+		Version:   "1.0.0",
+	})
+	require.NoError(t, err)
+	assert.False(t, v.Removed)
+
+	// Fetch from the upstream if configured.
+	env.service.probeUnlisted = true
+
+	p, err := env.service.GetPlatform(ctx, opts)
+	require.NoError(t, err)
+	assert.Equal(t, "terraform-provider-null_1.0.0_freebsd_amd64.zip", p.Filename)
+}
+
+func TestService_GetPlatform_upstreamBudget(t *testing.T) {
+	env := newTestEnv(t, 0)
+	env.service.eagerPlatformSync = []string{}
+	env.service.upstreamBudget = 100 * time.Millisecond
+	env.registry.set(func(f *fakeRegistry) {
+		f.delay = 300 * time.Millisecond
+	})
+
+	opts := GetPlatformOptions{
+		Hostname:  testHostname,
+		Namespace: "hashicorp",
+		Type:      "null",
+		Version:   "1.0.0",
+		OS:        "linux",
+		Arch:      "amd64",
+	}
+
+	_, err := env.service.GetPlatform(WithUpstreamBudget(context.Background()), opts)
+	require.ErrorIs(t, err, ErrUpstreamBudgetExceeded)
+
+	var he errorx.HttpError
+	require.ErrorAs(t, err, &he)
+	assert.Equal(t, http.StatusServiceUnavailable, he.Status)
+
+	var ra interface{ RetryAfter() string }
+	require.ErrorAs(t, err, &ra)
+	assert.Equal(t, "1", ra.RetryAfter())
+
+	// The syncing continues in background.
+	env.registry.set(func(f *fakeRegistry) {
+		f.delay = 0
+	})
+
+	assert.Eventually(t, func() bool {
+		return env.service.HasProvider(context.Background(), addrs.Address{
+			Hostname:  testHostname,
+			Namespace: "hashicorp",
+			Type:      "null",
+		})
+	}, 3*time.Second, 50*time.Millisecond)
+
+	// Unlimited without the budget marker.
+	_, err = env.service.GetPlatform(context.Background(), opts)
+	assert.NoError(t, err)
+}
+
+func TestService_Sync_pruneNonSemverVersions(t *testing.T) {
+	env := newTestEnv(t, 2)
+	ctx := context.Background()
+
+	env.registry.set(func(f *fakeRegistry) {
+		f.versions = []string{"1.0.0", "1.0.0.1", "1.1.0", "latest"}
+	})
+
+	vs, err := env.service.GetVersions(ctx, GetVersionsOptions{
+		Hostname:  testHostname,
+		Namespace: "hashicorp",
+		Type:      "null",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1.0.0.1", "1.1.0", "latest"}, versionsOf(vs))
+	assert.Equal(t, map[string][]string{
+		testHostname + "/hashicorp/null": {"1.0.0"},
+	}, env.pruned)
+}
+
+func TestService_Sync_upstreamFailure(t *testing.T) {
+	env := newTestEnv(t, 0)
+	ctx := context.Background()
+
+	env.registry.set(func(f *fakeRegistry) {
+		f.failing = true
+	})
+
+	_, err := env.service.GetVersions(ctx, GetVersionsOptions{
+		Hostname:  testHostname,
+		Namespace: "hashicorp",
+		Type:      "null",
+	})
+	require.Error(t, err)
+	assert.False(t, errors.Is(err, ErrTypedNotFound), "the upstream error must be surfaced")
+
+	// Recover after the upstream is back.
+	env.registry.set(func(f *fakeRegistry) {
+		f.failing = false
+	})
+
+	vs, err := env.service.GetVersions(ctx, GetVersionsOptions{
+		Hostname:  testHostname,
+		Namespace: "hashicorp",
+		Type:      "null",
+	})
+	require.NoError(t, err)
+	assert.Len(t, vs, 3)
+}
+
+func TestService_Sync_degraded(t *testing.T) {
+	env := newTestEnv(t, 0)
+	ctx := context.Background()
+
+	opts := GetVersionsOptions{
+		Hostname:  testHostname,
+		Namespace: "hashicorp",
+		Type:      "null",
+	}
+
+	_, err := env.service.GetVersions(ctx, opts)
+	require.NoError(t, err)
+
+	env.registry.set(func(f *fakeRegistry) {
+		f.failing = true
+	})
+
+	// Exhaust the error budget, the exhausting error is warned instead of reported.
+	for i := 1; i < SyncErrorBudget; i++ {
+		env.clock.Advance(30 * time.Minute)
+		require.Error(t, env.service.Sync(ctx))
+	}
+	env.clock.Advance(30 * time.Minute)
+	require.NoError(t, env.service.Sync(ctx))
+
+	ds := env.service.GetDegradedProviders(ctx)
+	require.Len(t, ds, 1)
+	assert.Equal(t, SyncErrorBudget, ds[0].Failures)
+	assert.Equal(t, env.clock.Now().Add(MinSyncBackoff), ds[0].RetryAt)
+
+	hits := func() (n int) {
+		env.registry.get(func(f *fakeRegistry) {
+			n = f.hits["/v1/providers/hashicorp/null/versions"]
+		})
+
+		return
+	}
+	h := hits()
+
+	// Backed off, and the error is not reported again.
+	require.NoError(t, env.service.Sync(ctx))
+	assert.Equal(t, h, hits())
+
+	// Retried after the backoff, and backed off doubly.
+	env.clock.Advance(MinSyncBackoff)
+	require.NoError(t, env.service.Sync(ctx))
+	assert.Equal(t, h+1, hits())
+
+	ds = env.service.GetDegradedProviders(ctx)
+	require.Len(t, ds, 1)
+	assert.Equal(t, env.clock.Now().Add(2*MinSyncBackoff), ds[0].RetryAt)
+
+	// Restored after the upstream is back.
+	env.registry.set(func(f *fakeRegistry) {
+		f.failing = false
+	})
+	env.clock.Advance(2 * MinSyncBackoff)
+	require.NoError(t, env.service.Sync(ctx))
+	assert.Empty(t, env.service.GetDegradedProviders(ctx))
+}
+
+func TestService_Sync_notBlockingWriter(t *testing.T) {
+	env := newTestEnv(t, 0)
+	ctx := context.Background()
+
+	env.registry.set(func(f *fakeRegistry) {
+		f.delay = time.Second
+	})
+
+	done := make(chan error)
+
+	go func() {
+		_, err := env.service.GetVersions(ctx, GetVersionsOptions{
+			Hostname:  testHostname,
+			Namespace: "hashicorp",
+			Type:      "null",
+		})
+		done <- err
+	}()
+
+	// Write during the slow upstream call.
+	time.Sleep(200 * time.Millisecond)
+
+	start := time.Now()
+	err := env.service.boltDriver.Update(func(tx *bolt.Tx) error {
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Less(t, time.Since(start), 500*time.Millisecond,
+		"the writer must not be blocked by the upstream call")
+
+	require.NoError(t, <-done)
+}
+
+func TestService_Sync_eagerPlatformSync(t *testing.T) {
+	ps, err := normalizeProviderPatterns([]string{"HashiCorp/AWS", "registry.example.com/hashicorp/*"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"registry.terraform.io/hashicorp/aws", "registry.example.com/hashicorp/*"}, ps)
+
+	_, err = normalizeProviderPatterns([]string{"aws"})
+	assert.Error(t, err)
+
+	downloads := func(env *testEnv) (n int) {
+		env.registry.get(func(f *fakeRegistry) {
+			for p, c := range f.hits {
+				if strings.Contains(p, "/download/") {
+					n += c
+				}
+			}
+		})
+
+		return n
+	}
+
+	opts := GetVersionsOptions{
+		Hostname:  testHostname,
+		Namespace: "hashicorp",
+		Type:      "null",
+	}
+
+	// Not in the allowlist.
+	env := newTestEnv(t, 0)
+	env.service.eagerPlatformSync = []string{"registry.terraform.io/hashicorp/aws"}
+
+	_, err = env.service.GetVersions(context.Background(), opts)
+	require.NoError(t, err)
+
+	time.Sleep(200 * time.Millisecond)
+	assert.Zero(t, downloads(env))
+
+	// In the allowlist.
+	env = newTestEnv(t, 0)
+	env.service.eagerPlatformSync = []string{testHostname + "/hashicorp/*"}
+
+	_, err = env.service.GetVersions(context.Background(), opts)
+	require.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		return downloads(env) != 0
+	}, 5*time.Second, 50*time.Millisecond)
+}
+
+func TestService_Sync_merged(t *testing.T) {
+	env := newTestEnv(t, 0)
+	ctx := context.Background()
+
+	_, err := env.service.GetVersions(ctx, GetVersionsOptions{
+		Hostname:  testHostname,
+		Namespace: "hashicorp",
+		Type:      "null",
+	})
+	require.NoError(t, err)
+
+	env.registry.set(func(f *fakeRegistry) {
+		f.delay = 500 * time.Millisecond
+		f.hits = map[string]int{}
+	})
+	env.clock.Advance(time.Hour)
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			assert.NoError(t, env.service.Sync(ctx))
+		}()
+	}
+
+	time.Sleep(200 * time.Millisecond)
+
+	kinds := make([]string, 0)
+	for _, a := range env.service.GetSyncActivities(ctx) {
+		kinds = append(kinds, a.Kind)
+	}
+	assert.Contains(t, kinds, SyncKindAll)
+
+	wg.Wait()
+
+	env.registry.get(func(f *fakeRegistry) {
+		assert.Equal(t, 1, f.hits["/v1/providers/hashicorp/null/versions"])
+	})
+}
+
+func TestService_GetSyncHistory(t *testing.T) {
+	env := newTestEnv(t, 0)
+	ctx := context.Background()
+
+	opts := GetSyncHistoryOptions{
+		Hostname:  testHostname,
+		Namespace: "hashicorp",
+		Type:      "null",
+	}
+
+	h, err := env.service.GetSyncHistory(ctx, opts)
+	require.NoError(t, err)
+	assert.Empty(t, h)
+
+	_, err = env.service.GetVersions(ctx, GetVersionsOptions(opts))
+	require.NoError(t, err)
+
+	// Failed to sync.
+	env.registry.set(func(f *fakeRegistry) {
+		f.failing = true
+	})
+	env.clock.Advance(time.Hour)
+	require.Error(t, env.service.Sync(ctx))
+
+	// Synced with a new version.
+	env.registry.set(func(f *fakeRegistry) {
+		f.failing = false
+		f.versions = append(f.versions, "2.1.0")
+		f.modified = env.clock.Now().Add(time.Minute)
+	})
+	env.clock.Advance(time.Hour)
+	require.NoError(t, env.service.Sync(ctx))
+
+	h, err = env.service.GetSyncHistory(ctx, opts)
+	require.NoError(t, err)
+	require.Len(t, h, 3)
+
+	// Newest first.
+	assert.Equal(t, env.clock.Now(), h[0].Timestamp.UTC())
+	assert.Equal(t, []string{"2.1.0"}, h[0].VersionsAdded)
+	assert.Empty(t, h[0].Error)
+	assert.NotEmpty(t, h[1].Error)
+	assert.Empty(t, h[1].VersionsAdded)
+	assert.ElementsMatch(t, []string{"1.0.0", "1.1.0", "2.0.0"}, h[2].VersionsAdded)
+
+	// Retain the maximum attempts.
+	env.service.maxSyncHistory = 2
+	require.NoError(t, env.service.Sync(ctx))
+
+	h, err = env.service.GetSyncHistory(ctx, opts)
+	require.NoError(t, err)
+	assert.Len(t, h, 2)
+}
@@ -0,0 +1,269 @@
+package metadata
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/seal-io/walrus/utils/gopool"
+	"github.com/seal-io/walrus/utils/json"
+	"github.com/seal-io/walrus/utils/log"
+	"github.com/tidwall/gjson"
+
+	"github.com/seal-io/hermitcrab/pkg/maintenance"
+	"github.com/seal-io/hermitcrab/pkg/provider/addrs"
+)
+
+// The kinds of the shadow comparisons.
+const (
+	// ShadowKindVersions compares the served version set of a provider.
+	ShadowKindVersions = "versions"
+	// ShadowKindPlatform compares the served filename and shasum of a provider platform.
+	ShadowKindPlatform = "platform"
+)
+
+// The results of the shadow comparisons.
+const (
+	ShadowResultMatch    = "match"
+	ShadowResultDiverged = "diverged"
+	ShadowResultError    = "error"
+)
+
+// shadowTimeout is the maximum duration of querying the upstream for a shadow comparison.
+const shadowTimeout = 30 * time.Second
+
+// ShadowDivergence holds the differences between the served result and the upstream one.
+type ShadowDivergence struct {
+	// Missing holds the versions of the upstream not served, i.e. the staleness.
+	Missing []string `json:"missing,omitempty"`
+	// Extra holds the served versions not in the upstream.
+	Extra []string `json:"extra,omitempty"`
+	// Filename is the upstream filename of the platform if differs from the served one.
+	Filename string `json:"filename,omitempty"`
+	// Shasum is the upstream shasum of the platform if differs from the served one, i.e. the corruption.
+	Shasum string `json:"shasum,omitempty"`
+}
+
+// Diverged returns true if any difference found.
+func (d ShadowDivergence) Diverged() bool {
+	return len(d.Missing) != 0 || len(d.Extra) != 0 || d.Filename != "" || d.Shasum != ""
+}
+
+var _shadowCollector = newShadowCollector()
+
+// NewShadowCollector returns the collector of the shadow comparisons against the upstreams.
+func NewShadowCollector() prometheus.Collector {
+	return _shadowCollector
+}
+
+func newShadowCollector() *shadowCollector {
+	return &shadowCollector{
+		comparisons: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: "shadow",
+				Name:      "comparisons_total",
+				Help:      "The total number of comparing the served results against the upstreams.",
+			},
+			[]string{"hostname", "kind", "result"},
+		),
+		divergences: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: "shadow",
+				Name:      "divergences_total",
+				Help: "The total number of the differences between the served results and the upstreams, " +
+					"the reason is one of missing_version, extra_version, filename and shasum.",
+			},
+			[]string{"hostname", "reason"},
+		),
+	}
+}
+
+type shadowCollector struct {
+	comparisons *prometheus.CounterVec
+	divergences *prometheus.CounterVec
+}
+
+func (c *shadowCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.comparisons.Describe(ch)
+	c.divergences.Describe(ch)
+}
+
+func (c *shadowCollector) Collect(ch chan<- prometheus.Metric) {
+	c.comparisons.Collect(ch)
+	c.divergences.Collect(ch)
+}
+
+func (c *shadowCollector) observe(addr addrs.Address, kind string, d ShadowDivergence, err error) {
+	switch {
+	case err != nil:
+		c.comparisons.WithLabelValues(addr.Hostname, kind, ShadowResultError).Inc()
+		return
+	case !d.Diverged():
+		c.comparisons.WithLabelValues(addr.Hostname, kind, ShadowResultMatch).Inc()
+		return
+	}
+
+	c.comparisons.WithLabelValues(addr.Hostname, kind, ShadowResultDiverged).Inc()
+	c.divergences.WithLabelValues(addr.Hostname, "missing_version").Add(float64(len(d.Missing)))
+	c.divergences.WithLabelValues(addr.Hostname, "extra_version").Add(float64(len(d.Extra)))
+
+	if d.Filename != "" {
+		c.divergences.WithLabelValues(addr.Hostname, "filename").Inc()
+	}
+
+	if d.Shasum != "" {
+		c.divergences.WithLabelValues(addr.Hostname, "shasum").Inc()
+	}
+}
+
+// shadow compares the given served result against the upstream in background for a sample of the queries,
+// the listing of the versions and the platform are compared,
+// the provider never synced from the upstream is skipped, i.e. the published one.
+func (s *service) shadow(addr addrs.Address, modified time.Time, served []Version) {
+	if s.shadowRate <= 0 || s.offline || modified.IsZero() || maintenance.Enabled() {
+		return
+	}
+
+	var kind string
+
+	switch {
+	case addr.Version == "":
+		kind = ShadowKindVersions
+	case addr.OS != "" && addr.Arch != "" && len(served) == 1 && len(served[0].Platforms) == 1:
+		// Never compare the removed version, which is not in the upstream.
+		if served[0].Removed {
+			return
+		}
+
+		kind = ShadowKindPlatform
+	default:
+		return
+	}
+
+	if s.shadowRate < 1 && rand.Float64() >= s.shadowRate { // nolint:gosec
+		return
+	}
+
+	// Compare at most one at a time per subject.
+	key := kind + ":" + addr.String()
+	if _, loaded := s.shadowing.LoadOrStore(key, struct{}{}); loaded {
+		return
+	}
+
+	// Detach from the caller, which may sort the result in place.
+	served = slices.Clone(served)
+
+	gopool.Go(func() {
+		defer s.shadowing.Delete(key)
+
+		ctx, cancel := context.WithTimeout(context.Background(), shadowTimeout)
+		defer cancel()
+
+		d, err := s.shadowCompare(ctx, addr, served)
+		_shadowCollector.observe(addr, kind, d, err)
+
+		logger := log.WithName("provider").WithName("metadata").
+			WithValues(addr.LogValues()...)
+
+		switch {
+		case err != nil:
+			logger.V(4).Infof("error comparing %s against upstream: %v", kind, err)
+		case d.Diverged():
+			logger.Warnf("served %s diverged from upstream: %s", kind, string(json.ShouldMarshal(d)))
+		}
+	})
+}
+
+// shadowCompare queries the upstream of the given provider,
+// and returns the differences against the given served result.
+func (s *service) shadowCompare(ctx context.Context, addr addrs.Address, served []Version) (ShadowDivergence, error) {
+	src, err := s.source(ctx, addr.Hostname)
+	if err != nil {
+		return ShadowDivergence{}, fmt.Errorf("error getting upstream source: %w", err)
+	}
+
+	var d ShadowDivergence
+
+	// Compare the platform.
+	if addr.Version != "" {
+		platformB, err := src.GetPlatform(ctx, addr.Namespace, addr.Type, addr.Version, addr.OS, addr.Arch)
+		if err != nil {
+			return d, fmt.Errorf("error getting remote platform: %w", err)
+		}
+
+		p := served[0].Platforms[0]
+
+		if fn := json.Get(platformB, "filename").String(); fn != p.Filename {
+			d.Filename = fn
+		}
+
+		// The shasum omitted by the upstream is backfilled from the SHA256SUMS, see ImportShasums.
+		if sum := json.Get(platformB, "shasum").String(); sum != "" && sum != p.Shasum {
+			d.Shasum = sum
+		}
+
+		return d, nil
+	}
+
+	// Compare the version set.
+	versionsB, err := src.GetVersions(ctx, addr.Namespace, addr.Type)
+	if err != nil {
+		return d, fmt.Errorf("error getting remote versions: %w", err)
+	}
+
+	upstream := map[string]bool{}
+
+	json.Get(versionsB, "versions").ForEach(func(_, versionJ gjson.Result) bool {
+		version := versionJ.Get("version").String()
+		if version == "" {
+			return true
+		}
+
+		// Skip the versions never synced.
+		var protocols []string
+		for _, p := range versionJ.Get("protocols").Array() {
+			protocols = append(protocols, p.String())
+		}
+
+		if s.isProtocolCompatible(protocols) {
+			upstream[version] = true
+		}
+
+		return true
+	})
+
+	servedSet := make(map[string]bool, len(served))
+
+	for _, v := range served {
+		// The removed version is served from the cache on purpose.
+		if v.Removed {
+			continue
+		}
+
+		servedSet[v.Version] = true
+
+		if !upstream[v.Version] {
+			d.Extra = append(d.Extra, v.Version)
+		}
+	}
+
+	// The versions beyond the limit are pruned on purpose.
+	if s.maxVersions <= 0 || len(servedSet) < s.maxVersions {
+		for v := range upstream {
+			if !servedSet[v] {
+				d.Missing = append(d.Missing, v)
+			}
+		}
+	}
+
+	sort.Strings(d.Missing)
+	sort.Strings(d.Extra)
+
+	return d, nil
+}
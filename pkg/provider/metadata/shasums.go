@@ -0,0 +1,204 @@
+package metadata
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/seal-io/walrus/utils/errorx"
+	"github.com/seal-io/walrus/utils/json"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/seal-io/hermitcrab/pkg/provider/addrs"
+	"github.com/seal-io/hermitcrab/pkg/registry"
+)
+
+// shasumsKey is the key of the version bucket, which holds the imported shasums of the archives,
+// the imported shasum backfills the platform without shasum,
+// which survives the re-syncing of the platform, takes a look of the key:
+//
+//	BUCKET({version}):
+//	  KEY(shasums): map[{filename}]string
+const shasumsKey = "shasums"
+
+// ImportShasumsOptions holds the options of importing the SHA256SUMS file of a provider version.
+type ImportShasumsOptions struct {
+	Hostname  string
+	Namespace string
+	Type      string
+	Version   string
+	// Content is the content of the SHA256SUMS file,
+	// each line is in the format of "<SHA256> <FILENAME>".
+	Content []byte
+}
+
+// ParseShasums parses the given content of a SHA256SUMS file into a map of the filename to the shasum.
+func ParseShasums(content []byte) (map[string]string, error) {
+	r := map[string]string{}
+
+	sc := bufio.NewScanner(bytes.NewReader(content))
+	for l := 1; sc.Scan(); l++ {
+		fs := strings.Fields(sc.Text())
+		if len(fs) == 0 {
+			continue
+		}
+
+		if len(fs) != 2 {
+			return nil, fmt.Errorf("invalid line %d: must be <SHA256> <FILENAME>", l)
+		}
+
+		sum := strings.ToLower(fs[0])
+		if bs, err := hex.DecodeString(sum); err != nil || len(bs) != 32 {
+			return nil, fmt.Errorf("invalid line %d: malformed sha256 checksum", l)
+		}
+
+		// The binary mode of sha256sum prefixes the filename with "*".
+		r[strings.TrimPrefix(fs[1], "*")] = sum
+	}
+
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("error reading shasums: %w", err)
+	}
+
+	return r, nil
+}
+
+// getShasums returns the imported shasums of the given version bucket.
+func getShasums(versionBucket *bolt.Bucket) map[string]string {
+	r := map[string]string{}
+
+	data := getValue(versionBucket, shasumsKey)
+	if len(data) != 0 {
+		_ = json.Unmarshal(data, &r)
+	}
+
+	return r
+}
+
+// backfillShasum returns the platform JSON with the imported shasum if the given one has no shasum.
+func backfillShasum(shasums map[string]string, data []byte) []byte {
+	if len(shasums) == 0 || len(data) == 0 || json.Get(data, "shasum").String() != "" {
+		return data
+	}
+
+	sum, ok := shasums[json.Get(data, "filename").String()]
+	if !ok {
+		return data
+	}
+
+	r, err := json.Set(data, "shasum", toBytes(`"`+sum+`"`))
+	if err != nil {
+		return data
+	}
+
+	return r
+}
+
+// ImportShasums imports the shasums of the archives of the given version from a SHA256SUMS file,
+// which backfills the stored platforms without shasum, returns the imported filenames in order,
+// the entries of the other providers or versions are ignored,
+// fails if any entry conflicts with the shasum of the stored platform.
+func (s *service) ImportShasums(_ context.Context, opts ImportShasumsOptions) ([]string, error) {
+	addr := addrs.Address{
+		Hostname:  opts.Hostname,
+		Namespace: opts.Namespace,
+		Type:      opts.Type,
+		Version:   opts.Version,
+	}.Normalize()
+	if addr.Validate() != nil || addr.Version == "" {
+		return nil, errors.New("invalid options")
+	}
+
+	all, err := ParseShasums(opts.Content)
+	if err != nil {
+		return nil, errorx.WrapHttpError(http.StatusBadRequest, err, "invalid shasums")
+	}
+
+	imported := map[string]string{}
+
+	for n, sum := range all {
+		if v, _, _, ok := registry.ParseArchiveFilename(addr.Type, n); ok && v == addr.Version {
+			imported[n] = sum
+		}
+	}
+
+	if len(imported) == 0 {
+		return nil, errorx.HttpErrorf(http.StatusBadRequest, "no archives of %s in shasums", addr)
+	}
+
+	err = s.update(addr, func(tx *bolt.Tx) error {
+		typedBucket := tx.
+			Bucket(toBytes(domain)).
+			Bucket(toBytes(addr.TypedKey()))
+		if typedBucket == nil {
+			return ErrTypedNotFound
+		}
+
+		versionBucket := typedBucket.Bucket(toBytes(addr.Version))
+		if versionBucket == nil {
+			return ErrVersionNotFound
+		}
+
+		// Reject the conflicts with the shasums given by the upstream.
+		getPlatform := platformsOf(versionBucket)
+
+		var version Version
+		_ = json.Unmarshal(getValue(versionBucket, "data"), &version)
+
+		for _, p := range version.Platforms {
+			pa := addr.WithPlatform(p.OS, p.Arch)
+
+			_, data, _ := getPlatform(pa.PlatformKey())
+
+			n := json.Get(data, "filename").String()
+			if n == "" {
+				n = pa.ArchiveFilename()
+			}
+
+			stored, sum := json.Get(data, "shasum").String(), imported[n]
+			if stored != "" && sum != "" && stored != sum {
+				return errorx.HttpErrorf(http.StatusConflict, "shasum of %s conflicts with the stored one", n)
+			}
+		}
+
+		shasums := getShasums(versionBucket)
+		for n, sum := range imported {
+			shasums[n] = sum
+		}
+
+		data, err := json.Marshal(shasums)
+		if err != nil {
+			return err
+		}
+
+		err = putValue(versionBucket, shasumsKey, data)
+		if err != nil {
+			return err
+		}
+
+		// Index the backfilled platforms.
+		return indexVersion(tx, addr, versionBucket, false)
+	})
+	if err != nil {
+		if errors.Is(err, ErrTypedNotFound) || errors.Is(err, ErrVersionNotFound) {
+			return nil, errorx.WrapHttpError(http.StatusNotFound, err, "version is not mirrored")
+		}
+
+		return nil, fmt.Errorf("error importing shasums: %w", err)
+	}
+
+	r := make([]string, 0, len(imported))
+	for n := range imported {
+		r = append(r, n)
+	}
+
+	sort.Strings(r)
+
+	return r, nil
+}
@@ -0,0 +1,74 @@
+package metadata
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/seal-io/walrus/utils/errorx"
+)
+
+// ErrPlatformNotPublished is returned if the version exists but the platform is never published by the upstream,
+// i.e. the darwin_arm64 of an old version built before the Apple Silicon.
+var ErrPlatformNotPublished = errors.New("platform not published")
+
+// publishes returns true if the given platform is listed in the version,
+// the version without the listing is treated as publishing all platforms.
+func (v Version) publishes(os, arch string) bool {
+	if len(v.Platforms) == 0 {
+		return true
+	}
+
+	for _, p := range v.Platforms {
+		if p.OS == os && p.Arch == arch {
+			return true
+		}
+	}
+
+	return false
+}
+
+// notPublishedError returns the error responding 404 for the platform not published in the given version,
+// which lists the published platforms of the version.
+func notPublishedError(version Version, os, arch string) error {
+	ps := make([]string, 0, len(version.Platforms))
+	for _, p := range version.Platforms {
+		ps = append(ps, p.OS+"_"+p.Arch)
+	}
+
+	sort.Strings(ps)
+
+	return errorx.WrapHttpError(http.StatusNotFound,
+		platformNotPublishedError{Version: version.Version, Platforms: ps},
+		fmt.Sprintf("platform %s_%s is not published for version %s", os, arch, version.Version))
+}
+
+// platformNotPublishedError is the cause of the unpublished platform,
+// which holds the published platforms of the version in form of <OS>_<ARCH>.
+type platformNotPublishedError struct {
+	Version   string
+	Platforms []string
+}
+
+func (e platformNotPublishedError) Error() string {
+	return ErrPlatformNotPublished.Error() + ", available platforms: " + strings.Join(e.Platforms, ", ")
+}
+
+func (e platformNotPublishedError) Unwrap() error {
+	return ErrPlatformNotPublished
+}
+
+// ErrorCode returns the machine-readable code of the error.
+func (e platformNotPublishedError) ErrorCode() string {
+	return "platform_not_published"
+}
+
+// ErrorDetails returns the structured details of the error.
+func (e platformNotPublishedError) ErrorDetails() any {
+	return map[string]any{
+		"version":   e.Version,
+		"platforms": e.Platforms,
+	}
+}
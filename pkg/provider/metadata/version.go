@@ -0,0 +1,175 @@
+package metadata
+
+import (
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+// The fallbacks of ordering the versions rejected by the semantic versioning.
+const (
+	// VersionFallbackTolerant orders the version by the numeric segments,
+	// i.e. 1.2.3.4 is ordered between 1.2.3 and 1.2.4.
+	VersionFallbackTolerant = "tolerant"
+	// VersionFallbackLexical orders the version lexically after all ordered versions,
+	// i.e. latest.
+	VersionFallbackLexical = "lexical"
+)
+
+// parsedVersion holds a version parsed tolerantly.
+type parsedVersion struct {
+	raw string
+	// semver is nil if the version is rejected by the semantic versioning.
+	semver *semver.Version
+	// segments holds the numeric segments, which are not limited to three,
+	// nil if the version is not parsable even tolerantly.
+	segments   []uint64
+	prerelease string
+}
+
+// parseVersion parses the given version in semantic versioning,
+// falls back to parse the numeric segments split by dot with an optional prerelease,
+// i.e. 1.2.3.4 and v1.2.3.4-beta.
+func parseVersion(s string) parsedVersion {
+	pv := parsedVersion{raw: s}
+
+	if sv, err := semver.NewVersion(s); err == nil {
+		pv.semver = sv
+		pv.segments = []uint64{sv.Major(), sv.Minor(), sv.Patch()}
+		pv.prerelease = sv.Prerelease()
+
+		return pv
+	}
+
+	core, _, _ := strings.Cut(strings.TrimPrefix(s, "v"), "+")
+	core, pre, _ := strings.Cut(core, "-")
+
+	ss := strings.Split(core, ".")
+	segments := make([]uint64, 0, len(ss))
+
+	for i := range ss {
+		n, err := strconv.ParseUint(ss[i], 10, 64)
+		if err != nil {
+			return pv
+		}
+
+		segments = append(segments, n)
+	}
+
+	pv.segments = segments
+	pv.prerelease = pre
+
+	return pv
+}
+
+// fallback returns the fallback of ordering the version,
+// returns blank if the version is in semantic versioning.
+func (pv parsedVersion) fallback() string {
+	switch {
+	case pv.semver != nil:
+		return ""
+	case pv.segments != nil:
+		return VersionFallbackTolerant
+	}
+
+	return VersionFallbackLexical
+}
+
+// compareVersions returns an integer comparing two parsed versions,
+// the versions not parsable even tolerantly are less than the others and compared lexically.
+func compareVersions(a, b parsedVersion) int {
+	switch {
+	case a.segments == nil && b.segments == nil:
+		return strings.Compare(a.raw, b.raw)
+	case a.segments == nil:
+		return -1
+	case b.segments == nil:
+		return 1
+	}
+
+	for i := 0; i < len(a.segments) || i < len(b.segments); i++ {
+		var x, y uint64
+		if i < len(a.segments) {
+			x = a.segments[i]
+		}
+
+		if i < len(b.segments) {
+			y = b.segments[i]
+		}
+
+		if x != y {
+			if x > y {
+				return 1
+			}
+
+			return -1
+		}
+	}
+
+	if a.semver != nil && b.semver != nil {
+		if c := a.semver.Compare(b.semver); c != 0 {
+			return c
+		}
+	} else if a.prerelease != b.prerelease {
+		// The release is greater than its prereleases.
+		switch {
+		case a.prerelease == "":
+			return 1
+		case b.prerelease == "":
+			return -1
+		}
+
+		return strings.Compare(a.prerelease, b.prerelease)
+	}
+
+	return strings.Compare(a.raw, b.raw)
+}
+
+// SortVersions sorts the given versions by semver descending,
+// the versions rejected by the semantic versioning are ordered by the numeric segments tolerantly,
+// i.e. 1.2.3.4, the others are placed at the end in lexical order.
+func SortVersions(vs []Version) {
+	sortVersionsBy(vs, func(v Version) string { return v.Version })
+}
+
+// sortVersionsBy sorts the given items by the version of the given key function descending,
+// see SortVersions.
+func sortVersionsBy[T any](items []T, key func(T) string) {
+	pvs := make(map[string]parsedVersion, len(items))
+	for i := range items {
+		k := key(items[i])
+		if _, ok := pvs[k]; !ok {
+			pvs[k] = parseVersion(k)
+		}
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		a, b := pvs[key(items[i])], pvs[key(items[j])]
+
+		// Keep the unparsable versions in lexical order.
+		if a.segments == nil && b.segments == nil {
+			return a.raw < b.raw
+		}
+
+		return compareVersions(a, b) > 0
+	})
+}
+
+// newestFirst returns the given versions excluding the given excluded ones,
+// sorted by version descending, see SortVersions.
+func newestFirst(versions, excluded []string) []string {
+	r := make([]string, 0, len(versions))
+
+	for _, v := range versions {
+		if !slices.Contains(excluded, v) {
+			r = append(r, v)
+		}
+	}
+
+	sortVersionsBy(r, func(v string) string { return v })
+
+	return r
+}
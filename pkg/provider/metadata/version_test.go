@@ -0,0 +1,50 @@
+package metadata
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSortVersions(t *testing.T) {
+	vs := []Version{
+		{Version: "1.10.0"},
+		{Version: "v2.0.0-beta"},
+		{Version: "unknown"},
+		{Version: "1.2.0"},
+		{Version: "2.0.0"},
+		{Version: "1.2.0.4"},
+		{Version: "latest"},
+		{Version: "1.2.0.4-rc1"},
+		{Version: "1.3"},
+	}
+
+	SortVersions(vs)
+
+	actual := make([]string, 0, len(vs))
+	for i := range vs {
+		actual = append(actual, vs[i].Version)
+	}
+
+	assert.Equal(t, []string{
+		"2.0.0", "v2.0.0-beta", "1.10.0", "1.3", "1.2.0.4", "1.2.0.4-rc1", "1.2.0", "latest", "unknown",
+	}, actual)
+}
+
+func TestParseVersion(t *testing.T) {
+	testCases := []struct {
+		given    string
+		expected string
+	}{
+		{given: "1.2.3", expected: ""},
+		{given: "v1.2", expected: ""},
+		{given: "1.2.3.4", expected: VersionFallbackTolerant},
+		{given: "v1.2.3.4-beta+build", expected: VersionFallbackTolerant},
+		{given: "1.2.x", expected: VersionFallbackLexical},
+		{given: "", expected: VersionFallbackLexical},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.expected, parseVersion(tc.given).fallback(), tc.given)
+	}
+}
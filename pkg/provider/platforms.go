@@ -0,0 +1,81 @@
+package provider
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// observedPlatformTTL is the duration to forget the platform not requested since.
+const observedPlatformTTL = 30 * 24 * time.Hour
+
+// ObservedPlatform holds the requests of a platform observed from the archive downloads.
+type ObservedPlatform struct {
+	Platform string    `json:"platform"`
+	Requests int64     `json:"requests"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// platformObserver counts the platforms of the archives requested by the clients.
+type platformObserver struct {
+	m  sync.Mutex
+	ps map[string]*ObservedPlatform
+}
+
+// ObservePlatform records the platform of an archive requested by the client,
+// does nothing if the platform inference is disabled.
+func (s *Service) ObservePlatform(os, arch string) {
+	if !s.InferPlatforms || os == "" || arch == "" {
+		return
+	}
+
+	o := &s.observer
+	k := os + "_" + arch
+
+	o.m.Lock()
+	defer o.m.Unlock()
+
+	if o.ps == nil {
+		o.ps = map[string]*ObservedPlatform{}
+	}
+
+	p, ok := o.ps[k]
+	if !ok {
+		p = &ObservedPlatform{Platform: k}
+		o.ps[k] = p
+	}
+
+	p.Requests++
+	p.LastSeen = time.Now()
+}
+
+// ObservedPlatforms returns the platforms requested within the last 30 days,
+// the most requested first.
+func (s *Service) ObservedPlatforms() []ObservedPlatform {
+	o := &s.observer
+	deadline := time.Now().Add(-observedPlatformTTL)
+
+	o.m.Lock()
+	defer o.m.Unlock()
+
+	r := make([]ObservedPlatform, 0, len(o.ps))
+
+	for k, p := range o.ps {
+		if p.LastSeen.Before(deadline) {
+			delete(o.ps, k)
+			continue
+		}
+
+		r = append(r, *p)
+	}
+
+	sort.Slice(r, func(i, j int) bool {
+		if r[i].Requests != r[j].Requests {
+			return r[i].Requests > r[j].Requests
+		}
+
+		return r[i].Platform < r[j].Platform
+	})
+
+	return r
+}
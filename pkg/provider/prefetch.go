@@ -0,0 +1,139 @@
+package provider
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/seal-io/walrus/utils/gopool"
+	"github.com/seal-io/walrus/utils/log"
+
+	"github.com/seal-io/hermitcrab/pkg/download"
+	"github.com/seal-io/hermitcrab/pkg/maintenance"
+	"github.com/seal-io/hermitcrab/pkg/policy"
+	"github.com/seal-io/hermitcrab/pkg/provider/addrs"
+	"github.com/seal-io/hermitcrab/pkg/provider/metadata"
+	"github.com/seal-io/hermitcrab/pkg/provider/provenance"
+	"github.com/seal-io/hermitcrab/pkg/provider/storage"
+	"github.com/seal-io/hermitcrab/pkg/registry"
+)
+
+// prefetchTimeout is the maximum duration of prefetching a new release.
+const prefetchTimeout = 10 * time.Minute
+
+// prefetchNewRelease prefetches the archives of the newest given version in background,
+// for the platforms the clients downloaded the provider previously,
+// so that the first `terraform init` after the release hits the cache,
+// the provider never downloaded by the clients is skipped.
+func (s *Service) prefetchNewRelease(addr addrs.Address, versions []string) {
+	if !s.PrefetchNewReleases || s.Offline || len(versions) == 0 {
+		return
+	}
+
+	gopool.Go(func() {
+		logger := log.WithName("provider").WithName("prefetch").
+			WithValues(addr.WithVersion(versions[0]).LogValues()...)
+
+		ctx, cancel := context.WithTimeout(context.Background(), prefetchTimeout)
+		defer cancel()
+
+		ps, err := s.clientPlatformsOf(ctx, addr)
+		if err != nil {
+			logger.Warnf("error getting downloaded platforms: %v", err)
+			return
+		}
+
+		if len(ps) == 0 {
+			return
+		}
+
+		// Give way to the interactive downloads.
+		ctx = download.WithPriority(ctx, download.PriorityBackground)
+
+		var n int
+
+		for _, p := range ps {
+			if maintenance.Enabled() {
+				return
+			}
+
+			paddr := addr.WithVersion(versions[0]).WithPlatform(p[0], p[1])
+
+			if err = s.fetch(ctx, paddr); err != nil {
+				logger.Warnf("error prefetching %s_%s: %v", p[0], p[1], err)
+				continue
+			}
+
+			n++
+		}
+
+		logger.Infof("prefetched %d/%d platforms of new release", n, len(ps))
+	})
+}
+
+// clientPlatformsOf returns the platforms of the given provider downloaded by the clients previously,
+// in form of [os, arch] and in order, which are inferred from the provenance of the cached archives,
+// excluding the ones fetched in background or published.
+func (s *Service) clientPlatformsOf(ctx context.Context, addr addrs.Address) ([][2]string, error) {
+	if s.Provenance == nil {
+		return nil, nil
+	}
+
+	rs, err := s.Provenance.List(ctx, addr.Typed())
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[[2]string]bool{}
+	ps := make([][2]string, 0)
+
+	for _, r := range rs {
+		if r.Background || r.Source == provenance.SourcePublish {
+			continue
+		}
+
+		_, os, arch, ok := registry.ParseArchiveFilename(addr.Type, r.Filename)
+		if !ok || seen[[2]string{os, arch}] || !policy.Get().ServesPlatform(os, arch) {
+			continue
+		}
+
+		seen[[2]string{os, arch}] = true
+		ps = append(ps, [2]string{os, arch})
+	}
+
+	sort.Slice(ps, func(i, j int) bool {
+		if ps[i][0] != ps[j][0] {
+			return ps[i][0] < ps[j][0]
+		}
+
+		return ps[i][1] < ps[j][1]
+	})
+
+	return ps, nil
+}
+
+// fetch fetches the archive of the given platform address into the storage.
+func (s *Service) fetch(ctx context.Context, addr addrs.Address) error {
+	p, err := s.Metadata.GetPlatform(ctx, metadata.GetPlatformOptions(addr))
+	if err != nil {
+		return err
+	}
+
+	if err = s.VerifyTrust(ctx, addr, p); err != nil {
+		return err
+	}
+
+	ar, err := s.Storage.LoadArchive(ctx, storage.LoadArchiveOptions{
+		Hostname:    addr.Hostname,
+		Namespace:   addr.Namespace,
+		Type:        addr.Type,
+		Filename:    p.Filename,
+		Shasum:      p.Shasum,
+		DownloadURL: p.DownloadURL,
+	})
+	if err != nil {
+		return err
+	}
+
+	return ar.Close()
+}
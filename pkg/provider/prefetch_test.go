@@ -0,0 +1,53 @@
+package provider
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/seal-io/hermitcrab/pkg/provider/addrs"
+	"github.com/seal-io/hermitcrab/pkg/provider/provenance"
+)
+
+func TestService_clientPlatformsOf(t *testing.T) {
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "metadata.db"), 0o600, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+
+	ps, err := provenance.NewService(db)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	addr := addrs.Address{Hostname: "registry.terraform.io", Namespace: "hashicorp", Type: "null"}
+
+	for _, r := range []provenance.Record{
+		{Filename: "terraform-provider-null_1.0.0_linux_amd64.zip", Source: provenance.SourceUpstream},
+		{Filename: "terraform-provider-null_1.1.0_linux_amd64.zip", Source: provenance.SourcePeer},
+		{Filename: "terraform-provider-null_1.1.0_darwin_arm64.zip", Source: provenance.SourceUpstream},
+		// The archives not requested by the clients.
+		{Filename: "terraform-provider-null_1.1.0_windows_amd64.zip", Source: provenance.SourceUpstream, Background: true},
+		{Filename: "terraform-provider-null_1.1.0_linux_arm64.zip", Source: provenance.SourcePublish},
+	} {
+		r.Hostname, r.Namespace, r.Type = addr.Hostname, addr.Namespace, addr.Type
+		require.NoError(t, ps.Record(ctx, r))
+	}
+
+	// The archive of another provider.
+	require.NoError(t, ps.Record(ctx, provenance.Record{
+		Hostname:  addr.Hostname,
+		Namespace: addr.Namespace,
+		Type:      "random",
+		Filename:  "terraform-provider-random_3.0.0_freebsd_amd64.zip",
+		Source:    provenance.SourceUpstream,
+	}))
+
+	s := &Service{Provenance: ps}
+
+	got, err := s.clientPlatformsOf(ctx, addr.WithVersion("2.0.0"))
+	require.NoError(t, err)
+	assert.Equal(t, [][2]string{{"darwin", "arm64"}, {"linux", "amd64"}}, got)
+}
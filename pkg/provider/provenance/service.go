@@ -0,0 +1,195 @@
+package provenance
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/seal-io/walrus/utils/errorx"
+	"github.com/seal-io/walrus/utils/json"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/seal-io/hermitcrab/pkg/database"
+	"github.com/seal-io/hermitcrab/pkg/provider/addrs"
+)
+
+// The sources of the cached archives.
+const (
+	// SourceUpstream indicates the archive is downloaded from the upstream.
+	SourceUpstream = "upstream"
+	// SourcePeer indicates the archive is downloaded from a peer.
+	SourcePeer = "peer"
+	// SourcePublish indicates the archive is published by a replicating instance.
+	SourcePublish = "publish"
+)
+
+// The verification results of the cached archives.
+const (
+	// VerificationChecksum indicates the archive matches the sha256 checksum given by the metadata.
+	VerificationChecksum = "checksum"
+	// VerificationNone indicates the archive is cached without the checksum to verify.
+	VerificationNone = "none"
+)
+
+// Record holds where a cached archive came from.
+type Record struct {
+	Hostname  string `json:"hostname"`
+	Namespace string `json:"namespace"`
+	Type      string `json:"type"`
+	Filename  string `json:"filename"`
+	// Source is the source of the archive, select from SourceUpstream, SourcePeer and SourcePublish.
+	Source string `json:"source"`
+	// URL is the URL the archive is downloaded from, blank if published.
+	URL string `json:"url,omitempty"`
+	// UpstreamHost is the host of the URL.
+	UpstreamHost string    `json:"upstreamHost,omitempty"`
+	Cached       time.Time `json:"cached"`
+	Shasum       string    `json:"shasum,omitempty"`
+	// Verification is the verification result, select from VerificationChecksum and VerificationNone.
+	Verification string `json:"verification"`
+	// Headers holds the headers of the response serving the archive.
+	Headers map[string]string `json:"headers,omitempty"`
+	// Background indicates the archive is fetched in background rather than requested by a client,
+	// i.e. prefetching or repairing.
+	Background bool `json:"background,omitempty"`
+}
+
+// Service holds the operation of the provenance of the cached archives,
+// the record survives the eviction of the archive for auditing,
+// and is replaced when the archive is cached again.
+// Value always be json.RawBytes, takes a look of the bucket structure:
+//
+//	BUCKET(provider_provenance)
+//	  KEY({hostname}/{namespace}/{type}/{filename}): Record
+type Service interface {
+	// Record records the provenance of a cached archive.
+	Record(context.Context, Record) error
+	// Get returns the provenance of the given archive of the given typed provider.
+	Get(ctx context.Context, addr addrs.Address, filename string) (Record, error)
+	// List returns the provenance of the archives of the given typed provider in filename order.
+	List(ctx context.Context, addr addrs.Address) ([]Record, error)
+}
+
+const domain = "provider_provenance"
+
+// NewService returns a new provenance service.
+func NewService(boltDriver database.BoltDriver) (Service, error) {
+	err := boltDriver.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(toBytes(domain))
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error creating provenance bucket: %w", err)
+	}
+
+	return &service{
+		boltDriver: boltDriver,
+	}, nil
+}
+
+type service struct {
+	boltDriver database.BoltDriver
+}
+
+// sensitiveHeaders are the response headers not recorded.
+var sensitiveHeaders = []string{"Set-Cookie", "Authorization", "Proxy-Authenticate", "Www-Authenticate"}
+
+// HeadersOf returns the flatten headers of the given response headers to record,
+// the sensitive headers are excluded.
+func HeadersOf(h http.Header) map[string]string {
+	r := make(map[string]string, len(h))
+
+	for k, vs := range h {
+		k = http.CanonicalHeaderKey(k)
+
+		sensitive := false
+
+		for _, s := range sensitiveHeaders {
+			if k == s {
+				sensitive = true
+				break
+			}
+		}
+
+		if !sensitive && len(vs) != 0 {
+			r[k] = strings.Join(vs, ", ")
+		}
+	}
+
+	return r
+}
+
+func (s *service) Record(_ context.Context, r Record) error {
+	addr := addrs.Address{
+		Hostname:  r.Hostname,
+		Namespace: r.Namespace,
+		Type:      r.Type,
+	}.Normalize()
+	if addr.Validate() != nil || r.Filename == "" {
+		return errors.New("invalid record")
+	}
+
+	r.Hostname, r.Namespace, r.Type = addr.Hostname, addr.Namespace, addr.Type
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("error marshaling record: %w", err)
+	}
+
+	return s.boltDriver.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(toBytes(domain)).Put(toBytes(keyOf(addr, r.Filename)), data)
+	})
+}
+
+func (s *service) Get(_ context.Context, addr addrs.Address, filename string) (Record, error) {
+	addr = addr.Normalize()
+
+	var r Record
+
+	err := s.boltDriver.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(toBytes(domain)).Get(toBytes(keyOf(addr, filename)))
+		if len(data) == 0 {
+			return errorx.HttpErrorf(http.StatusNotFound, "provenance of %s is not recorded", filename)
+		}
+
+		return json.Unmarshal(bytes.Clone(data), &r)
+	})
+
+	return r, err
+}
+
+func (s *service) List(_ context.Context, addr addrs.Address) ([]Record, error) {
+	prefix := toBytes(keyOf(addr.Normalize(), ""))
+
+	rs := make([]Record, 0)
+
+	err := s.boltDriver.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(toBytes(domain)).Cursor()
+
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			var r Record
+			if err := json.Unmarshal(bytes.Clone(v), &r); err != nil {
+				continue
+			}
+
+			rs = append(rs, r)
+		}
+
+		return nil
+	})
+
+	return rs, err
+}
+
+// keyOf returns the key of the given archive of the given typed provider.
+func keyOf(addr addrs.Address, filename string) string {
+	return addr.TypedKey() + "/" + filename
+}
+
+func toBytes(s string) []byte {
+	return []byte(s)
+}
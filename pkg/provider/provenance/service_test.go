@@ -0,0 +1,80 @@
+package provenance
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/seal-io/hermitcrab/pkg/provider/addrs"
+)
+
+func TestService(t *testing.T) {
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "provenance.db"), 0o600, nil)
+	require.NoError(t, err)
+
+	defer func() { _ = db.Close() }()
+
+	svc, err := NewService(db)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+
+	for _, r := range []Record{
+		{
+			Hostname:     "Registry.Terraform.io",
+			Namespace:    "hashicorp",
+			Type:         "null",
+			Filename:     "terraform-provider-null_3.2.2_linux_amd64.zip",
+			Source:       SourceUpstream,
+			URL:          "https://releases.hashicorp.com/terraform-provider-null_3.2.2_linux_amd64.zip",
+			Verification: VerificationChecksum,
+			Headers: HeadersOf(http.Header{
+				"Etag":       []string{`"abc"`},
+				"Set-Cookie": []string{"session=secret"},
+			}),
+		},
+		{
+			Hostname:     "registry.terraform.io",
+			Namespace:    "hashicorp",
+			Type:         "null",
+			Filename:     "terraform-provider-null_3.2.1_linux_amd64.zip",
+			Source:       SourcePublish,
+			Verification: VerificationChecksum,
+		},
+		{
+			Hostname:     "registry.terraform.io",
+			Namespace:    "hashicorp",
+			Type:         "null-extra",
+			Filename:     "terraform-provider-null-extra_1.0.0_linux_amd64.zip",
+			Source:       SourceUpstream,
+			Verification: VerificationNone,
+		},
+	} {
+		require.NoError(t, svc.Record(ctx, r))
+	}
+
+	addr := addrs.Address{
+		Hostname:  "registry.terraform.io",
+		Namespace: "hashicorp",
+		Type:      "null",
+	}
+
+	rs, err := svc.List(ctx, addr)
+	require.NoError(t, err)
+	require.Len(t, rs, 2)
+	assert.Equal(t, "terraform-provider-null_3.2.1_linux_amd64.zip", rs[0].Filename)
+	assert.Equal(t, "terraform-provider-null_3.2.2_linux_amd64.zip", rs[1].Filename)
+	assert.Equal(t, map[string]string{"Etag": `"abc"`}, rs[1].Headers)
+
+	r, err := svc.Get(ctx, addr, "terraform-provider-null_3.2.1_linux_amd64.zip")
+	require.NoError(t, err)
+	assert.Equal(t, SourcePublish, r.Source)
+
+	_, err = svc.Get(ctx, addr, "terraform-provider-null_9.9.9_linux_amd64.zip")
+	assert.Error(t, err)
+}
@@ -0,0 +1,305 @@
+package purge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/seal-io/walrus/utils/log"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"github.com/seal-io/hermitcrab/pkg/provider"
+	"github.com/seal-io/hermitcrab/pkg/provider/addrs"
+	"github.com/seal-io/hermitcrab/pkg/provider/storage"
+	"github.com/seal-io/hermitcrab/pkg/registry"
+)
+
+type (
+	// Options holds the filters of purging, the cached archives matching all given filters are purged.
+	Options struct {
+		// OlderThan only purges the archives not modified within the duration.
+		OlderThan time.Duration
+		// Provider only purges the archives of the providers matching the pattern,
+		// in form of [<HOSTNAME>/]<NAMESPACE>/<TYPE> with the shell globs, i.e. hashicorp/*.
+		Provider string
+		// Version only purges the archives of the versions satisfying the constraint, i.e. < 3.0.0,
+		// the versions rejected by the semantic versioning never satisfy.
+		Version string
+		// Platform only purges the archives of the platforms matching the pattern,
+		// in form of <OS>_<ARCH> with the shell globs, i.e. windows_*.
+		Platform string
+		// Metadata also deletes the metadata of the versions of the purged archives,
+		// which are synced from the upstream again on the next syncing,
+		// not allowed along with the Platform filter as the metadata of all platforms of the version is deleted,
+		// the versions failed to purge any archive or still having other cached archives are kept.
+		Metadata bool
+		// DryRun only reports the archives to purge without deleting.
+		DryRun bool
+	}
+
+	// Report holds the purged archives.
+	Report struct {
+		// Archives holds the purged archives, or the archives to purge if dry run.
+		Archives []Archive `json:"archives"`
+		// Versions holds the versioned providers whose metadata is deleted,
+		// or to delete if dry run.
+		Versions []string `json:"versions"`
+		// Size is the total size of the archives in bytes.
+		Size int64 `json:"size"`
+		// DryRun is true if nothing is deleted.
+		DryRun bool `json:"dryRun"`
+	}
+
+	// Archive holds the information of a purged archive.
+	Archive struct {
+		Hostname  string    `json:"hostname"`
+		Namespace string    `json:"namespace"`
+		Type      string    `json:"type"`
+		Filename  string    `json:"filename"`
+		Size      int64     `json:"size"`
+		Modified  time.Time `json:"modified"`
+		// Error is the error of purging.
+		Error string `json:"error,omitempty"`
+	}
+)
+
+// Validate returns error if the options are invalid,
+// at least one filter is required to not purge all archives by mistake.
+func (opts Options) Validate() error {
+	if opts.OlderThan < 0 {
+		return errors.New("invalid older than: must not be negative")
+	}
+
+	if _, err := opts.matcher(); err != nil {
+		return err
+	}
+
+	if opts.OlderThan == 0 && opts.Provider == "" && opts.Version == "" && opts.Platform == "" {
+		return errors.New("invalid filters: at least one filter is required")
+	}
+
+	if opts.Metadata && opts.Platform != "" {
+		return errors.New("invalid filters: metadata is not allowed with platform filter")
+	}
+
+	return nil
+}
+
+// matcher returns a function to check whether the given archive matches the filters.
+func (opts Options) matcher() (func(addr addrs.Address, fi os.FileInfo) bool, error) {
+	typed := strings.ToLower(strings.Trim(opts.Provider, "/"))
+	if typed != "" {
+		// Complete the hostname if omitted.
+		if strings.Count(typed, "/") == 1 {
+			typed = addrs.DefaultHostname + "/" + typed
+		}
+
+		if _, err := path.Match(typed, ""); err != nil || strings.Count(typed, "/") != 2 {
+			return nil, fmt.Errorf("invalid provider pattern %q", opts.Provider)
+		}
+	}
+
+	var constraint *semver.Constraints
+
+	if opts.Version != "" {
+		c, err := semver.NewConstraint(opts.Version)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version constraint %q: %w", opts.Version, err)
+		}
+
+		constraint = c
+	}
+
+	platform := strings.ToLower(opts.Platform)
+	if _, err := path.Match(platform, ""); err != nil {
+		return nil, fmt.Errorf("invalid platform pattern %q", opts.Platform)
+	}
+
+	before := time.Now().Add(-opts.OlderThan)
+
+	return func(addr addrs.Address, fi os.FileInfo) bool {
+		if opts.OlderThan > 0 && !fi.ModTime().Before(before) {
+			return false
+		}
+
+		if typed != "" {
+			if ok, _ := path.Match(typed, addr.TypedKey()); !ok {
+				return false
+			}
+		}
+
+		if constraint != nil {
+			v, err := semver.NewVersion(addr.Version)
+			if err != nil || !constraint.Check(v) {
+				return false
+			}
+		}
+
+		if platform != "" {
+			if ok, _ := path.Match(platform, addr.OS+"_"+addr.Arch); !ok {
+				return false
+			}
+		}
+
+		return true
+	}, nil
+}
+
+// Run purges the cached archives matching the given filters,
+// and deletes the metadata of their versions if required.
+func Run(ctx context.Context, s *provider.Service, opts Options) (Report, error) {
+	if err := opts.Validate(); err != nil {
+		return Report{}, err
+	}
+
+	match, _ := opts.matcher()
+
+	r := Report{
+		Archives: []Archive{},
+		Versions: []string{},
+		DryRun:   opts.DryRun,
+	}
+
+	// Index the versions of the purged archives by the typed provider,
+	// and the versions of the archives left after purging.
+	versions := map[addrs.Address]sets.Set[string]{}
+	kept := map[addrs.Address]sets.Set[string]{}
+
+	err := s.Storage.WalkArchives(ctx, func(a storage.StoredArchive) error {
+		addr := a.Address().Normalize()
+
+		v, goos, goarch, ok := registry.ParseArchiveFilename(addr.Type, a.Filename)
+		if !ok {
+			return nil
+		}
+
+		addr = addr.WithVersion(v).WithPlatform(goos, goarch)
+		if addr.Validate() != nil {
+			return nil
+		}
+
+		fi, err := os.Stat(a.Path)
+		if err != nil {
+			return nil
+		}
+
+		if !match(addr, fi) {
+			k := addr.Typed()
+			if kept[k] == nil {
+				kept[k] = sets.New[string]()
+			}
+
+			kept[k].Insert(addr.Version)
+
+			return nil
+		}
+
+		r.Archives = append(r.Archives, Archive{
+			Hostname:  a.Hostname,
+			Namespace: a.Namespace,
+			Type:      a.Type,
+			Filename:  a.Filename,
+			Size:      fi.Size(),
+			Modified:  fi.ModTime(),
+		})
+		r.Size += fi.Size()
+
+		k := addr.Typed()
+		if versions[k] == nil {
+			versions[k] = sets.New[string]()
+		}
+
+		versions[k].Insert(addr.Version)
+
+		return nil
+	})
+	if err != nil {
+		return Report{}, fmt.Errorf("error walking archives: %w", err)
+	}
+
+	// Keep the metadata of the versions still having cached archives,
+	// i.e. the archives of the version modified within the older than duration.
+	for k, vs := range kept {
+		if versions[k] != nil {
+			versions[k] = versions[k].Difference(vs)
+		}
+	}
+
+	if opts.Metadata {
+		r.Versions = listVersions(versions)
+	}
+
+	if opts.DryRun {
+		return r, nil
+	}
+
+	logger := log.WithName("provider").WithName("purge")
+
+	for i := range r.Archives {
+		a := &r.Archives[i]
+
+		err = s.Storage.DeleteArchives(ctx, storage.DeleteArchivesOptions{
+			Address: addrs.Address{
+				Hostname:  a.Hostname,
+				Namespace: a.Namespace,
+				Type:      a.Type,
+			},
+			Filename: a.Filename,
+			Reason:   storage.EvictionReasonPurge,
+		})
+		if err != nil {
+			a.Error = err.Error()
+			logger.Warnf("error purging archive %s: %v", a.Filename, err)
+
+			// Keep the metadata of the version still cached.
+			addr := addrs.Address{
+				Hostname:  a.Hostname,
+				Namespace: a.Namespace,
+				Type:      a.Type,
+			}.Normalize()
+			if v, _, _, ok := registry.ParseArchiveFilename(addr.Type, a.Filename); ok {
+				versions[addr].Delete(v)
+			}
+		}
+	}
+
+	if !opts.Metadata {
+		return r, nil
+	}
+
+	r.Versions = listVersions(versions)
+
+	for addr, vs := range versions {
+		if vs.Len() == 0 {
+			continue
+		}
+
+		_, err = s.Metadata.DeleteVersions(ctx, addr, sets.List(vs))
+		if err != nil {
+			return r, fmt.Errorf("error deleting metadata of %s: %w", addr, err)
+		}
+	}
+
+	return r, nil
+}
+
+// listVersions returns the sorted versioned providers of the given versions indexed by the typed provider.
+func listVersions(versions map[addrs.Address]sets.Set[string]) []string {
+	r := []string{}
+
+	for addr, vs := range versions {
+		for v := range vs {
+			r = append(r, addr.WithVersion(v).String())
+		}
+	}
+
+	sort.Strings(r)
+
+	return r
+}
@@ -0,0 +1,160 @@
+package purge
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/seal-io/hermitcrab/pkg/provider"
+	"github.com/seal-io/hermitcrab/pkg/provider/addrs"
+	"github.com/seal-io/hermitcrab/pkg/provider/metadata"
+	"github.com/seal-io/hermitcrab/pkg/provider/storage"
+)
+
+// fakeMetadata records the deleted versions only.
+type fakeMetadata struct {
+	metadata.Service
+
+	deleted map[string][]string
+}
+
+func (f fakeMetadata) DeleteVersions(_ context.Context, addr addrs.Address, vs []string) ([]string, error) {
+	f.deleted[addr.String()] = append(f.deleted[addr.String()], vs...)
+	return vs, nil
+}
+
+// fakeStorage fails to delete the archives of the given filenames.
+type fakeStorage struct {
+	storage.Service
+
+	failed map[string]bool
+}
+
+func (f fakeStorage) DeleteArchives(ctx context.Context, opts storage.DeleteArchivesOptions) error {
+	if f.failed[opts.Filename] {
+		return errors.New("permission denied")
+	}
+
+	return f.Service.DeleteArchives(ctx, opts)
+}
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+
+	ss, err := storage.NewService(dir, storage.ServiceOptions{})
+	require.NoError(t, err)
+
+	fm := fakeMetadata{deleted: map[string][]string{}}
+	s := &provider.Service{
+		Metadata: fm,
+		Storage:  ss,
+	}
+
+	addr := addrs.Address{
+		Hostname:  "registry.terraform.io",
+		Namespace: "hashicorp",
+		Type:      "null",
+	}
+
+	typedDir := addr.Dir(filepath.Join(dir, "providers"))
+	require.NoError(t, os.MkdirAll(typedDir, 0o700))
+
+	old := time.Now().Add(-48 * time.Hour)
+
+	for fn, modified := range map[string]time.Time{
+		"terraform-provider-null_1.0.0_linux_amd64.zip":   old,
+		"terraform-provider-null_1.0.0_windows_amd64.zip": old,
+		"terraform-provider-null_2.0.0_linux_amd64.zip":   old,
+		"terraform-provider-null_1.1.0_linux_amd64.zip":   time.Now(),
+		"terraform-provider-null_1.1.0_darwin_arm64.zip":  old,
+	} {
+		p := filepath.Join(typedDir, fn)
+		require.NoError(t, os.WriteFile(p, []byte("archive"), 0o600))
+		require.NoError(t, os.Chtimes(p, modified, modified))
+	}
+
+	_, err = Run(context.Background(), s, Options{})
+	assert.Error(t, err, "purging without filters must be refused")
+
+	opts := Options{
+		OlderThan: 24 * time.Hour,
+		Provider:  "hashicorp/*",
+		Version:   "< 2.0.0",
+		Metadata:  true,
+		DryRun:    true,
+	}
+
+	r, err := Run(context.Background(), s, opts)
+	require.NoError(t, err)
+
+	var filenames []string
+	for _, a := range r.Archives {
+		filenames = append(filenames, a.Filename)
+	}
+
+	assert.ElementsMatch(t, []string{
+		"terraform-provider-null_1.0.0_linux_amd64.zip",
+		"terraform-provider-null_1.0.0_windows_amd64.zip",
+		"terraform-provider-null_1.1.0_darwin_arm64.zip",
+	}, filenames)
+	assert.Equal(t, int64(21), r.Size)
+	// Keep the metadata of the version still having the recent archive.
+	assert.Equal(t, []string{"registry.terraform.io/hashicorp/null/1.0.0"}, r.Versions)
+	assert.FileExists(t, filepath.Join(typedDir, "terraform-provider-null_1.0.0_linux_amd64.zip"),
+		"the dry run must not delete")
+	assert.Empty(t, fm.deleted)
+
+	opts.DryRun = false
+	opts.Platform = "windows_*"
+
+	_, err = Run(context.Background(), s, opts)
+	assert.Error(t, err, "deleting metadata of the partial platforms must be refused")
+
+	opts.Metadata = false
+
+	r, err = Run(context.Background(), s, opts)
+	require.NoError(t, err)
+	require.Len(t, r.Archives, 1)
+	assert.Empty(t, r.Archives[0].Error)
+	assert.Empty(t, r.Versions)
+	assert.NoFileExists(t, filepath.Join(typedDir, "terraform-provider-null_1.0.0_windows_amd64.zip"))
+	assert.FileExists(t, filepath.Join(typedDir, "terraform-provider-null_1.0.0_linux_amd64.zip"))
+	assert.Empty(t, fm.deleted)
+
+	// Keep the metadata of the version failed to purge.
+	s.Storage = fakeStorage{
+		Service: ss,
+		failed:  map[string]bool{"terraform-provider-null_1.0.0_linux_amd64.zip": true},
+	}
+
+	opts = Options{
+		Version:  ">= 1.0.0",
+		Metadata: true,
+	}
+
+	r, err = Run(context.Background(), s, opts)
+	require.NoError(t, err)
+	require.Len(t, r.Archives, 4)
+
+	for _, a := range r.Archives {
+		if a.Filename == "terraform-provider-null_1.0.0_linux_amd64.zip" {
+			assert.NotEmpty(t, a.Error)
+		} else {
+			assert.Empty(t, a.Error, a.Filename)
+		}
+	}
+
+	assert.Equal(t, []string{
+		"registry.terraform.io/hashicorp/null/1.1.0",
+		"registry.terraform.io/hashicorp/null/2.0.0",
+	}, r.Versions)
+	assert.FileExists(t, filepath.Join(typedDir, "terraform-provider-null_1.0.0_linux_amd64.zip"))
+	assert.ElementsMatch(t, []string{"1.1.0", "2.0.0"}, fm.deleted["registry.terraform.io/hashicorp/null"])
+	assert.Len(t, fm.deleted, 1)
+}
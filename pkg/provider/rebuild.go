@@ -0,0 +1,119 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/seal-io/walrus/utils/log"
+
+	"github.com/seal-io/hermitcrab/pkg/download"
+	"github.com/seal-io/hermitcrab/pkg/provider/metadata"
+	"github.com/seal-io/hermitcrab/pkg/provider/storage"
+	"github.com/seal-io/hermitcrab/pkg/registry"
+)
+
+// RebuildResult holds the result of rebuilding the metadata from the cached archives.
+type RebuildResult struct {
+	// Archives is the number of the cached archives walked.
+	Archives int `json:"archives"`
+	// Synced is the number of the archives whose platforms are synced from the upstream.
+	Synced int `json:"synced"`
+	// Published is the number of the archives whose platforms are derived from the archives themselves.
+	Published int `json:"published"`
+	// Skipped is the number of the archives not recognized.
+	Skipped int `json:"skipped"`
+}
+
+// RebuildMetadata rebuilds the metadata of the cached archives, i.e. after the metadata database is lost,
+// so that the cached archives are served without downloading from scratch.
+// The platform of an archive is synced from the upstream if online,
+// otherwise, or if the upstream no longer lists it,
+// the platform is derived from the filename and the sha256 checksum of the archive.
+func (s *Service) RebuildMetadata(ctx context.Context) (RebuildResult, error) {
+	logger := log.WithName("provider").WithName("rebuild")
+
+	var r RebuildResult
+
+	// Remember whether the versions of the typed providers are synced,
+	// so that the unreachable upstream is only tried once per provider.
+	synced := map[string]bool{}
+
+	err := s.Storage.WalkArchives(ctx, func(a storage.StoredArchive) error {
+		r.Archives++
+
+		addr := a.Address().Normalize()
+
+		v, goos, goarch, ok := registry.ParseArchiveFilename(addr.Type, a.Filename)
+		if ok {
+			addr = addr.WithVersion(v).WithPlatform(goos, goarch)
+		}
+
+		if !ok || addr.Validate() != nil {
+			logger.Warnf("skip unrecognized archive %s", a.Path)
+
+			r.Skipped++
+
+			return nil
+		}
+
+		k := addr.TypedKey()
+		if _, ok := synced[k]; !ok && !s.Offline {
+			_, err := s.Metadata.GetVersions(ctx, metadata.GetVersionsOptions{
+				Hostname:  addr.Hostname,
+				Namespace: addr.Namespace,
+				Type:      addr.Type,
+			})
+			if err != nil {
+				logger.WithValues(addr.Typed().LogValues()...).
+					Warnf("deriving platforms from archives as error syncing versions: %v", err)
+			}
+
+			synced[k] = err == nil
+		}
+
+		if synced[k] {
+			p, err := s.Metadata.GetPlatform(ctx, metadata.GetPlatformOptions(addr))
+			if err == nil && p.Filename == a.Filename {
+				r.Synced++
+				return nil
+			}
+
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			logger.WithValues(addr.LogValues()...).
+				Debugf("deriving platform from archive as not synced: %v", err)
+		}
+
+		shasum, err := download.Shasum(a.Path)
+		if err != nil {
+			return fmt.Errorf("error calculating shasum of %s: %w", a.Path, err)
+		}
+
+		err = s.Metadata.Publish(ctx, metadata.PublishOptions{
+			Hostname:  addr.Hostname,
+			Namespace: addr.Namespace,
+			Type:      addr.Type,
+			Version:   addr.Version,
+			Platform: metadata.Platform{
+				OS:       addr.OS,
+				Arch:     addr.Arch,
+				Filename: a.Filename,
+				Shasum:   shasum,
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("error publishing platform of %s: %w", a.Path, err)
+		}
+
+		r.Published++
+
+		return nil
+	})
+	if err != nil {
+		return r, fmt.Errorf("error walking archives: %w", err)
+	}
+
+	return r, nil
+}
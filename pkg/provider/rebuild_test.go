@@ -0,0 +1,57 @@
+package provider
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/seal-io/hermitcrab/pkg/provider/metadata"
+)
+
+func TestService_RebuildMetadata(t *testing.T) {
+	dir := t.TempDir()
+
+	typedDir := filepath.Join(dir, "providers", "registry.terraform.io", "hashicorp", "null")
+	require.NoError(t, os.MkdirAll(typedDir, 0o755))
+
+	archive := []byte("archive")
+	require.NoError(t, os.WriteFile(
+		filepath.Join(typedDir, "terraform-provider-null_1.0.0_linux_amd64.zip"), archive, 0o600))
+	require.NoError(t, os.WriteFile(
+		filepath.Join(typedDir, "terraform-provider-random_1.0.0_linux_amd64.zip"), archive, 0o600))
+
+	db, err := bolt.Open(filepath.Join(dir, "metadata.db"), 0o600, nil)
+	require.NoError(t, err)
+
+	t.Cleanup(func() { _ = db.Close() })
+
+	s, err := NewService(db, dir, Options{Offline: true})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+
+	r, err := s.RebuildMetadata(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, RebuildResult{Archives: 2, Published: 1, Skipped: 1}, r)
+
+	p, err := s.Metadata.GetPlatform(ctx, metadata.GetPlatformOptions{
+		Hostname:  "registry.terraform.io",
+		Namespace: "hashicorp",
+		Type:      "null",
+		Version:   "1.0.0",
+		OS:        "linux",
+		Arch:      "amd64",
+	})
+	require.NoError(t, err)
+
+	sum := sha256.Sum256(archive)
+	assert.Equal(t, hex.EncodeToString(sum[:]), p.Shasum)
+	assert.Equal(t, "terraform-provider-null_1.0.0_linux_amd64.zip", p.Filename)
+}
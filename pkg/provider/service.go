@@ -1,31 +1,305 @@
 package provider
 
 import (
+	"context"
 	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/seal-io/walrus/utils/log"
+	"k8s.io/apimachinery/pkg/util/sets"
 
 	"github.com/seal-io/hermitcrab/pkg/database"
+	"github.com/seal-io/hermitcrab/pkg/policy"
+	"github.com/seal-io/hermitcrab/pkg/provider/addrs"
+	"github.com/seal-io/hermitcrab/pkg/provider/docs"
 	"github.com/seal-io/hermitcrab/pkg/provider/metadata"
+	"github.com/seal-io/hermitcrab/pkg/provider/provenance"
 	"github.com/seal-io/hermitcrab/pkg/provider/storage"
+	"github.com/seal-io/hermitcrab/pkg/registry"
 )
 
 type Service struct {
-	Metadata metadata.Service
-	Storage  storage.Service
+	Metadata   metadata.Service
+	Storage    storage.Service
+	Docs       docs.Service
+	Provenance provenance.Service
+
+	// Offline indicates the service only serves the cached providers.
+	Offline bool
+	// InferPlatforms indicates the service observes the platforms requested by the clients.
+	InferPlatforms bool
+	// CanaryToken is the token presented by the clients to see the canary versions.
+	CanaryToken string
+	// ServablePlatformsOnly indicates the service only lists the platforms served by the policy.
+	ServablePlatformsOnly bool
+	// ArtifactURLs indicates the service lists the archives by the content addressed URLs.
+	ArtifactURLs bool
+	// PrefetchNewReleases indicates the service prefetches the archives of the new releases
+	// for the platforms the clients downloaded previously.
+	PrefetchNewReleases bool
+
+	observer platformObserver
+	trusted  sync.Map
 }
 
-func NewService(boltDriver database.BoltDriver, dataSourceDir string) (*Service, error) {
-	ms, err := metadata.NewService(boltDriver)
+// Options holds the options of the provider service.
+type Options struct {
+	// MaxVersionsPerProvider is the maximum number of versions retained per provider,
+	// unlimited if not positive.
+	MaxVersionsPerProvider int
+	// EvictionWebhook is the URL to notify when the archives are evicted.
+	EvictionWebhook string
+	// VerifyOnServe verifies the checksum of the cached archive before serving.
+	VerifyOnServe bool
+	// ChecksumH1 responds the h1 hash of the archive via the X-Checksum-H1 header.
+	ChecksumH1 bool
+	// MaxConcurrentDownloads is the maximum number of concurrent downloads,
+	// unlimited if not positive.
+	MaxConcurrentDownloads int
+	// StartupScan is the mode of scanning the cached archives on start,
+	// select from full, fast and off.
+	StartupScan string
+	// CacheFileMode and CacheDirMode are the permission modes of the cached archives and their directories.
+	CacheFileMode os.FileMode
+	CacheDirMode  os.FileMode
+	// CacheOwner changes the owner of the cached archives and their directories if specified.
+	CacheOwner *storage.Owner
+	// Offline never reaches the upstream,
+	// only the versions and platforms with cached archives are served.
+	Offline bool
+	// InferPlatforms observes the platforms of the archives requested by the clients,
+	// which take precedence over the default popular platforms to prefetch.
+	InferPlatforms bool
+	// MetadataPlatformLayout is the layout of storing the platforms of a version in the metadata.
+	MetadataPlatformLayout string
+	// DocsCacheTTL is the duration of caching the provider documentation before re-fetching.
+	DocsCacheTTL time.Duration
+	// EagerPlatformSync holds the patterns of the providers whose platforms are synced eagerly
+	// after syncing the versions, i.e. hashicorp/aws.
+	EagerPlatformSync []string
+	// Protocols holds the major versions of the plugin protocols used by the clients, i.e. 5 and 6,
+	// the versions only supporting the other protocols are not synced.
+	Protocols []string
+	// HideRemovedVersions hides the versions removed from the upstream,
+	// otherwise, the cached platforms and archives of them are still served.
+	HideRemovedVersions bool
+	// UpstreamBudget is the maximum duration of the upstream calls of a client request,
+	// the request responds 503 with the Retry-After if exceeded, while the syncing continues in background,
+	// unlimited if not positive.
+	UpstreamBudget time.Duration
+	// VersionsSoftTTL is the age of the stored versions of a provider,
+	// beyond which reading them triggers refreshing in background,
+	// disabled if not positive.
+	VersionsSoftTTL time.Duration
+	// ShadowSampleRate is the ratio of the metadata requests served from the cache,
+	// which are compared against the upstream in background, disabled if not positive.
+	ShadowSampleRate float64
+	// ProbeUnlistedPlatforms fetches the platform not listed in the version from the upstream,
+	// otherwise, responds 404 with the published platforms of the version.
+	ProbeUnlistedPlatforms bool
+	// ImpliedDirError is the behavior of looking up the archive in the unreadable implied directory,
+	// select from warn and fail.
+	ImpliedDirError string
+	// CanaryToken is the token presented by the clients to see the canary versions,
+	// the canary versions are hidden from all clients if blank.
+	CanaryToken string
+	// Peers are the base URLs of the other instances to look up the archive before the upstream.
+	Peers []string
+	// ServablePlatformsOnly only lists the platforms served by the policy in the metadata,
+	// so that the clients never try to download the refused archives,
+	// all platforms are listed by default to keep the hashes of the lock files complete.
+	ServablePlatformsOnly bool
+	// ScratchDir holds the in-progress downloads if specified,
+	// the completed archives are moved into the data source directory atomically.
+	ScratchDir string
+	// ArtifactURLs lists the archives with the known checksums by the content addressed URLs,
+	// i.e. /v1/artifacts/sha256/{digest}, in the version metadata.
+	ArtifactURLs bool
+	// PrefetchNewReleases prefetches the archives of the new release discovered by syncing in background,
+	// for the platforms the clients downloaded the provider previously.
+	PrefetchNewReleases bool
+}
+
+func NewService(boltDriver database.BoltDriver, dataSourceDir string, opts Options) (*Service, error) {
+	// The service is referred by the callbacks of the storage and metadata services.
+	var svc *Service
+
+	ps, err := provenance.NewService(boltDriver)
 	if err != nil {
-		return nil, fmt.Errorf("error creating metadata service: %w", err)
+		return nil, fmt.Errorf("error creating provenance service: %w", err)
 	}
 
-	ss, err := storage.NewService(dataSourceDir)
+	ss, err := storage.NewService(dataSourceDir, storage.ServiceOptions{
+		EvictionWebhook:        opts.EvictionWebhook,
+		VerifyOnServe:          opts.VerifyOnServe,
+		ChecksumH1:             opts.ChecksumH1,
+		MaxConcurrentDownloads: opts.MaxConcurrentDownloads,
+		StartupScan:            opts.StartupScan,
+		FileMode:               opts.CacheFileMode,
+		DirMode:                opts.CacheDirMode,
+		Owner:                  opts.CacheOwner,
+		Offline:                opts.Offline,
+		ImpliedDirError:        opts.ImpliedDirError,
+		Provenance:             ps,
+		Peers:                  opts.Peers,
+		ScratchDir:             opts.ScratchDir,
+		Verify: func(ctx context.Context, lopts storage.LoadArchiveOptions) error {
+			return svc.verifyArchive(ctx, lopts)
+		},
+	})
 	if err != nil {
 		return nil, fmt.Errorf("error creating storage service: %w", err)
 	}
 
-	return &Service{
-		Metadata: ms,
-		Storage:  ss,
-	}, nil
+	ms, err := metadata.NewService(boltDriver, metadata.ServiceOptions{
+		MaxVersions:       opts.MaxVersionsPerProvider,
+		Offline:           opts.Offline,
+		PlatformLayout:    opts.MetadataPlatformLayout,
+		EagerPlatformSync: opts.EagerPlatformSync,
+		Protocols:         opts.Protocols,
+		HideRemoved:       opts.HideRemovedVersions,
+		UpstreamBudget:    opts.UpstreamBudget,
+		SoftTTL:           opts.VersionsSoftTTL,
+		ShadowSampleRate:  opts.ShadowSampleRate,
+		ProbeUnlisted:     opts.ProbeUnlistedPlatforms,
+		Pruned: func(ctx context.Context, addr addrs.Address, vs []string) {
+			for _, v := range vs {
+				err := ss.DeleteArchives(ctx, storage.DeleteArchivesOptions{
+					Address: addr.WithVersion(v),
+				})
+				if err != nil {
+					log.WithName("provider").
+						Warnf("error deleting archives of %s: %v", addr.WithVersion(v), err)
+				}
+			}
+		},
+		Added: func(_ context.Context, addr addrs.Address, vs []string) {
+			svc.prefetchNewRelease(addr, vs)
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error creating metadata service: %w", err)
+	}
+
+	ds, err := docs.NewService(boltDriver, docs.ServiceOptions{
+		TTL:     opts.DocsCacheTTL,
+		Offline: opts.Offline,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error creating docs service: %w", err)
+	}
+
+	svc = &Service{
+		Metadata:       ms,
+		Storage:        ss,
+		Docs:           ds,
+		Provenance:     ps,
+		Offline:        opts.Offline,
+		InferPlatforms: opts.InferPlatforms,
+		CanaryToken:    opts.CanaryToken,
+
+		ServablePlatformsOnly: opts.ServablePlatformsOnly,
+		ArtifactURLs:          opts.ArtifactURLs,
+		PrefetchNewReleases:   opts.PrefetchNewReleases,
+	}
+
+	return svc, nil
+}
+
+// Resolve returns the address of the given provider to serve,
+// which is the address under the first stored equivalent namespace if the given one is not stored,
+// otherwise, returns the given address.
+func (s *Service) Resolve(ctx context.Context, addr addrs.Address) addrs.Address {
+	es := policy.Get().EquivalentsOf(addr)
+	if len(es) == 0 || s.Metadata.HasProvider(ctx, addr) {
+		return addr
+	}
+
+	for _, e := range es {
+		if s.Metadata.HasProvider(ctx, e) {
+			return e
+		}
+	}
+
+	return addr
+}
+
+// Availability decides the platforms to serve of the versions of a typed provider,
+// which lists the cached archives of the provider once in offline mode,
+// instead of checking the archives of every version one by one.
+type Availability struct {
+	s      *Service
+	addr   addrs.Address
+	cached sets.Set[string]
+}
+
+// Availability returns the Availability of the given typed provider,
+// which is expected to be used within a request.
+func (s *Service) Availability(ctx context.Context, addr addrs.Address) Availability {
+	a := Availability{
+		s:    s,
+		addr: addr.Typed(),
+	}
+
+	if s.Offline {
+		a.cached = sets.New(s.Storage.ListArchives(ctx, a.addr)...)
+	}
+
+	return a
+}
+
+// Available returns the platforms of the given version to serve,
+// which are the ones with cached archives in offline mode,
+// and the ones served by the policy if ServablePlatformsOnly,
+// otherwise, returns the given platforms.
+func (a Availability) Available(ctx context.Context, v metadata.Version) []metadata.Platform {
+	if !a.s.Offline && !a.s.ServablePlatformsOnly {
+		return v.Platforms
+	}
+
+	pl := policy.Get()
+	ps := make([]metadata.Platform, 0, len(v.Platforms))
+
+	for _, p := range v.Platforms {
+		if a.s.ServablePlatformsOnly && !pl.ServesPlatform(p.OS, p.Arch) {
+			continue
+		}
+
+		if !a.s.Offline {
+			ps = append(ps, p)
+			continue
+		}
+
+		pa := a.addr.WithVersion(v.Version).WithPlatform(p.OS, p.Arch)
+
+		filename := p.Filename
+		if filename == "" {
+			filename = pa.ArchiveFilename()
+		}
+
+		if a.cached.Has(filename) {
+			ps = append(ps, p)
+			continue
+		}
+
+		// The archives of the filesystem upstreams are served from their directories.
+		if _, ok := registry.LocalArchivePath(p.DownloadURL); !ok {
+			continue
+		}
+
+		cached := a.s.Storage.HasArchive(ctx, storage.LoadArchiveOptions{
+			Hostname:    pa.Hostname,
+			Namespace:   pa.Namespace,
+			Type:        pa.Type,
+			Filename:    filename,
+			DownloadURL: p.DownloadURL,
+		})
+		if cached {
+			ps = append(ps, p)
+		}
+	}
+
+	return ps
 }
@@ -0,0 +1,121 @@
+package provider
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/seal-io/hermitcrab/pkg/provider/addrs"
+	"github.com/seal-io/hermitcrab/pkg/provider/metadata"
+	"github.com/seal-io/hermitcrab/pkg/provider/storage"
+)
+
+// countingStorage counts the lookups of the cached archives.
+type countingStorage struct {
+	storage.Service
+
+	lists, hits int
+}
+
+func (c *countingStorage) ListArchives(ctx context.Context, addr addrs.Address) []string {
+	c.lists++
+	return c.Service.ListArchives(ctx, addr)
+}
+
+func (c *countingStorage) HasArchive(ctx context.Context, opts storage.LoadArchiveOptions) bool {
+	c.hits++
+	return c.Service.HasArchive(ctx, opts)
+}
+
+func TestAvailability_Available(t *testing.T) {
+	dir := t.TempDir()
+
+	addr := addrs.Address{
+		Hostname:  "registry.terraform.io",
+		Namespace: "hashicorp",
+		Type:      "null",
+	}
+
+	typedDir := addr.Dir(filepath.Join(dir, "providers"))
+	require.NoError(t, os.MkdirAll(typedDir, 0o700))
+	require.NoError(t, os.WriteFile(
+		filepath.Join(typedDir, "terraform-provider-null_1.0.0_linux_amd64.zip"), []byte("archive"), 0o600))
+	require.NoError(t, os.WriteFile(
+		filepath.Join(typedDir, ".terraform-provider-null_2.0.0_linux_amd64.zip.123"), []byte("partial"), 0o600))
+
+	ss, err := storage.NewService(dir, storage.ServiceOptions{})
+	require.NoError(t, err)
+
+	platforms := func(v string) []metadata.Platform {
+		return []metadata.Platform{
+			{OS: "linux", Arch: "amd64", Filename: "terraform-provider-null_" + v + "_linux_amd64.zip"},
+			{OS: "darwin", Arch: "arm64"},
+		}
+	}
+
+	testCases := []struct {
+		name     string
+		offline  bool
+		given    metadata.Version
+		expected []string
+	}{
+		{
+			name:     "online",
+			offline:  false,
+			given:    metadata.Version{Version: "2.0.0", Platforms: platforms("2.0.0")},
+			expected: []string{"linux/amd64", "darwin/arm64"},
+		},
+		{
+			name:     "offline cached",
+			offline:  true,
+			given:    metadata.Version{Version: "1.0.0", Platforms: platforms("1.0.0")},
+			expected: []string{"linux/amd64"},
+		},
+		{
+			name:     "offline uncached",
+			offline:  true,
+			given:    metadata.Version{Version: "2.0.0", Platforms: platforms("2.0.0")},
+			expected: []string{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &Service{
+				Storage: ss,
+				Offline: tc.offline,
+			}
+
+			ctx := context.Background()
+
+			actual := []string{}
+			for _, p := range s.Availability(ctx, addr).Available(ctx, tc.given) {
+				actual = append(actual, p.OS+"/"+p.Arch)
+			}
+
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+
+	t.Run("once per provider", func(t *testing.T) {
+		cs := &countingStorage{Service: ss}
+		s := &Service{
+			Storage: cs,
+			Offline: true,
+		}
+
+		ctx := context.Background()
+		av := s.Availability(ctx, addr)
+
+		for _, v := range []string{"1.0.0", "2.0.0", "3.0.0"} {
+			av.Available(ctx, metadata.Version{Version: v, Platforms: platforms(v)})
+		}
+
+		assert.Equal(t, 1, cs.lists, "should list the cached archives once")
+		assert.Zero(t, cs.hits, "should not check the archives one by one")
+	})
+}
@@ -0,0 +1,45 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"golang.org/x/mod/sumdb/dirhash"
+
+	"github.com/seal-io/hermitcrab/pkg/timing"
+)
+
+// hashedArchive is the stamp of a hashed archive,
+// the archive is not hashed again until the stamp changes.
+type hashedArchive struct {
+	size     int64
+	modified time.Time
+	h1       string
+}
+
+// h1Of returns the h1 hash of the given zip archive,
+// which is the same as the one recorded in the dependency lock file of Terraform,
+// returns blank if failed.
+func (s *service) h1Of(ctx context.Context, p string, fi os.FileInfo) string {
+	if v, ok := s.hashed.Load(p); ok {
+		if ha := v.(hashedArchive); ha.size == fi.Size() && ha.modified.Equal(fi.ModTime()) {
+			return ha.h1
+		}
+	}
+
+	defer timing.Track(ctx, timing.PhaseDisk)()
+
+	h1, err := dirhash.HashZip(p, dirhash.Hash1)
+	if err != nil {
+		return ""
+	}
+
+	s.hashed.Store(p, hashedArchive{
+		size:     fi.Size(),
+		modified: fi.ModTime(),
+		h1:       h1,
+	})
+
+	return h1
+}
@@ -0,0 +1,86 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/seal-io/walrus/utils/gopool"
+	"github.com/seal-io/walrus/utils/log"
+	"github.com/seal-io/walrus/utils/req"
+	"github.com/seal-io/walrus/utils/version"
+
+	"github.com/seal-io/hermitcrab/pkg/events"
+)
+
+const (
+	// EvictionReasonQuota indicates the archives are evicted to fit in the namespace quota.
+	EvictionReasonQuota = "quota"
+	// EvictionReasonPrune indicates the archives are removed along with the pruned versions.
+	EvictionReasonPrune = "prune"
+	// EvictionReasonDrift indicates the archives are removed by repairing the drift from the metadata.
+	EvictionReasonDrift = "drift"
+	// EvictionReasonPurge indicates the archives are purged by the administrator.
+	EvictionReasonPurge = "purge"
+)
+
+type (
+	// EvictedArchive holds the information of an evicted archive.
+	EvictedArchive struct {
+		Hostname  string `json:"hostname"`
+		Namespace string `json:"namespace"`
+		Type      string `json:"type"`
+		Filename  string `json:"filename"`
+	}
+
+	// EvictionEvent is the payload posting to the eviction webhook.
+	EvictionEvent struct {
+		Reason    string           `json:"reason"`
+		Archives  []EvictedArchive `json:"archives"`
+		Timestamp time.Time        `json:"timestamp"`
+	}
+)
+
+var webhookCli = req.HTTP().
+	WithUserAgent(version.GetUserAgentWith("hermitcrab"))
+
+// webhookRetryWait bounds the waiting between the retries of posting to the eviction webhook.
+var webhookRetryWait = [2]time.Duration{time.Second, 5 * time.Second}
+
+// webhookRetries is the maximum retries of posting to the eviction webhook after the first attempt.
+const webhookRetries = 3
+
+// notifyEvicted publishes the evicted archives as an event,
+// and posts them to the eviction webhook asynchronously if configured.
+func (s *service) notifyEvicted(reason string, as []EvictedArchive) {
+	if len(as) == 0 {
+		return
+	}
+
+	ev := EvictionEvent{
+		Reason:    reason,
+		Archives:  as,
+		Timestamp: time.Now(),
+	}
+
+	events.Publish(events.TypeArchivesEvicted, ev)
+
+	if s.evictionWebhook == "" {
+		return
+	}
+
+	gopool.Go(func() {
+		logger := log.WithName("provider").WithName("storage")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		err := webhookCli.Request().
+			WithBodyJSON(ev).
+			WithRetryBackoff(webhookRetryWait[0], webhookRetryWait[1], webhookRetries).
+			PostWithContext(ctx, s.evictionWebhook).
+			Error()
+		if err != nil {
+			logger.Warnf("error notifying eviction webhook: %v", err)
+		}
+	})
+}
@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/seal-io/walrus/utils/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_notifyEvicted(t *testing.T) {
+	wait := webhookRetryWait
+	webhookRetryWait = [2]time.Duration{10 * time.Millisecond, 20 * time.Millisecond}
+
+	t.Cleanup(func() { webhookRetryWait = wait })
+
+	as := []EvictedArchive{
+		{
+			Hostname:  "registry.terraform.io",
+			Namespace: "hashicorp",
+			Type:      "null",
+			Filename:  "terraform-provider-null_1.0.0_linux_amd64.zip",
+		},
+	}
+
+	// newWebhook returns a webhook failing the given times before succeeding,
+	// which sends the received payloads to the returned channel.
+	newWebhook := func(failures int32) (*httptest.Server, *atomic.Int32, <-chan []byte) {
+		var received atomic.Int32
+
+		payloads := make(chan []byte, 10)
+
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			bs, _ := io.ReadAll(r.Body)
+			assert.Equal(t, http.MethodPost, r.Method)
+			assert.Contains(t, r.Header.Get("Content-Type"), "application/json")
+
+			if received.Add(1) <= failures {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+
+			payloads <- bs
+		}))
+		t.Cleanup(srv.Close)
+
+		return srv, &received, payloads
+	}
+
+	t.Run("payload", func(t *testing.T) {
+		srv, received, payloads := newWebhook(0)
+		s := &service{evictionWebhook: srv.URL}
+
+		s.notifyEvicted(EvictionReasonQuota, as)
+
+		select {
+		case bs := <-payloads:
+			var ev EvictionEvent
+			require.NoError(t, json.Unmarshal(bs, &ev))
+			assert.Equal(t, EvictionReasonQuota, ev.Reason)
+			assert.Equal(t, as, ev.Archives)
+			assert.WithinDuration(t, time.Now(), ev.Timestamp, time.Minute)
+		case <-time.After(5 * time.Second):
+			t.Fatal("webhook is not notified")
+		}
+
+		assert.Equal(t, int32(1), received.Load())
+	})
+
+	t.Run("retry", func(t *testing.T) {
+		srv, received, payloads := newWebhook(webhookRetries)
+		s := &service{evictionWebhook: srv.URL}
+
+		s.notifyEvicted(EvictionReasonPurge, as)
+
+		select {
+		case bs := <-payloads:
+			assert.Equal(t, EvictionReasonPurge, json.Get(bs, "reason").String())
+		case <-time.After(5 * time.Second):
+			t.Fatal("webhook is not retried")
+		}
+
+		assert.Equal(t, int32(webhookRetries+1), received.Load())
+	})
+
+	t.Run("give up", func(t *testing.T) {
+		srv, received, payloads := newWebhook(100)
+		s := &service{evictionWebhook: srv.URL}
+
+		s.notifyEvicted(EvictionReasonPrune, as)
+
+		assert.Eventually(t, func() bool { return received.Load() >= webhookRetries+1 },
+			5*time.Second, 10*time.Millisecond)
+
+		// No more attempts after giving up.
+		time.Sleep(100 * time.Millisecond)
+		assert.Equal(t, int32(webhookRetries+1), received.Load())
+		assert.Empty(t, payloads)
+	})
+
+	t.Run("nothing evicted", func(t *testing.T) {
+		srv, received, _ := newWebhook(0)
+		s := &service{evictionWebhook: srv.URL}
+
+		s.notifyEvicted(EvictionReasonPrune, nil)
+
+		time.Sleep(100 * time.Millisecond)
+		assert.Equal(t, int32(0), received.Load())
+	})
+}
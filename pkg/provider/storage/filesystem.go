@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// filesystemStats holds the usage of the filesystem of a directory.
+type filesystemStats struct {
+	// Capacity, Used and Free are in bytes,
+	// the Free is available to the unprivileged user.
+	Capacity, Used, Free uint64
+	Inodes, InodesFree   uint64
+}
+
+// filesystemCollector collects the usage of the filesystems of the watched directories,
+// so that the dashboards catch the nearly full disk before the downloads fail.
+type filesystemCollector struct {
+	dirs sync.Map
+
+	capacity   *prometheus.Desc
+	used       *prometheus.Desc
+	free       *prometheus.Desc
+	inodes     *prometheus.Desc
+	inodesUsed *prometheus.Desc
+	inodesFree *prometheus.Desc
+}
+
+func newFilesystemCollector(ns string) *filesystemCollector {
+	labels := []string{"dir"}
+
+	return &filesystemCollector{
+		capacity: prometheus.NewDesc(
+			prometheus.BuildFQName(ns, "filesystem", "capacity_bytes"),
+			"The capacity of the filesystem of the storage directory in bytes.",
+			labels, nil,
+		),
+		used: prometheus.NewDesc(
+			prometheus.BuildFQName(ns, "filesystem", "used_bytes"),
+			"The used bytes of the filesystem of the storage directory.",
+			labels, nil,
+		),
+		free: prometheus.NewDesc(
+			prometheus.BuildFQName(ns, "filesystem", "free_bytes"),
+			"The free bytes of the filesystem of the storage directory available to the unprivileged user.",
+			labels, nil,
+		),
+		inodes: prometheus.NewDesc(
+			prometheus.BuildFQName(ns, "filesystem", "inodes"),
+			"The number of inodes of the filesystem of the storage directory.",
+			labels, nil,
+		),
+		inodesUsed: prometheus.NewDesc(
+			prometheus.BuildFQName(ns, "filesystem", "inodes_used"),
+			"The number of used inodes of the filesystem of the storage directory.",
+			labels, nil,
+		),
+		inodesFree: prometheus.NewDesc(
+			prometheus.BuildFQName(ns, "filesystem", "inodes_free"),
+			"The number of free inodes of the filesystem of the storage directory.",
+			labels, nil,
+		),
+	}
+}
+
+// watch watches the filesystem of the given directory.
+func (c *filesystemCollector) watch(dir string) {
+	c.dirs.Store(dir, struct{}{})
+}
+
+func (c *filesystemCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.capacity
+	ch <- c.used
+	ch <- c.free
+	ch <- c.inodes
+	ch <- c.inodesUsed
+	ch <- c.inodesFree
+}
+
+func (c *filesystemCollector) Collect(ch chan<- prometheus.Metric) {
+	c.dirs.Range(func(k, _ any) bool {
+		dir := k.(string)
+
+		s, err := statFilesystem(dir)
+		if err != nil {
+			// Not supported or not ready.
+			return true
+		}
+
+		ch <- prometheus.MustNewConstMetric(c.capacity, prometheus.GaugeValue, float64(s.Capacity), dir)
+		ch <- prometheus.MustNewConstMetric(c.used, prometheus.GaugeValue, float64(s.Used), dir)
+		ch <- prometheus.MustNewConstMetric(c.free, prometheus.GaugeValue, float64(s.Free), dir)
+		ch <- prometheus.MustNewConstMetric(c.inodes, prometheus.GaugeValue, float64(s.Inodes), dir)
+		ch <- prometheus.MustNewConstMetric(c.inodesUsed, prometheus.GaugeValue, float64(s.Inodes-s.InodesFree), dir)
+		ch <- prometheus.MustNewConstMetric(c.inodesFree, prometheus.GaugeValue, float64(s.InodesFree), dir)
+
+		return true
+	})
+}
@@ -0,0 +1,27 @@
+package storage
+
+import (
+	"syscall"
+)
+
+func statFilesystem(dir string) (filesystemStats, error) {
+	var st syscall.Statfs_t
+
+	err := syscall.Statfs(dir, &st)
+	if err != nil {
+		return filesystemStats{}, err
+	}
+
+	bs := uint64(st.Frsize)
+	if bs == 0 {
+		bs = uint64(st.Bsize)
+	}
+
+	return filesystemStats{
+		Capacity:   st.Blocks * bs,
+		Used:       (st.Blocks - st.Bfree) * bs,
+		Free:       st.Bavail * bs,
+		Inodes:     st.Files,
+		InodesFree: st.Ffree,
+	}, nil
+}
@@ -0,0 +1,25 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilesystemCollector(t *testing.T) {
+	c := newFilesystemCollector("test")
+	c.watch(t.TempDir())
+	c.watch("/not/existed")
+
+	// The directories failed to stat are skipped.
+	assert.Equal(t, 1, testutil.CollectAndCount(c, "test_filesystem_capacity_bytes"))
+	assert.Equal(t, 1, testutil.CollectAndCount(c, "test_filesystem_inodes_free"))
+
+	s, err := statFilesystem(t.TempDir())
+	require.NoError(t, err)
+	assert.NotZero(t, s.Capacity)
+	assert.LessOrEqual(t, s.Used, s.Capacity)
+	assert.LessOrEqual(t, s.Free, s.Capacity-s.Used)
+}
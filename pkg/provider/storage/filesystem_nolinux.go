@@ -0,0 +1,11 @@
+//go:build !linux
+
+package storage
+
+import (
+	"errors"
+)
+
+func statFilesystem(string) (filesystemStats, error) {
+	return filesystemStats{}, errors.ErrUnsupported
+}
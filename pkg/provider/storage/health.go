@@ -0,0 +1,40 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"os"
+)
+
+// sentinelPattern is the name pattern of the sentinel file for checking writability,
+// which is hidden to skip walking, and unique to not collide with the concurrent checking.
+const sentinelPattern = ".sentinel-*"
+
+func (s *service) IsWritable(_ context.Context) error {
+	f, err := os.CreateTemp(s.explicitDir, sentinelPattern)
+	if err != nil {
+		return fmt.Errorf("error creating sentinel file: %w", err)
+	}
+
+	defer func() { _ = os.Remove(f.Name()) }()
+
+	_, err = f.WriteString("hermitcrab")
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		return fmt.Errorf("error writing sentinel file: %w", err)
+	}
+
+	fi, err := os.Stat(f.Name())
+	if err != nil {
+		return fmt.Errorf("error stating sentinel file: %w", err)
+	}
+
+	if fi.Size() != int64(len("hermitcrab")) {
+		return fmt.Errorf("invalid sentinel file: unexpected size %d", fi.Size())
+	}
+
+	return nil
+}
@@ -0,0 +1,27 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_IsWritable(t *testing.T) {
+	dir := t.TempDir()
+	s := &service{explicitDir: dir}
+
+	require.NoError(t, s.IsWritable(context.Background()))
+
+	// Leave nothing behind.
+	es, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, es)
+
+	// Fail if the directory is gone.
+	s.explicitDir = filepath.Join(dir, "missing")
+	assert.Error(t, s.IsWritable(context.Background()))
+}
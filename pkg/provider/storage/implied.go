@@ -0,0 +1,138 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/seal-io/walrus/utils/log"
+
+	"github.com/seal-io/hermitcrab/pkg/provider/addrs"
+)
+
+// The behaviors of looking up the archive in the unreadable implied directory.
+const (
+	// ImpliedDirErrorWarn warns the error and continues to look up the next directory.
+	ImpliedDirErrorWarn = "warn"
+	// ImpliedDirErrorFail fails the lookup.
+	ImpliedDirErrorFail = "fail"
+)
+
+// impliedDirsFromEnv returns the implied directories of the TF_PLUGIN_MIRROR_DIR environment variable,
+// which is a list separated by the OS-specific path list separator, i.e. ":" on Unix.
+func impliedDirsFromEnv() []string {
+	var ds []string
+
+	for _, d := range filepath.SplitList(os.Getenv("TF_PLUGIN_MIRROR_DIR")) {
+		if d = os.ExpandEnv(d); d != "" {
+			ds = append(ds, d)
+		}
+	}
+
+	return ds
+}
+
+// loadImplied loads the archive from the implied directories in order,
+// returns false if not found in any of them.
+func (s *service) loadImplied(ctx context.Context, addr addrs.Address, opts LoadArchiveOptions) (Archive, bool, error) {
+	for _, d := range s.impliedDirs {
+		p, err := archivePathOf(d, addr, opts.Filename)
+		if err != nil {
+			return Archive{}, false, err
+		}
+
+		f, fi, err := openRegular(p)
+		switch {
+		case err == nil:
+			_statsCollector.impliedLookups.WithLabelValues(d, "hit").Inc()
+
+			return s.archiveOf(ctx, p, f, fi, opts), true, nil
+		case os.IsNotExist(err):
+			_statsCollector.impliedLookups.WithLabelValues(d, "miss").Inc()
+
+			continue
+		}
+
+		_statsCollector.impliedLookups.WithLabelValues(d, "error").Inc()
+
+		if s.impliedDirError == ImpliedDirErrorFail {
+			return Archive{}, false, fmt.Errorf("error reading implied archive: %w", err)
+		}
+
+		log.WithName("provider").WithName("storage").
+			Warnf("skip reading implied archive: %v", err)
+	}
+
+	return Archive{}, false, nil
+}
+
+// openRegular opens the regular file of the given path,
+// returns a not exist error if the path is not a regular file.
+func openRegular(p string) (*os.File, os.FileInfo, error) {
+	fi, err := os.Stat(p)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !fi.Mode().IsRegular() {
+		return nil, nil, &os.PathError{Op: "open", Path: p, Err: os.ErrNotExist}
+	}
+
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return f, fi, nil
+}
+
+var _statsCollector = newStatsCollector()
+
+// NewStatsCollector returns the collector of the storage metrics.
+func NewStatsCollector() prometheus.Collector {
+	return _statsCollector
+}
+
+func newStatsCollector() *statsCollector {
+	ns := "provider_storage"
+
+	return &statsCollector{
+		impliedLookups: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: ns,
+				Name:      "implied_lookups_total",
+				Help:      "The total number of looking up the archives in the implied directories.",
+			},
+			[]string{"dir", "result"},
+		),
+		peerLookups: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: ns,
+				Name:      "peer_lookups_total",
+				Help:      "The total number of looking up the archives in the peers.",
+			},
+			[]string{"peer", "result"},
+		),
+		filesystem: newFilesystemCollector(ns),
+	}
+}
+
+type statsCollector struct {
+	impliedLookups *prometheus.CounterVec
+	peerLookups    *prometheus.CounterVec
+	filesystem     *filesystemCollector
+}
+
+func (c *statsCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.impliedLookups.Describe(ch)
+	c.peerLookups.Describe(ch)
+	c.filesystem.Describe(ch)
+}
+
+func (c *statsCollector) Collect(ch chan<- prometheus.Metric) {
+	c.impliedLookups.Collect(ch)
+	c.peerLookups.Collect(ch)
+	c.filesystem.Collect(ch)
+}
@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_LoadArchive_implied(t *testing.T) {
+	opts := LoadArchiveOptions{
+		Hostname:  "registry.terraform.io",
+		Namespace: "hashicorp",
+		Type:      "null",
+		Filename:  "terraform-provider-null_1.0.0_linux_amd64.zip",
+	}
+
+	// A regular file as the implied directory fails stating with ENOTDIR regardless of the running user.
+	unreadableDir := filepath.Join(t.TempDir(), "unreadable")
+	require.NoError(t, os.WriteFile(unreadableDir, nil, 0o600))
+
+	emptyDir := t.TempDir()
+
+	impliedDir := t.TempDir()
+	require.NoError(t, os.MkdirAll(opts.Address().Dir(impliedDir), 0o700))
+	require.NoError(t, os.WriteFile(
+		filepath.Join(opts.Address().Dir(impliedDir), opts.Filename), []byte("archive"), 0o600))
+
+	dirs := []string{unreadableDir, emptyDir, impliedDir}
+
+	t.Run("warn", func(t *testing.T) {
+		ss, err := NewService(t.TempDir(), ServiceOptions{
+			Offline:     true,
+			ImpliedDirs: dirs,
+		})
+		require.NoError(t, err)
+
+		ar, err := ss.LoadArchive(context.Background(), opts)
+		require.NoError(t, err)
+
+		defer func() { _ = ar.Close() }()
+
+		bs, err := io.ReadAll(ar.Reader)
+		require.NoError(t, err)
+		assert.Equal(t, "archive", string(bs))
+
+		assert.True(t, ss.HasArchive(context.Background(), opts))
+
+		c := _statsCollector.impliedLookups
+		assert.Equal(t, float64(1), testutil.ToFloat64(c.WithLabelValues(emptyDir, "miss")))
+		assert.Equal(t, float64(1), testutil.ToFloat64(c.WithLabelValues(impliedDir, "hit")))
+		assert.Positive(t, testutil.ToFloat64(c.WithLabelValues(unreadableDir, "error")))
+	})
+
+	t.Run("fail", func(t *testing.T) {
+		ss, err := NewService(t.TempDir(), ServiceOptions{
+			Offline:         true,
+			ImpliedDirs:     dirs,
+			ImpliedDirError: ImpliedDirErrorFail,
+		})
+		require.NoError(t, err)
+
+		_, err = ss.LoadArchive(context.Background(), opts)
+		assert.ErrorContains(t, err, "error reading implied archive")
+	})
+}
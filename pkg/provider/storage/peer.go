@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"path"
+
+	"github.com/seal-io/walrus/utils/log"
+
+	"github.com/seal-io/hermitcrab/pkg/download"
+	"github.com/seal-io/hermitcrab/pkg/provider/addrs"
+)
+
+// PeerArchiveURL returns the URL of the cached archive served by the given peer,
+// the peer responds 404 if not cached rather than reaching its upstream,
+// so that the peers never look up each other in a loop.
+func PeerArchiveURL(peer string, addr addrs.Address, filename string) string {
+	u, err := url.Parse(peer)
+	if err != nil {
+		return ""
+	}
+
+	u.Path = path.Join("/", u.Path, "v1/providers", addr.TypedKey(), "peer", filename)
+
+	return u.String()
+}
+
+// fetchPeers downloads the archive into the given directory from the first peer which caches it,
+// returns the URL of the archive downloaded from the peer, or blank if none of the peers caches it,
+// only the archive with the known checksum is fetched from the peers.
+func (s *service) fetchPeers(ctx context.Context, addr addrs.Address, opts LoadArchiveOptions, d string,
+	progress download.ProgressFunc, response func(http.Header),
+) string {
+	if opts.Shasum == "" {
+		return ""
+	}
+
+	for _, peer := range s.peers {
+		u := PeerArchiveURL(peer, addr, opts.Filename)
+
+		err := s.downloadCli.Get(ctx, download.GetOptions{
+			DownloadURL:      u,
+			Directory:        d,
+			Filename:         opts.Filename,
+			ScratchDirectory: s.scratchDirOf(d),
+			Shasum:           opts.Shasum,
+			Progress:         progress,
+			Response:         response,
+		})
+		if err == nil {
+			_statsCollector.peerLookups.WithLabelValues(peer, "hit").Inc()
+
+			return u
+		}
+
+		_statsCollector.peerLookups.WithLabelValues(peer, "miss").Inc()
+
+		log.WithName("provider").WithName("storage").
+			WithValues(addr.LogValues()...).
+			Debugf("archive %s is not fetched from peer %s: %v", opts.Filename, peer, err)
+
+		if ctx.Err() != nil {
+			return ""
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// The default permissions of the cached archives and their directories.
+const (
+	DefaultFileMode os.FileMode = 0o600
+	DefaultDirMode  os.FileMode = 0o700
+)
+
+// Owner holds the numeric owner of the cached archives and their directories.
+type Owner struct {
+	UID int
+	GID int
+}
+
+// ParseOwner parses the given string in form of <UID>[:<GID>] into an Owner,
+// the GID is the same as the UID if omitted.
+func ParseOwner(s string) (*Owner, error) {
+	us, gs, ok := strings.Cut(s, ":")
+	if !ok {
+		gs = us
+	}
+
+	uid, err := strconv.Atoi(us)
+	if err != nil || uid < 0 {
+		return nil, fmt.Errorf("invalid uid %q", us)
+	}
+
+	gid, err := strconv.Atoi(gs)
+	if err != nil || gid < 0 {
+		return nil, fmt.Errorf("invalid gid %q", gs)
+	}
+
+	return &Owner{UID: uid, GID: gid}, nil
+}
+
+// ParseMode parses the given octal string into a permission mode, i.e. 0640.
+func ParseMode(s string) (os.FileMode, error) {
+	m, err := strconv.ParseUint(s, 8, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid octal mode %q", s)
+	}
+
+	if os.FileMode(m)&^os.ModePerm != 0 {
+		return 0, errors.New("mode out of permission bits")
+	}
+
+	return os.FileMode(m), nil
+}
+
+// mkdirAll creates the given directory along with the missing parents under the explicit directory,
+// applies the directory mode and the owner to the created ones.
+func (s *service) mkdirAll(d string) error {
+	if fi, err := os.Stat(d); err == nil {
+		if !fi.IsDir() {
+			return fmt.Errorf("%s is not a directory", d)
+		}
+
+		return nil
+	}
+
+	if d != s.explicitDir && filepath.Dir(d) != d {
+		if err := s.mkdirAll(filepath.Dir(d)); err != nil {
+			return err
+		}
+	}
+
+	err := os.Mkdir(d, s.dirMode)
+	if err != nil {
+		if os.IsExist(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	return s.own(d, s.dirMode)
+}
+
+// own applies the given mode regardless of the umask and the owner if configured to the given path.
+func (s *service) own(p string, mode os.FileMode) error {
+	err := os.Chmod(p, mode)
+	if err != nil {
+		return fmt.Errorf("error changing mode of %s: %w", p, err)
+	}
+
+	if s.owner == nil {
+		return nil
+	}
+
+	err = os.Lchown(p, s.owner.UID, s.owner.GID)
+	if err != nil {
+		return fmt.Errorf("error changing owner of %s: %w", p, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,32 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseOwner(t *testing.T) {
+	testCases := []struct {
+		given    string
+		expected *Owner
+	}{
+		{given: "1000", expected: &Owner{UID: 1000, GID: 1000}},
+		{given: "1000:2000", expected: &Owner{UID: 1000, GID: 2000}},
+		{given: "root"},
+		{given: "1000:-1"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.given, func(t *testing.T) {
+			actual, err := ParseOwner(tc.given)
+			if tc.expected == nil {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
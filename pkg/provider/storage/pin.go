@@ -0,0 +1,42 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/seal-io/walrus/utils/log"
+)
+
+// PinArchive downloads the archive from the given URL into the explicit directory regardless of the metadata,
+// the archive must match the given sha256 checksum,
+// the cached archive not matching the checksum is replaced.
+func (s *service) PinArchive(ctx context.Context, opts LoadArchiveOptions) (Archive, error) {
+	if opts.DownloadURL == "" || opts.Shasum == "" || opts.Filename == "" {
+		return Archive{}, errors.New("invalid options")
+	}
+
+	addr := opts.Address()
+
+	p, err := archivePathOf(s.explicitDir, addr, opts.Filename)
+	if err != nil {
+		return Archive{}, err
+	}
+
+	if fi, err := os.Stat(p); err == nil && fi.Mode().IsRegular() && !s.verify(ctx, p, fi, opts.Shasum) {
+		log.WithName("provider").WithName("storage").
+			WithValues(addr.LogValues()...).
+			Infof("replacing archive %s mismatching the pinned checksum", opts.Filename)
+
+		s.verified.Delete(p)
+		s.index.delete(p)
+
+		err = os.Remove(p)
+		if err != nil && !os.IsNotExist(err) {
+			return Archive{}, fmt.Errorf("error removing mismatched archive: %w", err)
+		}
+	}
+
+	return s.loadExplicit(ctx, addr, opts)
+}
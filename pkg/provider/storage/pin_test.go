@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_PinArchive(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("pinned"))
+	}))
+	defer srv.Close()
+
+	sum := sha256.Sum256([]byte("pinned"))
+
+	opts := LoadArchiveOptions{
+		Hostname:    "registry.terraform.io",
+		Namespace:   "hashicorp",
+		Type:        "null",
+		Filename:    "terraform-provider-null_1.0.0_linux_amd64.zip",
+		Shasum:      hex.EncodeToString(sum[:]),
+		DownloadURL: srv.URL + "/terraform-provider-null_1.0.0_linux_amd64.zip",
+	}
+
+	dir := t.TempDir()
+
+	ss, err := NewService(dir, ServiceOptions{ImpliedDirs: []string{}})
+	require.NoError(t, err)
+
+	// Cache a stale archive mismatching the pinned checksum.
+	p := filepath.Join(opts.Address().Dir(filepath.Join(dir, "providers")), opts.Filename)
+	require.NoError(t, os.MkdirAll(filepath.Dir(p), 0o700))
+	require.NoError(t, os.WriteFile(p, []byte("stale"), 0o600))
+
+	ar, err := ss.PinArchive(context.Background(), opts)
+	require.NoError(t, err)
+
+	bs, err := io.ReadAll(ar.Reader)
+	require.NoError(t, err)
+	_ = ar.Close()
+
+	assert.Equal(t, "pinned", string(bs))
+
+	t.Run("mismatched", func(t *testing.T) {
+		o := opts
+		o.Filename = "terraform-provider-null_1.0.0_darwin_arm64.zip"
+		o.Shasum = hex.EncodeToString(make([]byte, 32))
+
+		_, err := ss.PinArchive(context.Background(), o)
+		assert.ErrorIs(t, err, ErrDownloadFailed)
+		assert.False(t, ss.HasArchive(context.Background(), o))
+	})
+}
@@ -0,0 +1,41 @@
+package storage
+
+import (
+	"context"
+	"net/url"
+	"time"
+
+	"github.com/seal-io/walrus/utils/log"
+
+	"github.com/seal-io/hermitcrab/pkg/provider/provenance"
+)
+
+// record records the provenance of the cached archive if configured,
+// the failure is logged rather than failing the caching.
+func (s *service) record(r provenance.Record) {
+	if s.provenance == nil {
+		return
+	}
+
+	if u, err := url.Parse(r.URL); err == nil {
+		r.UpstreamHost = u.Host
+	}
+
+	r.Cached = time.Now()
+
+	err := s.provenance.Record(context.Background(), r)
+	if err != nil {
+		log.WithName("provider").WithName("storage").
+			Warnf("error recording provenance of %s: %v", r.Filename, err)
+	}
+}
+
+// verificationOf returns the verification result of the archive downloaded with the given checksum,
+// the download fails if the archive mismatches the given checksum.
+func verificationOf(shasum string) string {
+	if shasum == "" {
+		return provenance.VerificationNone
+	}
+
+	return provenance.VerificationChecksum
+}
@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/seal-io/walrus/utils/errorx"
+
+	"github.com/seal-io/hermitcrab/pkg/provider/provenance"
+	"github.com/seal-io/hermitcrab/pkg/timing"
+)
+
+// StoreArchive stores the archive read from the given reader into the explicit directory,
+// i.e. the archive published by the replicating instance,
+// the archive must match the given sha256 checksum,
+// the cached archive matching the checksum is kept.
+func (s *service) StoreArchive(ctx context.Context, opts LoadArchiveOptions, r io.Reader) error {
+	if opts.Shasum == "" || opts.Filename == "" {
+		return errors.New("invalid options")
+	}
+
+	addr := opts.Address()
+
+	p, err := archivePathOf(s.explicitDir, addr, opts.Filename)
+	if err != nil {
+		return err
+	}
+
+	d := filepath.Dir(p)
+
+	if fi, err := os.Stat(p); err == nil && fi.Mode().IsRegular() && s.verify(ctx, p, fi, opts.Shasum) {
+		_, err = io.Copy(io.Discard, r)
+		return err
+	}
+
+	err = s.mkdirAll(d)
+	if err != nil {
+		return fmt.Errorf("error creating archive directory: %w", err)
+	}
+
+	// Write into a hidden file, which is removed as the stale download if interrupted.
+	f, err := os.CreateTemp(d, "."+opts.Filename+".*")
+	if err != nil {
+		return fmt.Errorf("error creating archive: %w", err)
+	}
+
+	defer func() { _ = os.Remove(f.Name()) }()
+
+	stop := timing.Track(ctx, timing.PhaseDisk)
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(f, h), r)
+	stop()
+
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		return fmt.Errorf("error writing archive: %w", err)
+	}
+
+	if sum := hex.EncodeToString(h.Sum(nil)); sum != opts.Shasum {
+		return errorx.HttpErrorf(http.StatusBadRequest,
+			"archive %s mismatches the checksum: got %s", opts.Filename, sum)
+	}
+
+	err = s.own(f.Name(), s.fileMode)
+	if err != nil {
+		return err
+	}
+
+	s.verified.Delete(p)
+	s.index.delete(p)
+
+	err = os.Rename(f.Name(), p)
+	if err != nil {
+		return fmt.Errorf("error storing archive: %w", err)
+	}
+
+	if fi, err := os.Stat(p); err == nil {
+		s.index.put(p, fi.Size(), time.Now())
+	}
+
+	s.record(provenance.Record{
+		Hostname:     addr.Hostname,
+		Namespace:    addr.Namespace,
+		Type:         addr.Type,
+		Filename:     opts.Filename,
+		Source:       provenance.SourcePublish,
+		Shasum:       opts.Shasum,
+		Verification: provenance.VerificationChecksum,
+	})
+
+	return s.enforceQuota(addr, p)
+}
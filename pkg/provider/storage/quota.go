@@ -0,0 +1,159 @@
+package storage
+
+import (
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/seal-io/walrus/utils/errorx"
+	"github.com/seal-io/walrus/utils/log"
+
+	"github.com/seal-io/hermitcrab/pkg/policy"
+	"github.com/seal-io/hermitcrab/pkg/provider/addrs"
+)
+
+type namespacedArchive struct {
+	path     string
+	size     uint64
+	accessed time.Time
+}
+
+// enforceQuota enforces the disk quota of the given namespace after caching the given archive,
+// evicts the oldest cached archives within the namespace if exceeding,
+// and returns 507 without evicting if the given archive cannot fit in the quota by itself.
+func (s *service) enforceQuota(addr addrs.Address, archivePath string) error {
+	hostname, namespace := addr.Hostname, addr.Namespace
+
+	quota, ok := policy.Get().QuotaOf(hostname, namespace)
+	if !ok {
+		return nil
+	}
+
+	logger := log.WithName("provider").WithName("storage").
+		WithValues("hostname", hostname, "namespace", namespace)
+
+	// Serialize the enforcement of the same namespace.
+	v, _ := s.quotas.LoadOrStore(filepath.Join(hostname, namespace), &sync.Mutex{})
+	mu := v.(*sync.Mutex)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	as, err := s.listNamespacedArchives(hostname, namespace)
+	if err != nil {
+		return fmt.Errorf("error listing namespaced archives: %w", err)
+	}
+
+	var usage, size uint64
+	for i := range as {
+		usage += as[i].size
+
+		if as[i].path == archivePath {
+			size = as[i].size
+		}
+	}
+
+	if usage <= quota {
+		return nil
+	}
+
+	// Give up the given archive without evicting others if it cannot fit in the quota by itself.
+	if size > quota {
+		_ = os.Remove(archivePath)
+
+		return errorx.HttpErrorf(http.StatusInsufficientStorage,
+			"archive %s exceeds the quota %s of namespace %s",
+			filepath.Base(archivePath), humanize.IBytes(quota), namespace)
+	}
+
+	// Evict the least recently accessed archives except the given one.
+	sort.Slice(as, func(i, j int) bool {
+		return as[i].accessed.Before(as[j].accessed)
+	})
+
+	var evicted []EvictedArchive
+	defer func() { s.notifyEvicted(EvictionReasonQuota, evicted) }()
+
+	for i := range as {
+		if usage <= quota {
+			return nil
+		}
+
+		if as[i].path == archivePath {
+			continue
+		}
+
+		s.index.delete(as[i].path)
+
+		err = os.Remove(as[i].path)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("error evicting archive: %w", err)
+		}
+
+		usage -= as[i].size
+		evicted = append(evicted, EvictedArchive{
+			Hostname:  hostname,
+			Namespace: namespace,
+			Type:      filepath.Base(filepath.Dir(as[i].path)),
+			Filename:  filepath.Base(as[i].path),
+		})
+
+		logger.Infof("evicted archive %s to fit in quota %s",
+			filepath.Base(as[i].path), humanize.IBytes(quota))
+	}
+
+	return nil
+}
+
+// listNamespacedArchives lists the archives of the given namespace in the explicit directory.
+func (s *service) listNamespacedArchives(hostname, namespace string) ([]namespacedArchive, error) {
+	var as []namespacedArchive
+
+	d, err := SafeJoin(s.explicitDir, hostname, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	err = filepath.WalkDir(d, func(p string, e fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+
+			return err
+		}
+
+		// The downloading archives are hidden.
+		if !e.Type().IsRegular() || strings.HasPrefix(e.Name(), ".") || filepath.Ext(p) != ".zip" {
+			return nil
+		}
+
+		fi, err := e.Info()
+		if err != nil {
+			return nil
+		}
+
+		// Fallback to the modified time if not accessed since start.
+		accessed := fi.ModTime()
+		if ia, ok := s.index.get(p); ok && ia.accessed.After(accessed) {
+			accessed = ia.accessed
+		}
+
+		as = append(as, namespacedArchive{
+			path:     p,
+			size:     uint64(fi.Size()),
+			accessed: accessed,
+		})
+
+		return nil
+	})
+
+	return as, err
+}
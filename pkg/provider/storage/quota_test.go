@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/seal-io/walrus/utils/errorx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/seal-io/hermitcrab/pkg/policy"
+	"github.com/seal-io/hermitcrab/pkg/provider/addrs"
+)
+
+func TestService_enforceQuota(t *testing.T) {
+	// Limit the test namespace only, as the policy is global.
+	quotas := policy.Get().Quotas
+	quotas["registry.example.com/quota"] = 10
+
+	t.Cleanup(func() { delete(quotas, "registry.example.com/quota") })
+
+	dir := t.TempDir()
+
+	ss, err := NewService(dir, ServiceOptions{ImpliedDirs: []string{}})
+	require.NoError(t, err)
+
+	s := ss.(*service)
+
+	addr := addrs.Address{Hostname: "registry.example.com", Namespace: "quota", Type: "null"}
+	typedDir := addr.Dir(filepath.Join(dir, "providers"))
+	require.NoError(t, os.MkdirAll(typedDir, 0o700))
+
+	now := time.Now()
+
+	cache := func(version string, size int, accessed time.Time) string {
+		p := filepath.Join(typedDir, addr.WithVersion(version).WithPlatform("linux", "amd64").ArchiveFilename())
+		require.NoError(t, os.WriteFile(p, make([]byte, size), 0o600))
+		require.NoError(t, os.Chtimes(p, accessed, accessed))
+
+		return p
+	}
+
+	oldest := cache("1.0.0", 4, now.Add(-2*time.Hour))
+	older := cache("1.1.0", 4, now.Add(-time.Hour))
+
+	// Within the quota.
+	require.NoError(t, s.enforceQuota(addr, older))
+	assert.FileExists(t, oldest)
+	assert.FileExists(t, older)
+
+	// Evict the least recently accessed one.
+	newest := cache("1.2.0", 4, now)
+	require.NoError(t, s.enforceQuota(addr, newest))
+	assert.NoFileExists(t, oldest)
+	assert.FileExists(t, older)
+	assert.FileExists(t, newest)
+
+	// The other namespaces are neither limited nor evicted.
+	other := addrs.Address{Hostname: "registry.example.com", Namespace: "other", Type: "null"}
+	require.NoError(t, os.MkdirAll(other.Dir(filepath.Join(dir, "providers")), 0o700))
+
+	large := filepath.Join(other.Dir(filepath.Join(dir, "providers")),
+		other.WithVersion("1.0.0").WithPlatform("linux", "amd64").ArchiveFilename())
+	require.NoError(t, os.WriteFile(large, make([]byte, 100), 0o600))
+	require.NoError(t, s.enforceQuota(other, large))
+	assert.FileExists(t, large)
+
+	// Give up the one exceeding the quota by itself, without evicting the others.
+	oversize := cache("2.0.0", 11, now)
+
+	err = s.enforceQuota(addr, oversize)
+	require.Error(t, err)
+
+	var he errorx.HttpError
+	require.True(t, errors.As(err, &he))
+	assert.Equal(t, http.StatusInsufficientStorage, he.Status)
+	assert.NoFileExists(t, oversize)
+	assert.FileExists(t, older)
+	assert.FileExists(t, newest)
+	assert.FileExists(t, large)
+}
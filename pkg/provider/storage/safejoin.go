@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/seal-io/walrus/utils/errorx"
+
+	"github.com/seal-io/hermitcrab/pkg/provider/addrs"
+)
+
+// ErrUnsafePath indicates a path component may escape the root directory.
+var ErrUnsafePath = errors.New("unsafe path component")
+
+// SafeJoin joins the given components into the given root directory,
+// returns ErrUnsafePath if any component is blank, ".", "..", absolute,
+// or carries the path separators or the NUL, so that the joined path never escapes the root,
+// i.e. the provider coordinates and the filenames received from the clients.
+func SafeJoin(root string, elems ...string) (string, error) {
+	for _, e := range elems {
+		if e == "" || e == "." || e == ".." ||
+			strings.ContainsAny(e, "/\\\x00") ||
+			filepath.IsAbs(e) || filepath.VolumeName(e) != "" {
+			return "", fmt.Errorf("%w: %q", ErrUnsafePath, e)
+		}
+	}
+
+	p := filepath.Join(append([]string{root}, elems...)...)
+
+	// Double-check the joined path stays in the root.
+	if r, err := filepath.Rel(root, p); err != nil || r == ".." || strings.HasPrefix(r, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%w: %q escapes %q", ErrUnsafePath, p, root)
+	}
+
+	return p, nil
+}
+
+// archivePathOf returns the path of the given archive of the provider in the given root directory,
+// responds 400 if the provider coordinates or the filename are unsafe.
+func archivePathOf(root string, addr addrs.Address, filename string) (string, error) {
+	p, err := SafeJoin(root, addr.Hostname, addr.Namespace, addr.Type, filename)
+	if err != nil {
+		return "", errorx.WrapHttpError(http.StatusBadRequest, err, "invalid archive path")
+	}
+
+	return p, nil
+}
@@ -0,0 +1,45 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/seal-io/walrus/utils/errorx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSafeJoin(t *testing.T) {
+	root := t.TempDir()
+
+	p, err := SafeJoin(root, "registry.terraform.io", "hashicorp", "null", "terraform-provider-null_1.0.0_linux_amd64.zip")
+	require.NoError(t, err)
+	assert.Equal(t,
+		filepath.Join(root, "registry.terraform.io", "hashicorp", "null", "terraform-provider-null_1.0.0_linux_amd64.zip"), p)
+
+	for _, e := range []string{"", ".", "..", "../etc", "a/b", `a\b`, "/etc", "a\x00b"} {
+		_, err = SafeJoin(root, "registry.terraform.io", e)
+		assert.ErrorIs(t, err, ErrUnsafePath, "component %q", e)
+	}
+
+	ss, err := NewService(t.TempDir(), ServiceOptions{ImpliedDirs: []string{t.TempDir()}, Offline: true})
+	require.NoError(t, err)
+
+	opts := LoadArchiveOptions{
+		Hostname:  "registry.terraform.io",
+		Namespace: "..",
+		Type:      "null",
+		Filename:  "terraform-provider-null_1.0.0_linux_amd64.zip",
+	}
+
+	_, err = ss.LoadArchive(context.Background(), opts)
+	require.ErrorIs(t, err, ErrUnsafePath)
+
+	var he errorx.HttpError
+	require.ErrorAs(t, err, &he)
+	assert.Equal(t, http.StatusBadRequest, he.Status)
+
+	assert.False(t, ss.HasArchive(context.Background(), opts))
+}
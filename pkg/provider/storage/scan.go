@@ -0,0 +1,223 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/seal-io/walrus/utils/log"
+)
+
+// The modes of scanning the explicit directory on start.
+const (
+	// StartupScanFull scans all archives of the explicit directory.
+	StartupScanFull = "full"
+	// StartupScanFast only scans the type directories changed since the last scan.
+	StartupScanFast = "fast"
+	// StartupScanOff skips scanning.
+	StartupScanOff = "off"
+)
+
+// scannedStamp is the file under the explicit directory,
+// whose modified time records the start of the last completed scan.
+const scannedStamp = ".scanned"
+
+// scan rebuilds the archive index and removes the leftover downloading archives of the explicit directory,
+// the fast mode skips the type directories unchanged since the last scan,
+// as the downloading archives are created within the type directory.
+func (s *service) scan(mode string) error {
+	if mode != StartupScanFull && mode != StartupScanFast {
+		return nil
+	}
+
+	logger := log.WithName("provider").WithName("storage")
+
+	var (
+		start     = time.Now()
+		stampPath = filepath.Join(s.explicitDir, scannedStamp)
+		lastScan  time.Time
+	)
+
+	if mode == StartupScanFast {
+		if fi, err := os.Stat(stampPath); err == nil {
+			lastScan = fi.ModTime()
+		}
+	}
+
+	var indexed, skipped, removed int
+
+	err := filepath.WalkDir(s.explicitDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		r, err := filepath.Rel(s.explicitDir, p)
+		if err != nil || r == "." {
+			return nil
+		}
+
+		depth := len(strings.Split(filepath.ToSlash(r), "/"))
+
+		if d.IsDir() {
+			if depth != 3 || lastScan.IsZero() {
+				return nil
+			}
+
+			// Skip the type directory without entries added or removed.
+			fi, err := d.Info()
+			if err == nil && fi.ModTime().Before(lastScan) {
+				skipped++
+				return fs.SkipDir
+			}
+
+			return nil
+		}
+
+		if depth != 4 || !d.Type().IsRegular() {
+			return nil
+		}
+
+		// Remove the downloading archive left from a crash,
+		// as nothing is downloading before serving.
+		if strings.HasPrefix(d.Name(), ".") {
+			if err = os.Remove(p); err != nil && !os.IsNotExist(err) {
+				logger.Warnf("error removing leftover downloading archive %s: %v", p, err)
+				return nil
+			}
+
+			removed++
+
+			return nil
+		}
+
+		if filepath.Ext(p) != ".zip" {
+			return nil
+		}
+
+		fi, err := d.Info()
+		if err != nil {
+			return nil
+		}
+
+		s.index.put(p, fi.Size(), fi.ModTime())
+		indexed++
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Record the start of the scan,
+	// so that the directories changed during scanning are scanned next time.
+	if err = os.WriteFile(stampPath, nil, 0o600); err == nil {
+		err = os.Chtimes(stampPath, start, start)
+	}
+
+	if err != nil {
+		logger.Warnf("error recording scanned stamp: %v", err)
+	}
+
+	logger.Infof("scanned archives in %s mode within %v, indexed %d, removed %d leftovers, skipped %d unchanged directories",
+		mode, time.Since(start).Round(time.Millisecond), indexed, removed, skipped)
+
+	return nil
+}
+
+func (s *service) RemoveStaleDownloads(ctx context.Context, olderThan time.Duration) (int, error) {
+	var (
+		deadline = time.Now().Add(-olderThan)
+		removed  int
+	)
+
+	for _, root := range []string{s.explicitDir, s.scratchDir} {
+		if root == "" {
+			continue
+		}
+
+		err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			r, err := filepath.Rel(root, p)
+			if err != nil || r == "." {
+				return nil
+			}
+
+			depth := len(strings.Split(filepath.ToSlash(r), "/"))
+
+			if d.IsDir() {
+				// Skip the type directory which is downloading,
+				// the barrier is keyed by the directory of the explicit directory.
+				if _, ok := s.barriers.Load(filepath.Join(s.explicitDir, r)); ok && depth == 3 {
+					return fs.SkipDir
+				}
+
+				return nil
+			}
+
+			// Only the hidden files of the type directory are downloading archives.
+			if depth != 4 || !d.Type().IsRegular() || !strings.HasPrefix(d.Name(), ".") {
+				return nil
+			}
+
+			fi, err := d.Info()
+			if err != nil || fi.ModTime().After(deadline) {
+				return nil
+			}
+
+			if err = os.Remove(p); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("error removing stale downloading archive: %w", err)
+			}
+
+			removed++
+
+			return nil
+		})
+		if err != nil {
+			return removed, err
+		}
+	}
+
+	return removed, nil
+}
+
+// archiveIndex indexes the size and the last access time of the cached archives by path.
+type archiveIndex struct {
+	m sync.Map
+}
+
+type indexedArchive struct {
+	size     int64
+	accessed time.Time
+}
+
+// put records the size and the last access time of the archive of the given path.
+func (x *archiveIndex) put(p string, size int64, accessed time.Time) {
+	x.m.Store(p, indexedArchive{size: size, accessed: accessed})
+}
+
+// get returns the indexed archive of the given path.
+func (x *archiveIndex) get(p string) (indexedArchive, bool) {
+	v, ok := x.m.Load(p)
+	if !ok {
+		return indexedArchive{}, false
+	}
+
+	return v.(indexedArchive), true
+}
+
+// delete removes the archive of the given path from the index.
+func (x *archiveIndex) delete(p string) {
+	x.m.Delete(p)
+}
@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_scan(t *testing.T) {
+	dir := t.TempDir()
+	typedDir := filepath.Join(dir, "providers", "registry.terraform.io", "hashicorp", "null")
+	require.NoError(t, os.MkdirAll(typedDir, 0o700))
+
+	var (
+		archive  = filepath.Join(typedDir, "terraform-provider-null_1.0.0_linux_amd64.zip")
+		leftover = filepath.Join(typedDir, ".terraform-provider-null_1.0.0_darwin_arm64.zip")
+	)
+
+	require.NoError(t, os.WriteFile(archive, []byte("archive"), 0o600))
+	require.NoError(t, os.WriteFile(leftover, []byte("downloading"), 0o600))
+
+	ss, err := NewService(dir, ServiceOptions{StartupScan: StartupScanFull})
+	require.NoError(t, err)
+
+	s := ss.(*service)
+
+	ia, ok := s.index.get(archive)
+	assert.True(t, ok)
+	assert.Equal(t, int64(len("archive")), ia.size)
+	assert.NoFileExists(t, leftover)
+
+	// The fast mode skips the directory unchanged since the last scan.
+	past := time.Now().Add(-time.Hour)
+	require.NoError(t, os.Chtimes(typedDir, past, past))
+
+	ss, err = NewService(dir, ServiceOptions{StartupScan: StartupScanFast})
+	require.NoError(t, err)
+
+	_, ok = ss.(*service).index.get(archive)
+	assert.False(t, ok)
+}
+
+func TestService_RemoveStaleDownloads(t *testing.T) {
+	dir := t.TempDir()
+
+	ss, err := NewService(dir, ServiceOptions{})
+	require.NoError(t, err)
+
+	typedDir := filepath.Join(dir, "providers", "registry.terraform.io", "hashicorp", "null")
+	require.NoError(t, os.MkdirAll(typedDir, 0o700))
+
+	var (
+		stale  = filepath.Join(typedDir, ".terraform-provider-null_1.0.0_linux_amd64.zip")
+		recent = filepath.Join(typedDir, ".terraform-provider-null_1.0.0_darwin_arm64.zip")
+	)
+
+	require.NoError(t, os.WriteFile(stale, []byte("stale"), 0o600))
+	require.NoError(t, os.WriteFile(recent, []byte("recent"), 0o600))
+
+	past := time.Now().Add(-2 * time.Hour)
+	require.NoError(t, os.Chtimes(stale, past, past))
+
+	n, err := ss.RemoveStaleDownloads(context.Background(), time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.NoFileExists(t, stale)
+	assert.FileExists(t, recent)
+}
@@ -2,13 +2,29 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
+
+	"github.com/seal-io/walrus/utils/errorx"
+	"github.com/seal-io/walrus/utils/log"
 
 	"github.com/seal-io/hermitcrab/pkg/apis/runtime"
 	"github.com/seal-io/hermitcrab/pkg/download"
+	"github.com/seal-io/hermitcrab/pkg/events"
+	"github.com/seal-io/hermitcrab/pkg/provider/addrs"
+	"github.com/seal-io/hermitcrab/pkg/provider/provenance"
+	"github.com/seal-io/hermitcrab/pkg/registry"
+	"github.com/seal-io/hermitcrab/pkg/timing"
+	"github.com/seal-io/hermitcrab/pkg/tunable"
 )
 
 type (
@@ -19,10 +35,33 @@ type (
 		Filename    string
 		Shasum      string
 		DownloadURL string
+		// Canary serves the archive of the canary version,
+		// which must not be stored by the shared caches.
+		Canary bool
+	}
+
+	// DeleteArchivesOptions holds the options of deleting the archives of a version.
+	DeleteArchivesOptions struct {
+		// Address is the versioned provider address,
+		// or the typed provider address if Filename is specified.
+		Address addrs.Address
+		// Filename specifies the only archive to delete.
+		Filename string
+		// Reason is the reason of eviction, default is EvictionReasonPrune.
+		Reason string
 	}
 
 	Archive = runtime.ResponseFile
 
+	// StoredArchive holds the information of an archive in the explicit directory.
+	StoredArchive struct {
+		Hostname  string
+		Namespace string
+		Type      string
+		Filename  string
+		Path      string
+	}
+
 	// Service holds the operation of provider storage.
 	// Takes a look of the filesystem layer structure:
 	// {hostname}
@@ -32,164 +71,666 @@ type (
 	Service interface {
 		// LoadArchive loads the archive from the storage.
 		LoadArchive(context.Context, LoadArchiveOptions) (Archive, error)
+		// PinArchive downloads the archive from the given URL into the explicit directory,
+		// which must match the given checksum, regardless of the metadata.
+		PinArchive(context.Context, LoadArchiveOptions) (Archive, error)
+		// StoreArchive stores the archive read from the given reader into the explicit directory,
+		// which must match the given checksum, regardless of the metadata.
+		StoreArchive(context.Context, LoadArchiveOptions, io.Reader) error
+		// WalkArchives walks the archives in the explicit directory,
+		// stops walking if the given function returns error.
+		WalkArchives(context.Context, func(StoredArchive) error) error
+		// DeleteArchives deletes the archives of the given version from the explicit directory.
+		DeleteArchives(context.Context, DeleteArchivesOptions) error
+		// IsWritable checks whether the explicit directory is writable.
+		IsWritable(context.Context) error
+		// HasArchive returns true if the archive is cached,
+		// which can be loaded without reaching the upstream.
+		HasArchive(context.Context, LoadArchiveOptions) bool
+		// ListArchives returns the filenames of the cached archives of the given typed provider,
+		// which reads the directories of the provider instead of checking the archives one by one.
+		ListArchives(context.Context, addrs.Address) []string
+		// RemoveStaleDownloads removes the downloading archives not written within the given duration,
+		// which are left by the interrupted downloads, returns the number of removed archives.
+		RemoveStaleDownloads(context.Context, time.Duration) (int, error)
 	}
 )
 
-func NewService(dir string) (Service, error) {
+// ServiceOptions holds the options of the storage service.
+type ServiceOptions struct {
+	// EvictionWebhook is the URL to notify when the archives are evicted.
+	EvictionWebhook string
+	// VerifyOnServe verifies the sha256 checksum of the cached archive before serving,
+	// the corrupted archive is removed and re-fetched.
+	VerifyOnServe bool
+	// ChecksumH1 responds the h1 hash of the archive via the X-Checksum-H1 header,
+	// the hash is remembered until the archive file changes.
+	ChecksumH1 bool
+	// MaxConcurrentDownloads is the maximum number of concurrent downloads,
+	// the interactive downloads preempt the background downloads if exceeding,
+	// unlimited if not positive.
+	MaxConcurrentDownloads int
+	// StartupScan is the mode of scanning the explicit directory on start,
+	// select from StartupScanFull, StartupScanFast and StartupScanOff,
+	// default is StartupScanOff.
+	StartupScan string
+	// FileMode is the permission mode of the cached archives,
+	// default is DefaultFileMode.
+	FileMode os.FileMode
+	// DirMode is the permission mode of the directories of the cached archives,
+	// default is DefaultDirMode.
+	DirMode os.FileMode
+	// Owner changes the owner of the cached archives and their directories if specified,
+	// which requires the privilege.
+	Owner *Owner
+	// Offline never downloads from the upstream,
+	// only the cached archives are served.
+	Offline bool
+	// ImpliedDirs are the read-only directories to look up the archives before the explicit directory,
+	// default is the TF_PLUGIN_MIRROR_DIR environment variable if nil.
+	ImpliedDirs []string
+	// ImpliedDirError is the behavior of looking up the archive in the unreadable implied directory,
+	// select from ImpliedDirErrorWarn and ImpliedDirErrorFail,
+	// default is ImpliedDirErrorWarn.
+	ImpliedDirError string
+	// Provenance records where the cached archives came from if specified.
+	Provenance provenance.Service
+	// Peers are the base URLs of the other instances to look up the archive before the upstream,
+	// which trades the LAN bandwidth for the WAN egress.
+	Peers []string
+	// ScratchDir holds the in-progress downloads if specified, i.e. a fast local volume,
+	// the completed archives are moved into the explicit directory atomically,
+	// which reduces the write amplification of the explicit directory on a networked volume.
+	ScratchDir string
+	// Verify verifies the archive before downloading it into the explicit directory if specified,
+	// i.e. the trust policy, the archive is never downloaded from the peers or the upstream if failed,
+	// so that every way of filling the cache enforces the same check.
+	Verify func(context.Context, LoadArchiveOptions) error
+}
+
+func NewService(dir string, opts ServiceOptions) (Service, error) {
+	if opts.FileMode == 0 {
+		opts.FileMode = DefaultFileMode
+	}
+
+	if opts.DirMode == 0 {
+		opts.DirMode = DefaultDirMode
+	}
+
+	if opts.ImpliedDirs == nil {
+		opts.ImpliedDirs = impliedDirsFromEnv()
+	}
+
+	if opts.ImpliedDirError == "" {
+		opts.ImpliedDirError = ImpliedDirErrorWarn
+	}
+
 	providerDir := filepath.Join(dir, "providers")
 
-	err := os.Mkdir(providerDir, 0o700)
-	if err != nil && !os.IsExist(err) {
-		return nil, err
+	var scratchDir string
+	if opts.ScratchDir != "" {
+		scratchDir = filepath.Join(opts.ScratchDir, "providers")
+
+		err := os.MkdirAll(scratchDir, 0o700)
+		if err != nil {
+			return nil, fmt.Errorf("error creating providers scratch directory: %w", err)
+		}
+	}
+
+	s := &service{
+		impliedDirs:     opts.ImpliedDirs,
+		impliedDirError: opts.ImpliedDirError,
+		explicitDir:     providerDir,
+		scratchDir:      scratchDir,
+		downloadCli:     download.NewClient(nil, opts.MaxConcurrentDownloads),
+
+		evictionWebhook: opts.EvictionWebhook,
+		verifyOnServe:   opts.VerifyOnServe,
+		checksumH1:      opts.ChecksumH1,
+		fileMode:        opts.FileMode,
+		dirMode:         opts.DirMode,
+		owner:           opts.Owner,
+		offline:         opts.Offline,
+		peers:           opts.Peers,
+		provenance:      opts.Provenance,
+		verifyFetch:     opts.Verify,
+	}
+
+	err := s.mkdirAll(providerDir)
+	if err != nil {
+		return nil, fmt.Errorf("error creating providers directory: %w", err)
 	}
 
-	impliedDir := os.Getenv("TF_PLUGIN_MIRROR_DIR")
-	if impliedDir != "" {
-		impliedDir = os.ExpandEnv(impliedDir)
+	err = s.scan(opts.StartupScan)
+	if err != nil {
+		return nil, fmt.Errorf("error scanning archives: %w", err)
 	}
 
-	return &service{
-		impliedDir:  impliedDir,
-		explicitDir: providerDir,
-		downloadCli: download.NewClient(nil),
-	}, nil
+	_statsCollector.filesystem.watch(providerDir)
+	if scratchDir != "" {
+		_statsCollector.filesystem.watch(scratchDir)
+	}
+
+	return s, nil
 }
 
 type service struct {
 	barriers sync.Map
+	quotas   sync.Map
+	verified sync.Map
+	hashed   sync.Map
+	index    archiveIndex
+
+	impliedDirs     []string
+	impliedDirError string
+	explicitDir     string
+	scratchDir      string
+	downloadCli     *download.Client
+
+	evictionWebhook string
+	verifyOnServe   bool
+	checksumH1      bool
+	fileMode        os.FileMode
+	dirMode         os.FileMode
+	owner           *Owner
+	offline         bool
+	peers           []string
+	provenance      provenance.Service
+	verifyFetch     func(context.Context, LoadArchiveOptions) error
+}
 
-	impliedDir  string
-	explicitDir string
-	downloadCli *download.Client
+// Address returns the typed provider address of the options.
+func (opts LoadArchiveOptions) Address() addrs.Address {
+	return addrs.Address{
+		Hostname:  opts.Hostname,
+		Namespace: opts.Namespace,
+		Type:      opts.Type,
+	}
 }
 
 func (s *service) LoadArchive(ctx context.Context, opts LoadArchiveOptions) (Archive, error) {
-	// Check whether the archive is in the implied directory.
-	if s.impliedDir != "" {
-		p := filepath.Join(
-			s.impliedDir,
-			opts.Hostname, opts.Namespace, opts.Type,
-			opts.Filename)
+	addr := opts.Address()
+
+	// Refuse the unsafe coordinates or filename before looking up any directory.
+	if _, err := archivePathOf(s.explicitDir, addr, opts.Filename); err != nil {
+		return Archive{}, err
+	}
+
+	// Check whether the archive is in the implied directories.
+	ar, found, err := s.loadImplied(ctx, addr, opts)
+	if err != nil || found {
+		return ar, err
+	}
 
+	// Check whether the archive is in the local directory of the filesystem upstream.
+	if p, ok := registry.LocalArchivePath(opts.DownloadURL); ok {
 		fi, err := os.Stat(p)
 		if err != nil {
-			if !os.IsNotExist(err) {
-				return Archive{}, fmt.Errorf("error stating archive: %w", err)
-			}
+			return Archive{}, fmt.Errorf("error stating local archive: %w", err)
+		}
 
-			goto ExplicitDir
+		f, err := os.Open(p)
+		if err != nil {
+			return Archive{}, fmt.Errorf("error opening local archive: %w", err)
 		}
 
-		if fi.IsDir() {
-			goto ExplicitDir
+		return s.archiveOf(ctx, p, f, fi, opts), nil
+	}
+
+	// Check whether the archive is in the explicit directory.
+	return s.loadExplicit(ctx, addr, opts)
+}
+
+func (s *service) HasArchive(_ context.Context, opts LoadArchiveOptions) bool {
+	addr := opts.Address()
+
+	ps := make([]string, 0, len(s.impliedDirs)+2)
+
+	for _, d := range append([]string{s.explicitDir}, s.impliedDirs...) {
+		p, err := archivePathOf(d, addr, opts.Filename)
+		if err != nil {
+			return false
 		}
 
-		f, err := os.Open(p)
+		ps = append(ps, p)
+	}
+
+	if p, ok := registry.LocalArchivePath(opts.DownloadURL); ok {
+		ps = append(ps, p)
+	}
+
+	for _, p := range ps {
+		if fi, err := os.Stat(p); err == nil && fi.Mode().IsRegular() {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *service) ListArchives(_ context.Context, addr addrs.Address) []string {
+	var ns []string
+
+	for _, d := range append([]string{s.explicitDir}, s.impliedDirs...) {
+		p, err := SafeJoin(d, addr.Hostname, addr.Namespace, addr.Type)
 		if err != nil {
-			goto ExplicitDir
+			return nil
+		}
+
+		es, err := os.ReadDir(p)
+		if err != nil {
+			continue
+		}
+
+		for _, e := range es {
+			// Skip the downloading archives, which are hidden.
+			if e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+				continue
+			}
+
+			ns = append(ns, e.Name())
 		}
+	}
+
+	return ns
+}
+
+// maxDownloadAttempts is the maximum number of attempts to download an archive,
+// the waiters take over the failed download in turn until exhausted.
+const maxDownloadAttempts = 3
+
+var (
+	// ErrDownloadFailed indicates the archive failed to download from the upstream.
+	ErrDownloadFailed = errors.New("error downloading archive")
+	// ErrAttemptsExhausted indicates the archive is still unavailable after the maximum download attempts.
+	ErrAttemptsExhausted = errors.New("archive download attempts exhausted")
+)
+
+// loadState is the state of loading an archive from the explicit directory.
+type loadState int
+
+const (
+	// loadOpen opens the archive if exists,
+	// otherwise, goes to loadFetch if no one is downloading into the same directory,
+	// or goes to loadAwait.
+	loadOpen loadState = iota
+	// loadAwait waits for the ongoing download of the same directory, then goes to loadOpen.
+	loadAwait
+	// loadFetch downloads the archive, then goes to loadOpen.
+	loadFetch
+)
 
-		return Archive{
-			ContentType:   "application/zip",
-			ContentLength: fi.Size(),
-			Headers: map[string]string{
-				"Content-Disposition": fmt.Sprintf(`attachment; filename="%s"`, fi.Name()),
-			},
-			Reader: f,
-		}, nil
+// loadExplicit loads the archive from the explicit directory by a fetch-or-serve state machine,
+// only one request downloads into the same directory at a time and the others wait,
+// if the download fails, one of the waiters takes over the download until exhausted.
+func (s *service) loadExplicit(ctx context.Context, addr addrs.Address, opts LoadArchiveOptions) (Archive, error) {
+	p, err := archivePathOf(s.explicitDir, addr, opts.Filename)
+	if err != nil {
+		return Archive{}, err
 	}
 
-ExplicitDir:
-	// Check whether the archive is in the explicit directory.
+	var (
+		d = filepath.Dir(p)
 
-	d := filepath.Join(s.explicitDir, opts.Hostname, opts.Namespace, opts.Type)
-	p := filepath.Join(d, opts.Filename)
+		state   = loadOpen
+		br      *barrier
+		attempt int // The attempts of downloading the archive, including the ones of others.
+		lastErr error
+	)
+
+	for {
+		switch state {
+		case loadOpen:
+			ar, ok, err := s.openExplicit(ctx, addr, opts, p)
+			if err != nil || ok {
+				return ar, err
+			}
+
+			if s.offline {
+				return Archive{}, errorx.HttpErrorf(http.StatusNotFound,
+					"archive %s is not cached in offline mode", opts.Filename)
+			}
+
+			if attempt >= maxDownloadAttempts {
+				if lastErr != nil {
+					return Archive{}, fmt.Errorf("%w: %w", ErrAttemptsExhausted, lastErr)
+				}
+
+				return Archive{}, ErrAttemptsExhausted
+			}
+
+			v, rd := s.barriers.LoadOrStore(d, newBarrier(opts.Filename, attempt+1))
+			br = v.(*barrier)
+
+			state = loadFetch
+			if rd {
+				state = loadAwait
+			}
+		case loadAwait:
+			// Prevent the interactive request from waiting for the background download.
+			if download.PriorityFrom(ctx) == download.PriorityInteractive {
+				s.downloadCli.Promote(d)
+			}
+
+			br.Lock()
+
+			stop := timing.Track(ctx, timing.PhaseUpstream)
+			br.Wait()
+			stop()
+
+			// Only the download of the same archive counts.
+			if br.filename == opts.Filename {
+				if br.err != nil && !br.retryable {
+					return Archive{}, br.err
+				}
+
+				attempt, lastErr = br.attempt, br.err
+			}
+
+			state = loadOpen
+		case loadFetch:
+			br.Lock()
+
+			br.retryable, br.err = s.fetchExplicit(ctx, addr, opts, d, p)
+			s.barriers.Delete(d)
+			br.Done()
+
+			if br.err != nil {
+				return Archive{}, br.err
+			}
+
+			attempt = br.attempt
+			state = loadOpen
+		}
+	}
+}
+
+// openExplicit opens the archive of the given path in the explicit directory,
+// returns false if not found or corrupted.
+func (s *service) openExplicit(ctx context.Context, addr addrs.Address, opts LoadArchiveOptions, p string) (Archive, bool, error) {
+	d := filepath.Dir(p)
 
 	fi, err := os.Stat(p)
 	if err != nil {
 		if !os.IsNotExist(err) {
-			return Archive{}, fmt.Errorf("error stating archive: %w", err)
+			return Archive{}, false, fmt.Errorf("error stating archive: %w", err)
 		}
 
-		err = os.MkdirAll(d, 0o700)
-		if err != nil && !os.IsExist(err) {
-			return Archive{}, fmt.Errorf("error creating archive directory: %w", err)
+		err = s.mkdirAll(d)
+		if err != nil {
+			return Archive{}, false, fmt.Errorf("error creating archive directory: %w", err)
 		}
 	}
 
 	if fi != nil && fi.IsDir() {
 		err = os.RemoveAll(p)
 		if err != nil {
-			return Archive{}, fmt.Errorf("error correcting invalid archive: %w", err)
+			return Archive{}, false, fmt.Errorf("error correcting invalid archive: %w", err)
 		}
 
 		fi = nil
 	}
 
-	if fi != nil {
-		var f *os.File
+	if fi != nil && s.verifyOnServe && !s.verify(ctx, p, fi, opts.Shasum) {
+		log.WithName("provider").WithName("storage").
+			WithValues(addr.LogValues()...).
+			Warnf("removing corrupted archive %s", opts.Filename)
+
+		s.verified.Delete(p)
+		s.index.delete(p)
+
+		err = os.Remove(p)
+		if err != nil && !os.IsNotExist(err) {
+			return Archive{}, false, fmt.Errorf("error removing corrupted archive: %w", err)
+		}
+
+		fi = nil
+	}
 
+	if fi != nil {
 		f, err := os.Open(p)
 		if err != nil {
-			return Archive{}, fmt.Errorf("error opening file: %w", err)
+			return Archive{}, false, fmt.Errorf("error opening file: %w", err)
+		}
+
+		s.index.put(p, fi.Size(), time.Now())
+
+		return s.archiveOf(ctx, p, f, fi, opts), true, nil
+	}
+
+	return Archive{}, false, nil
+}
+
+// DownloadEvent is the payload of the download events.
+type DownloadEvent struct {
+	Hostname  string `json:"hostname"`
+	Namespace string `json:"namespace"`
+	Type      string `json:"type"`
+	Filename  string `json:"filename"`
+	Received  int64  `json:"received,omitempty"`
+	Total     int64  `json:"total,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// fetchExplicit downloads the archive into the given path of the explicit directory,
+// and returns whether the waiters can take over if failed.
+func (s *service) fetchExplicit(ctx context.Context, addr addrs.Address, opts LoadArchiveOptions, d, p string) (bool, error) {
+	// The refused archive cannot be fixed by retrying.
+	if s.verifyFetch != nil {
+		if err := s.verifyFetch(ctx, opts); err != nil {
+			return false, err
 		}
+	}
 
-		return Archive{
-			ContentType:   "application/zip",
-			ContentLength: fi.Size(),
-			Headers: map[string]string{
-				"Content-Disposition": fmt.Sprintf(`attachment; filename="%s"`, fi.Name()),
-			},
-			Reader: f,
-		}, nil
+	ev := DownloadEvent{
+		Hostname:  addr.Hostname,
+		Namespace: addr.Namespace,
+		Type:      addr.Type,
+		Filename:  opts.Filename,
+	}
+	events.Publish(events.TypeDownloadStarted, ev)
+
+	progress := func(received, total int64) {
+		pev := ev
+		pev.Received, pev.Total = received, total
+		events.Publish(events.TypeDownloadProgress, pev)
 	}
 
 	var (
-		br *barrier
-		rd bool
+		err     error
+		headers http.Header
+		source  = provenance.SourcePeer
 	)
-	{
-		var v any
-		v, rd = s.barriers.LoadOrStore(d, newBarrier())
-		br = v.(*barrier)
+
+	response := func(h http.Header) {
+		headers = h
 	}
 
-	br.Lock()
+	// Download the archive from the peers, or the upstream.
+	stop := timing.Track(ctx, timing.PhaseUpstream)
+
+	u := s.fetchPeers(ctx, addr, opts, d, progress, response)
+	if u == "" {
+		u, source = opts.DownloadURL, provenance.SourceUpstream
+
+		err = s.downloadCli.Get(ctx, download.GetOptions{
+			DownloadURL:      u,
+			Directory:        d,
+			Filename:         opts.Filename,
+			ScratchDirectory: s.scratchDirOf(d),
+			Shasum:           opts.Shasum,
+			Authorize:        registry.AuthorizeRequest,
+			Progress:         progress,
+			Response:         response,
+		})
+	}
+	stop()
 
-	if rd {
-		// Wait for the download to complete.
-		br.Wait()
+	if err != nil {
+		ev.Error = err.Error()
+		events.Publish(events.TypeDownloadFinished, ev)
 
-		return s.LoadArchive(ctx, opts)
+		return true, fmt.Errorf("%w: %w", ErrDownloadFailed, err)
 	}
 
-	defer func() {
-		s.barriers.Delete(d)
-		br.Done()
-	}()
-
-	// Download the archive.
-	err = s.downloadCli.Get(ctx, download.GetOptions{
-		DownloadURL: opts.DownloadURL,
-		Directory:   d,
-		Filename:    opts.Filename,
-		Shasum:      opts.Shasum,
+	if fi, err := os.Stat(p); err == nil {
+		ev.Received, ev.Total = fi.Size(), fi.Size()
+	}
+	events.Publish(events.TypeDownloadFinished, ev)
+
+	s.record(provenance.Record{
+		Hostname:     addr.Hostname,
+		Namespace:    addr.Namespace,
+		Type:         addr.Type,
+		Filename:     opts.Filename,
+		Source:       source,
+		URL:          u,
+		Shasum:       opts.Shasum,
+		Verification: verificationOf(opts.Shasum),
+		Headers:      provenance.HeadersOf(headers),
+		Background:   download.PriorityFrom(ctx) == download.PriorityBackground,
 	})
+
+	err = s.own(p, s.fileMode)
+	if err != nil {
+		return false, err
+	}
+
+	stop = timing.Track(ctx, timing.PhaseDisk)
+	err = s.enforceQuota(addr, p)
+	stop()
+
+	// The archive exceeding the quota cannot be fixed by retrying.
+	return false, err
+}
+
+// scratchDirOf returns the scratch directory of the given directory of the explicit directory,
+// which mirrors the layout of the explicit directory, or blank if no scratch directory.
+func (s *service) scratchDirOf(d string) string {
+	if s.scratchDir == "" {
+		return ""
+	}
+
+	r, err := filepath.Rel(s.explicitDir, d)
 	if err != nil {
-		return Archive{}, fmt.Errorf("error downloading archive: %w", err)
+		return ""
+	}
+
+	return filepath.Join(s.scratchDir, r)
+}
+
+// DefaultArchiveCacheMaxAge is the default max-age of the Cache-Control of the served archives,
+// the archive of a provider version never changes, so that the downstream HTTP caches can keep it long.
+const DefaultArchiveCacheMaxAge = 7 * 24 * time.Hour
+
+// archiveCacheControl returns the Cache-Control of the served archives,
+// the max-age is tunable at runtime,
+// the canary archives are private to not leak to the non-canary clients through the shared caches.
+func archiveCacheControl(canary bool) string {
+	if canary {
+		return "private, no-store"
+	}
+
+	maxAge := tunable.Get().ArchiveCacheMaxAge.Std()
+	if maxAge <= 0 {
+		maxAge = DefaultArchiveCacheMaxAge
+	}
+
+	return "public, max-age=" + strconv.FormatInt(int64(maxAge/time.Second), 10)
+}
+
+// archiveOf returns the Archive to serve the given opened file of the given path,
+// the MIME type and the disposition are driven by the filename,
+// and the cache headers are driven by the checksum and the modified time.
+func (s *service) archiveOf(ctx context.Context, p string, f *os.File, fi os.FileInfo, opts LoadArchiveOptions) Archive {
+	shasum := opts.Shasum
+	if shasum == "" {
+		shasum = s.shasumOf(ctx, p, fi)
 	}
 
-	return s.LoadArchive(ctx, opts)
+	ar := Archive{
+		ContentType:   runtime.ContentTypeOf(fi.Name()),
+		ContentLength: fi.Size(),
+		Filename:      fi.Name(),
+		Checksum:      shasum,
+		Modified:      fi.ModTime(),
+		Headers: map[string]string{
+			"Cache-Control": archiveCacheControl(opts.Canary),
+		},
+		Reader: f,
+	}
+
+	if s.checksumH1 && filepath.Ext(p) == ".zip" {
+		if h1 := s.h1Of(ctx, p, fi); h1 != "" {
+			ar.Headers["X-Checksum-H1"] = h1
+		}
+	}
+
+	return ar
+}
+
+// Address returns the typed provider address of the archive.
+func (a StoredArchive) Address() addrs.Address {
+	return addrs.Address{
+		Hostname:  a.Hostname,
+		Namespace: a.Namespace,
+		Type:      a.Type,
+	}
+}
+
+func (s *service) WalkArchives(ctx context.Context, fn func(StoredArchive) error) error {
+	return filepath.WalkDir(s.explicitDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if d.IsDir() || !d.Type().IsRegular() {
+			return nil
+		}
+
+		r, err := filepath.Rel(s.explicitDir, p)
+		if err != nil {
+			return nil
+		}
+
+		// Only the {hostname}/{namespace}/{type}/{filename} are archives,
+		// the downloading archives are hidden.
+		ps := strings.Split(filepath.ToSlash(r), "/")
+		if len(ps) != 4 || strings.HasPrefix(ps[3], ".") || filepath.Ext(ps[3]) != ".zip" {
+			return nil
+		}
+
+		return fn(StoredArchive{
+			Hostname:  ps[0],
+			Namespace: ps[1],
+			Type:      ps[2],
+			Filename:  ps[3],
+			Path:      p,
+		})
+	})
 }
 
+// barrier blocks the waiters until the holder downloads the archive,
+// and carries the result to the waiters.
 type barrier struct {
 	cond *sync.Cond
 	done bool
+
+	filename  string
+	attempt   int
+	err       error
+	retryable bool
 }
 
-func newBarrier() *barrier {
+func newBarrier(filename string, attempt int) *barrier {
 	return &barrier{
-		cond: sync.NewCond(&sync.Mutex{}),
+		cond:     sync.NewCond(&sync.Mutex{}),
+		filename: filename,
+		attempt:  attempt,
 	}
 }
 
@@ -209,3 +750,56 @@ func (br *barrier) Done() {
 	br.cond.L.Unlock()
 	br.cond.Broadcast()
 }
+
+func (s *service) DeleteArchives(_ context.Context, opts DeleteArchivesOptions) error {
+	addr := opts.Address
+
+	filename := opts.Filename
+	if filename == "" {
+		filename = addr.WithPlatform("*", "*").ArchiveFilename()
+	}
+
+	p, err := archivePathOf(s.explicitDir, addr, filename)
+	if err != nil {
+		return err
+	}
+
+	ps := []string{p}
+
+	if opts.Filename == "" {
+		ps, err = filepath.Glob(p)
+		if err != nil {
+			return fmt.Errorf("error globbing archives: %w", err)
+		}
+	}
+
+	reason := opts.Reason
+	if reason == "" {
+		reason = EvictionReasonPrune
+	}
+
+	evicted := make([]EvictedArchive, 0, len(ps))
+	defer func() { s.notifyEvicted(reason, evicted) }()
+
+	for i := range ps {
+		s.index.delete(ps[i])
+
+		err = os.Remove(ps[i])
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+
+			return fmt.Errorf("error removing archive: %w", err)
+		}
+
+		evicted = append(evicted, EvictedArchive{
+			Hostname:  addr.Hostname,
+			Namespace: addr.Namespace,
+			Type:      addr.Type,
+			Filename:  filepath.Base(ps[i]),
+		})
+	}
+
+	return nil
+}
@@ -0,0 +1,245 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_LoadArchive(t *testing.T) {
+	testCases := []struct {
+		name              string
+		failures          int32
+		expectedGets      int32
+		expectedFails     int
+		expectedExhausted int
+	}{
+		{
+			name:          "recovered by waiter",
+			failures:      1,
+			expectedGets:  2,
+			expectedFails: 1,
+		},
+		{
+			name:              "exhausted",
+			failures:          10,
+			expectedGets:      maxDownloadAttempts,
+			expectedFails:     5,
+			expectedExhausted: 5 - maxDownloadAttempts,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var gets atomic.Int32
+
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodGet {
+					w.WriteHeader(http.StatusMethodNotAllowed)
+					return
+				}
+
+				// Hold the download until all requests are waiting.
+				time.Sleep(100 * time.Millisecond)
+
+				if gets.Add(1) <= tc.failures {
+					w.WriteHeader(http.StatusBadGateway)
+					return
+				}
+
+				_, _ = w.Write([]byte("archive"))
+			}))
+			defer srv.Close()
+
+			ss, err := NewService(t.TempDir(), ServiceOptions{})
+			require.NoError(t, err)
+
+			var (
+				wg        sync.WaitGroup
+				m         sync.Mutex
+				fails     int
+				exhausted int
+			)
+
+			for i := 0; i < 5; i++ {
+				wg.Add(1)
+
+				go func() {
+					defer wg.Done()
+
+					ar, err := ss.LoadArchive(context.Background(), LoadArchiveOptions{
+						Hostname:    "registry.terraform.io",
+						Namespace:   "hashicorp",
+						Type:        "null",
+						Filename:    "terraform-provider-null_1.0.0_linux_amd64.zip",
+						DownloadURL: srv.URL,
+					})
+					if err != nil {
+						assert.ErrorIs(t, err, ErrDownloadFailed)
+
+						m.Lock()
+						fails++
+						if errors.Is(err, ErrAttemptsExhausted) {
+							exhausted++
+						}
+						m.Unlock()
+
+						return
+					}
+
+					_ = ar.Close()
+				}()
+			}
+
+			wg.Wait()
+
+			assert.Equal(t, tc.expectedGets, gets.Load())
+			assert.Equal(t, tc.expectedFails, fails)
+			assert.Equal(t, tc.expectedExhausted, exhausted)
+		})
+	}
+}
+
+func TestService_LoadArchive_peers(t *testing.T) {
+	const (
+		filename = "terraform-provider-null_1.0.0_linux_amd64.zip"
+		// The sha256 checksum of "archive".
+		shasum = "0eb3e36bfb24dcd9bb1d1bece1531216b59539a8fde17ee80224af0653c92aa3"
+	)
+
+	var upstreamGets, peerGets atomic.Int32
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			upstreamGets.Add(1)
+		}
+
+		_, _ = w.Write([]byte("archive"))
+	}))
+	defer upstream.Close()
+
+	missing := httptest.NewServer(http.NotFoundHandler())
+	defer missing.Close()
+
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/providers/registry.terraform.io/hashicorp/null/peer/"+filename {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		if r.Method == http.MethodGet {
+			peerGets.Add(1)
+		}
+
+		_, _ = w.Write([]byte("archive"))
+	}))
+	defer peer.Close()
+
+	ss, err := NewService(t.TempDir(), ServiceOptions{
+		Peers: []string{missing.URL, peer.URL},
+	})
+	require.NoError(t, err)
+
+	opts := LoadArchiveOptions{
+		Hostname:    "registry.terraform.io",
+		Namespace:   "hashicorp",
+		Type:        "null",
+		Filename:    filename,
+		Shasum:      shasum,
+		DownloadURL: upstream.URL,
+	}
+
+	ar, err := ss.LoadArchive(context.Background(), opts)
+	require.NoError(t, err)
+	_ = ar.Close()
+
+	assert.Equal(t, int32(1), peerGets.Load())
+	assert.Equal(t, int32(0), upstreamGets.Load())
+
+	// Fetch from the upstream if the checksum is unknown.
+	opts.Filename = "terraform-provider-null_1.0.0_linux_arm64.zip"
+	opts.Shasum = ""
+
+	ar, err = ss.LoadArchive(context.Background(), opts)
+	require.NoError(t, err)
+	_ = ar.Close()
+
+	assert.Equal(t, int32(1), peerGets.Load())
+	assert.Equal(t, int32(1), upstreamGets.Load())
+}
+
+func TestService_LoadArchive_verify(t *testing.T) {
+	var gets atomic.Int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gets.Add(1)
+
+		_, _ = w.Write([]byte("archive"))
+	}))
+	defer srv.Close()
+
+	errUntrusted := errors.New("untrusted")
+
+	var verified atomic.Int32
+
+	ss, err := NewService(t.TempDir(), ServiceOptions{
+		// Serve as both the peer and the upstream.
+		Peers: []string{srv.URL},
+		Verify: func(_ context.Context, opts LoadArchiveOptions) error {
+			verified.Add(1)
+
+			if opts.Filename == "terraform-provider-null_1.0.0_linux_amd64.zip" {
+				return errUntrusted
+			}
+
+			return nil
+		},
+	})
+	require.NoError(t, err)
+
+	opts := LoadArchiveOptions{
+		Hostname:  "registry.terraform.io",
+		Namespace: "hashicorp",
+		Type:      "null",
+		Filename:  "terraform-provider-null_1.0.0_linux_amd64.zip",
+		// The sha256 checksum of "archive".
+		Shasum:      "0eb3e36bfb24dcd9bb1d1bece1531216b59539a8fde17ee80224af0653c92aa3",
+		DownloadURL: srv.URL,
+	}
+
+	_, err = ss.LoadArchive(context.Background(), opts)
+	require.ErrorIs(t, err, errUntrusted)
+	assert.Zero(t, gets.Load(), "should never download the refused archive")
+	assert.False(t, ss.HasArchive(context.Background(), opts))
+
+	opts.Filename = "terraform-provider-null_1.0.0_linux_arm64.zip"
+
+	ar, err := ss.LoadArchive(context.Background(), opts)
+	require.NoError(t, err)
+	_ = ar.Close()
+
+	// The cached archive is served without verifying again.
+	ar, err = ss.LoadArchive(context.Background(), opts)
+	require.NoError(t, err)
+	_ = ar.Close()
+
+	assert.Equal(t, int32(2), verified.Load())
+	assert.Equal(t, "public, max-age=604800", ar.Headers["Cache-Control"])
+
+	// The canary archive is never stored by the shared caches.
+	opts.Canary = true
+
+	ar, err = ss.LoadArchive(context.Background(), opts)
+	require.NoError(t, err)
+	_ = ar.Close()
+
+	assert.Equal(t, "private, no-store", ar.Headers["Cache-Control"])
+}
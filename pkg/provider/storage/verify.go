@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/seal-io/hermitcrab/pkg/download"
+	"github.com/seal-io/hermitcrab/pkg/timing"
+)
+
+// verifiedArchive is the stamp of a verified archive,
+// the archive is not verified again until the stamp changes.
+type verifiedArchive struct {
+	size     int64
+	modified time.Time
+	shasum   string
+}
+
+// verify returns true if the given archive matches the given shasum,
+// or the given shasum is blank.
+func (s *service) verify(ctx context.Context, p string, fi os.FileInfo, shasum string) bool {
+	if shasum == "" {
+		return true
+	}
+
+	stamp := verifiedArchive{
+		size:     fi.Size(),
+		modified: fi.ModTime(),
+		shasum:   shasum,
+	}
+
+	if v, ok := s.verified.Load(p); ok && v.(verifiedArchive) == stamp {
+		return true
+	}
+
+	defer timing.Track(ctx, timing.PhaseDisk)()
+
+	matched, err := download.ValidateShasum(p, shasum)
+	if err != nil || !matched {
+		return false
+	}
+
+	s.verified.Store(p, stamp)
+
+	return true
+}
+
+// shasumOf returns the sha256 checksum of the given archive,
+// which is remembered as verified until the archive file changes,
+// returns blank if failed.
+func (s *service) shasumOf(ctx context.Context, p string, fi os.FileInfo) string {
+	if v, ok := s.verified.Load(p); ok {
+		if va := v.(verifiedArchive); va.size == fi.Size() && va.modified.Equal(fi.ModTime()) {
+			return va.shasum
+		}
+	}
+
+	defer timing.Track(ctx, timing.PhaseDisk)()
+
+	shasum, err := download.Shasum(p)
+	if err != nil {
+		return ""
+	}
+
+	s.verified.Store(p, verifiedArchive{
+		size:     fi.Size(),
+		modified: fi.ModTime(),
+		shasum:   shasum,
+	})
+
+	return shasum
+}
@@ -0,0 +1,174 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/seal-io/walrus/utils/errorx"
+	"github.com/seal-io/walrus/utils/json"
+	"github.com/seal-io/walrus/utils/version"
+	"golang.org/x/crypto/openpgp"
+
+	"github.com/seal-io/hermitcrab/pkg/download"
+	"github.com/seal-io/hermitcrab/pkg/policy"
+	"github.com/seal-io/hermitcrab/pkg/provider/addrs"
+	"github.com/seal-io/hermitcrab/pkg/provider/metadata"
+	"github.com/seal-io/hermitcrab/pkg/provider/storage"
+	"github.com/seal-io/hermitcrab/pkg/registry"
+)
+
+var trustHttpClient = download.NewHttpClient(
+	download.WithUserAgent(version.GetUserAgentWith("hermitcrab")),
+)
+
+// maxShasumsSize is the maximum size of the SHA256SUMS file and its signature to verify.
+const maxShasumsSize = 1 << 20
+
+// VerifyTrust verifies the given platform is signed by the keys pinned by the trust policy,
+// the detached signature of the SHA256SUMS file must be made by a pinned key among the signing keys,
+// and the SHA256SUMS file must list the archive with its shasum,
+// does nothing if the provider is not pinned, the verified platforms are remembered.
+func (s *Service) VerifyTrust(ctx context.Context, addr addrs.Address, p metadata.Platform) error {
+	ids, ok := policy.Get().TrustedKeysOf(addr.Hostname, addr.Namespace)
+	if !ok {
+		return nil
+	}
+
+	k := strings.Join([]string{p.ShasumsURL, p.Filename, p.Shasum}, "\x00")
+	if _, ok := s.trusted.Load(k); ok {
+		return nil
+	}
+
+	err := verifyTrust(ctx, ids, p)
+	if err != nil {
+		return errorx.WrapHttpError(http.StatusForbidden, err,
+			fmt.Sprintf("archive %s is untrusted", p.Filename))
+	}
+
+	s.trusted.Store(k, struct{}{})
+
+	return nil
+}
+
+// verifyArchive verifies the archive to download into the cache is signed by the pinned keys,
+// the platform of the archive is looked up from the metadata, see VerifyTrust.
+func (s *Service) verifyArchive(ctx context.Context, opts storage.LoadArchiveOptions) error {
+	addr := opts.Address()
+	if _, ok := policy.Get().TrustedKeysOf(addr.Hostname, addr.Namespace); !ok {
+		return nil
+	}
+
+	v, os, arch, ok := registry.ParseArchiveFilename(addr.Type, opts.Filename)
+	if !ok {
+		return errorx.HttpErrorf(http.StatusForbidden, "archive %s is untrusted: unknown platform", opts.Filename)
+	}
+
+	paddr := addr.WithVersion(v).WithPlatform(os, arch)
+
+	p, err := s.Metadata.GetPlatform(ctx, metadata.GetPlatformOptions(paddr))
+	if err != nil {
+		return fmt.Errorf("error getting platform: %w", err)
+	}
+
+	if p.Filename != opts.Filename || (opts.Shasum != "" && p.Shasum != opts.Shasum) {
+		return errorx.HttpErrorf(http.StatusForbidden, "archive %s is untrusted: mismatched platform", opts.Filename)
+	}
+
+	return s.VerifyTrust(ctx, paddr, p)
+}
+
+func verifyTrust(ctx context.Context, ids []string, p metadata.Platform) error {
+	if p.Shasum == "" || p.ShasumsURL == "" || p.ShasumsSignatureURL == "" {
+		return errors.New("unsigned archive")
+	}
+
+	var sk struct {
+		GPGPublicKeys []metadata.GPGPublicKey `json:"gpg_public_keys"`
+	}
+
+	if len(p.SigningKeys) != 0 {
+		if err := json.Unmarshal(p.SigningKeys, &sk); err != nil {
+			return fmt.Errorf("error unmarshaling signing keys: %w", err)
+		}
+	}
+
+	var keyring openpgp.EntityList
+
+	for _, key := range sk.GPGPublicKeys {
+		el, err := openpgp.ReadArmoredKeyRing(strings.NewReader(key.ASCIIArmor))
+		if err != nil {
+			continue
+		}
+
+		keyring = append(keyring, el...)
+	}
+
+	if len(keyring) == 0 {
+		return errors.New("no signing keys")
+	}
+
+	shasums, err := fetchTrustFile(ctx, p.ShasumsURL)
+	if err != nil {
+		return fmt.Errorf("error fetching shasums: %w", err)
+	}
+
+	signature, err := fetchTrustFile(ctx, p.ShasumsSignatureURL)
+	if err != nil {
+		return fmt.Errorf("error fetching shasums signature: %w", err)
+	}
+
+	signer, err := openpgp.CheckDetachedSignature(keyring, bytes.NewReader(shasums), bytes.NewReader(signature))
+	if err != nil {
+		return fmt.Errorf("error checking shasums signature: %w", err)
+	}
+
+	// Check the key which actually signs, rather than the key_id claimed by the upstream.
+	signed := slices.Contains(ids, strings.ToUpper(signer.PrimaryKey.KeyIdString()))
+	for i := 0; !signed && i < len(signer.Subkeys); i++ {
+		signed = slices.Contains(ids, strings.ToUpper(signer.Subkeys[i].PublicKey.KeyIdString()))
+	}
+
+	if !signed {
+		return fmt.Errorf("signed by unexpected key %s", strings.ToUpper(signer.PrimaryKey.KeyIdString()))
+	}
+
+	sums, err := metadata.ParseShasums(shasums)
+	if err != nil {
+		return err
+	}
+
+	if sums[p.Filename] != strings.ToLower(p.Shasum) {
+		return errors.New("shasum is not signed")
+	}
+
+	return nil
+}
+
+// fetchTrustFile fetches the file of the given URL with the credential of the hostname.
+func fetchTrustFile(ctx context.Context, rawURL string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	registry.AuthorizeRequest(req)
+
+	resp, err := trustHttpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	return io.ReadAll(io.LimitReader(resp.Body, maxShasumsSize))
+}
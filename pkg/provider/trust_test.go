@@ -0,0 +1,90 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/seal-io/walrus/utils/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+
+	"github.com/seal-io/hermitcrab/pkg/provider/metadata"
+)
+
+func Test_verifyTrust(t *testing.T) {
+	const (
+		filename = "terraform-provider-null_1.0.0_linux_amd64.zip"
+		shasum   = "5f2d8a3b6c1e4f7a9b0c2d4e6f8a1b3c5d7e9f0a2b4c6d8e0f1a3b5c7d9e1f2a"
+	)
+
+	signer, err := openpgp.NewEntity("signer", "", "signer@example.com", nil)
+	require.NoError(t, err)
+
+	var armored bytes.Buffer
+	{
+		w, err := armor.Encode(&armored, openpgp.PublicKeyType, nil)
+		require.NoError(t, err)
+		require.NoError(t, signer.Serialize(w))
+		require.NoError(t, w.Close())
+	}
+
+	shasums := []byte(shasum + "  " + filename + "\n")
+
+	var signature bytes.Buffer
+	require.NoError(t, openpgp.DetachSign(&signature, signer, bytes.NewReader(shasums), nil))
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/SHA256SUMS":
+			_, _ = w.Write(shasums)
+		case "/SHA256SUMS.sig":
+			_, _ = w.Write(signature.Bytes())
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	keys, err := json.Marshal(map[string]any{
+		"gpg_public_keys": []metadata.GPGPublicKey{
+			{
+				// The claimed key ID is not trusted, the key which actually signs is checked.
+				KeyID:      "0000000000000000",
+				ASCIIArmor: armored.String(),
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	p := metadata.Platform{
+		Filename:            filename,
+		Shasum:              shasum,
+		ShasumsURL:          srv.URL + "/SHA256SUMS",
+		ShasumsSignatureURL: srv.URL + "/SHA256SUMS.sig",
+		SigningKeys:         keys,
+	}
+
+	pinned := strings.ToUpper(signer.PrimaryKey.KeyIdString())
+	ctx := context.Background()
+
+	assert.NoError(t, verifyTrust(ctx, []string{pinned}, p))
+
+	// Signed by an unexpected key.
+	assert.ErrorContains(t, verifyTrust(ctx, []string{"34365D9472D7468F"}, p), "unexpected key")
+
+	// Shasum not listed in the signed shasums.
+	tampered := p
+	tampered.Shasum = strings.Repeat("0", 64)
+	assert.ErrorContains(t, verifyTrust(ctx, []string{pinned}, tampered), "not signed")
+
+	// Unsigned.
+	unsigned := p
+	unsigned.ShasumsSignatureURL = ""
+	assert.Error(t, verifyTrust(ctx, []string{pinned}, unsigned))
+}
@@ -0,0 +1,151 @@
+package redact
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Mask is the replacement of the redacted secret.
+const Mask = "xxxxx"
+
+// sensitiveQueryKeys holds the (lower-cased) substrings of the query keys carrying credentials,
+// i.e. ?token=, ?X-Amz-Signature=, ?X-Amz-Credential=, ?access_key=.
+var sensitiveQueryKeys = []string{
+	"token",
+	"signature",
+	"credential",
+	"secret",
+	"password",
+	"passwd",
+	"key",
+	"auth",
+	"session",
+}
+
+// IsSensitiveQueryKey returns true if the given query key carries credentials.
+func IsSensitiveQueryKey(k string) bool {
+	k = strings.ToLower(k)
+	if k == "sig" {
+		return true
+	}
+
+	for _, s := range sensitiveQueryKeys {
+		if strings.Contains(k, s) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// URL returns the string of the given URL with the credentials masked,
+// which are the password(or the username without password) of the user info,
+// and the values of the sensitive queries.
+func URL(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+
+	r := *u
+
+	if r.User != nil {
+		if _, ok := r.User.Password(); ok {
+			r.User = url.UserPassword(r.User.Username(), Mask)
+		} else {
+			r.User = url.User(Mask)
+		}
+	}
+
+	if r.RawQuery != "" {
+		qs := strings.Split(r.RawQuery, "&")
+		for i := range qs {
+			k, _, ok := strings.Cut(qs[i], "=")
+			if !ok {
+				continue
+			}
+
+			if uk, err := url.QueryUnescape(k); err == nil {
+				k = uk
+			}
+
+			if IsSensitiveQueryKey(k) {
+				qs[i] = url.QueryEscape(k) + "=" + Mask
+			}
+		}
+		r.RawQuery = strings.Join(qs, "&")
+	}
+
+	return r.String()
+}
+
+// URLString is similar to URL but accepts a string,
+// it returns the given string if failed to parse.
+func URLString(s string) string {
+	u, err := url.Parse(s)
+	if err != nil {
+		return s
+	}
+
+	// Keep the original if nothing is masked.
+	r := URL(u)
+	if r == u.String() {
+		return s
+	}
+
+	return r
+}
+
+var (
+	regexURL           = regexp.MustCompile(`\b[a-zA-Z][a-zA-Z0-9+.-]*://[^\s"'<>` + "`" + `]+`)
+	regexAuthorization = regexp.MustCompile(`(?i)\b(authorization["']?\s*[:=]\s*["']?(?:(?:bearer|basic|token)\s+)?)[^\s"',]+`)
+	regexBearer        = regexp.MustCompile(`(?i)\b(bearer\s+)[a-z0-9._~+/=-]+`)
+)
+
+// String returns the given free text with the credentials masked,
+// which are the URLs with credentials and the authorization headers.
+func String(s string) string {
+	if s == "" {
+		return s
+	}
+
+	if strings.Contains(s, "://") {
+		s = regexURL.ReplaceAllStringFunc(s, func(m string) string {
+			// Exclude the trailing punctuations.
+			u := strings.TrimRight(m, ".,:;)]}")
+			return URLString(u) + m[len(u):]
+		})
+	}
+
+	if strings.Contains(strings.ToLower(s), "authorization") {
+		s = regexAuthorization.ReplaceAllString(s, "${1}"+Mask)
+	}
+
+	if strings.Contains(strings.ToLower(s), "bearer") {
+		s = regexBearer.ReplaceAllString(s, "${1}"+Mask)
+	}
+
+	return s
+}
+
+// Error wraps the given error to mask the credentials of the message,
+// the wrapped error can still be unwrapped.
+func Error(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return redactedError{err: err}
+}
+
+type redactedError struct {
+	err error
+}
+
+func (e redactedError) Error() string {
+	return String(e.err.Error())
+}
+
+func (e redactedError) Unwrap() error {
+	return e.err
+}
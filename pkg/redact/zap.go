@@ -0,0 +1,71 @@
+package redact
+
+import (
+	"fmt"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// ZapCore wraps the given zapcore.Core to mask the credentials of the message and fields,
+// it is used as zap.WrapCore(redact.ZapCore).
+func ZapCore(c zapcore.Core) zapcore.Core {
+	return core{Core: c}
+}
+
+type core struct {
+	zapcore.Core
+}
+
+func (c core) With(fields []zapcore.Field) zapcore.Core {
+	return core{Core: c.Core.With(redactFields(fields))}
+}
+
+func (c core) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+
+	return ce
+}
+
+func (c core) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	ent.Message = String(ent.Message)
+	return c.Core.Write(ent, redactFields(fields))
+}
+
+func redactFields(fields []zapcore.Field) []zapcore.Field {
+	var rs []zapcore.Field
+
+	for i := range fields {
+		f := fields[i]
+
+		switch f.Type {
+		case zapcore.StringType:
+			f.String = String(f.String)
+		case zapcore.StringerType:
+			f.Type = zapcore.StringType
+			f.String = String(fmt.Sprint(f.Interface))
+			f.Interface = nil
+		case zapcore.ErrorType:
+			if err, ok := f.Interface.(error); ok {
+				f.Interface = Error(err)
+			}
+		default:
+			continue
+		}
+
+		// Copy on write.
+		if rs == nil {
+			rs = make([]zapcore.Field, len(fields))
+			copy(rs, fields)
+		}
+
+		rs[i] = f
+	}
+
+	if rs == nil {
+		return fields
+	}
+
+	return rs
+}
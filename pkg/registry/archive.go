@@ -0,0 +1,116 @@
+package registry
+
+import (
+	"regexp"
+	"sort"
+
+	"github.com/seal-io/walrus/utils/json"
+)
+
+// Archive holds the information of a provider archive,
+// which is used to synthesize the registry protocol responses
+// for the upstreams that only host the archives.
+type Archive struct {
+	Version     string
+	OS          string
+	Arch        string
+	Filename    string
+	DownloadURL string
+	Shasum      string
+	Protocols   []string
+}
+
+// regexArchiveFilename matches the archive filename,
+// the type consists of letters, digits and hyphens, i.e. google-beta,
+// and the version may carry the prerelease and the build metadata.
+var regexArchiveFilename = regexp.MustCompile(
+	`^terraform-provider-(?P<type>[0-9A-Za-z-]+)_(?P<version>[0-9A-Za-z.+-]+)_(?P<os>[a-z]+)_(?P<arch>[a-z0-9]+)\.zip$`,
+)
+
+// ParseArchiveFilename parses the given archive filename of the given type,
+// returns false if the filename is not a valid archive of the type.
+func ParseArchiveFilename(type_, filename string) (version, os, arch string, ok bool) {
+	ps := regexArchiveFilename.FindStringSubmatch(filename)
+	if len(ps) != 5 || ps[1] != type_ {
+		return "", "", "", false
+	}
+
+	return ps[2], ps[3], ps[4], true
+}
+
+// defaultProtocols is the protocols of the archive without manifest.
+var defaultProtocols = []string{"5.0"}
+
+// marshalVersions synthesizes the list available versions response with the given archives.
+func marshalVersions(archives []Archive) []byte {
+	type (
+		platform struct {
+			OS   string `json:"os"`
+			Arch string `json:"arch"`
+		}
+		version struct {
+			Version   string     `json:"version"`
+			Protocols []string   `json:"protocols"`
+			Platforms []platform `json:"platforms"`
+		}
+	)
+
+	idx := map[string]int{}
+	vs := make([]version, 0, len(archives))
+
+	for _, a := range archives {
+		i, ok := idx[a.Version]
+		if !ok {
+			i = len(vs)
+			idx[a.Version] = i
+
+			ps := a.Protocols
+			if len(ps) == 0 {
+				ps = defaultProtocols
+			}
+
+			vs = append(vs, version{
+				Version:   a.Version,
+				Protocols: ps,
+			})
+		}
+
+		vs[i].Platforms = append(vs[i].Platforms, platform{
+			OS:   a.OS,
+			Arch: a.Arch,
+		})
+	}
+
+	for i := range vs {
+		sort.Slice(vs[i].Platforms, func(j, k int) bool {
+			pj, pk := vs[i].Platforms[j], vs[i].Platforms[k]
+			return pj.OS < pk.OS || pj.OS == pk.OS && pj.Arch < pk.Arch
+		})
+	}
+
+	bs, _ := json.Marshal(map[string]any{"versions": vs})
+
+	return bs
+}
+
+// marshalPlatform synthesizes the find a provider package response with the given archive.
+func marshalPlatform(a Archive) []byte {
+	ps := a.Protocols
+	if len(ps) == 0 {
+		ps = defaultProtocols
+	}
+
+	bs, _ := json.Marshal(map[string]any{
+		"protocols":    ps,
+		"os":           a.OS,
+		"arch":         a.Arch,
+		"filename":     a.Filename,
+		"download_url": a.DownloadURL,
+		"shasum":       a.Shasum,
+		"signing_keys": map[string]any{
+			"gpg_public_keys": []any{},
+		},
+	})
+
+	return bs
+}
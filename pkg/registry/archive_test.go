@@ -0,0 +1,25 @@
+package registry
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseArchiveFilename(t *testing.T) {
+	v, o, a, ok := ParseArchiveFilename("google-beta", "terraform-provider-google-beta_5.0.0_linux_amd64.zip")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"5.0.0", "linux", "amd64"}, []string{v, o, a})
+
+	v, _, _, ok = ParseArchiveFilename("null", "terraform-provider-null_3.2.1-alpha1+build.1_darwin_arm64.zip")
+	assert.True(t, ok)
+	assert.Equal(t, "3.2.1-alpha1+build.1", v)
+
+	// Mismatch the type.
+	_, _, _, ok = ParseArchiveFilename("google", "terraform-provider-google-beta_5.0.0_linux_amd64.zip")
+	assert.False(t, ok)
+
+	// Reject the underscore in the type.
+	_, _, _, ok = ParseArchiveFilename("foo_bar", "terraform-provider-foo_bar_1.0.0_linux_amd64.zip")
+	assert.False(t, ok)
+}
@@ -0,0 +1,94 @@
+package registry
+
+import (
+	"context"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// Artifactory serves the Terraform repositories under the API path of the context path,
+// see https://jfrog.com/help/r/jfrog-artifactory-documentation/terraform-registry,
+// the well-known discovery is only available when Artifactory is serving at the root of the hostname,
+// and the repository is addressed by prefixing the namespace with `<REPOSITORY>__`.
+//
+// The context path can be specified by the `context-path` option, default is /artifactory,
+// and the repository can be fixed by the `repository` option,
+// which allows the clients to request without the `<REPOSITORY>__` prefix.
+
+// artifactoryEndpoint returns the Terraform API endpoint of the given Artifactory upstream and service.
+func artifactoryEndpoint(u Upstream, service string) url.URL {
+	cp := u.Options["context-path"]
+	if cp == "" {
+		cp = "/artifactory"
+	}
+
+	return url.URL{
+		Scheme: "https",
+		Host:   u.Hostname,
+		Path:   path.Join("/", cp, "api/terraform/v1", service) + "/",
+	}
+}
+
+// artifactoryNamespace returns the namespace with the repository prefix.
+func artifactoryNamespace(u Upstream, namespace string) string {
+	r := u.Options["repository"]
+	if r == "" || strings.Contains(namespace, "__") {
+		return namespace
+	}
+
+	return r + "__" + namespace
+}
+
+type artifactorySource struct {
+	registrySource
+
+	upstream Upstream
+}
+
+// artifactorySourceOf returns the UpstreamSource of the Artifactory upstream.
+func artifactorySourceOf(_ context.Context, u Upstream) (UpstreamSource, error) {
+	return artifactorySource{
+		registrySource: registrySource{
+			host: Host(u.Hostname),
+			endpoints: map[string]url.URL{
+				"providers.v1": artifactoryEndpoint(u, "providers"),
+				"modules.v1":   artifactoryEndpoint(u, "modules"),
+			},
+		},
+		upstream: u,
+	}, nil
+}
+
+func (s artifactorySource) GetVersions(ctx context.Context, namespace, type_ string, since ...time.Time) ([]byte, error) {
+	return s.registrySource.GetVersions(ctx,
+		artifactoryNamespace(s.upstream, namespace), type_, since...)
+}
+
+func (s artifactorySource) GetPlatform(
+	ctx context.Context,
+	namespace, type_, version, os, arch string,
+	since ...time.Time,
+) ([]byte, error) {
+	return s.registrySource.GetPlatform(ctx,
+		artifactoryNamespace(s.upstream, namespace), type_, version, os, arch, since...)
+}
+
+func (s artifactorySource) GetModuleVersions(
+	ctx context.Context,
+	namespace, name, system string,
+	since ...time.Time,
+) ([]byte, error) {
+	return s.registrySource.GetModuleVersions(ctx,
+		artifactoryNamespace(s.upstream, namespace), name, system, since...)
+}
+
+func (s artifactorySource) GetModuleVersion(
+	ctx context.Context,
+	namespace, name, system, version string,
+	since ...time.Time,
+) ([]byte, error) {
+	return s.registrySource.GetModuleVersion(ctx,
+		artifactoryNamespace(s.upstream, namespace), name, system, version, since...)
+}
@@ -0,0 +1,108 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/seal-io/walrus/utils/log"
+)
+
+// ClockSkewThreshold is the tolerance of the clock skew between local and the upstream,
+// the conditional fetching with If-Modified-Since is unreliable beyond it.
+const ClockSkewThreshold = time.Minute
+
+var clockSkew = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Namespace: "registry",
+		Name:      "clock_skew_seconds",
+		Help:      "The clock skew in seconds between local and the upstream, positive means local is ahead.",
+	},
+	[]string{"hostname"},
+)
+
+// NewClockSkewCollector returns the collector of the clock skew.
+func NewClockSkewCollector() prometheus.Collector {
+	return clockSkew
+}
+
+// CheckClockSkew measures the clock skew against the Date header of the registry upstreams,
+// warns if the skew exceeds ClockSkewThreshold.
+func CheckClockSkew(ctx context.Context) error {
+	logger := log.WithName("registry")
+
+	for _, h := range clockSkewHosts() {
+		d, err := MeasureClockSkew(ctx, h)
+		if err != nil {
+			logger.Debugf("error measuring clock skew of %s: %v", h, err)
+			continue
+		}
+
+		clockSkew.WithLabelValues(h).Set(d.Seconds())
+
+		if d > ClockSkewThreshold || d < -ClockSkewThreshold {
+			logger.Warnf("clock skew of %s is %v, which disables the conditional fetching, "+
+				"please synchronize the local clock", h, d.Round(time.Second))
+		}
+	}
+
+	return nil
+}
+
+// MeasureClockSkew returns the clock skew between local and the given hostname,
+// positive means local is ahead.
+func MeasureClockSkew(ctx context.Context, hostname string) (time.Duration, error) {
+	u := &url.URL{
+		Scheme: "https",
+		Host:   hostname,
+	}
+
+	start := time.Now()
+	r := newRequest(u).
+		HeadWithContext(ctx, resolveURLString(u, "/.well-known/terraform.json"))
+	rtt := time.Since(start)
+
+	// Any response carries the Date header, even not 2xx.
+	date := r.Header("Date")
+	if date == "" {
+		if err := r.Error(); err != nil {
+			return 0, err
+		}
+
+		return 0, errors.New("blank date header")
+	}
+
+	remote, err := http.ParseTime(date)
+	if err != nil {
+		return 0, err
+	}
+
+	// Assume the Date header is generated at the middle of the round trip.
+	return start.Add(rtt / 2).Sub(remote), nil
+}
+
+// clockSkewHosts returns the hostnames of the upstreams that support conditional fetching.
+func clockSkewHosts() []string {
+	hs := map[string]struct{}{
+		"registry.terraform.io": {},
+	}
+
+	for _, us := range config.Get().Upstreams {
+		if us.Kind == UpstreamKindRegistry {
+			hs[us.Hostname] = struct{}{}
+		}
+	}
+
+	r := make([]string, 0, len(hs))
+	for h := range hs {
+		r = append(r, h)
+	}
+
+	sort.Strings(r)
+
+	return r
+}
@@ -0,0 +1,87 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/seal-io/walrus/utils/json"
+)
+
+// Credentials holds the API token of each registry hostname,
+// which is compatible with the credentials of Terraform CLI.
+// See https://developer.hashicorp.com/terraform/cli/config/config-file#credentials.
+type Credentials map[string]string
+
+// LoadCredentials loads the credentials from the given file,
+// the file is in the same format as the one generated by `terraform login`.
+//
+// File example:
+//
+//	{
+//	  "credentials": {
+//	    "app.terraform.io": {
+//	      "token": "xxxxxx.atlasv1.zzzzzzzzzzzzz"
+//	    }
+//	  }
+//	}
+//
+// Returns empty credentials if the given file is blank.
+func LoadCredentials(file string) (Credentials, error) {
+	if file == "" {
+		return Credentials{}, nil
+	}
+
+	bs, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading credentials file: %w", err)
+	}
+
+	var cf struct {
+		Credentials map[string]struct {
+			Token string `json:"token"`
+		} `json:"credentials"`
+	}
+
+	if err = json.Unmarshal(bs, &cf); err != nil {
+		return nil, fmt.Errorf("error unmarshaling credentials file: %w", err)
+	}
+
+	cs := make(Credentials, len(cf.Credentials))
+
+	for h, c := range cf.Credentials {
+		if c.Token == "" {
+			return nil, errors.New("invalid credentials: blank token of " + h)
+		}
+
+		cs[strings.ToLower(h)] = c.Token
+	}
+
+	return cs, nil
+}
+
+// Token returns the token of the given hostname,
+// the TF_TOKEN_... environment variable takes precedence over the loaded credentials.
+// See https://developer.hashicorp.com/terraform/cli/config/config-file#environment-variable-credentials.
+func (c Credentials) Token(host string) string {
+	host = strings.ToLower(host)
+
+	if t := os.Getenv(tokenEnvName(host)); t != "" {
+		return t
+	}
+
+	return c[host]
+}
+
+// tokenEnvName returns the environment variable name of the given hostname,
+// periods are encoded as underscores, and hyphens are encoded as double underscores.
+func tokenEnvName(host string) string {
+	r := strings.NewReplacer(".", "_", "-", "__", ":", "_")
+	return "TF_TOKEN_" + r.Replace(host)
+}
+
+// Token returns the configured API token of the given host.
+func Token(host string) string {
+	return config.Get().Credentials.Token(host)
+}
@@ -0,0 +1,215 @@
+package registry
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadCredentials(t *testing.T) {
+	write := func(content string) string {
+		p := filepath.Join(t.TempDir(), "credentials.tfrc.json")
+		require.NoError(t, os.WriteFile(p, []byte(content), 0o600))
+
+		return p
+	}
+
+	testCases := []struct {
+		name     string
+		given    string
+		expected Credentials
+		wantErr  bool
+	}{
+		{
+			name:     "blank file",
+			given:    "",
+			expected: Credentials{},
+		},
+		{
+			name: "terraform login",
+			given: write(`{
+  "credentials": {
+    "app.terraform.io": {"token": "xxxxxx.atlasv1.zzzzzzzzzzzzz"},
+    "TFE.Example.COM": {"token": "tfe"}
+  }
+}`),
+			expected: Credentials{
+				"app.terraform.io": "xxxxxx.atlasv1.zzzzzzzzzzzzz",
+				"tfe.example.com":  "tfe",
+			},
+		},
+		{
+			name:     "no credentials",
+			given:    write(`{}`),
+			expected: Credentials{},
+		},
+		{
+			name:    "blank token",
+			given:   write(`{"credentials": {"app.terraform.io": {"token": ""}}}`),
+			wantErr: true,
+		},
+		{
+			name:    "malformed",
+			given:   write(`credentials "app.terraform.io" { token = "xxx" }`),
+			wantErr: true,
+		},
+		{
+			name:    "not found",
+			given:   filepath.Join(t.TempDir(), "not-found.tfrc.json"),
+			wantErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, err := LoadCredentials(tc.given)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
+
+func TestCredentials_Token(t *testing.T) {
+	cs := Credentials{
+		"app.terraform.io": "from-file",
+		"tfe.example.com":  "from-file",
+	}
+
+	testCases := []struct {
+		name     string
+		host     string
+		env      string
+		expected string
+	}{
+		{
+			name:     "dots",
+			host:     "tfe.example.com",
+			env:      "TF_TOKEN_tfe_example_com",
+			expected: "from-env",
+		},
+		{
+			name:     "dashes",
+			host:     "my-registry.example.com",
+			env:      "TF_TOKEN_my__registry_example_com",
+			expected: "from-env",
+		},
+		{
+			name:     "punycode",
+			host:     "xn--caf-dma.example.com",
+			env:      "TF_TOKEN_xn____caf__dma_example_com",
+			expected: "from-env",
+		},
+		{
+			name:     "port",
+			host:     "localhost:8443",
+			env:      "TF_TOKEN_localhost_8443",
+			expected: "from-env",
+		},
+		{
+			name:     "case-insensitive host",
+			host:     "TFE.Example.com",
+			env:      "TF_TOKEN_tfe_example_com",
+			expected: "from-env",
+		},
+		{
+			name:     "fallback to file",
+			host:     "App.Terraform.io",
+			expected: "from-file",
+		},
+		{
+			name:     "none",
+			host:     "registry.terraform.io",
+			expected: "",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.env != "" {
+				t.Setenv(tc.env, "from-env")
+			}
+
+			assert.Equal(t, tc.expected, cs.Token(tc.host))
+		})
+	}
+}
+
+func TestAuthHeaders(t *testing.T) {
+	cfg := config.Get()
+
+	// Register the credentials and the upstreams of the test hosts only.
+	for h, u := range map[string]Upstream{
+		"gitlab-job.example.com":      {Kind: UpstreamKindGitLab, Options: map[string]string{"token-type": "job"}},
+		"gitlab-private.example.com":  {Kind: UpstreamKindGitLab, Options: map[string]string{"token-type": "private"}},
+		"gitlab.example.com":          {Kind: UpstreamKindGitLab, Options: map[string]string{}},
+		"artifactory-key.example.com": {Kind: UpstreamKindArtifactory, Options: map[string]string{"token-type": "api-key"}},
+		"artifactory.example.com":     {Kind: UpstreamKindArtifactory, Options: map[string]string{}},
+		"registry.example.com":        {Kind: UpstreamKindRegistry, Options: map[string]string{"token-type": "job"}},
+	} {
+		h := h
+		u.Hostname = h
+		cfg.Upstreams[h] = u
+		cfg.Credentials[h] = "token"
+
+		t.Cleanup(func() {
+			delete(cfg.Upstreams, h)
+			delete(cfg.Credentials, h)
+		})
+	}
+
+	cfg.Credentials["tfe.example.com"] = "token"
+	t.Cleanup(func() { delete(cfg.Credentials, "tfe.example.com") })
+
+	testCases := []struct {
+		host     string
+		expected map[string]string
+	}{
+		{
+			host:     "gitlab-job.example.com",
+			expected: map[string]string{"JOB-TOKEN": "token"},
+		},
+		{
+			host:     "gitlab-private.example.com",
+			expected: map[string]string{"PRIVATE-TOKEN": "token"},
+		},
+		{
+			host:     "gitlab.example.com",
+			expected: map[string]string{"Authorization": "Bearer token"},
+		},
+		{
+			host:     "artifactory-key.example.com",
+			expected: map[string]string{"X-JFrog-Art-Api": "token"},
+		},
+		{
+			host:     "artifactory.example.com",
+			expected: map[string]string{"Authorization": "Bearer token"},
+		},
+		{
+			host:     "registry.example.com",
+			expected: map[string]string{"Authorization": "Bearer token"},
+		},
+		{
+			host:     "tfe.example.com",
+			expected: map[string]string{"Authorization": "Bearer token"},
+		},
+		{
+			host:     "anonymous.example.com",
+			expected: nil,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.host, func(t *testing.T) {
+			assert.Equal(t, tc.expected, AuthHeaders(tc.host))
+		})
+	}
+
+	// The token of the environment variable is mapped as well.
+	t.Setenv("TF_TOKEN_gitlab__job_example_com", "from-env")
+	assert.Equal(t, map[string]string{"JOB-TOKEN": "from-env"}, AuthHeaders("gitlab-job.example.com"))
+}
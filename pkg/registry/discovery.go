@@ -0,0 +1,317 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/seal-io/walrus/utils/errorx"
+	"github.com/seal-io/walrus/utils/json"
+	"github.com/seal-io/walrus/utils/log"
+	"github.com/seal-io/walrus/utils/vars"
+	bolt "go.etcd.io/bbolt"
+	"golang.org/x/sync/singleflight"
+
+	"github.com/seal-io/hermitcrab/pkg/database"
+	"github.com/seal-io/hermitcrab/pkg/tunable"
+)
+
+// DefaultDiscoveryTTL is the default duration of caching the discovery document before re-fetching.
+const DefaultDiscoveryTTL = time.Hour
+
+// discoveryRetryInterval is the interval of re-fetching the discovery document after failed,
+// the stale document or the last error is served in the meantime.
+const discoveryRetryInterval = time.Minute
+
+// Discovery holds the discovery document of a registry hostname,
+// see https://developer.hashicorp.com/terraform/internals/remote-service-discovery.
+type Discovery struct {
+	Hostname string `json:"hostname"`
+	// Services holds the service endpoints indexing by the service type, i.e. providers.v1.
+	Services map[string]string `json:"services"`
+	// Fetched is the time of the last successful fetching, zero if never fetched or overridden.
+	Fetched time.Time `json:"fetched,omitempty"`
+	// Override indicates the document is specified by the administrator,
+	// which is never fetched from the upstream until deleted.
+	Override bool `json:"override,omitempty"`
+	// Error is the error of the last failed fetching,
+	// blank if the last fetching succeeded.
+	Error   string    `json:"error,omitempty"`
+	Errored time.Time `json:"errored,omitempty"`
+}
+
+// ConfigureDiscoveryOptions holds the options of configuring the discovery caching.
+type ConfigureDiscoveryOptions struct {
+	// BoltDriver persists the discovery documents if specified,
+	// otherwise, the documents are only cached in memory.
+	BoltDriver database.BoltDriver
+	// TTL is the duration of caching the discovery document before re-fetching,
+	// default is DefaultDiscoveryTTL.
+	TTL time.Duration
+}
+
+// discoveryDomain is the bucket of the discovery documents,
+// takes a look of the bucket structure:
+//
+//	BUCKET(registry_discoveries)
+//	  KEY({hostname}): Discovery
+const discoveryDomain = "registry_discoveries"
+
+var (
+	discoveryConfig = vars.NewSetOnce(ConfigureDiscoveryOptions{
+		TTL: DefaultDiscoveryTTL,
+	})
+
+	discoveries sync.Map
+
+	discoveryFetches singleflight.Group
+)
+
+// ConfigureDiscovery configures the discovery caching,
+// it can only be called once.
+func ConfigureDiscovery(opts ConfigureDiscoveryOptions) error {
+	if opts.TTL <= 0 {
+		opts.TTL = DefaultDiscoveryTTL
+	}
+
+	if opts.BoltDriver != nil {
+		err := opts.BoltDriver.Update(func(tx *bolt.Tx) error {
+			_, err := tx.CreateBucketIfNotExists([]byte(discoveryDomain))
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("error creating discovery bucket: %w", err)
+		}
+	}
+
+	discoveryConfig.Set(opts)
+
+	return nil
+}
+
+// Discovery returns the discovery document of the host,
+// which is fetched from the upstream if not cached or expired,
+// the stale document is returned if failed to fetch.
+func (h Host) Discovery(ctx context.Context) (Discovery, error) {
+	hostname := strings.ToLower(string(h))
+
+	// Fetch the same hostname only once at the same time.
+	ch := discoveryFetches.DoChan(hostname, func() (any, error) {
+		return discover(context.WithoutCancel(ctx), hostname)
+	})
+
+	select {
+	case <-ctx.Done():
+		d, _ := loadDiscovery(hostname)
+		return d, ctx.Err()
+	case r := <-ch:
+		return r.Val.(Discovery), r.Err
+	}
+}
+
+// discover returns the cached discovery document of the given hostname,
+// or fetches from the upstream if not cached or expired.
+func discover(ctx context.Context, hostname string) (Discovery, error) {
+	ttl := tunable.Get().DiscoveryTTL.Std()
+	if ttl <= 0 {
+		ttl = discoveryConfig.Get().TTL
+	}
+
+	d, cached := loadDiscovery(hostname)
+	if cached && (d.Override || time.Since(d.Fetched) < ttl) {
+		return d, nil
+	}
+
+	if cached && d.Error != "" && time.Since(d.Errored) < discoveryRetryInterval {
+		if d.Fetched.IsZero() {
+			return d, fmt.Errorf("error fetching discovery document: %s", d.Error)
+		}
+
+		return d, nil
+	}
+
+	u := &url.URL{
+		Scheme: "https",
+		Host:   hostname,
+	}
+	b := map[string]string{}
+
+	err := newRequest(u).
+		GetWithContext(ctx, resolveURLString(u, "/.well-known/terraform.json")).
+		BodyJSON(&b)
+	if err != nil {
+		d.Hostname = hostname
+		d.Error = err.Error()
+		d.Errored = time.Now()
+
+		// Keep the error visible in memory only,
+		// so that the persistence only holds the resolved documents.
+		discoveries.Store(hostname, d)
+
+		if d.Fetched.IsZero() {
+			return d, fmt.Errorf("error fetching discovery document: %w", err)
+		}
+
+		log.WithName("registry").
+			Warnf("serving stale discovery document of %s fetched at %s: %v",
+				hostname, d.Fetched.Format(time.RFC3339), err)
+
+		return d, nil
+	}
+
+	d = Discovery{
+		Hostname: hostname,
+		Services: b,
+		Fetched:  time.Now(),
+	}
+	_ = storeDiscovery(d)
+
+	return d, nil
+}
+
+// GetDiscovery returns the cached discovery document of the given hostname without fetching.
+func GetDiscovery(hostname string) (Discovery, error) {
+	d, ok := loadDiscovery(strings.ToLower(hostname))
+	if !ok {
+		return Discovery{}, errorx.HttpErrorf(http.StatusNotFound, "discovery of %s is not cached", hostname)
+	}
+
+	return d, nil
+}
+
+// ListDiscoveries returns the cached discovery documents in hostname order,
+// the ones in memory take precedence over the persisted ones.
+func ListDiscoveries() ([]Discovery, error) {
+	ds := make([]Discovery, 0)
+	listed := map[string]struct{}{}
+
+	discoveries.Range(func(_, v any) bool {
+		d := v.(Discovery)
+		ds = append(ds, d)
+		listed[d.Hostname] = struct{}{}
+
+		return true
+	})
+
+	if bd := discoveryConfig.Get().BoltDriver; bd != nil {
+		err := bd.View(func(tx *bolt.Tx) error {
+			return tx.Bucket([]byte(discoveryDomain)).ForEach(func(_, v []byte) error {
+				var d Discovery
+				if json.Unmarshal(v, &d) != nil {
+					return nil
+				}
+
+				if _, ok := listed[d.Hostname]; !ok {
+					ds = append(ds, d)
+				}
+
+				return nil
+			})
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error listing discoveries: %w", err)
+		}
+	}
+
+	sort.Slice(ds, func(i, j int) bool {
+		return ds[i].Hostname < ds[j].Hostname
+	})
+
+	return ds, nil
+}
+
+// OverrideDiscovery overrides the discovery document of the given hostname with the given services,
+// the overridden document is never fetched from the upstream until deleted.
+func OverrideDiscovery(hostname string, services map[string]string) (Discovery, error) {
+	hostname = strings.ToLower(hostname)
+	if hostname == "" || len(services) == 0 {
+		return Discovery{}, errors.New("invalid discovery")
+	}
+
+	d := Discovery{
+		Hostname: hostname,
+		Services: services,
+		Override: true,
+	}
+
+	return d, storeDiscovery(d)
+}
+
+// DeleteDiscovery deletes the cached or overridden discovery document of the given hostname,
+// which is fetched from the upstream again on the next discovering.
+func DeleteDiscovery(hostname string) error {
+	hostname = strings.ToLower(hostname)
+
+	discoveries.Delete(hostname)
+
+	bd := discoveryConfig.Get().BoltDriver
+	if bd == nil {
+		return nil
+	}
+
+	return bd.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(discoveryDomain)).Delete([]byte(hostname))
+	})
+}
+
+// loadDiscovery loads the discovery document of the given hostname from the memory,
+// or the persistence if not loaded yet.
+func loadDiscovery(hostname string) (Discovery, bool) {
+	if v, ok := discoveries.Load(hostname); ok {
+		return v.(Discovery), true
+	}
+
+	bd := discoveryConfig.Get().BoltDriver
+	if bd == nil {
+		return Discovery{}, false
+	}
+
+	var (
+		d     Discovery
+		found bool
+	)
+
+	_ = bd.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket([]byte(discoveryDomain)).Get([]byte(hostname))
+		found = len(v) != 0 && json.Unmarshal(v, &d) == nil
+
+		return nil
+	})
+
+	if found {
+		discoveries.Store(hostname, d)
+	}
+
+	return d, found
+}
+
+// storeDiscovery stores the given discovery document into the memory and the persistence.
+func storeDiscovery(d Discovery) error {
+	discoveries.Store(d.Hostname, d)
+
+	bd := discoveryConfig.Get().BoltDriver
+	if bd == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+
+	err = bd.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(discoveryDomain)).Put([]byte(d.Hostname), data)
+	})
+	if err != nil {
+		log.WithName("registry").
+			Warnf("error persisting discovery document of %s: %v", d.Hostname, err)
+	}
+
+	return err
+}
@@ -0,0 +1,162 @@
+package registry
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHost_Discovery_stale(t *testing.T) {
+	// Reserve a port refusing the connection.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hostname := ln.Addr().String()
+	_ = ln.Close()
+
+	services := map[string]string{"providers.v1": "/v1/providers/"}
+
+	err = storeDiscovery(Discovery{
+		Hostname: hostname,
+		Services: services,
+		Fetched:  time.Now().Add(-2 * DefaultDiscoveryTTL),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { _ = DeleteDiscovery(hostname) })
+
+	d, err := Host(hostname).Discovery(context.Background())
+	if err != nil {
+		t.Fatalf("expected stale discovery served, got error: %v", err)
+	}
+
+	if d.Services["providers.v1"] != "/v1/providers/" {
+		t.Errorf("unexpected services: %v", d.Services)
+	}
+
+	if d.Error == "" || d.Errored.IsZero() {
+		t.Error("expected fetching error recorded")
+	}
+
+	u := Host(hostname).Discover(context.Background(), "providers.v1")
+	if u.Path != "/v1/providers/" {
+		t.Errorf("expected stale endpoint discovered, got %s", u.String())
+	}
+
+	// Overridden discovery is never fetched.
+	_, err = OverrideDiscovery(hostname, map[string]string{"providers.v1": "/override/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, err = Host(hostname).Discovery(context.Background())
+	if err != nil || !d.Override || d.Services["providers.v1"] != "/override/" || d.Error != "" {
+		t.Errorf("expected overridden discovery, got %+v, %v", d, err)
+	}
+
+	// Deleted discovery without cache fails to fetch.
+	if err = DeleteDiscovery(hostname); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = Host(hostname).Discovery(context.Background()); err == nil {
+		t.Error("expected error fetching uncached discovery")
+	}
+}
+
+func TestHost_Discovery_negative(t *testing.T) {
+	// Reserve a port holding the connection until released.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		accepted atomic.Int32
+		release  = make(chan struct{})
+	)
+
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+
+			accepted.Add(1)
+
+			go func() {
+				<-release
+				_ = c.Close()
+			}()
+		}
+	}()
+
+	hostname := ln.Addr().String()
+	t.Cleanup(func() { _ = DeleteDiscovery(hostname) })
+
+	// Fetch once for the concurrent discovering.
+	var wg sync.WaitGroup
+
+	errs := make([]error, 4)
+	for i := range errs {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			_, errs[i] = Host(hostname).Discovery(context.Background())
+		}(i)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	_ = ln.Close()
+	close(release)
+	wg.Wait()
+
+	for i := range errs {
+		if errs[i] == nil {
+			t.Fatal("expected error fetching unresolvable discovery")
+		}
+	}
+
+	if n := accepted.Load(); n != 1 {
+		t.Fatalf("expected the upstream fetched once, got %d", n)
+	}
+
+	// Serve the error in memory until the retry interval passed.
+	d, err := Host(hostname).Discovery(context.Background())
+	if err == nil || d.Error == "" || !d.Fetched.IsZero() {
+		t.Errorf("expected the error served, got %+v, %v", d, err)
+	}
+
+	if accepted.Load() != 1 {
+		t.Error("expected the upstream not re-fetched within the retry interval")
+	}
+
+	// Only the resolved documents are listed from the persistence,
+	// the failed one is listed from the memory.
+	ds, err := ListDiscoveries()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var listed bool
+
+	for i := range ds {
+		if ds[i].Hostname == hostname {
+			listed = ds[i].Error != ""
+		}
+	}
+
+	if !listed {
+		t.Error("expected the failed discovery listed with the error")
+	}
+}
@@ -0,0 +1,47 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// DocsSource is implemented by the UpstreamSource serving the provider documentation,
+// which is out of the registry protocol.
+type DocsSource interface {
+	// GetDocs fetches the given path of the registry v2 API with the given query,
+	// i.e. providers/hashicorp/aws, provider-versions/12345 and provider-docs/67890.
+	GetDocs(ctx context.Context, p string, query url.Values) ([]byte, error)
+}
+
+// ErrDocsNotFound is returned if the requested documentation is not found in the upstream.
+var ErrDocsNotFound = errors.New("documentation not found")
+
+// GetDocs fetches the given path of the registry v2 API with the given query,
+// the endpoint is https://<HOSTNAME>/v2/ if not specified by the `docs.v2` option.
+// See https://registry.terraform.io/v2/providers/hashicorp/aws?include=provider-versions.
+func (s registrySource) GetDocs(ctx context.Context, p string, query url.Values) ([]byte, error) {
+	d, ok := s.endpoints["docs.v2"]
+	if !ok {
+		d = url.URL{
+			Scheme: "https",
+			Host:   string(s.host),
+			Path:   "/v2/",
+		}
+	}
+
+	u := resolveURL(&d, strings.TrimPrefix(p, "/"))
+	u.RawQuery = query.Encode()
+
+	r := observeRateLimit(string(s.host), newRequest(u).
+		WithHeader("Accept", "application/vnd.api+json").
+		GetWithContext(ctx, u.String()))
+
+	if r.StatusCode() == http.StatusNotFound {
+		return nil, ErrDocsNotFound
+	}
+
+	return r.BodyBytes()
+}
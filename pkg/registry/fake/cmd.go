@@ -0,0 +1,104 @@
+package fake
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/seal-io/walrus/utils/log"
+	"github.com/urfave/cli/v2"
+)
+
+// Command returns the `dev-registry` command to serve the fake registry.
+func Command() *cli.Command {
+	var (
+		bindAddress = "127.0.0.1:8080"
+		opts        Options
+	)
+
+	return &cli.Command{
+		Name:  "dev-registry",
+		Usage: "Serve an in-memory provider registry for testing and demo without internet access.",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:        "bind-address",
+				Usage:       "The address to serve the fake registry with plain HTTP.",
+				Destination: &bindAddress,
+				Value:       bindAddress,
+			},
+			&cli.StringSliceFlag{
+				Name: "providers",
+				Usage: "The providers to serve, in form of <NAMESPACE>/<TYPE>:<VERSION>[,<VERSION>...], " +
+					"i.e. hashicorp/null:3.2.1,3.2.2.",
+				Action: func(c *cli.Context, v []string) error {
+					ps := make([]Provider, 0, len(v))
+
+					for i := range v {
+						p, err := ParseProvider(v[i])
+						if err != nil {
+							return fmt.Errorf("--providers: %w", err)
+						}
+
+						ps = append(ps, p)
+					}
+					opts.Providers = ps
+
+					return nil
+				},
+			},
+			&cli.DurationFlag{
+				Name:        "latency",
+				Usage:       "The delay before responding each request.",
+				Destination: &opts.Latency,
+				Value:       opts.Latency,
+			},
+			&cli.Float64Flag{
+				Name:  "failure-rate",
+				Usage: "The probability in [0, 1] of responding 503.",
+				Action: func(c *cli.Context, f float64) error {
+					if f < 0 || f > 1 {
+						return errors.New("--failure-rate: must be in [0, 1]")
+					}
+
+					return nil
+				},
+				Destination: &opts.FailureRate,
+				Value:       opts.FailureRate,
+			},
+		},
+		Action: func(c *cli.Context) error {
+			return Serve(c.Context, bindAddress, opts)
+		},
+	}
+}
+
+// Serve serves the fake registry until the given context canceled.
+func Serve(ctx context.Context, bindAddress string, opts Options) error {
+	lis, err := net.Listen("tcp", bindAddress)
+	if err != nil {
+		return err
+	}
+
+	srv := &http.Server{
+		Handler:           New(opts),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		_ = srv.Close()
+	}()
+
+	log.WithName("registry").WithName("fake").
+		Infof("serving fake registry on http://%s", lis.Addr())
+
+	err = srv.Serve(lis)
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
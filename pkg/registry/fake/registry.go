@@ -0,0 +1,280 @@
+package fake
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/seal-io/walrus/utils/json"
+	"golang.org/x/exp/slices"
+)
+
+// Provider holds the provider served by the fake registry.
+type Provider struct {
+	Namespace string
+	Type      string
+	Versions  []string
+}
+
+// ParseProvider parses the given string into a Provider,
+// the string is in the format of `<NAMESPACE>/<TYPE>:<VERSION>[,<VERSION>...]`,
+// i.e. hashicorp/null:3.2.1,3.2.2.
+func ParseProvider(s string) (Provider, error) {
+	nt, vs, ok := strings.Cut(s, ":")
+	if !ok || vs == "" {
+		return Provider{}, errors.New("invalid provider: must be in <NAMESPACE>/<TYPE>:<VERSION> format")
+	}
+
+	n, t, ok := strings.Cut(nt, "/")
+	if !ok || n == "" || t == "" {
+		return Provider{}, errors.New("invalid provider: must be in <NAMESPACE>/<TYPE>:<VERSION> format")
+	}
+
+	return Provider{
+		Namespace: strings.ToLower(n),
+		Type:      strings.ToLower(t),
+		Versions:  strings.Split(vs, ","),
+	}, nil
+}
+
+// DefaultProviders is the providers served by the fake registry if not specified.
+var DefaultProviders = []Provider{
+	{Namespace: "hashicorp", Type: "null", Versions: []string{"3.2.1", "3.2.2"}},
+	{Namespace: "hashicorp", Type: "random", Versions: []string{"3.5.1", "3.6.0"}},
+}
+
+// DefaultPlatforms is the platforms of each provider version.
+var DefaultPlatforms = [][2]string{
+	{"darwin", "amd64"},
+	{"darwin", "arm64"},
+	{"linux", "amd64"},
+	{"linux", "arm64"},
+	{"windows", "amd64"},
+}
+
+// Options holds the options of the fake registry.
+type Options struct {
+	// Providers is the providers to serve, default is DefaultProviders.
+	Providers []Provider
+	// Latency is the delay before responding each request.
+	Latency time.Duration
+	// FailureRate is the probability in [0, 1] of responding 503.
+	FailureRate float64
+}
+
+// Registry is an in-memory registry implementing the provider registry protocol,
+// which serves the generated archives, for testing and demo without internet access.
+//
+//	GET /.well-known/terraform.json
+//	GET /v1/providers/{namespace}/{type}/versions
+//	GET /v1/providers/{namespace}/{type}/{version}/download/{os}/{arch}
+//	GET /archives/{filename}
+type Registry struct {
+	providers map[string]Provider
+	latency   time.Duration
+	failure   float64
+	modified  time.Time
+
+	archives sync.Map
+}
+
+// New returns a new fake registry.
+func New(opts Options) *Registry {
+	if len(opts.Providers) == 0 {
+		opts.Providers = DefaultProviders
+	}
+
+	ps := make(map[string]Provider, len(opts.Providers))
+	for _, p := range opts.Providers {
+		ps[path.Join(p.Namespace, p.Type)] = p
+	}
+
+	return &Registry{
+		providers: ps,
+		latency:   opts.Latency,
+		failure:   opts.FailureRate,
+		modified:  time.Now().UTC().Truncate(time.Second),
+	}
+}
+
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if r.latency > 0 {
+		select {
+		case <-req.Context().Done():
+			return
+		case <-time.After(r.latency):
+		}
+	}
+
+	if r.failure > 0 && rand.Float64() < r.failure { // nolint:gosec
+		http.Error(w, "injected failure", http.StatusServiceUnavailable)
+		return
+	}
+
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	p := req.URL.Path
+
+	switch {
+	case p == "/.well-known/terraform.json":
+		r.json(w, map[string]string{"providers.v1": "/v1/providers/"})
+	case strings.HasPrefix(p, "/v1/providers/"):
+		r.serveProviders(w, req, strings.Split(strings.TrimPrefix(p, "/v1/providers/"), "/"))
+	case strings.HasPrefix(p, "/archives/"):
+		r.serveArchive(w, strings.TrimPrefix(p, "/archives/"))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (r *Registry) serveProviders(w http.ResponseWriter, req *http.Request, ps []string) {
+	if len(ps) < 3 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	pv, ok := r.providers[path.Join(ps[0], ps[1])]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	// Support conditional requests.
+	if t, err := http.ParseTime(req.Header.Get("If-Modified-Since")); err == nil && !r.modified.After(t) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Last-Modified", r.modified.Format(http.TimeFormat))
+
+	switch {
+	case len(ps) == 3 && ps[2] == "versions":
+		vs := make([]map[string]any, 0, len(pv.Versions))
+
+		for _, v := range pv.Versions {
+			pfs := make([]map[string]string, 0, len(DefaultPlatforms))
+			for _, pf := range DefaultPlatforms {
+				pfs = append(pfs, map[string]string{"os": pf[0], "arch": pf[1]})
+			}
+
+			vs = append(vs, map[string]any{
+				"version":   v,
+				"protocols": []string{"5.0"},
+				"platforms": pfs,
+			})
+		}
+
+		r.json(w, map[string]any{"versions": vs})
+	case len(ps) == 6 && ps[3] == "download":
+		v, o, a := ps[2], ps[4], ps[5]
+		if !slices.Contains(pv.Versions, v) || !containsPlatform(o, a) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		fn := fmt.Sprintf("terraform-provider-%s_%s_%s_%s.zip", pv.Type, v, o, a)
+
+		r.json(w, map[string]any{
+			"protocols":    []string{"5.0"},
+			"os":           o,
+			"arch":         a,
+			"filename":     fn,
+			"download_url": "/archives/" + fn,
+			"shasum":       r.archive(fn).shasum,
+		})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (r *Registry) serveArchive(w http.ResponseWriter, fn string) {
+	var t, v, o, a string
+
+	// Parse terraform-provider-{type}_{version}_{os}_{arch}.zip.
+	ps := strings.Split(strings.TrimSuffix(strings.TrimPrefix(fn, "terraform-provider-"), ".zip"), "_")
+	if len(ps) == 4 {
+		t, v, o, a = ps[0], ps[1], ps[2], ps[3]
+	}
+
+	found := false
+
+	for _, pv := range r.providers {
+		if pv.Type == t && slices.Contains(pv.Versions, v) && containsPlatform(o, a) {
+			found = true
+			break
+		}
+	}
+
+	if !found {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	ar := r.archive(fn)
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Length", fmt.Sprint(len(ar.data)))
+	_, _ = w.Write(ar.data)
+}
+
+type archive struct {
+	data   []byte
+	shasum string
+}
+
+// archive returns the generated archive of the given filename,
+// which contains a fake provider binary.
+func (r *Registry) archive(fn string) archive {
+	if v, ok := r.archives.Load(fn); ok {
+		return v.(archive)
+	}
+
+	var buf bytes.Buffer
+
+	zw := zip.NewWriter(&buf)
+
+	f, _ := zw.CreateHeader(&zip.FileHeader{
+		Name:     strings.TrimSuffix(fn, ".zip"),
+		Method:   zip.Deflate,
+		Modified: r.modified,
+	})
+	_, _ = f.Write([]byte("#!/bin/sh\necho fake provider " + fn + "\n"))
+	_ = zw.Close()
+
+	sum := sha256.Sum256(buf.Bytes())
+	ar := archive{
+		data:   buf.Bytes(),
+		shasum: hex.EncodeToString(sum[:]),
+	}
+
+	v, _ := r.archives.LoadOrStore(fn, ar)
+
+	return v.(archive)
+}
+
+func (r *Registry) json(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func containsPlatform(os, arch string) bool {
+	for _, pf := range DefaultPlatforms {
+		if pf[0] == os && pf[1] == arch {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,336 @@
+package registry
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/seal-io/walrus/utils/json"
+
+	"github.com/seal-io/hermitcrab/pkg/download"
+)
+
+// The filesystem upstream serves the hand-curated provider archives from a local directory,
+// the directory specified by the `path` option is in the layout of:
+// {path}
+// └── {namespace}
+//  └── {type}
+//   ├── terraform-provider-{type}_{version}_{os}_{arch}.zip
+//   ├── terraform-provider-{type}_{version}_SHA256SUMS
+//   └── terraform-provider-{type}_{version}_manifest.json
+//
+// The SHA256SUMS and manifest.json files are optional,
+// the shasum is calculated from the archive if not found in the SHA256SUMS file,
+// and cached until the archive changes.
+
+type filesystemSource struct {
+	root string
+}
+
+// filesystemSourceOf returns the UpstreamSource of the filesystem upstream.
+func filesystemSourceOf(_ context.Context, u Upstream) (UpstreamSource, error) {
+	p := u.Options["path"]
+	if p == "" {
+		return nil, errors.New("path option: must be filled")
+	}
+
+	p, err := filepath.Abs(p)
+	if err != nil {
+		return nil, fmt.Errorf("path option: %w", err)
+	}
+
+	fi, err := os.Stat(p)
+	if err != nil {
+		return nil, fmt.Errorf("path option: %w", err)
+	}
+
+	if !fi.IsDir() {
+		return nil, errors.New("path option: must be a directory")
+	}
+
+	return filesystemSource{
+		root: p,
+	}, nil
+}
+
+// typedDir returns the directory of the given provider.
+func (s filesystemSource) typedDir(namespace, type_ string) string {
+	return filepath.Join(s.root, filepath.Clean("/"+namespace), filepath.Clean("/"+type_))
+}
+
+// listArchives lists the archives of the given provider,
+// returns nil if the given since is not zero and the directory has not modified since then.
+func (s filesystemSource) listArchives(namespace, type_ string, since ...time.Time) ([]Archive, error) {
+	d := s.typedDir(namespace, type_)
+
+	es, err := os.ReadDir(d)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []Archive{}, nil
+		}
+
+		return nil, fmt.Errorf("error reading directory: %w", err)
+	}
+
+	var (
+		fis      = make([]os.FileInfo, 0, len(es))
+		modified time.Time
+	)
+
+	for i := range es {
+		fi, err := es[i].Info()
+		if err != nil {
+			continue
+		}
+
+		fis = append(fis, fi)
+
+		if fi.ModTime().After(modified) {
+			modified = fi.ModTime()
+		}
+	}
+
+	if len(since) != 0 && !since[0].IsZero() && !modified.After(since[0]) {
+		return nil, nil
+	}
+
+	var (
+		as        = make([]Archive, 0, len(fis))
+		shasums   = map[string]map[string]string{}
+		protocols = map[string][]string{}
+	)
+
+	for _, fi := range fis {
+		if !fi.Mode().IsRegular() {
+			continue
+		}
+
+		v, o, a, ok := ParseArchiveFilename(type_, fi.Name())
+		if !ok {
+			continue
+		}
+
+		if _, ok := shasums[v]; !ok {
+			prefix := filepath.Join(d, "terraform-provider-"+type_+"_"+v)
+			shasums[v] = readShasums(prefix + "_SHA256SUMS")
+			protocols[v] = readProtocols(prefix + "_manifest.json")
+		}
+
+		ar, err := archiveOf(d, fi, shasums[v], protocols[v])
+		if err != nil {
+			return nil, err
+		}
+
+		ar.Version, ar.OS, ar.Arch = v, o, a
+		as = append(as, ar)
+	}
+
+	return as, nil
+}
+
+// archiveOf returns the Archive of the given archive file under the given directory,
+// the shasum is calculated from the archive if not found in the given shasums.
+func archiveOf(d string, fi os.FileInfo, shasums map[string]string, protocols []string) (Archive, error) {
+	n := fi.Name()
+	p := filepath.Join(d, n)
+
+	sum := shasums[n]
+	if sum == "" {
+		var err error
+
+		sum, err = cachedShasum(p, fi)
+		if err != nil {
+			return Archive{}, fmt.Errorf("error calculating shasum of %s: %w", n, err)
+		}
+	}
+
+	return Archive{
+		Filename:    n,
+		DownloadURL: (&url.URL{Scheme: "file", Path: filepath.ToSlash(p)}).String(),
+		Shasum:      sum,
+		Protocols:   protocols,
+	}, nil
+}
+
+func (s filesystemSource) GetVersions(_ context.Context, namespace, type_ string, since ...time.Time) ([]byte, error) {
+	as, err := s.listArchives(namespace, type_, since...)
+	if err != nil || as == nil {
+		return nil, err
+	}
+
+	return marshalVersions(as), nil
+}
+
+// GetPlatform reads the files of the given version only,
+// returns nil if the given since is not zero and none of them has modified since then.
+func (s filesystemSource) GetPlatform(
+	_ context.Context,
+	namespace, type_, version, os_, arch string,
+	since ...time.Time,
+) ([]byte, error) {
+	var (
+		d      = s.typedDir(namespace, type_)
+		prefix = filepath.Join(d, "terraform-provider-"+type_+"_"+version)
+		n      = "terraform-provider-" + type_ + "_" + version + "_" + os_ + "_" + arch + ".zip"
+	)
+
+	if v, o, a, ok := ParseArchiveFilename(type_, n); !ok || v != version || o != os_ || a != arch {
+		return []byte(`{}`), nil
+	}
+
+	fi, err := os.Stat(filepath.Join(d, n))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []byte(`{}`), nil
+		}
+
+		return nil, fmt.Errorf("error reading archive: %w", err)
+	}
+
+	if !fi.Mode().IsRegular() {
+		return []byte(`{}`), nil
+	}
+
+	if len(since) != 0 && !since[0].IsZero() {
+		modified := fi.ModTime()
+
+		for _, p := range []string{prefix + "_SHA256SUMS", prefix + "_manifest.json"} {
+			if pfi, err := os.Stat(p); err == nil && pfi.ModTime().After(modified) {
+				modified = pfi.ModTime()
+			}
+		}
+
+		if !modified.After(since[0]) {
+			return nil, nil
+		}
+	}
+
+	ar, err := archiveOf(d, fi, readShasums(prefix+"_SHA256SUMS"), readProtocols(prefix+"_manifest.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	ar.Version, ar.OS, ar.Arch = version, os_, arch
+
+	return marshalPlatform(ar), nil
+}
+
+func (s filesystemSource) GetModuleVersions(context.Context, string, string, string, ...time.Time) ([]byte, error) {
+	return nil, ErrUnsupported
+}
+
+func (s filesystemSource) GetModuleVersion(context.Context, string, string, string, string, ...time.Time) ([]byte, error) {
+	return nil, ErrUnsupported
+}
+
+// readShasums reads the SHA256SUMS file into a map indexing by the filename,
+// returns an empty map if failed.
+func readShasums(p string) map[string]string {
+	m := map[string]string{}
+
+	f, err := os.Open(p)
+	if err != nil {
+		return m
+	}
+
+	defer func() { _ = f.Close() }()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fs := strings.Fields(sc.Text())
+		if len(fs) != 2 {
+			continue
+		}
+
+		m[strings.TrimPrefix(fs[1], "*")] = fs[0]
+	}
+
+	return m
+}
+
+// readProtocols reads the protocols from the manifest file generated by GoReleaser,
+// returns nil if failed.
+func readProtocols(p string) []string {
+	bs, err := os.ReadFile(p)
+	if err != nil {
+		return nil
+	}
+
+	var ps []string
+
+	for _, r := range json.Get(bs, "metadata.protocol_versions").Array() {
+		ps = append(ps, r.String())
+	}
+
+	return ps
+}
+
+// calculatedShasum holds the calculated shasum of an archive,
+// along with the size and the modified time of the archive at calculating.
+type calculatedShasum struct {
+	size     int64
+	modified time.Time
+	sum      string
+}
+
+// calculatedShasums caches the calculated shasums of the archives indexing by the path.
+var calculatedShasums sync.Map
+
+// cachedShasum returns the shasum of the given archive,
+// which is calculated again only if the size or the modified time of the archive changes.
+func cachedShasum(p string, fi os.FileInfo) (string, error) {
+	if v, ok := calculatedShasums.Load(p); ok {
+		c := v.(calculatedShasum)
+		if c.size == fi.Size() && c.modified.Equal(fi.ModTime()) {
+			return c.sum, nil
+		}
+	}
+
+	sum, err := download.Shasum(p)
+	if err != nil {
+		return "", err
+	}
+
+	calculatedShasums.Store(p, calculatedShasum{
+		size:     fi.Size(),
+		modified: fi.ModTime(),
+		sum:      sum,
+	})
+
+	return sum, nil
+}
+
+// LocalArchivePath returns the local path of the given download URL,
+// returns false if the URL is not an archive of the filesystem upstreams.
+func LocalArchivePath(rawURL string) (string, bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "file" {
+		return "", false
+	}
+
+	p := filepath.Clean(filepath.FromSlash(u.Path))
+
+	for _, us := range config.Get().Upstreams {
+		if us.Kind != UpstreamKindFilesystem || us.Options["path"] == "" {
+			continue
+		}
+
+		r, err := filepath.Abs(us.Options["path"])
+		if err != nil {
+			continue
+		}
+
+		if strings.HasPrefix(p, r+string(filepath.Separator)) {
+			return p, true
+		}
+	}
+
+	return "", false
+}
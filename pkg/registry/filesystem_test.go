@@ -0,0 +1,122 @@
+package registry
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/seal-io/walrus/utils/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilesystemSource(t *testing.T) {
+	root := t.TempDir()
+	d := filepath.Join(root, "hashicorp", "null")
+	require.NoError(t, os.MkdirAll(d, 0o700))
+
+	modified := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	write := func(n, content string) string {
+		p := filepath.Join(d, n)
+		require.NoError(t, os.WriteFile(p, []byte(content), 0o600))
+		require.NoError(t, os.Chtimes(p, modified, modified))
+
+		return p
+	}
+
+	sumOf := func(content string) string {
+		sum := sha256.Sum256([]byte(content))
+		return hex.EncodeToString(sum[:])
+	}
+
+	write("terraform-provider-null_1.0.0_linux_amd64.zip", "1.0.0 linux")
+	write("terraform-provider-null_1.0.0_SHA256SUMS",
+		"listed  terraform-provider-null_1.0.0_linux_amd64.zip\n")
+	write("terraform-provider-null_1.0.0_manifest.json",
+		`{"metadata":{"protocol_versions":["6.0"]}}`)
+	darwin := write("terraform-provider-null_1.0.0_darwin_arm64.zip", "1.0.0 darwin")
+	other := write("terraform-provider-null_2.0.0_linux_amd64.zip", "2.0.0 linux")
+
+	src, err := filesystemSourceOf(context.Background(), Upstream{
+		Kind:    UpstreamKindFilesystem,
+		Options: map[string]string{"path": root},
+	})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+
+	t.Run("versions", func(t *testing.T) {
+		bs, err := src.GetVersions(ctx, "hashicorp", "null")
+		require.NoError(t, err)
+
+		vs := json.Get(bs, "versions")
+		assert.Equal(t, int64(2), vs.Get("#").Int())
+		assert.Equal(t, `["6.0"]`, vs.Get(`#(version=="1.0.0").protocols`).Raw)
+		assert.Equal(t, `["5.0"]`, vs.Get(`#(version=="2.0.0").protocols`).Raw)
+
+		bs, err = src.GetVersions(ctx, "hashicorp", "null", modified)
+		require.NoError(t, err)
+		assert.Nil(t, bs, "not modified since")
+	})
+
+	t.Run("platform", func(t *testing.T) {
+		calculatedShasums.Delete(other)
+
+		bs, err := src.GetPlatform(ctx, "hashicorp", "null", "1.0.0", "linux", "amd64")
+		require.NoError(t, err)
+		assert.Equal(t, "listed", json.Get(bs, "shasum").String())
+		assert.Equal(t, `["6.0"]`, json.Get(bs, "protocols").Raw)
+
+		bs, err = src.GetPlatform(ctx, "hashicorp", "null", "1.0.0", "darwin", "arm64")
+		require.NoError(t, err)
+		assert.Equal(t, sumOf("1.0.0 darwin"), json.Get(bs, "shasum").String())
+
+		_, ok := calculatedShasums.Load(other)
+		assert.False(t, ok, "the archives of the other versions must not be read")
+
+		bs, err = src.GetPlatform(ctx, "hashicorp", "null", "1.0.0", "windows", "amd64")
+		require.NoError(t, err)
+		assert.Equal(t, "{}", string(bs))
+
+		bs, err = src.GetPlatform(ctx, "hashicorp", "null", "../1.0.0", "linux", "amd64")
+		require.NoError(t, err)
+		assert.Equal(t, "{}", string(bs))
+
+		bs, err = src.GetPlatform(ctx, "hashicorp", "null", "1.0.0", "darwin", "arm64", modified)
+		require.NoError(t, err)
+		assert.Nil(t, bs, "not modified since")
+
+		// Modified along with the shasums of the version.
+		later := modified.Add(time.Minute)
+		require.NoError(t, os.Chtimes(filepath.Join(d, "terraform-provider-null_1.0.0_SHA256SUMS"), later, later))
+
+		bs, err = src.GetPlatform(ctx, "hashicorp", "null", "1.0.0", "darwin", "arm64", modified)
+		require.NoError(t, err)
+		assert.NotNil(t, bs)
+	})
+
+	t.Run("cached shasum", func(t *testing.T) {
+		getShasum := func() string {
+			bs, err := src.GetPlatform(ctx, "hashicorp", "null", "1.0.0", "darwin", "arm64")
+			require.NoError(t, err)
+
+			return json.Get(bs, "shasum").String()
+		}
+
+		assert.Equal(t, sumOf("1.0.0 darwin"), getShasum())
+
+		// Served from the cache as the size and the modified time are kept.
+		write("terraform-provider-null_1.0.0_darwin_arm64.zip", "1.0.0 DARWIN")
+		assert.Equal(t, sumOf("1.0.0 darwin"), getShasum())
+
+		// Calculated again once the modified time changes.
+		later := modified.Add(time.Minute)
+		require.NoError(t, os.Chtimes(darwin, later, later))
+		assert.Equal(t, sumOf("1.0.0 DARWIN"), getShasum())
+	})
+}
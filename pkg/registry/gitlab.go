@@ -0,0 +1,248 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"path"
+	"strconv"
+	"time"
+)
+
+// GitLab hosts the Terraform modules in the Terraform Module Registry,
+// see https://docs.gitlab.com/ee/user/packages/terraform_module_registry,
+// but there is no Terraform Provider Registry yet,
+// so the providers are expected to be published into the Generic Package Registry of a project,
+// see https://docs.gitlab.com/ee/user/packages/generic_packages,
+// with the package name terraform-provider-<TYPE> and the package version <VERSION>,
+// the files are the same as the output of GoReleaser.
+//
+// The project is addressed by the provider namespace within the group specified by the `group` option,
+// or fixed by the `project` option.
+
+type gitlabSource struct {
+	registrySource
+
+	api     url.URL
+	group   string
+	project string
+}
+
+// gitlabSourceOf returns the UpstreamSource of the GitLab upstream,
+// the modules are accessed with the registry protocol.
+func gitlabSourceOf(_ context.Context, u Upstream) (UpstreamSource, error) {
+	return gitlabSource{
+		registrySource: registrySource{
+			host: Host(u.Hostname),
+			endpoints: map[string]url.URL{
+				"modules.v1": {
+					Scheme: "https",
+					Host:   u.Hostname,
+					Path:   "/api/v4/packages/terraform/modules/v1/",
+				},
+			},
+		},
+		api: url.URL{
+			Scheme: "https",
+			Host:   u.Hostname,
+			Path:   "/api/v4/",
+		},
+		group:   u.Options["group"],
+		project: u.Options["project"],
+	}, nil
+}
+
+// projectPath returns the escaped project path of the given namespace.
+func (p gitlabSource) projectPath(namespace string) string {
+	switch {
+	case p.project != "":
+		return url.PathEscape(p.project)
+	case p.group != "":
+		return url.PathEscape(p.group + "/" + namespace)
+	}
+
+	return url.PathEscape(namespace)
+}
+
+func (p gitlabSource) get(ctx context.Context, rawPath string, query url.Values, ptr any) error {
+	u := p.api
+	u.RawPath = path.Join(u.Path, rawPath)
+	u.Path, _ = url.PathUnescape(u.RawPath)
+	u.RawQuery = query.Encode()
+
+	return observeRateLimit(string(p.host), newRequest(&u).
+		GetWithContext(ctx, u.String())).
+		BodyJSON(ptr)
+}
+
+type gitlabPackage struct {
+	ID      int64  `json:"id"`
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type gitlabPackageFile struct {
+	FileName   string `json:"file_name"`
+	FileSha256 string `json:"file_sha256"`
+}
+
+// listPackages lists the generic packages of the given provider type.
+func (p gitlabSource) listPackages(ctx context.Context, namespace, type_ string) ([]gitlabPackage, error) {
+	var (
+		name = "terraform-provider-" + type_
+		pkgs []gitlabPackage
+	)
+
+	for page := 1; ; page++ {
+		var ps []gitlabPackage
+
+		err := p.get(ctx,
+			path.Join("projects", p.projectPath(namespace), "packages"),
+			url.Values{
+				"package_type": []string{"generic"},
+				"package_name": []string{name},
+				"per_page":     []string{"100"},
+				"page":         []string{strconv.Itoa(page)},
+			},
+			&ps)
+		if err != nil {
+			return nil, fmt.Errorf("error listing packages: %w", err)
+		}
+
+		for i := range ps {
+			// Package name filtering is fuzzy.
+			if ps[i].Name == name {
+				pkgs = append(pkgs, ps[i])
+			}
+		}
+
+		if len(ps) < 100 {
+			break
+		}
+	}
+
+	return pkgs, nil
+}
+
+// listArchives lists the archives of the given package.
+func (p gitlabSource) listArchives(ctx context.Context, namespace, type_ string, pkg gitlabPackage) ([]Archive, error) {
+	var fs []gitlabPackageFile
+
+	err := p.get(ctx,
+		path.Join("projects", p.projectPath(namespace), "packages", strconv.FormatInt(pkg.ID, 10), "package_files"),
+		url.Values{
+			"per_page": []string{"100"},
+		},
+		&fs)
+	if err != nil {
+		return nil, fmt.Errorf("error listing package files: %w", err)
+	}
+
+	var (
+		as        = make([]Archive, 0, len(fs))
+		manifest  = "terraform-provider-" + type_ + "_" + pkg.Version + "_manifest.json"
+		protocols []string
+	)
+
+	for i := range fs {
+		if fs[i].FileName == manifest {
+			protocols = p.getProtocols(ctx, namespace, pkg, manifest)
+			continue
+		}
+
+		v, o, a, ok := ParseArchiveFilename(type_, fs[i].FileName)
+		if !ok || v != pkg.Version {
+			continue
+		}
+
+		u := p.api
+		u.RawPath = path.Join(u.Path,
+			"projects", p.projectPath(namespace), "packages", "generic", pkg.Name, pkg.Version, fs[i].FileName)
+		u.Path, _ = url.PathUnescape(u.RawPath)
+
+		as = append(as, Archive{
+			Version:     v,
+			OS:          o,
+			Arch:        a,
+			Filename:    fs[i].FileName,
+			DownloadURL: u.String(),
+			Shasum:      fs[i].FileSha256,
+		})
+	}
+
+	for i := range as {
+		as[i].Protocols = protocols
+	}
+
+	return as, nil
+}
+
+// getProtocols gets the protocols from the manifest file generated by GoReleaser,
+// returns nil if failed.
+func (p gitlabSource) getProtocols(ctx context.Context, namespace string, pkg gitlabPackage, manifest string) []string {
+	var m struct {
+		Metadata struct {
+			ProtocolVersions []string `json:"protocol_versions"`
+		} `json:"metadata"`
+	}
+
+	err := p.get(ctx,
+		path.Join("projects", p.projectPath(namespace), "packages", "generic", pkg.Name, pkg.Version, manifest),
+		nil,
+		&m)
+	if err != nil {
+		return nil
+	}
+
+	return m.Metadata.ProtocolVersions
+}
+
+func (p gitlabSource) GetVersions(ctx context.Context, namespace, type_ string, _ ...time.Time) ([]byte, error) {
+	pkgs, err := p.listPackages(ctx, namespace, type_)
+	if err != nil {
+		return nil, err
+	}
+
+	var as []Archive
+
+	for i := range pkgs {
+		pas, err := p.listArchives(ctx, namespace, type_, pkgs[i])
+		if err != nil {
+			return nil, err
+		}
+
+		as = append(as, pas...)
+	}
+
+	return marshalVersions(as), nil
+}
+
+func (p gitlabSource) GetPlatform(
+	ctx context.Context,
+	namespace, type_, version, os, arch string,
+	_ ...time.Time,
+) ([]byte, error) {
+	pkgs, err := p.listPackages(ctx, namespace, type_)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range pkgs {
+		if pkgs[i].Version != version {
+			continue
+		}
+
+		as, err := p.listArchives(ctx, namespace, type_, pkgs[i])
+		if err != nil {
+			return nil, err
+		}
+
+		for j := range as {
+			if as[j].OS == os && as[j].Arch == arch {
+				return marshalPlatform(as[j]), nil
+			}
+		}
+	}
+
+	return []byte(`{}`), nil
+}
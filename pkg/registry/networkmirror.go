@@ -0,0 +1,186 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The provider network mirror protocol only serves the provider archives,
+// see https://developer.hashicorp.com/terraform/internals/provider-network-mirror-protocol,
+// the responses are converted into the registry protocol responses.
+//
+// The mirror base URL is specified by the `url` option,
+// and the origin hostname of the mirror path can be changed by the `hostname` option,
+// default is the requested hostname.
+
+type networkMirrorSource struct {
+	base     url.URL
+	hostname string
+}
+
+// networkMirrorSourceOf returns the UpstreamSource of the network mirror upstream.
+func networkMirrorSourceOf(_ context.Context, u Upstream) (UpstreamSource, error) {
+	v := u.Options["url"]
+	if v == "" {
+		return nil, errors.New("url option: must be filled")
+	}
+
+	bu, err := url.Parse(v)
+	if err != nil || bu.Scheme == "" || bu.Host == "" {
+		return nil, fmt.Errorf("url option: invalid %q", v)
+	}
+
+	if !strings.HasSuffix(bu.Path, "/") {
+		bu.Path += "/"
+	}
+
+	h := u.Options["hostname"]
+	if h == "" {
+		h = u.Hostname
+	}
+
+	return networkMirrorSource{
+		base:     *bu,
+		hostname: h,
+	}, nil
+}
+
+type networkMirrorArchive struct {
+	URL    string   `json:"url"`
+	Hashes []string `json:"hashes"`
+}
+
+// getVersions gets the version list of the given provider.
+func (s networkMirrorSource) getVersions(ctx context.Context, namespace, type_ string) ([]string, error) {
+	var b struct {
+		Versions map[string]any `json:"versions"`
+	}
+
+	u := resolveURLString(&s.base, path.Join(s.hostname, namespace, type_, "index.json"))
+
+	err := newRequest(&s.base).
+		GetWithContext(ctx, u).
+		BodyJSON(&b)
+	if err != nil {
+		return nil, fmt.Errorf("error getting mirror versions: %w", err)
+	}
+
+	vs := make([]string, 0, len(b.Versions))
+	for v := range b.Versions {
+		vs = append(vs, v)
+	}
+
+	sort.Strings(vs)
+
+	return vs, nil
+}
+
+// listArchives lists the archives of the given provider version.
+func (s networkMirrorSource) listArchives(ctx context.Context, namespace, type_, version string) ([]Archive, error) {
+	var b struct {
+		Archives map[string]networkMirrorArchive `json:"archives"`
+	}
+
+	u := resolveURLString(&s.base, path.Join(s.hostname, namespace, type_, version+".json"))
+
+	err := newRequest(&s.base).
+		GetWithContext(ctx, u).
+		BodyJSON(&b)
+	if err != nil {
+		return nil, fmt.Errorf("error getting mirror archives: %w", err)
+	}
+
+	bu, err := url.Parse(u)
+	if err != nil {
+		return nil, err
+	}
+
+	as := make([]Archive, 0, len(b.Archives))
+
+	for p, a := range b.Archives {
+		o, r, ok := strings.Cut(p, "_")
+		if !ok || a.URL == "" {
+			continue
+		}
+
+		du, err := url.Parse(a.URL)
+		if err != nil {
+			continue
+		}
+
+		du = bu.ResolveReference(du)
+
+		ar := Archive{
+			Version:     version,
+			OS:          o,
+			Arch:        r,
+			Filename:    path.Base(du.Path),
+			DownloadURL: du.String(),
+		}
+
+		// Only the zip hash can be used as the shasum.
+		for _, h := range a.Hashes {
+			if v, ok := strings.CutPrefix(h, "zh:"); ok {
+				ar.Shasum = v
+				break
+			}
+		}
+
+		as = append(as, ar)
+	}
+
+	return as, nil
+}
+
+func (s networkMirrorSource) GetVersions(ctx context.Context, namespace, type_ string, _ ...time.Time) ([]byte, error) {
+	vs, err := s.getVersions(ctx, namespace, type_)
+	if err != nil {
+		return nil, err
+	}
+
+	var as []Archive
+
+	for i := range vs {
+		vas, err := s.listArchives(ctx, namespace, type_, vs[i])
+		if err != nil {
+			return nil, err
+		}
+
+		as = append(as, vas...)
+	}
+
+	return marshalVersions(as), nil
+}
+
+func (s networkMirrorSource) GetPlatform(
+	ctx context.Context,
+	namespace, type_, version, os, arch string,
+	_ ...time.Time,
+) ([]byte, error) {
+	as, err := s.listArchives(ctx, namespace, type_, version)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range as {
+		if as[i].OS == os && as[i].Arch == arch {
+			return marshalPlatform(as[i]), nil
+		}
+	}
+
+	return []byte(`{}`), nil
+}
+
+func (s networkMirrorSource) GetModuleVersions(context.Context, string, string, string, ...time.Time) ([]byte, error) {
+	return nil, ErrUnsupported
+}
+
+func (s networkMirrorSource) GetModuleVersion(context.Context, string, string, string, string, ...time.Time) ([]byte, error) {
+	return nil, ErrUnsupported
+}
@@ -0,0 +1,201 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+
+	"github.com/seal-io/hermitcrab/pkg/oci"
+)
+
+// The OCI upstream serves the provider archives from an OCI registry,
+// i.e. Harbor, ECR, each provider is a repository,
+// and each tag is a version in the form of <VERSION> or v<VERSION>,
+// the layers of the tag are the archives with the title annotation as the filename,
+// which is the way of `oras push <REPOSITORY>:<VERSION> terraform-provider-<TYPE>_<VERSION>_<OS>_<ARCH>.zip ...`.
+//
+// The registry is specified by the `registry` option, default is the requested hostname,
+// the `plain-http` option accesses the registry with HTTP,
+// and the `repository` option specifies the repository template,
+// default is {namespace}/terraform-provider-{type}.
+//
+// The credential of the registry is the token of the registry hostname,
+// in form of <USERNAME>:<PASSWORD> or a bearer token.
+
+type ociSource struct {
+	client     *oci.Client
+	repository string
+}
+
+var ociClients sync.Map
+
+// ociClientOf returns the cached OCI client of the given upstream.
+func ociClientOf(u Upstream) *oci.Client {
+	r := ociRegistry(u)
+
+	if v, ok := ociClients.Load(r); ok {
+		return v.(*oci.Client)
+	}
+
+	v, _ := ociClients.LoadOrStore(r, oci.NewClient(r, oci.ClientOptions{
+		PlainHTTP:  u.Options["plain-http"] == "true",
+		Credential: config.Get().Credentials.Token(r),
+	}))
+
+	return v.(*oci.Client)
+}
+
+func ociRegistry(u Upstream) string {
+	if r := u.Options["registry"]; r != "" {
+		return r
+	}
+
+	return u.Hostname
+}
+
+// ociSourceOf returns the UpstreamSource of the OCI upstream.
+func ociSourceOf(_ context.Context, u Upstream) (UpstreamSource, error) {
+	r := u.Options["repository"]
+	if r == "" {
+		r = "{namespace}/terraform-provider-{type}"
+	}
+
+	return ociSource{
+		client:     ociClientOf(u),
+		repository: r,
+	}, nil
+}
+
+func (s ociSource) repo(namespace, type_ string) string {
+	return strings.NewReplacer("{namespace}", namespace, "{type}", type_).Replace(s.repository)
+}
+
+// listArchives lists the archives of the given tag.
+func (s ociSource) listArchives(ctx context.Context, repo, type_, tag string) ([]Archive, error) {
+	m, err := s.client.GetManifest(ctx, repo, tag)
+	if err != nil {
+		return nil, err
+	}
+
+	var ps []string
+	if v := m.Annotations[oci.AnnotationProviderProtocols]; v != "" {
+		ps = strings.Split(v, ",")
+	}
+
+	as := make([]Archive, 0, len(m.Layers))
+
+	for _, l := range m.Layers {
+		n := l.Annotations[oci.AnnotationTitle]
+
+		v, o, a, ok := ParseArchiveFilename(type_, n)
+		if !ok || v != strings.TrimPrefix(tag, "v") {
+			continue
+		}
+
+		// The digest of the layer is the checksum of the archive.
+		sum, _ := strings.CutPrefix(l.Digest, "sha256:")
+
+		as = append(as, Archive{
+			Version:     v,
+			OS:          o,
+			Arch:        a,
+			Filename:    n,
+			DownloadURL: s.client.BlobURL(repo, l.Digest),
+			Shasum:      sum,
+			Protocols:   ps,
+		})
+	}
+
+	return as, nil
+}
+
+func (s ociSource) GetVersions(ctx context.Context, namespace, type_ string, _ ...time.Time) ([]byte, error) {
+	repo := s.repo(namespace, type_)
+
+	tags, err := s.client.ListTags(ctx, repo)
+	if err != nil {
+		return nil, err
+	}
+
+	var as []Archive
+
+	for _, t := range tags {
+		// Skip the tags that are not versions, i.e. latest.
+		if _, err = semver.StrictNewVersion(strings.TrimPrefix(t, "v")); err != nil {
+			continue
+		}
+
+		tas, err := s.listArchives(ctx, repo, type_, t)
+		if err != nil {
+			return nil, fmt.Errorf("error listing archives of %s: %w", t, err)
+		}
+
+		as = append(as, tas...)
+	}
+
+	return marshalVersions(as), nil
+}
+
+func (s ociSource) GetPlatform(
+	ctx context.Context,
+	namespace, type_, version, os, arch string,
+	_ ...time.Time,
+) ([]byte, error) {
+	repo := s.repo(namespace, type_)
+
+	for _, t := range []string{version, "v" + version} {
+		as, err := s.listArchives(ctx, repo, type_, t)
+		if err != nil {
+			continue
+		}
+
+		for i := range as {
+			if as[i].OS == os && as[i].Arch == arch {
+				return marshalPlatform(as[i]), nil
+			}
+		}
+	}
+
+	return []byte(`{}`), nil
+}
+
+func (s ociSource) GetModuleVersions(context.Context, string, string, string, ...time.Time) ([]byte, error) {
+	return nil, ErrUnsupported
+}
+
+func (s ociSource) GetModuleVersion(context.Context, string, string, string, string, ...time.Time) ([]byte, error) {
+	return nil, ErrUnsupported
+}
+
+// ociAuthHeaders returns the authorization headers of pulling the given URL,
+// returns false if the URL is not a blob of the OCI upstreams.
+func ociAuthHeaders(rawURL string) (map[string]string, bool) {
+	for _, us := range config.Get().Upstreams {
+		if us.Kind != UpstreamKindOCI {
+			continue
+		}
+
+		c := ociClientOf(us)
+
+		repo, _, ok := c.ParseBlobURL(rawURL)
+		if !ok {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		hs, err := c.AuthHeaders(ctx, repo, "pull")
+		if err != nil {
+			return nil, true
+		}
+
+		return hs, true
+	}
+
+	return nil, false
+}
@@ -0,0 +1,216 @@
+package registry
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/seal-io/walrus/utils/req"
+)
+
+// RateLimit holds the rate limit of an upstream reported by the response headers,
+// i.e. X-RateLimit-Limit, X-RateLimit-Remaining and X-RateLimit-Reset of GitHub and Terraform Cloud.
+type RateLimit struct {
+	Hostname  string    `json:"hostname"`
+	Limit     int64     `json:"limit,omitempty"`
+	Remaining int64     `json:"remaining"`
+	Reset     time.Time `json:"reset"`
+	Observed  time.Time `json:"observed"`
+	// RetryAfter is the time indicated by the Retry-After header of the last rate-limited response,
+	// zero if the upstream has not rate-limited the requests.
+	RetryAfter time.Time `json:"retryAfter,omitempty"`
+
+	// quota is true if the remaining quota is reported.
+	quota bool
+}
+
+// RateLimitLowRatio is the ratio of the remaining quota to the limit considered as low,
+// RateLimitLowRemaining is the remaining quota considered as low if the limit is unknown.
+const (
+	RateLimitLowRatio     = 0.1
+	RateLimitLowRemaining = 10
+)
+
+// IsLow returns true if the remaining quota is low and not reset yet at the given time.
+func (rl RateLimit) IsLow(now time.Time) bool {
+	if !rl.quota {
+		return false
+	}
+
+	if !rl.Reset.IsZero() && !now.Before(rl.Reset) {
+		return false
+	}
+
+	if rl.Limit > 0 {
+		return float64(rl.Remaining) < float64(rl.Limit)*RateLimitLowRatio
+	}
+
+	return rl.Remaining < RateLimitLowRemaining
+}
+
+// Pace returns the interval between the background requests at the given time,
+// which spreads the remaining quota until the reset if low,
+// returns false if the quota is exhausted until the reset or the upstream asks to retry later.
+func (rl RateLimit) Pace(now time.Time) (time.Duration, bool) {
+	if now.Before(rl.RetryAfter) {
+		return 0, false
+	}
+
+	if !rl.IsLow(now) {
+		return 0, true
+	}
+
+	if rl.Remaining <= 0 {
+		return 0, false
+	}
+
+	if rl.Reset.IsZero() {
+		return time.Second, true
+	}
+
+	return rl.Reset.Sub(now) / time.Duration(rl.Remaining+1), true
+}
+
+var (
+	rateLimits sync.Map
+
+	rateLimitRemaining = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "registry",
+			Name:      "rate_limit_remaining",
+			Help:      "The remaining requests of the upstream rate limit.",
+		},
+		[]string{"hostname"},
+	)
+	rateLimitReset = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "registry",
+			Name:      "rate_limit_reset_timestamp_seconds",
+			Help:      "The unix timestamp in seconds when the upstream rate limit resets.",
+		},
+		[]string{"hostname"},
+	)
+)
+
+// NewRateLimitCollector returns the collector of the upstream rate limits.
+func NewRateLimitCollector() prometheus.Collector {
+	return rateLimitCollector{}
+}
+
+type rateLimitCollector struct{}
+
+func (rateLimitCollector) Describe(ch chan<- *prometheus.Desc) {
+	rateLimitRemaining.Describe(ch)
+	rateLimitReset.Describe(ch)
+}
+
+func (rateLimitCollector) Collect(ch chan<- prometheus.Metric) {
+	rateLimitRemaining.Collect(ch)
+	rateLimitReset.Collect(ch)
+}
+
+// observeRateLimit records the rate limit headers of the given response from the upstream of the given hostname,
+// along with the Retry-After header of the rate-limited response,
+// does nothing if the response carries no rate limit,
+// returns the given response for chaining.
+func observeRateLimit(hostname string, r *req.HttpResponse) *req.HttpResponse {
+	now := time.Now()
+
+	if ra, ok := parseRetryAfter(r, now); ok {
+		rl, _ := RateLimitOf(hostname)
+		rl.Hostname = hostname
+		rl.Observed = now
+		rl.RetryAfter = ra
+
+		rateLimits.Store(hostname, rl)
+	}
+
+	remaining, err := strconv.ParseInt(r.Header("X-RateLimit-Remaining"), 10, 64)
+	if err != nil {
+		return r
+	}
+
+	rl, _ := RateLimitOf(hostname)
+	rl.Hostname = hostname
+	rl.Remaining = remaining
+	rl.quota = true
+	rl.Observed = now
+	rl.Reset = time.Time{}
+
+	rl.Limit, _ = strconv.ParseInt(r.Header("X-RateLimit-Limit"), 10, 64)
+
+	// GitHub responds the reset in unix seconds,
+	// Terraform Cloud responds the seconds until the reset.
+	if v, err := strconv.ParseFloat(r.Header("X-RateLimit-Reset"), 64); err == nil && v >= 0 {
+		if v > 1e9 {
+			rl.Reset = time.Unix(int64(v), 0)
+		} else {
+			rl.Reset = now.Add(time.Duration(v * float64(time.Second)))
+		}
+	}
+
+	rateLimits.Store(hostname, rl)
+
+	rateLimitRemaining.WithLabelValues(hostname).Set(float64(rl.Remaining))
+
+	if !rl.Reset.IsZero() {
+		rateLimitReset.WithLabelValues(hostname).Set(float64(rl.Reset.Unix()))
+	}
+
+	return r
+}
+
+// parseRetryAfter returns the time indicated by the Retry-After header of the given rate-limited response,
+// which is either the seconds to wait or an HTTP date.
+func parseRetryAfter(r *req.HttpResponse, now time.Time) (time.Time, bool) {
+	switch r.StatusCode() {
+	default:
+		return time.Time{}, false
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+	}
+
+	v := r.Header("Retry-After")
+	if v == "" {
+		return time.Time{}, false
+	}
+
+	if n, err := strconv.ParseInt(v, 10, 64); err == nil && n >= 0 {
+		return now.Add(time.Duration(n) * time.Second), true
+	}
+
+	if t, err := http.ParseTime(v); err == nil {
+		return t, true
+	}
+
+	return time.Time{}, false
+}
+
+// RateLimitOf returns the last observed rate limit of the given hostname,
+// returns false if not observed.
+func RateLimitOf(hostname string) (RateLimit, bool) {
+	v, ok := rateLimits.Load(hostname)
+	if !ok {
+		return RateLimit{}, false
+	}
+
+	return v.(RateLimit), true
+}
+
+// RateLimits returns the last observed rate limits of all upstreams in hostname order.
+func RateLimits() []RateLimit {
+	r := make([]RateLimit, 0)
+
+	rateLimits.Range(func(_, v any) bool {
+		r = append(r, v.(RateLimit))
+		return true
+	})
+
+	sort.Slice(r, func(i, j int) bool {
+		return r[i].Hostname < r[j].Hostname
+	})
+
+	return r
+}
@@ -0,0 +1,77 @@
+package registry
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestObserveRateLimit(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Limit", "100")
+		w.Header().Set("X-RateLimit-Remaining", "4")
+		w.Header().Set("X-RateLimit-Reset", "50")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	observeRateLimit("ratelimit.test", httpCli.Request().GetWithContext(context.Background(), srv.URL))
+
+	rl, ok := RateLimitOf("ratelimit.test")
+	if !ok {
+		t.Fatal("expected rate limit observed")
+	}
+
+	if rl.Limit != 100 || rl.Remaining != 4 {
+		t.Errorf("unexpected rate limit: %+v", rl)
+	}
+
+	now := rl.Observed
+	if !rl.IsLow(now) {
+		t.Error("expected low rate limit")
+	}
+
+	if d, ok := rl.Pace(now); !ok || d != 10*time.Second {
+		t.Errorf("expected pace 10s, got %v, %v", d, ok)
+	}
+
+	if rl.IsLow(rl.Reset) {
+		t.Error("expected not low after reset")
+	}
+
+	rl.Remaining = 0
+	if _, ok := rl.Pace(now); ok {
+		t.Error("expected exhausted rate limit")
+	}
+}
+
+func TestObserveRateLimit_retryAfter(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "120")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	// Disable the retry to observe the rate-limited response at once.
+	observeRateLimit("retryafter.test",
+		httpCli.Request().WithRetryIf(nil).GetWithContext(context.Background(), srv.URL))
+
+	rl, ok := RateLimitOf("retryafter.test")
+	if !ok {
+		t.Fatal("expected rate limit observed")
+	}
+
+	if d := rl.RetryAfter.Sub(rl.Observed); d != 120*time.Second {
+		t.Errorf("expected retry after 120s, got %v", d)
+	}
+
+	if _, ok := rl.Pace(rl.Observed); ok {
+		t.Error("expected no pace before retry after")
+	}
+
+	if _, ok := rl.Pace(rl.RetryAfter); !ok {
+		t.Error("expected pace after retry after")
+	}
+}
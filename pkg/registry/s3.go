@@ -0,0 +1,508 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/seal-io/walrus/utils/json"
+)
+
+// The S3 upstream serves the provider archives from an S3 compatible bucket,
+// which is laid out like https://releases.hashicorp.com:
+// {prefix}
+// └── terraform-provider-{type}
+//  └── {version}
+//   ├── terraform-provider-{type}_{version}_{os}_{arch}.zip
+//   ├── terraform-provider-{type}_{version}_SHA256SUMS
+//   └── terraform-provider-{type}_{version}_manifest.json
+//
+// The bucket is specified by the `bucket` option, within the `region` option(default us-east-1),
+// the `endpoint` option can point to other S3 compatible services,
+// i.e. storage.googleapis.com for GCS, and the `path-style` option forces the path style addressing.
+// The `prefix` option specifies the key prefix,
+// and the `namespace` option restricts the bucket to serve the given provider namespace only.
+//
+// The requests are signed with AWS Signature Version 4,
+// if the AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY environment variables are provided,
+// otherwise, the bucket must allow anonymous access.
+
+type s3Source struct {
+	base      url.URL
+	region    string
+	prefix    string
+	namespace string
+}
+
+// s3SourceOf returns the UpstreamSource of the S3 upstream.
+func s3SourceOf(_ context.Context, u Upstream) (UpstreamSource, error) {
+	base, err := s3Base(u)
+	if err != nil {
+		return nil, err
+	}
+
+	p := strings.Trim(u.Options["prefix"], "/")
+	if p != "" {
+		p += "/"
+	}
+
+	return s3Source{
+		base:      base,
+		region:    s3Region(u),
+		prefix:    p,
+		namespace: u.Options["namespace"],
+	}, nil
+}
+
+func s3Region(u Upstream) string {
+	if r := u.Options["region"]; r != "" {
+		return r
+	}
+
+	return "us-east-1"
+}
+
+// s3Base returns the bucket URL of the given S3 upstream, which is ended with a slash.
+func s3Base(u Upstream) (url.URL, error) {
+	b := u.Options["bucket"]
+	if b == "" {
+		return url.URL{}, errors.New("bucket option: must be filled")
+	}
+
+	ep := u.Options["endpoint"]
+	if ep == "" {
+		ep = "s3." + s3Region(u) + ".amazonaws.com"
+	}
+
+	if !strings.Contains(ep, "://") {
+		ep = "https://" + ep
+	}
+
+	eu, err := url.Parse(ep)
+	if err != nil || eu.Host == "" {
+		return url.URL{}, fmt.Errorf("endpoint option: invalid %q", ep)
+	}
+
+	if u.Options["path-style"] == "true" || strings.Contains(b, ".") {
+		return url.URL{
+			Scheme: eu.Scheme,
+			Host:   eu.Host,
+			Path:   "/" + b + "/",
+		}, nil
+	}
+
+	return url.URL{
+		Scheme: eu.Scheme,
+		Host:   b + "." + eu.Host,
+		Path:   "/",
+	}, nil
+}
+
+type s3Object struct {
+	Key          string    `xml:"Key"`
+	LastModified time.Time `xml:"LastModified"`
+}
+
+// get gets the object of the given key.
+func (s s3Source) get(ctx context.Context, key string) ([]byte, error) {
+	u := s.base
+	u.Path += key
+
+	r := httpCli.Request().
+		WithHeaders(s3SignedHeaders(http.MethodGet, &u, s.region, time.Now())).
+		GetWithContext(ctx, u.String())
+
+	bs, err := r.BodyBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	if r.StatusCode() != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d getting %s", r.StatusCode(), key)
+	}
+
+	return bs, nil
+}
+
+// list lists the objects under the given prefix.
+func (s s3Source) list(ctx context.Context, prefix string) ([]s3Object, error) {
+	var (
+		objs  []s3Object
+		token string
+	)
+
+	for {
+		q := url.Values{
+			"list-type": []string{"2"},
+			"prefix":    []string{prefix},
+		}
+		if token != "" {
+			q.Set("continuation-token", token)
+		}
+
+		u := s.base
+		u.RawQuery = q.Encode()
+
+		r := httpCli.Request().
+			WithHeaders(s3SignedHeaders(http.MethodGet, &u, s.region, time.Now())).
+			GetWithContext(ctx, u.String())
+
+		bs, err := r.BodyBytes()
+		if err != nil {
+			return nil, fmt.Errorf("error listing objects: %w", err)
+		}
+
+		if r.StatusCode() != http.StatusOK {
+			return nil, fmt.Errorf("error listing objects: unexpected status %d", r.StatusCode())
+		}
+
+		var b struct {
+			Contents              []s3Object `xml:"Contents"`
+			IsTruncated           bool       `xml:"IsTruncated"`
+			NextContinuationToken string     `xml:"NextContinuationToken"`
+		}
+
+		if err = xml.NewDecoder(bytes.NewReader(bs)).Decode(&b); err != nil {
+			return nil, fmt.Errorf("error decoding objects: %w", err)
+		}
+
+		objs = append(objs, b.Contents...)
+
+		if !b.IsTruncated || b.NextContinuationToken == "" {
+			break
+		}
+
+		token = b.NextContinuationToken
+	}
+
+	return objs, nil
+}
+
+// listArchives lists the archives of the given provider,
+// returns nil if the given since is not zero and the bucket has not modified since then.
+func (s s3Source) listArchives(ctx context.Context, namespace, type_, version string, since ...time.Time) ([]Archive, error) {
+	if s.namespace != "" && s.namespace != namespace {
+		return []Archive{}, nil
+	}
+
+	prefix := s.prefix + "terraform-provider-" + type_ + "/"
+	if version != "" {
+		prefix += version + "/"
+	}
+
+	objs, err := s.list(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var modified time.Time
+
+	for i := range objs {
+		if objs[i].LastModified.After(modified) {
+			modified = objs[i].LastModified
+		}
+	}
+
+	if len(since) != 0 && !since[0].IsZero() && !modified.After(since[0]) {
+		return nil, nil
+	}
+
+	var (
+		as        = make([]Archive, 0, len(objs))
+		shasums   = map[string]map[string]string{}
+		protocols = map[string][]string{}
+	)
+
+	for i := range objs {
+		n := path.Base(objs[i].Key)
+
+		v, o, a, ok := ParseArchiveFilename(type_, n)
+		if !ok {
+			continue
+		}
+
+		if _, ok := shasums[v]; !ok {
+			p := path.Dir(objs[i].Key) + "/terraform-provider-" + type_ + "_" + v
+			shasums[v] = s.getShasums(ctx, p+"_SHA256SUMS")
+			protocols[v] = s.getProtocols(ctx, p+"_manifest.json")
+		}
+
+		u := s.base
+		u.Path += objs[i].Key
+
+		as = append(as, Archive{
+			Version:     v,
+			OS:          o,
+			Arch:        a,
+			Filename:    n,
+			DownloadURL: u.String(),
+			Shasum:      shasums[v][n],
+			Protocols:   protocols[v],
+		})
+	}
+
+	return as, nil
+}
+
+// getShasums gets the SHA256SUMS object into a map indexing by the filename,
+// returns an empty map if failed.
+func (s s3Source) getShasums(ctx context.Context, key string) map[string]string {
+	m := map[string]string{}
+
+	bs, err := s.get(ctx, key)
+	if err != nil {
+		return m
+	}
+
+	for _, l := range strings.Split(string(bs), "\n") {
+		fs := strings.Fields(l)
+		if len(fs) != 2 {
+			continue
+		}
+
+		m[strings.TrimPrefix(fs[1], "*")] = fs[0]
+	}
+
+	return m
+}
+
+// getProtocols gets the protocols from the manifest object generated by GoReleaser,
+// returns nil if failed.
+func (s s3Source) getProtocols(ctx context.Context, key string) []string {
+	bs, err := s.get(ctx, key)
+	if err != nil {
+		return nil
+	}
+
+	var ps []string
+
+	for _, r := range json.Get(bs, "metadata.protocol_versions").Array() {
+		ps = append(ps, r.String())
+	}
+
+	return ps
+}
+
+func (s s3Source) GetVersions(ctx context.Context, namespace, type_ string, since ...time.Time) ([]byte, error) {
+	as, err := s.listArchives(ctx, namespace, type_, "", since...)
+	if err != nil || as == nil {
+		return nil, err
+	}
+
+	return marshalVersions(as), nil
+}
+
+func (s s3Source) GetPlatform(
+	ctx context.Context,
+	namespace, type_, version, os, arch string,
+	since ...time.Time,
+) ([]byte, error) {
+	as, err := s.listArchives(ctx, namespace, type_, version, since...)
+	if err != nil || as == nil {
+		return nil, err
+	}
+
+	for i := range as {
+		if as[i].OS == os && as[i].Arch == arch {
+			return marshalPlatform(as[i]), nil
+		}
+	}
+
+	return []byte(`{}`), nil
+}
+
+func (s s3Source) GetModuleVersions(context.Context, string, string, string, ...time.Time) ([]byte, error) {
+	return nil, ErrUnsupported
+}
+
+func (s s3Source) GetModuleVersion(context.Context, string, string, string, string, ...time.Time) ([]byte, error) {
+	return nil, ErrUnsupported
+}
+
+// s3AuthHeaders returns the signed headers of requesting the given URL by the given method,
+// returns false if the URL is not an object of the S3 upstreams.
+func s3AuthHeaders(method, rawURL string) (map[string]string, bool) {
+	for _, us := range config.Get().Upstreams {
+		if us.Kind != UpstreamKindS3 {
+			continue
+		}
+
+		base, err := s3Base(us)
+		if err != nil || !strings.HasPrefix(rawURL, base.String()) {
+			continue
+		}
+
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return nil, false
+		}
+
+		return s3SignedHeaders(method, u, s3Region(us), time.Now()), true
+	}
+
+	return nil, false
+}
+
+// s3SignedHeaders returns the headers of requesting the given URL by the given method,
+// which are signed with AWS Signature Version 4 if the credentials are provided,
+// the signature only stands for the given method, i.e. a GET signature is rejected on HEAD,
+// see https://docs.aws.amazon.com/AmazonS3/latest/API/sig-v4-header-based-auth.html.
+func s3SignedHeaders(method string, u *url.URL, region string, now time.Time) map[string]string {
+	const payload = "UNSIGNED-PAYLOAD"
+
+	ak, sk := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY")
+	if ak == "" || sk == "" {
+		return map[string]string{}
+	}
+
+	now = now.UTC()
+
+	hs := map[string]string{
+		"host":                 u.Host,
+		"x-amz-content-sha256": payload,
+		"x-amz-date":           now.Format(sigV4TimeFormat),
+	}
+	if t := os.Getenv("AWS_SESSION_TOKEN"); t != "" {
+		hs["x-amz-security-token"] = t
+	}
+
+	auth := sigV4Authorization(sigV4Request{
+		Method:    method,
+		URL:       u,
+		Headers:   hs,
+		Payload:   payload,
+		Region:    region,
+		Service:   "s3",
+		AccessKey: ak,
+		SecretKey: sk,
+		Time:      now,
+	})
+
+	delete(hs, "host")
+	hs["Authorization"] = auth
+
+	return hs
+}
+
+// sigV4TimeFormat is the format of the x-amz-date header.
+const sigV4TimeFormat = "20060102T150405Z"
+
+// sigV4Request holds the request to sign with AWS Signature Version 4.
+type sigV4Request struct {
+	Method string
+	URL    *url.URL
+	// Headers are the headers to sign in lower case, including the host and the x-amz-date.
+	Headers map[string]string
+	// Payload is the hex encoded sha256 of the body, or UNSIGNED-PAYLOAD.
+	Payload   string
+	Region    string
+	Service   string
+	AccessKey string
+	SecretKey string
+	Time      time.Time
+}
+
+// sigV4Authorization returns the value of the Authorization header of the given request,
+// see https://docs.aws.amazon.com/IAM/latest/UserGuide/create-signed-request.html.
+func sigV4Authorization(r sigV4Request) string {
+	hks := make([]string, 0, len(r.Headers))
+	for k := range r.Headers {
+		hks = append(hks, k)
+	}
+
+	sort.Strings(hks)
+
+	var ch strings.Builder
+	for _, k := range hks {
+		ch.WriteString(k + ":" + strings.Join(strings.Fields(r.Headers[k]), " ") + "\n")
+	}
+
+	signed := strings.Join(hks, ";")
+
+	q := r.URL.Query()
+	qks := make([]string, 0, len(q))
+
+	for k := range q {
+		qks = append(qks, k)
+	}
+
+	sort.Strings(qks)
+
+	cq := make([]string, 0, len(qks))
+	for _, k := range qks {
+		vs := q[k]
+		sort.Strings(vs)
+
+		for _, v := range vs {
+			cq = append(cq, s3Escape(k, true)+"="+s3Escape(v, true))
+		}
+	}
+
+	cp := s3Escape(r.URL.Path, false)
+	if cp == "" {
+		cp = "/"
+	}
+
+	cr := strings.Join([]string{
+		r.Method,
+		cp,
+		strings.Join(cq, "&"),
+		ch.String(),
+		signed,
+		r.Payload,
+	}, "\n")
+
+	now := r.Time.UTC()
+	date := now.Format("20060102")
+	scope := date + "/" + r.Region + "/" + r.Service + "/aws4_request"
+	crh := sha256.Sum256([]byte(cr))
+	sts := "AWS4-HMAC-SHA256\n" + now.Format(sigV4TimeFormat) + "\n" + scope + "\n" + hex.EncodeToString(crh[:])
+
+	key := []byte("AWS4" + r.SecretKey)
+	for _, v := range []string{date, r.Region, r.Service, "aws4_request"} {
+		key = s3HMAC(key, v)
+	}
+
+	return "AWS4-HMAC-SHA256 Credential=" + r.AccessKey + "/" + scope +
+		", SignedHeaders=" + signed +
+		", Signature=" + hex.EncodeToString(s3HMAC(key, sts))
+}
+
+func s3HMAC(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	_, _ = h.Write([]byte(data))
+
+	return h.Sum(nil)
+}
+
+// s3Escape escapes the given string in the way of AWS Signature Version 4,
+// the slash is kept if not escaping a query component.
+func s3Escape(s string, query bool) string {
+	var sb strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/' && !query:
+			sb.WriteByte(c)
+		default:
+			fmt.Fprintf(&sb, "%%%02X", c)
+		}
+	}
+
+	return sb.String()
+}
@@ -2,19 +2,73 @@ package registry
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"net/url"
 	"path"
+	"strings"
 	"time"
 
 	"github.com/seal-io/walrus/utils/json"
 	"github.com/seal-io/walrus/utils/req"
+	"github.com/seal-io/walrus/utils/vars"
 	"github.com/seal-io/walrus/utils/version"
+	"github.com/valyala/fasthttp/fasthttpproxy"
+
+	"github.com/seal-io/hermitcrab/pkg/chaos"
 )
 
 var httpCli = req.HTTP().
 	WithInsecureSkipVerifyEnabled().
-	WithUserAgent(version.GetUserAgentWith("hermitcrab"))
+	WithUserAgent(version.GetUserAgentWith("hermitcrab")).
+	WithDial(chaos.Dial(fasthttpproxy.FasthttpProxyHTTPDialerTimeout(5 * time.Second)))
+
+// ConfigureOptions holds the options of configuring the registry client.
+type ConfigureOptions struct {
+	// TerraformVersion is the value of the X-Terraform-Version header,
+	// some private registries, like Terraform Enterprise/Cloud,
+	// respond differently according to this header.
+	TerraformVersion string
+	// Credentials holds the API token of each registry hostname.
+	Credentials Credentials
+	// Upstreams holds the adapters of the registry hostnames.
+	Upstreams Upstreams
+}
+
+var config = vars.NewSetOnce(ConfigureOptions{
+	TerraformVersion: "1.5.7",
+	Credentials:      Credentials{},
+	Upstreams:        Upstreams{},
+})
+
+// Configure configures the registry client,
+// it can only be called once.
+func Configure(opts ConfigureOptions) {
+	if opts.TerraformVersion == "" {
+		opts.TerraformVersion = config.Get().TerraformVersion
+	}
+
+	if opts.Credentials == nil {
+		opts.Credentials = Credentials{}
+	}
+
+	if opts.Upstreams == nil {
+		opts.Upstreams = Upstreams{}
+	}
+
+	config.Set(opts)
+}
+
+// newRequest returns a request to the given URL,
+// which carries the compatibility headers and the credentials of the URL host.
+func newRequest(u *url.URL) *req.HttpRequest {
+	cfg := config.Get()
+
+	rq := httpCli.Request().
+		WithHeader("X-Terraform-Version", cfg.TerraformVersion)
+
+	return authorize(rq, u.Host)
+}
 
 type Host string
 
@@ -28,46 +82,76 @@ type Host string
 //	"providers.v1": "/terraform/providers/v1/"
 //	}
 //
-
+// The discovery document is cached, see Host.Discovery.
 func (h Host) Discover(ctx context.Context, service string) url.URL {
-	var (
-		u = &url.URL{
-			Scheme: "https",
-			Host:   string(h),
-		}
-		b = map[string]string{}
-	)
-
-	err := httpCli.Request().
-		GetWithContext(ctx, resolveURLString(u, "/.well-known/terraform.json")).
-		BodyJSON(&b)
-	if err == nil && b[service] != "" {
-		return *resolveURL(u, b[service])
+	u := &url.URL{
+		Scheme: "https",
+		Host:   string(h),
+	}
+
+	d, err := h.Discovery(ctx)
+	if err == nil && d.Services[service] != "" {
+		return *resolveURL(u, d.Services[service])
 	}
 
 	return *u
 }
 
-type Provider url.URL
+// registrySource implements the UpstreamSource with the registry protocol,
+// the service endpoints are discovered from the hostname if not specified.
+type registrySource struct {
+	host      Host
+	endpoints map[string]url.URL
+}
+
+// registrySourceOf returns the UpstreamSource of the given Upstream with the registry protocol,
+// the service endpoints can be specified by the `providers.v1`, `modules.v1` and `docs.v2` options.
+func registrySourceOf(_ context.Context, u Upstream) (UpstreamSource, error) {
+	s := registrySource{
+		host:      Host(u.Hostname),
+		endpoints: map[string]url.URL{},
+	}
 
-// Provider switches the host to the provider endpoint.
-func (h Host) Provider(ctx context.Context) Provider {
-	switch h {
-	case "registry.terraform.io":
-		return Provider(url.URL{
+	switch u.Hostname {
+	case "registry.terraform.io", "registry.opentofu.org":
+		s.endpoints["providers.v1"] = url.URL{
 			Scheme: "https",
-			Host:   "registry.terraform.io",
+			Host:   u.Hostname,
 			Path:   "/v1/providers/",
-		})
-	case "registry.opentofu.org":
-		return Provider(url.URL{
+		}
+		s.endpoints["modules.v1"] = url.URL{
 			Scheme: "https",
-			Host:   "registry.opentofu.org",
-			Path:   "/v1/providers/",
-		})
+			Host:   u.Hostname,
+			Path:   "/v1/modules/",
+		}
+	}
+
+	for _, svc := range []string{"providers.v1", "modules.v1", "docs.v2"} {
+		v := u.Options[svc]
+		if v == "" {
+			continue
+		}
+
+		eu, err := url.Parse(v)
+		if err != nil || eu.Scheme == "" || eu.Host == "" {
+			return nil, fmt.Errorf("invalid %s endpoint: %s", svc, v)
+		}
+
+		s.endpoints[svc] = *eu
 	}
 
-	return Provider(h.Discover(ctx, "providers.v1"))
+	return s, nil
+}
+
+// endpoint returns the endpoint of the given service.
+func (s registrySource) endpoint(ctx context.Context, service string) *url.URL {
+	if u, ok := s.endpoints[service]; ok {
+		return &u
+	}
+
+	u := s.host.Discover(ctx, service)
+
+	return &u
 }
 
 // GetVersions fetches the provider version list by the given parameters.
@@ -103,14 +187,16 @@ func (h Host) Provider(ctx context.Context) Provider {
 // If the given since is not zero, and the remote has not modified, the function returns nil, nil.
 //
 
-func (p Provider) GetVersions(ctx context.Context, namespace, type_ string, since ...time.Time) ([]byte, error) {
-	rq := httpCli.Request()
+func (s registrySource) GetVersions(ctx context.Context, namespace, type_ string, since ...time.Time) ([]byte, error) {
+	p := s.endpoint(ctx, "providers.v1")
+
+	rq := newRequest(p)
 	if len(since) != 0 && !since[0].IsZero() {
 		rq = rq.WithHeader("If-Modified-Since", since[0].Format(http.TimeFormat))
 	}
 
-	r := rq.GetWithContext(ctx,
-		resolveURLString((*url.URL)(&p), path.Join(namespace, type_, "versions")))
+	r := observeRateLimit(string(s.host), rq.GetWithContext(ctx,
+		resolveURLString(p, path.Join(namespace, type_, "versions"))))
 
 	if len(since) != 0 && !since[0].IsZero() && r.StatusCode() == http.StatusNotModified {
 		return nil, nil
@@ -156,46 +242,46 @@ func (p Provider) GetVersions(ctx context.Context, namespace, type_ string, sinc
 //	}
 //
 // If the given since is not zero, and the remote has not modified, the function returns nil, nil.
+// If the remote responds 404 or 410, the function returns ErrPlatformNotFound.
 //
 // nolint:lll
-func (p Provider) GetPlatform(
+func (s registrySource) GetPlatform(
 	ctx context.Context,
 	namespace, type_, version, os, arch string,
 	since ...time.Time,
 ) ([]byte, error) {
-	rq := httpCli.Request()
+	p := s.endpoint(ctx, "providers.v1")
+
+	rq := newRequest(p)
 	if len(since) != 0 && !since[0].IsZero() {
 		rq = rq.WithHeader("If-Modified-Since", since[0].Format(http.TimeFormat))
 	}
 
-	r := rq.GetWithContext(ctx,
-		resolveURLString((*url.URL)(&p), path.Join(namespace, type_, version, "download", os, arch)),
-	)
+	u := resolveURLString(p, path.Join(namespace, type_, version, "download", os, arch))
+
+	r := observeRateLimit(string(s.host), rq.GetWithContext(ctx, u))
 
 	if len(since) != 0 && !since[0].IsZero() && r.StatusCode() == http.StatusNotModified {
 		return nil, nil
 	}
 
+	if sc := r.StatusCode(); sc == http.StatusNotFound || sc == http.StatusGone {
+		return nil, ErrPlatformNotFound
+	}
+
 	bs, err := r.BodyBytes()
 	if err != nil {
 		return nil, err
 	}
 
 	if json.Get(bs, "@this").IsObject() {
-		return bs, nil
+		return resolvePlatformURLs(u, bs), nil
 	}
 
 	return []byte(`{}`), nil
 }
 
-type Module url.URL
-
-// Module switches the host to the module endpoint.
-func (h Host) Module(ctx context.Context) Module {
-	return Module(h.Discover(ctx, "modules.v1"))
-}
-
-// GetVersions fetches the module version list by the given parameters.
+// GetModuleVersions fetches the module version list by the given parameters.
 // See https://developer.hashicorp.com/terraform/internals/module-registry-protocol#list-available-versions-for-a-specific-module.
 // Response example:
 //
@@ -212,14 +298,20 @@ func (h Host) Module(ctx context.Context) Module {
 //	}
 //
 // If the given since is not zero, and the remote has not modified, the function returns nil, nil.
-func (m Module) GetVersions(ctx context.Context, namespace, name, system string, since ...time.Time) ([]byte, error) {
-	rq := httpCli.Request()
+func (s registrySource) GetModuleVersions(
+	ctx context.Context,
+	namespace, name, system string,
+	since ...time.Time,
+) ([]byte, error) {
+	m := s.endpoint(ctx, "modules.v1")
+
+	rq := newRequest(m)
 	if len(since) != 0 && !since[0].IsZero() {
 		rq = rq.WithHeader("If-Modified-Since", since[0].Format(http.TimeFormat))
 	}
 
-	r := rq.GetWithContext(ctx,
-		resolveURLString((*url.URL)(&m), path.Join(namespace, name, system, "versions")))
+	r := observeRateLimit(string(s.host), rq.GetWithContext(ctx,
+		resolveURLString(m, path.Join(namespace, name, system, "versions"))))
 
 	if len(since) != 0 && !since[0].IsZero() && r.StatusCode() == http.StatusNotModified {
 		return nil, nil
@@ -237,7 +329,7 @@ func (m Module) GetVersions(ctx context.Context, namespace, name, system string,
 	return []byte(`{"modules":[]}`), nil
 }
 
-// GetVersion fetches the module versioned information by the given parameters.
+// GetModuleVersion fetches the module versioned information by the given parameters.
 // See https://developer.hashicorp.com/terraform/internals/module-registry-protocol#download-source-code-for-a-specific-module-version.
 // Response example:
 //
@@ -246,19 +338,21 @@ func (m Module) GetVersions(ctx context.Context, namespace, name, system string,
 //	}
 //
 // If the given since is not zero, and the remote has not modified, the function returns nil, nil.
-func (m Module) GetVersion(
+func (s registrySource) GetModuleVersion(
 	ctx context.Context,
 	namespace, name, system, version string,
 	since ...time.Time,
 ) ([]byte, error) {
-	rq := httpCli.Request()
+	m := s.endpoint(ctx, "modules.v1")
+
+	rq := newRequest(m)
 	if len(since) != 0 && !since[0].IsZero() {
 		rq = rq.WithHeader("If-Modified-Since", since[0].Format(http.TimeFormat))
 	}
 
-	r := rq.GetWithContext(ctx,
-		resolveURLString((*url.URL)(&m), path.Join(namespace, name, system, version, "download")),
-	)
+	r := observeRateLimit(string(s.host), rq.GetWithContext(ctx,
+		resolveURLString(m, path.Join(namespace, name, system, version, "download")),
+	))
 
 	if len(since) != 0 && !since[0].IsZero() && r.StatusCode() == http.StatusNotModified {
 		return nil, nil
@@ -272,6 +366,57 @@ func (m Module) GetVersion(
 	return []byte(`{}`), nil
 }
 
+// resolvePlatformURLs resolves the relative URLs of the given platform information,
+// the relative URLs are resolved relative to the URL that returned the platform information.
+// See https://developer.hashicorp.com/terraform/internals/provider-registry-protocol#download_url.
+func resolvePlatformURLs(base string, bs []byte) []byte {
+	keys := []string{"download_url", "shasums_url", "shasums_signature_url"}
+
+	relative := false
+
+	for _, k := range keys {
+		if v := json.Get(bs, k).String(); v != "" && !strings.Contains(v, "://") {
+			relative = true
+			break
+		}
+	}
+
+	if !relative {
+		return bs
+	}
+
+	bu, err := url.Parse(base)
+	if err != nil {
+		return bs
+	}
+
+	var m map[string]any
+	if err = json.Unmarshal(bs, &m); err != nil {
+		return bs
+	}
+
+	for _, k := range keys {
+		v, ok := m[k].(string)
+		if !ok || v == "" || strings.Contains(v, "://") {
+			continue
+		}
+
+		ru, err := url.Parse(v)
+		if err != nil {
+			continue
+		}
+
+		m[k] = bu.ResolveReference(ru).String()
+	}
+
+	rbs, err := json.Marshal(m)
+	if err != nil {
+		return bs
+	}
+
+	return rbs
+}
+
 func resolveURL(u *url.URL, p string) *url.URL {
 	return u.ResolveReference(&url.URL{Path: p})
 }
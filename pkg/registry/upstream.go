@@ -0,0 +1,238 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/seal-io/walrus/utils/req"
+)
+
+// UpstreamSource holds the operations of an upstream,
+// the responses are in the format of the registry protocol.
+type UpstreamSource interface {
+	// GetVersions fetches the provider version list by the given parameters.
+	GetVersions(ctx context.Context, namespace, type_ string, since ...time.Time) ([]byte, error)
+	// GetPlatform fetches the provider versioned platform information by the given parameters.
+	GetPlatform(ctx context.Context, namespace, type_, version, os, arch string, since ...time.Time) ([]byte, error)
+	// GetModuleVersions fetches the module version list by the given parameters.
+	GetModuleVersions(ctx context.Context, namespace, name, system string, since ...time.Time) ([]byte, error)
+	// GetModuleVersion fetches the module versioned information by the given parameters.
+	GetModuleVersion(ctx context.Context, namespace, name, system, version string, since ...time.Time) ([]byte, error)
+}
+
+// UpstreamSourceFactory creates the UpstreamSource of the given Upstream.
+type UpstreamSourceFactory func(ctx context.Context, u Upstream) (UpstreamSource, error)
+
+// ErrUnsupported is returned if the UpstreamSource does not support the operation.
+var ErrUnsupported = errors.New("unsupported by the upstream source")
+
+// ErrPlatformNotFound is returned if the requested platform is not found in the upstream,
+// i.e. the upstream deletes the release.
+var ErrPlatformNotFound = errors.New("platform not found")
+
+var sourceFactories = map[string]UpstreamSourceFactory{}
+
+// RegisterUpstreamSource registers the UpstreamSourceFactory of the given kind,
+// it is not concurrent safe and should be called during initialization.
+func RegisterUpstreamSource(kind string, factory UpstreamSourceFactory) {
+	if kind == "" || factory == nil {
+		panic("invalid upstream source registration")
+	}
+
+	sourceFactories[strings.ToLower(kind)] = factory
+}
+
+// UpstreamSourceKinds returns the sorted kinds of the registered UpstreamSource.
+func UpstreamSourceKinds() []string {
+	ks := make([]string, 0, len(sourceFactories))
+	for k := range sourceFactories {
+		ks = append(ks, k)
+	}
+
+	sort.Strings(ks)
+
+	return ks
+}
+
+func init() {
+	RegisterUpstreamSource(UpstreamKindRegistry, registrySourceOf)
+	RegisterUpstreamSource(UpstreamKindNetworkMirror, networkMirrorSourceOf)
+	RegisterUpstreamSource(UpstreamKindFilesystem, filesystemSourceOf)
+	RegisterUpstreamSource(UpstreamKindS3, s3SourceOf)
+	RegisterUpstreamSource(UpstreamKindOCI, ociSourceOf)
+	RegisterUpstreamSource(UpstreamKindGitLab, gitlabSourceOf)
+	RegisterUpstreamSource(UpstreamKindArtifactory, artifactorySourceOf)
+}
+
+// Upstream holds the adapter of a registry hostname,
+// which is used to access the registry that does not fully follow the registry protocol.
+type Upstream struct {
+	// Hostname is the registry hostname requested by the clients.
+	Hostname string
+	// Kind is the kind of the adapter.
+	Kind string
+	// Options holds the options of the adapter.
+	Options map[string]string
+}
+
+const (
+	// UpstreamKindRegistry is the kind of registry protocol adapter,
+	// which is the default kind of the hostname without adapter.
+	UpstreamKindRegistry = "registry"
+	// UpstreamKindNetworkMirror is the kind of provider network mirror protocol adapter.
+	UpstreamKindNetworkMirror = "network-mirror"
+	// UpstreamKindFilesystem is the kind of local directory adapter.
+	UpstreamKindFilesystem = "filesystem"
+	// UpstreamKindS3 is the kind of S3 compatible bucket adapter.
+	UpstreamKindS3 = "s3"
+	// UpstreamKindOCI is the kind of OCI registry adapter.
+	UpstreamKindOCI = "oci"
+	// UpstreamKindGitLab is the kind of GitLab registry adapter.
+	UpstreamKindGitLab = "gitlab"
+	// UpstreamKindArtifactory is the kind of JFrog Artifactory registry adapter.
+	UpstreamKindArtifactory = "artifactory"
+)
+
+// ParseUpstream parses the given string into an Upstream,
+// the string is in the format of `<HOSTNAME>=<KIND>[,<KEY>=<VALUE>...]`,
+// i.e. gitlab.example.com=gitlab,group=infra,token-type=job.
+func ParseUpstream(s string) (Upstream, error) {
+	hk, opts, _ := strings.Cut(s, ",")
+
+	h, k, ok := strings.Cut(hk, "=")
+	if !ok || h == "" || k == "" {
+		return Upstream{}, errors.New("invalid upstream: must be in <HOSTNAME>=<KIND> format")
+	}
+
+	u := Upstream{
+		Hostname: strings.ToLower(h),
+		Kind:     strings.ToLower(k),
+		Options:  map[string]string{},
+	}
+
+	if _, ok := sourceFactories[u.Kind]; !ok {
+		return Upstream{}, fmt.Errorf("invalid upstream: unknown kind %q", u.Kind)
+	}
+
+	if opts == "" {
+		return u, nil
+	}
+
+	for _, opt := range strings.Split(opts, ",") {
+		k, v, ok := strings.Cut(opt, "=")
+		if !ok || k == "" {
+			return Upstream{}, fmt.Errorf("invalid upstream: illegal option %q", opt)
+		}
+
+		u.Options[strings.ToLower(k)] = v
+	}
+
+	return u, nil
+}
+
+// Upstreams holds the Upstream indexing by the hostname.
+type Upstreams map[string]Upstream
+
+func (us Upstreams) get(host string) (Upstream, bool) {
+	u, ok := us[strings.ToLower(host)]
+	return u, ok
+}
+
+// Source returns the UpstreamSource of the host,
+// the host without adapter is accessed with the registry protocol.
+func (h Host) Source(ctx context.Context) (UpstreamSource, error) {
+	u, ok := config.Get().Upstreams.get(string(h))
+	if !ok {
+		u = Upstream{
+			Hostname: strings.ToLower(string(h)),
+			Kind:     UpstreamKindRegistry,
+			Options:  map[string]string{},
+		}
+	}
+
+	return NewUpstreamSource(ctx, u)
+}
+
+// NewUpstreamSource creates the UpstreamSource of the given Upstream.
+func NewUpstreamSource(ctx context.Context, u Upstream) (UpstreamSource, error) {
+	f, ok := sourceFactories[u.Kind]
+	if !ok {
+		return nil, fmt.Errorf("unknown upstream kind %q", u.Kind)
+	}
+
+	s, err := f(ctx, u)
+	if err != nil {
+		return nil, fmt.Errorf("error creating upstream source of %s: %w", u.Hostname, err)
+	}
+
+	return s, nil
+}
+
+// authorize sets the credentials of the given host to the request.
+func authorize(rq *req.HttpRequest, host string) *req.HttpRequest {
+	hs := AuthHeaders(host)
+	if len(hs) == 0 {
+		return rq
+	}
+
+	return rq.WithHeaders(hs)
+}
+
+// AuthHeaders returns the authorization headers of the given host,
+// returns nil if no credentials for the given host.
+func AuthHeaders(host string) map[string]string {
+	cfg := config.Get()
+
+	t := cfg.Credentials.Token(host)
+	if t == "" {
+		return nil
+	}
+
+	if u, ok := cfg.Upstreams.get(host); ok {
+		switch tt := u.Options["token-type"]; {
+		case u.Kind == UpstreamKindGitLab && tt == "job":
+			return map[string]string{"JOB-TOKEN": t}
+		case u.Kind == UpstreamKindGitLab && tt == "private":
+			return map[string]string{"PRIVATE-TOKEN": t}
+		case u.Kind == UpstreamKindArtifactory && tt == "api-key":
+			return map[string]string{"X-JFrog-Art-Api": t}
+		}
+	}
+
+	return map[string]string{"Authorization": "Bearer " + t}
+}
+
+// AuthorizeRequest sets the authorization headers of the given request, which is similar to AuthHeaders,
+// but only sets the authorization headers if the URL is using HTTPS,
+// or the signed headers if the URL is an object of the S3 upstreams,
+// or the token headers if the URL is a blob of the OCI upstreams,
+// the request of the S3 upstreams is signed along with its method and time,
+// so it must be called for each request, i.e. the HEAD probe and the ranged GETs of downloading.
+func AuthorizeRequest(req *http.Request) {
+	for k, v := range authHeadersOf(req.Method, req.URL.String()) {
+		req.Header.Set(k, v)
+	}
+}
+
+func authHeadersOf(method, rawURL string) map[string]string {
+	if hs, ok := s3AuthHeaders(method, rawURL); ok {
+		return hs
+	}
+
+	if hs, ok := ociAuthHeaders(rawURL); ok {
+		return hs
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "https" {
+		return nil
+	}
+
+	return AuthHeaders(u.Host)
+}
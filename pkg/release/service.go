@@ -0,0 +1,535 @@
+package release
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/seal-io/walrus/utils/errorx"
+	"github.com/seal-io/walrus/utils/log"
+	"go.uber.org/multierr"
+	"golang.org/x/crypto/openpgp"
+
+	"github.com/seal-io/hermitcrab/pkg/apis/runtime"
+	"github.com/seal-io/hermitcrab/pkg/download"
+	"github.com/seal-io/hermitcrab/pkg/provider/metadata"
+	"github.com/seal-io/hermitcrab/pkg/registry"
+)
+
+// Product holds the upstream of the releases of a CLI.
+type Product struct {
+	// Name is the name of the CLI, which prefixes the release files,
+	// i.e. terraform_1.6.6_linux_amd64.zip.
+	Name string
+	// URL is the base URL of the releases,
+	// the files of a version are downloaded from <URL>/<VersionPrefix><VERSION>/<FILENAME>.
+	URL string
+	// VersionPrefix prefixes the version in the URL, i.e. v of the GitHub releases.
+	VersionPrefix string
+}
+
+// The names of the supported CLIs.
+const (
+	ProductTerraform = "terraform"
+	ProductTofu      = "tofu"
+)
+
+// DefaultProducts holds the upstreams of the supported CLIs.
+var DefaultProducts = []Product{
+	{
+		Name: ProductTerraform,
+		URL:  "https://releases.hashicorp.com/terraform",
+	},
+	{
+		Name:          ProductTofu,
+		URL:           "https://github.com/opentofu/opentofu/releases/download",
+		VersionPrefix: "v",
+	},
+}
+
+type (
+	// Version holds the index of a released version,
+	// which is in the format of https://releases.hashicorp.com/terraform/<VERSION>/index.json.
+	Version struct {
+		Name             string  `json:"name"`
+		Version          string  `json:"version"`
+		Shasums          string  `json:"shasums"`
+		ShasumsSignature string  `json:"shasums_signature,omitempty"`
+		Builds           []Build `json:"builds"`
+	}
+
+	// Build holds a released archive of a version.
+	Build struct {
+		Name     string `json:"name"`
+		Version  string `json:"version"`
+		OS       string `json:"os"`
+		Arch     string `json:"arch"`
+		Filename string `json:"filename"`
+		// URL is relative to the directory of the version.
+		URL    string `json:"url"`
+		Shasum string `json:"-"`
+	}
+
+	// File is a release file to serve.
+	File = runtime.ResponseFile
+)
+
+// Service holds the operation of mirroring the CLI releases,
+// the index of a version is derived from its SHA256SUMS file signed by the release keys of the product,
+// and all archives are verified by it, takes a look of the filesystem layer structure:
+//
+//	{product}
+//	└── {version}
+//	    ├── {product}_{version}_SHA256SUMS
+//	    ├── {product}_{version}_SHA256SUMS.sig
+//	    └── {product}_{version}_{os}_{arch}.zip
+type Service interface {
+	// GetVersions returns the cached versions of the given product in descending order.
+	GetVersions(ctx context.Context, product string) ([]Version, error)
+	// GetVersion returns the index of the given version, fetches from the upstream if not cached.
+	GetVersion(ctx context.Context, product, version string) (Version, error)
+	// LoadFile loads the given release file of the given version, fetches from the upstream if not cached.
+	LoadFile(ctx context.Context, product, version, filename string) (File, error)
+	// Mirror caches the archives of the given platforms of the given version,
+	// all archives are cached if no platform is specified.
+	Mirror(ctx context.Context, product, version string, platforms []string) error
+}
+
+// ServiceOptions holds the options of the release service.
+type ServiceOptions struct {
+	// Products holds the upstreams of the CLIs, default is DefaultProducts.
+	Products []Product
+	// SigningKeys holds the ASCII armored public keys signing the releases indexing by the product name,
+	// i.e. the HashiCorp and OpenTofu release keys,
+	// the releases of the product without the signing keys are not mirrored.
+	SigningKeys map[string]string
+	// Offline never fetches from the upstream, only the cached releases are served.
+	Offline bool
+}
+
+// NewService returns a new release service storing the files under the given directory.
+func NewService(dir string, opts ServiceOptions) (Service, error) {
+	if opts.Products == nil {
+		opts.Products = DefaultProducts
+	}
+
+	releaseDir := filepath.Join(dir, "releases")
+
+	err := os.MkdirAll(releaseDir, 0o755)
+	if err != nil {
+		return nil, fmt.Errorf("error creating releases directory: %w", err)
+	}
+
+	ps := make(map[string]Product, len(opts.Products))
+	for _, p := range opts.Products {
+		if _, err := url.Parse(p.URL); err != nil || p.Name == "" {
+			return nil, fmt.Errorf("invalid product %q", p.Name)
+		}
+
+		p.URL = strings.TrimSuffix(p.URL, "/")
+		ps[p.Name] = p
+	}
+
+	krs := make(map[string]openpgp.EntityList, len(opts.SigningKeys))
+	for n, k := range opts.SigningKeys {
+		if _, ok := ps[n]; !ok {
+			return nil, fmt.Errorf("invalid signing keys: unknown product %q", n)
+		}
+
+		kr, err := openpgp.ReadArmoredKeyRing(strings.NewReader(k))
+		if err != nil || len(kr) == 0 {
+			return nil, fmt.Errorf("invalid signing keys of product %q: %w", n, err)
+		}
+
+		krs[n] = kr
+	}
+
+	for n := range ps {
+		if _, ok := krs[n]; !ok {
+			log.WithName("release").
+				Warnf("releases of %s are not mirrored without the signing keys", n)
+		}
+	}
+
+	return &service{
+		dir:         releaseDir,
+		products:    ps,
+		keyrings:    krs,
+		offline:     opts.Offline,
+		downloadCli: download.NewClient(nil, 0),
+		locks:       map[string]*pathLock{},
+	}, nil
+}
+
+type service struct {
+	locksMu sync.Mutex
+	locks   map[string]*pathLock
+
+	// verified holds the directories of the versions whose SHA256SUMS is verified.
+	verified sync.Map
+
+	dir         string
+	products    map[string]Product
+	keyrings    map[string]openpgp.EntityList
+	offline     bool
+	downloadCli *download.Client
+}
+
+// pathLock is the lock of a path along with the number of its holders and waiters.
+type pathLock struct {
+	sync.Mutex
+
+	refs int
+}
+
+// regexValidVersion matches the released version, i.e. 1.6.6 and 1.7.0-beta1.
+var regexValidVersion = regexp.MustCompile(`^\d+\.\d+\.\d+(-[0-9A-Za-z.]+)?$`)
+
+// productOf returns the product of the given name and validates the given version.
+func (s *service) productOf(product, version string) (Product, error) {
+	p, ok := s.products[product]
+	if !ok {
+		return Product{}, errorx.HttpErrorf(http.StatusNotFound, "product %s is not mirrored", product)
+	}
+
+	if _, ok = s.keyrings[product]; !ok {
+		return Product{}, errorx.HttpErrorf(http.StatusNotFound,
+			"product %s is not mirrored without the signing keys", product)
+	}
+
+	if version != "" && !regexValidVersion.MatchString(version) {
+		return Product{}, errorx.HttpErrorf(http.StatusBadRequest, "invalid version %q", version)
+	}
+
+	return p, nil
+}
+
+// shasumsFilename returns the filename of the SHA256SUMS file of the given version.
+func shasumsFilename(product, version string) string {
+	return product + "_" + version + "_SHA256SUMS"
+}
+
+func (s *service) GetVersions(ctx context.Context, product string) ([]Version, error) {
+	if _, err := s.productOf(product, ""); err != nil {
+		return nil, err
+	}
+
+	es, err := os.ReadDir(filepath.Join(s.dir, product))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("error reading releases: %w", err)
+	}
+
+	vs := make([]Version, 0, len(es))
+
+	for _, e := range es {
+		if !e.IsDir() || !regexValidVersion.MatchString(e.Name()) {
+			continue
+		}
+
+		v, err := s.readVersion(product, e.Name())
+		if err != nil {
+			continue
+		}
+
+		vs = append(vs, v)
+	}
+
+	sort.SliceStable(vs, func(i, j int) bool {
+		a, aerr := semver.NewVersion(vs[i].Version)
+		b, berr := semver.NewVersion(vs[j].Version)
+
+		if aerr != nil || berr != nil {
+			return vs[i].Version > vs[j].Version
+		}
+
+		return a.GreaterThan(b)
+	})
+
+	return vs, nil
+}
+
+func (s *service) GetVersion(ctx context.Context, product, version string) (Version, error) {
+	p, err := s.productOf(product, version)
+	if err != nil {
+		return Version{}, err
+	}
+
+	v, err := s.readVersion(product, version)
+	if err == nil || !os.IsNotExist(err) && !errors.Is(err, errUnverified) {
+		return v, err
+	}
+
+	if s.offline {
+		if errors.Is(err, errUnverified) {
+			return Version{}, errorx.WrapHttpError(http.StatusBadGateway, err,
+				fmt.Sprintf("error verifying version %s of %s", version, product))
+		}
+
+		return Version{}, errorx.HttpErrorf(http.StatusNotFound,
+			"version %s of %s is not cached in offline mode", version, product)
+	}
+
+	d := filepath.Join(s.dir, product, version)
+	n := shasumsFilename(product, version)
+
+	unlock := s.lock(d)
+	defer unlock()
+
+	// Fetched by others while waiting.
+	v, err = s.readVersion(product, version)
+	switch {
+	case err == nil:
+		return v, nil
+	case errors.Is(err, errUnverified):
+		// Drop the untrusted files to fetch again.
+		dropShasums(d, n)
+	}
+
+	for _, f := range []string{n, n + ".sig"} {
+		err = s.fetch(ctx, p, version, f, "")
+		if err != nil {
+			return Version{}, errorx.WrapHttpError(http.StatusBadGateway, err,
+				fmt.Sprintf("error fetching version %s of %s", version, product))
+		}
+	}
+
+	v, err = s.readVersion(product, version)
+	if errors.Is(err, errUnverified) {
+		// Drop the untrusted files to fetch again on the next request.
+		dropShasums(d, n)
+
+		return Version{}, errorx.WrapHttpError(http.StatusBadGateway, err,
+			fmt.Sprintf("error verifying version %s of %s", version, product))
+	}
+
+	return v, err
+}
+
+// dropShasums removes the given SHA256SUMS file and its signature under the given directory.
+func dropShasums(d, n string) {
+	_ = os.Remove(filepath.Join(d, n))
+	_ = os.Remove(filepath.Join(d, n+".sig"))
+}
+
+// errUnverified indicates the SHA256SUMS file is not signed by the release keys of the product.
+var errUnverified = errors.New("unverified shasums")
+
+// verifyShasums verifies the detached signature of the given SHA256SUMS content
+// is made by the release keys of the given product.
+func (s *service) verifyShasums(product string, content, signature []byte) error {
+	_, err := openpgp.CheckDetachedSignature(s.keyrings[product], bytes.NewReader(content), bytes.NewReader(signature))
+	if err != nil {
+		return fmt.Errorf("%w: %v", errUnverified, err)
+	}
+
+	return nil
+}
+
+// readVersion reads the index of the given version from the cached SHA256SUMS file.
+func (s *service) readVersion(product, version string) (Version, error) {
+	d := filepath.Join(s.dir, product, version)
+	n := shasumsFilename(product, version)
+
+	content, err := os.ReadFile(filepath.Join(d, n))
+	if err != nil {
+		return Version{}, err
+	}
+
+	// Verify the cached files once, as the files of a version never change.
+	if _, ok := s.verified.Load(d); !ok {
+		signature, err := os.ReadFile(filepath.Join(d, n+".sig"))
+		if err != nil {
+			return Version{}, err
+		}
+
+		err = s.verifyShasums(product, content, signature)
+		if err != nil {
+			return Version{}, err
+		}
+
+		s.verified.Store(d, struct{}{})
+	}
+
+	sums, err := metadata.ParseShasums(content)
+	if err != nil {
+		return Version{}, fmt.Errorf("error parsing %s: %w", n, err)
+	}
+
+	v := Version{
+		Name:             product,
+		Version:          version,
+		Shasums:          n,
+		ShasumsSignature: n + ".sig",
+		Builds:           make([]Build, 0, len(sums)),
+	}
+
+	prefix := product + "_" + version + "_"
+
+	for f, sum := range sums {
+		platform, ok := strings.CutSuffix(strings.TrimPrefix(f, prefix), ".zip")
+		if !ok || !strings.HasPrefix(f, prefix) {
+			continue
+		}
+
+		goos, arch, ok := strings.Cut(platform, "_")
+		if !ok {
+			continue
+		}
+
+		v.Builds = append(v.Builds, Build{
+			Name:     product,
+			Version:  version,
+			OS:       goos,
+			Arch:     arch,
+			Filename: f,
+			URL:      f,
+			Shasum:   sum,
+		})
+	}
+
+	sort.Slice(v.Builds, func(i, j int) bool {
+		return v.Builds[i].Filename < v.Builds[j].Filename
+	})
+
+	return v, nil
+}
+
+func (s *service) LoadFile(ctx context.Context, product, version, filename string) (File, error) {
+	v, err := s.GetVersion(ctx, product, version)
+	if err != nil {
+		return File{}, err
+	}
+
+	var shasum string
+
+	switch filename {
+	case v.Shasums, v.ShasumsSignature:
+	default:
+		for _, b := range v.Builds {
+			if b.Filename == filename {
+				shasum = b.Shasum
+				break
+			}
+		}
+
+		if shasum == "" {
+			return File{}, errorx.HttpErrorf(http.StatusNotFound, "file %s is not released", filename)
+		}
+	}
+
+	p := filepath.Join(s.dir, product, version, filename)
+
+	if _, err = os.Stat(p); os.IsNotExist(err) {
+		if s.offline {
+			return File{}, errorx.HttpErrorf(http.StatusNotFound,
+				"file %s is not cached in offline mode", filename)
+		}
+
+		unlock := s.lock(p)
+		err = s.fetch(ctx, s.products[product], version, filename, shasum)
+		unlock()
+
+		if err != nil {
+			return File{}, errorx.WrapHttpError(http.StatusBadGateway, err,
+				fmt.Sprintf("error fetching file %s", filename))
+		}
+	}
+
+	f, err := os.Open(p)
+	if err != nil {
+		return File{}, fmt.Errorf("error opening file: %w", err)
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return File{}, fmt.Errorf("error stating file: %w", err)
+	}
+
+	return File{
+		ContentType:   runtime.ContentTypeOf(filename),
+		ContentLength: fi.Size(),
+		Filename:      filename,
+		Checksum:      shasum,
+		Reader:        f,
+	}, nil
+}
+
+func (s *service) Mirror(ctx context.Context, product, version string, platforms []string) error {
+	v, err := s.GetVersion(ctx, product, version)
+	if err != nil {
+		return err
+	}
+
+	for _, b := range v.Builds {
+		if len(platforms) != 0 && !slices.Contains(platforms, b.OS+"_"+b.Arch) {
+			continue
+		}
+
+		f, lerr := s.LoadFile(ctx, product, version, b.Filename)
+		if lerr != nil {
+			err = multierr.Append(err, lerr)
+			continue
+		}
+
+		_ = f.Close()
+	}
+
+	return err
+}
+
+// fetch downloads the given file of the given version from the upstream,
+// the downloaded file must match the given checksum if specified.
+func (s *service) fetch(ctx context.Context, p Product, version, filename, shasum string) error {
+	u := p.URL + "/" + path.Join(p.VersionPrefix+version, filename)
+
+	return s.downloadCli.Get(ctx, download.GetOptions{
+		DownloadURL: u,
+		Directory:   filepath.Join(s.dir, p.Name, version),
+		Filename:    filename,
+		Shasum:      shasum,
+		Authorize:   registry.AuthorizeRequest,
+	})
+}
+
+// lock locks the given path until the returned function is called,
+// so that only one request fetches the same file at a time,
+// the lock is released from the memory once no one holds or waits for it.
+func (s *service) lock(p string) func() {
+	s.locksMu.Lock()
+
+	l := s.locks[p]
+	if l == nil {
+		l = &pathLock{}
+		s.locks[p] = l
+	}
+	l.refs++
+
+	s.locksMu.Unlock()
+
+	l.Lock()
+
+	return func() {
+		l.Unlock()
+
+		s.locksMu.Lock()
+		defer s.locksMu.Unlock()
+
+		l.refs--
+		if l.refs == 0 {
+			delete(s.locks, p)
+		}
+	}
+}
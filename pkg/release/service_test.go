@@ -0,0 +1,146 @@
+package release
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+)
+
+// newSigningKey returns a new signing key along with its ASCII armored public key.
+func newSigningKey(t *testing.T) (*openpgp.Entity, string) {
+	t.Helper()
+
+	e, err := openpgp.NewEntity("release", "", "release@example.com", nil)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+
+	w, err := armor.Encode(&buf, openpgp.PublicKeyType, nil)
+	require.NoError(t, err)
+	require.NoError(t, e.Serialize(w))
+	require.NoError(t, w.Close())
+
+	return e, buf.String()
+}
+
+// sign returns the detached signature of the given content signed by the given key.
+func sign(t *testing.T, e *openpgp.Entity, content string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	require.NoError(t, openpgp.DetachSign(&buf, e, strings.NewReader(content), nil))
+
+	return buf.Bytes()
+}
+
+func TestService(t *testing.T) {
+	archive := []byte("terraform")
+	sum := sha256.Sum256(archive)
+
+	shasums := hex.EncodeToString(sum[:]) + "  terraform_1.6.6_linux_amd64.zip\n" +
+		hex.EncodeToString(sum[:]) + "  terraform_1.6.6_darwin_arm64.zip\n"
+
+	key, armored := newSigningKey(t)
+	other, _ := newSigningKey(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1.6.6/terraform_1.6.6_SHA256SUMS", "/v1.6.7/terraform_1.6.7_SHA256SUMS":
+			_, _ = w.Write([]byte(shasums))
+		case "/v1.6.6/terraform_1.6.6_SHA256SUMS.sig":
+			_, _ = w.Write(sign(t, key, shasums))
+		case "/v1.6.7/terraform_1.6.7_SHA256SUMS.sig":
+			// Signed by an unexpected key.
+			_, _ = w.Write(sign(t, other, shasums))
+		case "/v1.6.6/terraform_1.6.6_linux_amd64.zip":
+			_, _ = w.Write(archive)
+		case "/v1.6.6/terraform_1.6.6_darwin_arm64.zip":
+			_, _ = w.Write([]byte("tampered"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	products := []Product{
+		{Name: ProductTerraform, URL: srv.URL, VersionPrefix: "v"},
+		{Name: ProductTofu, URL: srv.URL, VersionPrefix: "v"},
+	}
+
+	s, err := NewService(dir, ServiceOptions{
+		Products:    products,
+		SigningKeys: map[string]string{ProductTerraform: armored},
+	})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+
+	// The product without the signing keys is not mirrored.
+	_, err = s.GetVersion(ctx, ProductTofu, "1.6.2")
+	assert.Error(t, err)
+
+	// The version signed by the unexpected key is refused.
+	_, err = s.GetVersion(ctx, ProductTerraform, "1.6.7")
+	assert.ErrorIs(t, err, errUnverified)
+	assert.NoFileExists(t, dir+"/releases/terraform/1.6.7/terraform_1.6.7_SHA256SUMS")
+
+	v, err := s.GetVersion(ctx, ProductTerraform, "1.6.6")
+	require.NoError(t, err)
+	assert.Equal(t, "terraform_1.6.6_SHA256SUMS", v.Shasums)
+	assert.Equal(t, "terraform_1.6.6_SHA256SUMS.sig", v.ShasumsSignature)
+	require.Len(t, v.Builds, 2)
+	assert.Equal(t, "darwin", v.Builds[0].OS)
+	assert.Equal(t, "arm64", v.Builds[0].Arch)
+
+	f, err := s.LoadFile(ctx, ProductTerraform, "1.6.6", "terraform_1.6.6_linux_amd64.zip")
+	require.NoError(t, err)
+
+	content, err := io.ReadAll(f.Reader)
+	_ = f.Close()
+	require.NoError(t, err)
+	assert.Equal(t, archive, content)
+
+	// The archive mismatched the SHA256SUMS is refused.
+	_, err = s.LoadFile(ctx, ProductTerraform, "1.6.6", "terraform_1.6.6_darwin_arm64.zip")
+	assert.Error(t, err)
+
+	// The file not listed in the SHA256SUMS is not served.
+	_, err = s.LoadFile(ctx, ProductTerraform, "1.6.6", "terraform_1.6.6_linux_386.zip")
+	assert.Error(t, err)
+
+	_, err = s.GetVersion(ctx, ProductTerraform, "../1.6.6")
+	assert.Error(t, err)
+
+	vs, err := s.GetVersions(ctx, ProductTerraform)
+	require.NoError(t, err)
+	require.Len(t, vs, 1)
+	assert.Equal(t, "1.6.6", vs[0].Version)
+
+	// The cached version is verified again after restarting.
+	_, otherArmored := newSigningKey(t)
+
+	s, err = NewService(dir, ServiceOptions{
+		Products:    products,
+		SigningKeys: map[string]string{ProductTerraform: otherArmored},
+		Offline:     true,
+	})
+	require.NoError(t, err)
+
+	_, err = s.GetVersion(ctx, ProductTerraform, "1.6.6")
+	assert.ErrorIs(t, err, errUnverified)
+
+	// The locks are released from the memory.
+	assert.Empty(t, s.(*service).locks)
+}
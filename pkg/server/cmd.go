@@ -1,7 +1,12 @@
 package server
 
 import (
+	"github.com/seal-io/walrus/utils/clis"
 	"github.com/urfave/cli/v2"
+
+	"github.com/seal-io/hermitcrab/pkg/registry/fake"
+	"github.com/seal-io/hermitcrab/pkg/smoke"
+	"github.com/seal-io/hermitcrab/pkg/support"
 )
 
 func Command() *cli.Command {
@@ -11,6 +16,23 @@ func Command() *cli.Command {
 	server.Before(&cmd)
 	server.Action(&cmd)
 	cmd.Name = "server"
+	cmd.Subcommands = []*cli.Command{
+		fake.Command(),
+		server.RebuildMetadataCommand(),
+		smoke.Command(),
+		support.Command(),
+	}
 
 	return &cmd
 }
+
+// App returns the application of the given command,
+// which keeps the comma within the slice flag values,
+// i.e. --registry-upstreams=gitlab.example.com=gitlab,group=infra,token-type=job,
+// the flags listing the plain items split the comma separated items by themselves.
+func App(cmd *cli.Command) *cli.App {
+	app := clis.AsApp(cmd)
+	app.DisableSliceFlagSeparator = true
+
+	return app
+}
@@ -12,10 +12,12 @@ import (
 
 	"github.com/seal-io/hermitcrab/pkg/database"
 	"github.com/seal-io/hermitcrab/pkg/provider"
+	"github.com/seal-io/hermitcrab/pkg/release"
 )
 
 type initOptions struct {
 	ProviderService *provider.Service
+	ReleaseService  release.Service
 	SkipTLSVerify   bool
 	BoltDriver      database.BoltDriver
 }
@@ -7,6 +7,7 @@ import (
 
 	"github.com/seal-io/hermitcrab/pkg/database"
 	"github.com/seal-io/hermitcrab/pkg/health"
+	"github.com/seal-io/hermitcrab/pkg/provider/storage"
 )
 
 // registerHealthCheckers registers the health checkers into the global health registry.
@@ -14,6 +15,7 @@ func (r *Server) registerHealthCheckers(ctx context.Context, opts initOptions) e
 	cs := health.Checkers{
 		health.CheckerFunc("database", getDatabaseHealthChecker(opts.BoltDriver)),
 		health.CheckerFunc("gopool", getGoPoolHealthChecker()),
+		health.CheckerFunc("storage", getStorageHealthChecker(opts.ProviderService.Storage)),
 	}
 
 	return health.Register(ctx, cs)
@@ -30,3 +32,9 @@ func getGoPoolHealthChecker() health.Check {
 		return gopool.IsHealthy()
 	}
 }
+
+func getStorageHealthChecker(s storage.Service) health.Check {
+	return func(ctx context.Context) error {
+		return s.IsWritable(ctx)
+	}
+}
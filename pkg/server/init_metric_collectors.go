@@ -9,15 +9,26 @@ import (
 	"github.com/seal-io/hermitcrab/pkg/apis/runtime"
 	"github.com/seal-io/hermitcrab/pkg/database"
 	"github.com/seal-io/hermitcrab/pkg/metric"
+	"github.com/seal-io/hermitcrab/pkg/provider/metadata"
+	"github.com/seal-io/hermitcrab/pkg/provider/storage"
+	"github.com/seal-io/hermitcrab/pkg/registry"
 )
 
 // registerMetricCollectors registers the metric collectors into the global metric registry.
 func (r *Server) registerMetricCollectors(ctx context.Context, opts initOptions) error {
 	cs := metric.Collectors{
-		database.NewStatsCollectorWith(opts.BoltDriver),
+		database.NewStatsCollectorWith(opts.BoltDriver, database.BucketStatsOptions{
+			Interval: database.DefaultBucketStatsInterval,
+			Depth:    r.MetricsBucketDepth,
+		}),
 		gopool.NewStatsCollector(),
 		cron.NewStatsCollector(),
 		runtime.NewStatsCollector(),
+		registry.NewClockSkewCollector(),
+		registry.NewRateLimitCollector(),
+		metadata.NewStatsCollector(opts.BoltDriver),
+		metadata.NewShadowCollector(),
+		storage.NewStatsCollector(),
 	}
 
 	return metric.Register(ctx, cs)
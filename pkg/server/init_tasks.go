@@ -5,8 +5,12 @@ import (
 	"fmt"
 
 	"github.com/seal-io/walrus/utils/cron"
+	"github.com/seal-io/walrus/utils/gopool"
 
+	"github.com/seal-io/hermitcrab/pkg/provider/export"
+	"github.com/seal-io/hermitcrab/pkg/registry"
 	"github.com/seal-io/hermitcrab/pkg/tasks/provider"
+	"github.com/seal-io/hermitcrab/pkg/tasks/release"
 )
 
 // startTasks starts the tasks by Cron Expression to do something periodically in background.
@@ -19,6 +23,62 @@ func (r *Server) startTasks(ctx context.Context, opts initOptions) (err error) {
 
 	// Register tasks.
 	err = cron.Schedule(provider.SyncMetadata(ctx, opts.ProviderService))
+	if err != nil {
+		return
+	}
+
+	err = cron.Schedule(provider.CheckClockSkew(ctx))
+	if err != nil {
+		return
+	}
+
+	err = cron.Schedule(provider.CheckDrift(ctx, opts.ProviderService, r.DriftAutoRepair))
+	if err != nil {
+		return
+	}
+
+	if r.StaleDownloadThreshold > 0 {
+		err = cron.Schedule(provider.RemoveStaleDownloads(ctx, opts.ProviderService, r.StaleDownloadThreshold))
+		if err != nil {
+			return
+		}
+	}
+
+	if r.ExportOCIRegistry != "" {
+		exporter := export.NewOCI(opts.ProviderService.Storage, export.OCIOptions{
+			Registry:   r.ExportOCIRegistry,
+			Repository: r.ExportOCIRepository,
+			PlainHTTP:  r.ExportOCIPlainHTTP,
+			Credential: registry.Token(r.ExportOCIRegistry),
+		})
+
+		err = cron.Schedule(provider.ExportOCI(ctx, exporter))
+		if err != nil {
+			return
+		}
+	}
+
+	if len(r.ReplicateTo) != 0 {
+		var replica *export.Replica
+
+		replica, err = export.NewReplica(opts.ProviderService.Metadata, opts.ProviderService.Storage,
+			export.ReplicaOptions{
+				Targets:            r.ReplicateTo,
+				InsecureSkipVerify: r.ReplicateInsecureSkipVerify,
+			})
+		if err != nil {
+			return fmt.Errorf("error creating replica: %w", err)
+		}
+
+		gopool.Go(func() { replica.Run(ctx) })
+	}
+
+	if len(r.MirrorReleases) != 0 {
+		err = cron.Schedule(release.Mirror(ctx, opts.ReleaseService, r.MirrorReleases))
+		if err != nil {
+			return
+		}
+	}
 
 	return
 }
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/seal-io/walrus/utils/gopool"
+	"github.com/seal-io/walrus/utils/log"
+	"github.com/urfave/cli/v2"
+
+	"github.com/seal-io/hermitcrab/pkg/database"
+	"github.com/seal-io/hermitcrab/pkg/provider"
+)
+
+// RebuildMetadataCommand returns the `rebuild-metadata` command to rebuild the metadata from the cached archives,
+// which shares the flags of the server, i.e. hermitcrab --data-source-dir=/var/run/hermitcrab rebuild-metadata.
+func (r *Server) RebuildMetadataCommand() *cli.Command {
+	return &cli.Command{
+		Name: "rebuild-metadata",
+		Usage: "Rebuild the metadata of the cached provider archives, i.e. after metadata.db is lost, " +
+			"the platforms are synced from the upstream unless --offline, " +
+			"otherwise, derived from the archives.",
+		Action: func(c *cli.Context) error {
+			return r.RebuildMetadata(c.Context)
+		},
+	}
+}
+
+// RebuildMetadata rebuilds the metadata of the cached provider archives and exits.
+func (r *Server) RebuildMetadata(c context.Context) error {
+	if err := r.configure(); err != nil {
+		return fmt.Errorf("error configuring: %w", err)
+	}
+
+	c, cancel := context.WithCancel(c)
+	defer cancel()
+
+	g, ctx := gopool.GroupWithContext(c)
+
+	// Load database driver.
+	var bolt database.Bolt
+
+	g.Go(func() error {
+		return bolt.Run(ctx, r.DataSourceDir, r.DataSourceLockMemory)
+	})
+
+	providerService, err := provider.NewService(bolt.GetDriver(), r.DataSourceDir, provider.Options{
+		// Never prune the versions, which deletes the cached archives.
+		MaxVersionsPerProvider: 0,
+		CacheFileMode:          r.CacheFileMode,
+		CacheDirMode:           r.CacheDirMode,
+		Offline:                r.Offline,
+		MetadataPlatformLayout: r.MetadataPlatformLayout,
+		ImpliedDirError:        r.ImpliedDirError,
+		// Only sync the platforms of the cached archives.
+		EagerPlatformSync: []string{},
+	})
+	if err != nil {
+		return fmt.Errorf("error creating provider service: %w", err)
+	}
+
+	log.Info("rebuilding metadata")
+
+	res, err := providerService.RebuildMetadata(ctx)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("rebuilt metadata of %d archives, %d synced, %d derived, %d skipped",
+		res.Archives, res.Synced, res.Published, res.Skipped)
+
+	// Close the database.
+	cancel()
+
+	err = g.Wait()
+	if err != nil && !errors.Is(err, context.Canceled) {
+		return err
+	}
+
+	return nil
+}
@@ -7,10 +7,15 @@ import (
 	"fmt"
 	stdlog "log"
 	"net"
+	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/Masterminds/semver/v3"
 	"github.com/seal-io/walrus/utils/clis"
 	"github.com/seal-io/walrus/utils/files"
 	"github.com/seal-io/walrus/utils/gopool"
@@ -18,17 +23,39 @@ import (
 	"github.com/seal-io/walrus/utils/runtimex"
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli/v2"
+	"go.uber.org/zap"
 	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/apimachinery/pkg/util/validation/field"
 	"k8s.io/klog/v2"
 
+	"github.com/seal-io/hermitcrab/pkg/apis"
+	"github.com/seal-io/hermitcrab/pkg/apis/rpc"
+	"github.com/seal-io/hermitcrab/pkg/chaos"
 	"github.com/seal-io/hermitcrab/pkg/consts"
 	"github.com/seal-io/hermitcrab/pkg/database"
+	"github.com/seal-io/hermitcrab/pkg/download"
+	"github.com/seal-io/hermitcrab/pkg/maintenance"
+	"github.com/seal-io/hermitcrab/pkg/policy"
 	"github.com/seal-io/hermitcrab/pkg/provider"
+	"github.com/seal-io/hermitcrab/pkg/provider/docs"
+	"github.com/seal-io/hermitcrab/pkg/provider/metadata"
+	"github.com/seal-io/hermitcrab/pkg/provider/storage"
+	"github.com/seal-io/hermitcrab/pkg/redact"
+	"github.com/seal-io/hermitcrab/pkg/registry"
+	"github.com/seal-io/hermitcrab/pkg/release"
+	"github.com/seal-io/hermitcrab/pkg/support"
+	"github.com/seal-io/hermitcrab/pkg/tunable"
+)
+
+// The formats of logging.
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
 )
 
 type Server struct {
-	Logger clis.Logger
+	Logger    clis.Logger
+	LogFormat string
 
 	BindAddress           string
 	BindWithDualStack     bool
@@ -41,13 +68,76 @@ type Server struct {
 	ConnBurst             int
 	WebsocketConnMaxPerIP int
 	GopoolWorkerFactor    int
+	GrpcBindAddress       string
+	AdminToken            string
+	AdminV1Sunset         time.Time
+	SyncCooldown          time.Duration
+	SlowRequestThreshold  time.Duration
+	MetricsBucketDepth    int
+	MetricsBindAddress    string
+	MetricsBasicAuth      string
+	CORSAllowOrigins      []string
+	CORSAllowMethods      []string
+	CORSAllowHeaders      []string
+	TrustedProxies        []string
 
 	DataSourceDir        string
 	DataSourceLockMemory bool
+	DataScratchDir       string
+
+	MaxVersionsPerProvider int
+	EvictionWebhook        string
+	VerifyOnServe          bool
+	ChecksumH1             bool
+	MaxConcurrentDownloads int
+	DriftAutoRepair        bool
+	StartupScan            string
+	StaleDownloadThreshold time.Duration
+	CacheFileMode          os.FileMode
+	CacheDirMode           os.FileMode
+	CacheOwner             *storage.Owner
+	Offline                bool
+	StartInMaintenance     bool
+	InferPlatforms         bool
+	MetadataPlatformLayout string
+	DocsCacheTTL           time.Duration
+	ImpliedDirError        string
+	EagerPlatformSync      []string
+	Protocols              []string
+	HideRemovedVersions    bool
+	UpstreamBudget         time.Duration
+	VersionsSoftTTL        time.Duration
+	ShadowSampleRate       float64
+	ProbeUnlistedPlatforms bool
+	CanaryToken            string
+	ServablePlatformsOnly  bool
+	ArtifactURLs           bool
+	PrefetchNewReleases    bool
+	Peers                  []string
+
+	RegistryTerraformVersion string
+	RegistryCredentialsFile  string
+	RegistryDiscoveryTTL     time.Duration
+	RegistryUpstreams        []registry.Upstream
+	RegistryFaults           chaos.Faults
+
+	PolicyFile string
+
+	ExportOCIRegistry   string
+	ExportOCIRepository string
+	ExportOCIPlainHTTP  bool
+
+	ReplicateTo                 []string
+	ReplicateInsecureSkipVerify bool
+
+	MirrorReleases     []string
+	ReleaseSigningKeys map[string]string
 }
 
 func New() *Server {
 	return &Server{
+		LogFormat: LogFormatText,
+
 		BindAddress:           "0.0.0.0",
 		BindWithDualStack:     true,
 		EnableTls:             true,
@@ -56,9 +146,27 @@ func New() *Server {
 		ConnBurst:             200,
 		WebsocketConnMaxPerIP: 25,
 		GopoolWorkerFactor:    100,
+		CORSAllowMethods:      []string{http.MethodGet, http.MethodHead},
+		CORSAllowHeaders:      []string{"Authorization", "Content-Type"},
+		SyncCooldown:          time.Minute,
+		MetricsBucketDepth:    database.DefaultBucketStatsDepth,
 
 		DataSourceDir:        filepath.Join(consts.DataDir, "data"),
 		DataSourceLockMemory: false,
+
+		MaxConcurrentDownloads: 32,
+		StartupScan:            storage.StartupScanOff,
+		MetadataPlatformLayout: metadata.PlatformLayoutNested,
+		DocsCacheTTL:           docs.DefaultTTL,
+		ImpliedDirError:        storage.ImpliedDirErrorWarn,
+		EagerPlatformSync:      metadata.DefaultEagerPlatformSync,
+		VersionsSoftTTL:        metadata.DefaultSoftTTL,
+		StaleDownloadThreshold: 24 * time.Hour,
+		CacheFileMode:          storage.DefaultFileMode,
+		CacheDirMode:           storage.DefaultDirMode,
+
+		RegistryTerraformVersion: "1.5.7",
+		RegistryDiscoveryTTL:     registry.DefaultDiscoveryTTL,
 	}
 }
 
@@ -147,6 +255,10 @@ func (r *Server) Flags(cmd *cli.Command) {
 				"and saved to the directory specified by --tls-cert-dir. " +
 				"If --tls-cert-file and --tls-key-file are provided, this flag will be ignored.",
 			Action: func(c *cli.Context, v []string) error {
+				// The slice flags are not separated by comma,
+				// see App.
+				v = splitCommaSeparated(v)
+
 				f := field.NewPath("--tls-auto-cert-domains")
 				for i := range v {
 					if err := validation.IsFullyQualifiedDomainName(f, v[i]).ToAggregate(); err != nil {
@@ -194,6 +306,197 @@ func (r *Server) Flags(cmd *cli.Command) {
 			Destination: &r.GopoolWorkerFactor,
 			Value:       r.GopoolWorkerFactor,
 		},
+		&cli.StringFlag{
+			Name: "grpc-bind-address",
+			Usage: "The address on which to serve the admin gRPC service with reflection, " +
+				"i.e. 127.0.0.1:9090, disabled if blank.",
+			Destination: &r.GrpcBindAddress,
+			Value:       r.GrpcBindAddress,
+			Action: func(c *cli.Context, s string) error {
+				if s == "" {
+					return nil
+				}
+				if _, _, err := net.SplitHostPort(s); err != nil {
+					return fmt.Errorf("--grpc-bind-address: %w", err)
+				}
+				return nil
+			},
+		},
+		&cli.StringFlag{
+			Name: "admin-token",
+			Usage: "The bearer token to access the admin services, " +
+				"only the local clients are allowed to access if blank.",
+			EnvVars:     []string{"HERMITCRAB_ADMIN_TOKEN"},
+			Destination: &r.AdminToken,
+			Value:       r.AdminToken,
+		},
+		&cli.StringFlag{
+			Name: "admin-v1-sunset",
+			Usage: "The date in form of YYYY-MM-DD when the deprecated admin services under /v1/admin stop serving, " +
+				"which is announced by the Sunset header, the successors are served under /v2/admin.",
+			Action: func(c *cli.Context, s string) error {
+				if s == "" {
+					return nil
+				}
+
+				t, err := time.Parse(time.DateOnly, s)
+				if err != nil {
+					return fmt.Errorf("--admin-v1-sunset: invalid date: %w", err)
+				}
+
+				r.AdminV1Sunset = t
+
+				return nil
+			},
+		},
+		&cli.DurationFlag{
+			Name: "sync-cooldown",
+			Usage: "The minimum interval between the manual synchronizations triggered by the same client, " +
+				"which are authorized as the admin services, unlimited if zero.",
+			Action: func(c *cli.Context, d time.Duration) error {
+				if d < 0 {
+					return errors.New("--sync-cooldown: must not be negative")
+				}
+
+				return nil
+			},
+			Destination: &r.SyncCooldown,
+			Value:       r.SyncCooldown,
+		},
+		&cli.StringFlag{
+			Name: "canary-token",
+			Usage: "The token presented by the clients via the X-Canary-Token header or the bearer token " +
+				"to see the provider versions marked as canary, " +
+				"the canary versions are hidden from all clients if blank.",
+			EnvVars:     []string{"HERMITCRAB_CANARY_TOKEN"},
+			Destination: &r.CanaryToken,
+			Value:       r.CanaryToken,
+		},
+		&cli.BoolFlag{
+			Name: "servable-platforms-only",
+			Usage: "List only the platforms served by the platforms of the policy in the version metadata, " +
+				"so that the clients never try to download the refused archives, " +
+				"all platforms are listed by default to keep the hashes of the lock files complete.",
+			Destination: &r.ServablePlatformsOnly,
+			Value:       r.ServablePlatformsOnly,
+		},
+		&cli.BoolFlag{
+			Name: "artifact-urls",
+			Usage: "List the archives with the known checksums by the content addressed URLs, " +
+				"i.e. /v1/artifacts/sha256/<DIGEST>, in the version metadata, " +
+				"which are responded with the immutable cache headers for the CDN to offload.",
+			Destination: &r.ArtifactURLs,
+			Value:       r.ArtifactURLs,
+		},
+		&cli.BoolFlag{
+			Name: "prefetch-new-releases",
+			Usage: "Prefetch the archives of the new release discovered by syncing in background, " +
+				"for the platforms the clients downloaded the provider previously, " +
+				"so that the first terraform init after the release hits the cache.",
+			Destination: &r.PrefetchNewReleases,
+			Value:       r.PrefetchNewReleases,
+		},
+		&cli.StringSliceFlag{
+			Name: "cors-allow-origins",
+			Usage: "The origins allowed to access the metadata and admin services from browsers, " +
+				"i.e. https://portal.example.com, the * allows any origin, disabled if blank.",
+			Action: func(c *cli.Context, v []string) error {
+				r.CORSAllowOrigins = splitCommaSeparated(v)
+				return nil
+			},
+			Value: cli.NewStringSlice(r.CORSAllowOrigins...),
+		},
+		&cli.StringSliceFlag{
+			Name:  "cors-allow-methods",
+			Usage: "The methods allowed to access from browsers, works with --cors-allow-origins.",
+			Action: func(c *cli.Context, v []string) error {
+				v = splitCommaSeparated(v)
+				for i := range v {
+					v[i] = strings.ToUpper(v[i])
+				}
+				r.CORSAllowMethods = v
+				return nil
+			},
+			Value: cli.NewStringSlice(r.CORSAllowMethods...),
+		},
+		&cli.StringSliceFlag{
+			Name:  "cors-allow-headers",
+			Usage: "The request headers allowed to carry from browsers, works with --cors-allow-origins.",
+			Action: func(c *cli.Context, v []string) error {
+				r.CORSAllowHeaders = splitCommaSeparated(v)
+				return nil
+			},
+			Value: cli.NewStringSlice(r.CORSAllowHeaders...),
+		},
+		&cli.StringSliceFlag{
+			Name: "trusted-proxies",
+			Usage: "The IPs or CIDRs of the trusted proxies(i.e. load balancers), " +
+				"the client IP is extracted from the X-Forwarded-For or X-Real-IP header of the requests from them, " +
+				"trust none if blank.",
+			Action: func(c *cli.Context, v []string) error {
+				v = splitCommaSeparated(v)
+				for i := range v {
+					if net.ParseIP(v[i]) != nil {
+						continue
+					}
+
+					if _, _, err := net.ParseCIDR(v[i]); err != nil {
+						return fmt.Errorf("--trusted-proxies: invalid IP or CIDR %q", v[i])
+					}
+				}
+				r.TrustedProxies = v
+
+				return nil
+			},
+		},
+		&cli.DurationFlag{
+			Name: "slow-request-threshold",
+			Usage: "Warn the request exceeding the threshold with the timing breakdown, " +
+				"i.e. 10s, disabled if zero.",
+			Destination: &r.SlowRequestThreshold,
+			Value:       r.SlowRequestThreshold,
+		},
+		&cli.StringFlag{
+			Name: "metrics-bind-address",
+			Usage: "The address on which to serve the metrics and pprof separately from the public services, " +
+				"i.e. 127.0.0.1:9100, served along with the public services if blank.",
+			Destination: &r.MetricsBindAddress,
+			Value:       r.MetricsBindAddress,
+			Action: func(c *cli.Context, s string) error {
+				if s == "" {
+					return nil
+				}
+				if _, _, err := net.SplitHostPort(s); err != nil {
+					return fmt.Errorf("--metrics-bind-address: %w", err)
+				}
+				return nil
+			},
+		},
+		&cli.StringFlag{
+			Name: "metrics-basic-auth",
+			Usage: "The basic auth credentials in form of <USERNAME>:<PASSWORD> to access the metrics, " +
+				"which also opens the pprof to the remote clients with --metrics-bind-address, " +
+				"the metrics are not authenticated if blank.",
+			Destination: &r.MetricsBasicAuth,
+			Value:       r.MetricsBasicAuth,
+			Action: func(c *cli.Context, s string) error {
+				if s == "" {
+					return nil
+				}
+				if u, _, ok := strings.Cut(s, ":"); !ok || u == "" {
+					return errors.New("invalid --metrics-basic-auth: must be in form of <USERNAME>:<PASSWORD>")
+				}
+				return nil
+			},
+		},
+		&cli.IntFlag{
+			Name: "metrics-bucket-depth",
+			Usage: "The maximum depth of the bolt buckets exposed by the metrics, " +
+				"i.e. 2 exposes the domain buckets and the typed providers, " +
+				"the deeper buckets are aggregated into their ancestors to limit the cardinality, unlimited if not positive.",
+			Destination: &r.MetricsBucketDepth,
+			Value:       r.MetricsBucketDepth,
+		},
 		&cli.StringFlag{
 			Name:  "data-source-dir",
 			Usage: "The directory where the data are stored.",
@@ -217,6 +520,516 @@ func (r *Server) Flags(cmd *cli.Command) {
 			Destination: &r.DataSourceLockMemory,
 			Value:       r.DataSourceLockMemory,
 		},
+		&cli.StringFlag{
+			Name: "data-scratch-dir",
+			Usage: "The directory where the in-progress downloads are stored, i.e. a fast local volume, " +
+				"the completed archives are moved into the data source directory atomically, " +
+				"which reduces the write amplification when the data source directory is on a networked volume.",
+			Action: func(c *cli.Context, s string) error {
+				if s != "" && !filepath.IsAbs(s) {
+					return errors.New("--data-scratch-dir: must be absolute path")
+				}
+
+				return nil
+			},
+			Destination: &r.DataScratchDir,
+			Value:       r.DataScratchDir,
+		},
+		&cli.IntFlag{
+			Name: "max-versions-per-provider",
+			Usage: "The maximum number of versions retained per provider, " +
+				"the oldest versions and their archives are pruned during syncing, unlimited if 0.",
+			Action: func(c *cli.Context, i int) error {
+				if i < 0 {
+					return errors.New("--max-versions-per-provider: must not be negative")
+				}
+				return nil
+			},
+			Destination: &r.MaxVersionsPerProvider,
+			Value:       r.MaxVersionsPerProvider,
+		},
+		&cli.StringFlag{
+			Name: "eviction-webhook",
+			Usage: "The URL to notify with a POST request when the archives are evicted, " +
+				"the body is a JSON of the reason and the evicted archives.",
+			Action: func(c *cli.Context, s string) error {
+				if s == "" {
+					return nil
+				}
+
+				u, err := url.Parse(s)
+				if err != nil {
+					return fmt.Errorf("--eviction-webhook: %w", err)
+				}
+
+				if u.Scheme != "http" && u.Scheme != "https" {
+					return errors.New("--eviction-webhook: must be http or https URL")
+				}
+
+				return nil
+			},
+			Destination: &r.EvictionWebhook,
+			Value:       r.EvictionWebhook,
+		},
+		&cli.IntFlag{
+			Name: "max-concurrent-downloads",
+			Usage: "The maximum number of concurrent downloads from the upstream, " +
+				"the user-facing downloads preempt the background downloads(i.e. prewarming, repairing) if exceeding, " +
+				"unlimited if not positive.",
+			Destination: &r.MaxConcurrentDownloads,
+			Value:       r.MaxConcurrentDownloads,
+		},
+		&cli.BoolFlag{
+			Name: "drift-auto-repair",
+			Usage: "Repair the drift between the metadata and the cached archives daily, " +
+				"the orphaned archives are removed, the mismatched and missing popular archives are re-fetched.",
+			Destination: &r.DriftAutoRepair,
+			Value:       r.DriftAutoRepair,
+		},
+		&cli.StringFlag{
+			Name: "startup-scan",
+			Usage: "The mode of scanning the cached archives on start to rebuild the access index " +
+				"and remove the leftover downloading archives, select from full, fast or off, " +
+				"the fast mode only scans the provider directories changed since the last scan.",
+			Action: func(c *cli.Context, s string) error {
+				switch s {
+				case storage.StartupScanFull, storage.StartupScanFast, storage.StartupScanOff:
+					return nil
+				}
+				return errors.New("--startup-scan: must be full, fast or off")
+			},
+			Destination: &r.StartupScan,
+			Value:       r.StartupScan,
+		},
+		&cli.DurationFlag{
+			Name: "stale-download-threshold",
+			Usage: "The duration after which the unfinished downloading archives are removed hourly, " +
+				"disabled if not positive.",
+			Destination: &r.StaleDownloadThreshold,
+			Value:       r.StaleDownloadThreshold,
+		},
+		&cli.StringFlag{
+			Name: "metadata-platform-layout",
+			Usage: "The layout of storing the platforms of a provider version in the metadata, select from nested or inline, " +
+				"the inline layout stores all platforms of a version in a single JSON, " +
+				"which reduces the keys and the size of the metadata for the providers with many platforms " +
+				"at the cost of slower platform lookups, the stored platforms are migrated on start if changed.",
+			Action: func(c *cli.Context, s string) error {
+				switch s {
+				case metadata.PlatformLayoutNested, metadata.PlatformLayoutInline:
+					return nil
+				}
+				return errors.New("--metadata-platform-layout: must be nested or inline")
+			},
+			Destination: &r.MetadataPlatformLayout,
+			Value:       r.MetadataPlatformLayout,
+		},
+		&cli.DurationFlag{
+			Name: "docs-cache-ttl",
+			Usage: "The duration of caching the provider documentation proxied from the registry v2 API " +
+				"before re-fetching, the expired one is served if the upstream is unavailable.",
+			Destination: &r.DocsCacheTTL,
+			Value:       r.DocsCacheTTL,
+		},
+		&cli.StringSliceFlag{
+			Name: "eager-platform-sync",
+			Usage: "The providers whose platforms of the newest versions are synced in background after syncing the versions, " +
+				"in form of [<HOSTNAME>/]<NAMESPACE>/<TYPE> with the shell globs, i.e. hashicorp/aws or hashicorp/*, " +
+				"the other providers sync the platforms on demand to save the upstream rate limits, disabled if blank.",
+			Action: func(c *cli.Context, v []string) error {
+				r.EagerPlatformSync = splitCommaSeparated(v)
+				return nil
+			},
+			Value: cli.NewStringSlice(r.EagerPlatformSync...),
+		},
+		&cli.StringSliceFlag{
+			Name: "protocols",
+			Usage: "The major versions of the plugin protocols used by the clients, i.e. 5,6, " +
+				"the provider versions only supporting the other protocols are not synced to reduce the metadata, " +
+				"all versions are synced if blank.",
+			Action: func(c *cli.Context, v []string) error {
+				r.Protocols = splitCommaSeparated(v)
+				return nil
+			},
+		},
+		&cli.BoolFlag{
+			Name: "hide-removed-versions",
+			Usage: "Hide the provider versions removed from the upstream, which respond 410, " +
+				"otherwise, the cached platforms and archives of them are still served.",
+			Destination: &r.HideRemovedVersions,
+			Value:       r.HideRemovedVersions,
+		},
+		&cli.DurationFlag{
+			Name: "upstream-budget",
+			Usage: "The maximum duration of the upstream calls of a client request, " +
+				"the request responds 503 with the Retry-After if exceeded while the syncing continues in background, " +
+				"i.e. 8s to stay below the timeout of the clients, unlimited if not positive.",
+			Destination: &r.UpstreamBudget,
+			Value:       r.UpstreamBudget,
+		},
+		&cli.DurationFlag{
+			Name: "versions-soft-ttl",
+			Usage: "The age of the stored versions of a provider, " +
+				"beyond which reading the index triggers refreshing in background without blocking the reader, " +
+				"so that the new releases show up before the next scheduled sync, disabled if not positive.",
+			Destination: &r.VersionsSoftTTL,
+			Value:       r.VersionsSoftTTL,
+		},
+		&cli.Float64Flag{
+			Name: "shadow-sample-rate",
+			Usage: "The ratio of the metadata requests served from the cache, " +
+				"which are compared against the upstream in background to detect the silent staleness or corruption, " +
+				"the divergences are reported by the provider_shadow_* metrics, i.e. 0.01, disabled if not positive.",
+			Destination: &r.ShadowSampleRate,
+			Value:       r.ShadowSampleRate,
+			Action: func(c *cli.Context, f float64) error {
+				if f < 0 || f > 1 {
+					return errors.New("--shadow-sample-rate: must be in range of [0, 1]")
+				}
+				return nil
+			},
+		},
+		&cli.BoolFlag{
+			Name: "probe-unlisted-platforms",
+			Usage: "Fetch the platform not listed in the provider version from the upstream, " +
+				"for the upstreams listing the platforms incompletely, " +
+				"otherwise, respond 404 with the published platforms of the version without asking the upstream.",
+			Destination: &r.ProbeUnlistedPlatforms,
+			Value:       r.ProbeUnlistedPlatforms,
+		},
+		&cli.StringSliceFlag{
+			Name: "peers",
+			Usage: "The base URLs of the other instances to look up the archive before downloading from the upstream, " +
+				"which trades the LAN bandwidth for the WAN egress, the peers only serve their cached archives, " +
+				"i.e. http://10.0.0.2,http://10.0.0.3.",
+			Action: func(c *cli.Context, v []string) error {
+				// The slice flags are not separated by comma,
+				// see App.
+				v = splitCommaSeparated(v)
+
+				for i := range v {
+					u, err := url.Parse(v[i])
+					if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+						return errors.New("--peers: must be absolute HTTP(S) URLs")
+					}
+				}
+				r.Peers = v
+
+				return nil
+			},
+		},
+		&cli.StringFlag{
+			Name: "implied-dir-error",
+			Usage: "The behavior of looking up the archive in the unreadable implied directory " +
+				"specified by the TF_PLUGIN_MIRROR_DIR environment variable, select from warn or fail, " +
+				"the warn behavior logs the error and continues to look up the next directory.",
+			Action: func(c *cli.Context, s string) error {
+				switch s {
+				case storage.ImpliedDirErrorWarn, storage.ImpliedDirErrorFail:
+					return nil
+				}
+				return errors.New("--implied-dir-error: must be warn or fail")
+			},
+			Destination: &r.ImpliedDirError,
+			Value:       r.ImpliedDirError,
+		},
+		&cli.StringFlag{
+			Name: "cache-file-mode",
+			Usage: "The octal permission mode of the cached archives, " +
+				"i.e. 0640 allows a sidecar of the same group to read the archives.",
+			Value: fmt.Sprintf("%#o", r.CacheFileMode),
+			Action: func(c *cli.Context, s string) error {
+				m, err := storage.ParseMode(s)
+				if err != nil {
+					return fmt.Errorf("--cache-file-mode: %w", err)
+				}
+				r.CacheFileMode = m
+
+				return nil
+			},
+		},
+		&cli.StringFlag{
+			Name:  "cache-dir-mode",
+			Usage: "The octal permission mode of the directories of the cached archives, i.e. 0750.",
+			Value: fmt.Sprintf("%#o", r.CacheDirMode),
+			Action: func(c *cli.Context, s string) error {
+				m, err := storage.ParseMode(s)
+				if err != nil {
+					return fmt.Errorf("--cache-dir-mode: %w", err)
+				}
+				r.CacheDirMode = m
+
+				return nil
+			},
+		},
+		&cli.StringFlag{
+			Name: "cache-owner",
+			Usage: "The numeric owner of the cached archives and their directories in form of <UID>[:<GID>], " +
+				"only takes effect when running as root.",
+			Action: func(c *cli.Context, s string) error {
+				o, err := storage.ParseOwner(s)
+				if err != nil {
+					return fmt.Errorf("--cache-owner: %w", err)
+				}
+				r.CacheOwner = o
+
+				return nil
+			},
+		},
+		&cli.BoolFlag{
+			Name: "verify-on-serve",
+			Usage: "Verify the sha256 checksum of the cached archive before serving, " +
+				"the corrupted archive is removed and re-fetched from the upstream.",
+			Destination: &r.VerifyOnServe,
+			Value:       r.VerifyOnServe,
+		},
+		&cli.BoolFlag{
+			Name: "checksum-h1",
+			Usage: "Respond the h1 hash of the archive via the X-Checksum-H1 header, " +
+				"which is the same as the one recorded in the dependency lock file, " +
+				"the archive is read once to hash until it changes.",
+			Destination: &r.ChecksumH1,
+			Value:       r.ChecksumH1,
+		},
+		&cli.BoolFlag{
+			Name: "offline",
+			Usage: "Serve the cached providers without reaching the upstream, " +
+				"only the versions and platforms whose archives are cached are advertised, " +
+				"so that terraform never selects a version which cannot be downloaded.",
+			Destination: &r.Offline,
+			Value:       r.Offline,
+		},
+		&cli.BoolFlag{
+			Name: "start-in-maintenance",
+			Usage: "Start in maintenance, which answers the metadata from the cache " +
+				"but refuses the downloads and the syncs with 503 until disabled via PUT /v1/admin/maintenance, " +
+				"i.e. for storage migrations and upgrades.",
+			Destination: &r.StartInMaintenance,
+			Value:       r.StartInMaintenance,
+		},
+		&cli.BoolFlag{
+			Name: "infer-platforms",
+			Usage: "Infer the platforms used by the clients from the requested archives, " +
+				"which take precedence over the default popular platforms(linux_amd64, linux_arm64, darwin_amd64, " +
+				"darwin_arm64 and windows_amd64) when re-fetching the missing archives, the most requested first.",
+			Destination: &r.InferPlatforms,
+			Value:       r.InferPlatforms,
+		},
+		&cli.StringFlag{
+			Name: "registry-terraform-version",
+			Usage: "The Terraform version to announce to the remote registry via the X-Terraform-Version header, " +
+				"some private registries, like Terraform Enterprise/Cloud, require it.",
+			Action: func(c *cli.Context, s string) error {
+				if s == "" {
+					return errors.New("--registry-terraform-version: must be filled")
+				}
+
+				if _, err := semver.NewVersion(s); err != nil {
+					return fmt.Errorf("--registry-terraform-version: %w", err)
+				}
+
+				return nil
+			},
+			Destination: &r.RegistryTerraformVersion,
+			Value:       r.RegistryTerraformVersion,
+		},
+		&cli.StringFlag{
+			Name: "registry-credentials-file",
+			Usage: "The file containing the API tokens to access the private registries, " +
+				"which is in the same format as the credentials.tfrc.json generated by `terraform login`. " +
+				"The TF_TOKEN_<HOSTNAME> environment variables take precedence over this file.",
+			Action: func(c *cli.Context, s string) error {
+				if s != "" &&
+					!files.Exists(s) {
+					return errors.New("--registry-credentials-file: file is not existed")
+				}
+				return nil
+			},
+			Destination: &r.RegistryCredentialsFile,
+			Value:       r.RegistryCredentialsFile,
+		},
+		&cli.DurationFlag{
+			Name: "registry-discovery-ttl",
+			Usage: "The duration of caching the /.well-known/terraform.json discovery document of a registry, " +
+				"the stale document is served if the registry fails to respond after expired.",
+			Action: func(c *cli.Context, d time.Duration) error {
+				if d <= 0 {
+					return errors.New("--registry-discovery-ttl: must be positive")
+				}
+
+				return nil
+			},
+			Destination: &r.RegistryDiscoveryTTL,
+			Value:       r.RegistryDiscoveryTTL,
+		},
+		&cli.StringSliceFlag{
+			Name: "registry-upstreams",
+			Usage: "The adapters to access the registries that do not fully follow the registry protocol, " +
+				"in form of <HOSTNAME>=<KIND>[,<KEY>=<VALUE>...]. " +
+				"Supported kinds: " + strings.Join(registry.UpstreamSourceKinds(), ", ") + ", " +
+				"i.e. gitlab.example.com=gitlab,group=infra,token-type=job, " +
+				"registry.example.com=network-mirror,url=https://mirror.example.com/providers/, " +
+				"artifactory.example.com=artifactory,repository=terraform-virtual.",
+			Action: func(c *cli.Context, v []string) error {
+				us := make([]registry.Upstream, 0, len(v))
+
+				for i := range v {
+					u, err := registry.ParseUpstream(v[i])
+					if err != nil {
+						return fmt.Errorf("--registry-upstreams: %w", err)
+					}
+
+					us = append(us, u)
+				}
+				r.RegistryUpstreams = us
+
+				return nil
+			},
+		},
+		&cli.StringFlag{
+			Name: "registry-fault-injection",
+			Usage: "The faults to inject into the upstream calls for testing only, " +
+				"in form of <KEY>=<VALUE>[,<KEY>=<VALUE>...], " +
+				"i.e. delay=2s,delay-rate=0.5,failure-rate=0.1,truncate-rate=0.1.",
+			Hidden: true,
+			Action: func(c *cli.Context, s string) error {
+				f, err := chaos.ParseFaults(s)
+				if err != nil {
+					return fmt.Errorf("--registry-fault-injection: %w", err)
+				}
+				r.RegistryFaults = f
+
+				return nil
+			},
+		},
+		&cli.StringFlag{
+			Name: "policy-file",
+			Usage: "The JSON file of the mirroring policies, " +
+				"i.e. {\"quotas\":{\"hashicorp\":\"20GiB\",\"registry.terraform.io/datadog\":\"5GiB\"}, " +
+				"\"vhosts\":{\"tf-mirror-prod.corp\":{\"providers\":[\"hashicorp/*\"]}}}.",
+			Action: func(c *cli.Context, s string) error {
+				if s != "" &&
+					!files.Exists(s) {
+					return errors.New("--policy-file: file is not existed")
+				}
+				return nil
+			},
+			Destination: &r.PolicyFile,
+			Value:       r.PolicyFile,
+		},
+		&cli.StringFlag{
+			Name: "export-oci-registry",
+			Usage: "The OCI registry to publish the cached provider archives as OCI artifacts hourly, " +
+				"the credential is configured as the token of the registry hostname, " +
+				"i.e. harbor.example.com.",
+			Destination: &r.ExportOCIRegistry,
+			Value:       r.ExportOCIRegistry,
+		},
+		&cli.StringFlag{
+			Name: "export-oci-repository",
+			Usage: "The repository prefix of the OCI registry specified by --export-oci-registry, " +
+				"the provider is published to <PREFIX>/<HOSTNAME>/<NAMESPACE>/terraform-provider-<TYPE>:<VERSION>.",
+			Destination: &r.ExportOCIRepository,
+			Value:       r.ExportOCIRepository,
+		},
+		&cli.BoolFlag{
+			Name:        "export-oci-plain-http",
+			Usage:       "Access the OCI registry specified by --export-oci-registry with HTTP.",
+			Destination: &r.ExportOCIPlainHTTP,
+			Value:       r.ExportOCIPlainHTTP,
+		},
+		&cli.StringSliceFlag{
+			Name: "replicate-to",
+			Usage: "The base URLs of the downstream instances to publish the newly cached provider archives to, " +
+				"the admin token of a downstream is configured as the token of its hostname, " +
+				"i.e. https://edge-a.example.com,https://edge-b.example.com.",
+			Action: func(c *cli.Context, v []string) error {
+				// The slice flags are not separated by comma,
+				// see App.
+				v = splitCommaSeparated(v)
+
+				for i := range v {
+					u, err := url.Parse(v[i])
+					if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+						return errors.New("--replicate-to: must be absolute HTTP(S) URLs")
+					}
+				}
+				r.ReplicateTo = v
+
+				return nil
+			},
+		},
+		&cli.BoolFlag{
+			Name: "replicate-insecure-skip-verify",
+			Usage: "Skip verifying the certificates of the downstream instances of --replicate-to, " +
+				"which exposes their admin tokens to the interceptors, only for testing.",
+			Destination: &r.ReplicateInsecureSkipVerify,
+			Value:       r.ReplicateInsecureSkipVerify,
+		},
+		&cli.StringSliceFlag{
+			Name: "mirror-releases",
+			Usage: "The CLI releases to mirror in background in form of <PRODUCT>@<VERSION>, " +
+				"the product is selected from terraform or tofu, " +
+				"i.e. terraform@1.6.6,tofu@1.6.2.",
+			Action: func(c *cli.Context, v []string) error {
+				// The slice flags are not separated by comma,
+				// see App.
+				v = splitCommaSeparated(v)
+
+				for i := range v {
+					p, ver, ok := strings.Cut(v[i], "@")
+					if !ok || (p != release.ProductTerraform && p != release.ProductTofu) || ver == "" {
+						return errors.New("--mirror-releases: must be in form of <PRODUCT>@<VERSION>")
+					}
+				}
+				r.MirrorReleases = v
+
+				return nil
+			},
+		},
+		&cli.StringSliceFlag{
+			Name: "release-signing-keys",
+			Usage: "The files of the ASCII armored public keys signing the CLI releases " +
+				"in form of <PRODUCT>=<FILE>, the product is selected from terraform or tofu, " +
+				"i.e. terraform=/etc/hermitcrab/hashicorp.asc,tofu=/etc/hermitcrab/opentofu.asc, " +
+				"the releases of the product without the signing keys are not mirrored.",
+			Action: func(c *cli.Context, v []string) error {
+				// The slice flags are not separated by comma,
+				// see App.
+				v = splitCommaSeparated(v)
+
+				r.ReleaseSigningKeys = make(map[string]string, len(v))
+
+				for i := range v {
+					p, f, ok := strings.Cut(v[i], "=")
+					if !ok || (p != release.ProductTerraform && p != release.ProductTofu) || f == "" {
+						return errors.New("--release-signing-keys: must be in form of <PRODUCT>=<FILE>")
+					}
+
+					bs, err := os.ReadFile(f)
+					if err != nil {
+						return fmt.Errorf("--release-signing-keys: error reading %s: %w", f, err)
+					}
+
+					r.ReleaseSigningKeys[p] = string(bs)
+				}
+
+				return nil
+			},
+		},
+		&cli.StringFlag{
+			Name: "log-format",
+			Usage: "The format of logging, select from text or json, " +
+				"the json format is also applied to the access logs with structured fields.",
+			Action: func(c *cli.Context, s string) error {
+				if s != LogFormatText && s != LogFormatJSON {
+					return errors.New("--log-format: must be text or json")
+				}
+				return nil
+			},
+			Destination: &r.LogFormat,
+			Value:       r.LogFormat,
+		},
 	}
 	for i := range flags {
 		cmd.Flags = append(cmd.Flags, flags[i])
@@ -225,9 +1038,38 @@ func (r *Server) Flags(cmd *cli.Command) {
 	r.Logger.Flags(cmd)
 }
 
+// splitCommaSeparated splits the comma separated items of the given slice.
+func splitCommaSeparated(v []string) []string {
+	r := make([]string, 0, len(v))
+
+	for i := range v {
+		for _, s := range strings.Split(v[i], ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				r = append(r, s)
+			}
+		}
+	}
+
+	return r
+}
+
 func (r *Server) Before(cmd *cli.Command) {
 	pb := cmd.Before
 	cmd.Before = func(c *cli.Context) error {
+		// Reset the logger to mask the credentials,
+		// and switch to the JSON logger if --log-format=json,
+		// --log-json is treated as the alias.
+		if c.Bool("log-json") {
+			r.LogFormat = LogFormatJSON
+		}
+
+		{
+			zl, lv := log.NewZapper(r.LogFormat == LogFormatJSON, !c.Bool("log-debug"), c.Bool("log-stdout"))
+			// Retain the recent logs for the support bundle, which are masked as well.
+			zl = zl.WithOptions(zap.WrapCore(support.ZapCore), zap.WrapCore(redact.ZapCore))
+			log.SetLogger(log.WrapZapperAsLogger(zl, lv))
+		}
+
 		l := log.GetLogger()
 
 		// Sink the output of standard logger to util logger.
@@ -292,16 +1134,79 @@ func (r *Server) Run(c context.Context) error {
 	// Create service clients.
 	boltDriver := bolt.GetDriver()
 
-	providerService, err := provider.NewService(boltDriver, r.DataSourceDir)
+	err := registry.ConfigureDiscovery(registry.ConfigureDiscoveryOptions{
+		BoltDriver: boltDriver,
+		TTL:        r.RegistryDiscoveryTTL,
+	})
+	if err != nil {
+		return fmt.Errorf("error configuring registry discovery: %w", err)
+	}
+
+	err = tunable.Configure(tunable.ConfigureOptions{
+		BoltDriver: boltDriver,
+		Defaults: tunable.Tunables{
+			DownloadChunkSize:  download.DefaultChunkSize,
+			DocsCacheTTL:       tunable.Duration(r.DocsCacheTTL),
+			DiscoveryTTL:       tunable.Duration(r.RegistryDiscoveryTTL),
+			ArchiveCacheMaxAge: tunable.Duration(storage.DefaultArchiveCacheMaxAge),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("error configuring tunables: %w", err)
+	}
+
+	support.Configure(support.ConfigureOptions{
+		Config:     r,
+		BoltDriver: boltDriver,
+	})
+
+	providerService, err := provider.NewService(boltDriver, r.DataSourceDir, provider.Options{
+		MaxVersionsPerProvider: r.MaxVersionsPerProvider,
+		EvictionWebhook:        r.EvictionWebhook,
+		VerifyOnServe:          r.VerifyOnServe,
+		ChecksumH1:             r.ChecksumH1,
+		MaxConcurrentDownloads: r.MaxConcurrentDownloads,
+		StartupScan:            r.StartupScan,
+		CacheFileMode:          r.CacheFileMode,
+		CacheDirMode:           r.CacheDirMode,
+		CacheOwner:             r.CacheOwner,
+		Offline:                r.Offline,
+		InferPlatforms:         r.InferPlatforms,
+		MetadataPlatformLayout: r.MetadataPlatformLayout,
+		DocsCacheTTL:           r.DocsCacheTTL,
+		ImpliedDirError:        r.ImpliedDirError,
+		EagerPlatformSync:      r.EagerPlatformSync,
+		Protocols:              r.Protocols,
+		HideRemovedVersions:    r.HideRemovedVersions,
+		UpstreamBudget:         r.UpstreamBudget,
+		VersionsSoftTTL:        r.VersionsSoftTTL,
+		ShadowSampleRate:       r.ShadowSampleRate,
+		ProbeUnlistedPlatforms: r.ProbeUnlistedPlatforms,
+		CanaryToken:            r.CanaryToken,
+		ServablePlatformsOnly:  r.ServablePlatformsOnly,
+		ArtifactURLs:           r.ArtifactURLs,
+		PrefetchNewReleases:    r.PrefetchNewReleases,
+		Peers:                  r.Peers,
+		ScratchDir:             r.DataScratchDir,
+	})
 	if err != nil {
 		return fmt.Errorf("error creating provider service: %w", err)
 	}
 
+	releaseService, err := release.NewService(r.DataSourceDir, release.ServiceOptions{
+		SigningKeys: r.ReleaseSigningKeys,
+		Offline:     r.Offline,
+	})
+	if err != nil {
+		return fmt.Errorf("error creating release service: %w", err)
+	}
+
 	// Initialize some resources.
 	log.Info("initializing")
 
 	initOpts := initOptions{
 		ProviderService: providerService,
+		ReleaseService:  releaseService,
 		SkipTLSVerify:   len(r.TlsAutoCertDomains) != 0,
 		BoltDriver:      boltDriver,
 	}
@@ -311,9 +1216,17 @@ func (r *Server) Run(c context.Context) error {
 		return fmt.Errorf("error initializing: %w", err)
 	}
 
+	// Share the keypair between the apis and the admin gRPC service.
+	apisTls, err := apis.NewTls(r.tlsOptions())
+	if err != nil {
+		return fmt.Errorf("error configuring TLS: %w", err)
+	}
+
 	// Run apis.
 	startApisOpts := startApisOptions{
 		ProviderService: providerService,
+		ReleaseService:  releaseService,
+		Tls:             apisTls,
 	}
 
 	g.Go(func() error {
@@ -327,6 +1240,29 @@ func (r *Server) Run(c context.Context) error {
 		return err
 	})
 
+	// Run admin gRPC service.
+	if r.GrpcBindAddress != "" {
+		g.Go(func() error {
+			log.Info("starting admin gRPC service")
+
+			opts := rpc.ServeOptions{
+				BindAddress:     r.GrpcBindAddress,
+				Token:           r.AdminToken,
+				ProviderService: providerService,
+			}
+			if apisTls != nil {
+				opts.TlsConfig = apisTls.Config
+			}
+
+			err := rpc.Serve(ctx, opts)
+			if err != nil {
+				log.Errorf("error starting admin gRPC service: %v", err)
+			}
+
+			return err
+		})
+	}
+
 	return g.Wait()
 }
 
@@ -334,8 +1270,15 @@ func (r *Server) configure() error {
 	// Configure gopool.
 	gopool.Reset(r.GopoolWorkerFactor)
 
+	// Configure cache owner, which requires the privilege.
+	if r.CacheOwner != nil && os.Geteuid() != 0 {
+		log.Warn("ignored --cache-owner as not running as root")
+
+		r.CacheOwner = nil
+	}
+
 	// Configure data source dir.
-	if err := os.MkdirAll(r.DataSourceDir, 0o700); err != nil {
+	if err := os.MkdirAll(r.DataSourceDir, r.CacheDirMode); err != nil {
 		if !os.IsExist(err) {
 			return fmt.Errorf("--data-source-dir: %w", err)
 		}
@@ -346,5 +1289,38 @@ func (r *Server) configure() error {
 		}
 	}
 
+	// Configure registry client.
+	creds, err := registry.LoadCredentials(r.RegistryCredentialsFile)
+	if err != nil {
+		return fmt.Errorf("--registry-credentials-file: %w", err)
+	}
+
+	upstreams := make(registry.Upstreams, len(r.RegistryUpstreams))
+	for i := range r.RegistryUpstreams {
+		upstreams[r.RegistryUpstreams[i].Hostname] = r.RegistryUpstreams[i]
+	}
+
+	registry.Configure(registry.ConfigureOptions{
+		TerraformVersion: r.RegistryTerraformVersion,
+		Credentials:      creds,
+		Upstreams:        upstreams,
+	})
+
+	// Configure fault injection.
+	chaos.Configure(r.RegistryFaults)
+
+	// Configure policy.
+	pol, err := policy.Load(r.PolicyFile)
+	if err != nil {
+		return fmt.Errorf("--policy-file: %w", err)
+	}
+
+	policy.Configure(pol)
+
+	// Configure maintenance.
+	if r.StartInMaintenance {
+		maintenance.Enable("started in maintenance", 0)
+	}
+
 	return nil
 }
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+
+	"github.com/seal-io/hermitcrab/pkg/registry"
+	"github.com/seal-io/hermitcrab/pkg/support"
+)
+
+func TestApp_sliceFlags(t *testing.T) {
+	r := New()
+
+	var cmd cli.Command
+	r.Flags(&cmd)
+	cmd.Name = "server"
+	cmd.Action = func(*cli.Context) error { return nil }
+
+	err := App(&cmd).Run([]string{
+		"server",
+		"--registry-upstreams=gitlab.example.com=gitlab,group=infra,token-type=job",
+		"--registry-upstreams=registry.example.com=network-mirror,url=https://mirror.example.com/providers/",
+		"--cors-allow-origins=https://a.example.com,https://b.example.com",
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []registry.Upstream{
+		{
+			Hostname: "gitlab.example.com",
+			Kind:     registry.UpstreamKindGitLab,
+			Options:  map[string]string{"group": "infra", "token-type": "job"},
+		},
+		{
+			Hostname: "registry.example.com",
+			Kind:     registry.UpstreamKindNetworkMirror,
+			Options:  map[string]string{"url": "https://mirror.example.com/providers/"},
+		},
+	}, r.RegistryUpstreams, "should keep the options of the upstreams")
+	assert.Equal(t, []string{"https://a.example.com", "https://b.example.com"}, r.CORSAllowOrigins,
+		"should split the plain items")
+}
+
+func TestServer_supportBundleConfig(t *testing.T) {
+	r := New()
+	r.AdminToken = "admin-secret"
+	r.ArtifactURLs = true
+	r.EvictionWebhook = "https://hooks.slack.com/services/T000/B000/slack-secret"
+	r.RegistryUpstreams = []registry.Upstream{
+		{
+			Hostname: "mirror.example.com",
+			Kind:     registry.UpstreamKindNetworkMirror,
+			Options:  map[string]string{"url": "https://mirror.example.com/path-secret/"},
+		},
+		{
+			Hostname: "s3.example.com",
+			Kind:     registry.UpstreamKindS3,
+			Options: map[string]string{
+				"bucket":   "providers",
+				"endpoint": "https://s3.example.com/endpoint-secret",
+			},
+		},
+	}
+
+	support.Configure(support.ConfigureOptions{Config: r})
+
+	t.Cleanup(func() { support.Configure(support.ConfigureOptions{}) })
+
+	var b bytes.Buffer
+	require.NoError(t, support.Collect(context.Background(), &b, support.CollectOptions{}))
+
+	gr, err := gzip.NewReader(&b)
+	require.NoError(t, err)
+
+	var cfg string
+
+	tr := tar.NewReader(gr)
+
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+
+		require.NoError(t, err)
+
+		if h.Name != "config.json" {
+			continue
+		}
+
+		bs, err := io.ReadAll(tr)
+		require.NoError(t, err)
+
+		cfg = string(bs)
+	}
+
+	require.NotEmpty(t, cfg)
+	assert.Contains(t, cfg, `"EvictionWebhook": "xxxxx"`)
+	assert.Contains(t, cfg, `"url": "xxxxx"`)
+	assert.Contains(t, cfg, `"endpoint": "xxxxx"`)
+	assert.Contains(t, cfg, `"bucket": "providers"`)
+	assert.Contains(t, cfg, `"ArtifactURLs": true`, "should keep the toggles")
+	assert.Contains(t, cfg, `"BindAddress": "0.0.0.0"`)
+	assert.NotContains(t, cfg, "secret")
+	assert.NotContains(t, cfg, "hooks.slack.com")
+}
@@ -6,10 +6,14 @@ import (
 
 	"github.com/seal-io/hermitcrab/pkg/apis"
 	"github.com/seal-io/hermitcrab/pkg/provider"
+	"github.com/seal-io/hermitcrab/pkg/release"
 )
 
 type startApisOptions struct {
 	ProviderService *provider.Service
+	ReleaseService  release.Service
+	// Tls is the TLS to serve in HTTPs, serves in HTTP only if nil.
+	Tls *apis.Tls
 }
 
 func (r *Server) startApis(ctx context.Context, opts startApisOptions) error {
@@ -23,28 +27,26 @@ func (r *Server) startApis(ctx context.Context, opts startApisOptions) error {
 			ConnQPS:               r.ConnQPS,
 			ConnBurst:             r.ConnBurst,
 			WebsocketConnMaxPerIP: r.WebsocketConnMaxPerIP,
+			StructuredLogging:     r.LogFormat == LogFormatJSON,
+			SlowRequestThreshold:  r.SlowRequestThreshold,
+			CORSAllowOrigins:      r.CORSAllowOrigins,
+			CORSAllowMethods:      r.CORSAllowMethods,
+			CORSAllowHeaders:      r.CORSAllowHeaders,
+			TrustedProxies:        r.TrustedProxies,
+			MetricsBasicAuth:      r.MetricsBasicAuth,
 			ProviderService:       opts.ProviderService,
+			ReleaseService:        opts.ReleaseService,
+			AdminToken:            r.AdminToken,
+			SyncCooldown:          r.SyncCooldown,
+			AdminV1Sunset:         r.AdminV1Sunset,
 		},
-		BindAddress:       r.BindAddress,
-		BindWithDualStack: r.BindWithDualStack,
+		BindAddress:        r.BindAddress,
+		BindWithDualStack:  r.BindWithDualStack,
+		MetricsBindAddress: r.MetricsBindAddress,
 	}
 
-	switch {
-	default:
-		serveOpts.TlsMode = apis.TlsModeSelfGenerated
-		serveOpts.TlsCertDir = r.TlsCertDir
-	case !r.EnableTls:
-		serveOpts.TlsMode = apis.TlsModeDisabled
-	case r.TlsCertFile != "" && r.TlsPrivateKeyFile != "":
-		serveOpts.TlsMode = apis.TlsModeCustomized
-		serveOpts.TlsCertFile = r.TlsCertFile
-		serveOpts.TlsPrivateKeyFile = r.TlsPrivateKeyFile
-	case len(r.TlsAutoCertDomains) != 0:
-		serveOpts.TlsMode = apis.TlsModeAutoGenerated
-		serveOpts.TlsCertified = true
-		serveOpts.TlsCertDir = r.TlsCertDir
-		serveOpts.TlsAutoCertDomains = r.TlsAutoCertDomains
-	}
+	serveOpts.Tls = opts.Tls
+	serveOpts.TlsCertified = r.tlsOptions().TlsMode == apis.TlsModeAutoGenerated
 
 	err = srv.Serve(ctx, serveOpts)
 	if err != nil && !errors.Is(err, context.Canceled) {
@@ -53,3 +55,26 @@ func (r *Server) startApis(ctx context.Context, opts startApisOptions) error {
 
 	return nil
 }
+
+// tlsOptions returns the options of serving in HTTPs.
+func (r *Server) tlsOptions() apis.TlsOptions {
+	var opts apis.TlsOptions
+
+	switch {
+	default:
+		opts.TlsMode = apis.TlsModeSelfGenerated
+		opts.TlsCertDir = r.TlsCertDir
+	case !r.EnableTls:
+		opts.TlsMode = apis.TlsModeDisabled
+	case r.TlsCertFile != "" && r.TlsPrivateKeyFile != "":
+		opts.TlsMode = apis.TlsModeCustomized
+		opts.TlsCertFile = r.TlsCertFile
+		opts.TlsPrivateKeyFile = r.TlsPrivateKeyFile
+	case len(r.TlsAutoCertDomains) != 0:
+		opts.TlsMode = apis.TlsModeAutoGenerated
+		opts.TlsCertDir = r.TlsCertDir
+		opts.TlsAutoCertDomains = r.TlsAutoCertDomains
+	}
+
+	return opts
+}
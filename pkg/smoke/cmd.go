@@ -0,0 +1,80 @@
+package smoke
+
+import (
+	"time"
+
+	"github.com/seal-io/walrus/utils/log"
+	"github.com/urfave/cli/v2"
+)
+
+// Command returns the `smoke` command to exercise a running mirror end-to-end,
+// which exits non-zero if any step failed, i.e. in the deployment pipelines.
+func Command() *cli.Command {
+	opts := Options{
+		Timeout: DefaultTimeout,
+	}
+
+	return &cli.Command{
+		Name: "smoke",
+		Usage: "Exercise the index, the version file and the archive download of a provider " +
+			"against a running mirror, and verify the hashes of the downloaded archive, " +
+			"i.e. smoke --target https://mirror.example.com --provider hashicorp/random.",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:        "target",
+				Usage:       "The base URL of the mirror to exercise, i.e. https://mirror.example.com.",
+				Destination: &opts.Target,
+				Required:    true,
+			},
+			&cli.StringFlag{
+				Name:        "provider",
+				Usage:       "The provider to exercise, in form of [<HOSTNAME>/]<NAMESPACE>/<TYPE>, i.e. hashicorp/random.",
+				Destination: &opts.Provider,
+				Required:    true,
+			},
+			&cli.StringFlag{
+				Name:        "version",
+				Usage:       "The version to exercise, the latest one of the index if blank.",
+				Destination: &opts.Version,
+			},
+			&cli.StringFlag{
+				Name:        "platform",
+				Usage:       "The platform to exercise in form of <OS>_<ARCH>, the one of the running host if blank.",
+				Destination: &opts.Platform,
+			},
+			&cli.DurationFlag{
+				Name:        "timeout",
+				Usage:       "The duration of the whole smoke test.",
+				Destination: &opts.Timeout,
+				Value:       opts.Timeout,
+			},
+			&cli.BoolFlag{
+				Name:        "insecure-skip-verify",
+				Usage:       "Skip verifying the certificate of the target.",
+				Destination: &opts.InsecureSkipVerify,
+			},
+		},
+		Action: func(c *cli.Context) error {
+			logger := log.WithName("smoke")
+
+			r, err := Run(c.Context, opts)
+
+			for _, s := range r.Steps {
+				if s.Error != "" {
+					logger.Errorf("%s failed in %s: %s", s.Name, s.Duration.Round(time.Millisecond), s.Error)
+					continue
+				}
+
+				logger.Infof("%s passed in %s: %s", s.Name, s.Duration.Round(time.Millisecond), s.Detail)
+			}
+
+			if err != nil {
+				return err
+			}
+
+			logger.Infof("smoke passed: %s %s %s", r.Provider, r.Version, r.Platform)
+
+			return nil
+		},
+	}
+}
@@ -0,0 +1,375 @@
+package smoke
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	goruntime "runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/seal-io/walrus/utils/json"
+	"github.com/seal-io/walrus/utils/version"
+	"golang.org/x/mod/sumdb/dirhash"
+
+	"github.com/seal-io/hermitcrab/pkg/download"
+	"github.com/seal-io/hermitcrab/pkg/provider/addrs"
+)
+
+// DefaultTimeout is the default duration of the whole smoke test.
+const DefaultTimeout = 5 * time.Minute
+
+// Options holds the options of the smoke test.
+type Options struct {
+	// Target is the base URL of the mirror, i.e. https://mirror.example.com.
+	Target string
+	// Provider is the provider to exercise, in form of [<HOSTNAME>/]<NAMESPACE>/<TYPE>.
+	Provider string
+	// Version is the version to exercise, the latest one of the index if blank.
+	Version string
+	// Platform is the platform to exercise in form of <OS>_<ARCH>,
+	// the one of the running host if blank.
+	Platform string
+	// Timeout is the duration of the whole smoke test, default is DefaultTimeout if not positive.
+	Timeout time.Duration
+	// InsecureSkipVerify skips verifying the certificate of the target.
+	InsecureSkipVerify bool
+	// HttpClient is the client to request the target if specified.
+	HttpClient *http.Client
+}
+
+// Validate returns error if the options are invalid.
+func (opts Options) Validate() error {
+	u, err := url.Parse(opts.Target)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("invalid target %q: must be an absolute URL", opts.Target)
+	}
+
+	if _, err = addrs.Parse(opts.Provider); err != nil {
+		return fmt.Errorf("invalid provider %q: %w", opts.Provider, err)
+	}
+
+	if opts.Platform != "" {
+		if o, a, ok := strings.Cut(opts.Platform, "_"); !ok || o == "" || a == "" {
+			return fmt.Errorf("invalid platform %q: must be in form of <OS>_<ARCH>", opts.Platform)
+		}
+	}
+
+	return nil
+}
+
+type (
+	// Report holds the result of the smoke test.
+	Report struct {
+		Provider string `json:"provider"`
+		Version  string `json:"version,omitempty"`
+		Platform string `json:"platform"`
+		// Steps holds the exercised steps in order,
+		// the steps after the failed one are not exercised.
+		Steps []Step `json:"steps"`
+	}
+
+	// Step holds the result of a smoke test step.
+	Step struct {
+		Name     string        `json:"name"`
+		URL      string        `json:"url"`
+		Duration time.Duration `json:"duration"`
+		// Detail is the summary of the passed step, i.e. the verified hash.
+		Detail string `json:"detail,omitempty"`
+		// Error is the error of the failed step.
+		Error string `json:"error,omitempty"`
+	}
+)
+
+// Run exercises the index, the version file and the archive download of the given provider
+// via the network mirror protocol of the target, and verifies the hashes of the downloaded archive,
+// returns error if any step failed.
+func Run(ctx context.Context, opts Options) (Report, error) {
+	if err := opts.Validate(); err != nil {
+		return Report{}, err
+	}
+
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+
+	if opts.Platform == "" {
+		opts.Platform = goruntime.GOOS + "_" + goruntime.GOARCH
+	}
+
+	if opts.HttpClient == nil {
+		hopts := []download.HttpClientOption{
+			download.WithUserAgent(version.GetUserAgentWith("hermitcrab-smoke")),
+		}
+		if opts.InsecureSkipVerify {
+			hopts = append(hopts, download.WithInsecureSkipVerify())
+		}
+
+		opts.HttpClient = download.NewHttpClient(hopts...)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	addr, _ := addrs.Parse(opts.Provider)
+
+	r := Report{
+		Provider: addr.String(),
+		Version:  opts.Version,
+		Platform: opts.Platform,
+	}
+
+	base, _ := url.Parse(strings.TrimSuffix(opts.Target, "/") + "/")
+	typedURL := base.JoinPath("v1/providers", addr.Hostname, addr.Namespace, addr.Type).String() + "/"
+
+	c := client{httpCli: opts.HttpClient}
+
+	// Exercise the index.
+	err := r.step("index", typedURL+"index.json", func(u string) (string, error) {
+		var b struct {
+			Versions map[string]any `json:"versions"`
+		}
+
+		if err := c.getJSON(ctx, u, &b); err != nil {
+			return "", err
+		}
+
+		if len(b.Versions) == 0 {
+			return "", errors.New("no versions")
+		}
+
+		if r.Version == "" {
+			r.Version = latestOf(b.Versions)
+		} else if _, ok := b.Versions[r.Version]; !ok {
+			return "", fmt.Errorf("version %s is not listed", r.Version)
+		}
+
+		return fmt.Sprintf("%d versions", len(b.Versions)), nil
+	})
+	if err != nil {
+		return r, err
+	}
+
+	// Exercise the version file.
+	var archive struct {
+		URL    string   `json:"url"`
+		Hashes []string `json:"hashes"`
+	}
+
+	versionURL := typedURL + r.Version + ".json"
+
+	err = r.step("version", versionURL, func(u string) (string, error) {
+		var b struct {
+			Archives map[string]json.RawMessage `json:"archives"`
+		}
+
+		if err := c.getJSON(ctx, u, &b); err != nil {
+			return "", err
+		}
+
+		a, ok := b.Archives[r.Platform]
+		if !ok {
+			return "", fmt.Errorf("platform %s is not listed", r.Platform)
+		}
+
+		if err := json.Unmarshal(a, &archive); err != nil {
+			return "", fmt.Errorf("error decoding archive: %w", err)
+		}
+
+		if archive.URL == "" {
+			return "", errors.New("blank archive url")
+		}
+
+		if len(archive.Hashes) == 0 {
+			return "", errors.New("no hashes to verify the archive")
+		}
+
+		return fmt.Sprintf("%d platforms", len(b.Archives)), nil
+	})
+	if err != nil {
+		return r, err
+	}
+
+	// Exercise the archive download, which is relative to the version file.
+	vu, _ := url.Parse(versionURL)
+	au, err := vu.Parse(archive.URL)
+	if err != nil {
+		return r, fmt.Errorf("invalid archive url %q: %w", archive.URL, err)
+	}
+
+	err = r.step("archive", au.String(), func(u string) (string, error) {
+		return c.verifyArchive(ctx, u, archive.Hashes)
+	})
+
+	return r, err
+}
+
+// step runs the given step and records the result,
+// returns the error of the step.
+func (r *Report) step(name, u string, fn func(u string) (string, error)) error {
+	start := time.Now()
+	detail, err := fn(u)
+
+	s := Step{
+		Name:     name,
+		URL:      u,
+		Duration: time.Since(start),
+		Detail:   detail,
+	}
+	if err != nil {
+		s.Error = err.Error()
+		err = fmt.Errorf("error exercising %s %s: %w", name, u, err)
+	}
+
+	r.Steps = append(r.Steps, s)
+
+	return err
+}
+
+// latestOf returns the latest version of the given versions,
+// the prereleases and the versions rejected by the semantic versioning
+// are only chosen if no released version.
+func latestOf(versions map[string]any) string {
+	var (
+		vs  = make([]*semver.Version, 0, len(versions))
+		raw = make([]string, 0, len(versions))
+	)
+
+	for k := range versions {
+		raw = append(raw, k)
+
+		if v, err := semver.NewVersion(k); err == nil {
+			vs = append(vs, v)
+		}
+	}
+
+	sort.Sort(sort.Reverse(semver.Collection(vs)))
+
+	for _, v := range vs {
+		if v.Prerelease() == "" {
+			return v.Original()
+		}
+	}
+
+	if len(vs) != 0 {
+		return vs[0].Original()
+	}
+
+	sort.Strings(raw)
+
+	return raw[len(raw)-1]
+}
+
+type client struct {
+	httpCli *http.Client
+}
+
+// get requests the given URL and returns the response with the status 200.
+func (c client) get(ctx context.Context, u string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpCli.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	return resp, nil
+}
+
+// getJSON requests the given URL and decodes the JSON response into the given value.
+func (c client) getJSON(ctx context.Context, u string, v any) error {
+	resp, err := c.get(ctx, u)
+	if err != nil {
+		return err
+	}
+
+	defer func() { _ = resp.Body.Close() }()
+
+	if err = json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("error decoding response: %w", err)
+	}
+
+	return nil
+}
+
+// verifyArchive downloads the archive of the given URL into a temporary file,
+// and verifies it with the given hashes, the zh hash is the SHA256 checksum of the archive,
+// and the h1 hash is the one recorded in the dependency lock file of Terraform.
+func (c client) verifyArchive(ctx context.Context, u string, hashes []string) (string, error) {
+	resp, err := c.get(ctx, u)
+	if err != nil {
+		return "", err
+	}
+
+	defer func() { _ = resp.Body.Close() }()
+
+	f, err := os.CreateTemp("", "hermitcrab-smoke-*"+path.Ext(path.Base(resp.Request.URL.Path)))
+	if err != nil {
+		return "", fmt.Errorf("error creating temporary file: %w", err)
+	}
+
+	defer func() {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+	}()
+
+	h := sha256.New()
+
+	n, err := io.Copy(io.MultiWriter(f, h), resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("error downloading archive: %w", err)
+	}
+
+	if err = f.Close(); err != nil {
+		return "", fmt.Errorf("error closing temporary file: %w", err)
+	}
+
+	zh := "zh:" + hex.EncodeToString(h.Sum(nil))
+
+	var verified []string
+
+	for _, v := range hashes {
+		switch {
+		case strings.HasPrefix(v, "zh:"):
+			if !strings.EqualFold(v, zh) {
+				return "", fmt.Errorf("mismatched hash: expected %s, got %s", v, zh)
+			}
+		case strings.HasPrefix(v, "h1:"):
+			h1, err := dirhash.HashZip(f.Name(), dirhash.Hash1)
+			if err != nil {
+				return "", fmt.Errorf("error hashing archive: %w", err)
+			}
+
+			if v != h1 {
+				return "", fmt.Errorf("mismatched hash: expected %s, got %s", v, h1)
+			}
+		default:
+			continue
+		}
+
+		verified = append(verified, v)
+	}
+
+	if len(verified) == 0 {
+		return "", fmt.Errorf("no supported hashes in %v", hashes)
+	}
+
+	return fmt.Sprintf("%d bytes, verified %s", n, strings.Join(verified, ", ")), nil
+}
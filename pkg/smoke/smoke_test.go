@@ -0,0 +1,77 @@
+package smoke
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun(t *testing.T) {
+	var buf bytes.Buffer
+
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create("terraform-provider-random_v3.6.0")
+	require.NoError(t, err)
+	_, err = w.Write([]byte("binary"))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	archive := buf.Bytes()
+	sum := sha256.Sum256(archive)
+	shasum := hex.EncodeToString(sum[:])
+
+	m := http.NewServeMux()
+	m.HandleFunc("/v1/providers/registry.terraform.io/hashicorp/random/index.json",
+		func(w http.ResponseWriter, _ *http.Request) {
+			_, _ = w.Write([]byte(`{"versions":{"3.5.1":{},"3.6.0":{},"3.7.0-beta1":{}}}`))
+		})
+	m.HandleFunc("/v1/providers/registry.terraform.io/hashicorp/random/3.6.0.json",
+		func(w http.ResponseWriter, _ *http.Request) {
+			_, _ = w.Write([]byte(`{"archives":{"linux_amd64":{` +
+				`"url":"download/terraform-provider-random_3.6.0_linux_amd64.zip",` +
+				`"hashes":["zh:` + shasum + `"]}}}`))
+		})
+	m.HandleFunc("/v1/providers/registry.terraform.io/hashicorp/random/download/"+
+		"terraform-provider-random_3.6.0_linux_amd64.zip",
+		func(w http.ResponseWriter, _ *http.Request) {
+			_, _ = w.Write(archive)
+		})
+
+	srv := httptest.NewServer(m)
+	t.Cleanup(srv.Close)
+
+	opts := Options{
+		Target:   srv.URL,
+		Provider: "hashicorp/random",
+		Platform: "linux_amd64",
+	}
+
+	r, err := Run(context.Background(), opts)
+	require.NoError(t, err)
+	assert.Equal(t, "3.6.0", r.Version, "the prerelease must not be chosen as the latest")
+	require.Len(t, r.Steps, 3)
+	assert.Contains(t, r.Steps[2].Detail, "zh:"+shasum)
+
+	// Fail if the platform is not listed.
+	opts.Platform = "windows_amd64"
+
+	r, err = Run(context.Background(), opts)
+	assert.Error(t, err)
+	require.Len(t, r.Steps, 2)
+	assert.NotEmpty(t, r.Steps[1].Error)
+
+	// Fail if the archive is corrupted.
+	archive = append(bytes.Clone(archive), '!')
+	opts.Platform = "linux_amd64"
+
+	_, err = Run(context.Background(), opts)
+	assert.ErrorContains(t, err, "mismatched hash")
+}
@@ -0,0 +1,159 @@
+package support
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/seal-io/walrus/utils/log"
+	"github.com/seal-io/walrus/utils/version"
+	"github.com/urfave/cli/v2"
+
+	"github.com/seal-io/hermitcrab/pkg/download"
+)
+
+// DefaultTimeout is the default duration of downloading the support bundle.
+const DefaultTimeout = 2 * time.Minute
+
+// FetchOptions holds the options of downloading the support bundle from a running mirror.
+type FetchOptions struct {
+	// Target is the base URL of the mirror, i.e. https://mirror.example.com.
+	Target string
+	// AdminToken is the bearer token to access the admin services of the mirror.
+	AdminToken string
+	// Output is the file to write the support bundle,
+	// default is hermitcrab-support-<TIME>.tar.gz in the working directory if blank.
+	Output string
+	// Timeout is the duration of downloading, default is DefaultTimeout if not positive.
+	Timeout time.Duration
+	// InsecureSkipVerify skips verifying the certificate of the target.
+	InsecureSkipVerify bool
+}
+
+// Command returns the `support-bundle` command to download the support bundle from a running mirror,
+// i.e. for attaching to the issues.
+func Command() *cli.Command {
+	opts := FetchOptions{
+		Timeout: DefaultTimeout,
+	}
+
+	return &cli.Command{
+		Name: "support-bundle",
+		Usage: "Download the support bundle of a running mirror for attaching to the issues, " +
+			"which collects the sanitized configuration, the recent logs, the bolt stats, the cache stats, " +
+			"the sync history and the goroutine dumps, i.e. support-bundle --target https://mirror.example.com.",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:        "target",
+				Usage:       "The base URL of the mirror, i.e. https://mirror.example.com.",
+				Destination: &opts.Target,
+				Required:    true,
+			},
+			&cli.StringFlag{
+				Name:        "admin-token",
+				Usage:       "The bearer token to access the admin services of the mirror.",
+				EnvVars:     []string{"HERMITCRAB_ADMIN_TOKEN"},
+				Destination: &opts.AdminToken,
+			},
+			&cli.StringFlag{
+				Name:        "output",
+				Usage:       "The file to write the support bundle, hermitcrab-support-<TIME>.tar.gz if blank.",
+				Destination: &opts.Output,
+			},
+			&cli.DurationFlag{
+				Name:        "timeout",
+				Usage:       "The duration of downloading the support bundle.",
+				Destination: &opts.Timeout,
+				Value:       opts.Timeout,
+			},
+			&cli.BoolFlag{
+				Name:        "insecure-skip-verify",
+				Usage:       "Skip verifying the certificate of the target.",
+				Destination: &opts.InsecureSkipVerify,
+			},
+		},
+		Action: func(c *cli.Context) error {
+			p, err := Fetch(c.Context, opts)
+			if err != nil {
+				return err
+			}
+
+			log.WithName("support").Infof("support bundle written to %s", p)
+
+			return nil
+		},
+	}
+}
+
+// Fetch downloads the support bundle from the admin services of the target,
+// and writes it into the output file, returns the path of the written file.
+func Fetch(ctx context.Context, opts FetchOptions) (string, error) {
+	u, err := url.Parse(opts.Target)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("invalid target %q: must be an absolute URL", opts.Target)
+	}
+
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+
+	if opts.Output == "" {
+		opts.Output = "hermitcrab-support-" + time.Now().UTC().Format("20060102T150405Z") + ".tar.gz"
+	}
+
+	hopts := []download.HttpClientOption{
+		download.WithUserAgent(version.GetUserAgentWith("hermitcrab-support")),
+	}
+	if opts.InsecureSkipVerify {
+		hopts = append(hopts, download.WithInsecureSkipVerify())
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		strings.TrimSuffix(opts.Target, "/")+"/v2/admin/support-bundle", nil)
+	if err != nil {
+		return "", fmt.Errorf("error creating request: %w", err)
+	}
+
+	if opts.AdminToken != "" {
+		req.Header.Set("Authorization", "Bearer "+opts.AdminToken)
+	}
+
+	resp, err := download.NewHttpClient(hopts...).Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error requesting support bundle: %w", err)
+	}
+
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<10))
+		return "", fmt.Errorf("error requesting support bundle: unexpected status %d: %s",
+			resp.StatusCode, strings.TrimSpace(string(b)))
+	}
+
+	f, err := os.Create(opts.Output)
+	if err != nil {
+		return "", fmt.Errorf("error creating support bundle file: %w", err)
+	}
+
+	if _, err = io.Copy(f, resp.Body); err != nil {
+		_ = f.Close()
+		_ = os.Remove(opts.Output)
+
+		return "", fmt.Errorf("error writing support bundle file: %w", err)
+	}
+
+	if err = f.Close(); err != nil {
+		return "", fmt.Errorf("error closing support bundle file: %w", err)
+	}
+
+	return opts.Output, nil
+}
@@ -0,0 +1,111 @@
+package support
+
+import (
+	"bytes"
+	"sync"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// MaxRecentLogs is the number of the recent log entries retained for the support bundle.
+const MaxRecentLogs = 1000
+
+// ZapCore wraps the given zapcore.Core to retain the recent log entries in memory,
+// it is used as zap.WrapCore(support.ZapCore) before masking the credentials,
+// so that the retained entries are masked as well.
+func ZapCore(c zapcore.Core) zapcore.Core {
+	return zapcore.NewTee(c, ringCore{
+		LevelEnabler: zapcore.InfoLevel,
+		enc:          zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()),
+		ring:         recentLogs,
+	})
+}
+
+// recentLogs holds the recent log entries of the process.
+var recentLogs = newLogRing(MaxRecentLogs)
+
+// logRing is a fixed size ring of the encoded log entries.
+type logRing struct {
+	m       sync.Mutex
+	entries [][]byte
+	next    int
+	full    bool
+}
+
+func newLogRing(size int) *logRing {
+	return &logRing{entries: make([][]byte, size)}
+}
+
+func (r *logRing) add(b []byte) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	r.entries[r.next] = b
+	r.next = (r.next + 1) % len(r.entries)
+
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// bytes returns the retained entries in order, one per line.
+func (r *logRing) bytes() []byte {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	var b bytes.Buffer
+
+	if r.full {
+		for _, e := range r.entries[r.next:] {
+			b.Write(e)
+		}
+	}
+
+	for _, e := range r.entries[:r.next] {
+		b.Write(e)
+	}
+
+	return b.Bytes()
+}
+
+// ringCore is a zapcore.Core encoding the entries into the ring.
+type ringCore struct {
+	zapcore.LevelEnabler
+
+	enc  zapcore.Encoder
+	ring *logRing
+}
+
+func (c ringCore) With(fields []zapcore.Field) zapcore.Core {
+	enc := c.enc.Clone()
+	for i := range fields {
+		fields[i].AddTo(enc)
+	}
+
+	return ringCore{LevelEnabler: c.LevelEnabler, enc: enc, ring: c.ring}
+}
+
+func (c ringCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+
+	return ce
+}
+
+func (c ringCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	buf, err := c.enc.EncodeEntry(ent, fields)
+	if err != nil {
+		return err
+	}
+
+	c.ring.add(bytes.Clone(buf.Bytes()))
+	buf.Free()
+
+	return nil
+}
+
+func (c ringCore) Sync() error {
+	return nil
+}
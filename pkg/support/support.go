@@ -0,0 +1,378 @@
+package support
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/seal-io/walrus/utils/version"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/seal-io/hermitcrab/pkg/database"
+	"github.com/seal-io/hermitcrab/pkg/metric"
+	"github.com/seal-io/hermitcrab/pkg/provider/metadata"
+	"github.com/seal-io/hermitcrab/pkg/provider/storage"
+	"github.com/seal-io/hermitcrab/pkg/redact"
+)
+
+// MaxSyncHistories is the maximum number of the providers,
+// the sync history of which is collected into the support bundle, the degraded ones first.
+const MaxSyncHistories = 100
+
+// ConfigureOptions holds the options of the support bundle.
+type ConfigureOptions struct {
+	// Config is the effective configuration of the server,
+	// which is sanitized before collecting.
+	Config any
+	// BoltDriver is the driver of the metadata database.
+	BoltDriver database.BoltDriver
+}
+
+var (
+	m      sync.RWMutex
+	config ConfigureOptions
+)
+
+// Configure configures the global sources of the support bundle.
+func Configure(opts ConfigureOptions) {
+	m.Lock()
+	defer m.Unlock()
+
+	config = opts
+}
+
+// CollectOptions holds the options of collecting the support bundle.
+type CollectOptions struct {
+	Metadata metadata.Service
+	Storage  storage.Service
+}
+
+// Collect writes the support bundle into the given writer in tar.gz format,
+// the bundle includes the sanitized configuration, the recent logs, the bolt stats,
+// the cache stats, the metrics, the sync history and the goroutine dumps.
+// A failed part is recorded into the errors.txt of the bundle instead of failing the whole.
+func Collect(ctx context.Context, w io.Writer, opts CollectOptions) error {
+	m.RLock()
+	cfg := config
+	m.RUnlock()
+
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+	now := time.Now()
+
+	var errs bytes.Buffer
+
+	parts := []struct {
+		name    string
+		collect func(io.Writer) error
+	}{
+		{"version.json", collectVersion},
+		{"config.json", func(w io.Writer) error { return collectConfig(w, cfg.Config) }},
+		{"logs.jsonl", func(w io.Writer) error { _, err := w.Write(recentLogs.bytes()); return err }},
+		{"bolt.json", func(w io.Writer) error { return collectBolt(w, cfg.BoltDriver) }},
+		{"cache.json", func(w io.Writer) error { return collectCache(ctx, w, opts.Storage) }},
+		{"metrics.txt", metric.WriteText},
+		{"syncs.json", func(w io.Writer) error { return collectSyncs(ctx, w, opts.Metadata) }},
+		{"goroutines.txt", func(w io.Writer) error { return pprof.Lookup("goroutine").WriteTo(w, 2) }},
+	}
+
+	for _, p := range parts {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		var b bytes.Buffer
+		if err := p.collect(&b); err != nil {
+			fmt.Fprintf(&errs, "%s: %v\n", p.name, redact.Error(err))
+			continue
+		}
+
+		if err := writeFile(tw, p.name, b.Bytes(), now); err != nil {
+			return err
+		}
+	}
+
+	if errs.Len() != 0 {
+		if err := writeFile(tw, "errors.txt", errs.Bytes(), now); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("error closing support bundle: %w", err)
+	}
+
+	return gw.Close()
+}
+
+func writeFile(tw *tar.Writer, name string, data []byte, modified time.Time) error {
+	err := tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0o644,
+		Size:    int64(len(data)),
+		ModTime: modified,
+	})
+	if err != nil {
+		return fmt.Errorf("error writing support bundle %s: %w", name, err)
+	}
+
+	if _, err = tw.Write(data); err != nil {
+		return fmt.Errorf("error writing support bundle %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// writeJSON writes the given value in indented JSON,
+// which is friendly to read in the issues.
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(v)
+}
+
+func collectVersion(w io.Writer) error {
+	return writeJSON(w, map[string]any{
+		"version":   version.Version,
+		"commit":    version.GitCommit,
+		"goVersion": runtime.Version(),
+		"platform":  runtime.GOOS + "/" + runtime.GOARCH,
+		"time":      time.Now().UTC().Format(time.RFC3339),
+	})
+}
+
+func collectConfig(w io.Writer, cfg any) error {
+	if cfg == nil {
+		return errors.New("configuration is not configured")
+	}
+
+	bs, err := json.Marshal(cfg)
+	if err != nil {
+		return fmt.Errorf("error marshaling configuration: %w", err)
+	}
+
+	var v any
+	if err = json.Unmarshal(bs, &v); err != nil {
+		return fmt.Errorf("error unmarshaling configuration: %w", err)
+	}
+
+	return writeJSON(w, sanitize("", v))
+}
+
+// sensitiveURLKeys holds the (lower-cased) substrings of the configuration keys
+// whose values are masked entirely,
+// i.e. the webhooks and the upstream endpoints carrying the secrets in their paths.
+var sensitiveURLKeys = []string{
+	"webhook",
+	"url",
+	"endpoint",
+}
+
+// sanitize masks the non-empty values under the sensitive keys,
+// and the credentials carried by the strings, i.e. the userinfo of the URLs.
+func sanitize(k string, v any) any {
+	if k != "" && isSensitiveKey(k, v) && !isEmpty(v) {
+		return redact.Mask
+	}
+
+	switch t := v.(type) {
+	case map[string]any:
+		for mk, mv := range t {
+			t[mk] = sanitize(mk, mv)
+		}
+	case []any:
+		for i := range t {
+			t[i] = sanitize(k, t[i])
+		}
+	case string:
+		return redact.String(t)
+	}
+
+	return v
+}
+
+func isSensitiveKey(k string, v any) bool {
+	if redact.IsSensitiveQueryKey(k) {
+		return true
+	}
+
+	// Toggles like ArtifactURLs are not URLs.
+	if _, ok := v.(bool); ok {
+		return false
+	}
+
+	k = strings.ToLower(k)
+	for _, s := range sensitiveURLKeys {
+		if strings.Contains(k, s) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isEmpty(v any) bool {
+	switch t := v.(type) {
+	case nil:
+		return true
+	case string:
+		return t == ""
+	case []any:
+		return len(t) == 0
+	case map[string]any:
+		return len(t) == 0
+	}
+
+	return false
+}
+
+type (
+	boltStats struct {
+		Path    string                     `json:"path"`
+		Size    int64                      `json:"size"`
+		DB      bolt.Stats                 `json:"db"`
+		Buckets map[string]boltBucketStats `json:"buckets"`
+	}
+
+	boltBucketStats struct {
+		Keys    int `json:"keys"`
+		Buckets int `json:"buckets"`
+		Depth   int `json:"depth"`
+		InUse   int `json:"inuse"`
+		Alloc   int `json:"alloc"`
+	}
+)
+
+func collectBolt(w io.Writer, db database.BoltDriver) error {
+	if db == nil {
+		return errors.New("database is not configured")
+	}
+
+	var s boltStats
+
+	err := db.View(func(tx *bolt.Tx) error {
+		s.Path = tx.DB().Path()
+		s.Size = tx.Size()
+		s.DB = tx.DB().Stats()
+		s.Buckets = map[string]boltBucketStats{}
+
+		return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			bs := b.Stats()
+			s.Buckets[string(name)] = boltBucketStats{
+				Keys:    bs.KeyN,
+				Buckets: bs.BucketN,
+				Depth:   bs.Depth,
+				InUse:   bs.BranchInuse + bs.LeafInuse,
+				Alloc:   bs.BranchAlloc + bs.LeafAlloc,
+			}
+
+			return nil
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("error reading database stats: %w", err)
+	}
+
+	return writeJSON(w, s)
+}
+
+type cacheStats struct {
+	Archives int   `json:"archives"`
+	Bytes    int64 `json:"bytes"`
+}
+
+func collectCache(ctx context.Context, w io.Writer, s storage.Service) error {
+	if s == nil {
+		return errors.New("storage is not configured")
+	}
+
+	total := cacheStats{}
+	hosts := map[string]cacheStats{}
+
+	err := s.WalkArchives(ctx, func(a storage.StoredArchive) error {
+		var size int64
+		if fi, err := os.Stat(a.Path); err == nil {
+			size = fi.Size()
+		}
+
+		h := hosts[a.Hostname]
+		h.Archives++
+		h.Bytes += size
+		hosts[a.Hostname] = h
+
+		total.Archives++
+		total.Bytes += size
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error walking archives: %w", err)
+	}
+
+	return writeJSON(w, map[string]any{
+		"total":     total,
+		"hostnames": hosts,
+	})
+}
+
+func collectSyncs(ctx context.Context, w io.Writer, s metadata.Service) error {
+	if s == nil {
+		return errors.New("metadata is not configured")
+	}
+
+	degraded := s.GetDegradedProviders(ctx)
+
+	as, err := s.ListProviders(ctx)
+	if err != nil {
+		return fmt.Errorf("error listing providers: %w", err)
+	}
+
+	isDegraded := make(map[string]bool, len(degraded))
+	for _, d := range degraded {
+		isDegraded[d.Hostname+"/"+d.Namespace+"/"+d.Type] = true
+	}
+
+	sort.SliceStable(as, func(i, j int) bool {
+		return isDegraded[as[i].TypedKey()] && !isDegraded[as[j].TypedKey()]
+	})
+
+	if len(as) > MaxSyncHistories {
+		as = as[:MaxSyncHistories]
+	}
+
+	history := make(map[string][]metadata.SyncAttempt, len(as))
+
+	for _, a := range as {
+		h, err := s.GetSyncHistory(ctx, metadata.GetSyncHistoryOptions{
+			Hostname:  a.Hostname,
+			Namespace: a.Namespace,
+			Type:      a.Type,
+		})
+		if err != nil {
+			return fmt.Errorf("error getting sync history of %s: %w", a.TypedKey(), err)
+		}
+
+		if len(h) != 0 {
+			history[a.TypedKey()] = h
+		}
+	}
+
+	return writeJSON(w, map[string]any{
+		"activities": s.GetSyncActivities(ctx),
+		"degraded":   degraded,
+		"history":    history,
+	})
+}
@@ -2,10 +2,16 @@ package provider
 
 import (
 	"context"
+	"time"
 
 	"github.com/seal-io/walrus/utils/cron"
+	"github.com/seal-io/walrus/utils/log"
 
+	"github.com/seal-io/hermitcrab/pkg/maintenance"
 	"github.com/seal-io/hermitcrab/pkg/provider"
+	"github.com/seal-io/hermitcrab/pkg/provider/drift"
+	"github.com/seal-io/hermitcrab/pkg/provider/export"
+	"github.com/seal-io/hermitcrab/pkg/registry"
 )
 
 // SyncMetadata creates a Cron task to sync the metadata from remote to local 30 minutes.
@@ -13,8 +19,101 @@ func SyncMetadata(_ context.Context, providerService *provider.Service) (name st
 	name = "tasks.provider.sync_metadata"
 	expr = cron.ImmediateExpr("0 */30 * ? * *")
 	task = cron.TaskFunc(func(ctx context.Context, args ...any) error {
+		// Skip during the maintenance.
+		if maintenance.Enabled() {
+			return nil
+		}
+
 		return providerService.Metadata.Sync(ctx)
 	})
 
 	return
 }
+
+// ExportOCI creates a Cron task to export the cached archives to the OCI registry per hour.
+func ExportOCI(_ context.Context, exporter *export.OCI) (name string, expr cron.Expr, task cron.Task) {
+	name = "tasks.provider.export_oci"
+	expr = cron.AwaitedExpr("0 0 * ? * *")
+	task = cron.TaskFunc(func(ctx context.Context, args ...any) error {
+		// Skip during the maintenance.
+		if maintenance.Enabled() {
+			return nil
+		}
+
+		return exporter.Export(ctx)
+	})
+
+	return
+}
+
+// CheckClockSkew creates a Cron task to check the clock skew against the upstreams per hour.
+func CheckClockSkew(_ context.Context) (name string, expr cron.Expr, task cron.Task) {
+	name = "tasks.provider.check_clock_skew"
+	expr = cron.ImmediateExpr("0 0 * ? * *")
+	task = cron.TaskFunc(func(ctx context.Context, args ...any) error {
+		return registry.CheckClockSkew(ctx)
+	})
+
+	return
+}
+
+// RemoveStaleDownloads creates a Cron task to remove the downloading archives
+// not written within the given threshold per hour.
+func RemoveStaleDownloads(
+	_ context.Context,
+	providerService *provider.Service,
+	threshold time.Duration,
+) (name string, expr cron.Expr, task cron.Task) {
+	name = "tasks.provider.remove_stale_downloads"
+	expr = cron.AwaitedExpr("0 30 * ? * *")
+	task = cron.TaskFunc(func(ctx context.Context, args ...any) error {
+		// Skip during the maintenance.
+		if maintenance.Enabled() {
+			return nil
+		}
+
+		n, err := providerService.Storage.RemoveStaleDownloads(ctx, threshold)
+		if n != 0 {
+			log.WithName("tasks").WithName("provider").
+				Infof("removed %d stale downloading archives", n)
+		}
+
+		return err
+	})
+
+	return
+}
+
+// CheckDrift creates a Cron task to check the drift between the metadata and the cached archives per day,
+// and repairs the drift if required.
+func CheckDrift(
+	_ context.Context,
+	providerService *provider.Service,
+	repair bool,
+) (name string, expr cron.Expr, task cron.Task) {
+	name = "tasks.provider.check_drift"
+	expr = cron.AwaitedExpr("0 0 3 ? * *")
+	task = cron.TaskFunc(func(ctx context.Context, args ...any) error {
+		// Skip during the maintenance.
+		if maintenance.Enabled() {
+			return nil
+		}
+
+		r, err := drift.Check(ctx, providerService, drift.Options{
+			Repair: repair,
+		})
+		if err != nil {
+			return err
+		}
+
+		if r.Drifted() {
+			log.WithName("tasks").WithName("provider").
+				Warnf("drifted archives: orphaned %d, missing %d, mismatched %d, repaired %v",
+					len(r.Orphaned), len(r.Missing), len(r.Mismatched), r.Repaired)
+		}
+
+		return nil
+	})
+
+	return
+}
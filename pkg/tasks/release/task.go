@@ -0,0 +1,44 @@
+package release
+
+import (
+	"context"
+	"strings"
+
+	"github.com/seal-io/walrus/utils/cron"
+	"go.uber.org/multierr"
+
+	"github.com/seal-io/hermitcrab/pkg/maintenance"
+	"github.com/seal-io/hermitcrab/pkg/provider/drift"
+	"github.com/seal-io/hermitcrab/pkg/release"
+)
+
+// Mirror creates a Cron task to mirror the given releases per hour,
+// the releases are in form of <PRODUCT>@<VERSION>,
+// only the archives of the popular platforms are mirrored.
+func Mirror(
+	_ context.Context,
+	releaseService release.Service,
+	releases []string,
+) (name string, expr cron.Expr, task cron.Task) {
+	name = "tasks.release.mirror"
+	expr = cron.ImmediateExpr("0 0 * ? * *")
+	task = cron.TaskFunc(func(ctx context.Context, args ...any) (err error) {
+		// Skip during the maintenance.
+		if maintenance.Enabled() {
+			return nil
+		}
+
+		for i := range releases {
+			product, version, _ := strings.Cut(releases[i], "@")
+
+			merr := releaseService.Mirror(ctx, product, version, drift.DefaultPopularPlatforms)
+			if merr != nil {
+				err = multierr.Append(err, merr)
+			}
+		}
+
+		return err
+	})
+
+	return
+}
@@ -0,0 +1,132 @@
+package timing
+
+import (
+	"context"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// The phases of the timing breakdown.
+const (
+	// PhaseBolt is the time of querying the metadata database.
+	PhaseBolt = "bolt"
+	// PhaseUpstream is the time of fetching from the upstream,
+	// including waiting for the same fetching.
+	PhaseUpstream = "upstream"
+	// PhaseDisk is the time of reading or writing the archives.
+	PhaseDisk = "disk"
+)
+
+// ContextKey is the key to carry the Breakdown within the context,
+// it must be a string to be found by the gin.Context.
+const ContextKey = "timing.breakdown"
+
+// Breakdown accumulates the time of each phase of a request.
+type Breakdown struct {
+	m sync.Mutex
+	d map[string]time.Duration
+}
+
+// New returns a new Breakdown.
+func New() *Breakdown {
+	return &Breakdown{
+		d: map[string]time.Duration{},
+	}
+}
+
+// NewContext returns a copy of the given context carrying the given Breakdown.
+func NewContext(ctx context.Context, b *Breakdown) context.Context {
+	// nolint:staticcheck
+	return context.WithValue(ctx, ContextKey, b)
+}
+
+// FromContext returns the Breakdown carried by the given context,
+// returns nil if not found.
+func FromContext(ctx context.Context) *Breakdown {
+	if ctx == nil {
+		return nil
+	}
+
+	b, _ := ctx.Value(ContextKey).(*Breakdown)
+
+	return b
+}
+
+// Add adds the given duration to the given phase.
+func (b *Breakdown) Add(phase string, d time.Duration) {
+	if b == nil {
+		return
+	}
+
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	b.d[phase] += d
+}
+
+// LogValues returns the key/value pairs of the phases in order for logging.
+func (b *Breakdown) LogValues() []any {
+	if b == nil {
+		return nil
+	}
+
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	ps := make([]string, 0, len(b.d))
+	for p := range b.d {
+		ps = append(ps, p)
+	}
+
+	sort.Strings(ps)
+
+	kvs := make([]any, 0, 2*len(ps))
+	for _, p := range ps {
+		kvs = append(kvs, p+"_time", b.d[p].String())
+	}
+
+	return kvs
+}
+
+// Track starts timing the given phase of the Breakdown carried by the given context,
+// and returns the function to stop, i.e. defer timing.Track(ctx, timing.PhaseBolt)().
+func Track(ctx context.Context, phase string) func() {
+	b := FromContext(ctx)
+	if b == nil {
+		return func() {}
+	}
+
+	start := time.Now()
+
+	return func() {
+		b.Add(phase, time.Since(start))
+	}
+}
+
+// Reader wraps the given io.ReadCloser to time the reading as the given phase,
+// returns the given io.ReadCloser if the context carries no Breakdown.
+func Reader(ctx context.Context, phase string, rc io.ReadCloser) io.ReadCloser {
+	b := FromContext(ctx)
+	if b == nil || rc == nil {
+		return rc
+	}
+
+	return &reader{ReadCloser: rc, b: b, phase: phase}
+}
+
+type reader struct {
+	io.ReadCloser
+
+	b     *Breakdown
+	phase string
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	start := time.Now()
+	n, err := r.ReadCloser.Read(p)
+	r.b.Add(r.phase, time.Since(start))
+
+	return n, err
+}
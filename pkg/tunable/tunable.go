@@ -0,0 +1,298 @@
+package tunable
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/seal-io/walrus/utils/json"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/seal-io/hermitcrab/pkg/database"
+)
+
+// Tunables holds the knobs adjustable at runtime,
+// the zero value of a knob means the consumer falls back to its own default.
+type Tunables struct {
+	// SyncParallelism is the maximum number of the providers syncing at the same time,
+	// every 10 providers are synced by a worker if not positive.
+	SyncParallelism int `json:"syncParallelism"`
+	// DownloadChunkSize is the bytes of each range requested by the ranged downloads.
+	DownloadChunkSize int64 `json:"downloadChunkSize"`
+	// DocsCacheTTL is the duration of the cached documentation before re-fetching.
+	DocsCacheTTL Duration `json:"docsCacheTTL"`
+	// DiscoveryTTL is the duration of the cached discovery document before re-fetching.
+	DiscoveryTTL Duration `json:"discoveryTTL"`
+	// ArchiveCacheMaxAge is the max-age of the Cache-Control of the served archives.
+	ArchiveCacheMaxAge Duration `json:"archiveCacheMaxAge"`
+}
+
+// Overrides holds the knobs changed at runtime,
+// which are persisted and take precedence over the defaults after restarting.
+type Overrides struct {
+	SyncParallelism    *int      `json:"syncParallelism,omitempty"`
+	DownloadChunkSize  *int64    `json:"downloadChunkSize,omitempty"`
+	DocsCacheTTL       *Duration `json:"docsCacheTTL,omitempty"`
+	DiscoveryTTL       *Duration `json:"discoveryTTL,omitempty"`
+	ArchiveCacheMaxAge *Duration `json:"archiveCacheMaxAge,omitempty"`
+}
+
+// State holds the effective tunables and the overrides of them.
+type State struct {
+	Tunables  Tunables  `json:"tunables"`
+	Overrides Overrides `json:"overrides"`
+}
+
+const (
+	// MinDownloadChunkSize is the minimum bytes of the download chunk.
+	MinDownloadChunkSize = 64 * 1024
+	// MaxDownloadChunkSize is the maximum bytes of the download chunk,
+	// which limits the memory buffering the parallel ranges.
+	MaxDownloadChunkSize = 64 * 1024 * 1024
+)
+
+// Validate returns error if the overrides are invalid.
+func (o Overrides) Validate() error {
+	if o.SyncParallelism != nil && *o.SyncParallelism < 0 {
+		return errors.New("invalid sync parallelism: negative")
+	}
+
+	if o.DownloadChunkSize != nil &&
+		(*o.DownloadChunkSize < MinDownloadChunkSize || *o.DownloadChunkSize > MaxDownloadChunkSize) {
+		return fmt.Errorf("invalid download chunk size: must be in range [%d, %d]",
+			MinDownloadChunkSize, MaxDownloadChunkSize)
+	}
+
+	for n, d := range map[string]*Duration{
+		"docs cache ttl":        o.DocsCacheTTL,
+		"discovery ttl":         o.DiscoveryTTL,
+		"archive cache max age": o.ArchiveCacheMaxAge,
+	} {
+		if d != nil && *d <= 0 {
+			return fmt.Errorf("invalid %s: must be positive", n)
+		}
+	}
+
+	return nil
+}
+
+// merge returns the overrides replaced by the non-nil knobs of the given overrides.
+func (o Overrides) merge(n Overrides) Overrides {
+	if n.SyncParallelism != nil {
+		o.SyncParallelism = n.SyncParallelism
+	}
+
+	if n.DownloadChunkSize != nil {
+		o.DownloadChunkSize = n.DownloadChunkSize
+	}
+
+	if n.DocsCacheTTL != nil {
+		o.DocsCacheTTL = n.DocsCacheTTL
+	}
+
+	if n.DiscoveryTTL != nil {
+		o.DiscoveryTTL = n.DiscoveryTTL
+	}
+
+	if n.ArchiveCacheMaxAge != nil {
+		o.ArchiveCacheMaxAge = n.ArchiveCacheMaxAge
+	}
+
+	return o
+}
+
+// apply returns the given tunables overridden by the overrides.
+func (o Overrides) apply(t Tunables) Tunables {
+	if o.SyncParallelism != nil {
+		t.SyncParallelism = *o.SyncParallelism
+	}
+
+	if o.DownloadChunkSize != nil {
+		t.DownloadChunkSize = *o.DownloadChunkSize
+	}
+
+	if o.DocsCacheTTL != nil {
+		t.DocsCacheTTL = *o.DocsCacheTTL
+	}
+
+	if o.DiscoveryTTL != nil {
+		t.DiscoveryTTL = *o.DiscoveryTTL
+	}
+
+	if o.ArchiveCacheMaxAge != nil {
+		t.ArchiveCacheMaxAge = *o.ArchiveCacheMaxAge
+	}
+
+	return t
+}
+
+// ConfigureOptions holds the options of configuring the tunables.
+type ConfigureOptions struct {
+	// BoltDriver persists the overrides if specified,
+	// otherwise, the overrides are only kept in memory.
+	BoltDriver database.BoltDriver
+	// Defaults holds the tunables without overrides, i.e. the ones configured by the flags.
+	Defaults Tunables
+}
+
+// domain is the bucket of the tunables,
+// takes a look of the bucket structure:
+//
+//	BUCKET(tunables)
+//	  KEY(overrides): Overrides
+const domain = "tunables"
+
+var overridesKey = []byte("overrides")
+
+var (
+	m         sync.Mutex
+	config    ConfigureOptions
+	overrides Overrides
+	effective atomic.Pointer[Tunables]
+)
+
+// Configure configures the defaults of the tunables,
+// and restores the persisted overrides.
+func Configure(opts ConfigureOptions) error {
+	m.Lock()
+	defer m.Unlock()
+
+	var o Overrides
+
+	if opts.BoltDriver != nil {
+		err := opts.BoltDriver.Update(func(tx *bolt.Tx) error {
+			b, err := tx.CreateBucketIfNotExists([]byte(domain))
+			if err != nil {
+				return err
+			}
+
+			if v := b.Get(overridesKey); v != nil {
+				return json.Unmarshal(v, &o)
+			}
+
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("error restoring tunables: %w", err)
+		}
+	}
+
+	config = opts
+	store(o)
+
+	return nil
+}
+
+// Get returns the effective tunables.
+func Get() Tunables {
+	if t := effective.Load(); t != nil {
+		return *t
+	}
+
+	return Tunables{}
+}
+
+// GetState returns the effective tunables and the overrides of them.
+func GetState() State {
+	m.Lock()
+	defer m.Unlock()
+
+	return State{
+		Tunables:  Get(),
+		Overrides: overrides,
+	}
+}
+
+// Update overrides the tunables by the non-nil knobs of the given overrides,
+// and persists the overrides.
+func Update(o Overrides) (State, error) {
+	if err := o.Validate(); err != nil {
+		return State{}, err
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	n := overrides.merge(o)
+	if err := persist(n); err != nil {
+		return State{}, err
+	}
+
+	store(n)
+
+	return State{Tunables: Get(), Overrides: overrides}, nil
+}
+
+// Reset deletes all overrides, the tunables fall back to the defaults.
+func Reset() (State, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	if err := persist(Overrides{}); err != nil {
+		return State{}, err
+	}
+
+	store(Overrides{})
+
+	return State{Tunables: Get(), Overrides: overrides}, nil
+}
+
+// store keeps the given overrides and refreshes the effective tunables,
+// must be called with the lock held.
+func store(o Overrides) {
+	overrides = o
+	t := o.apply(config.Defaults)
+	effective.Store(&t)
+}
+
+// persist writes the given overrides into the database if configured,
+// must be called with the lock held.
+func persist(o Overrides) error {
+	if config.BoltDriver == nil {
+		return nil
+	}
+
+	v, err := json.Marshal(o)
+	if err != nil {
+		return fmt.Errorf("error marshaling tunables: %w", err)
+	}
+
+	err = config.BoltDriver.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(domain)).Put(overridesKey, v)
+	})
+	if err != nil {
+		return fmt.Errorf("error persisting tunables: %w", err)
+	}
+
+	return nil
+}
+
+// Duration is a time.Duration encoded as the duration string in JSON, i.e. 24h0m0s.
+type Duration time.Duration
+
+// Std returns the time.Duration.
+func (d Duration) Std() time.Duration {
+	return time.Duration(d)
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(v)
+
+	return nil
+}
@@ -0,0 +1,67 @@
+package tunable
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestUpdate(t *testing.T) {
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "test.db"), 0o600, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+
+	opts := ConfigureOptions{
+		BoltDriver: db,
+		Defaults: Tunables{
+			DownloadChunkSize: 2 * 1024 * 1024,
+			DocsCacheTTL:      Duration(24 * time.Hour),
+		},
+	}
+
+	require.NoError(t, Configure(opts))
+	assert.Equal(t, opts.Defaults, Get())
+
+	_, err = Update(Overrides{DownloadChunkSize: ptr[int64](1)})
+	assert.Error(t, err, "the chunk size below the minimum must be refused")
+
+	s, err := Update(Overrides{
+		SyncParallelism: ptr(4),
+		DocsCacheTTL:    ptr(Duration(time.Hour)),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 4, s.Tunables.SyncParallelism)
+	assert.Equal(t, Duration(time.Hour), s.Tunables.DocsCacheTTL)
+	assert.Equal(t, int64(2*1024*1024), s.Tunables.DownloadChunkSize)
+
+	// Merge with the previous overrides.
+	_, err = Update(Overrides{DownloadChunkSize: ptr[int64](MinDownloadChunkSize)})
+	require.NoError(t, err)
+	assert.Equal(t, 4, Get().SyncParallelism)
+
+	// Restore the overrides after restarting.
+	require.NoError(t, Configure(opts))
+
+	expected := Tunables{
+		SyncParallelism:   4,
+		DownloadChunkSize: MinDownloadChunkSize,
+		DocsCacheTTL:      Duration(time.Hour),
+	}
+	assert.Equal(t, expected, Get())
+
+	s, err = Reset()
+	require.NoError(t, err)
+	assert.Equal(t, opts.Defaults, s.Tunables)
+	assert.Equal(t, Overrides{}, s.Overrides)
+
+	require.NoError(t, Configure(opts))
+	assert.Equal(t, opts.Defaults, Get())
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}